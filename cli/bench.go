@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf"
+)
+
+type benchFlagopts struct {
+	Count       *int     `long:"count" args:"number" description:"run the query this many times (default 100)"`
+	Warmup      *int     `long:"warmup" args:"number" description:"runs before measuring, to fill caches (default 3)"`
+	InputNull   bool     `short:"n" long:"null-input" description:"use null as input value"`
+	InputRaw    bool     `short:"R" long:"raw-input" description:"read input as raw strings"`
+	InputYAML   bool     `long:"yaml-input" description:"read input as YAML format"`
+	InputSlurp  bool     `short:"s" long:"slurp" description:"read all inputs into an array"`
+	ModulePaths []string `short:"L" long:"library-path" args:"dir" description:"directory to search modules from"`
+	JSON        bool     `long:"json" description:"print the results as JSON"`
+	NoConfig    bool     `long:"no-config" description:"ignore the config file"`
+	Help        bool     `short:"h" long:"help" description:"display this help information"`
+}
+
+// benchResult is what bench reports, in JSON with --json
+type benchResult struct {
+	Query       string  `json:"query"`
+	Inputs      int     `json:"inputs"`
+	InputBytes  int     `json:"input_bytes"`
+	Runs        int     `json:"runs"`
+	Warmup      int     `json:"warmup"`
+	Results     int     `json:"results_per_run"`
+	MinMS       float64 `json:"min_ms"`
+	MeanMS      float64 `json:"mean_ms"`
+	P50MS       float64 `json:"p50_ms"`
+	P95MS       float64 `json:"p95_ms"`
+	P99MS       float64 `json:"p99_ms"`
+	MaxMS       float64 `json:"max_ms"`
+	Allocs      uint64  `json:"allocs_per_run"`
+	AllocBytes  uint64  `json:"alloc_bytes_per_run"`
+	RunsPerSec  float64 `json:"runs_per_sec"`
+	BytesPerSec float64 `json:"bytes_per_sec"`
+}
+
+// runBench implements the bench subcommand:
+//
+//	pwrq bench [OPTIONS] QUERY [FILE...]
+//
+// The inputs are read once, and the query runs on all of them --count
+// times, so that only the query is measured
+func (cli *cli) runBench(args []string) error {
+	var opts benchFlagopts
+	args, err := parseFlags(args, &opts)
+	if err != nil {
+		return &flagParseError{err}
+	}
+	if opts.Help {
+		fmt.Fprintf(cli.outStream, `%[1]s bench - measure how fast a query runs
+
+Usage:
+  %[1]s bench [OPTIONS] QUERY [FILE...]
+
+The inputs are read once, from FILE or standard input, and kept in memory,
+so reading and printing are left out of the measurements.
+
+`, name)
+		fmt.Fprintln(cli.outStream, formatFlags(&opts))
+		return nil
+	}
+	if len(args) == 0 {
+		return &flagParseError{errors.New("expected a query")}
+	}
+	runs, warmup := 100, 3
+	if opts.Count != nil {
+		if runs = *opts.Count; runs < 1 {
+			return &flagParseError{fmt.Errorf("run count must be positive: %d", runs)}
+		}
+	}
+	if opts.Warmup != nil {
+		if warmup = *opts.Warmup; warmup < 0 {
+			return &flagParseError{fmt.Errorf("warmup count must not be negative: %d", warmup)}
+		}
+	}
+	src := strings.TrimSpace(args[0])
+	query, err := gojq.Parse(src)
+	if err != nil {
+		return &queryParseError{"<arg>", src, err}
+	}
+
+	if err := cli.loadConfig(opts.NoConfig); err != nil {
+		cli.closePlugins()
+		return err
+	}
+	defer cli.closePlugins()
+	if err := cli.checkCalls(query); err != nil {
+		return err
+	}
+	code, err := gojq.Compile(query, append(append([]gojq.CompilerOption{
+		gojq.WithModuleLoader(cli.moduleLoader(opts.ModulePaths)),
+		gojq.WithEnvironLoader(os.Environ),
+		gojq.WithFunction("debug", 0, 0, cli.funcDebug),
+		gojq.WithFunction("stderr", 0, 0, cli.funcStderr),
+	}, udf.DefaultRegistry().Options()...), cli.pluginOptions()...)...)
+	if err != nil {
+		return &compileError{err}
+	}
+
+	inputs := []any{nil}
+	if !opts.InputNull {
+		cli.inputRaw, cli.inputYAML, cli.inputSlurp = opts.InputRaw, opts.InputYAML, opts.InputSlurp
+		if inputs, err = cli.readInputs(args[1:]); err != nil {
+			return err
+		}
+	}
+	result := benchResult{Query: src, Inputs: len(inputs), Runs: runs, Warmup: warmup}
+	for _, v := range inputs {
+		if b, err := gojq.Marshal(v); err == nil {
+			result.InputBytes += len(b)
+		}
+	}
+
+	run := func() (int, error) {
+		var n int
+		for _, input := range inputs {
+			iter := code.Run(input)
+			for {
+				v, ok := iter.Next()
+				if !ok {
+					break
+				}
+				if err, ok := v.(error); ok {
+					if err, ok := err.(*gojq.HaltError); ok && err.Value() == nil {
+						break
+					}
+					return n, err
+				}
+				n++
+			}
+		}
+		return n, nil
+	}
+	for range warmup {
+		if _, err := run(); err != nil {
+			return err
+		}
+	}
+	times := make([]time.Duration, runs)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := range times {
+		t := time.Now()
+		if result.Results, err = run(); err != nil {
+			return err
+		}
+		times[i] = time.Since(t)
+	}
+	total := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	slices.Sort(times)
+	result.MinMS, result.MaxMS = benchMS(times[0]), benchMS(times[runs-1])
+	result.MeanMS = benchMS(total / time.Duration(runs))
+	result.P50MS = benchMS(percentile(times, 50))
+	result.P95MS = benchMS(percentile(times, 95))
+	result.P99MS = benchMS(percentile(times, 99))
+	result.Allocs = (after.Mallocs - before.Mallocs) / uint64(runs)
+	result.AllocBytes = (after.TotalAlloc - before.TotalAlloc) / uint64(runs)
+	if secs := total.Seconds(); secs > 0 {
+		result.RunsPerSec = math.Round(float64(runs)/secs*10) / 10
+		result.BytesPerSec = math.Round(float64(result.InputBytes*runs) / secs)
+	}
+
+	if opts.JSON {
+		enc := json.NewEncoder(cli.outStream)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	fmt.Fprintf(cli.outStream, `query:      %s
+inputs:     %d (%s)
+runs:       %d, after %d warmup
+results:    %d per run
+latency:    min %s  p50 %s  p95 %s  p99 %s  max %s  mean %s
+allocs:     %d per run (%s)
+throughput: %.1f runs/s, %s/s
+`, result.Query, result.Inputs, formatBytes(int64(result.InputBytes)), runs, warmup, result.Results,
+		benchDuration(times[0]), benchDuration(percentile(times, 50)), benchDuration(percentile(times, 95)),
+		benchDuration(percentile(times, 99)), benchDuration(times[runs-1]), benchDuration(total/time.Duration(runs)),
+		result.Allocs, formatBytes(int64(result.AllocBytes)),
+		result.RunsPerSec, formatBytes(int64(result.BytesPerSec)))
+	return nil
+}
+
+// percentile returns the p-th percentile of sorted times, by nearest rank
+func percentile(times []time.Duration, p int) time.Duration {
+	i := (len(times)*p + 99) / 100
+	return times[max(i, 1)-1]
+}
+
+func benchMS(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*1000) / 1000
+}
+
+// benchDuration shows a duration with three significant digits or so, like
+// 1.25ms or 312µs
+func benchDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	case d >= time.Microsecond:
+		return d.Round(100 * time.Nanosecond).String()
+	}
+	return d.String()
+}
@@ -2,18 +2,24 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/mattn/go-isatty"
 
 	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/graph"
 	"github.com/xen0bit/pwrq/pkg/udf"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	"github.com/xen0bit/pwrq/pkg/udf/plugin"
 )
 
 const name = "pwrq"
@@ -43,16 +49,31 @@ type cli struct {
 	outputIndent  *int
 	outputTab     bool
 	outputYAML    bool
+	outputTable   *tableMarshaler
 	inputRaw      bool
 	inputStream   bool
+	inputElements bool
 	inputYAML     bool
 	inputSlurp    bool
+	inputJSONL    bool
+
+	parallel          int
+	parallelUnordered bool
+
+	ctx     context.Context
+	timeout time.Duration
+
+	query string // recorded in the history file
+
+	config  config
+	plugins []*plugin.Plugin
 
 	argnames  []string
 	argvalues []any
 
 	outputYAMLSeparator bool
 	exitCodeError       error
+	udfFailed           atomic.Bool // a UDF returned an _err, for -e
 }
 
 type flagopts struct {
@@ -63,13 +84,23 @@ type flagopts struct {
 	OutputIndent  *int              `long:"indent" args:"number" description:"number of spaces for indentation"`
 	OutputTab     bool              `long:"tab" description:"use tabs for indentation"`
 	OutputYAML    bool              `long:"yaml-output" description:"output in YAML format"`
+	OutputCSV     bool              `long:"csv" description:"output objects and arrays as CSV rows"`
+	OutputTSV     bool              `long:"tsv" description:"output objects and arrays as TSV rows"`
+	OutputFormat  string            `long:"output-format" args:"format" description:"output as json, jsonl, yaml, csv, tsv or raw"`
+	Output        string            `short:"o" long:"output" args:"file" description:"write the results to this file once the query succeeds"`
 	OutputColor   bool              `short:"C" long:"color-output" description:"output with colors even if piped"`
 	OutputMono    bool              `short:"M" long:"monochrome-output" description:"output without colors"`
+	Color         bool              `long:"color" description:"same as -C"`
+	NoColor       bool              `long:"no-color" description:"same as -M"`
 	InputNull     bool              `short:"n" long:"null-input" description:"use null as input value"`
 	InputRaw      bool              `short:"R" long:"raw-input" description:"read input as raw strings"`
 	InputStream   bool              `long:"stream" description:"parse input in stream fashion"`
+	InputElements bool              `long:"stream-elements" description:"read each element of top-level arrays as an input"`
 	InputYAML     bool              `long:"yaml-input" description:"read input as YAML format"`
 	InputSlurp    bool              `short:"s" long:"slurp" description:"read all inputs into an array"`
+	JSONL         bool              `long:"jsonl" description:"read and write newline-delimited JSON"`
+	Parallel      *int              `short:"P" long:"parallel" args:"number" description:"run the query on this many inputs at once"`
+	Unordered     bool              `long:"unordered" description:"with -P, print results as soon as they are ready"`
 	FromFile      bool              `short:"f" long:"from-file" description:"load query from file"`
 	ModulePaths   []string          `short:"L" long:"library-path" args:"dir" description:"directory to search modules from"`
 	Arg           map[string]string `long:"arg" args:"name value" description:"set a string value to a variable"`
@@ -78,17 +109,62 @@ type flagopts struct {
 	RawFile       map[string]string `long:"rawfile" args:"name file" description:"set the contents of a file to a variable"`
 	Args          []any             `long:"args" positional:"" description:"consume remaining arguments as positional string values"`
 	JSONArgs      []any             `long:"jsonargs" positional:"" description:"consume remaining arguments as positional JSON values"`
-	ExitStatus    bool              `short:"e" long:"exit-status" description:"exit 1 when the last value is false or null"`
+	ExitStatus    bool              `short:"e" long:"exit-status" description:"exit 1 when the last value is false or null, or a UDF returned an _err"`
 	Version       bool              `short:"v" long:"version" description:"display version information"`
 	Help          bool              `short:"h" long:"help" description:"display this help information"`
 	UDFList       bool              `short:"u" long:"udf-list" description:"list all available user-defined functions"`
-	Graph         string            `short:"g" long:"graph" args:"output.png" description:"generate a D2 diagram of the query flow and save to PNG file"`
+	Graph         string            `short:"g" long:"graph" args:"output.svg" description:"generate a D2 diagram of the query flow and save it (.d2, .mmd, .json, .svg, .png or .pdf)"`
 	IDE           bool              `short:"i" long:"ide" description:"launch IDE web interface"`
+	NoConfig      bool              `long:"no-config" description:"ignore the config file"`
+	NoNet         bool              `long:"no-net" description:"disable network access from UDFs"`
+	NoFS          bool              `long:"no-fs" description:"disable file access from UDFs"`
+	ReadOnly      bool              `long:"read-only" description:"let UDFs read files but not change them"`
+	AllowPaths    []string          `long:"allow-path" args:"dir" description:"limit UDF file access to this directory"`
+	AllowHosts    []string          `long:"allow-host" args:"host" description:"limit UDF network access to this host"`
+	Audit         string            `long:"audit" args:"file" description:"append a JSON line for each file, network and command UDF call"`
+	Timeout       string            `long:"timeout" args:"duration" description:"stop the query after this long"`
+	UDFTimeout    string            `long:"udf-timeout" args:"duration" description:"limit each network and command UDF call to this long"`
+	Cache         string            `long:"cache" args:"dir" description:"cache the responses of http GET requests in this directory"`
+	CacheTTL      string            `long:"cache-ttl" args:"duration" description:"keep cached responses this long unless they say otherwise (default 1h)"`
+	RateLimit     string            `long:"rate-limit" args:"rate" description:"limit http requests to this rate, like 10/s, 100/m or 1000/h"`
+	HostRateLimit []string          `long:"host-rate-limit" args:"host=rate" description:"limit http requests to a host and its subdomains to this rate"`
+	Profile       bool              `long:"profile" description:"print the time and data spent in each UDF to stderr"`
+	ProfileJSON   bool              `long:"profile-json" description:"implies --profile with a JSON summary"`
+	ProfileGraph  string            `long:"profile-graph" args:"output.svg" description:"run the query, then save its graph annotated with the time and data spent in each UDF"`
+	ErrorGraph    string            `long:"error-graph" args:"output.svg" description:"run the query, and if a UDF returned an _err, save its graph with the failing functions in red"`
+	Progress      bool              `long:"progress" description:"show the progress of long file reads and downloads on stderr"`
+	ProgressJSON  bool              `long:"progress-json" description:"implies --progress with JSON lines"`
+	Trace         bool              `long:"trace" description:"log each UDF call with its input, arguments and output to stderr"`
+	Provenance    bool              `long:"provenance" description:"record each UDF that led to a result in its _meta.chain"`
+	Watch         bool              `short:"w" long:"watch" description:"run the query again whenever an input file changes"`
 }
 
 var addDefaultModulePaths = true
 
-func (cli *cli) run(args []string) int {
+// defaultModulePaths are searched for import and include when no -L is
+// given. ~/.pwrq/modules comes first so shared libraries need not be
+// mixed with jq's own
+var defaultModulePaths = []string{"~/.pwrq/modules", "~/.jq", "$ORIGIN/../lib/pwrq", "$ORIGIN/../lib"}
+
+// moduleLoader resolves modules from paths, or else from the config file's
+// library_path or defaultModulePaths. Modules are held to the categories
+// enabled in the config file, like the query
+func (cli *cli) moduleLoader(paths []string) gojq.ModuleLoader {
+	if len(paths) == 0 {
+		paths = cli.config.LibraryPath
+	}
+	if len(paths) == 0 && addDefaultModulePaths {
+		paths = defaultModulePaths
+	}
+	loader := gojq.NewModuleLoader(paths)
+	if cli.config.Categories == nil {
+		return loader
+	}
+	return &checkedModuleLoader{loader: loader.(metaModuleLoader), check: cli.checkCalls}
+}
+
+func (cli *cli) run(args []string) (code int) {
+	defer func() { cli.recordQuery(code) }()
 	if err := cli.runInternal(args); err != nil {
 		if _, ok := err.(interface{ isEmptyError() }); !ok {
 			fmt.Fprintf(cli.errStream, "%s: %s\n", name, err)
@@ -102,6 +178,27 @@ func (cli *cli) run(args []string) int {
 }
 
 func (cli *cli) runInternal(args []string) (err error) {
+	if len(args) > 0 && args[0] == "graph" {
+		return cli.runGraph(args[1:])
+	}
+	if len(args) > 0 && args[0] == "repl" {
+		return cli.runREPL(args[1:])
+	}
+	if len(args) > 0 && args[0] == "funcs" {
+		return cli.runFuncs(args[1:])
+	}
+	if len(args) > 0 && args[0] == "history" {
+		return cli.runHistory(args[1:])
+	}
+	if len(args) > 0 && args[0] == "bench" {
+		return cli.runBench(args[1:])
+	}
+	if len(args) > 0 && args[0] == "lint" {
+		return cli.runLint(args[1:])
+	}
+	if len(args) > 0 && args[0] == "fmt" {
+		return cli.runFmt(args[1:])
+	}
 	var opts flagopts
 	args, err = parseFlags(args, &opts)
 	if err != nil {
@@ -117,6 +214,13 @@ Synopsis:
 
 Usage:
   %[1]s [OPTIONS]
+  %[1]s graph [OPTIONS] QUERY [OUTPUT]
+  %[1]s repl [OPTIONS] [FILE...]
+  %[1]s funcs [OPTIONS] [NAME|CATEGORY]
+  %[1]s history [OPTIONS] [TEXT]
+  %[1]s bench [OPTIONS] QUERY [FILE...]
+  %[1]s lint [OPTIONS] QUERY...
+  %[1]s fmt [OPTIONS] [QUERY]
 
 `,
 			name, version, revision, runtime.Version())
@@ -127,6 +231,31 @@ Usage:
 		fmt.Fprintf(cli.outStream, "%s %s (rev: %s/%s)\n", name, version, revision, runtime.Version())
 		return nil
 	}
+	if err := cli.loadConfig(opts.NoConfig); err != nil {
+		cli.closePlugins()
+		return err
+	}
+	defer cli.closePlugins()
+	if err := common.SetPolicy(common.Policy{
+		NoNet:    opts.NoNet,
+		NoFS:     opts.NoFS,
+		ReadOnly: opts.ReadOnly,
+		Paths:    opts.AllowPaths,
+		Hosts:    opts.AllowHosts,
+	}); err != nil {
+		return err
+	}
+	if opts.Audit != "" {
+		f, err := os.OpenFile(opts.Audit, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		common.SetAuditLog(f)
+		defer func() {
+			common.SetAuditLog(nil)
+			f.Close()
+		}()
+	}
 	if opts.UDFList {
 		cli.printUDFList()
 		return nil
@@ -134,13 +263,88 @@ Usage:
 	if opts.IDE {
 		return cli.launchIDE()
 	}
+	cli.ctx = context.Background()
+	cli.timeout = cli.config.timeout
+	if opts.Timeout != "" {
+		if cli.timeout, err = parseTimeout("timeout", opts.Timeout); err != nil {
+			return &flagParseError{err}
+		}
+	}
+	if cli.timeout > 0 {
+		var cancel context.CancelFunc
+		cli.ctx, cancel = context.WithTimeout(cli.ctx, cli.timeout)
+		defer cancel()
+	}
+	udfTimeout := cli.config.udfTimeout
+	if opts.UDFTimeout != "" {
+		if udfTimeout, err = parseTimeout("udf-timeout", opts.UDFTimeout); err != nil {
+			return &flagParseError{err}
+		}
+	}
+	common.SetContext(cli.ctx, udfTimeout)
+	defer common.SetContext(context.Background(), 0)
+	if opts.Cache != "" {
+		ttl := time.Hour
+		if opts.CacheTTL != "" {
+			if ttl, err = parseTimeout("cache-ttl", opts.CacheTTL); err != nil {
+				return &flagParseError{err}
+			}
+		}
+		common.SetCache(opts.Cache, ttl)
+		defer common.SetCache("", 0)
+	} else if opts.CacheTTL != "" {
+		return &flagParseError{errors.New("--cache-ttl requires --cache")}
+	}
+	if opts.RateLimit != "" || len(opts.HostRateLimit) > 0 {
+		var global common.Rate
+		if opts.RateLimit != "" {
+			if global, err = common.ParseRate(opts.RateLimit); err != nil {
+				return &flagParseError{fmt.Errorf("invalid --rate-limit: %w", err)}
+			}
+		}
+		hosts := map[string]common.Rate{}
+		for _, limit := range opts.HostRateLimit {
+			host, rate, ok := strings.Cut(limit, "=")
+			if !ok || host == "" {
+				return &flagParseError{fmt.Errorf("invalid --host-rate-limit: %q is not host=rate", limit)}
+			}
+			if hosts[host], err = common.ParseRate(rate); err != nil {
+				return &flagParseError{fmt.Errorf("invalid --host-rate-limit: %w", err)}
+			}
+		}
+		common.SetRateLimits(global, hosts)
+		defer common.SetRateLimits(common.Rate{}, nil)
+	}
+	if err := opts.setOutputFormat(); err != nil {
+		return &flagParseError{err}
+	}
+	if opts.Output != "" {
+		if opts.Watch {
+			return errors.New("cannot use --output with --watch")
+		}
+		var out *outputFile
+		if out, err = createOutputFile(opts.Output); err != nil {
+			return err
+		}
+		cli.outStream = out.tmp
+		defer func() {
+			if !completed(err) {
+				out.abort()
+			} else if e := out.commit(); e != nil {
+				err = e
+			}
+		}()
+	}
 	cli.outputRaw, cli.outputRaw0, cli.outputJoin,
 		cli.outputCompact, cli.outputIndent, cli.outputTab, cli.outputYAML =
 		opts.OutputRaw, opts.OutputRaw0, opts.OutputJoin,
 		opts.OutputCompact, opts.OutputIndent, opts.OutputTab, opts.OutputYAML
+	if cli.outputIndent == nil {
+		cli.outputIndent = cli.config.Indent
+	}
 	defer func(x bool) { noColor = x }(noColor)
-	if opts.OutputColor || opts.OutputMono {
-		noColor = opts.OutputMono
+	if color, mono := opts.OutputColor || opts.Color, opts.OutputMono || opts.NoColor; color || mono {
+		noColor = mono
 	} else if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
 		noColor = true
 	} else {
@@ -157,6 +361,10 @@ Usage:
 			if err := setColors(colors); err != nil {
 				return err
 			}
+		} else if colors := cli.config.Colors; colors != "" {
+			if err := setColors(colors); err != nil {
+				return fmt.Errorf("invalid config file %s: %w", cli.config.path, err)
+			}
 		}
 	}
 	if i := cli.outputIndent; i != nil {
@@ -166,11 +374,73 @@ Usage:
 			return fmt.Errorf("negative indentation count: %d", *i)
 		}
 	}
+	if p := opts.Parallel; p != nil {
+		if *p < 1 {
+			return fmt.Errorf("parallel count must be positive: %d", *p)
+		}
+		cli.parallel, cli.parallelUnordered = *p, opts.Unordered
+	}
 	if opts.OutputYAML && opts.OutputTab {
 		return errors.New("cannot use tabs for YAML output")
 	}
-	cli.inputRaw, cli.inputStream, cli.inputYAML, cli.inputSlurp =
-		opts.InputRaw, opts.InputStream, opts.InputYAML, opts.InputSlurp
+	if opts.OutputCSV || opts.OutputTSV {
+		table := "--tsv"
+		if opts.OutputCSV {
+			table = "--csv"
+		}
+		for _, f := range []struct {
+			set  bool
+			flag string
+		}{
+			{opts.OutputCSV && opts.OutputTSV, "--tsv"},
+			{opts.OutputYAML, "--yaml-output"},
+			{opts.OutputRaw0, "--raw-output0"},
+			{opts.OutputJoin, "--join-output"},
+			{opts.JSONL, "--jsonl"},
+		} {
+			if f.set {
+				return fmt.Errorf("cannot use %s with %s", f.flag, table)
+			}
+		}
+		cli.outputTable = &tableMarshaler{tsv: opts.OutputTSV}
+	}
+	if opts.JSONL {
+		for _, f := range []struct {
+			set  bool
+			flag string
+		}{
+			{opts.InputRaw, "--raw-input"},
+			{opts.InputStream, "--stream"},
+			{opts.InputElements, "--stream-elements"},
+			{opts.InputYAML, "--yaml-input"},
+			{opts.OutputYAML, "--yaml-output"},
+			{opts.OutputTab, "--tab"},
+			{opts.OutputIndent != nil, "--indent"},
+		} {
+			if f.set {
+				return fmt.Errorf("cannot use %s with --jsonl", f.flag)
+			}
+		}
+		// Each output value goes on its own line
+		cli.outputCompact = true
+	}
+	if opts.InputElements {
+		for _, f := range []struct {
+			set  bool
+			flag string
+		}{
+			{opts.InputRaw, "--raw-input"},
+			{opts.InputStream, "--stream"},
+			{opts.InputYAML, "--yaml-input"},
+		} {
+			if f.set {
+				return fmt.Errorf("cannot use %s with --stream-elements", f.flag)
+			}
+		}
+	}
+	cli.inputRaw, cli.inputStream, cli.inputYAML, cli.inputSlurp, cli.inputJSONL =
+		opts.InputRaw, opts.InputStream, opts.InputYAML, opts.InputSlurp, opts.JSONL
+	cli.inputElements = opts.InputElements
 	for k, v := range opts.Arg {
 		cli.argnames = append(cli.argnames, "$"+k)
 		cli.argvalues = append(cli.argvalues, v)
@@ -237,13 +507,27 @@ Usage:
 	} else {
 		arg, args, fname = strings.TrimSpace(args[0]), args[1:], "<arg>"
 	}
+	cli.query = arg
+	if opts.Watch && len(args) == 0 {
+		return errors.New("--watch requires input files")
+	}
 	if opts.ExitStatus {
 		cli.exitCodeError = &exitCodeError{exitCodeNoValueErr}
 		defer func() {
 			if _, ok := err.(interface{ ExitCode() int }); !ok {
 				err = cli.exitCodeError
+				// A failed UDF call fails the run even when the query went on
+				// to print something truthy
+				if e, ok := err.(*exitCodeError); ok && e.code == exitCodeOK && cli.udfFailed.Load() {
+					err = &exitCodeError{exitCodeFalsyErr}
+				}
 			}
 		}()
+		defer common.AddCallObserver(func(c common.Call) {
+			if common.HasUDFError(c.Output) {
+				cli.udfFailed.Store(true)
+			}
+		})()
 	}
 	query, err := gojq.Parse(arg)
 	if err != nil {
@@ -251,8 +535,11 @@ Usage:
 	}
 
 	// Handle graph generation flag
+	if opts.Graph != "" && (opts.ProfileGraph != "" || opts.ErrorGraph != "") {
+		return &flagParseError{errors.New("--graph does not run the query; use --profile-graph or --error-graph alone")}
+	}
 	if opts.Graph != "" {
-		err := graph.GenerateGraph(query, opts.Graph)
+		err := graph.GenerateGraph(query, opts.Graph, graph.GraphOptions{})
 		if err != nil {
 			return fmt.Errorf("failed to generate graph: %w", err)
 		}
@@ -260,12 +547,17 @@ Usage:
 		return nil
 	}
 
-	modulePaths := opts.ModulePaths
-	if len(modulePaths) == 0 && addDefaultModulePaths {
-		modulePaths = []string{"~/.jq", "$ORIGIN/../lib/pwrq", "$ORIGIN/../lib"}
-	}
 	iter := cli.createInputIter(args)
+	var rerun *rerunInputIter
+	if opts.Watch {
+		rerun = &rerunInputIter{inputIter: iter, open: func() inputIter { return cli.createInputIter(args) }}
+		iter = rerun
+	}
 	defer iter.Close()
+	if cli.parallel > 1 {
+		iter = &lockedInputIter{inputIter: iter}
+		cli.errStream = &lockedWriter{w: cli.errStream}
+	}
 
 	// Get UDF registry and apply all registered functions
 	udfRegistry := udf.DefaultRegistry()
@@ -273,7 +565,7 @@ Usage:
 
 	// Build compiler options
 	options := []gojq.CompilerOption{
-		gojq.WithModuleLoader(gojq.NewModuleLoader(modulePaths)),
+		gojq.WithModuleLoader(cli.moduleLoader(opts.ModulePaths)),
 		gojq.WithEnvironLoader(os.Environ),
 		gojq.WithVariables(cli.argnames),
 		gojq.WithFunction("debug", 0, 0, cli.funcDebug),
@@ -293,8 +585,21 @@ Usage:
 
 	// Add all UDF options
 	options = append(options, udfOptions...)
+	options = append(options, cli.pluginOptions()...)
 
+	if err := cli.checkCalls(query); err != nil {
+		return &compileError{err}
+	}
+	profiling := opts.Profile || opts.ProfileJSON || opts.ProfileGraph != "" || opts.ErrorGraph != ""
+	restoreCalls := func() {}
+	if profiling {
+		// Tell the calls of a function at different places apart
+		var siteOptions []gojq.CompilerOption
+		siteOptions, restoreCalls = udf.WithCallSites(query)
+		options = append(options, siteOptions...)
+	}
 	code, err := gojq.Compile(query, options...)
+	restoreCalls()
 	if err != nil {
 		if err, ok := err.(interface {
 			QueryParseError() (string, string, error)
@@ -310,12 +615,71 @@ Usage:
 		}
 		return &compileError{err}
 	}
+	if profiling {
+		p := newProfile(udf.CallSites(query))
+		remove := common.AddCallObserver(p.observe)
+		defer func() {
+			remove()
+			if opts.Profile || opts.ProfileJSON {
+				p.write(cli.errStream, opts.ProfileJSON)
+			}
+			errs, siteErrs := p.graphErrors()
+			if opts.ProfileGraph != "" {
+				gerr := cli.saveGraph(query, opts.ProfileGraph, graph.GraphOptions{
+					Stats: p.graphStats(), Errors: errs,
+					SiteStats: p.graphSiteStats(), SiteErrors: siteErrs,
+				})
+				if err == nil {
+					err = gerr
+				}
+			}
+			if opts.ErrorGraph != "" && len(errs) > 0 {
+				gerr := cli.saveGraph(query, opts.ErrorGraph, graph.GraphOptions{Errors: errs, SiteErrors: siteErrs})
+				if err == nil {
+					err = gerr
+				}
+			}
+		}()
+	}
+	if opts.Trace {
+		defer common.AddCallObserver(cli.traceCall)()
+	}
+	if opts.Provenance {
+		common.SetProvenance(true)
+		defer common.SetProvenance(false)
+	}
+	if opts.Progress || opts.ProgressJSON {
+		p := cli.newProgress(opts.ProgressJSON)
+		common.SetProgress(p.update, p.interval)
+		defer common.SetProgress(nil, 0)
+	}
+	if opts.Watch {
+		return cli.watchInputs(args, func() error {
+			if opts.InputNull {
+				return cli.process(newNullInputIter(), code)
+			}
+			return cli.process(iter, code)
+		}, rerun.reset)
+	}
 	if opts.InputNull {
 		iter = newNullInputIter()
 	}
 	return cli.process(iter, code)
 }
 
+// saveGraph renders the graph of a query that has run, reporting the file on
+// stderr so that it doesn't mix with the results
+func (cli *cli) saveGraph(query *gojq.Query, output string, opts graph.GraphOptions) error {
+	if opts.Theme == "" {
+		opts.Theme = cli.config.Theme
+	}
+	if err := graph.GenerateGraph(query, output, opts); err != nil {
+		return fmt.Errorf("failed to generate graph: %w", err)
+	}
+	fmt.Fprintf(cli.errStream, "Graph generated: %s\n", output)
+	return nil
+}
+
 func slurpFile(name string) (any, error) {
 	iter := newSlurpInputIter(
 		newFilesInputIter(newJSONInputIter, []string{name}, nil),
@@ -339,8 +703,12 @@ func (cli *cli) createInputIter(args []string) (iter inputIter) {
 		}
 	case cli.inputStream:
 		newIter = newStreamInputIter
+	case cli.inputElements:
+		newIter = newElementsInputIter
 	case cli.inputYAML:
 		newIter = newYAMLInputIter
+	case cli.inputJSONL:
+		newIter = newJSONLInputIter
 	default:
 		newIter = newJSONInputIter
 	}
@@ -360,6 +728,9 @@ func (cli *cli) createInputIter(args []string) (iter inputIter) {
 }
 
 func (cli *cli) process(iter inputIter, code *gojq.Code) error {
+	if cli.parallel > 1 {
+		return cli.processParallel(iter, code)
+	}
 	var err error
 	for {
 		v, ok := iter.Next()
@@ -371,22 +742,14 @@ func (cli *cli) process(iter inputIter, code *gojq.Code) error {
 			err = e
 			continue
 		}
-		if e := cli.printValues(code.Run(v, cli.argvalues...)); e != nil {
-			if e, ok := e.(*gojq.HaltError); ok {
-				if v := e.Value(); v != nil {
-					if str, ok := v.(string); ok {
-						cli.errStream.Write([]byte(str))
-					} else {
-						bs, _ := gojq.Marshal(v)
-						cli.errStream.Write(bs)
-						cli.errStream.Write([]byte{'\n'})
-					}
-				}
-				err = e
-				break
+		if e := cli.printValues(code.RunWithContext(cli.ctx, v, cli.argvalues...)); e != nil {
+			if e := cli.timeoutError(); e != nil {
+				return e
 			}
-			fmt.Fprintf(cli.errStream, "%s: %s\n", name, e)
 			err = e
+			if cli.reportError(e) {
+				break
+			}
 		}
 	}
 	if err != nil {
@@ -395,6 +758,60 @@ func (cli *cli) process(iter inputIter, code *gojq.Code) error {
 	return nil
 }
 
+// parseTimeout parses the value of a timeout or other duration flag, a duration like 1m30s or
+// a number of seconds
+func parseTimeout(flag, s string) (time.Duration, error) {
+	d, err := parseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --%s: %w", flag, err)
+	}
+	return d, nil
+}
+
+// parseDuration parses a positive duration like 1m30s, or a number of seconds
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		secs, e := strconv.ParseFloat(s, 64)
+		if e != nil {
+			return 0, fmt.Errorf("%q is not a duration", s)
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%q is not positive", s)
+	}
+	return d, nil
+}
+
+// timeoutError returns the error to stop with once the --timeout of the
+// whole run has passed, or nil before that.
+func (cli *cli) timeoutError() error {
+	if cli.ctx.Err() == nil {
+		return nil
+	}
+	return fmt.Errorf("timed out after %v", cli.timeout)
+}
+
+// reportError writes an error of the query to the error stream, and reports
+// whether the query halted so that no more inputs should be processed.
+func (cli *cli) reportError(err error) bool {
+	if err, ok := err.(*gojq.HaltError); ok {
+		if v := err.Value(); v != nil {
+			if str, ok := v.(string); ok {
+				cli.errStream.Write([]byte(str))
+			} else {
+				bs, _ := gojq.Marshal(v)
+				cli.errStream.Write(bs)
+				cli.errStream.Write([]byte{'\n'})
+			}
+		}
+		return true
+	}
+	fmt.Fprintf(cli.errStream, "%s: %s\n", name, err)
+	return false
+}
+
 func (cli *cli) printValues(iter gojq.Iter) error {
 	m := cli.createMarshaler()
 	for {
@@ -420,7 +837,7 @@ func (cli *cli) printValues(iter gojq.Iter) error {
 				cli.exitCodeError = &exitCodeError{exitCodeOK}
 			}
 		}
-		if !cli.outputYAML {
+		if !cli.outputYAML && cli.outputTable == nil {
 			if cli.outputRaw0 {
 				cli.outStream.Write([]byte{'\x00'})
 			} else if !cli.outputJoin {
@@ -432,6 +849,10 @@ func (cli *cli) printValues(iter gojq.Iter) error {
 }
 
 func (cli *cli) createMarshaler() marshaler {
+	if cli.outputTable != nil {
+		// One marshaler for the whole run, so the header is written once
+		return cli.outputTable
+	}
 	if cli.outputYAML {
 		return yamlFormatter(cli.outputIndent)
 	}
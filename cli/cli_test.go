@@ -12,6 +12,8 @@ import (
 
 func init() {
 	addDefaultModulePaths = false
+	loadUserConfig = false
+	addDefaultPluginPaths = false
 }
 
 // This reader does not implement io.Seeker to emulate standard input.
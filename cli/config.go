@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gotoml "github.com/pelletier/go-toml/v2"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/graph"
+	"github.com/xen0bit/pwrq/pkg/udf"
+)
+
+// loadUserConfig enables reading the config file from the user's config
+// directory. $PWRQ_CONFIG is read regardless
+var loadUserConfig = true
+
+// config holds defaults read from ~/.config/pwrq/config.toml or
+// config.json. Flags and environment variables take precedence
+type config struct {
+	LibraryPath []string `json:"library_path" toml:"library_path"`
+	Colors      string   `json:"colors" toml:"colors"`
+	Indent      *int     `json:"indent" toml:"indent"`
+	Timeout     string   `json:"timeout" toml:"timeout"`
+	UDFTimeout  string   `json:"udf_timeout" toml:"udf_timeout"`
+	Theme       string   `json:"theme" toml:"theme"`
+	Proxy       string   `json:"proxy" toml:"proxy"`
+	Categories  []string `json:"categories" toml:"categories"`
+	PluginPath  []string `json:"plugin_path" toml:"plugin_path"`
+
+	path       string
+	timeout    time.Duration // Timeout parsed
+	udfTimeout time.Duration // UDFTimeout parsed
+}
+
+// configPath returns the config file to read, or "" for none. An empty
+// $PWRQ_CONFIG turns the config file off
+func configPath() string {
+	if path, ok := os.LookupEnv("PWRQ_CONFIG"); ok || !loadUserConfig {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	for _, ext := range []string{".toml", ".json"} {
+		path := filepath.Join(dir, name, "config"+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfig reads the config file, if there is one, starts the plugins,
+// and applies the settings that are not tied to a flag. The caller closes
+// the plugins with closePlugins
+func (cli *cli) loadConfig(skip bool) error {
+	if path := configPath(); !skip && path != "" {
+		if err := cli.readConfig(path); err != nil {
+			return err
+		}
+	}
+	// Plugins add categories of their own
+	cli.loadPlugins()
+	for i, c := range cli.config.Categories {
+		category, ok := udf.LookupCategory(c)
+		if !ok {
+			return fmt.Errorf("invalid config file %s: unknown category %q (expected one of %s)",
+				cli.config.path, c, strings.Join(udf.Categories(), ", "))
+		}
+		cli.config.Categories[i] = category
+	}
+	return nil
+}
+
+func (cli *cli) readConfig(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cfg config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(src))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&cfg)
+	} else {
+		err = gotoml.NewDecoder(bytes.NewReader(src)).DisallowUnknownFields().Decode(&cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	if cfg.Proxy != "" {
+		if u, err := url.Parse(cfg.Proxy); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid config file %s: invalid proxy %q", path, cfg.Proxy)
+		}
+		// The proxy environment variables win over the config file
+		for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY"} {
+			if os.Getenv(key) == "" && os.Getenv(strings.ToLower(key)) == "" {
+				os.Setenv(key, cfg.Proxy)
+			}
+		}
+	}
+	if i := cfg.Indent; i != nil && (*i < 0 || *i > 9) {
+		return fmt.Errorf("invalid config file %s: indent must be between 0 and 9, got %d", path, *i)
+	}
+	if cfg.Timeout != "" {
+		if cfg.timeout, err = parseDuration(cfg.Timeout); err != nil {
+			return fmt.Errorf("invalid config file %s: timeout: %w", path, err)
+		}
+	}
+	if cfg.UDFTimeout != "" {
+		if cfg.udfTimeout, err = parseDuration(cfg.UDFTimeout); err != nil {
+			return fmt.Errorf("invalid config file %s: udf_timeout: %w", path, err)
+		}
+	}
+	if cfg.Theme != "" {
+		if err := (graph.GraphOptions{Theme: cfg.Theme}).Validate(); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	cfg.path = path
+	cli.config = cfg
+	return nil
+}
+
+// checkCalls rejects a query calling a UDF outside the categories enabled
+// in the config file
+func (cli *cli) checkCalls(query *gojq.Query) error {
+	if cli.config.Categories == nil {
+		return nil
+	}
+	for _, fn := range udf.FuncCalls(query) {
+		category := udf.FunctionCategory(fn)
+		if category == "" {
+			continue
+		}
+		var enabled bool
+		for _, c := range cli.config.Categories {
+			enabled = enabled || c == category
+		}
+		if !enabled {
+			return fmt.Errorf("function %s is in category %q, which is not enabled in %s", fn, category, cli.config.path)
+		}
+	}
+	return nil
+}
+
+// metaModuleLoader is the module loader returned by gojq.NewModuleLoader
+type metaModuleLoader interface {
+	LoadInitModules() ([]*gojq.Query, error)
+	LoadModuleWithMeta(string, map[string]any) (*gojq.Query, error)
+	LoadJSONWithMeta(string, map[string]any) (any, error)
+}
+
+// checkedModuleLoader applies checkCalls to every module a query imports
+type checkedModuleLoader struct {
+	loader metaModuleLoader
+	check  func(*gojq.Query) error
+}
+
+func (l *checkedModuleLoader) LoadInitModules() ([]*gojq.Query, error) {
+	queries, err := l.loader.LoadInitModules()
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range queries {
+		if err := l.check(q); err != nil {
+			return nil, err
+		}
+	}
+	return queries, nil
+}
+
+func (l *checkedModuleLoader) LoadModuleWithMeta(name string, meta map[string]any) (*gojq.Query, error) {
+	q, err := l.loader.LoadModuleWithMeta(name, meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.check(q); err != nil {
+		return nil, fmt.Errorf("module %q: %w", name, err)
+	}
+	return q, nil
+}
+
+func (l *checkedModuleLoader) LoadJSONWithMeta(name string, meta map[string]any) (any, error) {
+	return l.loader.LoadJSONWithMeta(name, meta)
+}
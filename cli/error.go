@@ -106,6 +106,10 @@ func (err *jsonParseError) Error() string {
 		offset = len(err.contents) + 1
 	} else if e, ok := err.err.(*json.SyntaxError); ok {
 		offset = int(e.Offset)
+	} else if e, ok := err.err.(*jsonlTrailingDataError); ok {
+		offset = int(e.offset)
+	} else if e, ok := err.err.(*elementsTypeError); ok {
+		offset = int(e.offset) + 1
 	}
 	linestr, line, column := getLineByOffset(err.contents, offset)
 	if line += err.line; line > 1 {
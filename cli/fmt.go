@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/queryfmt"
+)
+
+type fmtFlagopts struct {
+	FromFile bool `short:"f" long:"from-file" description:"format the query files given as arguments"`
+	Write    bool `short:"w" long:"write" description:"with -f, write the result back to the files"`
+	List     bool `short:"l" long:"list" description:"with -f, list the files whose formatting differs, failing unless -w is given"`
+	Width    *int `long:"width" args:"number" description:"break lines longer than this (default 80)"`
+	Help     bool `short:"h" long:"help" description:"display this help information"`
+}
+
+// runFmt implements the fmt subcommand:
+//
+//	pwrq fmt [OPTIONS] [QUERY]
+//	pwrq fmt [OPTIONS] -f FILE...
+//
+// Without a query or files, the query is read from standard input
+func (cli *cli) runFmt(args []string) error {
+	var opts fmtFlagopts
+	args, err := parseFlags(args, &opts)
+	if err != nil {
+		return &flagParseError{err}
+	}
+	if opts.Help {
+		fmt.Fprintf(cli.outStream, `%[1]s fmt - pretty-print queries
+
+Usage:
+  %[1]s fmt [OPTIONS] [QUERY]
+  %[1]s fmt [OPTIONS] -f FILE...
+
+Queries that fit on a line are printed on one. Longer ones get a pipeline
+stage per line, with the | leading, and an object key or function argument
+per line. Queries with comments are not formatted, as the comments would be
+lost.
+
+`, name)
+		fmt.Fprintln(cli.outStream, formatFlags(&opts))
+		return nil
+	}
+	if (opts.Write || opts.List) && !opts.FromFile {
+		return &flagParseError{errors.New("flags `--write' and `--list' require `--from-file'")}
+	}
+	width := queryfmt.DefaultWidth
+	if opts.Width != nil {
+		if width = *opts.Width; width < 1 {
+			return &flagParseError{fmt.Errorf("width must be positive: %d", width)}
+		}
+	}
+
+	if !opts.FromFile {
+		if len(args) > 1 {
+			return &flagParseError{errors.New("expected one query; use -f to format files")}
+		}
+		fname, src := "<stdin>", ""
+		if len(args) == 1 {
+			fname, src = "<arg>", args[0]
+		} else {
+			b, err := io.ReadAll(cli.inStream)
+			if err != nil {
+				return err
+			}
+			src = string(b)
+		}
+		out, err := formatQuery(fname, src, width)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.outStream, out)
+		return nil
+	}
+
+	if len(args) == 0 {
+		return &flagParseError{errors.New("expected a file")}
+	}
+	var differ bool
+	for _, fname := range args {
+		b, err := os.ReadFile(fname)
+		if err != nil {
+			return err
+		}
+		out, err := formatQuery(fname, string(b), width)
+		if err != nil {
+			return err
+		}
+		out += "\n"
+		if !opts.List && !opts.Write {
+			fmt.Fprint(cli.outStream, out)
+			continue
+		}
+		if out == string(b) {
+			continue
+		}
+		if opts.List {
+			differ = true
+			fmt.Fprintln(cli.outStream, fname)
+		}
+		if opts.Write {
+			if err := writeFormatted(fname, out); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.List && differ && !opts.Write {
+		return &exitCodeError{exitCodeFalsyErr}
+	}
+	return nil
+}
+
+// writeFormatted replaces a query file the way --output replaces its file
+func writeFormatted(fname, out string) error {
+	f, err := createOutputFile(fname)
+	if err != nil {
+		return err
+	}
+	if _, err := f.tmp.WriteString(out); err != nil {
+		f.abort()
+		return fmt.Errorf("cannot write %s: %w", fname, err)
+	}
+	return f.commit()
+}
+
+// formatQuery parses and formats the query in src, read from fname
+func formatQuery(fname, src string, width int) (string, error) {
+	query, err := gojq.Parse(src)
+	if err != nil {
+		return "", &queryParseError{fname, src, err}
+	}
+	if queryfmt.HasComments(src) {
+		return "", fmt.Errorf("cannot format %s: it has comments, which formatting would drop", fname)
+	}
+	return strings.TrimSpace(queryfmt.Format(query, width)), nil
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xen0bit/pwrq/pkg/udf"
+)
+
+type funcsFlagopts struct {
+	Category string `short:"c" long:"category" args:"name" description:"list only the functions in this category"`
+	Search   string `short:"s" long:"search" args:"text" description:"list only the functions whose name or description contains this text"`
+	JSON     bool   `long:"json" description:"print the functions as a JSON array"`
+	NoConfig bool   `long:"no-config" description:"ignore the config file"`
+	Help     bool   `short:"h" long:"help" description:"display this help information"`
+}
+
+// runFuncs implements the funcs subcommand:
+//
+//	pwrq funcs                 list every UDF by category
+//	pwrq funcs NAME            describe one UDF
+//	pwrq funcs CATEGORY        list the UDFs in a category
+func (cli *cli) runFuncs(args []string) error {
+	var opts funcsFlagopts
+	args, err := parseFlags(args, &opts)
+	if err != nil {
+		return &flagParseError{err}
+	}
+	if opts.Help {
+		fmt.Fprintf(cli.outStream, `%[1]s funcs - describe user-defined functions
+
+Usage:
+  %[1]s funcs [OPTIONS] [NAME|CATEGORY]
+
+`, name)
+		fmt.Fprintln(cli.outStream, formatFlags(&opts))
+		return nil
+	}
+	if len(args) > 1 {
+		return &flagParseError{fmt.Errorf("expected one function or category, got %d arguments", len(args))}
+	}
+	// Plugins add functions of their own
+	if err := cli.loadConfig(opts.NoConfig); err != nil {
+		cli.closePlugins()
+		return err
+	}
+	defer cli.closePlugins()
+
+	metadata := udf.GetFunctionMetadata()
+	var single bool
+	if len(args) == 1 {
+		if m, ok := lookupFunction(metadata, args[0]); ok {
+			metadata, single = []udf.FunctionMetadata{m}, true
+		} else if category, ok := udf.LookupCategory(args[0]); ok {
+			metadata = filterFunctions(metadata, func(m udf.FunctionMetadata) bool {
+				return m.Category == category
+			})
+		} else {
+			return fmt.Errorf("no function or category named %q", args[0])
+		}
+	}
+	if opts.Category != "" {
+		category, ok := udf.LookupCategory(opts.Category)
+		if !ok {
+			return fmt.Errorf("unknown category %q (expected one of %s)",
+				opts.Category, strings.Join(udf.Categories(), ", "))
+		}
+		metadata = filterFunctions(metadata, func(m udf.FunctionMetadata) bool {
+			return m.Category == category
+		})
+	}
+	if opts.Search != "" {
+		text := strings.ToLower(opts.Search)
+		metadata = filterFunctions(metadata, func(m udf.FunctionMetadata) bool {
+			return strings.Contains(strings.ToLower(m.Name), text) ||
+				strings.Contains(strings.ToLower(m.Description), text)
+		})
+	}
+
+	if opts.JSON {
+		if metadata == nil {
+			metadata = []udf.FunctionMetadata{}
+		}
+		enc := json.NewEncoder(cli.outStream)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(metadata)
+	}
+	if len(metadata) == 0 {
+		return errors.New("no functions match")
+	}
+	if single {
+		cli.printFunction(metadata[0])
+		return nil
+	}
+	cli.printUDFCategories(metadata)
+	return nil
+}
+
+func lookupFunction(metadata []udf.FunctionMetadata, name string) (udf.FunctionMetadata, bool) {
+	for _, m := range metadata {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return udf.FunctionMetadata{}, false
+}
+
+func filterFunctions(metadata []udf.FunctionMetadata, keep func(udf.FunctionMetadata) bool) []udf.FunctionMetadata {
+	var kept []udf.FunctionMetadata
+	for _, m := range metadata {
+		if keep(m) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// printFunction describes a single UDF in full
+func (cli *cli) printFunction(m udf.FunctionMetadata) {
+	fmt.Fprintf(cli.outStream, "%s (%s)\n\n", m.Name, m.Category)
+	fmt.Fprintf(cli.outStream, "  %s\n\n", m.Description)
+	if m.MinArgs == m.MaxArgs {
+		fmt.Fprintf(cli.outStream, "  Arguments: %d\n", m.MinArgs)
+	} else {
+		fmt.Fprintf(cli.outStream, "  Arguments: %d to %d\n", m.MinArgs, m.MaxArgs)
+	}
+	if len(m.Examples) > 0 {
+		fmt.Fprintf(cli.outStream, "\n  Examples:\n")
+		for _, example := range m.Examples {
+			fmt.Fprintf(cli.outStream, "    %s\n", example)
+		}
+	}
+}
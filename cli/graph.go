@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/graph"
+	"github.com/xen0bit/pwrq/pkg/udf"
+)
+
+// defaultCorpusDir is the query corpus checked by `graph --check` when no
+// directory is given, relative to the repository root
+var defaultCorpusDir = filepath.Join("pkg", "graph", "testdata", "queries")
+
+type graphFlagopts struct {
+	Output     string `short:"o" long:"output" args:"file" description:"render to this file (.d2, .mmd, .json, .svg, .png or .pdf) instead of printing D2"`
+	Layout     string `long:"layout" args:"engine" description:"layout engine: dagre (default) or elk"`
+	Theme      string `long:"theme" args:"name" description:"D2 theme name or ID, like dark (default), light or terminal"`
+	Direction  string `long:"direction" args:"dir" description:"flow direction: right (default), down, left or up"`
+	Padding    *int   `long:"padding" args:"pixels" description:"space around the diagram (default 100)"`
+	Sketch     bool   `long:"sketch" description:"draw hand-drawn looking shapes"`
+	MaxLabel   *int   `long:"max-label" args:"number" description:"cut node labels longer than this (default 50, -1 for no limit)"`
+	MaxDepth   *int   `long:"max-depth" args:"number" description:"collapse containers nested this deep into summary nodes (default no limit)"`
+	ASCII      bool   `long:"ascii" description:"draw the graph with box-drawing characters instead of printing D2"`
+	Categories bool   `long:"categories" description:"color UDF nodes by category, with a legend"`
+	Sample     string `long:"sample" args:"file" description:"run the query on the first value of this file and show the values on the edges"`
+	Check      bool   `long:"check" description:"re-render the query corpus and diff against the golden .d2 files"`
+	Update     bool   `long:"update" description:"with --check, rewrite golden .d2 files instead of failing"`
+	Help       bool   `short:"h" long:"help" description:"display this help information"`
+}
+
+// runGraph implements the graph subcommand:
+//
+//	pwrq graph QUERY [-o OUTPUT]   render QUERY to OUTPUT (.d2/.mmd/.json/.svg/.png/.pdf) or stdout
+//	pwrq graph --ascii QUERY       draw QUERY in the terminal
+//	pwrq graph --check [DIR]       diff the corpus in DIR against its goldens
+//
+// OUTPUT may also follow the query, as it did before -o existed
+func (cli *cli) runGraph(args []string) error {
+	var opts graphFlagopts
+	args, err := parseFlags(args, &opts)
+	if err != nil {
+		return &flagParseError{err}
+	}
+	if opts.Help {
+		fmt.Fprintf(cli.outStream, `%[1]s graph - render query flow diagrams
+
+Usage:
+  %[1]s graph [OPTIONS] QUERY [-o OUTPUT]
+  %[1]s graph --check [--update] [DIR]
+
+--layout, --theme, --direction, --padding and --sketch apply to rendered
+output such as .svg; --max-label and --max-depth apply to every format.
+
+`, name)
+		fmt.Fprintln(cli.outStream, formatFlags(&opts))
+		return nil
+	}
+	if opts.Update && !opts.Check {
+		return &flagParseError{errors.New("flag `--update' requires `--check'")}
+	}
+	if opts.Check {
+		dir := defaultCorpusDir
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		return cli.checkGraphCorpus(dir, opts.Update)
+	}
+
+	if len(args) == 0 {
+		return &flagParseError{errors.New("expected a query")}
+	}
+	output := opts.Output
+	if len(args) > 1 {
+		if output != "" {
+			return &flagParseError{errors.New("output given both with -o and after the query")}
+		}
+		output = args[1]
+	}
+	graphOpts := graph.GraphOptions{
+		Layout:     opts.Layout,
+		Theme:      opts.Theme,
+		Direction:  opts.Direction,
+		Padding:    opts.Padding,
+		Sketch:     opts.Sketch,
+		Categories: opts.Categories,
+	}
+	if opts.MaxLabel != nil {
+		graphOpts.MaxLabel = *opts.MaxLabel
+	}
+	if opts.MaxDepth != nil {
+		graphOpts.MaxDepth = *opts.MaxDepth
+	}
+	// The theme of the config file, as --theme overrides it
+	if path := configPath(); opts.Theme == "" && path != "" {
+		if err := cli.readConfig(path); err != nil {
+			return err
+		}
+		graphOpts.Theme = cli.config.Theme
+	}
+	if err := graphOpts.Validate(); err != nil {
+		return &flagParseError{err}
+	}
+	query, err := gojq.Parse(strings.TrimSpace(args[0]))
+	if err != nil {
+		return &queryParseError{"<arg>", args[0], err}
+	}
+	if opts.Sample != "" {
+		defer cli.closePlugins()
+		if graphOpts.Sample, err = cli.graphSample(query, opts.Sample); err != nil {
+			return err
+		}
+	}
+	if opts.ASCII {
+		if output != "" {
+			return &flagParseError{errors.New("flag `--ascii' prints the graph and takes no output file")}
+		}
+		text, err := graph.GenerateASCII(query, graphOpts)
+		if err != nil {
+			return fmt.Errorf("failed to generate graph: %w", err)
+		}
+		fmt.Fprint(cli.outStream, text)
+		return nil
+	}
+	if output != "" {
+		if err := graph.GenerateGraph(query, output, graphOpts); err != nil {
+			return fmt.Errorf("failed to generate graph: %w", err)
+		}
+		fmt.Fprintf(cli.outStream, "Graph generated: %s\n", output)
+		return nil
+	}
+	script, err := graph.GenerateD2(query, graphOpts)
+	if err != nil {
+		return fmt.Errorf("failed to generate graph: %w", err)
+	}
+	fmt.Fprint(cli.outStream, script)
+	return nil
+}
+
+// graphSample reads the input of --sample, and compiles the query for it
+// with the UDFs and plugins a run would have
+func (cli *cli) graphSample(query *gojq.Query, file string) (*graph.Sample, error) {
+	if err := cli.loadConfig(false); err != nil {
+		return nil, err
+	}
+	if err := cli.checkCalls(query); err != nil {
+		return nil, &compileError{err}
+	}
+	inputs, err := cli.readInputs([]string{file})
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("sample file %s has no values", file)
+	}
+	options := append([]gojq.CompilerOption{gojq.WithEnvironLoader(os.Environ)}, udf.DefaultRegistry().Options()...)
+	return &graph.Sample{Input: inputs[0], Options: append(options, cli.pluginOptions()...)}, nil
+}
+
+func (cli *cli) checkGraphCorpus(dir string, update bool) error {
+	results, err := graph.CheckCorpus(dir, update)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Fprintf(cli.outStream, "FAIL %s: %s\n", r.Name, r.Err)
+		case len(r.Unsupported) > 0:
+			fmt.Fprintf(cli.outStream, "UNSUPPORTED %s: %s\n", r.Name, strings.Join(r.Unsupported, ", "))
+		case r.Updated:
+			fmt.Fprintf(cli.outStream, "UPDATE %s\n", r.Name)
+		case !r.OK():
+			failed++
+			fmt.Fprintf(cli.outStream, "FAIL %s: output differs from %s\n%s", r.Name, r.Golden, r.Diff())
+		default:
+			fmt.Fprintf(cli.outStream, "ok %s\n", r.Name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("graph check failed: %d of %d queries differ", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// historyEntry is a line of the history file. Exit is unset for lines of a
+// REPL session and for entries of plain-text history files
+type historyEntry struct {
+	Time  string `json:"time,omitempty"`
+	Query string `json:"query"`
+	Exit  *int   `json:"exit,omitempty"`
+}
+
+// historyPath returns the history file shared by queries and the REPL, or ""
+// when history is off. An empty $PWRQ_HISTORY turns it off
+func historyPath() string {
+	if path, ok := os.LookupEnv("PWRQ_HISTORY"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "."+name, "history")
+}
+
+// readHistory reads a history file. Lines that are not JSON objects are
+// queries of their own, so older plain-text history files still load
+func readHistory(path string) ([]historyEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []historyEntry
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+		var e historyEntry
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &e) != nil || e.Query == "" {
+			e = historyEntry{Query: line}
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
+
+// appendHistory adds an entry to a history file, creating it and its
+// directory if needed
+func appendHistory(path string, e historyEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if e.Time == "" {
+		e.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// recordQuery saves a query run from a terminal, with its exit status, to
+// the history file. Queries run by scripts are left out
+func (cli *cli) recordQuery(code int) {
+	if cli.query == "" {
+		return
+	}
+	f, ok := cli.errStream.(interface{ Fd() uintptr })
+	if !ok || !(isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())) {
+		return
+	}
+	if path := historyPath(); path != "" {
+		appendHistory(path, historyEntry{Query: cli.query, Exit: &code})
+	}
+}
+
+type historyFlagopts struct {
+	Limit *int `short:"n" long:"limit" args:"number" description:"show only the last number entries"`
+	JSON  bool `long:"json" description:"print the entries as JSON lines"`
+	Clear bool `long:"clear" description:"delete the history file"`
+	Help  bool `short:"h" long:"help" description:"display this help information"`
+}
+
+// runHistory implements the history subcommand:
+//
+//	pwrq history [TEXT]   list past queries, optionally those containing TEXT
+//	pwrq history --clear  delete the history
+func (cli *cli) runHistory(args []string) error {
+	var opts historyFlagopts
+	args, err := parseFlags(args, &opts)
+	if err != nil {
+		return &flagParseError{err}
+	}
+	if opts.Help {
+		fmt.Fprintf(cli.outStream, `%[1]s history - list past queries
+
+Usage:
+  %[1]s history [OPTIONS] [TEXT]
+
+`, name)
+		fmt.Fprintln(cli.outStream, formatFlags(&opts))
+		return nil
+	}
+	path := historyPath()
+	if path == "" {
+		return errors.New("history is turned off")
+	}
+	if opts.Clear {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	entries, err := readHistory(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	type numbered struct {
+		n int
+		historyEntry
+	}
+	var shown []numbered
+	for i, e := range entries {
+		if len(args) == 0 || strings.Contains(e.Query, args[0]) {
+			shown = append(shown, numbered{i + 1, e})
+		}
+	}
+	if n := opts.Limit; n != nil && *n >= 0 && *n < len(shown) {
+		shown = shown[len(shown)-*n:]
+	}
+	for _, e := range shown {
+		if opts.JSON {
+			line, _ := json.Marshal(e.historyEntry)
+			fmt.Fprintf(cli.outStream, "%s\n", line)
+			continue
+		}
+		// Numbers match !N in the REPL
+		status := " "
+		if e.Exit != nil && *e.Exit != exitCodeOK {
+			status = "!"
+		}
+		when := e.Time
+		if t, err := time.Parse(time.RFC3339, e.Time); err == nil {
+			when = t.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(cli.outStream, "%5d %s %-16s  %s\n", e.n, status, when,
+			strings.ReplaceAll(e.Query, "\n", " "))
+	}
+	return nil
+}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/itchyny/go-yaml"
@@ -97,6 +99,9 @@ func (i *jsonInputIter) Next() (any, bool) {
 		if e, ok := err.(*json.SyntaxError); ok {
 			e.Offset -= i.offset
 			offset, line = &e.Offset, &i.line
+		} else if e, ok := err.(*elementsTypeError); ok {
+			e.offset -= i.offset
+			offset, line = &e.offset, &i.line
 		} else if err == io.ErrUnexpectedEOF && i.ir.rs != nil {
 			if pos, err := i.ir.rs.Seek(0, io.SeekEnd); err == nil {
 				offset, line = &pos, &i.line
@@ -129,6 +134,138 @@ func newStreamInputIter(r io.Reader, fname string) inputIter {
 	return &jsonInputIter{next: newJSONStream(dec).next, ir: ir, fname: fname}
 }
 
+// newElementsInputIter reads top-level arrays incrementally and yields
+// each element as an input, so only one element is held in memory at a
+// time. Several arrays in a row are read one after another.
+func newElementsInputIter(r io.Reader, fname string) inputIter {
+	ir := newInputReader(r)
+	dec := json.NewDecoder(ir)
+	dec.UseNumber()
+	var inArray bool
+	next := func() (v any, err error) {
+		for {
+			if !inArray {
+				offset := dec.InputOffset()
+				token, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				if token != json.Delim('[') {
+					// Point at the token rather than the space before it
+					switch token := token.(type) {
+					case json.Delim:
+						offset = dec.InputOffset() - 1
+					case json.Number:
+						offset = dec.InputOffset() - int64(len(token))
+					case string:
+						offset = dec.InputOffset() - int64(len(strconv.Quote(token)))
+					case bool:
+						offset = dec.InputOffset() - int64(len(fmt.Sprint(token)))
+					case nil:
+						offset = dec.InputOffset() - int64(len("null"))
+					}
+					return nil, &elementsTypeError{offset, token}
+				}
+				inArray = true
+			}
+			if dec.More() {
+				err = dec.Decode(&v)
+				return
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			inArray = false
+		}
+	}
+	return &jsonInputIter{next: next, ir: ir, fname: fname}
+}
+
+type elementsTypeError struct {
+	offset int64
+	token  json.Token
+}
+
+func (err *elementsTypeError) Error() string {
+	var typ string
+	switch err.token.(type) {
+	case json.Delim:
+		typ = "object"
+	case json.Number:
+		typ = "number"
+	case bool:
+		typ = "boolean"
+	case string:
+		typ = "string"
+	default:
+		typ = "null"
+	}
+	return "expected a top-level array, got " + typ
+}
+
+// jsonlInputIter reads newline-delimited JSON. Each non-blank line holds
+// exactly one value. A malformed line is reported and skipped, so one bad
+// record does not stop processing of a large log.
+type jsonlInputIter struct {
+	r     *bufio.Reader
+	fname string
+	line  int
+	err   error
+}
+
+func newJSONLInputIter(r io.Reader, fname string) inputIter {
+	return &jsonlInputIter{r: bufio.NewReaderSize(r, 64*1024), fname: fname}
+}
+
+func (i *jsonlInputIter) Next() (any, bool) {
+	for i.err == nil {
+		line, err := i.r.ReadString('\n')
+		if err != nil {
+			i.err = err
+			if err != io.EOF {
+				return err, true
+			}
+		}
+		i.line++
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return &jsonParseError{i.fname, line, i.line - 1, err}, true
+		}
+		if offset := dec.InputOffset(); strings.TrimSpace(line[offset:]) != "" {
+			offset += int64(len(line[offset:]) - len(strings.TrimLeft(line[offset:], " \t")))
+			return &jsonParseError{i.fname, line, i.line - 1, &jsonlTrailingDataError{offset + 1}}, true
+		}
+		return v, true
+	}
+	return nil, false
+}
+
+func (i *jsonlInputIter) Close() error {
+	i.err = io.EOF
+	return nil
+}
+
+func (i *jsonlInputIter) Name() string {
+	return i.fname
+}
+
+type jsonlTrailingDataError struct {
+	offset int64
+}
+
+func (*jsonlTrailingDataError) Error() string {
+	return "unexpected data after JSON value"
+}
+
 type nullInputIter struct {
 	err error
 }
@@ -415,3 +552,21 @@ func (i *slurpRawInputIter) Close() error {
 func (i *slurpRawInputIter) Name() string {
 	return i.iter.Name()
 }
+
+// readInputs reads all the inputs of files, or of standard input without
+// any, for subcommands that run queries on them more than once
+func (cli *cli) readInputs(files []string) ([]any, error) {
+	iter := cli.createInputIter(files)
+	defer iter.Close()
+	var inputs []any
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			return inputs, nil
+		}
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		inputs = append(inputs, v)
+	}
+}
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf"
+)
+
+type lintFlagopts struct {
+	FromFile    bool     `short:"f" long:"from-file" description:"read the queries from files given as arguments"`
+	ModulePaths []string `short:"L" long:"library-path" args:"dir" description:"directory to search modules from"`
+	JSON        bool     `long:"json" description:"print the diagnostics as a JSON array"`
+	Strict      bool     `long:"strict" description:"fail on warnings as well as errors"`
+	NoConfig    bool     `long:"no-config" description:"ignore the config file"`
+	Help        bool     `short:"h" long:"help" description:"display this help information"`
+}
+
+// lintDiagnostic is a udf.Diagnostic with where it was found
+type lintDiagnostic struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	udf.Diagnostic
+}
+
+// runLint implements the lint subcommand:
+//
+//	pwrq lint [OPTIONS] QUERY...
+//	pwrq lint [OPTIONS] -f FILE...
+//
+// It exits 1 when it finds an error, or a warning with --strict
+func (cli *cli) runLint(args []string) error {
+	var opts lintFlagopts
+	args, err := parseFlags(args, &opts)
+	if err != nil {
+		return &flagParseError{err}
+	}
+	if opts.Help {
+		fmt.Fprintf(cli.outStream, `%[1]s lint - check queries for mistakes
+
+Usage:
+  %[1]s lint [OPTIONS] QUERY...
+  %[1]s lint [OPTIONS] -f FILE...
+
+Reports syntax errors, unknown functions, UDFs called with the wrong number
+of arguments, deprecated functions, and UDF results used without ._val.
+
+`, name)
+		fmt.Fprintln(cli.outStream, formatFlags(&opts))
+		return nil
+	}
+	if len(args) == 0 {
+		if opts.FromFile {
+			return &flagParseError{errors.New("expected a file")}
+		}
+		return &flagParseError{errors.New("expected a query")}
+	}
+	if err := cli.loadConfig(opts.NoConfig); err != nil {
+		cli.closePlugins()
+		return err
+	}
+	defer cli.closePlugins()
+
+	diags := []lintDiagnostic{}
+	for _, arg := range args {
+		fname, src := "<arg>", arg
+		if opts.FromFile {
+			cnt, err := os.ReadFile(arg)
+			if err != nil {
+				return err
+			}
+			fname, src = arg, string(cnt)
+		}
+		diags = append(diags, cli.lintQuery(fname, src, opts.ModulePaths)...)
+	}
+
+	var failed bool
+	for _, d := range diags {
+		failed = failed || d.Severity == "error" || opts.Strict
+	}
+	if opts.JSON {
+		enc := json.NewEncoder(cli.outStream)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diags); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range diags {
+			fmt.Fprintf(cli.outStream, "%s:%d:%d: %s: %s [%s]\n",
+				d.File, d.Line, d.Column, d.Severity, d.Message, d.Code)
+		}
+	}
+	if failed {
+		return &exitCodeError{exitCodeFalsyErr}
+	}
+	return nil
+}
+
+// lintQuery runs udf.Lint on a query, and compiles it to find what Lint
+// does not look for, like undefined functions and variables
+func (cli *cli) lintQuery(fname, src string, modulePaths []string) []lintDiagnostic {
+	query, err := gojq.Parse(src)
+	if err != nil {
+		offset := len(src)
+		var e *gojq.ParseError
+		if errors.As(err, &e) {
+			offset = max(e.Offset-len(e.Token), 0)
+		}
+		line, column := lineColumn(src, offset)
+		return []lintDiagnostic{{fname, line, column,
+			udf.Diagnostic{Severity: "error", Code: "syntax", Message: err.Error()}}}
+	}
+
+	var diags []lintDiagnostic
+	reported := map[string]bool{}
+	add := func(d udf.Diagnostic) {
+		line, column := 1, 1
+		if d.Function != "" {
+			reported[d.Function] = true
+			line, column = lineColumn(src, funcOffset(src, d.Function))
+		}
+		diags = append(diags, lintDiagnostic{fname, line, column, d})
+	}
+	for _, d := range udf.Lint(query) {
+		add(d)
+	}
+	if err := cli.checkCalls(query); err != nil {
+		add(udf.Diagnostic{Severity: "error", Code: "category", Message: err.Error()})
+	}
+	_, err = gojq.Compile(query, append(append([]gojq.CompilerOption{
+		gojq.WithModuleLoader(cli.moduleLoader(modulePaths)),
+		gojq.WithEnvironLoader(os.Environ),
+		gojq.WithFunction("debug", 0, 0, cli.funcDebug),
+		gojq.WithFunction("stderr", 0, 0, cli.funcStderr),
+		gojq.WithInputIter(newNullInputIter()),
+	}, udf.DefaultRegistry().Options()...), cli.pluginOptions()...)...)
+	if err == nil {
+		return diags
+	}
+	msg := err.Error()
+	if fn, ok := strings.CutPrefix(msg, "function not defined: "); ok {
+		fn, _, _ = strings.Cut(fn, "/")
+		if reported[fn] {
+			// Lint has already said what is wrong with the call
+			return diags
+		}
+		if s := udf.SuggestFunction(fn); s != "" {
+			msg += fmt.Sprintf(" (did you mean %s?)", s)
+		}
+		add(udf.Diagnostic{Severity: "error", Code: "undefined", Message: msg, Function: fn})
+	} else {
+		add(udf.Diagnostic{Severity: "error", Code: "compile", Message: msg})
+	}
+	return diags
+}
+
+// funcOffset is the offset of the first call of a function in src, or 0
+func funcOffset(src, name string) int {
+	re := regexp.MustCompile(`(^|[^\w$.])` + regexp.QuoteMeta(name) + `\b`)
+	if loc := re.FindStringSubmatchIndex(src); loc != nil {
+		return loc[3]
+	}
+	return 0
+}
+
+// lineColumn converts an offset in src to a line and a column, both from 1
+func lineColumn(src string, offset int) (line, column int) {
+	offset = min(offset, len(src))
+	before := src[:offset]
+	line = strings.Count(before, "\n") + 1
+	column = offset - strings.LastIndexByte(before, '\n')
+	return line, column
+}
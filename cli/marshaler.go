@@ -1,11 +1,15 @@
 package cli
 
 import (
+	"encoding/csv"
 	"fmt"
 	"io"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/itchyny/go-yaml"
+	"github.com/itchyny/gojq"
 )
 
 type marshaler interface {
@@ -48,3 +52,80 @@ func (m *yamlMarshaler) marshal(v any, w io.Writer) error {
 	}
 	return enc.Close()
 }
+
+// tableMarshaler writes values as CSV or TSV rows. Objects are written
+// under a header taken from the keys of the first object, arrays are
+// written as rows as they are, and other values as rows of one field
+type tableMarshaler struct {
+	tsv    bool
+	header []string
+}
+
+func (m *tableMarshaler) marshal(v any, w io.Writer) error {
+	var row []any
+	switch v := v.(type) {
+	case map[string]any:
+		if m.header == nil {
+			m.header = make([]string, 0, len(v))
+			for k := range v {
+				m.header = append(m.header, k)
+			}
+			sort.Strings(m.header)
+			cells := make([]any, len(m.header))
+			for i, k := range m.header {
+				cells[i] = k
+			}
+			if err := m.writeRow(cells, w); err != nil {
+				return err
+			}
+		}
+		for k := range v {
+			if !slices.Contains(m.header, k) {
+				return fmt.Errorf("cannot output object with key %q not in the header %q", k, m.header)
+			}
+		}
+		row = make([]any, len(m.header))
+		for i, k := range m.header {
+			row[i] = v[k]
+		}
+	case []any:
+		row = v
+	default:
+		row = []any{v}
+	}
+	return m.writeRow(row, w)
+}
+
+func (m *tableMarshaler) writeRow(row []any, w io.Writer) error {
+	fields := make([]string, len(row))
+	for i, v := range row {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			fields[i] = v
+		default:
+			// Numbers, booleans and nested values are written as JSON
+			bs, err := gojq.Marshal(v)
+			if err != nil {
+				return err
+			}
+			fields[i] = string(bs)
+		}
+	}
+	if m.tsv {
+		// Escape like jq's @tsv, since TSV has no quoting
+		for i, f := range fields {
+			fields[i] = tsvEscaper.Replace(f)
+		}
+		_, err := io.WriteString(w, strings.Join(fields, "\t")+"\n")
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(fields); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
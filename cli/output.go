@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputFormats are the values of --output-format
+var outputFormats = []string{"json", "jsonl", "yaml", "csv", "tsv", "raw"}
+
+// setOutputFormat turns --output-format into the flags it stands for
+func (opts *flagopts) setOutputFormat() error {
+	switch opts.OutputFormat {
+	case "", "json":
+	case "jsonl":
+		opts.OutputCompact = true
+	case "yaml":
+		opts.OutputYAML = true
+	case "csv":
+		opts.OutputCSV = true
+	case "tsv":
+		opts.OutputTSV = true
+	case "raw":
+		opts.OutputRaw = true
+	default:
+		return fmt.Errorf("invalid --output-format: %q (expected one of %s)",
+			opts.OutputFormat, strings.Join(outputFormats, ", "))
+	}
+	return nil
+}
+
+// outputFile is the file named by -o. Results go to a temporary file in the
+// same directory, which is renamed over the file only when the query
+// succeeds, so a run that fails halfway leaves the previous file intact and
+// readers never see a partial one
+type outputFile struct {
+	name string
+	tmp  *os.File
+}
+
+func createOutputFile(name string) (*outputFile, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		// The error names the temporary file, which means nothing to the user
+		if e, ok := err.(*os.PathError); ok {
+			err = e.Err
+		}
+		return nil, fmt.Errorf("cannot write %s: %w", name, err)
+	}
+	return &outputFile{name, tmp}, nil
+}
+
+// commit moves the results into place. A file being replaced keeps its
+// permissions, and a new one gets the usual 0644
+func (f *outputFile) commit() error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(f.name); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	err := f.tmp.Chmod(mode)
+	if e := f.tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.tmp.Name(), f.name)
+	}
+	if err != nil {
+		os.Remove(f.tmp.Name())
+		return fmt.Errorf("cannot write %s: %w", f.name, err)
+	}
+	return nil
+}
+
+// abort throws the results away
+func (f *outputFile) abort() {
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+}
+
+// completed reports whether a run that ended with err printed all of its
+// results. The exit status of -e and a halt with status 0 do not cut the
+// output short
+func completed(err error) bool {
+	if _, ok := err.(*exitCodeError); err == nil || ok {
+		return true
+	}
+	e, ok := err.(interface{ ExitCode() int })
+	return ok && e.ExitCode() == exitCodeOK
+}
@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/itchyny/gojq"
+)
+
+type parallelResult struct {
+	seq    int
+	values []any
+	err    error // error reading the input
+}
+
+// processParallel runs the query on up to cli.parallel inputs at once, so
+// queries spending their time in I/O-heavy functions scale with cores. The
+// results of each input are collected and printed together, in input order
+// unless cli.parallelUnordered is set, so outputs never interleave.
+func (cli *cli) processParallel(iter inputIter, code *gojq.Code) error {
+	jobs := make(chan parallelResult)
+	results := make(chan parallelResult)
+	done := make(chan struct{})
+	// Bound the number of inputs read ahead of the one being printed
+	window := make(chan struct{}, cli.parallel*2)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		for seq := 0; ; seq++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			v, ok := iter.Next()
+			if !ok {
+				return
+			}
+			r := parallelResult{seq: seq}
+			if err, ok := v.(error); ok {
+				r.err = err
+				select {
+				case results <- r:
+				case <-done:
+					return
+				}
+				continue
+			}
+			r.values = []any{v}
+			select {
+			case jobs <- r:
+			case <-done:
+				return
+			}
+		}
+	}()
+	for range cli.parallel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range jobs {
+				select {
+				case <-done:
+					continue
+				default:
+				}
+				iter := code.RunWithContext(cli.ctx, r.values[0], cli.argvalues...)
+				r.values = r.values[:0]
+				for {
+					v, ok := iter.Next()
+					if !ok {
+						break
+					}
+					r.values = append(r.values, v)
+					if _, ok := v.(error); ok {
+						break
+					}
+				}
+				select {
+				case results <- r:
+				case <-done:
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var err, timedOut error
+	var halted bool
+	emit := func(r parallelResult) {
+		<-window
+		if r.err != nil {
+			fmt.Fprintf(cli.errStream, "%s: %s\n", name, r.err)
+			err = r.err
+			return
+		}
+		if e := cli.printValues(gojq.NewIter(r.values...)); e != nil {
+			if timedOut = cli.timeoutError(); timedOut != nil {
+				halted = true
+				close(done)
+				return
+			}
+			err = e
+			if halted = cli.reportError(e); halted {
+				close(done)
+			}
+		}
+	}
+	next, pending := 0, map[int]parallelResult{}
+	for r := range results {
+		if halted {
+			continue // drain until every goroutine has returned
+		}
+		if cli.parallelUnordered {
+			emit(r)
+			continue
+		}
+		pending[r.seq] = r
+		for !halted {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			emit(r)
+		}
+	}
+	if timedOut != nil {
+		return timedOut
+	}
+	if err != nil {
+		return &emptyError{err}
+	}
+	return nil
+}
+
+// lockedInputIter serializes reads of the inputs, which are shared by the
+// dispatcher and the input and inputs functions of every worker.
+type lockedInputIter struct {
+	inputIter
+	mu sync.Mutex
+}
+
+func (iter *lockedInputIter) Next() (any, bool) {
+	iter.mu.Lock()
+	defer iter.mu.Unlock()
+	return iter.inputIter.Next()
+}
+
+func (iter *lockedInputIter) Name() string {
+	iter.mu.Lock()
+	defer iter.mu.Unlock()
+	return iter.inputIter.Name()
+}
+
+// lockedWriter keeps debug and stderr messages of concurrent workers from
+// interleaving with each other and with reported errors.
+type lockedWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf"
+	"github.com/xen0bit/pwrq/pkg/udf/plugin"
+)
+
+// addDefaultPluginPaths enables loading plugins from defaultPluginPaths
+var addDefaultPluginPaths = true
+
+// defaultPluginPaths are searched for plugins when the config file names
+// no plugin_path
+var defaultPluginPaths = []string{"~/.pwrq/plugins"}
+
+// loadPlugins starts the plugins and adds their functions to the UDF
+// metadata. A plugin that fails to start, or a function named like one
+// already defined, is reported and skipped rather than failing the query
+func (cli *cli) loadPlugins() {
+	dirs := cli.config.PluginPath
+	if len(dirs) == 0 && addDefaultPluginPaths {
+		dirs = defaultPluginPaths
+	}
+	if len(dirs) == 0 {
+		return
+	}
+	expanded := make([]string, len(dirs))
+	for i, dir := range dirs {
+		if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				dir = filepath.Join(home, rest)
+			}
+		}
+		expanded[i] = dir
+	}
+
+	plugins, errs := plugin.Discover(expanded, cli.errStream)
+	for _, err := range errs {
+		fmt.Fprintf(cli.errStream, "%s: %s\n", name, err)
+	}
+	var metadata []udf.FunctionMetadata
+	defined := map[string]bool{}
+	for _, p := range plugins {
+		functions := p.Functions[:0]
+		for _, f := range p.Functions {
+			if defined[f.Name] || udf.FunctionCategory(f.Name) != "" {
+				fmt.Fprintf(cli.errStream, "%s: plugin %s: function %s is already defined\n", name, p.Path, f.Name)
+				continue
+			}
+			defined[f.Name] = true
+			functions = append(functions, f)
+			metadata = append(metadata, udf.FunctionMetadata{
+				Name:        f.Name,
+				MinArgs:     f.MinArgs,
+				MaxArgs:     f.MaxArgs,
+				Description: f.Description,
+				Category:    f.Category,
+				Examples:    f.Examples,
+				Input:       f.Input,
+				Output:      f.Output,
+			})
+		}
+		p.Functions = functions
+	}
+	udf.SetExtraFunctionMetadata(metadata)
+	cli.plugins = plugins
+}
+
+// pluginOptions returns the compiler options registering plugin functions
+func (cli *cli) pluginOptions() []gojq.CompilerOption {
+	var options []gojq.CompilerOption
+	for _, p := range cli.plugins {
+		options = append(options, p.Options()...)
+	}
+	return options
+}
+
+// closePlugins stops the plugins and drops their functions from the UDF
+// metadata
+func (cli *cli) closePlugins() {
+	for _, p := range cli.plugins {
+		p.Close()
+	}
+	cli.plugins = nil
+	udf.SetExtraFunctionMetadata(nil)
+}
@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/graph"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// profile collects the time spent in, and the data passed through, each UDF
+// for --profile, in total and at each place the query calls it, as numbered
+// by udf.CallSites
+type profile struct {
+	start time.Time
+	mu    sync.Mutex
+	funcs map[string]*profileStat
+	sites map[int]*profileStat
+	calls map[int]string // the text of the call at each site
+}
+
+type profileStat struct {
+	Name     string         `json:"name"`
+	Site     int            `json:"site,omitempty"`
+	Call     string         `json:"call,omitempty"`
+	Calls    int            `json:"calls"`
+	Values   int            `json:"values"`
+	Errors   int            `json:"errors"`
+	Sites    []*profileStat `json:"sites,omitempty"` // set when called at more than one site
+	TotalMS  float64        `json:"total_ms"`
+	MeanMS   float64        `json:"mean_ms"`
+	BytesIn  int            `json:"bytes_in"`
+	BytesOut int            `json:"bytes_out"`
+	total    time.Duration
+	err      string // the first _err returned
+}
+
+func newProfile(sites map[*gojq.Func]int) *profile {
+	calls := make(map[int]string, len(sites))
+	for f, site := range sites {
+		calls[site] = f.String()
+	}
+	return &profile{start: time.Now(), funcs: map[string]*profileStat{}, sites: map[int]*profileStat{}, calls: calls}
+}
+
+func (p *profile) observe(c common.Call) {
+	var in, out int
+	if c.Seq == 0 {
+		in = profileBytes(c.Input)
+	}
+	if !c.End {
+		out = profileBytes(c.Output)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.funcs[c.Name]
+	if !ok {
+		s = &profileStat{Name: c.Name}
+		p.funcs[c.Name] = s
+	}
+	s.add(c, in, out)
+	if c.Site == 0 {
+		return
+	}
+	s, ok = p.sites[c.Site]
+	if !ok {
+		s = &profileStat{Name: c.Name, Site: c.Site, Call: p.calls[c.Site]}
+		p.sites[c.Site] = s
+	}
+	s.add(c, in, out)
+}
+
+func (s *profileStat) add(c common.Call, in, out int) {
+	s.total += c.Duration
+	s.BytesIn += in
+	if c.Seq == 0 {
+		s.Calls++
+	}
+	if c.End {
+		return
+	}
+	s.Values++
+	s.BytesOut += out
+	if err, ok := c.Output.(error); ok {
+		s.Errors++
+		if s.err == "" {
+			s.err = err.Error()
+		}
+	} else if common.HasUDFError(c.Output) {
+		s.Errors++
+		if s.err == "" {
+			s.err = common.GetUDFError(c.Output)
+		}
+	}
+}
+
+// profileBytes is the size of a value: the length of a string, or else of
+// its JSON encoding
+func profileBytes(v any) int {
+	switch v := common.ExtractUDFValue(v).(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case error:
+		return 0
+	default:
+		b, err := gojq.Marshal(v)
+		if err != nil {
+			return 0
+		}
+		return len(b)
+	}
+}
+
+// stats returns the collected stats, slowest function first, with the
+// sites of a function called at more than one in the order of the query
+func (p *profile) stats() []*profileStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]*profileStat, 0, len(p.funcs))
+	for _, s := range p.funcs {
+		s.finish()
+		s.Sites = nil
+		stats = append(stats, s)
+	}
+	for _, s := range p.sites {
+		s.finish()
+		f := p.funcs[s.Name]
+		f.Sites = append(f.Sites, s)
+	}
+	for _, s := range stats {
+		if len(s.Sites) < 2 {
+			s.Sites = nil
+		}
+		sort.Slice(s.Sites, func(i, j int) bool { return s.Sites[i].Site < s.Sites[j].Site })
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].total != stats[j].total {
+			return stats[i].total > stats[j].total
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+func (s *profileStat) finish() {
+	s.TotalMS = float64(s.total.Microseconds()) / 1000
+	s.MeanMS = s.TotalMS / float64(s.Calls)
+}
+
+func (s *profileStat) nodeStats() graph.NodeStats {
+	return graph.NodeStats{
+		Calls:    s.Calls,
+		Values:   s.Values,
+		Errors:   s.Errors,
+		Total:    s.total,
+		BytesIn:  s.BytesIn,
+		BytesOut: s.BytesOut,
+	}
+}
+
+// graphStats returns the collected stats of each function for annotating a
+// query graph
+func (p *profile) graphStats() map[string]graph.NodeStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]graph.NodeStats, len(p.funcs))
+	for name, s := range p.funcs {
+		stats[name] = s.nodeStats()
+	}
+	return stats
+}
+
+// graphSiteStats returns the collected stats of each call site for
+// annotating a query graph
+func (p *profile) graphSiteStats() map[int]graph.NodeStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[int]graph.NodeStats, len(p.sites))
+	for site, s := range p.sites {
+		stats[site] = s.nodeStats()
+	}
+	return stats
+}
+
+// graphErrors returns the first _err of each function, and of each call
+// site, that returned one
+func (p *profile) graphErrors() (map[string]string, map[int]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	errs := map[string]string{}
+	for name, s := range p.funcs {
+		if s.Errors > 0 {
+			errs[name] = s.err
+		}
+	}
+	siteErrs := map[int]string{}
+	for site, s := range p.sites {
+		if s.Errors > 0 {
+			siteErrs[site] = s.err
+		}
+	}
+	return errs, siteErrs
+}
+
+// write prints the summary as a table, or as a JSON object
+func (p *profile) write(w io.Writer, asJSON bool) {
+	elapsed := time.Since(p.start)
+	stats := p.stats()
+	if asJSON {
+		b, _ := json.Marshal(map[string]any{
+			"total_ms":  float64(elapsed.Microseconds()) / 1000,
+			"functions": stats,
+		})
+		fmt.Fprintf(w, "%s\n", b)
+		return
+	}
+	fmt.Fprintf(w, "%-24s %8s %8s %8s %12s %12s %12s %12s\n",
+		"function", "calls", "values", "errors", "total", "mean", "bytes in", "bytes out")
+	var udfTime time.Duration
+	row := func(name string, s *profileStat) {
+		fmt.Fprintf(w, "%-24s %8d %8d %8d %12s %12s %12d %12d\n",
+			name, s.Calls, s.Values, s.Errors, profileDuration(s.total),
+			profileDuration(s.total/time.Duration(s.Calls)), s.BytesIn, s.BytesOut)
+	}
+	for _, s := range stats {
+		udfTime += s.total
+		row(s.Name, s)
+		for _, site := range s.Sites {
+			row(profileSiteName(site), site)
+		}
+	}
+	fmt.Fprintf(w, "total %s, of which %s in UDFs\n", profileDuration(elapsed), profileDuration(udfTime))
+}
+
+// profileSiteName is the name of a call site in the table, indented under
+// its function and cut to fit the column
+func profileSiteName(s *profileStat) string {
+	name := []rune(fmt.Sprintf("  #%d %s", s.Site, s.Call))
+	if len(name) > 24 {
+		name = append(name[:23], '…')
+	}
+	return string(name)
+}
+
+func profileDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// progressWidth is the number of cells in a --progress bar
+const progressWidth = 30
+
+// progress writes the updates of long reads by UDFs to the error stream, as
+// bars for --progress or as JSON lines for --progress-json
+type progress struct {
+	mu       sync.Mutex
+	w        io.Writer
+	json     bool
+	tty      bool
+	interval time.Duration
+}
+
+func (cli *cli) newProgress(jsonLines bool) *progress {
+	f, ok := cli.errStream.(interface{ Fd() uintptr })
+	p := &progress{
+		w:    cli.errStream,
+		json: jsonLines,
+		tty:  ok && (isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())),
+	}
+	// A bar on a terminal can be redrawn often; lines that pile up in a log
+	// should not be
+	if p.tty && !p.json {
+		p.interval = 200 * time.Millisecond
+	} else {
+		p.interval = time.Second
+	}
+	return p
+}
+
+type progressLine struct {
+	Op        string   `json:"op"`
+	Name      string   `json:"name"`
+	Done      int64    `json:"done"`
+	Total     *int64   `json:"total,omitempty"`
+	Percent   *float64 `json:"percent,omitempty"`
+	ElapsedMS int64    `json:"elapsed_ms"`
+	Rate      int64    `json:"bytes_per_sec"`
+	End       bool     `json:"end"`
+}
+
+func (p *progress) update(u common.Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var rate int64
+	if secs := u.Elapsed.Seconds(); secs > 0 {
+		rate = int64(float64(u.Done) / secs)
+	}
+	if p.json {
+		line := progressLine{Op: u.Op, Name: u.Name, Done: u.Done,
+			ElapsedMS: u.Elapsed.Milliseconds(), Rate: rate, End: u.End}
+		if u.Total >= 0 {
+			percent := progressPercent(u)
+			line.Total, line.Percent = &u.Total, &percent
+		}
+		b, _ := json.Marshal(line)
+		p.w.Write(append(b, '\n'))
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s %s ", name, u.Op, u.Name)
+	if u.Total >= 0 {
+		cells := int(progressPercent(u) / 100 * progressWidth)
+		fmt.Fprintf(&sb, "[%s%s] %3.0f%% %s/%s", strings.Repeat("#", cells),
+			strings.Repeat("-", progressWidth-cells), progressPercent(u),
+			formatBytes(u.Done), formatBytes(u.Total))
+	} else {
+		sb.WriteString(formatBytes(u.Done))
+	}
+	fmt.Fprintf(&sb, " %s/s", formatBytes(rate))
+	if p.tty {
+		// The bar is redrawn in place until the read is over
+		fmt.Fprintf(p.w, "\r\x1b[K%s", sb.String())
+		if u.End {
+			fmt.Fprintln(p.w)
+		}
+	} else {
+		fmt.Fprintln(p.w, sb.String())
+	}
+}
+
+func progressPercent(u common.Progress) float64 {
+	if u.Total <= 0 || u.Done >= u.Total {
+		return 100
+	}
+	return float64(u.Done) / float64(u.Total) * 100
+}
+
+// formatBytes shows a size in binary units, like 1.5 GiB
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f, unit := float64(n)/1024, 0
+	for f >= 1024 && unit < 4 {
+		f, unit = f/1024, unit+1
+	}
+	return fmt.Sprintf("%.1f %ciB", f, "KMGTP"[unit])
+}
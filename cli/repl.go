@@ -0,0 +1,368 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/graph"
+	"github.com/xen0bit/pwrq/pkg/udf"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+const replPrompt = name + "> "
+
+type replFlagopts struct {
+	InputNull   bool     `short:"n" long:"null-input" description:"use null as input value"`
+	InputRaw    bool     `short:"R" long:"raw-input" description:"read input as raw strings"`
+	InputYAML   bool     `long:"yaml-input" description:"read input as YAML format"`
+	InputSlurp  bool     `short:"s" long:"slurp" description:"read all inputs into an array"`
+	Compact     bool     `short:"c" long:"compact-output" description:"output without pretty-printing"`
+	Color       bool     `short:"C" long:"color" description:"output with colors even if piped"`
+	NoColor     bool     `short:"M" long:"no-color" description:"output without colors"`
+	ModulePaths []string `short:"L" long:"library-path" args:"dir" description:"directory to search modules from"`
+	History     string   `long:"history" args:"file" description:"history file (default ~/.pwrq/history, PWRQ_HISTORY)"`
+	NoConfig    bool     `long:"no-config" description:"ignore the config file"`
+	NoNet       bool     `long:"no-net" description:"disable network access from UDFs"`
+	NoFS        bool     `long:"no-fs" description:"disable file access from UDFs"`
+	ReadOnly    bool     `long:"read-only" description:"let UDFs read files but not change them"`
+	AllowPaths  []string `long:"allow-path" args:"dir" description:"limit UDF file access to this directory"`
+	AllowHosts  []string `long:"allow-host" args:"host" description:"limit UDF network access to this host"`
+	Help        bool     `short:"h" long:"help" description:"display this help information"`
+}
+
+// repl is an interactive session over inputs loaded once
+type repl struct {
+	cli         *cli
+	inputs      []any
+	history     []string
+	historyFile string
+	lastQuery   *gojq.Query
+	last        []any
+	options     []gojq.CompilerOption
+	interactive bool
+	failed      bool
+}
+
+// runREPL implements the repl subcommand:
+//
+//	pwrq repl [OPTIONS] [FILE...]
+//
+// Queries are read line by line and run against every input. Lines
+// starting with a colon are meta-commands
+func (cli *cli) runREPL(args []string) error {
+	var opts replFlagopts
+	args, err := parseFlags(args, &opts)
+	if err != nil {
+		return &flagParseError{err}
+	}
+	if opts.Help {
+		fmt.Fprintf(cli.outStream, `%[1]s repl - interactive query session
+
+Usage:
+  %[1]s repl [OPTIONS] [FILE...]
+
+Input is read once from FILE, or is null without one, since standard
+input carries the queries. Type :help in the session for its commands.
+
+`, name)
+		fmt.Fprintln(cli.outStream, formatFlags(&opts))
+		return nil
+	}
+
+	if err := cli.loadConfig(opts.NoConfig); err != nil {
+		cli.closePlugins()
+		return err
+	}
+	defer cli.closePlugins()
+	if err := common.SetPolicy(common.Policy{
+		NoNet:    opts.NoNet,
+		NoFS:     opts.NoFS,
+		ReadOnly: opts.ReadOnly,
+		Paths:    opts.AllowPaths,
+		Hosts:    opts.AllowHosts,
+	}); err != nil {
+		return err
+	}
+	r := &repl{cli: cli, historyFile: opts.History}
+	// The UDF registry is built once for the session rather than per line
+	r.options = append([]gojq.CompilerOption{
+		gojq.WithModuleLoader(cli.moduleLoader(opts.ModulePaths)),
+		gojq.WithEnvironLoader(os.Environ),
+		gojq.WithVariables(append(append([]string{}, cli.argnames...), "$_")),
+		gojq.WithFunction("debug", 0, 0, cli.funcDebug),
+		gojq.WithFunction("stderr", 0, 0, cli.funcStderr),
+	}, udf.DefaultRegistry().Options()...)
+	r.options = append(r.options, cli.pluginOptions()...)
+	if r.historyFile == "" {
+		r.historyFile = historyPath()
+	}
+	r.loadHistory()
+
+	if len(args) == 0 || opts.InputNull {
+		r.inputs = []any{nil}
+	} else {
+		cli.inputRaw, cli.inputYAML, cli.inputSlurp = opts.InputRaw, opts.InputYAML, opts.InputSlurp
+		if r.inputs, err = cli.readInputs(args); err != nil {
+			return err
+		}
+	}
+
+	cli.outputCompact = opts.Compact
+	defer func(x bool) { noColor = x }(noColor)
+	if opts.Color || opts.NoColor {
+		noColor = opts.NoColor
+	} else {
+		f, ok := cli.outStream.(interface{ Fd() uintptr })
+		noColor = os.Getenv("NO_COLOR") != "" || !(ok && isatty.IsTerminal(f.Fd()))
+	}
+	// Prompts are only shown to a person at a terminal, so piped sessions
+	// print nothing but results
+	in, ok := cli.inStream.(interface{ Fd() uintptr })
+	r.interactive = ok && isatty.IsTerminal(in.Fd())
+	return r.loop()
+}
+
+func (r *repl) loop() error {
+	in := bufio.NewReader(r.cli.inStream)
+	for {
+		if r.interactive {
+			fmt.Fprint(r.cli.errStream, replPrompt)
+		}
+		line, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			if quit := r.eval(line); quit {
+				break
+			}
+		}
+		if err == io.EOF {
+			if r.interactive {
+				fmt.Fprintln(r.cli.errStream)
+			}
+			break
+		}
+	}
+	// A piped session fails like a script would, after running to the end.
+	// The errors were already reported
+	if r.failed && !r.interactive {
+		return &emptyError{errors.New("repl failed")}
+	}
+	return nil
+}
+
+// eval runs one line and reports whether the session should end
+func (r *repl) eval(line string) bool {
+	// !! and !N recall a line from the history
+	if strings.HasPrefix(line, "!") {
+		recalled, err := r.recall(line)
+		if err != nil {
+			r.errorf("%s", err)
+			return false
+		}
+		line = recalled
+		if r.interactive {
+			fmt.Fprintln(r.cli.errStream, line)
+		}
+	}
+	r.addHistory(line)
+
+	if !strings.HasPrefix(line, ":") {
+		r.runQuery(line)
+		return false
+	}
+	cmd, arg, _ := strings.Cut(line[1:], " ")
+	arg = strings.TrimSpace(arg)
+	switch cmd {
+	case "q", "quit", "exit":
+		return true
+	case "help":
+		fmt.Fprint(r.cli.outStream, `Commands:
+  QUERY          run QUERY against the input; $_ is the last result
+  :last          show the last result again
+  :graph [FILE]  D2 diagram of the last query, or render it to FILE
+  :save FILE     write the last result to FILE as JSON lines
+  :funcs [TEXT]  list UDFs, optionally those matching TEXT
+  :history       list previous lines; !! or !N runs one again
+  :quit          leave the session
+`)
+	case "last":
+		r.print(r.last)
+	case "graph":
+		r.graph(arg)
+	case "save":
+		r.save(arg)
+	case "funcs":
+		r.funcs(arg)
+	case "history":
+		for i, h := range r.history {
+			fmt.Fprintf(r.cli.outStream, "%4d  %s\n", i+1, h)
+		}
+	default:
+		r.errorf("unknown command :%s (try :help)", cmd)
+	}
+	return false
+}
+
+func (r *repl) errorf(format string, args ...any) {
+	r.failed = true
+	fmt.Fprintf(r.cli.errStream, "%s: %s\n", name, fmt.Sprintf(format, args...))
+}
+
+// lastValue is the value of $_: the last result, or an array of them when
+// the query had several
+func (r *repl) lastValue() any {
+	if len(r.last) == 1 {
+		return r.last[0]
+	}
+	if r.last == nil {
+		return nil
+	}
+	return r.last
+}
+
+func (r *repl) runQuery(src string) {
+	query, err := gojq.Parse(src)
+	if err != nil {
+		r.errorf("%s", &queryParseError{"<repl>", src, err})
+		return
+	}
+	if err := r.cli.checkCalls(query); err != nil {
+		r.errorf("%s", err)
+		return
+	}
+	code, err := gojq.Compile(query, r.options...)
+	if err != nil {
+		r.errorf("%s", err)
+		return
+	}
+	values := append(append([]any{}, r.cli.argvalues...), r.lastValue())
+
+	var results []any
+	for _, input := range r.inputs {
+		iter := code.Run(input, values...)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				r.errorf("%s", err)
+				break
+			}
+			results = append(results, v)
+		}
+	}
+	r.print(results)
+	r.lastQuery, r.last = query, results
+}
+
+func (r *repl) print(values []any) {
+	if err := r.cli.printValues(gojq.NewIter(values...)); err != nil {
+		r.errorf("%s", err)
+	}
+}
+
+func (r *repl) graph(file string) {
+	if r.lastQuery == nil {
+		r.errorf("no query to graph yet")
+		return
+	}
+	if file != "" {
+		if err := graph.GenerateGraph(r.lastQuery, file, graph.GraphOptions{}); err != nil {
+			r.errorf("failed to generate graph: %s", err)
+			return
+		}
+		fmt.Fprintf(r.cli.outStream, "Graph generated: %s\n", file)
+		return
+	}
+	script, err := graph.GenerateD2(r.lastQuery, graph.GraphOptions{})
+	if err != nil {
+		r.errorf("failed to generate graph: %s", err)
+		return
+	}
+	fmt.Fprint(r.cli.outStream, script)
+}
+
+func (r *repl) save(file string) {
+	if file == "" {
+		r.errorf("usage: :save FILE")
+		return
+	}
+	var data []byte
+	for _, v := range r.last {
+		bs, err := gojq.Marshal(v)
+		if err != nil {
+			r.errorf("%s", err)
+			return
+		}
+		data = append(append(data, bs...), '\n')
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		r.errorf("%s", err)
+		return
+	}
+	fmt.Fprintf(r.cli.outStream, "Saved %d result(s) to %s\n", len(r.last), file)
+}
+
+func (r *repl) funcs(filter string) {
+	metadata := udf.GetFunctionMetadata()
+	sort.Slice(metadata, func(i, j int) bool {
+		return metadata[i].Name < metadata[j].Name
+	})
+	filter = strings.ToLower(filter)
+	for _, meta := range metadata {
+		if filter != "" && !strings.Contains(strings.ToLower(meta.Name+" "+meta.Description+" "+meta.Category), filter) {
+			continue
+		}
+		fmt.Fprintf(r.cli.outStream, "  %-25s %s\n", meta.Name, meta.Description)
+	}
+}
+
+func (r *repl) recall(line string) (string, error) {
+	if len(r.history) == 0 {
+		return "", errors.New("history is empty")
+	}
+	if line == "!!" {
+		return r.history[len(r.history)-1], nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 || n > len(r.history) {
+		return "", fmt.Errorf("no history entry %s", line)
+	}
+	return r.history[n-1], nil
+}
+
+func (r *repl) loadHistory() {
+	if r.historyFile == "" {
+		return
+	}
+	// Queries run outside the REPL can be recalled as well
+	entries, _ := readHistory(r.historyFile)
+	for _, e := range entries {
+		r.history = append(r.history, e.Query)
+	}
+}
+
+func (r *repl) addHistory(line string) {
+	if len(r.history) > 0 && r.history[len(r.history)-1] == line {
+		return
+	}
+	r.history = append(r.history, line)
+	// Only lines typed at a terminal are saved, so a piped script does not
+	// end up in the history file
+	if r.historyFile == "" || !r.interactive {
+		return
+	}
+	appendHistory(r.historyFile, historyEntry{Query: line})
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// traceLimit bounds the length of each value shown by --trace
+const traceLimit = 80
+
+// traceCall writes a line to the error stream for each value a UDF returns,
+// in the shape of the call: input | name(args) -> output
+func (cli *cli) traceCall(c common.Call) {
+	if c.End && c.Seq > 0 {
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: trace: %s | %s", name, traceValue(c.Input), c.Name)
+	for i, arg := range c.Args {
+		if i == 0 {
+			sb.WriteByte('(')
+		} else {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(traceValue(arg))
+	}
+	if len(c.Args) > 0 {
+		sb.WriteByte(')')
+	}
+	sb.WriteString(" -> ")
+	if err, ok := c.Output.(error); ok {
+		sb.WriteString("error: " + err.Error())
+	} else if common.HasUDFError(c.Output) {
+		sb.WriteString("error: " + common.GetUDFError(c.Output))
+	} else if c.Name == "secret" {
+		sb.WriteString("<redacted>")
+	} else if c.End {
+		sb.WriteString("empty")
+	} else {
+		sb.WriteString(traceValue(c.Output))
+	}
+	sb.WriteByte('\n')
+	cli.errStream.Write([]byte(sb.String()))
+}
+
+// traceValue shows the value of a UDF result, or any other value, as JSON
+// cut short at traceLimit characters
+func traceValue(v any) string {
+	b, err := gojq.Marshal(common.ExtractUDFValue(v))
+	if err != nil {
+		return fmt.Sprintf("<%T>", v)
+	}
+	if r := []rune(string(b)); len(r) > traceLimit {
+		return string(r[:traceLimit]) + "…"
+	}
+	return string(b)
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettle is how long --watch waits for a burst of writes to a file to
+// end before running the query again
+const watchSettle = 100 * time.Millisecond
+
+// rerunInputIter reads the inputs afresh each time it is reset, so that a
+// query compiled once can run again on the same files
+type rerunInputIter struct {
+	inputIter
+	open func() inputIter
+}
+
+func (iter *rerunInputIter) reset() {
+	iter.inputIter.Close()
+	iter.inputIter = iter.open()
+}
+
+// watchInputs runs the query, then runs it again, after reset, each time one
+// of the files is written or replaced, until the --timeout passes or pwrq is
+// interrupted. The files are found through their directories, so editors
+// that save by renaming a new file into place are noticed too
+func (cli *cli) watchInputs(files []string, run func() error, reset func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("--watch: %w", err)
+	}
+	defer w.Close()
+	// The events name files by absolute path; report them as they were given
+	watched := map[string]string{}
+	for _, f := range files {
+		path, err := filepath.Abs(f)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+		watched[path] = f
+		if err := w.Add(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("--watch: cannot watch %s: %w", f, err)
+		}
+	}
+
+	for {
+		if err := run(); err != nil {
+			if cli.ctx.Err() != nil {
+				return err
+			}
+			if _, ok := err.(interface{ isEmptyError() }); !ok {
+				fmt.Fprintf(cli.errStream, "%s: %s\n", name, err)
+			}
+		}
+		var changed string
+		var settle <-chan time.Time
+		for changed == "" || settle != nil {
+			select {
+			case <-cli.ctx.Done():
+				return cli.timeoutError()
+			case err, ok := <-w.Errors:
+				if !ok {
+					return nil
+				}
+				return fmt.Errorf("--watch: %w", err)
+			case ev, ok := <-w.Events:
+				if !ok {
+					return nil
+				}
+				if f, ok := watched[ev.Name]; ok && (ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create)) {
+					changed = f
+					settle = time.After(watchSettle)
+				}
+			case <-settle:
+				settle = nil
+			}
+		}
+		fmt.Fprintf(cli.errStream, "--- %s changed at %s ---\n", changed, time.Now().Format("15:04:05"))
+		reset()
+	}
+}
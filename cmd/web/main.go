@@ -1,24 +1,55 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"syscall/js"
+	"time"
+	"unicode/utf16"
 
 	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/graph"
+	"github.com/xen0bit/pwrq/pkg/queryfmt"
+	"github.com/xen0bit/pwrq/pkg/udf"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
 )
 
+// maxPNGScale caps the scale of createPNG, as browsers limit the size of
+// a canvas
+const maxPNGScale = 8
+
+// maxResults caps the values runQuery collects, so that a query like
+// `repeat(.)` can't hang the page
+const maxResults = 10000
+
 func main() {
+	// The browser has no filesystem or network for UDFs to reach; their
+	// modes taking a path fail with a clear error instead
+	common.SetPolicy(common.Policy{NoNet: true, NoFS: true})
+
 	// Expose functions to JavaScript
 	js.Global().Set("validateQuery", js.FuncOf(validateQuery))
 	js.Global().Set("createSVG", js.FuncOf(createSVG))
+	js.Global().Set("createSVGAsync", js.FuncOf(createSVGAsync))
+	js.Global().Set("createPNG", js.FuncOf(createPNG))
+	js.Global().Set("runQuery", js.FuncOf(runQuery))
+	js.Global().Set("formatQuery", js.FuncOf(formatQuery))
+	js.Global().Set("getFunctions", js.FuncOf(getFunctions))
+	js.Global().Set("getCapabilities", js.FuncOf(getCapabilities))
+	js.Global().Set("explainQuery", js.FuncOf(explainQuery))
 
 	// Keep the program running
 	select {}
 }
 
-// validateQuery validates a jq query string
-// Returns: {ok: boolean, err: string}
+// validateQuery validates a jq query string. A syntax error comes with
+// where it is: offset counts from 0 and line and column from 1, all in
+// UTF-16 code units as JavaScript strings do, and token is the text
+// there, empty at the end of the query
+// Returns: {ok: boolean, err: string, offset?, line?, column?: number, token?: string}
 func validateQuery(this js.Value, args []js.Value) interface{} {
 	if len(args) < 1 {
 		return map[string]interface{}{
@@ -37,10 +68,19 @@ func validateQuery(this js.Value, args []js.Value) interface{} {
 
 	_, err := gojq.Parse(queryStr)
 	if err != nil {
-		return map[string]interface{}{
+		result := map[string]interface{}{
 			"ok":  false,
 			"err": err.Error(),
 		}
+		var e *gojq.ParseError
+		if errors.As(err, &e) {
+			offset, line, column := errorPosition(queryStr, e)
+			result["offset"] = offset
+			result["line"] = line
+			result["column"] = column
+			result["token"] = e.Token
+		}
+		return result
 	}
 
 	return map[string]interface{}{
@@ -49,7 +89,8 @@ func validateQuery(this js.Value, args []js.Value) interface{} {
 	}
 }
 
-// createSVG creates an SVG from a jq query string
+// createSVG creates an SVG from a jq query string and optional options
+// object: {layout, direction, theme, padding, sketch, maxLabel}
 // Returns: {svg: string, err: string}
 func createSVG(this js.Value, args []js.Value) interface{} {
 	if len(args) < 1 {
@@ -76,8 +117,18 @@ func createSVG(this js.Value, args []js.Value) interface{} {
 		}
 	}
 
+	var opts graph.GraphOptions
+	if len(args) > 1 {
+		if opts, err = graphOptions(args[1]); err != nil {
+			return map[string]interface{}{
+				"svg": "",
+				"err": err.Error(),
+			}
+		}
+	}
+
 	// Generate SVG using the graph package
-	svg, err := graph.GenerateSVG(query)
+	svg, err := graph.GenerateSVG(query, opts)
 	if err != nil {
 		return map[string]interface{}{
 			"svg": "",
@@ -90,3 +141,501 @@ func createSVG(this js.Value, args []js.Value) interface{} {
 		"err": "",
 	}
 }
+
+// createSVGAsync creates an SVG like createSVG, but returns a promise, and
+// calls the optional onProgress(stage, step, steps) as each stage of the
+// work starts. Between stages the page gets to update, though each stage
+// still holds the thread while it runs; load the module in a Web Worker to
+// keep the page responsive throughout
+// Returns: a promise of the SVG string, rejected with an Error on failure
+func createSVGAsync(this js.Value, args []js.Value) interface{} {
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		resolve, reject := p[0], p[1]
+		go func() {
+			svg, err := generateSVGAsync(args)
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(svg)
+		}()
+		return nil
+	})
+	// The executor runs while the promise is constructed
+	defer executor.Release()
+	return js.Global().Get("Promise").New(executor)
+}
+
+// generateSVGAsync does the work of createSVGAsync, off the call from
+// JavaScript
+func generateSVGAsync(args []js.Value) (string, error) {
+	if len(args) < 1 {
+		return "", errors.New("createSVGAsync requires 1 argument: query string")
+	}
+	queryStr := args[0].String()
+	if queryStr == "" {
+		return "", errors.New("query string cannot be empty")
+	}
+	query, err := gojq.Parse(queryStr)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse query: %v", err)
+	}
+
+	var opts graph.GraphOptions
+	if len(args) > 1 {
+		if opts, err = graphOptions(args[1]); err != nil {
+			return "", err
+		}
+	}
+	var onProgress js.Value
+	if len(args) > 2 && args[2].Type() == js.TypeFunction {
+		onProgress = args[2]
+	}
+	opts.Progress = func(stage string, step, steps int) {
+		if onProgress.Truthy() {
+			onProgress.Invoke(stage, step, steps)
+		}
+		// Sleeping hands the thread back to the event loop, which can
+		// then repaint the page
+		time.Sleep(time.Millisecond)
+	}
+	return graph.GenerateSVG(query, opts)
+}
+
+// createPNG renders a jq query string to PNG at scale times the size of its
+// SVG, 2 by default to stay sharp on high DPI screens, with the options of
+// createSVG. The browser rasterizes the SVG on a canvas, so this needs a
+// page, not a Web Worker
+// Returns: a promise of the PNG as a Blob, rejected with an Error on failure
+func createPNG(this js.Value, args []js.Value) interface{} {
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		resolve, reject := p[0], p[1]
+		go func() {
+			png, err := generatePNG(args)
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(png)
+		}()
+		return nil
+	})
+	// The executor runs while the promise is constructed
+	defer executor.Release()
+	return js.Global().Get("Promise").New(executor)
+}
+
+// generatePNG does the work of createPNG, off the call from JavaScript
+func generatePNG(args []js.Value) (js.Value, error) {
+	if len(args) < 1 {
+		return js.Null(), errors.New("createPNG requires 1 argument: query string")
+	}
+	queryStr := args[0].String()
+	if queryStr == "" {
+		return js.Null(), errors.New("query string cannot be empty")
+	}
+	query, err := gojq.Parse(queryStr)
+	if err != nil {
+		return js.Null(), fmt.Errorf("failed to parse query: %v", err)
+	}
+	scale := 2.0
+	if len(args) > 1 && args[1].Type() == js.TypeNumber {
+		if scale = args[1].Float(); scale <= 0 || scale > maxPNGScale {
+			return js.Null(), fmt.Errorf("scale must be above 0 and at most %d: %v", maxPNGScale, scale)
+		}
+	}
+	var opts graph.GraphOptions
+	if len(args) > 2 {
+		if opts, err = graphOptions(args[2]); err != nil {
+			return js.Null(), err
+		}
+	}
+	svg, err := graph.GenerateSVG(query, opts)
+	if err != nil {
+		return js.Null(), err
+	}
+
+	// Load the SVG as an image, then draw it scaled on a canvas
+	blob := js.Global().Get("Blob").New([]any{svg}, map[string]any{"type": "image/svg+xml"})
+	url := js.Global().Get("URL").Call("createObjectURL", blob)
+	defer js.Global().Get("URL").Call("revokeObjectURL", url)
+	img := js.Global().Get("Image").New()
+	img.Set("src", url)
+	if _, err := await(img.Call("decode")); err != nil {
+		return js.Null(), fmt.Errorf("failed to load the SVG: %w", err)
+	}
+	width, height := img.Get("naturalWidth").Float()*scale, img.Get("naturalHeight").Float()*scale
+	if width == 0 || height == 0 {
+		return js.Null(), errors.New("failed to load the SVG: it has no size")
+	}
+	canvas := js.Global().Get("document").Call("createElement", "canvas")
+	canvas.Set("width", int(width+0.5))
+	canvas.Set("height", int(height+0.5))
+	canvas.Call("getContext", "2d").Call("drawImage", img, 0, 0, width, height)
+
+	done := make(chan js.Value, 1)
+	callback := js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		done <- p[0]
+		return nil
+	})
+	defer callback.Release()
+	canvas.Call("toBlob", callback, "image/png")
+	png := <-done
+	if png.IsNull() {
+		return js.Null(), errors.New("failed to render the SVG to PNG")
+	}
+	return png, nil
+}
+
+// await waits for a JavaScript promise to settle, returning its value or
+// the reason it was rejected
+func await(promise js.Value) (js.Value, error) {
+	done := make(chan js.Value, 1)
+	failed := make(chan js.Value, 1)
+	onDone := js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		v := js.Undefined()
+		if len(p) > 0 {
+			v = p[0]
+		}
+		done <- v
+		return nil
+	})
+	defer onDone.Release()
+	onFailed := js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		failed <- p[0]
+		return nil
+	})
+	defer onFailed.Release()
+	promise.Call("then", onDone, onFailed)
+	select {
+	case v := <-done:
+		return v, nil
+	case reason := <-failed:
+		return js.Null(), errors.New(reason.Call("toString").String())
+	}
+}
+
+// errorPosition locates the token a parse error points at in src. gojq
+// reports the offset in bytes after the token
+func errorPosition(src string, e *gojq.ParseError) (offset, line, column int) {
+	start := min(max(e.Offset-len(e.Token), 0), len(src))
+	before := src[:start]
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return utf16Len(before), strings.Count(before, "\n") + 1, utf16Len(before[lineStart:]) + 1
+}
+
+// utf16Len returns the length of s as a JavaScript string
+func utf16Len(s string) int {
+	var n int
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// formatQuery pretty-prints a jq query string the way `pwrq fmt` does, with
+// an optional line width
+// Returns: {query: string, err: string}
+func formatQuery(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return map[string]interface{}{
+			"query": "",
+			"err":   "formatQuery requires 1 argument: query string",
+		}
+	}
+
+	queryStr := args[0].String()
+	if queryStr == "" {
+		return map[string]interface{}{
+			"query": "",
+			"err":   "query string cannot be empty",
+		}
+	}
+
+	query, err := gojq.Parse(queryStr)
+	if err != nil {
+		return map[string]interface{}{
+			"query": "",
+			"err":   fmt.Sprintf("failed to parse query: %v", err),
+		}
+	}
+	// The parser drops comments, so formatting would lose them
+	if queryfmt.HasComments(queryStr) {
+		return map[string]interface{}{
+			"query": "",
+			"err":   "cannot format a query with comments, which formatting would drop",
+		}
+	}
+
+	width := queryfmt.DefaultWidth
+	if len(args) > 1 && args[1].Type() == js.TypeNumber {
+		if width = args[1].Int(); width <= 0 {
+			return map[string]interface{}{
+				"query": "",
+				"err":   fmt.Sprintf("width must be positive: %d", width),
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"query": strings.TrimSpace(queryfmt.Format(query, width)),
+		"err":   "",
+	}
+}
+
+// runQuery runs a jq query on a JSON input, with the UDFs that need no
+// filesystem, network or other programs. An empty input runs the query on
+// null, and several JSON values run it on each in turn
+// Returns: {results: string (a JSON array), err: string}
+func runQuery(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return map[string]interface{}{
+			"results": "[]",
+			"err":     "runQuery requires 1 argument: query string",
+		}
+	}
+
+	queryStr := args[0].String()
+	if queryStr == "" {
+		return map[string]interface{}{
+			"results": "[]",
+			"err":     "query string cannot be empty",
+		}
+	}
+
+	query, err := gojq.Parse(queryStr)
+	if err != nil {
+		return map[string]interface{}{
+			"results": "[]",
+			"err":     fmt.Sprintf("failed to parse query: %v", err),
+		}
+	}
+	code, err := gojq.Compile(query, udf.PureRegistry().Options()...)
+	if err != nil {
+		return map[string]interface{}{
+			"results": "[]",
+			"err":     fmt.Sprintf("failed to compile query: %v", err),
+		}
+	}
+
+	var inputStr string
+	if len(args) > 1 && args[1].Type() == js.TypeString {
+		inputStr = args[1].String()
+	}
+	inputs, err := decodeInputs(inputStr)
+	if err != nil {
+		return map[string]interface{}{
+			"results": "[]",
+			"err":     fmt.Sprintf("failed to parse input: %v", err),
+		}
+	}
+
+	// Results before an error are kept, as the CLI prints them too
+	results := []any{}
+	var errMsg string
+run:
+	for _, input := range inputs {
+		iter := code.Run(input)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				var haltErr *gojq.HaltError
+				if errors.As(err, &haltErr) && haltErr.Value() == nil {
+					break run
+				}
+				errMsg = err.Error()
+				break run
+			}
+			if len(results) == maxResults {
+				errMsg = fmt.Sprintf("stopped after %d results", maxResults)
+				break run
+			}
+			results = append(results, v)
+		}
+	}
+
+	b, err := gojq.Marshal(results)
+	if err != nil {
+		return map[string]interface{}{
+			"results": "[]",
+			"err":     err.Error(),
+		}
+	}
+	return map[string]interface{}{
+		"results": string(b),
+		"err":     errMsg,
+	}
+}
+
+// getFunctions lists the UDFs runQuery can call, with their arities,
+// descriptions, categories and examples, for autocompletion and inline docs
+// Returns: {functions: string (a JSON array), err: string}
+func getFunctions(this js.Value, args []js.Value) interface{} {
+	b, err := json.Marshal(udf.PureFunctionMetadata())
+	if err != nil {
+		return map[string]interface{}{
+			"functions": "[]",
+			"err":       err.Error(),
+		}
+	}
+	return map[string]interface{}{
+		"functions": string(b),
+		"err":       "",
+	}
+}
+
+// getCapabilities lists every UDF of pwrq with whether runQuery can call
+// it, and if not, whether it needs the filesystem, the network or the system,
+// for the editor to warn about calls that only work natively
+// Returns: {capabilities: string (a JSON array), err: string}
+func getCapabilities(this js.Value, args []js.Value) interface{} {
+	b, err := json.Marshal(udf.FunctionCapabilities())
+	if err != nil {
+		return map[string]interface{}{
+			"capabilities": "[]",
+			"err":          err.Error(),
+		}
+	}
+	return map[string]interface{}{
+		"capabilities": string(b),
+		"err":          "",
+	}
+}
+
+// decodeInputs reads the JSON values of an input, keeping large numbers
+// as they are
+func decodeInputs(s string) ([]any, error) {
+	if strings.TrimSpace(s) == "" {
+		return []any{nil}, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var inputs []any
+	for {
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			if err == io.EOF {
+				return inputs, nil
+			}
+			return nil, err
+		}
+		inputs = append(inputs, v)
+	}
+}
+
+// explainQuery returns the graph of a jq query string as graph.ExportAST
+// writes it, for views of the query other than the SVG
+// Returns: {graph: string (a JSON object), err: string}
+func explainQuery(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return map[string]interface{}{
+			"graph": "",
+			"err":   "explainQuery requires 1 argument: query string",
+		}
+	}
+
+	queryStr := args[0].String()
+	if queryStr == "" {
+		return map[string]interface{}{
+			"graph": "",
+			"err":   "query string cannot be empty",
+		}
+	}
+
+	query, err := gojq.Parse(queryStr)
+	if err != nil {
+		return map[string]interface{}{
+			"graph": "",
+			"err":   fmt.Sprintf("failed to parse query: %v", err),
+		}
+	}
+
+	b, err := graph.ExportAST(query)
+	if err != nil {
+		return map[string]interface{}{
+			"graph": "",
+			"err":   err.Error(),
+		}
+	}
+
+	return map[string]interface{}{
+		"graph": string(b),
+		"err":   "",
+	}
+}
+
+// graphOptions reads graph options from a JS object. Missing fields keep
+// their defaults, and the theme may be a name or an ID
+func graphOptions(v js.Value) (graph.GraphOptions, error) {
+	var opts graph.GraphOptions
+	if v.IsUndefined() || v.IsNull() {
+		return opts, nil
+	}
+	if v.Type() != js.TypeObject {
+		return opts, fmt.Errorf("options must be an object, got %s", v.Type())
+	}
+	field := func(name string, typ js.Type) (js.Value, error) {
+		f := v.Get(name)
+		if f.IsUndefined() || f.IsNull() {
+			return f, nil
+		}
+		if f.Type() != typ {
+			return f, fmt.Errorf("option %s must be a %s, got %s", name, typ, f.Type())
+		}
+		return f, nil
+	}
+	for name, dst := range map[string]*string{"layout": &opts.Layout, "direction": &opts.Direction} {
+		f, err := field(name, js.TypeString)
+		if err != nil {
+			return opts, err
+		}
+		if f.Truthy() {
+			*dst = f.String()
+		}
+	}
+	if theme := v.Get("theme"); theme.Type() == js.TypeNumber {
+		opts.Theme = fmt.Sprint(theme.Int())
+	} else if theme, err := field("theme", js.TypeString); err != nil {
+		return opts, err
+	} else if theme.Truthy() {
+		opts.Theme = theme.String()
+	}
+	padding, err := field("padding", js.TypeNumber)
+	if err != nil {
+		return opts, err
+	}
+	if padding.Type() == js.TypeNumber {
+		n := padding.Int()
+		opts.Padding = &n
+	}
+	sketch, err := field("sketch", js.TypeBoolean)
+	if err != nil {
+		return opts, err
+	}
+	opts.Sketch = sketch.Truthy()
+	categories, err := field("categories", js.TypeBoolean)
+	if err != nil {
+		return opts, err
+	}
+	opts.Categories = categories.Truthy()
+	maxLabel, err := field("maxLabel", js.TypeNumber)
+	if err != nil {
+		return opts, err
+	}
+	if maxLabel.Type() == js.TypeNumber {
+		opts.MaxLabel = maxLabel.Int()
+	}
+	maxDepth, err := field("maxDepth", js.TypeNumber)
+	if err != nil {
+		return opts, err
+	}
+	if maxDepth.Type() == js.TypeNumber {
+		opts.MaxDepth = maxDepth.Int()
+	}
+	return opts, nil
+}
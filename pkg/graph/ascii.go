@@ -0,0 +1,147 @@
+package graph
+
+import (
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/mattn/go-runewidth"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// GenerateASCII draws the flow of a jq query with box-drawing characters,
+// for terminals and logs where an image can't be shown. Stages run top to
+// bottom, and function and object containers are boxes holding their own
+// stages. Of the options, only the label length applies
+func GenerateASCII(query *gojq.Query, opts GraphOptions) (string, error) {
+	opts.Format = "ascii"
+	out, err := Generate(query, opts)
+	return string(out), err
+}
+
+// textNode is a node of the graph as formatASCII draws it
+type textNode struct {
+	label    string
+	round    bool // start and end are drawn with round corners
+	children []*textNode
+	linked   bool   // an edge goes to the next node of the same parent
+	edge     string // the label of that edge
+}
+
+// textTree converts a D2 graph to the nodes formatASCII draws. Edges that
+// don't go from a node to the one after it are returned as text
+func textTree(graph *d2graph.Graph) ([]*textNode, []string) {
+	nodes := map[*d2graph.Object]*textNode{}
+	var convert func([]*d2graph.Object) []*textNode
+	convert = func(objs []*d2graph.Object) []*textNode {
+		list := make([]*textNode, len(objs))
+		for i, obj := range objs {
+			list[i] = &textNode{
+				label:    obj.Label.Value,
+				round:    obj.Shape.Value == "circle",
+				children: convert(obj.ChildrenArray),
+			}
+			nodes[obj] = list[i]
+		}
+		return list
+	}
+	roots := convert(graph.Root.ChildrenArray)
+
+	var others []string
+	for _, edge := range graph.Edges {
+		src, dst := edge.Src, edge.Dst
+		if src.Parent == dst.Parent {
+			siblings := graph.Root.ChildrenArray
+			if src.Parent != nil {
+				siblings = src.Parent.ChildrenArray
+			}
+			if i := indexOf(siblings, src); i >= 0 && i+1 < len(siblings) && siblings[i+1] == dst {
+				nodes[src].linked = true
+				nodes[src].edge = edge.Label.Value
+				continue
+			}
+		}
+		line := src.Label.Value + " → " + dst.Label.Value
+		if edge.Label.Value != "" {
+			line += " (" + edge.Label.Value + ")"
+		}
+		others = append(others, line)
+	}
+	return roots, others
+}
+
+func indexOf(objs []*d2graph.Object, obj *d2graph.Object) int {
+	for i, o := range objs {
+		if o == obj {
+			return i
+		}
+	}
+	return -1
+}
+
+// formatASCII draws nodes one under the other, followed by the edges that
+// could not be drawn as arrows
+func formatASCII(nodes []*textNode, others []string) string {
+	lines := textColumn(nodes)
+	for _, line := range others {
+		lines = append(lines, "↪ "+line)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// textColumn draws nodes one under the other, with an arrow between those
+// linked by an edge
+func textColumn(nodes []*textNode) []string {
+	var lines []string
+	for i, n := range nodes {
+		box := textBox(n)
+		last := i+1 == len(nodes)
+		if n.linked && !last {
+			// The arrow leaves from the bottom border
+			bottom := []rune(box[len(box)-1])
+			bottom[2] = '┬'
+			box[len(box)-1] = string(bottom)
+		}
+		lines = append(lines, box...)
+		switch {
+		case last:
+		case n.linked && n.edge != "":
+			lines = append(lines, "  │ "+n.edge, "  ▼")
+		case n.linked:
+			lines = append(lines, "  │", "  ▼")
+		default:
+			lines = append(lines, "")
+		}
+	}
+	return lines
+}
+
+// textBox draws a node: its label in a box, or for a container, the label
+// in the top border of a box holding the children
+func textBox(n *textNode) []string {
+	corners := []string{"┌", "┐", "└", "┘"}
+	if n.round {
+		corners = []string{"╭", "╮", "╰", "╯"}
+	}
+	label := strings.Split(n.label, "\n")
+	content := label
+	if len(n.children) > 0 {
+		content = textColumn(n.children)
+	}
+	var width int
+	for _, line := range content {
+		width = max(width, runewidth.StringWidth(line))
+	}
+	var top string
+	if len(n.children) > 0 {
+		title := strings.Join(label, " ")
+		width = max(width, runewidth.StringWidth(title)+1)
+		top = corners[0] + "─ " + title + " " + strings.Repeat("─", width-runewidth.StringWidth(title)-1) + corners[1]
+	} else {
+		top = corners[0] + strings.Repeat("─", width+2) + corners[1]
+	}
+	lines := []string{top}
+	for _, line := range content {
+		lines = append(lines, "│ "+line+strings.Repeat(" ", width-runewidth.StringWidth(line))+" │")
+	}
+	return append(lines, corners[2]+strings.Repeat("─", width+2)+corners[3])
+}
@@ -0,0 +1,124 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2oracle"
+)
+
+// varScope follows the variables bound where the traversal is, so that each
+// $x can be tied to the node that defines it
+type varScope struct {
+	bound map[string][]string // variable -> the nodes binding it, innermost last
+	uses  [][2]string         // reference node -> binding node
+}
+
+func newVarScope() *varScope {
+	return &varScope{bound: map[string][]string{}}
+}
+
+// bind makes the variables of patterns refer to nodeID, until the returned
+// function is called at the end of their scope
+func (s *varScope) bind(nodeID string, patterns ...*gojq.Pattern) func() {
+	var names []string
+	for _, p := range patterns {
+		names = append(names, patternVars(p)...)
+	}
+	for _, name := range names {
+		s.bound[name] = append(s.bound[name], nodeID)
+	}
+	return func() {
+		for _, name := range names {
+			s.bound[name] = s.bound[name][:len(s.bound[name])-1]
+		}
+	}
+}
+
+// use records that nodeID reads a variable. Variables bound outside the
+// query, like $ENV and $__loc__, have no node to point to
+func (s *varScope) use(nodeID, name string) {
+	if ids := s.bound[name]; len(ids) > 0 {
+		s.uses = append(s.uses, [2]string{nodeID, ids[len(ids)-1]})
+	}
+}
+
+// patternVars returns the variables a pattern binds, like $a and $b of
+// [$a, {b: $b}]
+func patternVars(p *gojq.Pattern) []string {
+	if p == nil {
+		return nil
+	}
+	if p.Name != "" {
+		return []string{p.Name}
+	}
+	var names []string
+	for _, e := range p.Array {
+		names = append(names, patternVars(e)...)
+	}
+	for _, kv := range p.Object {
+		if strings.HasPrefix(kv.Key, "$") {
+			names = append(names, kv.Key)
+		}
+		names = append(names, patternVars(kv.Val)...)
+	}
+	return names
+}
+
+// isVariable reports whether a term reads a variable, which gojq parses as a
+// call of a function named $x
+func isVariable(term *gojq.Term) bool {
+	return term != nil && term.Type == gojq.TermTypeFunc && term.Func != nil && strings.HasPrefix(term.Func.Name, "$")
+}
+
+// bindingLabel labels the node of E as $x | ..., with the alternatives of
+// destructuring ?// if there are some
+func bindingLabel(patterns []*gojq.Pattern) string {
+	parts := make([]string, len(patterns))
+	for i, p := range patterns {
+		parts[i] = p.String()
+	}
+	return "as " + strings.Join(parts, " ?// ")
+}
+
+// createBindingNode creates the node defining the variables of E as $x,
+// which the output of E flows into
+func createBindingNode(graph *d2graph.Graph, boardPath []string, nodeID string, patterns []*gojq.Pattern) (*d2graph.Graph, error) {
+	graph, _, err := d2oracle.Create(graph, boardPath, nodeID)
+	if err != nil {
+		return graph, fmt.Errorf("failed to create binding node %s: %w", nodeID, err)
+	}
+	shapeHexagon := "hexagon"
+	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.shape", nodeID), nil, &shapeHexagon)
+	if err != nil {
+		return graph, fmt.Errorf("failed to set binding node shape: %w", err)
+	}
+	label := bindingLabel(patterns)
+	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", nodeID), nil, &label)
+	if err != nil {
+		return graph, fmt.Errorf("failed to set binding node label: %w", err)
+	}
+	return graph, nil
+}
+
+// addUseEdges draws a dashed edge from each reference of a variable back to
+// the node binding it
+func addUseEdges(graph *d2graph.Graph, boardPath []string, uses [][2]string) (*d2graph.Graph, error) {
+	var err error
+	for _, u := range uses {
+		edgeKey := fmt.Sprintf("%s -> %s", u[0], u[1])
+		graph, _, err = d2oracle.Create(graph, boardPath, edgeKey)
+		if err != nil {
+			return graph, fmt.Errorf("failed to create use edge: %w", err)
+		}
+		for _, kv := range [][2]string{{"label", "use"}, {"style.stroke-dash", "3"}} {
+			graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("(%s)[0].%s", edgeKey, kv[0]), nil, &kv[1])
+			if err != nil {
+				return graph, fmt.Errorf("failed to set use edge %s: %w", kv[0], err)
+			}
+		}
+	}
+	return graph, nil
+}
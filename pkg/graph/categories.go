@@ -0,0 +1,112 @@
+package graph
+
+import (
+	"fmt"
+
+	"github.com/xen0bit/pwrq/pkg/udf"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2oracle"
+)
+
+// categoryColors fill the nodes of UDFs that reach outside the query, like
+// the network and the filesystem, in colors that stand out
+var categoryColors = map[string]string{
+	"HTTP":            "#0091ff",
+	"Network":         "#00a2c7",
+	"File Operations": "#f76b15",
+	"System":          "#ab4aba",
+	"Hash":            "#46a758",
+	"Encoding":        "#8e8c99",
+	"Encryption":      "#d6409f",
+}
+
+// otherColors fill the nodes of the other categories, in the order of
+// udf.Categories
+var otherColors = []string{"#ffc53d", "#12a594", "#6e56cf", "#978365", "#3e63dd", "#e93d82"}
+
+// categoryColor returns the fill of the nodes of a UDF category
+func categoryColor(category string) string {
+	if color, ok := categoryColors[category]; ok {
+		return color
+	}
+	var i int
+	for _, c := range udf.Categories() {
+		if c == category {
+			break
+		}
+		if _, ok := categoryColors[c]; !ok {
+			i++
+		}
+	}
+	return otherColors[i%len(otherColors)]
+}
+
+// styleCategories fills the node of each UDF with the color of its
+// category, and adds a legend of the categories in the graph
+func styleCategories(graph *d2graph.Graph, boardPath []string) (*d2graph.Graph, error) {
+	// Collect first, as each Set recompiles the graph
+	var ids, fills []string
+	used := map[string]bool{}
+	for _, obj := range graph.Objects {
+		name, ok := funcNodeName(obj)
+		if !ok {
+			continue
+		}
+		m, ok := udf.LookupFunction(name)
+		if !ok {
+			continue
+		}
+		ids = append(ids, obj.AbsID())
+		fills = append(fills, categoryColor(m.Category))
+		used[m.Category] = true
+	}
+	if len(ids) == 0 {
+		return graph, nil
+	}
+
+	set := func(key, value string) error {
+		var err error
+		graph, err = d2oracle.Set(graph, boardPath, key, nil, &value)
+		if err != nil {
+			return fmt.Errorf("failed to style %s: %w", key, err)
+		}
+		return nil
+	}
+	for i, id := range ids {
+		if err := set(id+".style.fill", fills[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// The legend sits in a corner, out of the flow
+	var err error
+	graph, _, err = d2oracle.Create(graph, boardPath, "legend")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create legend: %w", err)
+	}
+	if err := set("legend.label", "Legend"); err != nil {
+		return nil, err
+	}
+	if err := set("legend.near", "bottom-right"); err != nil {
+		return nil, err
+	}
+	var n int
+	for _, category := range udf.Categories() {
+		if !used[category] {
+			continue
+		}
+		id := fmt.Sprintf("legend.category_%d", n)
+		n++
+		graph, _, err = d2oracle.Create(graph, boardPath, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create legend entry: %w", err)
+		}
+		if err := set(id+".label", category); err != nil {
+			return nil, err
+		}
+		if err := set(id+".style.fill", categoryColor(category)); err != nil {
+			return nil, err
+		}
+	}
+	return graph, nil
+}
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2oracle"
+)
+
+// collapseDepth turns the containers at maxDepth, counting top level nodes
+// as depth 1, into summary nodes: their contents are removed, and their
+// label says how many nodes they held. A maxDepth of 0 keeps every level
+func collapseDepth(graph *d2graph.Graph, boardPath []string, maxDepth int) (*d2graph.Graph, error) {
+	if maxDepth <= 0 {
+		return graph, nil
+	}
+	// Collect first, as each change recompiles the graph
+	var hidden []hiddenNode
+	var ids, labels []string
+	var walk func(objs []*d2graph.Object, depth int)
+	walk = func(objs []*d2graph.Object, depth int) {
+		for _, obj := range objs {
+			if depth < maxDepth {
+				walk(obj.ChildrenArray, depth+1)
+				continue
+			}
+			if len(obj.ChildrenArray) == 0 {
+				continue
+			}
+			n := len(hidden)
+			collectHidden(obj.ChildrenArray, depth+1, &hidden)
+			ids = append(ids, obj.AbsID())
+			labels = append(labels, obj.Label.Value+"\n"+formatNodeCount(len(hidden)-n))
+		}
+	}
+	walk(graph.Root.ChildrenArray, 1)
+
+	// The deepest nodes go first, so that no container is deleted while it
+	// still has children, which D2 would move up a level
+	sort.SliceStable(hidden, func(i, j int) bool { return hidden[i].depth > hidden[j].depth })
+	var err error
+	for _, h := range hidden {
+		graph, err = d2oracle.Delete(graph, boardPath, h.id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collapse %s: %w", h.id, err)
+		}
+	}
+	multiple := "true"
+	for i, id := range ids {
+		graph, err = d2oracle.Set(graph, boardPath, id+".label", nil, &labels[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to label collapsed %s: %w", id, err)
+		}
+		graph, err = d2oracle.Set(graph, boardPath, id+".style.multiple", nil, &multiple)
+		if err != nil {
+			return nil, fmt.Errorf("failed to style collapsed %s: %w", id, err)
+		}
+	}
+	return graph, nil
+}
+
+// hiddenNode is a node inside a collapsed container
+type hiddenNode struct {
+	id    string
+	depth int
+}
+
+func collectHidden(objs []*d2graph.Object, depth int, hidden *[]hiddenNode) {
+	for _, obj := range objs {
+		*hidden = append(*hidden, hiddenNode{obj.AbsID(), depth})
+		collectHidden(obj.ChildrenArray, depth+1, hidden)
+	}
+}
+
+// formatNodeCount shows how many nodes a collapsed container held
+func formatNodeCount(n int) string {
+	if n == 1 {
+		return "(1 node)"
+	}
+	return fmt.Sprintf("(%d nodes)", n)
+}
@@ -0,0 +1,208 @@
+package graph
+
+import (
+	"fmt"
+
+	"github.com/itchyny/gojq"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2oracle"
+)
+
+// controlFlowLabels label the containers of control flow constructs
+var controlFlowLabels = map[gojq.TermType]string{
+	gojq.TermTypeIf:      "If",
+	gojq.TermTypeTry:     "Try",
+	gojq.TermTypeReduce:  "Reduce",
+	gojq.TermTypeForeach: "Foreach",
+	gojq.TermTypeLabel:   "Label",
+}
+
+// isControlFlow reports whether a term is drawn as a container of branches
+func isControlFlow(term *gojq.Term) bool {
+	switch term.Type {
+	case gojq.TermTypeIf:
+		return term.If != nil
+	case gojq.TermTypeTry:
+		return term.Try != nil
+	case gojq.TermTypeReduce:
+		return term.Reduce != nil
+	case gojq.TermTypeForeach:
+		return term.Foreach != nil
+	case gojq.TermTypeLabel:
+		return term.Label != nil
+	}
+	return false
+}
+
+// traverseControlFlow draws if, try, reduce, foreach and label as a container
+// holding a container per branch, with edges for the flow between them
+func traverseControlFlow(query *gojq.Query, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
+	nodeID := fmt.Sprintf("node_%d", *nodeCounter)
+	*nodeCounter++
+
+	var err error
+	graph, err = createControlFlowNode(query.Term, graph, boardPath, nodeID)
+	if err != nil {
+		return "", graph, err
+	}
+	if err := connectNodeFromPrevious(graph, boardPath, *lastNodeID, nodeID, prevOutputType, tr); err != nil {
+		return "", graph, err
+	}
+	graph, err = addControlFlowBranches(query.Term, graph, boardPath, nodeID, prevOutputType, tr)
+	if err != nil {
+		return "", graph, err
+	}
+
+	*lastNodeID = nodeID
+	return inferOutputType(query, query.Op), graph, nil
+}
+
+// handleControlFlowInContainer draws a control flow construct inside a
+// container, the way traverseControlFlow does at the top level
+func handleControlFlowInContainer(query *gojq.Query, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
+	nodeID := fmt.Sprintf("%s.child_%d", containerID, *childCounter)
+	*childCounter++
+
+	var err error
+	graph, err = createControlFlowNode(query.Term, graph, boardPath, nodeID)
+	if err != nil {
+		return "", graph, err
+	}
+
+	// Connect from previous (but not from container itself)
+	if *lastNodeID != "start" && *lastNodeID != containerID {
+		if err := connectNodeFromPrevious(graph, boardPath, *lastNodeID, nodeID, prevOutputType, tr); err != nil {
+			return "", graph, err
+		}
+	}
+	graph, err = addControlFlowBranches(query.Term, graph, boardPath, nodeID, prevOutputType, tr)
+	if err != nil {
+		return "", graph, err
+	}
+
+	*lastNodeID = nodeID
+	return inferOutputType(query, query.Op), graph, nil
+}
+
+// createControlFlowNode creates the container of a control flow construct
+func createControlFlowNode(term *gojq.Term, graph *d2graph.Graph, boardPath []string, nodeID string) (*d2graph.Graph, error) {
+	graph, _, err := d2oracle.Create(graph, boardPath, nodeID)
+	if err != nil {
+		return graph, fmt.Errorf("failed to create control flow node %s: %w", nodeID, err)
+	}
+	label := controlFlowLabels[term.Type]
+	if term.Type == gojq.TermTypeLabel {
+		label += " " + term.Label.Ident
+	}
+	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", nodeID), nil, &label)
+	if err != nil {
+		return graph, fmt.Errorf("failed to set control flow label: %w", err)
+	}
+	return graph, nil
+}
+
+// addControlFlowBranches fills the container of a control flow construct:
+//
+//	if:      Condition -truthy-> Then, -falsy-> the next Elif or Else
+//	try:     Body -error-> Catch
+//	reduce:  Source as $x -each-> Update <-initial- Init, where $x is bound
+//	foreach: as reduce, then Update -state-> Extract
+//	label:   the body's stages
+func addControlFlowBranches(term *gojq.Term, graph *d2graph.Graph, boardPath []string, nodeID, prevOutputType string, tr *traversal) (*d2graph.Graph, error) {
+	counter := 0
+	var err error
+	branch := func(label string, q *gojq.Query) string {
+		if err != nil {
+			return ""
+		}
+		var id string
+		id, graph, err = addBranch(graph, boardPath, nodeID, &counter, label, q, prevOutputType, tr)
+		return id
+	}
+	var edges [][3]string // from, to, label
+	switch term.Type {
+	case gojq.TermTypeIf:
+		cond := branch("Condition", term.If.Cond)
+		edges = append(edges, [3]string{cond, branch("Then", term.If.Then), "truthy"})
+		for _, elif := range term.If.Elif {
+			next := branch("Elif", elif.Cond)
+			edges = append(edges, [3]string{cond, next, "falsy"}, [3]string{next, branch("Then", elif.Then), "truthy"})
+			cond = next
+		}
+		label := "Else"
+		if term.If.Else == nil {
+			label = "Else (.)"
+		}
+		edges = append(edges, [3]string{cond, branch(label, term.If.Else), "falsy"})
+	case gojq.TermTypeTry:
+		body := branch("Body", term.Try.Body)
+		label := "Catch"
+		if term.Try.Catch == nil {
+			label = "Catch (empty)"
+		}
+		edges = append(edges, [3]string{body, branch(label, term.Try.Catch), "error"})
+	case gojq.TermTypeReduce:
+		source := branch("Source as "+term.Reduce.Pattern.String(), term.Reduce.Query)
+		init := branch("Init", term.Reduce.Start)
+		unbind := tr.bind(source, term.Reduce.Pattern)
+		update := branch("Update", term.Reduce.Update)
+		unbind()
+		edges = append(edges, [3]string{source, update, "each"}, [3]string{init, update, "initial"})
+	case gojq.TermTypeForeach:
+		source := branch("Source as "+term.Foreach.Pattern.String(), term.Foreach.Query)
+		init := branch("Init", term.Foreach.Start)
+		unbind := tr.bind(source, term.Foreach.Pattern)
+		update := branch("Update", term.Foreach.Update)
+		edges = append(edges, [3]string{source, update, "each"}, [3]string{init, update, "initial"})
+		if term.Foreach.Extract != nil {
+			edges = append(edges, [3]string{update, branch("Extract", term.Foreach.Extract), "state"})
+		}
+		unbind()
+	case gojq.TermTypeLabel:
+		// The body is drawn in the container itself, as break leaves it
+		childLastNodeID := "start"
+		_, graph, err = traverseInContainer(term.Label.Body, graph, boardPath, nodeID, &counter, &childLastNodeID, prevOutputType, tr)
+	}
+	if err != nil {
+		return graph, err
+	}
+
+	for _, e := range edges {
+		edgeKey := fmt.Sprintf("%s -> %s", e[0], e[1])
+		graph, _, err = d2oracle.Create(graph, boardPath, edgeKey)
+		if err != nil {
+			return graph, fmt.Errorf("failed to create branch edge: %w", err)
+		}
+		label := e[2]
+		graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("(%s)[0].label", edgeKey), nil, &label)
+		if err != nil {
+			return graph, fmt.Errorf("failed to set branch edge label: %w", err)
+		}
+	}
+	return graph, nil
+}
+
+// addBranch creates a container for one branch of a control flow construct
+// holding the stages of q, or a plain node when the branch is left out
+func addBranch(graph *d2graph.Graph, boardPath []string, parentID string, counter *int, label string, q *gojq.Query, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
+	branchID := fmt.Sprintf("%s.child_%d", parentID, *counter)
+	*counter++
+
+	graph, _, err := d2oracle.Create(graph, boardPath, branchID)
+	if err != nil {
+		return "", graph, fmt.Errorf("failed to create branch %s: %w", branchID, err)
+	}
+	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", branchID), nil, &label)
+	if err != nil {
+		return "", graph, fmt.Errorf("failed to set branch label: %w", err)
+	}
+	if q != nil {
+		childCounter := 0
+		childLastNodeID := "start"
+		_, graph, err = traverseInContainer(q, graph, boardPath, branchID, &childCounter, &childLastNodeID, prevOutputType, tr)
+		if err != nil {
+			return "", graph, fmt.Errorf("failed to traverse branch %s: %w", branchID, err)
+		}
+	}
+	return branchID, graph, nil
+}
@@ -0,0 +1,143 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// CorpusResult is the outcome of re-rendering a single corpus query
+type CorpusResult struct {
+	Name    string // query file name, e.g. "pipe_chain.jq"
+	Golden  string // path to the golden .d2 file
+	Want    string // golden D2 script (empty if missing)
+	Got     string // freshly rendered D2 script
+	Err     error  // parse or render error
+	Updated bool   // golden was rewritten
+
+	// Unsupported lists constructs the query uses that cannot be drawn
+	// yet. Such queries are not compared with a golden
+	Unsupported []string
+}
+
+// OK reports whether the rendered script matches its golden, or has no
+// golden because the query is unsupported
+func (r CorpusResult) OK() bool {
+	return r.Err == nil && (r.Updated || len(r.Unsupported) > 0 || r.Want == r.Got)
+}
+
+// Diff returns a line diff from the golden to the rendered script
+func (r CorpusResult) Diff() string {
+	return diffLines(r.Want, r.Got)
+}
+
+// CheckCorpus renders every *.jq file in dir and compares the D2 output with
+// the .d2 golden next to it. With update set, goldens are rewritten instead.
+// Queries using constructs listed by Unsupported are reported but not
+// compared, so no golden locks in their placeholder output
+func CheckCorpus(dir string, update bool) ([]CorpusResult, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jq"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .jq queries found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	results := make([]CorpusResult, 0, len(paths))
+	for _, path := range paths {
+		result := CorpusResult{
+			Name:   filepath.Base(path),
+			Golden: strings.TrimSuffix(path, ".jq") + ".d2",
+		}
+		result.Got, result.Unsupported, result.Err = renderCorpusQuery(path)
+		if result.Err == nil && len(result.Unsupported) > 0 {
+			results = append(results, result)
+			continue
+		}
+		if result.Err == nil {
+			want, err := os.ReadFile(result.Golden)
+			switch {
+			case err == nil:
+				result.Want = string(want)
+			case errors.Is(err, fs.ErrNotExist):
+				if !update {
+					result.Err = fmt.Errorf("missing golden file %s", result.Golden)
+				}
+			default:
+				result.Err = err
+			}
+		}
+		if result.Err == nil && update && result.Want != result.Got {
+			if err := os.WriteFile(result.Golden, []byte(result.Got), 0644); err != nil {
+				return nil, err
+			}
+			result.Updated = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// renderCorpusQuery parses a query file and returns its D2 script and the
+// constructs in it that cannot be drawn
+func renderCorpusQuery(path string) (string, []string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	query, err := gojq.Parse(strings.TrimSpace(string(src)))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse query: %w", err)
+	}
+	script, err := GenerateD2(query, GraphOptions{})
+	return script, Unsupported(query), err
+}
+
+// diffLines produces a minimal line diff using the longest common subsequence.
+// Unchanged lines are prefixed with two spaces, removals with "- " and
+// additions with "+ "
+func diffLines(want, got string) string {
+	a := strings.Split(want, "\n")
+	b := strings.Split(got, "\n")
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			sb.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			sb.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			sb.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+	return sb.String()
+}
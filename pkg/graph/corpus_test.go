@@ -0,0 +1,134 @@
+package graph
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden .d2 files in testdata/queries")
+
+func TestQueryCorpus(t *testing.T) {
+	results, err := CheckCorpus(filepath.Join("testdata", "queries"), *updateGolden)
+	if err != nil {
+		t.Fatalf("CheckCorpus failed: %v", err)
+	}
+	for _, r := range results {
+		t.Run(strings.TrimSuffix(r.Name, ".jq"), func(t *testing.T) {
+			if r.Err != nil {
+				t.Fatalf("%s: %v", r.Name, r.Err)
+			}
+			if len(r.Unsupported) > 0 {
+				t.Skipf("%s uses unsupported %v", r.Name, r.Unsupported)
+			}
+			if r.Updated {
+				t.Logf("updated %s", r.Golden)
+			}
+			if !r.OK() {
+				t.Errorf("%s does not match %s (re-run with -update to accept):\n%s", r.Name, r.Golden, r.Diff())
+			}
+		})
+	}
+}
+
+func TestCheckCorpus_DetectsDrift(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "q.jq"), []byte("md5 | ._val\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Missing golden is an error unless updating
+	results, err := CheckCorpus(dir, false)
+	if err != nil {
+		t.Fatalf("CheckCorpus failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("Expected missing golden error, got %+v", results)
+	}
+
+	results, err = CheckCorpus(dir, true)
+	if err != nil {
+		t.Fatalf("CheckCorpus failed: %v", err)
+	}
+	if !results[0].OK() || !results[0].Updated {
+		t.Fatalf("Expected golden to be written, got %+v", results[0])
+	}
+
+	// Tamper with the golden and expect a diff naming the changed line
+	golden := filepath.Join(dir, "q.d2")
+	content, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(content), "Start", "Begin", 1)
+	if err := os.WriteFile(golden, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+	results, err = CheckCorpus(dir, false)
+	if err != nil {
+		t.Fatalf("CheckCorpus failed: %v", err)
+	}
+	if results[0].OK() {
+		t.Fatal("Expected tampered golden to be reported")
+	}
+	diff := results[0].Diff()
+	if !strings.Contains(diff, "- ") || !strings.Contains(diff, "Begin") || !strings.Contains(diff, "+ ") {
+		t.Errorf("Diff should show removed and added lines, got:\n%s", diff)
+	}
+}
+
+func TestCheckCorpus_Unsupported(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "q.jq"), []byte("def f: .; f\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither a missing golden nor an update applies
+	results, err := CheckCorpus(dir, true)
+	if err != nil {
+		t.Fatalf("CheckCorpus failed: %v", err)
+	}
+	r := results[0]
+	if !r.OK() || r.Updated || !reflect.DeepEqual(r.Unsupported, []string{"def"}) {
+		t.Fatalf("Expected an unsupported result, got %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "q.d2")); !os.IsNotExist(err) {
+		t.Errorf("Expected no golden to be written, got %v", err)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`md5 | ._val`, nil},
+		{`map(. as $x | {a: $x})`, nil},
+		{`if .a then 1 else 2 end`, nil},
+		{`map(try json_parse catch null) | reduce .[] as $x (0; . + $x)`, nil},
+		{`[foreach .[] as $x (0; . + $x)] | "\(label $out | 1)"`, nil},
+		{`def f: .; {a: (.b | f)}`, []string{"def"}},
+		{`if .a then (def f: .; f) else . end`, []string{"def"}},
+		{`reduce .[] as $x (0; def g: $x; . + g)`, []string{"def"}},
+	}
+	for _, tt := range tests {
+		query, err := gojq.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got := Unsupported(query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Unsupported(%s) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCorpus_EmptyDir(t *testing.T) {
+	if _, err := CheckCorpus(t.TempDir(), false); err == nil {
+		t.Error("Expected error for a directory with no queries")
+	}
+}
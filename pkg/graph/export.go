@@ -0,0 +1,73 @@
+package graph
+
+import (
+	"encoding/json"
+
+	"github.com/itchyny/gojq"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// ExportVersion is the version of the JSON layout ExportAST writes. It
+// changes only when fields are removed or change meaning
+const ExportVersion = 1
+
+// ExportedGraph is the graph of a query as ExportAST writes it
+type ExportedGraph struct {
+	Version int            `json:"version"`
+	Nodes   []ExportedNode `json:"nodes"`
+	Edges   []ExportedEdge `json:"edges"`
+}
+
+// ExportedNode is a node of an exported graph. Nodes inside a container
+// name it as their parent, and follow it
+type ExportedNode struct {
+	ID     string `json:"id"`
+	Parent string `json:"parent,omitempty"`
+	Label  string `json:"label"`
+	Shape  string `json:"shape"`
+}
+
+// ExportedEdge is an edge of an exported graph, with the type of the values
+// it carries when it is known
+type ExportedEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// ExportAST returns the graph of a jq query as JSON, for tools drawing it
+// their own way: its nodes, with their whole labels, and its edges, with
+// the types inferred for them. It is Generate with the "json" format
+func ExportAST(query *gojq.Query) ([]byte, error) {
+	return Generate(query, GraphOptions{Format: "json", MaxLabel: -1})
+}
+
+// exportJSON writes a graph and its edge types as an ExportedGraph
+func exportJSON(graph *d2graph.Graph, edgeTypes map[string]string) ([]byte, error) {
+	g := ExportedGraph{Version: ExportVersion, Nodes: []ExportedNode{}, Edges: []ExportedEdge{}}
+	for _, obj := range graph.Objects {
+		node := ExportedNode{ID: obj.AbsID(), Label: obj.Label.Value, Shape: obj.Shape.Value}
+		if obj.Parent != nil && obj.Parent != graph.Root {
+			node.Parent = obj.Parent.AbsID()
+		}
+		if node.Shape == "" {
+			node.Shape = "rectangle"
+		}
+		g.Nodes = append(g.Nodes, node)
+	}
+	for _, edge := range graph.Edges {
+		from, to := edge.Src.AbsID(), edge.Dst.AbsID()
+		g.Edges = append(g.Edges, ExportedEdge{
+			From:  from,
+			To:    to,
+			Label: edge.Label.Value,
+			Type:  edgeTypes[from+" -> "+to],
+		})
+	}
+	out, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
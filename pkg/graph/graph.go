@@ -3,12 +3,14 @@ package graph
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf"
 	"oss.terrastruct.com/d2/d2format"
 	"oss.terrastruct.com/d2/d2graph"
 	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
@@ -21,94 +23,131 @@ import (
 	"oss.terrastruct.com/d2/lib/textmeasure"
 )
 
-// GenerateSVG generates an SVG string from a jq query
-func GenerateSVG(query *gojq.Query) (string, error) {
-	// Create context with a logger
-	ctx := context.Background()
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	ctx = d2log.With(ctx, logger)
+// Formats are the output formats of GraphOptions.Format
+var Formats = []string{"svg", "d2", "mermaid", "ascii", "json", "png", "pdf"}
+
+// formatExtensions map output file extensions to formats
+var formatExtensions = map[string]string{
+	".svg":  "svg",
+	".d2":   "d2",
+	".mmd":  "mermaid",
+	".json": "json",
+	".png":  "png",
+	".pdf":  "pdf",
+}
 
-	// Start with an empty graph
-	_, graph, err := d2lib.Compile(ctx, "", nil, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to initialize graph: %w", err)
+// FormatForPath returns the format GenerateGraph writes to a file, from its
+// extension
+func FormatForPath(path string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	format, ok := formatExtensions[ext]
+	if !ok {
+		return "", fmt.Errorf("unsupported output format: %s (supported formats: .d2, .mmd, .json, .svg, .png, .pdf)", ext)
 	}
+	return format, nil
+}
 
-	nodeCounter := 0
-	lastNodeID := "start"
-	var lastOutputType string
-	boardPath := []string{}
-
-	// Create start node
-	graph, startKey, err := d2oracle.Create(graph, boardPath, "start")
+// Generate renders the flow of a jq query in the format of opts, without
+// touching the filesystem
+func Generate(query *gojq.Query, opts GraphOptions) ([]byte, error) {
+	resolved, err := opts.resolve()
 	if err != nil {
-		return "", fmt.Errorf("failed to create start node: %w", err)
+		return nil, err
 	}
-	shapeCircle := "circle"
-	labelStart := "Start"
-	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.shape", startKey), nil, &shapeCircle)
+	ctx := newContext()
+	graph, edgeTypes, err := buildGraph(ctx, query, resolved)
 	if err != nil {
-		return "", fmt.Errorf("failed to set start node shape: %w", err)
-	}
-	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", startKey), nil, &labelStart)
+		return nil, err
+	}
+
+	switch resolved.format {
+	case "json":
+		resolved.report("write")
+		return exportJSON(graph, edgeTypes)
+	case "d2":
+		// Plain D2 script text without directives, so that they don't become
+		// nodes. Users can add directives if they need them
+		resolved.report("write")
+		return []byte(d2format.Format(graph.AST)), nil
+	case "mermaid":
+		resolved.report("write")
+		return []byte(formatMermaid(graph, resolved.direction)), nil
+	case "ascii":
+		resolved.report("write")
+		return []byte(formatASCII(textTree(graph))), nil
+	}
+
+	out, err := renderSVG(ctx, d2format.Format(graph.AST), resolved)
 	if err != nil {
-		return "", fmt.Errorf("failed to set start node label: %w", err)
-	}
+		return nil, err
+	}
+	// PNG and PDF are rendered from the SVG
+	switch resolved.format {
+	case "png":
+		resolved.report("convert")
+		return renderPNG(out)
+	case "pdf":
+		resolved.report("convert")
+		return renderPDF(out)
+	}
+	return out, nil
+}
 
-	// Traverse the query AST and build graph programmatically
-	lastOutputType, graph, err = traverseQueryWithOracle(query, graph, boardPath, &nodeCounter, &lastNodeID, "")
+// GenerateTo renders the flow of a jq query like Generate, writing it to w
+func GenerateTo(w io.Writer, query *gojq.Query, opts GraphOptions) error {
+	out, err := Generate(query, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to traverse query: %w", err)
+		return err
 	}
+	_, err = w.Write(out)
+	return err
+}
 
-	// Add end node
-	endNodeID := fmt.Sprintf("end_%d", nodeCounter)
-	graph, endKey, err := d2oracle.Create(graph, boardPath, endNodeID)
-	if err != nil {
-		return "", fmt.Errorf("failed to create end node: %w", err)
-	}
-	labelEnd := "End"
-	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.shape", endKey), nil, &shapeCircle)
+// GenerateSVG generates an SVG string from a jq query
+func GenerateSVG(query *gojq.Query, opts GraphOptions) (string, error) {
+	opts.Format = "svg"
+	out, err := Generate(query, opts)
+	return string(out), err
+}
+
+// GenerateGraph creates a diagram representing the flow of a jq query, in
+// the format of the extension of outputPath, which overrides opts.Format
+func GenerateGraph(query *gojq.Query, outputPath string, opts GraphOptions) error {
+	format, err := FormatForPath(outputPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to set end node shape: %w", err)
+		return err
 	}
-	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", endKey), nil, &labelEnd)
+	opts.Format = format
+	out, err := Generate(query, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to set end node label: %w", err)
-	}
-
-	// Connect last node to end
-	if lastNodeID != "start" {
-		edgeKey := fmt.Sprintf("%s -> %s", lastNodeID, endNodeID)
-		graph, _, err = d2oracle.Create(graph, boardPath, edgeKey)
-		if err != nil {
-			return "", fmt.Errorf("failed to create end edge: %w", err)
-		}
-		if lastOutputType != "" {
-			formattedType := formatEdgeLabel(lastOutputType)
-			if formattedType != "" {
-				graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", edgeKey), nil, &formattedType)
-				if err != nil {
-					return "", fmt.Errorf("failed to set end edge label: %w", err)
-				}
-			}
-		}
+		return err
 	}
+	return os.WriteFile(outputPath, out, 0644)
+}
 
-	// Format the graph AST to D2 script
-	d2Script := d2format.Format(graph.AST)
+// newContext returns a context whose logger keeps the D2 library's warnings
+// quiet while still reporting its errors
+func newContext() context.Context {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	return d2log.With(context.Background(), logger)
+}
 
-	// For SVG, prepend directives
-	svgD2Script := "direction: right\nlayout: dagre\n" + d2Script
+// renderSVG lays out a D2 script and renders it to SVG
+func renderSVG(ctx context.Context, d2Script string, opts resolvedOptions) ([]byte, error) {
+	// Prepend directives for layout direction
+	// Theme will be set via RenderOpts to avoid creating a node
+	// Layout is needed for compilation
+	svgD2Script := fmt.Sprintf("direction: %s\nlayout: %s\n", opts.direction, opts.layout) + d2Script
 
-	// Set up text measurement ruler
+	// Set up text measurement ruler for D2 compilation
 	ruler, err := textmeasure.NewRuler()
 	if err != nil {
-		return "", fmt.Errorf("failed to create text ruler: %w", err)
+		return nil, fmt.Errorf("failed to create text ruler: %w", err)
 	}
 
-	// Compile the D2 script
-	layoutStr := "dagre"
+	// Compile the D2 script with layout and ruler
+	// ELK supports container-to-descendant edges, dagre is the default
+	layoutStr := opts.layout
 	compileOpts := &d2lib.CompileOptions{
 		Layout: &layoutStr,
 		Ruler:  ruler,
@@ -122,12 +161,20 @@ func GenerateSVG(query *gojq.Query) (string, error) {
 			return nil, fmt.Errorf("unknown layout engine: %s", engine)
 		},
 	}
-	diagram, _, err := d2lib.Compile(ctx, svgD2Script, compileOpts, nil)
+	themeID := opts.themeID
+	renderOpts := &d2svg.RenderOpts{
+		Pad:     &opts.padding,
+		Sketch:  &opts.sketch,
+		ThemeID: &themeID,
+	}
+	opts.report("layout")
+	diagram, _, err := d2lib.Compile(ctx, svgD2Script, compileOpts, renderOpts)
 	if err != nil {
-		return "", fmt.Errorf("failed to compile D2 diagram: %w", err)
+		return nil, fmt.Errorf("failed to compile D2 diagram: %w", err)
 	}
 
-	// Remove directive nodes
+	// Remove directive nodes (theme, layout, layout.dir, direction) from the diagram
+	// These are created when we add directives to the script, but we don't want them rendered
 	if diagram != nil {
 		var filteredShapes []d2target.Shape
 		for _, shape := range diagram.Shapes {
@@ -139,191 +186,185 @@ func GenerateSVG(query *gojq.Query) (string, error) {
 	}
 
 	// Render to SVG
-	pad := int64(d2svg.DEFAULT_PADDING)
-	themeID := int64(200) // dark-mauve theme
-	svgBytes, err := d2svg.Render(diagram, &d2svg.RenderOpts{
-		Pad:     &pad,
-		ThemeID: &themeID,
-	})
+	opts.report("render")
+	svgBytes, err := d2svg.Render(diagram, renderOpts)
 	if err != nil {
-		return "", fmt.Errorf("failed to render D2 diagram to SVG: %w", err)
+		return nil, fmt.Errorf("failed to render D2 diagram to SVG: %w", err)
 	}
-
-	return string(svgBytes), nil
+	return svgBytes, nil
 }
 
-// GenerateGraph creates a D2 diagram representing the flow of a jq query
-func GenerateGraph(query *gojq.Query, outputPath string) error {
-	// Resolve absolute output path
-	outputPath, err := filepath.Abs(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to resolve output path: %w", err)
-	}
-
-	// Create context with a logger to suppress D2 library warnings
-	// Use a no-op logger to silence the warnings while still allowing D2 to function
-	ctx := context.Background()
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	ctx = d2log.With(ctx, logger)
+// GenerateD2 returns the D2 script describing the flow of a jq query. Of
+// the options, only the label length applies, as the script has no
+// directives
+func GenerateD2(query *gojq.Query, opts GraphOptions) (string, error) {
+	opts.Format = "d2"
+	out, err := Generate(query, opts)
+	return string(out), err
+}
 
-	// Start with an empty graph (following d2oracle pattern from blog post)
+// buildGraph builds the start -> query -> end graph, and returns it with the
+// types of the values on its edges
+func buildGraph(ctx context.Context, query *gojq.Query, opts resolvedOptions) (*d2graph.Graph, map[string]string, error) {
+	// Start with an empty graph
+	opts.report("build")
 	_, graph, err := d2lib.Compile(ctx, "", nil, nil)
 	if err != nil {
-		return fmt.Errorf("failed to initialize graph: %w", err)
+		return nil, nil, fmt.Errorf("failed to initialize graph: %w", err)
 	}
 
 	nodeCounter := 0
 	lastNodeID := "start"
 	var lastOutputType string
-	boardPath := []string{} // Empty board path for root level
+	boardPath := []string{}
 
-	// Create start node using d2oracle
+	// Create start node
 	graph, startKey, err := d2oracle.Create(graph, boardPath, "start")
 	if err != nil {
-		return fmt.Errorf("failed to create start node: %w", err)
+		return nil, nil, fmt.Errorf("failed to create start node: %w", err)
 	}
 	shapeCircle := "circle"
 	labelStart := "Start"
 	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.shape", startKey), nil, &shapeCircle)
 	if err != nil {
-		return fmt.Errorf("failed to set start node shape: %w", err)
+		return nil, nil, fmt.Errorf("failed to set start node shape: %w", err)
 	}
 	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", startKey), nil, &labelStart)
 	if err != nil {
-		return fmt.Errorf("failed to set start node label: %w", err)
+		return nil, nil, fmt.Errorf("failed to set start node label: %w", err)
 	}
 
 	// Traverse the query AST and build graph programmatically
-	lastOutputType, graph, err = traverseQueryWithOracle(query, graph, boardPath, &nodeCounter, &lastNodeID, "")
+	tr := newTraversal(udf.CallSites(query))
+	lastOutputType, graph, err = traverseQueryWithOracle(query, graph, boardPath, &nodeCounter, &lastNodeID, "", tr)
 	if err != nil {
-		return fmt.Errorf("failed to traverse query: %w", err)
+		return nil, nil, fmt.Errorf("failed to traverse query: %w", err)
 	}
 
 	// Add end node
 	endNodeID := fmt.Sprintf("end_%d", nodeCounter)
 	graph, endKey, err := d2oracle.Create(graph, boardPath, endNodeID)
 	if err != nil {
-		return fmt.Errorf("failed to create end node: %w", err)
+		return nil, nil, fmt.Errorf("failed to create end node: %w", err)
 	}
 	labelEnd := "End"
 	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.shape", endKey), nil, &shapeCircle)
 	if err != nil {
-		return fmt.Errorf("failed to set end node shape: %w", err)
+		return nil, nil, fmt.Errorf("failed to set end node shape: %w", err)
 	}
 	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", endKey), nil, &labelEnd)
 	if err != nil {
-		return fmt.Errorf("failed to set end node label: %w", err)
+		return nil, nil, fmt.Errorf("failed to set end node label: %w", err)
 	}
 
-	// Connect last node to end with type
+	// Connect last node to end
 	if lastNodeID != "start" {
 		edgeKey := fmt.Sprintf("%s -> %s", lastNodeID, endNodeID)
 		graph, _, err = d2oracle.Create(graph, boardPath, edgeKey)
 		if err != nil {
-			return fmt.Errorf("failed to create end edge: %w", err)
+			return nil, nil, fmt.Errorf("failed to create end edge: %w", err)
 		}
 		if lastOutputType != "" {
+			tr.edgeTypes[edgeKey] = lastOutputType
 			formattedType := formatEdgeLabel(lastOutputType)
 			if formattedType != "" {
 				graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", edgeKey), nil, &formattedType)
 				if err != nil {
-					return fmt.Errorf("failed to set end edge label: %w", err)
+					return nil, nil, fmt.Errorf("failed to set end edge label: %w", err)
 				}
 			}
 		}
 	}
 
-	// Format the graph AST to D2 script
-	d2Script := d2format.Format(graph.AST)
-
-	// Check output file extension
-	ext := strings.ToLower(filepath.Ext(outputPath))
-
-	switch ext {
-	case ".d2":
-		// Write plain D2 script text without directives to avoid creating nodes
-		// Users can add directives manually if needed
-		return os.WriteFile(outputPath, []byte(d2Script), 0644)
-
-	case ".svg":
-		// For SVG, prepend directives for layout direction
-		// Theme will be set via RenderOpts to avoid creating a node
-		// Layout is needed for compilation
-		svgD2Script := "direction: right\nlayout: dagre\n" + d2Script
-
-		// Render to SVG using the D2 library
-		// Set up text measurement ruler for D2 compilation
-		ruler, err := textmeasure.NewRuler()
-		if err != nil {
-			// Save D2 script for debugging
-			d2OutputPath := outputPath[:len(outputPath)-len(ext)] + ".d2"
-			os.WriteFile(d2OutputPath, []byte(svgD2Script), 0644)
-			return fmt.Errorf("failed to create text ruler: %w\nD2 script saved to: %s", err, d2OutputPath)
-		}
-
-		// Compile the D2 script with layout and ruler (following blog post pattern)
-		// Use ELK layout which supports container-to-descendant edges
-		layoutStr := "dagre"
-		compileOpts := &d2lib.CompileOptions{
-			Layout: &layoutStr,
-			Ruler:  ruler,
-			LayoutResolver: func(engine string) (d2graph.LayoutGraph, error) {
-				if engine == "elk" {
-					return d2elklayout.DefaultLayout, nil
-				}
-				if engine == "dagre" {
-					return d2dagrelayout.DefaultLayout, nil
-				}
-				return nil, fmt.Errorf("unknown layout engine: %s", engine)
-			},
-		}
-		diagram, _, err := d2lib.Compile(ctx, svgD2Script, compileOpts, nil)
+	opts.report("style")
+	graph, err = addUseEdges(graph, boardPath, tr.uses)
+	if err != nil {
+		return nil, nil, err
+	}
+	graph, err = collapseDepth(graph, boardPath, opts.maxDepth)
+	if err != nil {
+		return nil, nil, err
+	}
+	graph, err = annotateStats(graph, boardPath, nodeValues[NodeStats]{opts.stats, opts.siteStats, tr.nodeSites})
+	if err != nil {
+		return nil, nil, err
+	}
+	graph, err = annotateSample(graph, boardPath, query, opts.sample)
+	if err != nil {
+		return nil, nil, err
+	}
+	graph, err = highlightErrors(graph, boardPath, nodeValues[string]{opts.errors, opts.siteErrors, tr.nodeSites})
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.categories {
+		graph, err = styleCategories(graph, boardPath)
 		if err != nil {
-			// Save D2 script for debugging
-			d2OutputPath := outputPath[:len(outputPath)-len(ext)] + ".d2"
-			os.WriteFile(d2OutputPath, []byte(svgD2Script), 0644)
-			return fmt.Errorf("failed to compile D2 diagram: %w\nD2 script saved to: %s", err, d2OutputPath)
+			return nil, nil, err
 		}
+	}
+	graph, err = truncateLabels(graph, boardPath, opts.maxLabel)
+	return graph, tr.edgeTypes, err
+}
 
-		// Remove directive nodes (theme, layout, layout.dir, direction) from the diagram
-		// These are created when we add directives to the script, but we don't want them rendered
-		if diagram != nil {
-			// Filter out nodes named "theme", "layout", "layout.dir", and "direction" from top-level shapes
-			var filteredShapes []d2target.Shape
-			for _, shape := range diagram.Shapes {
-				if shape.ID != "theme" && shape.ID != "layout" && shape.ID != "layout.dir" && shape.ID != "direction" {
-					filteredShapes = append(filteredShapes, shape)
-				}
+// truncateLabels cuts node labels longer than maxLabel characters, as shown,
+// with "...". Only the first line is the node's own label; lines below it,
+// like runtime stats, are kept. A maxLabel of 0 leaves labels whole
+func truncateLabels(graph *d2graph.Graph, boardPath []string, maxLabel int) (*d2graph.Graph, error) {
+	if maxLabel <= 0 {
+		return graph, nil
+	}
+	// Collect first, as each Set recompiles the graph
+	var ids, labels []string
+	for _, obj := range graph.Objects {
+		first, rest, multiline := strings.Cut(obj.Label.Value, "\n")
+		label := []rune(first)
+		if len(label) > maxLabel {
+			cut := string(label[:maxLabel-3]) + "..."
+			if multiline {
+				cut += "\n" + rest
 			}
-			diagram.Shapes = filteredShapes
+			ids = append(ids, obj.AbsID())
+			labels = append(labels, cut)
 		}
-
-		// Render to SVG (following blog post pattern)
-		// Use ThemeID for dark-mauve theme (theme ID 200 according to D2 docs)
-		pad := int64(d2svg.DEFAULT_PADDING)
-		themeID := int64(200) // dark-mauve theme
-		svgBytes, err := d2svg.Render(diagram, &d2svg.RenderOpts{
-			Pad:     &pad,
-			ThemeID: &themeID,
-		})
+	}
+	for i, id := range ids {
+		var err error
+		graph, err = d2oracle.Set(graph, boardPath, id+".label", nil, &labels[i])
 		if err != nil {
-			// Save D2 script for debugging
-			d2OutputPath := outputPath[:len(outputPath)-len(ext)] + ".d2"
-			os.WriteFile(d2OutputPath, []byte(d2Script), 0644)
-			return fmt.Errorf("failed to render D2 diagram to SVG: %w\nD2 script saved to: %s", err, d2OutputPath)
+			return nil, fmt.Errorf("failed to truncate label of %s: %w", id, err)
 		}
+	}
+	return graph, nil
+}
 
-		// Write SVG to file
-		return os.WriteFile(outputPath, svgBytes, 0644)
+// traversal is the state kept over the whole walk of a query: the variables
+// in scope, the type of the values on each edge, which labels leave out for
+// jq's own types, and the call site of each node calling a UDF
+type traversal struct {
+	*varScope
+	edgeTypes map[string]string // "a -> b" -> type
+	sites     map[*gojq.Func]int
+	nodeSites map[string]int // node ID -> call site
+}
 
-	default:
-		return fmt.Errorf("unsupported output format: %s (supported formats: .d2, .svg)", ext)
+func newTraversal(sites map[*gojq.Func]int) *traversal {
+	return &traversal{varScope: newVarScope(), edgeTypes: map[string]string{}, sites: sites, nodeSites: map[string]int{}}
+}
+
+// markSite records the call site of the node for query, if it calls a UDF
+func (tr *traversal) markSite(nodeID string, query *gojq.Query) {
+	if query.Term == nil || query.Term.Func == nil {
+		return
+	}
+	if site, ok := tr.sites[query.Term.Func]; ok {
+		tr.nodeSites[nodeID] = site
 	}
 }
 
 // traverseQueryWithOracle recursively traverses the jq query AST and builds D2 nodes using d2oracle
 // Returns the output type, updated graph, and error
-func traverseQueryWithOracle(query *gojq.Query, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string) (string, *d2graph.Graph, error) {
+func traverseQueryWithOracle(query *gojq.Query, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
 	if query == nil {
 		return "", graph, nil
 	}
@@ -337,7 +378,7 @@ func traverseQueryWithOracle(query *gojq.Query, graph *d2graph.Graph, boardPath
 	switch op {
 	case gojq.OpPipe:
 		// Pipe operations: process left, then right (no pipe node created)
-		return handlePipeOperation(query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType)
+		return handlePipeOperation(query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType, tr)
 	}
 
 	// Handle term types using switch
@@ -346,50 +387,71 @@ func traverseQueryWithOracle(query *gojq.Query, graph *d2graph.Graph, boardPath
 		case gojq.TermTypeQuery:
 			// Unwrap query term and recurse
 			if query.Term.Query != nil {
-				return traverseQueryWithOracle(query.Term.Query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType)
+				return traverseQueryWithOracle(query.Term.Query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType, tr)
 			}
 		case gojq.TermTypeFunc:
-			// Function calls create containers
-			if query.Term.Func != nil {
-				return traverseFunction(query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType)
+			// Function calls create containers, variables are regular nodes
+			if query.Term.Func != nil && !isVariable(query.Term) {
+				return traverseFunction(query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType, tr)
+			}
+		case gojq.TermTypeIf, gojq.TermTypeTry, gojq.TermTypeReduce, gojq.TermTypeForeach, gojq.TermTypeLabel:
+			// Control flow creates a container per branch
+			if isControlFlow(query.Term) {
+				return traverseControlFlow(query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType, tr)
 			}
 		case gojq.TermTypeObject:
 			// Object literals create containers with key containers
 			if query.Term.Object != nil {
-				return traverseObjectLiteral(query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType)
+				return traverseObjectLiteral(query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType, tr)
 			}
 		case gojq.TermTypeArray:
 			// Array literals - traverse the array query
 			if query.Term.Array != nil && query.Term.Array.Query != nil {
-				return traverseQueryWithOracle(query.Term.Array.Query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType)
+				return traverseQueryWithOracle(query.Term.Array.Query, graph, boardPath, nodeCounter, lastNodeID, prevOutputType, tr)
 			}
 		}
 	}
 
 	// For other operations, create a regular node
-	return handleRegularNode(query, op, graph, boardPath, nodeCounter, lastNodeID, prevOutputType)
+	return handleRegularNode(query, op, graph, boardPath, nodeCounter, lastNodeID, prevOutputType, tr)
 }
 
 // handlePipeOperation processes pipe operations (no pipe node, just edges)
-func handlePipeOperation(query *gojq.Query, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string) (string, *d2graph.Graph, error) {
+func handlePipeOperation(query *gojq.Query, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
 	var leftType string
 	var err error
 
 	// Process left side
 	if query.Left != nil {
-		leftType, graph, err = traverseQueryWithOracle(query.Left, graph, boardPath, nodeCounter, lastNodeID, prevOutputType)
+		leftType, graph, err = traverseQueryWithOracle(query.Left, graph, boardPath, nodeCounter, lastNodeID, prevOutputType, tr)
+		if err != nil {
+			return "", graph, err
+		}
+	}
+
+	// E as $x | body: the output of E defines $x, and body runs on the input
+	if len(query.Patterns) > 0 {
+		nodeID := fmt.Sprintf("node_%d", *nodeCounter)
+		*nodeCounter++
+		graph, err = createBindingNode(graph, boardPath, nodeID, query.Patterns)
 		if err != nil {
 			return "", graph, err
 		}
+		if err := connectNodeFromPrevious(graph, boardPath, *lastNodeID, nodeID, leftType, tr); err != nil {
+			return "", graph, err
+		}
+		*lastNodeID = nodeID
+		defer tr.bind(nodeID, query.Patterns...)()
+		leftType = prevOutputType
 	}
 
 	// Process right side with left's output as input
 	if query.Right != nil {
 		inputType := leftType
-		if inputType == "" && query.Left != nil {
+		if inputType == "" && query.Left != nil && len(query.Patterns) == 0 {
 			inputType = inferOutputType(query.Left, query.Left.Op)
 		}
-		rightType, graph, err := traverseQueryWithOracle(query.Right, graph, boardPath, nodeCounter, lastNodeID, inputType)
+		rightType, graph, err := traverseQueryWithOracle(query.Right, graph, boardPath, nodeCounter, lastNodeID, inputType, tr)
 		if err != nil {
 			return "", graph, err
 		}
@@ -400,9 +462,10 @@ func handlePipeOperation(query *gojq.Query, graph *d2graph.Graph, boardPath []st
 }
 
 // handleRegularNode creates a regular node (non-container, non-pipe)
-func handleRegularNode(query *gojq.Query, op gojq.Operator, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string) (string, *d2graph.Graph, error) {
+func handleRegularNode(query *gojq.Query, op gojq.Operator, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
 	nodeID := fmt.Sprintf("node_%d", *nodeCounter)
 	*nodeCounter++
+	tr.markSite(nodeID, query)
 
 	label := getNodeLabel(query, op)
 	outputType := inferOutputType(query, op)
@@ -420,41 +483,43 @@ func handleRegularNode(query *gojq.Query, op gojq.Operator, graph *d2graph.Graph
 	if err != nil {
 		return "", graph, fmt.Errorf("failed to set node shape: %w", err)
 	}
-	formattedLabel := formatD2LabelForOracle(label)
-	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", nodeID), nil, &formattedLabel)
+	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", nodeID), nil, &label)
 	if err != nil {
 		return "", graph, fmt.Errorf("failed to set node label: %w", err)
 	}
 
 	// Connect from previous node
-	if err := connectNodeFromPrevious(graph, boardPath, *lastNodeID, nodeID, prevOutputType); err != nil {
+	if err := connectNodeFromPrevious(graph, boardPath, *lastNodeID, nodeID, prevOutputType, tr); err != nil {
 		return "", graph, err
 	}
+	if isVariable(query.Term) {
+		tr.use(nodeID, query.Term.Func.Name)
+	}
 
 	*lastNodeID = nodeID
 
 	// Process children recursively (if not a slice to avoid duplicates)
 	if !strings.HasPrefix(label, "Slice ") {
 		if query.Left != nil {
-			leftType, graph, err := traverseQueryWithOracle(query.Left, graph, boardPath, nodeCounter, lastNodeID, prevOutputType)
+			leftType, graph, err := traverseQueryWithOracle(query.Left, graph, boardPath, nodeCounter, lastNodeID, prevOutputType, tr)
 			if err != nil {
 				return "", graph, err
 			}
 			// Connect back if needed
 			if *lastNodeID != nodeID {
-				if err := connectNodeFromPrevious(graph, boardPath, *lastNodeID, nodeID, leftType); err != nil {
+				if err := connectNodeFromPrevious(graph, boardPath, *lastNodeID, nodeID, leftType, tr); err != nil {
 					return "", graph, err
 				}
 			}
 		}
 		if query.Right != nil {
-			rightType, graph, err := traverseQueryWithOracle(query.Right, graph, boardPath, nodeCounter, lastNodeID, prevOutputType)
+			rightType, graph, err := traverseQueryWithOracle(query.Right, graph, boardPath, nodeCounter, lastNodeID, prevOutputType, tr)
 			if err != nil {
 				return "", graph, err
 			}
 			// Connect back if needed
 			if *lastNodeID != nodeID {
-				if err := connectNodeFromPrevious(graph, boardPath, *lastNodeID, nodeID, rightType); err != nil {
+				if err := connectNodeFromPrevious(graph, boardPath, *lastNodeID, nodeID, rightType, tr); err != nil {
 					return "", graph, err
 				}
 			}
@@ -465,7 +530,7 @@ func handleRegularNode(query *gojq.Query, op gojq.Operator, graph *d2graph.Graph
 }
 
 // connectNodeFromPrevious creates an edge from previous node (or start) to current node
-func connectNodeFromPrevious(graph *d2graph.Graph, boardPath []string, lastNodeID, nodeID, edgeType string) error {
+func connectNodeFromPrevious(graph *d2graph.Graph, boardPath []string, lastNodeID, nodeID, edgeType string, tr *traversal) error {
 	var fromID string
 	if lastNodeID == "start" {
 		fromID = "start"
@@ -481,6 +546,7 @@ func connectNodeFromPrevious(graph *d2graph.Graph, boardPath []string, lastNodeI
 	}
 
 	if edgeType != "" && fromID != "start" {
+		tr.edgeTypes[edgeKey] = edgeType
 		formattedType := formatEdgeLabel(edgeType)
 		if formattedType != "" {
 			graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", edgeKey), nil, &formattedType)
@@ -493,7 +559,7 @@ func connectNodeFromPrevious(graph *d2graph.Graph, boardPath []string, lastNodeI
 }
 
 // traverseFunction handles ALL function calls by creating a container and exploding the function's arguments
-func traverseFunction(query *gojq.Query, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string) (string, *d2graph.Graph, error) {
+func traverseFunction(query *gojq.Query, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
 	if query == nil || query.Term == nil || query.Term.Func == nil {
 		return "", graph, fmt.Errorf("traverseFunction called on non-function")
 	}
@@ -506,6 +572,7 @@ func traverseFunction(query *gojq.Query, graph *d2graph.Graph, boardPath []strin
 	// Create a container node for the function
 	funcNodeID := fmt.Sprintf("node_%d", *nodeCounter)
 	*nodeCounter++
+	tr.markSite(funcNodeID, query)
 
 	var err error
 	graph, _, err = d2oracle.Create(graph, boardPath, funcNodeID)
@@ -528,6 +595,7 @@ func traverseFunction(query *gojq.Query, graph *d2graph.Graph, boardPath []strin
 			return "", graph, fmt.Errorf("failed to create edge to function container: %w", err)
 		}
 		if prevOutputType != "" {
+			tr.edgeTypes[edgeKey] = prevOutputType
 			formattedType := formatEdgeLabel(prevOutputType)
 			if formattedType != "" {
 				graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", edgeKey), nil, &formattedType)
@@ -556,7 +624,7 @@ func traverseFunction(query *gojq.Query, graph *d2graph.Graph, boardPath []strin
 		if arg != nil {
 			// Traverse the argument, creating nodes inside the function container
 			// This will recursively handle nested functions
-			_, graph, err = traverseInContainer(arg, graph, boardPath, funcNodeID, &childCounter, &childLastNodeID, prevOutputType)
+			_, graph, err = traverseInContainer(arg, graph, boardPath, funcNodeID, &childCounter, &childLastNodeID, prevOutputType, tr)
 			if err != nil {
 				return "", graph, fmt.Errorf("failed to traverse function argument %d: %w", i, err)
 			}
@@ -572,7 +640,7 @@ func traverseFunction(query *gojq.Query, graph *d2graph.Graph, boardPath []strin
 }
 
 // traverseObjectLiteral handles object literals by creating a container and traversing their values
-func traverseObjectLiteral(query *gojq.Query, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string) (string, *d2graph.Graph, error) {
+func traverseObjectLiteral(query *gojq.Query, graph *d2graph.Graph, boardPath []string, nodeCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
 	if query == nil || query.Term == nil || query.Term.Object == nil {
 		return "", graph, fmt.Errorf("traverseObjectLiteral called on non-object")
 	}
@@ -602,6 +670,7 @@ func traverseObjectLiteral(query *gojq.Query, graph *d2graph.Graph, boardPath []
 			return "", graph, fmt.Errorf("failed to create edge to object container: %w", err)
 		}
 		if prevOutputType != "" {
+			tr.edgeTypes[edgeKey] = prevOutputType
 			formattedType := formatEdgeLabel(prevOutputType)
 			if formattedType != "" {
 				graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", edgeKey), nil, &formattedType)
@@ -657,7 +726,7 @@ func traverseObjectLiteral(query *gojq.Query, graph *d2graph.Graph, boardPath []
 			// Traverse the value query inside this key's container (independent of other keys)
 			keyChildCounter := 0
 			keyLastNodeID := "start"
-			_, graph, err = traverseInContainer(kv.Val, graph, boardPath, keyContainerID, &keyChildCounter, &keyLastNodeID, prevOutputType)
+			_, graph, err = traverseInContainer(kv.Val, graph, boardPath, keyContainerID, &keyChildCounter, &keyLastNodeID, prevOutputType, tr)
 			if err != nil {
 				return "", graph, fmt.Errorf("failed to traverse object value: %w", err)
 			}
@@ -673,7 +742,7 @@ func traverseObjectLiteral(query *gojq.Query, graph *d2graph.Graph, boardPath []
 }
 
 // traverseObjectLiteralInContainer handles object literals inside a container
-func traverseObjectLiteralInContainer(query *gojq.Query, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string) (string, *d2graph.Graph, error) {
+func traverseObjectLiteralInContainer(query *gojq.Query, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
 	if query == nil || query.Term == nil || query.Term.Object == nil {
 		return "", graph, fmt.Errorf("traverseObjectLiteralInContainer called on non-object")
 	}
@@ -703,6 +772,7 @@ func traverseObjectLiteralInContainer(query *gojq.Query, graph *d2graph.Graph, b
 			return "", graph, fmt.Errorf("failed to create edge to nested object container: %w", err)
 		}
 		if prevOutputType != "" {
+			tr.edgeTypes[edgeKey] = prevOutputType
 			formattedType := formatEdgeLabel(prevOutputType)
 			if formattedType != "" {
 				graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", edgeKey), nil, &formattedType)
@@ -751,7 +821,7 @@ func traverseObjectLiteralInContainer(query *gojq.Query, graph *d2graph.Graph, b
 			// Traverse the value query inside this key's container (independent of other keys)
 			keyChildCounter := 0
 			keyLastNodeID := "start"
-			_, graph, err = traverseInContainer(kv.Val, graph, boardPath, keyContainerID, &keyChildCounter, &keyLastNodeID, prevOutputType)
+			_, graph, err = traverseInContainer(kv.Val, graph, boardPath, keyContainerID, &keyChildCounter, &keyLastNodeID, prevOutputType, tr)
 			if err != nil {
 				return "", graph, fmt.Errorf("failed to traverse nested object value: %w", err)
 			}
@@ -769,7 +839,7 @@ func traverseObjectLiteralInContainer(query *gojq.Query, graph *d2graph.Graph, b
 // traverseInContainer traverses a query and creates nodes inside a container using dot notation
 // It creates nodes with IDs like "containerID.child_0", "containerID.child_1", etc.
 // This handles nested functions recursively - if a child is a function, it creates a nested container
-func traverseInContainer(query *gojq.Query, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string) (string, *d2graph.Graph, error) {
+func traverseInContainer(query *gojq.Query, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
 	if query == nil {
 		return "", graph, nil
 	}
@@ -779,7 +849,7 @@ func traverseInContainer(query *gojq.Query, graph *d2graph.Graph, boardPath []st
 	// Handle pipe operations using switch
 	pipeQuery := findPipeQuery(query, op)
 	if pipeQuery != nil {
-		return handlePipeInContainer(pipeQuery, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType)
+		return handlePipeInContainer(pipeQuery, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType, tr)
 	}
 
 	// Handle term types using switch
@@ -788,23 +858,28 @@ func traverseInContainer(query *gojq.Query, graph *d2graph.Graph, boardPath []st
 		case gojq.TermTypeQuery:
 			// Unwrap query term and recurse
 			if query.Term.Query != nil {
-				return traverseInContainer(query.Term.Query, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType)
+				return traverseInContainer(query.Term.Query, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType, tr)
 			}
 		case gojq.TermTypeObject:
 			// Object literals create containers with key containers
 			if query.Term.Object != nil {
-				return traverseObjectLiteralInContainer(query, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType)
+				return traverseObjectLiteralInContainer(query, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType, tr)
 			}
 		case gojq.TermTypeFunc:
-			// Function calls create nested containers
-			if query.Term.Func != nil {
-				return handleFunctionInContainer(query, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType)
+			// Function calls create nested containers, variables are regular nodes
+			if query.Term.Func != nil && !isVariable(query.Term) {
+				return handleFunctionInContainer(query, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType, tr)
+			}
+		case gojq.TermTypeIf, gojq.TermTypeTry, gojq.TermTypeReduce, gojq.TermTypeForeach, gojq.TermTypeLabel:
+			// Control flow creates nested branch containers
+			if isControlFlow(query.Term) {
+				return handleControlFlowInContainer(query, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType, tr)
 			}
 		}
 	}
 
 	// For other operations, create a regular child node
-	return handleRegularNodeInContainer(query, op, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType)
+	return handleRegularNodeInContainer(query, op, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType, tr)
 }
 
 // Helper functions for container traversal
@@ -824,23 +899,41 @@ func findPipeQuery(query *gojq.Query, op gojq.Operator) *gojq.Query {
 }
 
 // handlePipeInContainer processes pipe operations inside containers
-func handlePipeInContainer(pipeQuery *gojq.Query, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string) (string, *d2graph.Graph, error) {
+func handlePipeInContainer(pipeQuery *gojq.Query, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
 	var leftType string
 	var err error
 
 	if pipeQuery.Left != nil {
-		leftType, graph, err = traverseInContainer(pipeQuery.Left, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType)
+		leftType, graph, err = traverseInContainer(pipeQuery.Left, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType, tr)
+		if err != nil {
+			return "", graph, err
+		}
+	}
+
+	// E as $x | body: the output of E defines $x, and body runs on the input
+	if len(pipeQuery.Patterns) > 0 {
+		nodeID := fmt.Sprintf("%s.child_%d", containerID, *childCounter)
+		*childCounter++
+		graph, err = createBindingNode(graph, boardPath, nodeID, pipeQuery.Patterns)
 		if err != nil {
 			return "", graph, err
 		}
+		if *lastNodeID != "start" && *lastNodeID != containerID {
+			if err := connectNodeFromPrevious(graph, boardPath, *lastNodeID, nodeID, leftType, tr); err != nil {
+				return "", graph, err
+			}
+		}
+		*lastNodeID = nodeID
+		defer tr.bind(nodeID, pipeQuery.Patterns...)()
+		leftType = prevOutputType
 	}
 
 	if pipeQuery.Right != nil {
 		inputType := leftType
-		if inputType == "" && pipeQuery.Left != nil {
+		if inputType == "" && pipeQuery.Left != nil && len(pipeQuery.Patterns) == 0 {
 			inputType = inferOutputType(pipeQuery.Left, pipeQuery.Left.Op)
 		}
-		rightType, graph, err := traverseInContainer(pipeQuery.Right, graph, boardPath, containerID, childCounter, lastNodeID, inputType)
+		rightType, graph, err := traverseInContainer(pipeQuery.Right, graph, boardPath, containerID, childCounter, lastNodeID, inputType, tr)
 		if err != nil {
 			return "", graph, err
 		}
@@ -851,7 +944,7 @@ func handlePipeInContainer(pipeQuery *gojq.Query, graph *d2graph.Graph, boardPat
 }
 
 // handleFunctionInContainer processes function calls inside containers
-func handleFunctionInContainer(query *gojq.Query, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string) (string, *d2graph.Graph, error) {
+func handleFunctionInContainer(query *gojq.Query, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
 	funcName := query.Term.Func.Name
 	if funcName == "" {
 		return "", graph, fmt.Errorf("function has no name")
@@ -860,6 +953,7 @@ func handleFunctionInContainer(query *gojq.Query, graph *d2graph.Graph, boardPat
 	// Create nested function container
 	nestedFuncNodeID := fmt.Sprintf("%s.child_%d", containerID, *childCounter)
 	*childCounter++
+	tr.markSite(nestedFuncNodeID, query)
 
 	var err error
 	graph, _, err = d2oracle.Create(graph, boardPath, nestedFuncNodeID)
@@ -881,6 +975,7 @@ func handleFunctionInContainer(query *gojq.Query, graph *d2graph.Graph, boardPat
 			return "", graph, fmt.Errorf("failed to create edge to nested function: %w", err)
 		}
 		if prevOutputType != "" {
+			tr.edgeTypes[edgeKey] = prevOutputType
 			formattedType := formatEdgeLabel(prevOutputType)
 			if formattedType != "" {
 				graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", edgeKey), nil, &formattedType)
@@ -896,7 +991,7 @@ func handleFunctionInContainer(query *gojq.Query, graph *d2graph.Graph, boardPat
 	nestedLastNodeID := "start"
 	for i, arg := range query.Term.Func.Args {
 		if arg != nil {
-			_, graph, err = traverseInContainer(arg, graph, boardPath, nestedFuncNodeID, &nestedChildCounter, &nestedLastNodeID, prevOutputType)
+			_, graph, err = traverseInContainer(arg, graph, boardPath, nestedFuncNodeID, &nestedChildCounter, &nestedLastNodeID, prevOutputType, tr)
 			if err != nil {
 				return "", graph, fmt.Errorf("failed to traverse nested function argument %d: %w", i, err)
 			}
@@ -909,9 +1004,10 @@ func handleFunctionInContainer(query *gojq.Query, graph *d2graph.Graph, boardPat
 }
 
 // handleRegularNodeInContainer creates a regular node inside a container
-func handleRegularNodeInContainer(query *gojq.Query, op gojq.Operator, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string) (string, *d2graph.Graph, error) {
+func handleRegularNodeInContainer(query *gojq.Query, op gojq.Operator, graph *d2graph.Graph, boardPath []string, containerID string, childCounter *int, lastNodeID *string, prevOutputType string, tr *traversal) (string, *d2graph.Graph, error) {
 	childNodeID := fmt.Sprintf("%s.child_%d", containerID, *childCounter)
 	*childCounter++
+	tr.markSite(childNodeID, query)
 
 	label := getNodeLabel(query, op)
 	outputType := inferOutputType(query, op)
@@ -929,8 +1025,7 @@ func handleRegularNodeInContainer(query *gojq.Query, op gojq.Operator, graph *d2
 	if err != nil {
 		return "", graph, fmt.Errorf("failed to set child node shape: %w", err)
 	}
-	formattedLabel := formatD2LabelForOracle(label)
-	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", childNodeID), nil, &formattedLabel)
+	graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", childNodeID), nil, &label)
 	if err != nil {
 		return "", graph, fmt.Errorf("failed to set child node label: %w", err)
 	}
@@ -943,6 +1038,7 @@ func handleRegularNodeInContainer(query *gojq.Query, op gojq.Operator, graph *d2
 			return "", graph, fmt.Errorf("failed to create child edge: %w", err)
 		}
 		if prevOutputType != "" {
+			tr.edgeTypes[edgeKey] = prevOutputType
 			formattedType := formatEdgeLabel(prevOutputType)
 			if formattedType != "" {
 				graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", edgeKey), nil, &formattedType)
@@ -953,12 +1049,16 @@ func handleRegularNodeInContainer(query *gojq.Query, op gojq.Operator, graph *d2
 		}
 	}
 
+	if isVariable(query.Term) {
+		tr.use(childNodeID, query.Term.Func.Name)
+	}
+
 	*lastNodeID = childNodeID
 
 	// Process children recursively (if not a slice)
 	if !strings.HasPrefix(label, "Slice ") {
 		if query.Left != nil {
-			leftType, graph, err := traverseInContainer(query.Left, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType)
+			leftType, graph, err := traverseInContainer(query.Left, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType, tr)
 			if err != nil {
 				return "", graph, err
 			}
@@ -969,6 +1069,7 @@ func handleRegularNodeInContainer(query *gojq.Query, op gojq.Operator, graph *d2
 					return "", graph, fmt.Errorf("failed to create left branch edge: %w", err)
 				}
 				if leftType != "" {
+					tr.edgeTypes[edgeKey] = leftType
 					formattedType := formatEdgeLabel(leftType)
 					if formattedType != "" {
 						graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", edgeKey), nil, &formattedType)
@@ -980,7 +1081,7 @@ func handleRegularNodeInContainer(query *gojq.Query, op gojq.Operator, graph *d2
 			}
 		}
 		if query.Right != nil {
-			rightType, graph, err := traverseInContainer(query.Right, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType)
+			rightType, graph, err := traverseInContainer(query.Right, graph, boardPath, containerID, childCounter, lastNodeID, prevOutputType, tr)
 			if err != nil {
 				return "", graph, err
 			}
@@ -991,6 +1092,7 @@ func handleRegularNodeInContainer(query *gojq.Query, op gojq.Operator, graph *d2
 					return "", graph, fmt.Errorf("failed to create right branch edge: %w", err)
 				}
 				if rightType != "" {
+					tr.edgeTypes[edgeKey] = rightType
 					formattedType := formatEdgeLabel(rightType)
 					if formattedType != "" {
 						graph, err = d2oracle.Set(graph, boardPath, fmt.Sprintf("%s.label", edgeKey), nil, &formattedType)
@@ -1006,15 +1108,6 @@ func handleRegularNodeInContainer(query *gojq.Query, op gojq.Operator, graph *d2
 	return outputType, graph, nil
 }
 
-// formatD2LabelForOracle formats a label for use with d2oracle.Set
-func formatD2LabelForOracle(label string) string {
-	// Replace $ with _VAR_ to avoid D2 variable substitution
-	safeLabel := strings.ReplaceAll(label, "$", "_VAR_")
-	// Don't remove quotes - they're part of the string representation
-	// The quotes are needed for proper display of string literals
-	return safeLabel
-}
-
 // formatEdgeLabel formats a label for use on edges, avoiding reserved keywords
 func formatEdgeLabel(label string) string {
 	// D2 has reserved keywords that can't be used in edge labels
@@ -1295,9 +1388,7 @@ func getNodeLabel(query *gojq.Query, op gojq.Operator) string {
 		queryStr := query.String()
 		if queryStr != "" && !strings.Contains(queryStr, "[") {
 			// Only use query string if it doesn't contain brackets (to avoid slice detection)
-			if len(queryStr) > 50 {
-				return queryStr[:47] + "..."
-			}
+			// Long ones are cut by truncateLabels
 			return queryStr
 		}
 	}
@@ -1486,7 +1577,14 @@ func getTermLabel(term *gojq.Term, query *gojq.Query) string {
 						} else if kv.Key != "" {
 							keyName = kv.Key
 						}
-						if len(funcArgs) > 0 {
+						if strings.HasPrefix(funcName, "$") {
+							// A variable, not a call
+							if keyName != "" {
+								keyValLabels = append(keyValLabels, fmt.Sprintf("%s: %s", keyName, funcName))
+							} else {
+								keyValLabels = append(keyValLabels, funcName)
+							}
+						} else if len(funcArgs) > 0 {
 							args := formatFuncArgs(funcArgs)
 							if keyName != "" {
 								keyValLabels = append(keyValLabels, fmt.Sprintf("%s: %s(%s)", keyName, funcName, args))
@@ -1657,23 +1755,10 @@ func inferOutputType(query *gojq.Query, op gojq.Operator) string {
 		case gojq.TermTypeObject:
 			return "object"
 		case gojq.TermTypeFunc:
-			// Try to infer from function name
+			// UDFs declare their types, and jq builtins are known
 			if query.Term.Func != nil {
-				name := query.Term.Func.Name
-				// Common functions that return strings
-				if strings.HasSuffix(name, "_encode") || strings.HasSuffix(name, "_decode") ||
-					strings.HasPrefix(name, "base") || strings.HasPrefix(name, "hex") ||
-					name == "cat" || name == "tee" || name == "sh" {
-					return "string"
-				}
-				// Hash functions return strings
-				if name == "md5" || name == "sha1" || name == "sha256" || name == "sha512" ||
-					strings.HasPrefix(name, "sha") {
-					return "string"
-				}
-				// Functions that return numbers
-				if name == "length" || name == "keys" {
-					return "number"
+				if t := funcOutputType(query.Term.Func.Name); t != "" {
+					return t
 				}
 			}
 		}
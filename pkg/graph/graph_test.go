@@ -1,12 +1,20 @@
 package graph
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf"
 )
 
 func TestGenerateGraph_SimpleQuery(t *testing.T) {
@@ -18,7 +26,7 @@ func TestGenerateGraph_SimpleQuery(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -49,7 +57,7 @@ func TestGenerateGraph_PipeOperation(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -84,7 +92,7 @@ func TestGenerateGraph_FunctionCall(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -109,7 +117,7 @@ func TestGenerateGraph_ObjectLiteral(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -151,7 +159,7 @@ func TestGenerateGraph_ObjectLiteralWithMultipleHashes(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -190,7 +198,7 @@ func TestGenerateGraph_ArrayLiteral(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -215,7 +223,7 @@ func TestGenerateGraph_SliceOperation(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -245,7 +253,7 @@ func TestGenerateGraph_MapFunction(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -276,7 +284,7 @@ func TestGenerateGraph_ComplexNestedQuery(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -312,7 +320,7 @@ func TestGenerateGraph_StartNodeConnection(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -337,7 +345,7 @@ func TestGenerateGraph_EndNodeConnection(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -362,7 +370,7 @@ func TestGenerateGraph_SVGOutput(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.svg")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -397,7 +405,7 @@ func TestGenerateGraph_InvalidOutputPath(t *testing.T) {
 	// Try to write to a non-existent directory
 	outputPath := "/nonexistent/path/test.d2"
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err == nil {
 		t.Error("GenerateGraph should fail with invalid path")
 	}
@@ -412,7 +420,7 @@ func TestGenerateGraph_UnsupportedFormat(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.txt")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err == nil {
 		t.Error("GenerateGraph should fail with unsupported format")
 	}
@@ -430,7 +438,7 @@ func TestGenerateGraph_EmptyQuery(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	// Empty query might succeed or fail, but shouldn't panic
 	if err != nil {
 		t.Logf("GenerateGraph with empty query returned error (expected): %v", err)
@@ -446,7 +454,7 @@ func TestGenerateGraph_NestedFunctions(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -488,7 +496,7 @@ func TestGenerateGraph_ObjectLiteralWithVariable(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -502,8 +510,8 @@ func TestGenerateGraph_ObjectLiteralWithVariable(t *testing.T) {
 	if !strings.Contains(contentStr, "file {") {
 		t.Error("Output should contain 'file' container")
 	}
-	// Variable should be shown (might be formatted as _VAR_path)
-	if !strings.Contains(contentStr, "$path") && !strings.Contains(contentStr, "_VAR_path") {
+	// Variable should be shown
+	if !strings.Contains(contentStr, "$path") {
 		t.Error("Output should contain variable reference")
 	}
 }
@@ -517,7 +525,7 @@ func TestGenerateGraph_MultiplePipes(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -550,7 +558,7 @@ func TestGenerateGraph_ObjectLiteralInMap(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -592,7 +600,7 @@ func TestGenerateGraph_ParenthesizedExpression(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -619,7 +627,7 @@ func TestGenerateGraph_StringLiteral(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -644,7 +652,7 @@ func TestGenerateGraph_NumberLiteral(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -669,7 +677,7 @@ func TestGenerateGraph_IdentityOperator(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -694,7 +702,7 @@ func TestGenerateGraph_IndexAccess(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -720,7 +728,7 @@ func TestGenerateGraph_ObjectKeyAccess(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -745,7 +753,7 @@ func TestGenerateGraph_NoDuplicateSlices(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -783,7 +791,7 @@ func TestGenerateGraph_FunctionWithArguments(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -812,7 +820,7 @@ func TestGenerateGraph_ComplexObjectWithAllHashes(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -848,7 +856,7 @@ func TestGenerateGraph_ArrayWithFunction(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -874,7 +882,7 @@ func TestGenerateGraph_SelectWithPipe(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -918,7 +926,7 @@ func TestGenerateGraph_VariableAssignment(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -930,7 +938,7 @@ func TestGenerateGraph_VariableAssignment(t *testing.T) {
 
 	contentStr := string(content)
 	// Variable should be shown
-	if !strings.Contains(contentStr, "$path") && !strings.Contains(contentStr, "_VAR_path") {
+	if !strings.Contains(contentStr, "$path") {
 		t.Error("Output should contain variable reference")
 	}
 }
@@ -944,7 +952,7 @@ func TestGenerateGraph_HTTPFunction(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -973,7 +981,7 @@ func TestGenerateGraph_FromJSONFunction(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -999,7 +1007,7 @@ func TestGenerateGraph_EndToEndComplexQuery(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test.d2")
 
-	err = GenerateGraph(query, outputPath)
+	err = GenerateGraph(query, outputPath, GraphOptions{})
 	if err != nil {
 		t.Fatalf("GenerateGraph failed: %v", err)
 	}
@@ -1034,3 +1042,663 @@ func TestGenerateGraph_EndToEndComplexQuery(t *testing.T) {
 	}
 }
 
+func TestGraphOptions(t *testing.T) {
+	r, err := GraphOptions{}.resolve()
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if r.layout != "dagre" || r.direction != "right" || r.themeID != 200 {
+		t.Errorf("zero options resolve to %+v, want dagre, right and theme 200", r)
+	}
+	r, err = GraphOptions{Layout: "ELK", Direction: "down", Theme: "light"}.resolve()
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if r.layout != "elk" || r.direction != "down" || r.themeID != 0 {
+		t.Errorf("options resolve to %+v, want elk, down and theme 0", r)
+	}
+	if r, err := (GraphOptions{Theme: "301"}).resolve(); err != nil || r.themeID != 301 {
+		t.Errorf("theme 301 resolves to %+v, %v", r, err)
+	}
+	if r.padding != 100 || r.sketch || r.maxLabel != 50 {
+		t.Errorf("options resolve to %+v, want padding 100, no sketch and labels cut at 50", r)
+	}
+	padding := 0
+	r, err = GraphOptions{Padding: &padding, Sketch: true, MaxLabel: -1}.resolve()
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if r.padding != 0 || !r.sketch || r.maxLabel != 0 {
+		t.Errorf("options resolve to %+v, want padding 0, sketch and no label limit", r)
+	}
+	negative := -1
+	for _, opts := range []GraphOptions{{Layout: "tala"}, {Direction: "sideways"}, {Theme: "pastel"}, {Theme: "999"},
+		{Padding: &negative}, {MaxLabel: 3}, {MaxDepth: -1}} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded, want an error", opts)
+		}
+	}
+}
+
+func TestGenerateSVG_Options(t *testing.T) {
+	query, err := gojq.Parse("md5 | ._val")
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	svg, err := GenerateSVG(query, GraphOptions{Layout: "elk", Direction: "down", Theme: "neutral-default"})
+	if err != nil {
+		t.Fatalf("GenerateSVG failed: %v", err)
+	}
+	if !strings.Contains(svg, "<svg") {
+		t.Error("Output should be an SVG")
+	}
+	if _, err := GenerateSVG(query, GraphOptions{Layout: "tala"}); err == nil {
+		t.Error("GenerateSVG should reject an unknown layout")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	query, err := gojq.Parse("md5 | ._val")
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	for format, want := range map[string]string{"": "<svg", "d2": "md5()", "mermaid": "flowchart LR", "ascii": "md5()"} {
+		out, err := Generate(query, GraphOptions{Format: format})
+		if err != nil {
+			t.Fatalf("Generate(%q) failed: %v", format, err)
+		}
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("Generate(%q) should contain %q:\n%s", format, want, out)
+		}
+	}
+	var buf bytes.Buffer
+	if err := GenerateTo(&buf, query, GraphOptions{Format: "D2"}); err != nil {
+		t.Fatalf("GenerateTo failed: %v", err)
+	}
+	if script, _ := GenerateD2(query, GraphOptions{}); buf.String() != script {
+		t.Errorf("GenerateTo wrote %q, want the script of GenerateD2 %q", buf.String(), script)
+	}
+	if _, err := Generate(query, GraphOptions{Format: "txt"}); err == nil {
+		t.Error("Generate should reject an unknown format")
+	}
+	for path, want := range map[string]string{"a.SVG": "svg", "a.d2": "d2", "a.mmd": "mermaid", "a.png": "png", "a.pdf": "pdf"} {
+		if got, err := FormatForPath(path); err != nil || got != want {
+			t.Errorf("FormatForPath(%q) = %q, %v, want %q", path, got, err, want)
+		}
+	}
+}
+
+func TestExportAST(t *testing.T) {
+	query, err := gojq.Parse(`md5 | ._val | {hash: .}`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	out, err := ExportAST(query)
+	if err != nil {
+		t.Fatalf("ExportAST failed: %v", err)
+	}
+	var g ExportedGraph
+	if err := json.Unmarshal(out, &g); err != nil {
+		t.Fatalf("ExportAST should write JSON: %v\n%s", err, out)
+	}
+	if g.Version != ExportVersion {
+		t.Errorf("version = %d, want %d", g.Version, ExportVersion)
+	}
+	nodes := map[string]ExportedNode{}
+	for _, n := range g.Nodes {
+		nodes[n.ID] = n
+	}
+	if n := nodes["start"]; n.Label != "Start" || n.Shape != "circle" {
+		t.Errorf("start node = %+v", n)
+	}
+	if n := nodes["node_0"]; n.Label != "md5()" {
+		t.Errorf("node_0 = %+v, want md5()", n)
+	}
+	if n := nodes["node_2.child_0"]; n.Parent != "node_2" || n.Label != "hash" {
+		t.Errorf("node_2.child_0 = %+v, want the hash key inside node_2", n)
+	}
+	var typed bool
+	for _, e := range g.Edges {
+		if e.From == "node_0" && e.To == "node_1" {
+			typed = e.Type == "string" && e.Label == ""
+		}
+	}
+	if !typed {
+		t.Errorf("the edge out of md5() should carry a string, unlabeled:\n%s", out)
+	}
+	again, err := ExportAST(query)
+	if err != nil || !bytes.Equal(out, again) {
+		t.Errorf("ExportAST should be stable, got:\n%s\nthen:\n%s", out, again)
+	}
+}
+
+func TestGenerateD2_ControlFlow(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`if .a then 1 elif .b then 2 end`, []string{"If {", "Condition {", "Elif {", "Else (.)", "child_0 -> child_2: falsy", "child_2 -> child_3: truthy", "child_2 -> child_4: falsy"}},
+		{`try md5`, []string{"Try {", "Body {", "md5()", "Catch (empty)", "child_0 -> child_1: error"}},
+		{`foreach .[] as $x (0; 1; [$x])`, []string{"Foreach {", "'Source as $x' {", "Init {", "Update {", "Extract {", "child_2 -> child_3: state"}},
+		{`label $out | md5`, []string{"'Label $out' {", "md5()"}},
+		{`map(try md5 catch null)`, []string{"map() {", "Try {", "Catch {"}},
+	}
+	for _, tt := range tests {
+		query, err := gojq.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		script, err := GenerateD2(query, GraphOptions{})
+		if err != nil {
+			t.Fatalf("GenerateD2(%s) failed: %v", tt.query, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(script, want) {
+				t.Errorf("GenerateD2(%s) should contain %q:\n%s", tt.query, want, script)
+			}
+		}
+	}
+}
+
+func TestGenerateD2_Bindings(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []string
+		notWant []string
+	}{
+		{`. as $x | $x | md5`, []string{"node_1: 'as $x' {shape: hexagon}", "node_2: '$x' {shape: rectangle}", "node_2 -> node_1: use {style.stroke-dash: 3}"}, nil},
+		{`. as $x | .a as $x | $x`, []string{"node_4 -> node_3: use"}, []string{"node_4 -> node_1"}},
+		{`. as [$a, {b: $b}] | $b`, []string{"'as [$a, {b: $b}]'", "node_2 -> node_1: use"}, nil},
+		{`reduce .[] as $x (0; $x)`, []string{"child_2.child_0 -> child_0: use"}, nil},
+		{`$ENV | .a`, []string{"'$ENV'"}, []string{"use"}},
+	}
+	for _, tt := range tests {
+		query, err := gojq.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		script, err := GenerateD2(query, GraphOptions{})
+		if err != nil {
+			t.Fatalf("GenerateD2(%s) failed: %v", tt.query, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(script, want) {
+				t.Errorf("GenerateD2(%s) should contain %q:\n%s", tt.query, want, script)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(script, notWant) {
+				t.Errorf("GenerateD2(%s) should not contain %q:\n%s", tt.query, notWant, script)
+			}
+		}
+	}
+}
+
+func TestPatternVars(t *testing.T) {
+	for q, want := range map[string]string{
+		`. as $x | .`:               "$x",
+		`. as [$a, {b: $b}] | .`:    "$a $b",
+		`. as {$a, b: [$c]} | .`:    "$a $c",
+		`. as [$a] ?// {a: $a} | .`: "$a $a",
+	} {
+		query, err := gojq.Parse(q)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		var names []string
+		for _, p := range query.Patterns {
+			names = append(names, patternVars(p)...)
+		}
+		if got := strings.Join(names, " "); got != want {
+			t.Errorf("patternVars(%s) = %q, want %q", q, got, want)
+		}
+	}
+}
+
+func TestFuncOutputType(t *testing.T) {
+	udf.SetExtraFunctionMetadata([]udf.FunctionMetadata{{Name: "rdns", Output: "string"}})
+	defer udf.SetExtraFunctionMetadata(nil)
+	for name, want := range map[string]string{
+		"md5":        "string",
+		"entropy":    "number",
+		"csv_parse":  "array",
+		"json_parse": "",
+		"keys":       "array",
+		"test":       "boolean",
+		"rdns":       "string",
+		"nope":       "",
+	} {
+		if got := funcOutputType(name); got != want {
+			t.Errorf("funcOutputType(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestGenerateD2_MaxLabel(t *testing.T) {
+	query, err := gojq.Parse(`gzip_compress | gzip_decompress`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	script, err := GenerateD2(query, GraphOptions{})
+	if err != nil {
+		t.Fatalf("GenerateD2 failed: %v", err)
+	}
+	if !strings.Contains(script, "gzip_decompress()") {
+		t.Errorf("Labels under 50 characters should be whole:\n%s", script)
+	}
+	script, err = GenerateD2(query, GraphOptions{MaxLabel: 8})
+	if err != nil {
+		t.Fatalf("GenerateD2 failed: %v", err)
+	}
+	if strings.Contains(script, "gzip_decompress()") || !strings.Contains(script, "gzip_...") {
+		t.Errorf("Labels should be cut at 8 characters:\n%s", script)
+	}
+}
+
+func TestGenerateD2_Stats(t *testing.T) {
+	query, err := gojq.Parse(`md5 | ._val | sha256 | ._val`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	script, err := GenerateD2(query, GraphOptions{Stats: map[string]NodeStats{
+		"md5":    {Calls: 2, Values: 2, Total: 1500 * time.Microsecond, BytesIn: 10, BytesOut: 2048},
+		"sha256": {Calls: 1, Values: 1, Errors: 1, Total: time.Millisecond, BytesIn: 64, BytesOut: 0},
+	}})
+	if err != nil {
+		t.Fatalf("GenerateD2 failed: %v", err)
+	}
+	for _, want := range []string{
+		`md5()\n2 calls, 1.5ms\n10 B in, 2.0 KiB out`,
+		`sha256()\n1 call, 1ms\n64 B in, 0 B out\n1 of 1 values _err`,
+		"2.0 KiB", "stroke-width: 8", "stroke-width: 1",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Script should contain %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestGenerateD2_SiteStats(t *testing.T) {
+	query, err := gojq.Parse(`md5 | ._val | md5 | ._val`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	script, err := GenerateD2(query, GraphOptions{
+		Stats: map[string]NodeStats{"md5": {Calls: 3, Values: 3, Errors: 1, Total: 3 * time.Millisecond}},
+		SiteStats: map[int]NodeStats{
+			1: {Calls: 1, Values: 1, Total: time.Millisecond, BytesIn: 1, BytesOut: 32},
+			2: {Calls: 2, Values: 2, Errors: 1, Total: 2 * time.Millisecond, BytesIn: 32, BytesOut: 32},
+		},
+		Errors:     map[string]string{"md5": "md5: broken"},
+		SiteErrors: map[int]string{2: "md5: broken"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateD2 failed: %v", err)
+	}
+	for _, want := range []string{
+		`md5()\n1 call, 1ms\n1 B in, 32 B out`,
+		`md5()\n2 calls, 2ms\n32 B in, 32 B out\n1 of 2 values _err\n✗ md5: broken`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Script should contain %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "3 calls") {
+		t.Errorf("Nodes should show the stats of their own call site:\n%s", script)
+	}
+}
+
+func TestGenerateASCII_MaxDepth(t *testing.T) {
+	query, err := gojq.Parse(`[find("."; "file")] | map(select(._val | endswith(".go")))`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	tests := []struct {
+		depth   int
+		want    []string
+		notWant []string
+	}{
+		{0, []string{"select()", "endswith()", `String: ".go"`}, []string{"nodes)"}},
+		{1, []string{"find()", "(2 nodes)", "map()", "(4 nodes)"}, []string{"select()"}},
+		{2, []string{"select()", "(3 nodes)", `String: "."`}, []string{"endswith()"}},
+	}
+	for _, tt := range tests {
+		text, err := GenerateASCII(query, GraphOptions{MaxDepth: tt.depth})
+		if err != nil {
+			t.Fatalf("GenerateASCII with depth %d failed: %v", tt.depth, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(text, want) {
+				t.Errorf("GenerateASCII with depth %d should contain %q:\n%s", tt.depth, want, text)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(text, notWant) {
+				t.Errorf("GenerateASCII with depth %d should not contain %q:\n%s", tt.depth, notWant, text)
+			}
+		}
+	}
+}
+
+func TestGenerateCategories(t *testing.T) {
+	query, err := gojq.Parse(`md5 | ._val | base64_encode | length`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	opts, err := GraphOptions{Categories: true}.resolve()
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	graph, _, err := buildGraph(newContext(), query, opts)
+	if err != nil {
+		t.Fatalf("buildGraph failed: %v", err)
+	}
+	fills := map[string]string{}
+	for _, obj := range graph.Objects {
+		if obj.Style.Fill != nil {
+			fills[obj.Label.Value] = obj.Style.Fill.Value
+		}
+	}
+	for label, want := range map[string]string{"md5()": "#46a758", "base64_encode()": "#8e8c99", "Hash": "#46a758", "Encoding": "#8e8c99"} {
+		if fills[label] != want {
+			t.Errorf("%s is filled with %q, want %q", label, fills[label], want)
+		}
+	}
+	if _, ok := fills["length()"]; ok {
+		t.Error("jq builtins should not be filled")
+	}
+
+	text, err := GenerateASCII(query, GraphOptions{Categories: true})
+	if err != nil {
+		t.Fatalf("GenerateASCII failed: %v", err)
+	}
+	if !strings.Contains(text, "Legend") || strings.Contains(text, "File Operations") {
+		t.Errorf("the legend should list only the categories in the graph:\n%s", text)
+	}
+}
+
+func TestCategoryColor(t *testing.T) {
+	if got := categoryColor("HTTP"); got != "#0091ff" {
+		t.Errorf("categoryColor(HTTP) = %q", got)
+	}
+	seen := map[string]string{}
+	for _, c := range udf.Categories() {
+		if _, ok := categoryColors[c]; ok {
+			continue
+		}
+		color := categoryColor(c)
+		if other, ok := seen[color]; ok && len(seen) < len(otherColors) {
+			t.Errorf("%s and %s share the color %s", c, other, color)
+		}
+		seen[color] = c
+	}
+}
+
+func TestGenerateASCII_Sample(t *testing.T) {
+	query, err := gojq.Parse(`.items[] as $x | $x.name | ascii_upcase`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	input := map[string]any{"items": []any{map[string]any{"name": "a"}, map[string]any{"name": "b"}}}
+	text, err := GenerateASCII(query, GraphOptions{Sample: &Sample{Input: input}})
+	if err != nil {
+		t.Fatalf("GenerateASCII failed: %v", err)
+	}
+	for _, want := range []string{`{"items":[{"name":"a"},{"na...`, `{"name":"a"} (+1 more)`,
+		`{"items":[{"name":"a"},{"na... (+1 more)`, `"a" (+1 more)`, `"A" (+1 more)`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("GenerateASCII with a sample should contain %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestSampleStages(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`.a | md5 | length`, []string{`.a`, `.a | md5`, `.a | md5 | length`}},
+		{`.[] as $x | [$x, 1]`, []string{`.[]`, `.[] as $x | .`, `.[] as $x | [$x, 1]`}},
+		{`(.a | .b)[0] | .c`, []string{`.a`, `(.a | .b)[0]`, `(.a | .b)[0] | .c`}},
+		{`def f: .x; f | .y`, []string{`def f: .x; (f)`, `def f: .x; (f | .y)`}},
+	}
+	for _, tt := range tests {
+		query, err := gojq.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		var got []string
+		for _, stage := range sampleStages(query, func(q *gojq.Query) *gojq.Query { return q }) {
+			got = append(got, stage.String())
+		}
+		if strings.Join(got, "; ") != strings.Join(tt.want, "; ") {
+			t.Errorf("sampleStages(%s) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSampleValues(t *testing.T) {
+	many := make([]any, 150)
+	tests := []struct {
+		values []any
+		want   string
+	}{
+		{nil, "empty"},
+		{[]any{"abc"}, `"abc"`},
+		{[]any{1, 2, 3}, "1 (+2 more)"},
+		{[]any{strings.Repeat("x", 40)}, `"` + strings.Repeat("x", 26) + "..."},
+		{many[:maxSampleValues], "null (+99 or more)"},
+	}
+	for _, tt := range tests {
+		if got := formatSampleValues(tt.values); got != tt.want {
+			t.Errorf("formatSampleValues(%v) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateD2_Errors(t *testing.T) {
+	query, err := gojq.Parse(`md5 | ._val | base64_decode | ._val`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	script, err := GenerateD2(query, GraphOptions{Errors: map[string]string{
+		"base64_decode": "base64_decode: illegal base64 data at input byte 4",
+	}})
+	if err != nil {
+		t.Fatalf("GenerateD2 failed: %v", err)
+	}
+	for _, want := range []string{
+		`base64_decode()\n✗ base64_decode: illegal base64 data at input byte 4`,
+		"tooltip: ", "stroke-dash: 3",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Script should contain %q:\n%s", want, script)
+		}
+	}
+	if strings.Count(script, "#e5484d") != 3 {
+		t.Errorf("Only the failing node and its edge should be red:\n%s", script)
+	}
+}
+
+func TestShortenMessage(t *testing.T) {
+	if got := shortenMessage("bad input\nat line 2"); got != "bad input" {
+		t.Errorf("shortenMessage kept %q, want the first line", got)
+	}
+	if got := shortenMessage(strings.Repeat("x", 100)); len(got) != maxErrorMessage || !strings.HasSuffix(got, "...") {
+		t.Errorf("shortenMessage(100 x) = %q, want %d characters ending in ...", got, maxErrorMessage)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 3 << 20: "3.0 MiB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestPNGToPDF(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 200, 100))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	out, err := pngToPDF(img.Bytes())
+	if err != nil {
+		t.Fatalf("pngToPDF failed: %v", err)
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-")) {
+		t.Errorf("Output should be a PDF, got %q", out[:min(len(out), 8)])
+	}
+	if _, err := pngToPDF([]byte("not a png")); err == nil {
+		t.Error("pngToPDF should reject data that is not a PNG")
+	}
+}
+
+func TestGenerateMermaid(t *testing.T) {
+	query, err := gojq.Parse(`.files[] | sha256 | {file: ._meta.file_path, hash: ._val}`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	out, err := GenerateMermaid(query, GraphOptions{})
+	if err != nil {
+		t.Fatalf("GenerateMermaid failed: %v", err)
+	}
+	for _, want := range []string{
+		"flowchart LR\n",
+		`start(("Start"))`,
+		`node_1["sha256()"]`,
+		`subgraph node_2 ["Object"]`,
+		`subgraph node_2_child_0 ["file"]`,
+		`node_2_child_1_child_0["._val"]`,
+		"start --> node_0",
+		"node_1 --> node_2",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Output should contain %q:\n%s", want, out)
+		}
+	}
+
+	query, err = gojq.Parse(`. as $x | $x`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	out, err = GenerateMermaid(query, GraphOptions{Direction: "down"})
+	if err != nil {
+		t.Fatalf("GenerateMermaid failed: %v", err)
+	}
+	if !strings.HasPrefix(out, "flowchart TD\n") {
+		t.Errorf("Output should flow down:\n%s", out)
+	}
+	if strings.Contains(out, "_VAR_") {
+		t.Errorf("Output should show variables as they are:\n%s", out)
+	}
+}
+
+func TestGenerateGraph_Mermaid(t *testing.T) {
+	query, err := gojq.Parse("md5 | ._val")
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	outputPath := filepath.Join(t.TempDir(), "test.mmd")
+	if err := GenerateGraph(query, outputPath, GraphOptions{}); err != nil {
+		t.Fatalf("GenerateGraph failed: %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if !strings.Contains(string(content), `node_0["md5()"]`) {
+		t.Errorf("Output should contain the md5() node:\n%s", content)
+	}
+}
+
+func TestMermaidLabel(t *testing.T) {
+	for label, want := range map[string]string{
+		`._val`:             `"._val"`,
+		`select(.a == "b")`: `"select(.a == #quot;b#quot;)"`,
+		`$x | .[0]`:         `"$x | .[0]"`,
+	} {
+		if got := mermaidLabel(label); got != want {
+			t.Errorf("mermaidLabel(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
+
+func TestFormatASCII(t *testing.T) {
+	nodes := []*textNode{
+		{label: "Start", round: true, linked: true},
+		{label: "map()", linked: true, edge: "array", children: []*textNode{
+			{label: "md5()", linked: true},
+			{label: "._val"},
+		}},
+		{label: "End", round: true},
+	}
+	want := `╭───────╮
+│ Start │
+╰─┬─────╯
+  │
+  ▼
+┌─ map() ───┐
+│ ┌───────┐ │
+│ │ md5() │ │
+│ └─┬─────┘ │
+│   │       │
+│   ▼       │
+│ ┌───────┐ │
+│ │ ._val │ │
+│ └───────┘ │
+└─┬─────────┘
+  │ array
+  ▼
+╭─────╮
+│ End │
+╰─────╯
+↪ md5() → End
+`
+	if got := formatASCII(nodes, []string{"md5() → End"}); got != want {
+		t.Errorf("formatASCII() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGenerateASCII(t *testing.T) {
+	query, err := gojq.Parse(`. as $x | $x | md5 | ._val`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	out, err := GenerateASCII(query, GraphOptions{})
+	if err != nil {
+		t.Fatalf("GenerateASCII failed: %v", err)
+	}
+	for _, want := range []string{"│ Start │", "│ md5() │", "│ ._val │", "│ End │", "  ▼\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Output should contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "_VAR_") {
+		t.Errorf("Output should show variables as they are:\n%s", out)
+	}
+}
+
+func TestGenerateProgress(t *testing.T) {
+	query, err := gojq.Parse("md5 | ._val")
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	for _, format := range []string{"svg", "ascii"} {
+		var got []string
+		opts := GraphOptions{Format: format, Progress: func(stage string, step, steps int) {
+			got = append(got, fmt.Sprintf("%s %d/%d", stage, step, steps))
+		}}
+		if _, err := Generate(query, opts); err != nil {
+			t.Fatalf("Generate(%q) failed: %v", format, err)
+		}
+		var want []string
+		stages := ProgressStages(format)
+		for i, stage := range stages {
+			want = append(want, fmt.Sprintf("%s %d/%d", stage, i+1, len(stages)))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Generate(%q) reported %v, want %v", format, got, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2oracle"
+)
+
+const (
+	errorColor      = "#e5484d"
+	maxErrorMessage = 60
+)
+
+// highlightErrors draws the nodes of the functions that returned an _err in
+// red, with the message as a tooltip and below the label, and dashes the
+// edges the errors flowed on through. With errors by call site, only the
+// calls that failed are drawn
+func highlightErrors(graph *d2graph.Graph, boardPath []string, errs nodeValues[string]) (*d2graph.Graph, error) {
+	if errs.empty() {
+		return graph, nil
+	}
+	// Collect first, as each Set recompiles the graph
+	var ids, labels, tooltips []string
+	failed := map[string]bool{}
+	for _, obj := range graph.Objects {
+		msg, ok := errs.lookup(obj)
+		if !ok {
+			continue
+		}
+		if msg == "" {
+			msg = "returned an _err"
+		}
+		ids = append(ids, obj.AbsID())
+		labels = append(labels, obj.Label.Value+"\n✗ "+shortenMessage(msg))
+		tooltips = append(tooltips, msg)
+		failed[obj.AbsID()] = true
+	}
+	var edges []string
+	for _, edge := range graph.Edges {
+		if failed[edge.Src.AbsID()] {
+			edges = append(edges, edge.AbsID())
+		}
+	}
+
+	set := func(key, value string) error {
+		var err error
+		graph, err = d2oracle.Set(graph, boardPath, key, nil, &value)
+		if err != nil {
+			return fmt.Errorf("failed to highlight %s: %w", key, err)
+		}
+		return nil
+	}
+	for i, id := range ids {
+		for _, kv := range [][2]string{
+			{".label", labels[i]},
+			{".tooltip", tooltips[i]},
+			{".style.stroke", errorColor},
+			{".style.stroke-width", "3"},
+			{".style.font-color", errorColor},
+		} {
+			if err := set(id+kv[0], kv[1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, id := range edges {
+		if err := set(id+".style.stroke", errorColor); err != nil {
+			return nil, err
+		}
+		if err := set(id+".style.stroke-dash", "3"); err != nil {
+			return nil, err
+		}
+	}
+	return graph, nil
+}
+
+// shortenMessage keeps the first line of an error message, cut to fit under
+// a node
+func shortenMessage(msg string) string {
+	msg, _, _ = strings.Cut(msg, "\n")
+	if r := []rune(msg); len(r) > maxErrorMessage {
+		msg = string(r[:maxErrorMessage-3]) + "..."
+	}
+	return msg
+}
@@ -0,0 +1,72 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// mermaidDirections are the flowchart directions of GraphOptions.Direction
+var mermaidDirections = map[string]string{
+	"right": "LR",
+	"down":  "TD",
+	"left":  "RL",
+	"up":    "BT",
+}
+
+// GenerateMermaid returns a Mermaid flowchart of the flow of a jq query, the
+// same graph GenerateD2 describes, for markdown that renders Mermaid such as
+// GitHub's and GitLab's
+func GenerateMermaid(query *gojq.Query, opts GraphOptions) (string, error) {
+	opts.Format = "mermaid"
+	out, err := Generate(query, opts)
+	return string(out), err
+}
+
+// formatMermaid writes a D2 graph as a Mermaid flowchart. Containers become
+// subgraphs, circles stay circles, and everything else is a box
+func formatMermaid(graph *d2graph.Graph, direction string) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "flowchart %s\n", mermaidDirections[direction])
+	var writeObjects func(objs []*d2graph.Object, indent string)
+	writeObjects = func(objs []*d2graph.Object, indent string) {
+		for _, obj := range objs {
+			id, label := mermaidID(obj.AbsID()), mermaidLabel(obj.Label.Value)
+			switch {
+			case len(obj.ChildrenArray) > 0:
+				fmt.Fprintf(&s, "%ssubgraph %s [%s]\n", indent, id, label)
+				writeObjects(obj.ChildrenArray, indent+"  ")
+				fmt.Fprintf(&s, "%send\n", indent)
+			case obj.Shape.Value == "circle":
+				fmt.Fprintf(&s, "%s%s((%s))\n", indent, id, label)
+			default:
+				fmt.Fprintf(&s, "%s%s[%s]\n", indent, id, label)
+			}
+		}
+	}
+	writeObjects(graph.Root.ChildrenArray, "  ")
+	for _, edge := range graph.Edges {
+		src, dst := mermaidID(edge.Src.AbsID()), mermaidID(edge.Dst.AbsID())
+		if edge.Label.Value != "" {
+			fmt.Fprintf(&s, "  %s -->|%s| %s\n", src, mermaidLabel(edge.Label.Value), dst)
+		} else {
+			fmt.Fprintf(&s, "  %s --> %s\n", src, dst)
+		}
+	}
+	return s.String()
+}
+
+// mermaidID flattens a D2 path like node_3.child_0 into a Mermaid node ID
+func mermaidID(absID string) string {
+	return strings.ReplaceAll(absID, ".", "_")
+}
+
+// mermaidLabel quotes a label, so that brackets, pipes and the like in a
+// query are shown as they are
+func mermaidLabel(label string) string {
+	label = strings.ReplaceAll(label, `"`, "#quot;")
+	label = strings.ReplaceAll(label, "\n", "<br>")
+	return `"` + label + `"`
+}
@@ -0,0 +1,230 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+)
+
+// GraphOptions controls how a query graph is laid out and rendered. The
+// zero value renders as pwrq always has: an SVG left to right, laid out by
+// dagre, in the dark mauve theme, with labels cut at 50 characters
+type GraphOptions struct {
+	Format    string // output format of Generate, one of Formats; "" for "svg"
+	Layout    string // layout engine: "dagre" or "elk"
+	Direction string // flow direction: "right", "down", "left" or "up"
+	Theme     string // a D2 theme name like "dark-mauve", "dark", "light", or its ID
+	Padding   *int   // space around the diagram in pixels; nil for D2's default
+	Sketch    bool   // draw hand-drawn looking shapes
+	MaxLabel  int    // cut longer node labels with "..."; 0 for the default, -1 for no limit
+	MaxDepth  int    // levels of nested nodes shown, collapsing the containers of the last; 0 for all
+
+	// Categories fills the node of each UDF with the color of its category,
+	// like File Operations or HTTP, and adds a legend of them
+	Categories bool
+
+	// Stats annotate the graph with what a run of the query spent in each
+	// UDF, by function name, weighting edges by the data they carried
+	Stats map[string]NodeStats
+
+	// SiteStats are Stats by call site, as numbered by udf.CallSites. When
+	// given, the node of each call shows the stats of its own site rather
+	// than the totals of its function
+	SiteStats map[int]NodeStats
+
+	// Errors are the first _err each failing UDF returned, by function
+	// name. Their nodes are drawn in red with the message attached
+	Errors map[string]string
+
+	// SiteErrors are Errors by call site, as numbered by udf.CallSites.
+	// When given, only the calls at the sites that failed are drawn in red
+	SiteErrors map[int]string
+
+	// Sample runs the query on an example input, labeling the edges of its
+	// main flow with the values they carry. The query runs once per edge
+	Sample *Sample
+
+	// Progress is called as Generate starts each stage of its work, with
+	// the stage's name and its number, from 1, out of the stages the
+	// format goes through. See ProgressStages
+	Progress func(stage string, step, steps int)
+}
+
+// ProgressStages returns the stages Generate reports to
+// GraphOptions.Progress for a format, in order: building the graph, then
+// styling and annotating it, and either writing it as text, or laying it
+// out and rendering it, and for PNG and PDF converting the SVG
+func ProgressStages(format string) []string {
+	switch strings.ToLower(format) {
+	case "", "svg":
+		return []string{"build", "style", "layout", "render"}
+	case "png", "pdf":
+		return []string{"build", "style", "layout", "render", "convert"}
+	}
+	return []string{"build", "style", "write"}
+}
+
+const (
+	defaultFormat    = "svg"
+	defaultLayout    = "dagre"
+	defaultDirection = "right"
+	defaultThemeID   = 200 // dark-mauve
+	defaultMaxLabel  = 50
+	minMaxLabel      = 4 // room for a character and the "..."
+)
+
+// themes are the D2 themes by name, with dark and light as shorthands
+var themes = map[string]int64{
+	"neutral-default":           0,
+	"neutral-grey":              1,
+	"flagship-terrastruct":      3,
+	"cool-classics":             4,
+	"mixed-berry-blue":          5,
+	"grape-soda":                6,
+	"aubergine":                 7,
+	"colorblind-clear":          8,
+	"vanilla-nitro-cola":        100,
+	"orange-creamsicle":         101,
+	"shirley-temple":            102,
+	"earth-tones":               103,
+	"everglade-green":           104,
+	"buttered-toast":            105,
+	"dark-mauve":                200,
+	"dark-flagship-terrastruct": 201,
+	"terminal":                  300,
+	"terminal-grayscale":        301,
+	"origami":                   302,
+	"dark":                      200,
+	"light":                     0,
+}
+
+// ThemeNames lists the theme names GraphOptions accepts, sorted
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that the options name a known format, layout, direction
+// and theme, and that the padding, label length and depth are in range
+func (opts GraphOptions) Validate() error {
+	_, err := opts.resolve()
+	return err
+}
+
+// resolve fills in the defaults and looks up the theme ID
+func (opts GraphOptions) resolve() (resolvedOptions, error) {
+	r := resolvedOptions{
+		format:     defaultFormat,
+		layout:     defaultLayout,
+		direction:  defaultDirection,
+		themeID:    defaultThemeID,
+		padding:    int64(d2svg.DEFAULT_PADDING),
+		sketch:     opts.Sketch,
+		maxLabel:   defaultMaxLabel,
+		stats:      opts.Stats,
+		siteStats:  opts.SiteStats,
+		errors:     opts.Errors,
+		siteErrors: opts.SiteErrors,
+		sample:     opts.Sample,
+		categories: opts.Categories,
+		progress:   opts.Progress,
+	}
+	if opts.Format != "" {
+		r.format = strings.ToLower(opts.Format)
+		if !slices.Contains(Formats, r.format) {
+			return r, fmt.Errorf("unknown format %q (expected one of %s)", opts.Format, strings.Join(Formats, ", "))
+		}
+	}
+	switch layout := strings.ToLower(opts.Layout); layout {
+	case "":
+	case "dagre", "elk":
+		r.layout = layout
+	default:
+		return r, fmt.Errorf("unknown layout %q (expected dagre or elk)", opts.Layout)
+	}
+	switch direction := strings.ToLower(opts.Direction); direction {
+	case "":
+	case "right", "down", "left", "up":
+		r.direction = direction
+	default:
+		return r, fmt.Errorf("unknown direction %q (expected right, down, left or up)", opts.Direction)
+	}
+	if opts.Theme != "" {
+		theme := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(opts.Theme), " ", "-"))
+		id, ok := themes[theme]
+		if !ok {
+			n, err := strconv.ParseInt(theme, 10, 64)
+			if err != nil || !knownThemeID(n) {
+				return r, fmt.Errorf("unknown theme %q (expected one of %s, or a theme ID)",
+					opts.Theme, strings.Join(ThemeNames(), ", "))
+			}
+			id = n
+		}
+		r.themeID = id
+	}
+	if opts.Padding != nil {
+		if *opts.Padding < 0 {
+			return r, fmt.Errorf("padding must not be negative: %d", *opts.Padding)
+		}
+		r.padding = int64(*opts.Padding)
+	}
+	switch {
+	case opts.MaxLabel == 0:
+	case opts.MaxLabel < 0:
+		r.maxLabel = 0
+	case opts.MaxLabel < minMaxLabel:
+		return r, fmt.Errorf("label length must be at least %d: %d", minMaxLabel, opts.MaxLabel)
+	default:
+		r.maxLabel = opts.MaxLabel
+	}
+	if opts.MaxDepth < 0 {
+		return r, fmt.Errorf("depth must not be negative: %d", opts.MaxDepth)
+	}
+	r.maxDepth = opts.MaxDepth
+	return r, nil
+}
+
+func knownThemeID(id int64) bool {
+	for _, n := range themes {
+		if n == id {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvedOptions are GraphOptions with the defaults filled in
+type resolvedOptions struct {
+	format     string
+	layout     string
+	direction  string
+	themeID    int64
+	padding    int64
+	sketch     bool
+	maxLabel   int // 0 for no limit
+	maxDepth   int // 0 for no limit
+	stats      map[string]NodeStats
+	siteStats  map[int]NodeStats
+	errors     map[string]string
+	siteErrors map[int]string
+	sample     *Sample
+	categories bool
+	progress   func(stage string, step, steps int)
+}
+
+// report tells the progress callback that a stage of the work starts
+func (r resolvedOptions) report(stage string) {
+	if r.progress == nil {
+		return
+	}
+	stages := ProgressStages(r.format)
+	r.progress(stage, slices.Index(stages, stage)+1, len(stages))
+}
@@ -0,0 +1,56 @@
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+
+	"github.com/jung-kurt/gofpdf"
+	d2png "oss.terrastruct.com/d2/lib/png"
+)
+
+// renderPNG rasterizes an SVG the way the d2 command does, in a headless
+// Chromium driven by Playwright, which is downloaded on first use. The PNG
+// is drawn at twice the size of the SVG, to stay sharp on high DPI screens
+func renderPNG(svg []byte) ([]byte, error) {
+	pw, err := d2png.InitPlaywright()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the browser that renders PNG: %w", err)
+	}
+	defer pw.Cleanup()
+	img, err := d2png.ConvertSVG(pw.Page, svg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render D2 diagram to PNG: %w", err)
+	}
+	return img, nil
+}
+
+// renderPDF puts the PNG rendering of an SVG on a single page of its size
+func renderPDF(svg []byte) ([]byte, error) {
+	img, err := renderPNG(svg)
+	if err != nil {
+		return nil, err
+	}
+	return pngToPDF(img)
+}
+
+func pngToPDF(img []byte) ([]byte, error) {
+	cfg, err := png.DecodeConfig(bytes.NewReader(img))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PNG: %w", err)
+	}
+	// Back to the size of the SVG, in points of 3/4 of a CSS pixel
+	w, h := float64(cfg.Width)/2*0.75, float64(cfg.Height)/2*0.75
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{UnitStr: "pt", Size: gofpdf.SizeType{Wd: w, Ht: h}})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPage()
+	opts := gofpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader("graph", opts, bytes.NewReader(img))
+	pdf.ImageOptions("graph", 0, 0, w, h, false, opts, 0, "")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to render PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,194 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2oracle"
+)
+
+// Sample is an input to run a query on, so that the graph shows an example
+// of the values flowing along each edge of its main flow
+type Sample struct {
+	Input     any
+	Options   []gojq.CompilerOption // compile the query, like the UDFs it calls
+	Variables []any                 // values of the variables the options declare
+}
+
+const (
+	maxSampleLabel  = 30  // cut longer example values with "..."
+	maxSampleValues = 100 // values counted at an edge before giving up
+)
+
+// sampleStages returns, for each node the traversal draws at the top level,
+// the query whose output leaves that node. They follow the traversal: pipes
+// and parenthesized queries are drawn stage by stage, and everything else is
+// a single node. wrap puts a stage back into the pipes around it
+func sampleStages(query *gojq.Query, wrap func(*gojq.Query) *gojq.Query) []*gojq.Query {
+	if query == nil {
+		return nil
+	}
+	// Stages cut out of the query still need its imports and function
+	// definitions, while the query as a whole has them
+	whole := wrap
+	if len(query.Imports) > 0 || len(query.FuncDefs) > 0 {
+		imports, defs, outer := query.Imports, query.FuncDefs, wrap
+		wrap = func(q *gojq.Query) *gojq.Query {
+			return outer(&gojq.Query{Imports: imports, FuncDefs: defs, Term: &gojq.Term{Type: gojq.TermTypeQuery, Query: q}})
+		}
+	}
+	if query.Op == gojq.OpPipe {
+		stages := sampleStages(query.Left, wrap)
+		right := func(q *gojq.Query) *gojq.Query {
+			return wrap(&gojq.Query{Left: query.Left, Op: gojq.OpPipe, Patterns: query.Patterns, Right: q})
+		}
+		// The binding node passes on the input of the pipe, once for each
+		// binding of its variables
+		if len(query.Patterns) > 0 {
+			stages = append(stages, right(&gojq.Query{Term: &gojq.Term{Type: gojq.TermTypeIdentity}}))
+		}
+		return append(stages, sampleStages(query.Right, right)...)
+	}
+	var inner *gojq.Query
+	if t := query.Term; t != nil {
+		switch {
+		case t.Type == gojq.TermTypeQuery:
+			inner = t.Query
+		case t.Type == gojq.TermTypeArray && t.Array != nil:
+			inner = t.Array.Query
+		}
+	}
+	if inner == nil {
+		return []*gojq.Query{whole(query)}
+	}
+	// The last node drawn for (...) or [...] carries what the whole term
+	// gives, with its suffixes applied and its values collected
+	stages := sampleStages(inner, wrap)
+	if len(stages) > 0 {
+		stages[len(stages)-1] = whole(query)
+	}
+	return stages
+}
+
+// annotateSample runs the query on the sample input up to each node of its
+// main flow, and shows the values leaving the node on its edge to the next
+// one. The graph is left as it is if its nodes don't line up with the stages
+func annotateSample(graph *d2graph.Graph, boardPath []string, query *gojq.Query, sample *Sample) (*d2graph.Graph, error) {
+	if sample == nil {
+		return graph, nil
+	}
+	stages := sampleStages(query, func(q *gojq.Query) *gojq.Query { return q })
+	nodes := topLevelNodes(graph)
+	if len(nodes) != len(stages) {
+		return graph, nil
+	}
+
+	// The edges of the main flow run from start through each node to end
+	from := append([]string{"start"}, nodes...)
+	to := append(nodes[:len(nodes):len(nodes)], endNode(graph))
+	values := []string{formatSampleValues([]any{sample.Input})}
+	for _, stage := range stages {
+		values = append(values, runSample(stage, sample))
+	}
+	var edges, labels []string
+	for _, edge := range graph.Edges {
+		for i := range from {
+			if edge.Src.AbsID() != from[i] || edge.Dst.AbsID() != to[i] {
+				continue
+			}
+			label := values[i]
+			if edge.Label.Value != "" {
+				label = edge.Label.Value + ": " + label
+			}
+			edges = append(edges, edge.AbsID())
+			labels = append(labels, label)
+		}
+	}
+
+	var err error
+	for i, id := range edges {
+		graph, err = d2oracle.Set(graph, boardPath, id+".label", nil, &labels[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to add sample to edge %s: %w", id, err)
+		}
+	}
+	return graph, nil
+}
+
+// topLevelNodes returns the IDs of the nodes outside any container, besides
+// start and end, in the order they were created
+func topLevelNodes(graph *d2graph.Graph) []string {
+	var ids []string
+	for _, obj := range graph.Root.ChildrenArray {
+		if strings.HasPrefix(obj.ID, "node_") {
+			ids = append(ids, obj.ID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		m, _ := strconv.Atoi(strings.TrimPrefix(ids[i], "node_"))
+		n, _ := strconv.Atoi(strings.TrimPrefix(ids[j], "node_"))
+		return m < n
+	})
+	return ids
+}
+
+// endNode returns the ID of the end node
+func endNode(graph *d2graph.Graph) string {
+	for _, obj := range graph.Root.ChildrenArray {
+		if strings.HasPrefix(obj.ID, "end_") {
+			return obj.ID
+		}
+	}
+	return ""
+}
+
+// runSample runs a stage on the sample input and formats what it gives
+func runSample(stage *gojq.Query, sample *Sample) string {
+	code, err := gojq.Compile(stage, sample.Options...)
+	if err != nil {
+		return "error: " + shortenMessage(err.Error())
+	}
+	var values []any
+	iter := code.Run(sample.Input, sample.Variables...)
+	for len(values) < maxSampleValues {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			if len(values) == 0 {
+				return "error: " + shortenMessage(err.Error())
+			}
+			break
+		}
+		values = append(values, v)
+	}
+	return formatSampleValues(values)
+}
+
+// formatSampleValues shows the first of the values as compact JSON, and how
+// many more there are
+func formatSampleValues(values []any) string {
+	if len(values) == 0 {
+		return "empty"
+	}
+	b, err := gojq.Marshal(values[0])
+	if err != nil {
+		return "error: " + shortenMessage(err.Error())
+	}
+	s := string(b)
+	if r := []rune(s); len(r) > maxSampleLabel {
+		s = string(r[:maxSampleLabel-3]) + "..."
+	}
+	switch n := len(values) - 1; {
+	case n >= maxSampleValues-1:
+		s += fmt.Sprintf(" (+%d or more)", n)
+	case n > 0:
+		s += fmt.Sprintf(" (+%d more)", n)
+	}
+	return s
+}
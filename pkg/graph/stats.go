@@ -0,0 +1,150 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2oracle"
+)
+
+// NodeStats are what a run of a query spent in a UDF, as pwrq --profile
+// collects them
+type NodeStats struct {
+	Calls    int
+	Values   int
+	Errors   int
+	Total    time.Duration
+	BytesIn  int
+	BytesOut int
+}
+
+const (
+	minStrokeWidth = 1
+	maxStrokeWidth = 8
+)
+
+// nodeValues look up a value, like the stats, of each function node: by its
+// call site when values by site are given, and by the name of its function
+// otherwise
+type nodeValues[V any] struct {
+	byName    map[string]V
+	bySite    map[int]V
+	nodeSites map[string]int // node ID -> call site
+}
+
+func (n nodeValues[V]) empty() bool {
+	return len(n.byName) == 0 && len(n.bySite) == 0
+}
+
+// lookup returns the value of a node. A UDF call whose site has no value,
+// as it never ran, gets none rather than the totals of other sites
+func (n nodeValues[V]) lookup(obj *d2graph.Object) (V, bool) {
+	var v V
+	name, ok := funcNodeName(obj)
+	if !ok {
+		return v, false
+	}
+	if site, ok := n.nodeSites[obj.AbsID()]; ok && len(n.bySite) > 0 {
+		v, ok = n.bySite[site]
+		return v, ok
+	}
+	v, ok = n.byName[name]
+	return v, ok
+}
+
+// annotateStats adds the stats of each function node below its label, and
+// weights the edges leaving it by the data it returned. With stats by call
+// site, a function called at two places shows what each of them spent
+func annotateStats(graph *d2graph.Graph, boardPath []string, stats nodeValues[NodeStats]) (*d2graph.Graph, error) {
+	if stats.empty() {
+		return graph, nil
+	}
+	// Collect first, as each Set recompiles the graph
+	var ids, labels []string
+	out := map[string]int{}
+	var maxOut int
+	for _, obj := range graph.Objects {
+		s, ok := stats.lookup(obj)
+		if !ok {
+			continue
+		}
+		ids = append(ids, obj.AbsID())
+		labels = append(labels, obj.Label.Value+"\n"+formatStats(s))
+		out[obj.AbsID()] = s.BytesOut
+		maxOut = max(maxOut, s.BytesOut)
+	}
+	var edges, edgeLabels, widths []string
+	for _, edge := range graph.Edges {
+		n, ok := out[edge.Src.AbsID()]
+		if !ok {
+			continue
+		}
+		label := formatBytes(n)
+		if edge.Label.Value != "" {
+			label = edge.Label.Value + ", " + label
+		}
+		width := minStrokeWidth
+		if maxOut > 0 {
+			width += (maxStrokeWidth - minStrokeWidth) * n / maxOut
+		}
+		edges = append(edges, edge.AbsID())
+		edgeLabels = append(edgeLabels, label)
+		widths = append(widths, fmt.Sprint(width))
+	}
+
+	var err error
+	for i, id := range ids {
+		graph, err = d2oracle.Set(graph, boardPath, id+".label", nil, &labels[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to annotate %s: %w", id, err)
+		}
+	}
+	for i, id := range edges {
+		graph, err = d2oracle.Set(graph, boardPath, id+".label", nil, &edgeLabels[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to annotate edge %s: %w", id, err)
+		}
+		graph, err = d2oracle.Set(graph, boardPath, id+".style.stroke-width", nil, &widths[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to weight edge %s: %w", id, err)
+		}
+	}
+	return graph, nil
+}
+
+// funcNodeName returns the name of the function a node calls, from its
+// label: name() on the first line
+func funcNodeName(obj *d2graph.Object) (string, bool) {
+	first, _, _ := strings.Cut(obj.Label.Value, "\n")
+	return strings.CutSuffix(first, "()")
+}
+
+// formatStats shows the stats of a function as lines below its label
+func formatStats(s NodeStats) string {
+	calls := "calls"
+	if s.Calls == 1 {
+		calls = "call"
+	}
+	lines := []string{
+		fmt.Sprintf("%d %s, %s", s.Calls, calls, s.Total.Round(time.Microsecond)),
+		fmt.Sprintf("%s in, %s out", formatBytes(s.BytesIn), formatBytes(s.BytesOut)),
+	}
+	if s.Errors > 0 {
+		lines = append(lines, fmt.Sprintf("%d of %d values _err", s.Errors, s.Values))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatBytes shows a size in binary units, like 1.5 KiB
+func formatBytes(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f, unit := float64(n)/1024, 0
+	for f >= 1024 && unit < 4 {
+		f, unit = f/1024, unit+1
+	}
+	return fmt.Sprintf("%.1f %ciB", f, "KMGTP"[unit])
+}
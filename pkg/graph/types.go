@@ -0,0 +1,66 @@
+package graph
+
+import "github.com/xen0bit/pwrq/pkg/udf"
+
+// builtinOutputTypes are the types of what jq builtins return, for those
+// that always return the same type
+var builtinOutputTypes = map[string]string{
+	"length":         "number",
+	"utf8bytelength": "number",
+	"keys":           "array",
+	"keys_unsorted":  "array",
+	"to_entries":     "array",
+	"from_entries":   "object",
+	"with_entries":   "object",
+	"map":            "array",
+	"sort":           "array",
+	"sort_by":        "array",
+	"group_by":       "array",
+	"unique":         "array",
+	"unique_by":      "array",
+	"explode":        "array",
+	"path":           "array",
+	"paths":          "array",
+	"splits":         "string",
+	"join":           "string",
+	"implode":        "string",
+	"tostring":       "string",
+	"tojson":         "string",
+	"type":           "string",
+	"ascii_downcase": "string",
+	"ascii_upcase":   "string",
+	"ltrimstr":       "string",
+	"rtrimstr":       "string",
+	"todate":         "string",
+	"strftime":       "string",
+	"tonumber":       "number",
+	"fromdate":       "number",
+	"mktime":         "number",
+	"now":            "number",
+	"floor":          "number",
+	"ceil":           "number",
+	"round":          "number",
+	"sqrt":           "number",
+	"fabs":           "number",
+	"test":           "boolean",
+	"startswith":     "boolean",
+	"endswith":       "boolean",
+	"contains":       "boolean",
+	"inside":         "boolean",
+	"has":            "boolean",
+	"in":             "boolean",
+	"any":            "boolean",
+	"all":            "boolean",
+	"not":            "boolean",
+	"isempty":        "boolean",
+}
+
+// funcOutputType returns the type of what a function returns: for a UDF,
+// plugins' included, the type of its _val as its metadata declares it, or
+// "" when that varies or isn't known
+func funcOutputType(name string) string {
+	if m, ok := udf.LookupFunction(name); ok {
+		return m.Output
+	}
+	return builtinOutputTypes[name]
+}
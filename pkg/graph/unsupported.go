@@ -0,0 +1,103 @@
+package graph
+
+import "github.com/itchyny/gojq"
+
+// Unsupported lists the constructs in query that GenerateD2 cannot draw
+// yet, in the order they first appear. Such a query still renders, but
+// function definitions are left out
+func Unsupported(query *gojq.Query) []string {
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	var walkQuery func(*gojq.Query)
+	var walkTerm func(*gojq.Term)
+	walkString := func(s *gojq.String) {
+		if s != nil {
+			for _, q := range s.Queries {
+				walkQuery(q)
+			}
+		}
+	}
+	walkIndex := func(index *gojq.Index) {
+		if index != nil {
+			walkString(index.Str)
+			walkQuery(index.Start)
+			walkQuery(index.End)
+		}
+	}
+	walkQuery = func(q *gojq.Query) {
+		if q == nil {
+			return
+		}
+		if len(q.FuncDefs) > 0 {
+			add("def")
+		}
+		walkTerm(q.Term)
+		walkQuery(q.Left)
+		walkQuery(q.Right)
+	}
+	walkTerm = func(t *gojq.Term) {
+		if t == nil {
+			return
+		}
+		walkIndex(t.Index)
+		if t.Func != nil {
+			for _, arg := range t.Func.Args {
+				walkQuery(arg)
+			}
+		}
+		if t.Object != nil {
+			for _, kv := range t.Object.KeyVals {
+				walkString(kv.KeyString)
+				walkQuery(kv.KeyQuery)
+				walkQuery(kv.Val)
+			}
+		}
+		if t.Array != nil {
+			walkQuery(t.Array.Query)
+		}
+		if t.Unary != nil {
+			walkTerm(t.Unary.Term)
+		}
+		walkString(t.Str)
+		walkQuery(t.Query)
+		if t.If != nil {
+			walkQuery(t.If.Cond)
+			walkQuery(t.If.Then)
+			for _, elif := range t.If.Elif {
+				walkQuery(elif.Cond)
+				walkQuery(elif.Then)
+			}
+			walkQuery(t.If.Else)
+		}
+		if t.Try != nil {
+			walkQuery(t.Try.Body)
+			walkQuery(t.Try.Catch)
+		}
+		if t.Reduce != nil {
+			walkQuery(t.Reduce.Query)
+			walkQuery(t.Reduce.Start)
+			walkQuery(t.Reduce.Update)
+		}
+		if t.Foreach != nil {
+			walkQuery(t.Foreach.Query)
+			walkQuery(t.Foreach.Start)
+			walkQuery(t.Foreach.Update)
+			walkQuery(t.Foreach.Extract)
+		}
+		if t.Label != nil {
+			walkQuery(t.Label.Body)
+		}
+		for _, suffix := range t.SuffixList {
+			walkIndex(suffix.Index)
+		}
+	}
+	walkQuery(query)
+	return names
+}
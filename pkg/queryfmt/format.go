@@ -0,0 +1,294 @@
+// Package queryfmt pretty-prints jq queries from their gojq syntax tree.
+//
+// A query that fits in the line width is printed on one line, the way
+// gojq prints it. A longer one is broken up, outermost construct first:
+// one pipeline stage per line with the | leading, one object key or
+// function argument per line, and if, reduce and foreach bodies on lines
+// of their own, each level indented by two spaces.
+package queryfmt
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+)
+
+// DefaultWidth is the line width Format uses when given zero
+const DefaultWidth = 80
+
+const indentWidth = 2
+
+// Format prints a query, breaking lines longer than width
+func Format(query *gojq.Query, width int) string {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	p := &printer{width: width}
+	return p.query(query, 0)
+}
+
+type printer struct {
+	width int
+}
+
+// fits reports whether s can go on a line from column col
+func (p *printer) fits(col int, s string) bool {
+	return !strings.Contains(s, "\n") && col+utf8.RuneCountInString(s) <= p.width
+}
+
+func newline(indent int) string {
+	return "\n" + strings.Repeat(" ", indent)
+}
+
+// query prints q to start at column indent, with any following lines
+// indented by at least as much
+func (p *printer) query(q *gojq.Query, indent int) string {
+	var s strings.Builder
+	if q.Meta != nil || len(q.Imports) > 0 {
+		// The module header is printed as gojq does, a line per directive
+		header := &gojq.Query{Meta: q.Meta, Imports: q.Imports}
+		s.WriteString(header.String())
+		s.WriteString(strings.Repeat(" ", indent))
+	}
+	for _, fd := range q.FuncDefs {
+		s.WriteString(p.funcDef(fd, indent))
+		s.WriteString(newline(indent))
+	}
+	s.WriteString(p.body(q, indent))
+	return s.String()
+}
+
+func (p *printer) funcDef(fd *gojq.FuncDef, indent int) string {
+	head := (&gojq.FuncDef{Name: fd.Name, Args: fd.Args, Body: &gojq.Query{}}).String()
+	head = strings.TrimSuffix(head, " ;")
+	if body := fd.Body.String(); len(fd.Body.FuncDefs) == 0 && p.fits(indent+len(head)+1, body+";") {
+		return head + " " + body + ";"
+	}
+	return head + newline(indent+indentWidth) + p.query(fd.Body, indent+indentWidth) + ";"
+}
+
+// body prints q without its module header and function definitions
+func (p *printer) body(q *gojq.Query, indent int) string {
+	if q.Term == nil && q.Right == nil {
+		return ""
+	}
+	bare := &gojq.Query{Term: q.Term, Left: q.Left, Op: q.Op, Right: q.Right, Patterns: q.Patterns}
+	if flat := bare.String(); p.fits(indent, flat) {
+		return flat
+	}
+	if q.Term != nil {
+		return p.term(q.Term, indent)
+	}
+	switch q.Op {
+	case gojq.OpPipe:
+		// The first stage starts the line, the others follow a "| "
+		stages := []string{p.stage(q.Left, q.Patterns, indent)}
+		for q = q.Right; q.Op == gojq.OpPipe && len(q.FuncDefs) == 0; q = q.Right {
+			stages = append(stages, p.stage(q.Left, q.Patterns, indent+indentWidth))
+		}
+		stages = append(stages, p.query(q, indent+indentWidth))
+		return strings.Join(stages, newline(indent)+"| ")
+	case gojq.OpComma:
+		var items []string
+		for q.Op == gojq.OpComma && len(q.FuncDefs) == 0 {
+			items = append(items, p.query(q.Left, indent))
+			q = q.Right
+		}
+		items = append(items, p.query(q, indent))
+		return strings.Join(items, ","+newline(indent))
+	case gojq.OpAnd, gojq.OpOr, gojq.OpAlt:
+		return p.query(q.Left, indent) + newline(indent) + q.Op.String() + " " +
+			p.query(q.Right, indent+len(q.Op.String())+1)
+	}
+	left := p.query(q.Left, indent)
+	return left + " " + q.Op.String() + " " + p.query(q.Right, lastColumn(left, indent)+len(q.Op.String())+2)
+}
+
+// stage prints a pipeline stage, with the variables it binds
+func (p *printer) stage(q *gojq.Query, patterns []*gojq.Pattern, indent int) string {
+	s := p.query(q, indent)
+	for i, pat := range patterns {
+		if i == 0 {
+			s += " as "
+		} else {
+			s += " ?// "
+		}
+		s += pat.String()
+	}
+	return s
+}
+
+func (p *printer) term(t *gojq.Term, indent int) string {
+	if flat := t.String(); p.fits(indent, flat) {
+		return flat
+	}
+	base := *t
+	base.SuffixList = nil
+	// The suffixes are printed as gojq does, which knows when .x needs a
+	// space before it
+	suffix := strings.TrimPrefix(t.String(), base.String())
+
+	var s string
+	switch t.Type {
+	case gojq.TermTypeObject:
+		s = p.object(t.Object, indent)
+	case gojq.TermTypeArray:
+		if t.Array.Query == nil {
+			s = "[]"
+		} else {
+			s = "[" + newline(indent+indentWidth) + p.query(t.Array.Query, indent+indentWidth) +
+				newline(indent) + "]"
+		}
+	case gojq.TermTypeFunc:
+		s = p.call(t.Func, indent)
+	case gojq.TermTypeQuery:
+		s = "(" + newline(indent+indentWidth) + p.query(t.Query, indent+indentWidth) +
+			newline(indent) + ")"
+	case gojq.TermTypeUnary:
+		s = t.Unary.Op.String() + p.term(t.Unary.Term, indent+1)
+	case gojq.TermTypeIf:
+		s = p.ifTerm(t.If, indent)
+	case gojq.TermTypeTry:
+		s = "try " + p.query(t.Try.Body, indent)
+		if t.Try.Catch != nil {
+			s += newline(indent) + "catch " + p.query(t.Try.Catch, indent)
+		}
+	case gojq.TermTypeReduce:
+		r := t.Reduce
+		s = p.loop("reduce", r.Query, r.Pattern, []*gojq.Query{r.Start, r.Update}, indent)
+	case gojq.TermTypeForeach:
+		f := t.Foreach
+		args := []*gojq.Query{f.Start, f.Update}
+		if f.Extract != nil {
+			args = append(args, f.Extract)
+		}
+		s = p.loop("foreach", f.Query, f.Pattern, args, indent)
+	case gojq.TermTypeLabel:
+		s = "label " + t.Label.Ident + newline(indent) + "| " + p.query(t.Label.Body, indent+indentWidth)
+	default:
+		// Strings, formats and the like are not broken up
+		return t.String()
+	}
+	return s + suffix
+}
+
+func (p *printer) object(o *gojq.Object, indent int) string {
+	if len(o.KeyVals) == 0 {
+		return "{}"
+	}
+	inner := indent + indentWidth
+	kvs := make([]string, len(o.KeyVals))
+	for i, kv := range o.KeyVals {
+		key := (&gojq.ObjectKeyVal{Key: kv.Key, KeyString: kv.KeyString, KeyQuery: kv.KeyQuery}).String()
+		if kv.Val == nil {
+			kvs[i] = key
+			continue
+		}
+		col := lastColumn(key, inner) + 2
+		val := kv.Val.String()
+		if !p.fits(col, val) {
+			val = p.query(kv.Val, col)
+		}
+		kvs[i] = key + ": " + val
+	}
+	return "{" + newline(inner) + strings.Join(kvs, ","+newline(inner)) + newline(indent) + "}"
+}
+
+func (p *printer) call(f *gojq.Func, indent int) string {
+	if len(f.Args) == 0 {
+		return f.Name
+	}
+	inner := indent + indentWidth
+	args := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		args[i] = p.query(arg, inner)
+	}
+	return f.Name + "(" + newline(inner) + strings.Join(args, ";"+newline(inner)) + newline(indent) + ")"
+}
+
+func (p *printer) ifTerm(e *gojq.If, indent int) string {
+	inner := indent + indentWidth
+	var s strings.Builder
+	s.WriteString("if " + p.query(e.Cond, indent+3) + " then")
+	s.WriteString(newline(inner) + p.query(e.Then, inner))
+	for _, elif := range e.Elif {
+		s.WriteString(newline(indent) + "elif " + p.query(elif.Cond, indent+5) + " then")
+		s.WriteString(newline(inner) + p.query(elif.Then, inner))
+	}
+	if e.Else != nil {
+		s.WriteString(newline(indent) + "else")
+		s.WriteString(newline(inner) + p.query(e.Else, inner))
+	}
+	s.WriteString(newline(indent) + "end")
+	return s.String()
+}
+
+// loop prints reduce and foreach, with a line for each of the start, update
+// and extract queries
+func (p *printer) loop(keyword string, source *gojq.Query, pattern *gojq.Pattern, args []*gojq.Query, indent int) string {
+	inner := indent + indentWidth
+	head := keyword + " " + p.query(source, indent+len(keyword)+1) + " as " + pattern.String() + " ("
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = p.query(arg, inner)
+	}
+	return head + newline(inner) + strings.Join(parts, ";"+newline(inner)) + newline(indent) + ")"
+}
+
+// lastColumn is the column where s ends when it starts at column col
+func lastColumn(s string, col int) int {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return utf8.RuneCountInString(s[i+1:])
+	}
+	return col + utf8.RuneCountInString(s)
+}
+
+// HasComments reports whether src, the source of a query, has comments.
+// gojq drops them while parsing, so Format would too
+func HasComments(src string) bool {
+	// depth counts the string interpolations entered, and parens the
+	// parentheses open in each
+	var depth int
+	var parens []int
+	inString := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if inString {
+			switch c {
+			case '\\':
+				if i+1 < len(src) && src[i+1] == '(' {
+					depth++
+					parens = append(parens, 0)
+					inString = false
+				}
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '#':
+			return true
+		case '(':
+			if depth > 0 {
+				parens[depth-1]++
+			}
+		case ')':
+			if depth > 0 {
+				if parens[depth-1] == 0 {
+					// The end of an interpolation, back in its string
+					depth--
+					parens = parens[:depth]
+					inString = true
+				} else {
+					parens[depth-1]--
+				}
+			}
+		}
+	}
+	return false
+}
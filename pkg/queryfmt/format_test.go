@@ -0,0 +1,127 @@
+package queryfmt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		query string
+		width int
+		want  string
+	}{
+		{`.a|.b`, 0, `.a | .b`},
+		{`{a:1,b:[.c[]|.d]}`, 0, `{ a: 1, b: [.c[] | .d] }`},
+		{
+			`.items[] | select(.severity == "high") | {id, url: ("https://example.com/" + .id)} | @json`,
+			40,
+			`.items[]
+| select(.severity == "high")
+| {
+    id,
+    url: ("https://example.com/" + .id)
+  }
+| @json`,
+		},
+		{
+			`def f(g): g | md5 | ._val; .files[] | f(.content) as $h | if $h == "x" then "same file" elif $h == "y" then "other" else empty end`,
+			40,
+			`def f(g): g | md5 | ._val;
+.files[]
+| f(.content) as $h
+| if $h == "x" then
+    "same file"
+  elif $h == "y" then
+    "other"
+  else
+    empty
+  end`,
+		},
+		{
+			`reduce .events[] as $e ({}; .[$e.kind] += 1) | sub("something long"; "something else"; "g")`,
+			40,
+			`reduce .events[] as $e (
+  {};
+  .[$e.kind] += 1
+)
+| sub(
+    "something long";
+    "something else";
+    "g"
+  )`,
+		},
+		{
+			`.a, .b, .c | try error("a message long enough to wrap") catch .`,
+			30,
+			`.a, .b, .c
+| try error(
+    "a message long enough to wrap"
+  )
+  catch .`,
+		},
+	}
+	for _, tt := range tests {
+		query, err := gojq.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got := Format(query, tt.width); got != tt.want {
+			t.Errorf("Format(%s, %d) =\n%s\nwant\n%s", tt.query, tt.width, got, tt.want)
+		}
+	}
+}
+
+// TestFormatCorpus checks that formatting does not change what the queries
+// of the graph corpus mean, and that formatted queries stay as they are
+func TestFormatCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "graph", "testdata", "queries", "*.jq"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no queries to format: %v", err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query, err := gojq.Parse(string(src))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		for _, width := range []int{20, 80} {
+			got := Format(query, width)
+			again, err := gojq.Parse(got)
+			if err != nil {
+				t.Errorf("%s: formatted query does not parse: %v\n%s", file, err, got)
+				continue
+			}
+			if again.String() != query.String() {
+				t.Errorf("%s: formatting changed the query:\n%s\nto\n%s", file, query, again)
+			}
+			if twice := Format(again, width); twice != got {
+				t.Errorf("%s: formatting again changed the query:\n%s\nto\n%s", file, got, twice)
+			}
+		}
+	}
+}
+
+func TestHasComments(t *testing.T) {
+	for src, want := range map[string]bool{
+		`.a | .b`:                   false,
+		"# the name\n.name":         true,
+		`.a # the a`:                true,
+		`"#hashtag"`:                false,
+		`"\"#"`:                     false,
+		`"\(.a | "#")" | .b`:        false,
+		`"\((.a) + "x") # comment"`: false,
+		`"\((.a) + "x")" # comment`: true,
+	} {
+		if got := HasComments(src); got != want {
+			t.Errorf("HasComments(%s) = %v, want %v", strings.ReplaceAll(src, "\n", `\n`), got, want)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/linkedin/goavro/v2"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// containerMagic starts every Avro object container file
+var containerMagic = []byte("Obj\x01")
+
+// Options are the settings accepted by avro_decode and avro_encode
+type Options struct {
+	File      bool   // decode: the data argument is a file path
+	Encoding  string // "raw" (default), "base64", or "hex" for the binary side
+	Confluent bool   // decode: strip the Confluent Schema Registry header
+	SchemaID  int    // encode: prepend a Confluent header with this id, -1 for none
+	Container bool   // encode: write an object container file from an array
+	Codec     string // encode: container compression ("null", "deflate", "snappy")
+}
+
+func parseOptions(v any) (Options, error) {
+	opts := Options{SchemaID: -1}
+	v = common.ExtractUDFValue(v)
+	if v == nil {
+		return opts, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return opts, common.Errorf(common.CodeInvalid, "options must be an object, got %T", v)
+	}
+	for key, dst := range map[string]*bool{"file": &opts.File, "confluent": &opts.Confluent, "container": &opts.Container} {
+		if raw, ok := m[key]; ok && raw != nil {
+			b, ok := raw.(bool)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.%v must be a boolean, got %T", key, raw)
+			}
+			*dst = b
+		}
+	}
+	for key, dst := range map[string]*string{"encoding": &opts.Encoding, "codec": &opts.Codec} {
+		if raw, ok := m[key]; ok && raw != nil {
+			s, ok := raw.(string)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.%v must be a string, got %T", key, raw)
+			}
+			*dst = s
+		}
+	}
+	switch opts.Encoding {
+	case "", "raw", "base64", "hex":
+	default:
+		return opts, common.Errorf(common.CodeInvalid, "unsupported encoding %q (supported: raw, base64, hex)", opts.Encoding)
+	}
+	if raw, ok := m["schema_id"]; ok && raw != nil {
+		var id int
+		switch n := raw.(type) {
+		case int:
+			id = n
+		case float64:
+			if n != math.Trunc(n) {
+				return opts, common.Errorf(common.CodeInvalid, "options.schema_id must be an integer, got %v", n)
+			}
+			id = int(n)
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "options.schema_id must be a number, got %T", raw)
+		}
+		if id < 0 || id > math.MaxUint32 {
+			return opts, common.Errorf(common.CodeInvalid, "options.schema_id out of range: %d", id)
+		}
+		opts.SchemaID = id
+	}
+	return opts, nil
+}
+
+// schemaText returns the JSON text of a schema given as a JSON string, a
+// parsed object or array, or a bare primitive type name such as "string"
+func schemaText(v any) (string, error) {
+	switch s := common.ExtractUDFValue(v).(type) {
+	case string:
+		trimmed := strings.TrimSpace(s)
+		if trimmed == "" {
+			return "", common.Errorf(common.CodeInvalid, "schema must not be empty")
+		}
+		switch trimmed[0] {
+		case '{', '[', '"':
+			return trimmed, nil
+		}
+		quoted, _ := json.Marshal(trimmed)
+		return string(quoted), nil
+	case map[string]any, []any:
+		b, err := json.Marshal(s)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", common.Errorf(common.CodeInvalid, "schema must be a JSON string or object, got %T", s)
+	}
+}
+
+// newCodec compiles a schema. Unions use the standard JSON form, so a
+// ["null", "string"] field is just "text" or null rather than {"string": "text"}
+func newCodec(schema string) (*goavro.Codec, error) {
+	codec, err := goavro.NewCodecForStandardJSONFull(schema)
+	if err != nil {
+		return nil, common.Errorf(common.CodeInvalid, "invalid schema: %w", err)
+	}
+	return codec, nil
+}
+
+// toJSON converts a native datum into plain JSON values via the codec's
+// textual form, keeping integers as ints
+func toJSON(codec *goavro.Codec, datum any) (any, error) {
+	text, err := codec.TextualFromNative(nil, datum)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	var out any
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return fromJSONNumbers(out), nil
+}
+
+// fromJSON converts a jq value into the codec's native form
+func fromJSON(codec *goavro.Codec, v any) (any, error) {
+	text, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := codec.NativeFromTextual(text)
+	return native, err
+}
+
+// fromJSONNumbers converts json.Number values into ints or floats
+func fromJSONNumbers(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = fromJSONNumbers(item)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = fromJSONNumbers(item)
+		}
+		return val
+	case json.Number:
+		if n, err := val.Int64(); err == nil && int64(int(n)) == n {
+			return int(n)
+		}
+		f, _ := val.Float64()
+		return f
+	default:
+		return val
+	}
+}
+
+func decodeBinaryInput(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "base64":
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	case "hex":
+		return hex.DecodeString(strings.TrimSpace(string(data)))
+	default:
+		return data, nil
+	}
+}
+
+func encodeBinaryOutput(data []byte, encoding string) string {
+	switch encoding {
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data)
+	case "hex":
+		return hex.EncodeToString(data)
+	default:
+		return string(data)
+	}
+}
+
+// DecodeContainer reads every record of an object container file
+func DecodeContainer(data []byte) ([]any, *goavro.OCFReader, error) {
+	r, err := goavro.NewOCFReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, common.Errorf(common.CodeInvalid, "invalid container file: %w", err)
+	}
+	// Re-compile the writer schema so records come back in standard JSON form
+	codec, err := newCodec(r.Codec().Schema())
+	if err != nil {
+		return nil, nil, err
+	}
+	records := []any{}
+	for r.Scan() {
+		datum, err := r.Read()
+		if err != nil {
+			return nil, nil, fmt.Errorf("record %d: %w", len(records), err)
+		}
+		record, err := toJSON(codec, datum)
+		if err != nil {
+			return nil, nil, fmt.Errorf("record %d: %w", len(records), err)
+		}
+		records = append(records, record)
+	}
+	if err := r.Err(); err != nil {
+		return nil, nil, err
+	}
+	return records, r, nil
+}
+
+// RegisterAvroDecode registers the avro_decode function with gojq
+func RegisterAvroDecode() gojq.CompilerOption {
+	return common.WithFunction("avro_decode", 1, 3, func(v any, args []any) any {
+		// avro_decode(schema), avro_decode(schema; data),
+		// or avro_decode(schema; data; options)
+		dataVal := v
+		if len(args) >= 2 {
+			dataVal = args[1]
+		}
+		opts := Options{SchemaID: -1}
+		if len(args) == 3 {
+			var err error
+			if opts, err = parseOptions(args[2]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("avro_decode: %w", err), nil)
+			}
+		}
+		dataVal = common.ExtractUDFValue(dataVal)
+
+		meta := map[string]any{
+			"operation": "avro_decode",
+		}
+
+		var data []byte
+		if opts.File {
+			filePathStr, ok := dataVal.(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "avro_decode: file argument requires string path, got %T", dataVal), nil)
+			}
+			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("avro_decode: %w", err), meta)
+			}
+			data = fileData
+			meta["file_path"] = absPath
+			meta["file_size"] = int(size)
+		} else {
+			switch val := dataVal.(type) {
+			case string:
+				data = []byte(val)
+			case []byte:
+				data = val
+			default:
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "avro_decode: data must be a string or bytes, got %T", val), nil)
+			}
+		}
+
+		data, err := decodeBinaryInput(data, opts.Encoding)
+		if err != nil {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "avro_decode: invalid %v input: %w", opts.Encoding, err), meta)
+		}
+
+		// Container files carry their own schema, so the schema argument may be null
+		if bytes.HasPrefix(data, containerMagic) {
+			records, r, err := DecodeContainer(data)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("avro_decode: %w", err), meta)
+			}
+			meta["container"] = true
+			meta["codec"] = r.CompressionName()
+			meta["count"] = len(records)
+			meta["schema"] = r.Codec().Schema()
+			return common.MakeUDFSuccessResult(records, meta)
+		}
+
+		if common.ExtractUDFValue(args[0]) == nil {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "avro_decode: schema is required unless the data is a container file"), meta)
+		}
+		schema, err := schemaText(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("avro_decode: %w", err), meta)
+		}
+		codec, err := newCodec(schema)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("avro_decode: %w", err), meta)
+		}
+
+		if opts.Confluent {
+			if len(data) < 5 || data[0] != 0 {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "avro_decode: missing Confluent header (magic byte 0 and 4-byte schema id)"), meta)
+			}
+			meta["schema_id"] = int(binary.BigEndian.Uint32(data[1:5]))
+			data = data[5:]
+		}
+
+		datum, rest, err := codec.NativeFromBinary(data)
+		if err != nil {
+			if errors.Is(err, io.ErrShortBuffer) {
+				err = common.Errorf(common.CodeInvalid, "data ends before the datum is complete")
+			}
+			return common.MakeUDFErrorResult(fmt.Errorf("avro_decode: %w", err), meta)
+		}
+		if len(rest) != 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "avro_decode: %d trailing bytes after datum", len(rest)), meta)
+		}
+		result, err := toJSON(codec, datum)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("avro_decode: %w", err), meta)
+		}
+		meta["input_length"] = len(data)
+		return common.MakeUDFSuccessResult(result, meta)
+	})
+}
+
+// RegisterAvroEncode registers the avro_encode function with gojq
+func RegisterAvroEncode() gojq.CompilerOption {
+	return common.WithFunction("avro_encode", 1, 3, func(v any, args []any) any {
+		// avro_encode(schema), avro_encode(schema; value),
+		// or avro_encode(schema; value; options)
+		value := v
+		if len(args) >= 2 {
+			value = args[1]
+		}
+		opts := Options{SchemaID: -1}
+		if len(args) == 3 {
+			var err error
+			if opts, err = parseOptions(args[2]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("avro_encode: %w", err), nil)
+			}
+		}
+		value = common.ExtractUDFValue(value)
+
+		meta := map[string]any{
+			"operation": "avro_encode",
+		}
+
+		schema, err := schemaText(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("avro_encode: %w", err), meta)
+		}
+		codec, err := newCodec(schema)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("avro_encode: %w", err), meta)
+		}
+
+		var out []byte
+		if opts.Container {
+			records, ok := value.([]any)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "avro_encode: container input must be an array of records, got %T", value), meta)
+			}
+			var buf bytes.Buffer
+			w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buf, Codec: codec, CompressionName: opts.Codec})
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("avro_encode: %w", err), meta)
+			}
+			natives := make([]any, len(records))
+			for i, record := range records {
+				if natives[i], err = fromJSON(codec, record); err != nil {
+					return common.MakeUDFErrorResult(fmt.Errorf("avro_encode: record %d: %w", i, err), meta)
+				}
+			}
+			if err := w.Append(natives); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("avro_encode: %w", err), meta)
+			}
+			out = buf.Bytes()
+			meta["container"] = true
+			meta["codec"] = w.CompressionName()
+			meta["count"] = len(records)
+		} else {
+			native, err := fromJSON(codec, value)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("avro_encode: %w", err), meta)
+			}
+			if opts.SchemaID >= 0 {
+				out = append([]byte{0}, binary.BigEndian.AppendUint32(nil, uint32(opts.SchemaID))...)
+				meta["schema_id"] = opts.SchemaID
+			}
+			if out, err = codec.BinaryFromNative(out, native); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("avro_encode: %w", err), meta)
+			}
+		}
+
+		meta["output_length"] = len(out)
+		return common.MakeUDFSuccessResult(encodeBinaryOutput(out, opts.Encoding), meta)
+	})
+}
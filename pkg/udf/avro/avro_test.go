@@ -0,0 +1,186 @@
+package avro
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+const userSchema = `{
+  "type": "record",
+  "name": "User",
+  "namespace": "demo",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "name", "type": "string"},
+    {"name": "email", "type": ["null", "string"], "default": null},
+    {"name": "roles", "type": {"type": "array", "items": "string"}},
+    {"name": "score", "type": "double"}
+  ]
+}`
+
+func TestAvroDecode(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterAvroDecode()}
+
+	// id=1 (zigzag 02), name="ada", email=null (union index 0),
+	// roles=["x"], score=1.5
+	payload := "\x02\x06ada\x00\x02\x02x\x00\x00\x00\x00\x00\x00\x00\xf8\x3f"
+	result := runGojqQuery(t, `avro_decode(`+jqString(userSchema)+`)`, payload, opts...)
+	got := result.(map[string]any)
+	want := map[string]any{"id": 1, "name": "ada", "email": nil, "roles": []any{"x"}, "score": 1.5}
+	if !reflect.DeepEqual(got["_val"], want) {
+		t.Errorf("Decode mismatch:\n got: %v\nwant: %v", got["_val"], want)
+	}
+	if got["_meta"].(map[string]any)["input_length"] != len(payload) {
+		t.Errorf("Unexpected metadata %v", got["_meta"])
+	}
+
+	// The data can also be passed as an argument, e.g. from base64_decode
+	result = runGojqQuery(t, `avro_decode("string"; "BGhp"; {encoding: "base64"}) | ._val`, nil, opts...)
+	if result != "hi" {
+		t.Errorf("Expected hi, got %v", result)
+	}
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterAvroDecode(), RegisterAvroEncode()}
+	user := map[string]any{"id": 7, "name": "ada", "email": "ada@example.com", "roles": []any{"admin", "dev"}, "score": 1.5}
+
+	result := runGojqQuery(t, `avro_encode(`+jqString(userSchema)+`) | avro_decode(`+jqString(userSchema)+`)`, user, opts...)
+	got := result.(map[string]any)
+	if !reflect.DeepEqual(got["_val"], user) {
+		t.Errorf("Round trip mismatch:\n got: %v\nwant: %v", got["_val"], user)
+	}
+	if got["_meta"].(map[string]any)["operation"] != "avro_decode" {
+		t.Errorf("Unexpected metadata %v", got["_meta"])
+	}
+
+	// Null union branch and schema given as a parsed object
+	result = runGojqQuery(t, `(`+userSchema+`) as $s | {id: 1, name: "b", email: null, roles: [], score: 0} | avro_encode($s; .; {encoding: "hex"}) | ._val`, nil, opts...)
+	if result != "02026200000000000000000000" {
+		t.Errorf("Unexpected hex encoding %v", result)
+	}
+
+	// Primitive schemas may be given by bare type name
+	result = runGojqQuery(t, `avro_encode("long"; 150) | avro_decode("long") | ._val`, nil, opts...)
+	if result != 150 {
+		t.Errorf("Expected 150, got %v", result)
+	}
+}
+
+func TestAvroConfluent(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterAvroDecode(), RegisterAvroEncode()}
+
+	result := runGojqQuery(t, `avro_encode("string"; "hi"; {schema_id: 42, encoding: "base64"}) | ._val`, nil, opts...)
+	if result != "AAAAACoEaGk=" {
+		t.Fatalf("Unexpected Confluent framing %v", result)
+	}
+
+	result = runGojqQuery(t, `avro_decode("string"; "AAAAACoEaGk="; {confluent: true, encoding: "base64"})`, nil, opts...)
+	got := result.(map[string]any)
+	if got["_val"] != "hi" || got["_meta"].(map[string]any)["schema_id"] != 42 {
+		t.Errorf("Unexpected Confluent decode %v", result)
+	}
+
+	result = runGojqQuery(t, `avro_decode("string"; "x"; {confluent: true})`, nil, opts...)
+	errStr := common.GetUDFError(result)
+	if !strings.Contains(errStr, "missing Confluent header") {
+		t.Errorf("Expected header error, got %v", result)
+	}
+}
+
+func TestAvroContainer(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterAvroDecode(), RegisterAvroEncode()}
+	users := []any{
+		map[string]any{"id": 1, "name": "a", "email": nil, "roles": []any{}, "score": 0.5},
+		map[string]any{"id": 2, "name": "b", "email": "b@example.com", "roles": []any{"x"}, "score": 2.5},
+	}
+
+	for _, codec := range []string{"null", "deflate", "snappy"} {
+		result := runGojqQuery(t, `avro_encode(`+jqString(userSchema)+`; .; {container: true, codec: "`+codec+`"})`, users, opts...)
+		encoded := result.(map[string]any)
+		if meta := encoded["_meta"].(map[string]any); meta["count"] != 2 || meta["codec"] != codec {
+			t.Errorf("%s: unexpected encode metadata %v", codec, meta)
+		}
+
+		// The schema comes from the container header
+		path := filepath.Join(t.TempDir(), "users.avro")
+		if err := os.WriteFile(path, []byte(encoded["_val"].(string)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result = runGojqQuery(t, `avro_decode(null; "`+path+`"; {file: true})`, nil, opts...)
+		decoded := result.(map[string]any)
+		if !reflect.DeepEqual(decoded["_val"], users) {
+			t.Errorf("%s: container mismatch:\n got: %v\nwant: %v", codec, decoded["_val"], users)
+		}
+		meta := decoded["_meta"].(map[string]any)
+		if meta["container"] != true || meta["count"] != 2 || meta["file_path"] == nil {
+			t.Errorf("%s: unexpected decode metadata %v", codec, meta)
+		}
+	}
+}
+
+func TestAvroErrors(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterAvroDecode(), RegisterAvroEncode()}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`avro_decode(null; "\u0002")`, "avro_decode: schema is required"},
+		{`avro_decode("{\"type\": \"nope\"}"; "")`, "avro_decode: invalid schema"},
+		{`avro_decode("long"; "\u0002\u0002")`, "avro_decode: 1 trailing bytes"},
+		{`avro_decode("string"; "\u0008ab")`, "avro_decode: "},
+		{`avro_decode("long"; 5)`, "data must be a string"},
+		{`avro_decode("long"; "AA"; {encoding: "rot13"})`, "unsupported encoding"},
+		{`avro_encode("long"; "seven")`, "avro_encode: "},
+		{`avro_encode("long"; 1; {container: true})`, "must be an array of records"},
+		{`avro_encode("long"; 1; {schema_id: -1})`, "out of range"},
+		{`avro_encode(5; 1)`, "schema must be a JSON string or object"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, nil, opts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.Contains(errStr, tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
+
+// jqString quotes s as a jq string literal
+func jqString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
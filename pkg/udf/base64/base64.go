@@ -10,10 +10,10 @@ import (
 
 // RegisterBase64Encode registers the base64_encode function with gojq
 func RegisterBase64Encode() gojq.CompilerOption {
-	return gojq.WithFunction("base64_encode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("base64_encode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("base64_encode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("base64_encode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -25,7 +25,7 @@ func RegisterBase64Encode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("base64_encode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "base64_encode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -33,25 +33,18 @@ func RegisterBase64Encode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "base64_encode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("base64_encode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("base64_encode: %w", err), meta)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("base64_encode: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("base64_encode: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		encoded := base64.StdEncoding.EncodeToString(inputBytes)
@@ -73,10 +66,10 @@ func RegisterBase64Encode() gojq.CompilerOption {
 
 // RegisterBase64Decode registers the base64_decode function with gojq
 func RegisterBase64Decode() gojq.CompilerOption {
-	return gojq.WithFunction("base64_decode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("base64_decode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("base64_decode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("base64_decode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -88,7 +81,7 @@ func RegisterBase64Decode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("base64_decode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "base64_decode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -96,7 +89,7 @@ func RegisterBase64Decode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "base64_decode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("base64_decode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("base64_decode: %w", err), meta)
 			}
 
 			input = string(fileData)
@@ -112,7 +105,7 @@ func RegisterBase64Decode() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("base64_decode: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "base64_decode: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -129,7 +122,7 @@ func RegisterBase64Decode() gojq.CompilerOption {
 			} else {
 				meta["original_length"] = len(input)
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("base64_decode: invalid base64 string: %v", err), meta)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "base64_decode: invalid base64 string: %w", err), meta)
 		}
 
 		meta := map[string]any{
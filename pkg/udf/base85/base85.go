@@ -10,10 +10,10 @@ import (
 
 // RegisterBase85Encode registers the base85_encode function with gojq
 func RegisterBase85Encode() gojq.CompilerOption {
-	return gojq.WithFunction("base85_encode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("base85_encode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("base85_encode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("base85_encode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -25,7 +25,7 @@ func RegisterBase85Encode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("base85_encode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "base85_encode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -33,25 +33,18 @@ func RegisterBase85Encode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "base85_encode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("base85_encode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("base85_encode: %w", err), meta)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("base85_encode: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("base85_encode: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		// Encode to base85
@@ -78,10 +71,10 @@ func RegisterBase85Encode() gojq.CompilerOption {
 
 // RegisterBase85Decode registers the base85_decode function with gojq
 func RegisterBase85Decode() gojq.CompilerOption {
-	return gojq.WithFunction("base85_decode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("base85_decode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("base85_decode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("base85_decode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -93,7 +86,7 @@ func RegisterBase85Decode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("base85_decode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "base85_decode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -101,25 +94,18 @@ func RegisterBase85Decode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "base85_decode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("base85_decode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("base85_decode: %w", err), meta)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("base85_decode: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("base85_decode: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		// Decode from base85
@@ -136,7 +122,7 @@ func RegisterBase85Decode() gojq.CompilerOption {
 			} else {
 				meta["original_length"] = len(inputBytes)
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("base85_decode: invalid base85 string: %v", err), meta)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "base85_decode: invalid base85 string: %w", err), meta)
 		}
 		decoded = decoded[:n]
 
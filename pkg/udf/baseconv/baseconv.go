@@ -0,0 +1,124 @@
+package baseconv
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// prefixes are the base prefixes accepted on input, and stripped when they
+// match the base being converted from
+var prefixes = map[int]string{2: "0b", 8: "0o", 16: "0x"}
+
+// Parse parses s in base, 2 to 62. Digits are 0-9, then a-z, then A-Z;
+// up to base 36 letters are case-insensitive. Base 0 detects the base from
+// a 0x, 0b, 0o or 0 prefix and defaults to 10. It returns the number and
+// the base used
+func Parse(s string, base int) (*big.Int, int, error) {
+	s = strings.TrimSpace(s)
+	digits, sign := s, ""
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		sign, digits = digits[:1], digits[1:]
+	}
+	if base == 0 {
+		base = 10
+		lower := strings.ToLower(digits)
+		for b, prefix := range prefixes {
+			if strings.HasPrefix(lower, prefix) && len(digits) > 2 {
+				base, digits = b, digits[2:]
+			}
+		}
+		if base == 10 && len(digits) > 1 && digits[0] == '0' {
+			base = 8
+		}
+	} else if prefix, ok := prefixes[base]; ok && len(digits) > 2 && strings.EqualFold(digits[:2], prefix) {
+		digits = digits[2:]
+	}
+	if digits == "" {
+		return nil, base, common.Errorf(common.CodeInvalid, "empty number")
+	}
+	n, ok := new(big.Int).SetString(sign+digits, base)
+	if !ok {
+		return nil, base, common.Errorf(common.CodeInvalid, "invalid base %d number %q", base, s)
+	}
+	return n, base, nil
+}
+
+// baseArg reads a base argument; allowZero permits 0 for detection
+func baseArg(name string, raw any, allowZero bool) (int, error) {
+	var base int
+	switch val := common.ExtractUDFValue(raw).(type) {
+	case int:
+		base = val
+	case float64:
+		if val != math.Trunc(val) || math.Abs(val) > 1e9 {
+			return 0, common.Errorf(common.CodeInvalid, "%v must be an integer, got %v", name, val)
+		}
+		base = int(val)
+	default:
+		return 0, common.Errorf(common.CodeInvalid, "%v must be a number, got %T", name, val)
+	}
+	if (base == 0 && allowZero) || (base >= 2 && base <= 62) {
+		return base, nil
+	}
+	if allowZero {
+		return 0, common.Errorf(common.CodeInvalid, "%v must be 0 or from 2 to 62, got %d", name, base)
+	}
+	return 0, common.Errorf(common.CodeInvalid, "%v must be from 2 to 62, got %d", name, base)
+}
+
+// RegisterBaseConvert registers the base_convert function with gojq
+func RegisterBaseConvert() gojq.CompilerOption {
+	return common.WithFunction("base_convert", 2, 3, func(v any, args []any) any {
+		// base_convert(from; to) converts the input, base_convert(value;
+		// from; to) its first argument
+		value := v
+		if len(args) == 3 {
+			value, args = args[0], args[1:]
+		}
+		from, err := baseArg("from", args[0], true)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("base_convert: %w", err), nil)
+		}
+		to, err := baseArg("to", args[1], false)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("base_convert: %w", err), nil)
+		}
+
+		var n *big.Int
+		switch val := common.ExtractUDFValue(value).(type) {
+		case string:
+			if n, from, err = Parse(val, from); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("base_convert: %w", err), nil)
+			}
+		case int, float64, *big.Int:
+			// Numbers are decimal whatever from says
+			switch num := val.(type) {
+			case int:
+				n = big.NewInt(int64(num))
+			case float64:
+				if num != math.Trunc(num) || math.IsInf(num, 0) {
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "base_convert: value must be an integer, got %v", num), nil)
+				}
+				n, _ = big.NewFloat(num).Int(nil)
+			case *big.Int:
+				n = num
+			}
+			from = 10
+		default:
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "base_convert: value must be a string or an integer, got %T", val), nil)
+		}
+
+		return common.MakeUDFSuccessResult(n.Text(to), map[string]any{
+			"operation":  "base_convert",
+			"from":       from,
+			"to":         to,
+			"decimal":    n.String(),
+			"bit_length": n.BitLen(),
+		})
+	})
+}
@@ -0,0 +1,103 @@
+package baseconv
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+func TestBaseConvert(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  any
+	}{
+		{`base_convert(16; 10) | ._val`, "ff", "255"},
+		{`base_convert(16; 2) | ._val`, "0xFF", "11111111"},
+		{`base_convert(2; 16) | ._val`, "0b1010", "a"},
+		{`base_convert(10; 36) | ._val`, "1295", "zz"},
+		{`base_convert(36; 10) | ._val`, "ZZ", "1295"},
+		{`base_convert(10; 62) | ._val`, "61", "Z"},
+		{`base_convert(62; 10) | ._val`, "zZ", "2231"},
+		{`base_convert(10; 16) | ._val`, "-255", "-ff"},
+		{`base_convert(0; 10) | ._val`, "0x1f", "31"},
+		{`base_convert(0; 10) | ._val`, "0o17", "15"},
+		{`base_convert(0; 10) | ._val`, "017", "15"},
+		{`base_convert(0; 2) | ._val`, "42", "101010"},
+		{`base_convert(16; 10) | ._val`, "ffffffffffffffffffffffffffffffff", "340282366920938463463374607431768211455"},
+		{`base_convert(10; 16) | ._val`, 3232235777, "c0a80101"},
+		{`base_convert("777"; 8; 10) | ._val`, nil, "511"},
+		{`base_convert(0; 16) | ._meta | [.from, .decimal, .bit_length]`, "0b1111", []any{2, "15", 4}},
+	}
+	for _, tt := range tests {
+		got := runGojqQuery(t, tt.query, tt.input, RegisterBaseConvert())
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s on %v = %v, want %v", tt.query, tt.input, got, tt.want)
+		}
+	}
+
+	// gojq passes integers too large for an int as *big.Int
+	big, _ := new(big.Int).SetString("18446744073709551616", 10)
+	got := runGojqQuery(t, `base_convert(10; 16) | ._val`, big, RegisterBaseConvert())
+	if got != "10000000000000000" {
+		t.Errorf("base_convert of 2^64 = %v", got)
+	}
+}
+
+func TestBaseConvertErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`base_convert(10; 16)`, "12a", `base_convert: invalid base 10 number "12a"`},
+		{`base_convert(2; 10)`, "102", `base_convert: invalid base 2 number "102"`},
+		{`base_convert(16; 10)`, "", "base_convert: empty number"},
+		{`base_convert(1; 10)`, "1", "base_convert: from must be 0 or from 2 to 62, got 1"},
+		{`base_convert(10; 63)`, "1", "base_convert: to must be from 2 to 62, got 63"},
+		{`base_convert(10; 0)`, "1", "base_convert: to must be from 2 to 62, got 0"},
+		{`base_convert(10; 2.5)`, "1", "base_convert: to must be an integer"},
+		{`base_convert("a"; 10)`, "1", "base_convert: from must be a number"},
+		{`base_convert(10; 16)`, 1.5, "base_convert: value must be an integer"},
+		{`base_convert(10; 16)`, true, "base_convert: value must be a string or an integer"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, RegisterBaseConvert())
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
@@ -11,10 +11,10 @@ import (
 
 // RegisterBinaryEncode registers the binary_encode function with gojq
 func RegisterBinaryEncode() gojq.CompilerOption {
-	return gojq.WithFunction("binary_encode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("binary_encode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("binary_encode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("binary_encode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -26,7 +26,7 @@ func RegisterBinaryEncode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("binary_encode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "binary_encode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -34,7 +34,7 @@ func RegisterBinaryEncode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "binary_encode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("binary_encode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("binary_encode: %w", err), meta)
 			}
 
 			inputBytes = fileData
@@ -50,7 +50,7 @@ func RegisterBinaryEncode() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					inputBytes = []byte(str.String())
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("binary_encode: argument must be a string or bytes, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "binary_encode: argument must be a string or bytes, got %T", val), nil)
 				}
 			}
 		}
@@ -78,10 +78,10 @@ func RegisterBinaryEncode() gojq.CompilerOption {
 
 // RegisterBinaryDecode registers the binary_decode function with gojq
 func RegisterBinaryDecode() gojq.CompilerOption {
-	return gojq.WithFunction("binary_decode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("binary_decode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("binary_decode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("binary_decode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -93,7 +93,7 @@ func RegisterBinaryDecode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("binary_decode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "binary_decode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -101,7 +101,7 @@ func RegisterBinaryDecode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "binary_decode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("binary_decode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("binary_decode: %w", err), meta)
 			}
 
 			input = string(fileData)
@@ -117,7 +117,7 @@ func RegisterBinaryDecode() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("binary_decode: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "binary_decode: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -138,7 +138,7 @@ func RegisterBinaryDecode() gojq.CompilerOption {
 					} else {
 						meta["original_length"] = len(input)
 					}
-					return common.MakeUDFErrorResult(fmt.Errorf("binary_decode: each binary byte must be 8 bits, got %d bits in %q", len(part), part), meta)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "binary_decode: each binary byte must be 8 bits, got %d bits in %q", len(part), part), meta)
 				}
 				val, err := strconv.ParseUint(part, 2, 8)
 				if err != nil {
@@ -151,7 +151,7 @@ func RegisterBinaryDecode() gojq.CompilerOption {
 					} else {
 						meta["original_length"] = len(input)
 					}
-					return common.MakeUDFErrorResult(fmt.Errorf("binary_decode: invalid binary string %q: %v", part, err), meta)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "binary_decode: invalid binary string %q: %w", part, err), meta)
 				}
 				decoded = append(decoded, byte(val))
 			}
@@ -167,7 +167,7 @@ func RegisterBinaryDecode() gojq.CompilerOption {
 				} else {
 					meta["original_length"] = len(input)
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("binary_decode: binary string length must be multiple of 8, got %d", len(binaryStr)), meta)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "binary_decode: binary string length must be multiple of 8, got %d", len(binaryStr)), meta)
 			}
 			for i := 0; i < len(binaryStr); i += 8 {
 				part := binaryStr[i : i+8]
@@ -182,7 +182,7 @@ func RegisterBinaryDecode() gojq.CompilerOption {
 					} else {
 						meta["original_length"] = len(input)
 					}
-					return common.MakeUDFErrorResult(fmt.Errorf("binary_decode: invalid binary string %q: %v", part, err), meta)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "binary_decode: invalid binary string %q: %w", part, err), meta)
 				}
 				decoded = append(decoded, byte(val))
 			}
@@ -0,0 +1,236 @@
+package bitwise
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// maxShift bounds shift amounts and widths, so a typo cannot allocate an
+// enormous number
+const maxShift = 65536
+
+// Operand is a parsed input to a bitwise operation, with the form it was
+// written in so the result can be written the same way
+type Operand struct {
+	N      *big.Int
+	Base   int    // 0 for a number, 16 or 2 for a string
+	Prefix string // "0x", "0b" or ""
+	Digits int    // digits in the string, kept as the minimum width
+}
+
+// ParseOperand reads a number, or a string of hex digits with an optional
+// 0x prefix, or of binary digits with a 0b prefix
+func ParseOperand(v any) (Operand, error) {
+	switch val := common.ExtractUDFValue(v).(type) {
+	case int:
+		return Operand{N: big.NewInt(int64(val))}, nil
+	case float64:
+		if val != math.Trunc(val) || math.IsInf(val, 0) {
+			return Operand{}, common.Errorf(common.CodeInvalid, "%v is not an integer", val)
+		}
+		n, _ := big.NewFloat(val).Int(nil)
+		return Operand{N: n}, nil
+	case *big.Int:
+		return Operand{N: val}, nil
+	case string:
+		s := strings.ReplaceAll(strings.TrimSpace(val), "_", "")
+		op := Operand{Base: 16}
+		switch lower := strings.ToLower(s); {
+		case strings.HasPrefix(lower, "0x"):
+			op.Prefix, s = s[:2], s[2:]
+		case strings.HasPrefix(lower, "0b"):
+			op.Base, op.Prefix, s = 2, s[:2], s[2:]
+		}
+		n, ok := new(big.Int).SetString(s, op.Base)
+		if !ok || s == "" || strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+			return Operand{}, common.Errorf(common.CodeInvalid, "invalid %v string %q", map[int]string{16: "hex", 2: "binary"}[op.Base], val)
+		}
+		op.N, op.Digits = n, len(s)
+		return op, nil
+	default:
+		return Operand{}, common.Errorf(common.CodeInvalid, "operand must be a number or a hex string, got %T", val)
+	}
+}
+
+// Width is the bit width of a string operand, from its digits
+func (o Operand) Width() int {
+	switch o.Base {
+	case 16:
+		return o.Digits * 4
+	case 2:
+		return o.Digits
+	}
+	return 0
+}
+
+// Format writes n in the form of o
+func (o Operand) Format(n *big.Int) (any, error) {
+	if o.Base == 0 {
+		if n.IsInt64() && n.Int64() >= math.MinInt && n.Int64() <= math.MaxInt {
+			return int(n.Int64()), nil
+		}
+		return n, nil
+	}
+	if n.Sign() < 0 {
+		return nil, common.Errorf(common.CodeInvalid, "result %v is negative and cannot be written as a hex string", n)
+	}
+	s := n.Text(o.Base)
+	if len(s) < o.Digits {
+		s = strings.Repeat("0", o.Digits-len(s)) + s
+	}
+	return o.Prefix + s, nil
+}
+
+// amountArg reads a shift amount or width
+func amountArg(name string, raw any) (int, error) {
+	var n int
+	switch val := common.ExtractUDFValue(raw).(type) {
+	case int:
+		n = val
+	case float64:
+		if val != math.Trunc(val) || math.Abs(val) > maxShift+1 {
+			return 0, common.Errorf(common.CodeInvalid, "%v must be an integer, got %v", name, val)
+		}
+		n = int(val)
+	default:
+		return 0, common.Errorf(common.CodeInvalid, "%v must be a number, got %T", name, val)
+	}
+	if n < 0 || n > maxShift {
+		return 0, common.Errorf(common.CodeInvalid, "%v must be from 0 to %d, got %d", name, maxShift, n)
+	}
+	return n, nil
+}
+
+// result builds the envelope of an operation on in
+func result(name string, in Operand, n *big.Int) any {
+	val, err := in.Format(n)
+	if err != nil {
+		return common.MakeUDFErrorResult(fmt.Errorf("%v: %w", name, err), nil)
+	}
+	meta := map[string]any{
+		"operation":  name,
+		"decimal":    n.String(),
+		"bit_length": n.BitLen(),
+	}
+	if n.Sign() >= 0 {
+		meta["hex"] = "0x" + n.Text(16)
+	}
+	return common.MakeUDFSuccessResult(val, meta)
+}
+
+// registerBinary registers an operation on the input and one operand
+func registerBinary(name string, op func(z, x, y *big.Int) *big.Int) gojq.CompilerOption {
+	return common.WithFunction(name, 1, 1, func(v any, args []any) any {
+		in, err := ParseOperand(v)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("%v: input: %w", name, err), nil)
+		}
+		arg, err := ParseOperand(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("%v: argument: %w", name, err), nil)
+		}
+		return result(name, in, op(new(big.Int), in.N, arg.N))
+	})
+}
+
+// RegisterBand registers the band function with gojq
+func RegisterBand() gojq.CompilerOption {
+	return registerBinary("band", (*big.Int).And)
+}
+
+// RegisterBor registers the bor function with gojq
+func RegisterBor() gojq.CompilerOption {
+	return registerBinary("bor", (*big.Int).Or)
+}
+
+// RegisterBxor registers the bxor function with gojq
+func RegisterBxor() gojq.CompilerOption {
+	return registerBinary("bxor", (*big.Int).Xor)
+}
+
+// RegisterBnot registers the bnot function with gojq
+func RegisterBnot() gojq.CompilerOption {
+	return common.WithFunction("bnot", 0, 1, func(v any, args []any) any {
+		// bnot(width) flips the low width bits. Without it, strings flip
+		// the bits of their digits and numbers give -(n+1), like ~ in C
+		in, err := ParseOperand(v)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("bnot: input: %w", err), nil)
+		}
+		width := in.Width()
+		if len(args) > 0 {
+			if width, err = amountArg("width", args[0]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("bnot: %w", err), nil)
+			}
+			if width == 0 {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "bnot: width must be from 1 to %d, got 0", maxShift), nil)
+			}
+		}
+		if width == 0 {
+			return result("bnot", in, new(big.Int).Not(in.N))
+		}
+		if in.N.Sign() < 0 || in.N.BitLen() > width {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "bnot: %v does not fit in %d bits", in.N, width), nil)
+		}
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(width)), big.NewInt(1))
+		return result("bnot", in, new(big.Int).Xor(in.N, mask))
+	})
+}
+
+// RegisterShl registers the shl function with gojq
+func RegisterShl() gojq.CompilerOption {
+	return common.WithFunction("shl", 1, 1, func(v any, args []any) any {
+		in, err := ParseOperand(v)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("shl: input: %w", err), nil)
+		}
+		n, err := amountArg("shift", args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("shl: %w", err), nil)
+		}
+		return result("shl", in, new(big.Int).Lsh(in.N, uint(n)))
+	})
+}
+
+// RegisterShr registers the shr function with gojq
+func RegisterShr() gojq.CompilerOption {
+	return common.WithFunction("shr", 1, 1, func(v any, args []any) any {
+		// Negative numbers shift arithmetically, keeping their sign
+		in, err := ParseOperand(v)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("shr: input: %w", err), nil)
+		}
+		n, err := amountArg("shift", args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("shr: %w", err), nil)
+		}
+		return result("shr", in, new(big.Int).Rsh(in.N, uint(n)))
+	})
+}
+
+// RegisterPopcount registers the popcount function with gojq
+func RegisterPopcount() gojq.CompilerOption {
+	return common.WithFunction("popcount", 0, 0, func(v any, args []any) any {
+		in, err := ParseOperand(v)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("popcount: input: %w", err), nil)
+		}
+		if in.N.Sign() < 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "popcount: input must not be negative, got %v", in.N), nil)
+		}
+		count := 0
+		for _, word := range in.N.Bits() {
+			count += bits.OnesCount(uint(word))
+		}
+		return common.MakeUDFSuccessResult(count, map[string]any{
+			"operation":  "popcount",
+			"bit_length": in.N.BitLen(),
+		})
+	})
+}
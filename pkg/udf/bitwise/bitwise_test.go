@@ -0,0 +1,114 @@
+package bitwise
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+var bitwiseOpts = []gojq.CompilerOption{
+	RegisterBand(), RegisterBor(), RegisterBxor(), RegisterBnot(),
+	RegisterShl(), RegisterShr(), RegisterPopcount(),
+}
+
+func TestBitwise(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  any
+	}{
+		{`band(12) | ._val`, 10, 8},
+		{`bor(12) | ._val`, 10, 14},
+		{`bxor(12) | ._val`, 10, 6},
+		{`band("0x0f") | ._val`, 0xab, 0x0b},
+		{`band(15) | ._val`, "0xAB", "0x0b"},
+		{`bor("0x0100") | ._val`, "00ff", "01ff"},
+		{`bxor("0b0110") | ._val`, "0b1100", "0b1010"},
+		{`band(-1) | ._val`, 255, 255},
+		{`bnot | ._val`, 5, -6},
+		{`bnot(8) | ._val`, 5, 250},
+		{`bnot | ._val`, "0x00f0", "0xff0f"},
+		{`bnot | ._val`, "0b101", "0b010"},
+		{`bnot(4) | ._val`, "0x5", "0xa"},
+		{`shl(4) | ._val`, 1, 16},
+		{`shl(4) | ._val`, "0xff", "0xff0"},
+		{`shr(4) | ._val`, "0xff", "0x0f"},
+		{`shr(1) | ._val`, -7, -4},
+		{`shl(70) | ._val | tostring`, 1, "1180591620717411303424"},
+		{`popcount | ._val`, 255, 8},
+		{`popcount | ._val`, "0xffffffffffffffffffff", 80},
+		{`popcount | ._val`, 0, 0},
+		{`band(240) | ._meta | [.decimal, .hex, .bit_length]`, 0xff, []any{"240", "0xf0", 8}},
+		{`bor(1) | ._meta | has("hex")`, -4, false},
+	}
+	for _, tt := range tests {
+		got := runGojqQuery(t, tt.query, tt.input, bitwiseOpts...)
+		if n, ok := got.(*big.Int); ok {
+			got = n.String()
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s on %v = %#v, want %#v", tt.query, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestBitwiseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`band(1)`, "0xzz", `band: input: invalid hex string "0xzz"`},
+		{`band(1)`, "0b12", `band: input: invalid binary string "0b12"`},
+		{`band(1)`, "", `band: input: invalid hex string ""`},
+		{`band(1)`, "-ff", `band: input: invalid hex string "-ff"`},
+		{`bor(1.5)`, 1, "bor: argument: 1.5 is not an integer"},
+		{`bxor(1)`, true, "bxor: input: operand must be a number or a hex string"},
+		{`bor(-1)`, "0xff", "bor: result -1 is negative and cannot be written as a hex string"},
+		{`bnot(4)`, 16, "bnot: 16 does not fit in 4 bits"},
+		{`bnot(0)`, 1, "bnot: width must be from 1 to 65536, got 0"},
+		{`shl(-1)`, 1, "shl: shift must be from 0 to 65536, got -1"},
+		{`shl(100000)`, 1, "shl: shift must be from 0 to 65536"},
+		{`shr("a")`, 1, "shr: shift must be a number"},
+		{`popcount`, -1, "popcount: input must not be negative"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, bitwiseOpts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package bitwise
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// floatFormat describes an IEEE 754 binary format
+type floatFormat struct {
+	width, expBits, fracBits int
+}
+
+var floatFormats = map[int]floatFormat{
+	32: {32, 8, 23},
+	64: {64, 11, 52},
+}
+
+func floatWidthArg(args []any) (floatFormat, error) {
+	if len(args) == 0 {
+		return floatFormats[64], nil
+	}
+	var width int
+	switch val := common.ExtractUDFValue(args[0]).(type) {
+	case int:
+		width = val
+	case float64:
+		width = int(val)
+		if float64(width) != val {
+			width = -1
+		}
+	default:
+		return floatFormat{}, common.Errorf(common.CodeInvalid, "width must be 32 or 64, got %T", val)
+	}
+	f, ok := floatFormats[width]
+	if !ok {
+		return floatFormat{}, common.Errorf(common.CodeInvalid, "width must be 32 or 64, got %v", common.ExtractUDFValue(args[0]))
+	}
+	return f, nil
+}
+
+// FloatFields splits the bits of a float of format f into its fields
+func FloatFields(bits uint64, f floatFormat) map[string]any {
+	fracMask := uint64(1)<<f.fracBits - 1
+	expMask := uint64(1)<<f.expBits - 1
+	sign := int(bits >> (f.width - 1) & 1)
+	exp := int(bits >> f.fracBits & expMask)
+	frac := bits & fracMask
+	bias := int(expMask >> 1)
+
+	class := "normal"
+	unbiased := exp - bias
+	switch {
+	case exp == int(expMask) && frac == 0:
+		class = "infinity"
+	case exp == int(expMask):
+		class = "nan"
+	case exp == 0 && frac == 0:
+		class = "zero"
+	case exp == 0:
+		class, unbiased = "subnormal", 1-bias
+	}
+
+	binary := strconv.FormatUint(bits, 2)
+	binary = strings.Repeat("0", f.width-len(binary)) + binary
+	return map[string]any{
+		"width":             f.width,
+		"sign":              sign,
+		"exponent":          exp,
+		"exponent_unbiased": unbiased,
+		"mantissa":          intOrBig(frac),
+		"mantissa_hex":      fmt.Sprintf("0x%0*x", (f.fracBits+3)/4, frac),
+		"class":             class,
+		"binary":            binary[:1] + " " + binary[1:1+f.expBits] + " " + binary[1+f.expBits:],
+	}
+}
+
+func intOrBig(n uint64) any {
+	if n > math.MaxInt64 {
+		return new(big.Int).SetUint64(n)
+	}
+	return int(n)
+}
+
+// RegisterFloatBits registers the float_bits function with gojq
+func RegisterFloatBits() gojq.CompilerOption {
+	return common.WithFunction("float_bits", 0, 1, func(v any, args []any) any {
+		// float_bits or float_bits(width), width 32 or 64 (the default)
+		f, err := floatWidthArg(args)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("float_bits: %w", err), nil)
+		}
+		var x float64
+		switch val := common.ExtractUDFValue(v).(type) {
+		case int:
+			x = float64(val)
+		case float64:
+			x = val
+		case *big.Int:
+			x, _ = new(big.Float).SetInt(val).Float64()
+		default:
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "float_bits: input must be a number, got %T", val), nil)
+		}
+
+		var bits uint64
+		if f.width == 32 {
+			bits = uint64(math.Float32bits(float32(x)))
+		} else {
+			bits = math.Float64bits(x)
+		}
+		meta := FloatFields(bits, f)
+		meta["operation"] = "float_bits"
+		return common.MakeUDFSuccessResult(fmt.Sprintf("0x%0*x", f.width/4, bits), meta)
+	})
+}
+
+// RegisterBitsFloat registers the bits_float function with gojq
+func RegisterBitsFloat() gojq.CompilerOption {
+	return common.WithFunction("bits_float", 0, 1, func(v any, args []any) any {
+		// The input is the bits as an integer or a hex or binary string
+		f, err := floatWidthArg(args)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("bits_float: %w", err), nil)
+		}
+		in, err := ParseOperand(v)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("bits_float: %w", err), nil)
+		}
+		if in.N.Sign() < 0 || in.N.BitLen() > f.width {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "bits_float: %v does not fit in %d bits", in.N, f.width), nil)
+		}
+
+		bits := in.N.Uint64()
+		var x float64
+		if f.width == 32 {
+			x = float64(math.Float32frombits(uint32(bits)))
+		} else {
+			x = math.Float64frombits(bits)
+		}
+		meta := FloatFields(bits, f)
+		meta["operation"] = "bits_float"
+		return common.MakeUDFSuccessResult(x, meta)
+	})
+}
@@ -0,0 +1,67 @@
+package bitwise
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+var floatOpts = []gojq.CompilerOption{RegisterFloatBits(), RegisterBitsFloat()}
+
+func TestFloatBits(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  any
+	}{
+		{`float_bits | ._val`, 1.5, "0x3ff8000000000000"},
+		{`float_bits(32) | ._val`, 1.5, "0x3fc00000"},
+		{`float_bits(32) | ._val`, -2, "0xc0000000"},
+		{`float_bits(32) | ._meta | [.sign, .exponent, .exponent_unbiased, .mantissa, .class]`, 1.5, []any{0, 127, 0, 4194304, "normal"}},
+		{`float_bits(32) | ._meta.binary`, 1.5, "0 01111111 10000000000000000000000"},
+		{`float_bits(32) | ._meta.mantissa_hex`, 1.5, "0x400000"},
+		{`float_bits | ._meta | [.sign, .class]`, 0, []any{0, "zero"}},
+		{`float_bits | ._meta | [.exponent_unbiased, .class]`, 5e-324, []any{-1022, "subnormal"}},
+		{`float_bits(32) | ._meta.class`, 1e39, "infinity"},
+		{`bits_float(32) | ._val`, "0x3fc00000", 1.5},
+		{`bits_float(32) | ._val`, 1069547520, 1.5},
+		{`bits_float | ._val`, "3ff8000000000000", 1.5},
+		{`bits_float(32) | ._val`, "0b01000000010010010000111111011011", float64(float32(math.Pi))},
+		{`bits_float(32) | ._meta.class`, "0x7fc00000", "nan"},
+		{`bits_float(32) | ._meta | [.sign, .class]`, "0xff800000", []any{1, "infinity"}},
+		{`float_bits(32) | bits_float(32) | ._val`, 0.1, float64(float32(0.1))},
+	}
+	for _, tt := range tests {
+		got := runGojqQuery(t, tt.query, tt.input, floatOpts...)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s on %v = %#v, want %#v", tt.query, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFloatBitsErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`float_bits(16)`, 1, "float_bits: width must be 32 or 64, got 16"},
+		{`float_bits("32")`, 1, "float_bits: width must be 32 or 64"},
+		{`float_bits`, "1.5", "float_bits: input must be a number"},
+		{`bits_float(32)`, "0x1ffffffff", "bits_float: 8589934591 does not fit in 32 bits"},
+		{`bits_float`, -1, "bits_float: -1 does not fit in 64 bits"},
+		{`bits_float`, "0xzz", `bits_float: invalid hex string "0xzz"`},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, floatOpts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package udf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// FuncCalls returns the names of the functions a query calls, including
+// calls inside the functions it defines, in the order they first appear.
+// Functions the query defines itself, with the same arity, are left out
+func FuncCalls(query *gojq.Query) []string {
+	type call struct {
+		name  string
+		arity int
+	}
+	var calls []call
+	seen := map[call]bool{}
+	defined := map[call]bool{}
+
+	var walkQuery func(*gojq.Query)
+	var walkTerm func(*gojq.Term)
+	var walkPattern func(*gojq.Pattern)
+	walkString := func(s *gojq.String) {
+		if s != nil {
+			for _, q := range s.Queries {
+				walkQuery(q)
+			}
+		}
+	}
+	walkIndex := func(index *gojq.Index) {
+		if index != nil {
+			walkString(index.Str)
+			walkQuery(index.Start)
+			walkQuery(index.End)
+		}
+	}
+	walkPattern = func(p *gojq.Pattern) {
+		if p == nil {
+			return
+		}
+		for _, e := range p.Array {
+			walkPattern(e)
+		}
+		for _, kv := range p.Object {
+			walkString(kv.KeyString)
+			walkQuery(kv.KeyQuery)
+			walkPattern(kv.Val)
+		}
+	}
+	walkQuery = func(q *gojq.Query) {
+		if q == nil {
+			return
+		}
+		for _, fd := range q.FuncDefs {
+			defined[call{fd.Name, len(fd.Args)}] = true
+			for _, arg := range fd.Args {
+				// Parameters are called like functions without arguments
+				defined[call{arg, 0}] = true
+			}
+			walkQuery(fd.Body)
+		}
+		walkTerm(q.Term)
+		walkQuery(q.Left)
+		walkQuery(q.Right)
+		for _, p := range q.Patterns {
+			walkPattern(p)
+		}
+	}
+	walkTerm = func(t *gojq.Term) {
+		if t == nil {
+			return
+		}
+		walkIndex(t.Index)
+		// Variables are parsed as functions named with a $
+		if t.Func != nil && !strings.HasPrefix(t.Func.Name, "$") {
+			c := call{t.Func.Name, len(t.Func.Args)}
+			if !seen[c] {
+				seen[c] = true
+				calls = append(calls, c)
+			}
+			for _, arg := range t.Func.Args {
+				walkQuery(arg)
+			}
+		}
+		if t.Object != nil {
+			for _, kv := range t.Object.KeyVals {
+				walkString(kv.KeyString)
+				walkQuery(kv.KeyQuery)
+				walkQuery(kv.Val)
+			}
+		}
+		if t.Array != nil {
+			walkQuery(t.Array.Query)
+		}
+		if t.Unary != nil {
+			walkTerm(t.Unary.Term)
+		}
+		walkString(t.Str)
+		if t.If != nil {
+			walkQuery(t.If.Cond)
+			walkQuery(t.If.Then)
+			for _, elif := range t.If.Elif {
+				walkQuery(elif.Cond)
+				walkQuery(elif.Then)
+			}
+			walkQuery(t.If.Else)
+		}
+		if t.Try != nil {
+			walkQuery(t.Try.Body)
+			walkQuery(t.Try.Catch)
+		}
+		if t.Reduce != nil {
+			walkQuery(t.Reduce.Query)
+			walkPattern(t.Reduce.Pattern)
+			walkQuery(t.Reduce.Start)
+			walkQuery(t.Reduce.Update)
+		}
+		if t.Foreach != nil {
+			walkQuery(t.Foreach.Query)
+			walkPattern(t.Foreach.Pattern)
+			walkQuery(t.Foreach.Start)
+			walkQuery(t.Foreach.Update)
+			walkQuery(t.Foreach.Extract)
+		}
+		if t.Label != nil {
+			walkQuery(t.Label.Body)
+		}
+		walkQuery(t.Query)
+		for _, suffix := range t.SuffixList {
+			walkIndex(suffix.Index)
+		}
+	}
+	walkQuery(query)
+
+	var names []string
+	named := map[string]bool{}
+	for _, c := range calls {
+		if !defined[c] && !named[c.name] {
+			named[c.name] = true
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+// CallSites numbers the places a query calls a UDF, from 1, in the order of
+// a walk of the query that is the same for the same query. Calls of
+// functions the query defines, with the same arity, are left out. Profiles
+// and graphs use the numbers to tell the calls of a function at different
+// places apart
+func CallSites(query *gojq.Query) map[*gojq.Func]int {
+	defined := map[string]bool{}
+	eachQuery(query, func(q *gojq.Query) {
+		for _, fd := range q.FuncDefs {
+			defined[fmt.Sprintf("%s/%d", fd.Name, len(fd.Args))] = true
+			for _, arg := range fd.Args {
+				defined[arg+"/0"] = true
+			}
+		}
+	})
+	sites := map[*gojq.Func]int{}
+	eachQuery(query, func(q *gojq.Query) {
+		if q.Term == nil || q.Term.Func == nil {
+			return
+		}
+		f := q.Term.Func
+		m, ok := LookupFunction(f.Name)
+		if ok && len(f.Args) >= m.MinArgs && len(f.Args) <= m.MaxArgs &&
+			!defined[fmt.Sprintf("%s/%d", f.Name, len(f.Args))] {
+			sites[f] = len(sites) + 1
+		}
+	})
+	return sites
+}
+
+// WithCallSites renames each UDF call of a query, as numbered by CallSites,
+// to a name of its own, and returns the compiler options registering those
+// names, so that call observers see the site of each call. Compile the
+// query with them, then call restore to give the calls their names back
+func WithCallSites(query *gojq.Query) (options []gojq.CompilerOption, restore func()) {
+	sites := CallSites(query)
+	names := make(map[*gojq.Func]string, len(sites))
+	for f, site := range sites {
+		alias := fmt.Sprintf("%s@%d", f.Name, site)
+		option, ok := common.WithCallSite(alias, f.Name, site)
+		if !ok {
+			continue
+		}
+		names[f] = f.Name
+		f.Name = alias
+		options = append(options, option)
+	}
+	return options, func() {
+		for f, name := range names {
+			f.Name = name
+		}
+	}
+}
+
+// LookupFunction returns the metadata of a UDF, plugins' included, or false
+// for jq builtins and other names that are not UDFs
+func LookupFunction(name string) (FunctionMetadata, bool) {
+	for _, m := range GetFunctionMetadata() {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return FunctionMetadata{}, false
+}
+
+// FunctionCategory returns the category of a UDF, matching the metadata
+// registry, or "" for jq builtins and other names that are not UDFs
+func FunctionCategory(name string) string {
+	m, _ := LookupFunction(name)
+	return m.Category
+}
+
+// Categories returns the UDF categories in the order they first appear in
+// the metadata registry
+func Categories() []string {
+	var categories []string
+	seen := map[string]bool{}
+	for _, m := range GetFunctionMetadata() {
+		if !seen[m.Category] {
+			seen[m.Category] = true
+			categories = append(categories, m.Category)
+		}
+	}
+	return categories
+}
+
+// LookupCategory finds a category by name, ignoring case
+func LookupCategory(name string) (string, bool) {
+	for _, c := range Categories() {
+		if strings.EqualFold(c, name) {
+			return c, true
+		}
+	}
+	return "", false
+}
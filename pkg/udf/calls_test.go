@@ -0,0 +1,173 @@
+package udf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+func TestFuncCalls(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`.foo`, nil},
+		{`md5 | ._val`, []string{"md5"}},
+		{`map(sha256(true))`, []string{"map", "sha256"}},
+		{`if sh("id") then cat else empty end`, []string{"sh", "cat", "empty"}},
+		{`try http("GET"; .url) catch error`, []string{"http", "error"}},
+		{`reduce find(".") as $p (0; . + 1)`, []string{"find"}},
+		{`"\(env.HOME | cat)"`, []string{"env", "cat"}},
+		{`def f: sh("x"); f, f`, []string{"sh"}},
+		// A definition only hides calls of the same arity
+		{`def sh: .; sh, sh("id")`, []string{"sh"}},
+		{`def sh(c): c; sh("id")`, nil},
+		{`. as [$a, {b: $c}] ?// $d | {(tempdir): $a}`, []string{"tempdir"}},
+		{`.[rand_int(0; 9)]`, []string{"rand_int"}},
+	}
+	for _, tt := range tests {
+		query, err := gojq.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got := FuncCalls(query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FuncCalls(%s) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCallSites(t *testing.T) {
+	query, err := gojq.Parse(`def sha256: .; (md5 | ._val | md5), sha256, {a: upper(.)}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for f, site := range CallSites(query) {
+		got = append(got, fmt.Sprintf("%d:%s", site, f.Name))
+	}
+	sort.Strings(got)
+	if want := []string{"1:md5", "2:md5", "3:upper"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CallSites = %v, want %v", got, want)
+	}
+}
+
+func TestWithCallSites(t *testing.T) {
+	query, err := gojq.Parse(`md5 | ._val | md5 | ._val`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var sites []string
+	defer common.AddCallObserver(func(c common.Call) {
+		mu.Lock()
+		defer mu.Unlock()
+		sites = append(sites, fmt.Sprintf("%s@%d", c.Name, c.Site))
+	})()
+
+	options := DefaultRegistry().Options()
+	siteOptions, restore := WithCallSites(query)
+	code, err := gojq.Compile(query, append(options, siteOptions...)...)
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.String() != `md5 | ._val | md5 | ._val` {
+		t.Errorf("restore left %s", query)
+	}
+	got, _ := code.Run("a").Next()
+	if got != "d7afde3e7059cd0a0fe09eec4b0008cd" {
+		t.Errorf("result = %v", got)
+	}
+	if want := []string{"md5@1", "md5@2"}; !reflect.DeepEqual(sites, want) {
+		t.Errorf("sites = %v, want %v", sites, want)
+	}
+}
+
+func TestFunctionCategory(t *testing.T) {
+	if got := FunctionCategory("sha256"); got != "Hash" {
+		t.Errorf("FunctionCategory(sha256) = %q", got)
+	}
+	if got := FunctionCategory("map"); got != "" {
+		t.Errorf("FunctionCategory(map) = %q, want none", got)
+	}
+	if got, ok := LookupCategory("file operations"); !ok || got != "File Operations" {
+		t.Errorf("LookupCategory = %q, %v", got, ok)
+	}
+	if _, ok := LookupCategory("Nope"); ok {
+		t.Error("LookupCategory(Nope) found a category")
+	}
+}
+
+func TestFunctionTypes(t *testing.T) {
+	types := map[string]bool{"": true, "string": true, "number": true, "boolean": true, "array": true, "object": true}
+	for _, m := range GetFunctionMetadata() {
+		if !types[m.Input] || !types[m.Output] {
+			t.Errorf("%s declares types %q and %q, want jq type names", m.Name, m.Input, m.Output)
+		}
+	}
+	if m, ok := LookupFunction("entropy"); !ok || m.Input != "string" || m.Output != "number" {
+		t.Errorf("LookupFunction(entropy) = %+v, %v", m, ok)
+	}
+	if _, ok := LookupFunction("map"); ok {
+		t.Error("LookupFunction(map) found a UDF")
+	}
+}
+
+func TestPureRegistry(t *testing.T) {
+	compile := func(reg *Registry, q string) error {
+		query, err := gojq.Parse(q)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		_, err = gojq.Compile(query, reg.Options()...)
+		return err
+	}
+	pure := PureRegistry()
+	if err := compile(pure, `md5, base64_encode, regex_match("a")`); err != nil {
+		t.Errorf("PureRegistry lacks a pure UDF: %v", err)
+	}
+	for _, q := range []string{`cat`, `http("GET"; .)`, `sh("id")`, `redis_keys`} {
+		if err := compile(pure, q); err == nil {
+			t.Errorf("PureRegistry compiles %s", q)
+		}
+		if err := compile(DefaultRegistry(), q); err != nil {
+			t.Errorf("DefaultRegistry doesn't compile %s: %v", q, err)
+		}
+	}
+}
+
+func TestPureFunctionMetadata(t *testing.T) {
+	options := PureRegistry().Options()
+	for _, m := range PureFunctionMetadata() {
+		// Built from the syntax tree, as some names like 3des_encrypt
+		// don't parse
+		args := make([]*gojq.Query, m.MinArgs)
+		for i := range args {
+			args[i] = &gojq.Query{Term: &gojq.Term{Type: gojq.TermTypeIdentity}}
+		}
+		query := &gojq.Query{Term: &gojq.Term{Type: gojq.TermTypeFunc, Func: &gojq.Func{Name: m.Name, Args: args}}}
+		if _, err := gojq.Compile(query, options...); err != nil {
+			t.Errorf("PureRegistry doesn't compile %s/%d: %v", m.Name, m.MinArgs, err)
+		}
+	}
+}
+
+func TestFunctionCapabilities(t *testing.T) {
+	capabilities := map[string]FunctionCapability{}
+	for _, c := range FunctionCapabilities() {
+		capabilities[c.Name] = c
+	}
+	for name, needs := range map[string]string{"md5": "", "cat": "filesystem", "http": "network", "redis_get": "network", "sh": "system"} {
+		if c := capabilities[name]; c.Pure != (needs == "") || c.Needs != needs {
+			t.Errorf("FunctionCapabilities: %s = %+v, want needs %q", name, c, needs)
+		}
+	}
+	if n := len(PureFunctionMetadata()); n >= len(capabilities) || n == 0 {
+		t.Errorf("PureFunctionMetadata has %d of %d functions", n, len(capabilities))
+	}
+}
@@ -1,19 +1,37 @@
 package cat
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"unicode/utf8"
 
 	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/udf/common"
 )
 
+// formats are the output formats of cat: text is the content as a string,
+// base64 is standard base64, and bytes is an array of byte values as made
+// by common.BytesValue. Only base64 and bytes keep binary data intact in
+// JSON output
+var formats = []string{"text", "base64", "bytes"}
+
 // RegisterCat registers the cat function with gojq
 func RegisterCat() gojq.CompilerOption {
-	return gojq.WithFunction("cat", 0, 1, func(v any, args []any) any {
+	return common.WithFunction("cat", 0, 2, common.Audited("cat", func(v any, args []any) any {
 		var filePath string
 
+		format := "text"
+		if len(args) > 1 {
+			f, _ := common.ExtractUDFValue(args[1]).(string)
+			if !slices.Contains(formats, f) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, `cat: format must be "text", "base64" or "bytes", got %v`, common.ExtractUDFValue(args[1])), nil)
+			}
+			format = f
+		}
+
 		// Parse arguments: file path can come from pipe or as argument
 		if len(args) > 0 {
 			// File path provided as argument
@@ -25,7 +43,7 @@ func RegisterCat() gojq.CompilerOption {
 				if pathStr, ok := pathVal.(string); ok {
 					filePath = pathStr
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("cat: argument must be a string file path, got %T", args[0]), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "cat: argument must be a string file path, got %T", args[0]), nil)
 				}
 			}
 		} else {
@@ -34,7 +52,7 @@ func RegisterCat() gojq.CompilerOption {
 			if pathStr, ok := inputVal.(string); ok {
 				filePath = pathStr
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("cat: input must be a string file path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "cat: input must be a string file path, got %T", inputVal), nil)
 			}
 		}
 
@@ -45,13 +63,13 @@ func RegisterCat() gojq.CompilerOption {
 			if filePath == "~" {
 				home, homeErr := os.UserHomeDir()
 				if homeErr != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("cat: cannot determine home directory: %v", homeErr), nil)
+					return common.MakeUDFErrorResult(fmt.Errorf("cat: cannot determine home directory: %w", homeErr), nil)
 				}
 				absPath = home
 			} else if len(filePath) > 0 && filePath[0] == '~' && (len(filePath) == 1 || filePath[1] == '/') {
 				home, homeErr := os.UserHomeDir()
 				if homeErr != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("cat: cannot determine home directory: %v", homeErr), nil)
+					return common.MakeUDFErrorResult(fmt.Errorf("cat: cannot determine home directory: %w", homeErr), nil)
 				}
 				if len(filePath) > 1 {
 					absPath = filepath.Join(home, filePath[2:])
@@ -60,28 +78,34 @@ func RegisterCat() gojq.CompilerOption {
 				}
 				absPath, err = filepath.Abs(absPath)
 				if err != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("cat: cannot resolve path %q: %v", filePath, err), nil)
+					return common.MakeUDFErrorResult(fmt.Errorf("cat: cannot resolve path %q: %w", filePath, err), nil)
 				}
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("cat: cannot resolve path %q: %v", filePath, err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("cat: cannot resolve path %q: %w", filePath, err), nil)
 			}
 		}
 		filePath = absPath
+		if err := common.CheckRead(filePath); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("cat: %w", err), map[string]any{
+				"operation": "cat",
+				"file_path": filePath,
+			})
+		}
 
 		// Read file contents
-		fileData, err := os.ReadFile(filePath)
+		fileData, err := common.ReadFile(filePath)
 		if err != nil {
 			meta := map[string]any{
 				"operation": "cat",
 				"file_path": filePath,
 			}
 			if os.IsNotExist(err) {
-				return common.MakeUDFErrorResult(fmt.Errorf("cat: file does not exist: %q", filePath), meta)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeNotFound, "cat: file does not exist: %q", filePath).WithDetails(map[string]any{"path": filePath}), meta)
 			}
 			if os.IsPermission(err) {
-				return common.MakeUDFErrorResult(fmt.Errorf("cat: permission denied reading file: %q", filePath), meta)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodePermission, "cat: permission denied reading file: %q", filePath).WithDetails(map[string]any{"path": filePath}), meta)
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("cat: failed to read file %q: %v", filePath, err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("cat: failed to read file %q: %w", filePath, err), meta)
 		}
 
 		// Get file info for metadata
@@ -100,18 +124,27 @@ func RegisterCat() gojq.CompilerOption {
 				"file_path": filePath,
 				"file_size": int(fileSize),
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("cat: %q is a directory, not a file", filePath), meta)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "cat: %q is a directory, not a file", filePath), meta)
 		}
 
-		// Return file contents as string
-		content := string(fileData)
+		var content any
+		switch format {
+		case "base64":
+			content = base64.StdEncoding.EncodeToString(fileData)
+		case "bytes":
+			content = common.BytesValue(fileData)
+		default:
+			content = string(fileData)
+		}
 
 		meta := map[string]any{
 			"operation": "cat",
 			"file_path": filePath,
 			"file_size": int(fileSize),
+			"format":    format,
+			"binary":    !utf8.Valid(fileData),
 		}
 
 		return common.MakeUDFSuccessResult(content, meta)
-	})
+	}))
 }
@@ -1,12 +1,17 @@
 package cat
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
 )
 
 // Helper to compile and run a gojq query
@@ -141,10 +146,12 @@ func TestCatFileNotFound(t *testing.T) {
 		t.Fatalf("expected map[string]any error result, got %T", result)
 	}
 
-	if errStr, hasErr := resMap["_err"].(string); !hasErr {
+	if !common.HasUDFError(resMap) {
 		t.Errorf("expected _err field in result, got %v", result)
-	} else if errStr == "" {
+	} else if common.GetUDFError(resMap) == "" {
 		t.Errorf("expected non-empty error message, got empty string")
+	} else if code := common.GetUDFErrorCode(resMap); code != common.CodeNotFound {
+		t.Errorf("expected error code %s, got %q", common.CodeNotFound, code)
 	}
 
 	// _val should be null on error
@@ -170,9 +177,9 @@ func TestCatDirectoryError(t *testing.T) {
 		t.Fatalf("expected map[string]any error result, got %T", result)
 	}
 
-	if errStr, hasErr := resMap["_err"].(string); !hasErr {
+	if !common.HasUDFError(resMap) {
 		t.Errorf("expected _err field in result, got %v", result)
-	} else if errStr == "" {
+	} else if common.GetUDFError(resMap) == "" {
 		t.Errorf("expected non-empty error message, got empty string")
 	}
 }
@@ -303,3 +310,49 @@ func TestCatGojqIntegration(t *testing.T) {
 	}
 }
 
+
+func TestCatFormats(t *testing.T) {
+	data := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe, '\n'}
+	path := filepath.Join(t.TempDir(), "image.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  any
+	}{
+		{`cat(.; "base64") | ._val`, base64.StdEncoding.EncodeToString(data)},
+		{`cat(.; "bytes") | ._val`, common.BytesValue(data)},
+		{`cat(.; "bytes") | ._val | length`, len(data)},
+		{`cat(.; "bytes") | ._meta | [.format, .binary]`, []any{"bytes", true}},
+		{`cat(.; "text") | ._meta.format`, "text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result := runGojqQuery(t, tt.query, path, RegisterCat())
+			if !reflect.DeepEqual(result, tt.want) {
+				t.Errorf("got %v, want %v", result, tt.want)
+			}
+		})
+	}
+
+	// The bytes survive a round trip through JSON
+	result := runGojqQuery(t, `cat(.; "bytes") | ._val`, path, RegisterCat())
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := common.BytesFromValue(decoded); !ok || !bytes.Equal(b, data) {
+		t.Errorf("BytesFromValue after JSON = %v, want %v", b, data)
+	}
+
+	result = runGojqQuery(t, `cat(.; "hex")`, path, RegisterCat())
+	if msg := common.GetUDFError(result); !strings.HasPrefix(msg, `cat: format must be "text", "base64" or "bytes"`) {
+		t.Errorf("_err = %q", msg)
+	}
+}
@@ -0,0 +1,307 @@
+package charset
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// Charset is a named character encoding. A nil enc is UTF-8, which needs
+// no conversion
+type Charset struct {
+	Name  string
+	enc   encoding.Encoding
+	ascii bool // reject everything outside 7-bit ASCII
+}
+
+// Lookup finds a charset by name, using the WHATWG labels browsers accept
+// ("shift_jis", "latin1", "cp1251") and then the IANA registry
+func Lookup(name string) (Charset, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	switch key {
+	case "utf-8", "utf8":
+		return Charset{Name: "UTF-8"}, nil
+	case "ascii", "us-ascii":
+		// WHATWG treats ASCII as windows-1252, which would let accented
+		// characters through
+		return Charset{Name: "ASCII", ascii: true}, nil
+	case "utf-16", "utf16":
+		// Unmarked UTF-16 is big-endian unless it starts with a BOM
+		return Charset{Name: "UTF-16", enc: unicode.UTF16(unicode.BigEndian, unicode.UseBOM)}, nil
+	case "utf-16le", "utf16le":
+		return Charset{Name: "UTF-16LE", enc: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)}, nil
+	case "utf-16be", "utf16be":
+		return Charset{Name: "UTF-16BE", enc: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)}, nil
+	case "utf-32", "utf32":
+		return Charset{Name: "UTF-32", enc: utf32.UTF32(utf32.BigEndian, utf32.UseBOM)}, nil
+	case "utf-32le", "utf32le":
+		return Charset{Name: "UTF-32LE", enc: utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM)}, nil
+	case "utf-32be", "utf32be":
+		return Charset{Name: "UTF-32BE", enc: utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM)}, nil
+	}
+
+	enc, err := htmlindex.Get(key)
+	if err != nil {
+		enc, err = ianaindex.IANA.Encoding(key)
+	}
+	if err != nil || enc == nil {
+		return Charset{}, common.Errorf(common.CodeInvalid, "unknown charset %q", name)
+	}
+	canonical, err := ianaindex.MIME.Name(enc)
+	if err != nil {
+		canonical = name
+	}
+	return Charset{Name: canonical, enc: enc}, nil
+}
+
+// Decode converts data in charset c to UTF-8. Invalid sequences become
+// U+FFFD; invalid is how many there were. A leading BOM is dropped
+func (c Charset) Decode(data []byte) (string, int) {
+	if c.enc == nil {
+		text := string(bytes.TrimPrefix(data, []byte("\uFEFF")))
+		invalid := 0
+		for i := 0; i < len(text); {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			if r == utf8.RuneError && size == 1 || c.ascii && r >= 0x80 {
+				invalid++
+			}
+			i += size
+		}
+		if invalid == 0 {
+			return text, 0
+		}
+		var sb strings.Builder
+		for _, r := range text {
+			if c.ascii && r >= 0x80 {
+				r = utf8.RuneError
+			}
+			sb.WriteRune(r)
+		}
+		return sb.String(), invalid
+	}
+
+	// Decoders replace invalid input instead of failing
+	out, _ := c.enc.NewDecoder().Bytes(data)
+	text := strings.TrimPrefix(string(out), "\uFEFF")
+	return text, strings.Count(text, "\uFFFD")
+}
+
+// Encode converts UTF-8 text to charset c. Characters c cannot represent
+// are replaced with "?" when replace is set and dropped when skip is set;
+// otherwise the first one is an error. unsupported counts them
+func (c Charset) Encode(text string, replace, skip bool) ([]byte, int, error) {
+	if c.enc == nil && !c.ascii {
+		return []byte(text), 0, nil
+	}
+
+	if c.ascii {
+		if !strings.ContainsFunc(text, func(r rune) bool { return r >= 0x80 }) {
+			return []byte(text), 0, nil
+		}
+	} else if out, err := c.enc.NewEncoder().Bytes([]byte(text)); err == nil {
+		return out, 0, nil
+	}
+
+	// Go character by character to find what cannot be represented
+	var out []byte
+	unsupported := 0
+	enc := c.encoder()
+	for _, r := range text {
+		b, err := enc(r)
+		if err == nil {
+			out = append(out, b...)
+			continue
+		}
+		unsupported++
+		switch {
+		case replace:
+			out = append(out, '?')
+		case skip:
+		default:
+			return nil, unsupported, common.Errorf(common.CodeInvalid, "character %q cannot be represented in %v", r, c.Name)
+		}
+	}
+	return out, unsupported, nil
+}
+
+// encoder returns a function encoding a single character
+func (c Charset) encoder() func(rune) ([]byte, error) {
+	if c.ascii {
+		return func(r rune) ([]byte, error) {
+			if r >= 0x80 {
+				return nil, common.Errorf(common.CodeInvalid, "not ASCII")
+			}
+			return []byte{byte(r)}, nil
+		}
+	}
+	e := c.enc.NewEncoder()
+	return func(r rune) ([]byte, error) {
+		e.Reset()
+		return e.Bytes([]byte(string(r)))
+	}
+}
+
+// readInput reads the input value, or the file it names when isFile is set
+func readInput(name string, inputVal any, isFile bool) ([]byte, map[string]any, error) {
+	inputVal = common.ExtractUDFValue(inputVal)
+	meta := map[string]any{}
+	if isFile {
+		filePathStr, ok := inputVal.(string)
+		if !ok {
+			return nil, nil, common.Errorf(common.CodeInvalid, "%v: file argument requires string path, got %T", name, inputVal)
+		}
+		fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%v: %w", name, err)
+		}
+		meta["file_path"] = absPath
+		meta["file_size"] = size
+		return fileData, meta, nil
+	}
+
+	data, err := common.InputBytes(inputVal)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %w", name, err)
+	}
+	return data, meta, nil
+}
+
+// RegisterCharsetDetect registers the charset_detect function with gojq
+func RegisterCharsetDetect() gojq.CompilerOption {
+	return common.WithFunction("charset_detect", 0, 2, func(v any, args []any) any {
+		inputVal, isFile, err := common.ParseFileArgs(v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("charset_detect: %w", err), nil)
+		}
+		data, meta, err := readInput("charset_detect", inputVal, isFile)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		results := Detect(data)
+		candidates := make([]any, len(results))
+		for i, r := range results {
+			candidates[i] = map[string]any{"charset": r.Charset, "confidence": r.Confidence}
+		}
+		meta["operation"] = "charset_detect"
+		meta["input_length"] = len(data)
+		meta["candidates"] = candidates
+		if len(results) == 0 {
+			// Binary data, or text in a charset that is not detected
+			meta["confidence"] = 0.0
+			meta["bom"] = false
+			return common.MakeUDFSuccessResult(nil, meta)
+		}
+		meta["confidence"] = results[0].Confidence
+		meta["bom"] = results[0].BOM
+		return common.MakeUDFSuccessResult(results[0].Charset, meta)
+	})
+}
+
+// iconvOptions are the settings accepted by iconv
+type iconvOptions struct {
+	File    bool
+	Invalid string // "error", "replace" or "skip"
+}
+
+func parseIconvOptions(m map[string]any) (iconvOptions, error) {
+	opts := iconvOptions{Invalid: "error"}
+	for key, raw := range m {
+		switch key {
+		case "file":
+			b, ok := raw.(bool)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.file must be a boolean, got %T", raw)
+			}
+			opts.File = b
+		case "invalid":
+			s, ok := raw.(string)
+			if !ok || (s != "error" && s != "replace" && s != "skip") {
+				return opts, common.Errorf(common.CodeInvalid, `options.invalid must be "error", "replace" or "skip", got %v`, raw)
+			}
+			opts.Invalid = s
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// RegisterIconv registers the iconv function with gojq
+func RegisterIconv() gojq.CompilerOption {
+	return common.WithFunction("iconv", 2, 3, func(v any, args []any) any {
+		fromName, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "iconv: from must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		toName, ok := common.ExtractUDFValue(args[1]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "iconv: to must be a string, got %T", common.ExtractUDFValue(args[1])), nil)
+		}
+		opts := iconvOptions{Invalid: "error"}
+		if len(args) > 2 {
+			m, ok := common.ExtractUDFValue(args[2]).(map[string]any)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "iconv: options must be an object, got %T", common.ExtractUDFValue(args[2])), nil)
+			}
+			var err error
+			if opts, err = parseIconvOptions(m); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("iconv: %w", err), nil)
+			}
+		}
+
+		to, err := Lookup(toName)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("iconv: %w", err), nil)
+		}
+		data, meta, err := readInput("iconv", v, opts.File)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		var from Charset
+		if strings.EqualFold(fromName, "auto") {
+			results := Detect(data)
+			if len(results) == 0 {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "iconv: could not detect the charset of the input"), nil)
+			}
+			if from, err = Lookup(results[0].Charset); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("iconv: %w", err), nil)
+			}
+			meta["confidence"] = results[0].Confidence
+		} else if from, err = Lookup(fromName); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("iconv: %w", err), nil)
+		}
+
+		text, invalid := from.Decode(data)
+		if invalid > 0 {
+			switch opts.Invalid {
+			case "skip":
+				text = strings.ReplaceAll(text, "\uFFFD", "")
+			case "error":
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "iconv: input has %d invalid sequences for %v", invalid, from.Name), nil)
+			}
+		}
+		out, unsupported, err := to.Encode(text, opts.Invalid == "replace", opts.Invalid == "skip")
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("iconv: %w", err), nil)
+		}
+
+		meta["operation"] = "iconv"
+		meta["from"] = from.Name
+		meta["to"] = to.Name
+		meta["input_length"] = len(data)
+		meta["output_length"] = len(out)
+		meta["invalid"] = invalid + unsupported
+		return common.MakeUDFSuccessResult(string(out), meta)
+	})
+}
@@ -0,0 +1,209 @@
+package charset
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+// encode converts UTF-8 text to the named charset for test input
+func encode(t *testing.T, text, name string) string {
+	t.Helper()
+	c, err := Lookup(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := c.Encode(text, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+var samples = []struct {
+	charset string
+	text    string
+}{
+	{"Shift_JIS", "2024-05-01 10:00:00 エラー: ファイルを開けませんでした。設定を確認してください。"},
+	{"EUC-JP", "今日はとても良い天気ですね。明日も晴れるといいのですが。"},
+	{"GB18030", "这是一个测试文件，我们要检查中文的编码是不是可以正确地识别出来。"},
+	{"Big5", "這是一個測試檔案，我們要檢查中文的編碼是不是可以正確地識別出來。"},
+	{"EUC-KR", "이것은 문자 인코딩을 확인하기 위한 테스트 문장입니다. 한국어 로그 파일을 읽을 수 있습니다."},
+	{"windows-1251", "Ошибка: не удалось открыть файл конфигурации, проверьте права доступа."},
+	{"KOI8-R", "Привет, мир! Это проверка определения кодировки для русского текста."},
+	{"windows-1252", "Le café “crème” coûte 3 € à la gare — très cher, n’est-ce pas?"},
+	{"ISO-8859-1", "Größenänderung der Datei fehlgeschlagen: Zugriff verweigert für Benutzer Jürgen."},
+}
+
+func TestDetect(t *testing.T) {
+	for _, s := range samples {
+		t.Run(s.charset, func(t *testing.T) {
+			results := Detect([]byte(encode(t, s.text, s.charset)))
+			if len(results) == 0 || results[0].Charset != s.charset {
+				t.Errorf("Detect = %+v, want %s first", results, s.charset)
+			}
+		})
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		bom   bool
+	}{
+		{"ascii", "plain text\n", "ASCII", false},
+		{"utf-8", "naïve café ✓", "UTF-8", false},
+		{"utf-8 bom", "\uFEFFhello", "UTF-8", true},
+		{"utf-16le bom", "\xFF\xFEh\x00i\x00", "UTF-16LE", true},
+		{"utf-32le bom", "\xFF\xFE\x00\x00h\x00\x00\x00", "UTF-32LE", true},
+		{"utf-16le", "h\x00e\x00l\x00l\x00o\x00", "UTF-16LE", false},
+		{"utf-16be", "\x00h\x00e\x00l\x00l\x00o", "UTF-16BE", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := Detect([]byte(tt.input))
+			if len(results) != 1 || results[0].Charset != tt.want || results[0].BOM != tt.bom {
+				t.Errorf("Detect(%q) = %+v, want %s (bom %v)", tt.input, results, tt.want, tt.bom)
+			}
+		})
+	}
+}
+
+func TestDetectTruncated(t *testing.T) {
+	// A multi-byte character cut off by the sample limit is not an error
+	text := strings.Repeat("日本語のテキストです。", sampleLen/20)
+	for _, name := range []string{"UTF-8", "Shift_JIS"} {
+		data := []byte(encode(t, text, name))
+		if len(data) <= sampleLen {
+			t.Fatalf("Sample too short: %d bytes", len(data))
+		}
+		results := Detect(data[:sampleLen+1])
+		if len(results) == 0 || results[0].Charset != name {
+			t.Errorf("Detect = %+v, want %s first", results, name)
+		}
+	}
+}
+
+func TestCharsetDetectUDF(t *testing.T) {
+	input := encode(t, samples[0].text, "Shift_JIS")
+	result := runGojqQuery(t, `charset_detect`, input, RegisterCharsetDetect())
+	got := result.(map[string]any)
+	if got["_val"] != "Shift_JIS" {
+		t.Errorf("Expected Shift_JIS, got %v", result)
+	}
+	meta := got["_meta"].(map[string]any)
+	if conf, _ := meta["confidence"].(float64); conf < 0.5 {
+		t.Errorf("Expected a confident detection, got %v", meta)
+	}
+	if candidates, _ := meta["candidates"].([]any); len(candidates) == 0 {
+		t.Errorf("Expected candidates, got %v", meta)
+	}
+
+	path := filepath.Join(t.TempDir(), "log.txt")
+	if err := os.WriteFile(path, []byte(encode(t, samples[5].text, "windows-1251")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result = runGojqQuery(t, `charset_detect(true)`, path, RegisterCharsetDetect())
+	got = result.(map[string]any)
+	if got["_val"] != "windows-1251" || got["_meta"].(map[string]any)["file_path"] != path {
+		t.Errorf("Unexpected file detection %v", result)
+	}
+
+	// Binary data has no charset
+	result = runGojqQuery(t, `charset_detect`, "\x00\x01\x02\x80\xff\x00", RegisterCharsetDetect())
+	if got := result.(map[string]any); got["_val"] != nil || got["_err"] != nil {
+		t.Errorf("Expected null charset, got %v", result)
+	}
+}
+
+func TestIconvUDF(t *testing.T) {
+	sjis := encode(t, samples[0].text, "Shift_JIS")
+	tests := []struct {
+		name  string
+		query string
+		input any
+		want  string
+	}{
+		{"to utf-8", `iconv("Shift_JIS"; "UTF-8") | ._val`, sjis, samples[0].text},
+		{"auto", `iconv("auto"; "utf-8") | ._val`, sjis, samples[0].text},
+		{"from utf-8", `iconv("utf-8"; "cp1251") | ._val`, "Привет", "\xcf\xf0\xe8\xe2\xe5\xf2"},
+		{"latin1 alias", `iconv("latin1"; "UTF-8") | ._val`, "caf\xe9", "café"},
+		{"utf-16 bom", `iconv("UTF-16"; "UTF-8") | ._val`, "\xFF\xFEh\x00i\x00", "hi"},
+		{"to utf-16le", `iconv("UTF-8"; "UTF-16LE") | ._val`, "hi", "h\x00i\x00"},
+		{"round trip", `iconv("UTF-8"; "EUC-KR") | ._val | iconv("EUC-KR"; "UTF-8") | ._val`, samples[4].text, samples[4].text},
+		{"replace unsupported", `iconv("UTF-8"; "ASCII"; {invalid: "replace"}) | ._val`, "café", "caf?"},
+		{"skip unsupported", `iconv("UTF-8"; "windows-1252"; {invalid: "skip"}) | ._val`, "a✓b", "ab"},
+		{"replace invalid", `iconv("UTF-8"; "UTF-8"; {invalid: "replace"}) | ._val`, "a\xffb", "a\uFFFDb"},
+		{"skip invalid", `iconv("Shift_JIS"; "UTF-8"; {invalid: "skip"}) | ._val`, "ab\x82", "ab"},
+		{"bytes array", `iconv("latin1"; "UTF-8") | ._val`, []any{99, 97, 102, 233}, "café"},
+		{"meta", `iconv("auto"; "UTF-8") | ._meta | "\(.from) \(.to) \(.invalid)"`, sjis, "Shift_JIS UTF-8 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query, tt.input, RegisterIconv())
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIconvErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`iconv(1; "UTF-8")`, "x", "iconv: from must be a string"},
+		{`iconv("UTF-8"; 1)`, "x", "iconv: to must be a string"},
+		{`iconv("klingon"; "UTF-8")`, "x", `iconv: unknown charset "klingon"`},
+		{`iconv("UTF-8"; "klingon")`, "x", `iconv: unknown charset "klingon"`},
+		{`iconv("UTF-8"; "UTF-8"; {bogus: 1})`, "x", `iconv: unknown option "bogus"`},
+		{`iconv("UTF-8"; "UTF-8"; {invalid: "maybe"})`, "x", "iconv: options.invalid must be"},
+		{`iconv("UTF-8"; "ASCII")`, "café", `iconv: character 'é' cannot be represented in ASCII`},
+		{`iconv("UTF-8"; "UTF-8")`, "a\xffb", "iconv: input has 1 invalid sequences for UTF-8"},
+		{`iconv("UTF-8"; "UTF-8")`, 5, "iconv: argument must be a string"},
+		{`iconv("auto"; "UTF-8")`, "\x00\x01\x02\x80\xff\x00", "iconv: could not detect the charset"},
+		{`charset_detect`, 5, "charset_detect: argument must be a string"},
+		{`charset_detect(true)`, "/nonexistent/file", "charset_detect: file does not exist"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, RegisterIconv(), RegisterCharsetDetect())
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
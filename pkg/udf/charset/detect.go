@@ -0,0 +1,258 @@
+package charset
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// sampleLen bounds how much of the input the heuristics look at
+const sampleLen = 64 * 1024
+
+// Result is a detected charset and how confident the detection is, from 0 to 1
+type Result struct {
+	Charset    string
+	Confidence float64
+	BOM        bool
+}
+
+// profile scores text decoded with a candidate charset by how much it looks
+// like the languages usually written in that charset
+type profile struct {
+	common  string // frequent characters, worth the most
+	scripts []*unicode.RangeTable
+	// score adjusts the score of r given the rune before it
+	adjust func(prev, r rune) int
+}
+
+var (
+	chineseSimplified  = profile{common: "的一是不了在人有我他这个们中来上大为和国地到以说时要就出也会可你对生能而子那得于着下自之年过发后作里用道行所然家种事成方多经么去法学如都同现当没动面起看定天分还进好小部其些主样理心她本前开但因只从想实日，。、：；？！“”（）", scripts: []*unicode.RangeTable{unicode.Han}}
+	chineseTraditional = profile{common: "的一是不了在人有我他這個們中來上大為和國地到以說時要就出也會可你對生能而子那得於著下自之年過發後作裡用道行所然家種事成方多經麼去法學如都同現當沒動面起看定天分還進好小部其些主樣理心她本前開但因只從想實日，。、：；？！「」（）", scripts: []*unicode.RangeTable{unicode.Han}}
+	japaneseText       = profile{common: "日本人年大十二一中国会出時行見月分後前生五間上東四今金九入学高円子外八六下来気小七山話女北午百書先名川千水半男西電校語土木聞食車何南万毎白天母火右読友左休父雨。、「」・ー", scripts: []*unicode.RangeTable{unicode.Hiragana, unicode.Katakana, unicode.Han}}
+	koreanText         = profile{common: "이다의는에가을를하고한지서도로기사으리자수나대그있것들시어아정게만해인일라요주문적보상부세원제전위구없면거소비여내또우과년무화장학경중생회신방동성말때못", scripts: []*unicode.RangeTable{unicode.Hangul, unicode.Han}}
+	cyrillicText       = profile{common: "оеаинтсрвлкмдпуяыьгзбчй", scripts: []*unicode.RangeTable{unicode.Cyrillic}, adjust: cyrillicCase}
+	latinText          = profile{common: "éèàçüöäßñáíóúêâôîëïûùœ’“”–—€…«»ÉÀÜÖÄ", scripts: []*unicode.RangeTable{unicode.Latin}, adjust: latinRuns}
+)
+
+func init() {
+	// Kana are what sets Japanese apart from Chinese
+	japaneseText.common += kana()
+}
+
+func kana() string {
+	var sb strings.Builder
+	for r := rune(0x3041); r <= 0x30FA; r++ {
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// cyrillicCase penalizes capitals inside words, which is what text in the
+// wrong Cyrillic charset (windows-1251 read as KOI8-R and vice versa) has
+func cyrillicCase(prev, r rune) int {
+	if unicode.Is(unicode.Cyrillic, prev) && unicode.IsLower(prev) && unicode.IsUpper(r) {
+		return -2
+	}
+	return 0
+}
+
+// latinRuns penalizes runs of accented characters. In Western European text
+// they sit between ASCII letters; runs of them are usually multi-byte text
+// read one byte at a time
+func latinRuns(prev, r rune) int {
+	if prev >= 0x80 && !unicode.IsSpace(prev) {
+		return -2
+	}
+	return 0
+}
+
+// candidates are tried in order; on a tie the earlier one wins
+var candidates = []struct {
+	name    string
+	enc     encoding.Encoding
+	profile *profile
+}{
+	{"GB18030", simplifiedchinese.GB18030, &chineseSimplified},
+	{"Big5", traditionalchinese.Big5, &chineseTraditional},
+	{"Shift_JIS", japanese.ShiftJIS, &japaneseText},
+	{"EUC-JP", japanese.EUCJP, &japaneseText},
+	{"EUC-KR", korean.EUCKR, &koreanText},
+	{"windows-1251", charmap.Windows1251, &cyrillicText},
+	{"KOI8-R", charmap.KOI8R, &cyrillicText},
+	{"windows-1252", charmap.Windows1252, &latinText},
+}
+
+// score rates decoded text; ok is false when it cannot be text in the
+// profile's languages at all
+func (p *profile) score(text string) (float64, bool) {
+	total, count := 0, 0
+	prev := rune(0)
+	for _, r := range text {
+		if r < 0x80 {
+			prev = r
+			continue
+		}
+		count++
+		switch {
+		case r == utf8.RuneError:
+			return 0, false
+		case unicode.IsControl(r) || unicode.Is(unicode.Co, r):
+			total -= 3
+		case strings.ContainsRune(p.common, r):
+			total += 3
+		case unicode.IsOneOf(p.scripts, r):
+			total++
+		}
+		if p.adjust != nil {
+			total += p.adjust(prev, r)
+		}
+		prev = r
+	}
+	if count == 0 {
+		return 0, false
+	}
+	avg := float64(total) / float64(count) / 3
+	// A handful of characters is weak evidence
+	if count < 8 {
+		avg *= float64(count) / 8
+	}
+	return min(max(avg, 0), 1), true
+}
+
+// boms are checked longest first, so UTF-32LE is not taken for UTF-16LE
+var boms = []struct {
+	bom  []byte
+	name string
+}{
+	{[]byte{0x00, 0x00, 0xFE, 0xFF}, "UTF-32BE"},
+	{[]byte{0xFF, 0xFE, 0x00, 0x00}, "UTF-32LE"},
+	{[]byte{0xEF, 0xBB, 0xBF}, "UTF-8"},
+	{[]byte{0xFE, 0xFF}, "UTF-16BE"},
+	{[]byte{0xFF, 0xFE}, "UTF-16LE"},
+}
+
+// utf16Order guesses the byte order of UTF-16 without a BOM from where the
+// zero bytes of ASCII characters fall
+func utf16Order(data []byte) string {
+	if len(data) < 4 || len(data)%2 != 0 {
+		return ""
+	}
+	var even, odd int
+	for i, b := range data {
+		if b == 0 {
+			if i%2 == 0 {
+				even++
+			} else {
+				odd++
+			}
+		}
+	}
+	half := len(data) / 2
+	switch {
+	case odd*10 > half*3 && even*20 < half:
+		return "UTF-16LE"
+	case even*10 > half*3 && odd*20 < half:
+		return "UTF-16BE"
+	}
+	return ""
+}
+
+// Detect returns the likely charsets of data, best first. It is empty when
+// data does not look like text in any supported charset
+func Detect(data []byte) []Result {
+	for _, b := range boms {
+		if bytes.HasPrefix(data, b.bom) {
+			return []Result{{Charset: b.name, Confidence: 1, BOM: true}}
+		}
+	}
+
+	sample := data
+	truncated := len(sample) > sampleLen
+	if truncated {
+		sample = sample[:sampleLen]
+	}
+	if name := utf16Order(sample[:len(sample)&^1]); name != "" {
+		return []Result{{Charset: name, Confidence: 0.9}}
+	}
+	// Text in any other charset has no NUL bytes
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return nil
+	}
+
+	ascii := true
+	for _, b := range sample {
+		if b >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return []Result{{Charset: "ASCII", Confidence: 1}}
+	}
+	if validUTF8(sample, truncated) {
+		return []Result{{Charset: "UTF-8", Confidence: 1}}
+	}
+
+	var results []Result
+	for _, c := range candidates {
+		text, err := c.enc.NewDecoder().Bytes(sample)
+		if err != nil {
+			continue
+		}
+		// A character cut off at the end of the sample is not an error
+		if truncated {
+			text = bytes.TrimRight(text, "\uFFFD")
+		}
+		if conf, ok := c.profile.score(string(text)); ok && conf > 0 {
+			results = append(results, Result{Charset: c.name, Confidence: conf})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Confidence > results[j].Confidence
+	})
+
+	// windows-1252 without any of its extra characters is ISO-8859-1
+	for i, r := range results {
+		if r.Charset == "windows-1252" && !hasC1(sample) {
+			results[i].Charset = "ISO-8859-1"
+		}
+	}
+	return results
+}
+
+// hasC1 reports whether data has bytes in 0x80-0x9F, which ISO-8859-1
+// leaves for control characters and windows-1252 uses for punctuation
+func hasC1(data []byte) bool {
+	for _, b := range data {
+		if b >= 0x80 && b <= 0x9F {
+			return true
+		}
+	}
+	return false
+}
+
+// validUTF8 reports whether sample is UTF-8, allowing a character to be cut
+// off at the end of a truncated sample
+func validUTF8(sample []byte, truncated bool) bool {
+	if utf8.Valid(sample) {
+		return true
+	}
+	if !truncated {
+		return false
+	}
+	for i := 1; i < utf8.UTFMax && i < len(sample); i++ {
+		if utf8.Valid(sample[:len(sample)-i]) {
+			return true
+		}
+	}
+	return false
+}
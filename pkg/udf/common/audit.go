@@ -0,0 +1,204 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itchyny/gojq"
+)
+
+// auditSummaryLen bounds the length of the input and each argument in an
+// audit record
+const auditSummaryLen = 200
+
+var (
+	auditMu  sync.Mutex
+	auditLog io.Writer
+)
+
+// SetAuditLog sets where calls of audited UDFs are recorded, one JSON
+// object per line. A nil writer turns auditing off
+func SetAuditLog(w io.Writer) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditLog = w
+}
+
+func auditing() bool {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	return auditLog != nil
+}
+
+// Audited wraps a UDF that touches the filesystem, the network or other
+// programs so that each call is recorded in the audit log
+func Audited(name string, f func(any, []any) any) func(any, []any) any {
+	return func(v any, args []any) any {
+		if !auditing() {
+			return f(v, args)
+		}
+		start := time.Now()
+		result := f(v, args)
+		audit(name, start, v, args, result)
+		return result
+	}
+}
+
+// AuditedIter is Audited for UDFs yielding several values. The call is
+// recorded, with the status of the first value, once that value is ready
+func AuditedIter(name string, f func(any, []any) gojq.Iter) func(any, []any) gojq.Iter {
+	return func(v any, args []any) gojq.Iter {
+		if !auditing() {
+			return f(v, args)
+		}
+		start := time.Now()
+		return &auditIter{iter: f(v, args), record: func(result any) {
+			audit(name, start, v, args, result)
+		}}
+	}
+}
+
+type auditIter struct {
+	iter   gojq.Iter
+	record func(any)
+}
+
+func (it *auditIter) Next() (any, bool) {
+	v, ok := it.iter.Next()
+	if it.record != nil {
+		it.record(v)
+		it.record = nil
+	}
+	return v, ok
+}
+
+func audit(name string, start time.Time, v any, args []any, result any) {
+	record := map[string]any{
+		"time":        start.UTC().Format(time.RFC3339Nano),
+		"function":    name,
+		"input":       auditSummary(v),
+		"duration_ms": time.Since(start).Milliseconds(),
+		"status":      "ok",
+	}
+	summaries := make([]any, len(args))
+	for i, arg := range args {
+		summaries[i] = auditSummary(arg)
+	}
+	record["args"] = summaries
+	if err, ok := result.(error); ok {
+		record["status"], record["error"] = "error", redactString(err.Error())
+	} else if HasUDFError(result) {
+		record["status"], record["error"] = "error", redactString(GetUDFError(result))
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if auditLog != nil {
+		auditLog.Write(append(line, '\n'))
+	}
+}
+
+// auditRedacted replaces values that must not reach the audit log
+const auditRedacted = "[redacted]"
+
+// sensitiveKeys are parts of the names of object keys whose values are
+// credentials, like password or auth_token
+var sensitiveKeys = []string{"password", "passwd", "token", "secret", "auth", "credential",
+	"api_key", "apikey", "private_key", "cookie"}
+
+// urlUserinfo matches the user and password of a URL, like the ":pw@" of
+// redis://:pw@host
+var urlUserinfo = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/?#@\s]*@`)
+
+var (
+	secretsMu sync.RWMutex
+	secrets   = map[string]bool{}
+)
+
+// AddSecretValue has the audit log redact value wherever it appears, for
+// values looked up by secret() that may be passed on to audited UDFs
+func AddSecretValue(value string) {
+	if value == "" {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secrets[value] = true
+}
+
+// isSensitiveKey reports whether the value of an object key is a credential
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString strips the userinfo of URLs and the values of secrets
+func redactString(s string) string {
+	s = urlUserinfo.ReplaceAllString(s, "$1")
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for secret := range secrets {
+		s = strings.ReplaceAll(s, secret, auditRedacted)
+	}
+	return s
+}
+
+// redact copies v without credentials: the values of sensitive keys, the
+// userinfo of URLs and the values of secrets
+func redact(v any) any {
+	switch v := v.(type) {
+	case string:
+		return redactString(v)
+	case []any:
+		redacted := make([]any, len(v))
+		for i, e := range v {
+			redacted[i] = redact(e)
+		}
+		return redacted
+	case map[string]any:
+		redacted := make(map[string]any, len(v))
+		for k, e := range v {
+			if isSensitiveKey(k) && e != nil {
+				redacted[k] = auditRedacted
+			} else {
+				redacted[k] = redact(e)
+			}
+		}
+		return redacted
+	}
+	return v
+}
+
+// auditSummary shortens a value for an audit record, after redacting it.
+// Long strings, and values whose JSON is long, are cut off with an ellipsis
+func auditSummary(v any) any {
+	v = redact(ExtractUDFValue(v))
+	s, ok := v.(string)
+	if !ok {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%T", v)
+		}
+		if len(b) <= auditSummaryLen {
+			return v
+		}
+		s = string(b)
+	}
+	if r := []rune(s); len(r) > auditSummaryLen {
+		return string(r[:auditSummaryLen]) + "…"
+	}
+	return s
+}
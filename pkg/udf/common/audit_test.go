@@ -0,0 +1,147 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func readAudit(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		var r map[string]any
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid audit line %q: %v", line, err)
+		}
+		// The time and duration vary from run to run
+		if _, ok := r["time"].(string); !ok {
+			t.Errorf("record without a time: %s", line)
+		}
+		if _, ok := r["duration_ms"].(float64); !ok {
+			t.Errorf("record without a duration: %s", line)
+		}
+		delete(r, "time")
+		delete(r, "duration_ms")
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestAudited(t *testing.T) {
+	var buf bytes.Buffer
+	SetAuditLog(&buf)
+	defer SetAuditLog(nil)
+
+	f := Audited("fetch", func(v any, args []any) any {
+		if len(args) > 0 {
+			return MakeUDFErrorResult(errors.New("fetch: boom"), nil)
+		}
+		return MakeUDFSuccessResult("ok", nil)
+	})
+	f("http://example.com", nil)
+	f(MakeUDFSuccessResult("/tmp/a", nil), []any{strings.Repeat("x", 300), map[string]any{"a": 1}})
+	Audited("fail", func(any, []any) any { return errors.New("bad input") })(nil, nil)
+
+	want := []map[string]any{
+		{"function": "fetch", "input": "http://example.com", "args": []any{}, "status": "ok"},
+		{"function": "fetch", "input": "/tmp/a", "args": []any{strings.Repeat("x", 200) + "…", map[string]any{"a": 1.0}}, "status": "error", "error": "fetch: boom"},
+		{"function": "fail", "input": nil, "args": []any{}, "status": "error", "error": "bad input"},
+	}
+	if got := readAudit(t, &buf); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAuditedIter(t *testing.T) {
+	var buf bytes.Buffer
+	SetAuditLog(&buf)
+	defer SetAuditLog(nil)
+
+	f := AuditedIter("list", func(v any, args []any) gojq.Iter {
+		if v == nil {
+			return gojq.NewIter[any]()
+		}
+		return gojq.NewIter[any](MakeUDFSuccessResult(1, nil), MakeUDFSuccessResult(2, nil))
+	})
+	for _, input := range []any{"dir", nil} {
+		iter := f(input, nil)
+		for {
+			if _, ok := iter.Next(); !ok {
+				break
+			}
+		}
+	}
+
+	want := []map[string]any{
+		{"function": "list", "input": "dir", "args": []any{}, "status": "ok"},
+		{"function": "list", "input": nil, "args": []any{}, "status": "ok"},
+	}
+	if got := readAudit(t, &buf); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAuditOff(t *testing.T) {
+	calls := 0
+	f := Audited("noop", func(any, []any) any { calls++; return nil })
+	f(nil, nil)
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestAuditSummary(t *testing.T) {
+	long := make([]any, 100)
+	for i := range long {
+		long[i] = i
+	}
+	if got := auditSummary(long).(string); !strings.HasPrefix(got, "[0,1,2,") || !strings.HasSuffix(got, "…") {
+		t.Errorf("long array summary = %q", got)
+	}
+	if got := auditSummary(func() {}); got != "func()" {
+		t.Errorf("unmarshalable summary = %v", got)
+	}
+}
+
+func TestAuditRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	SetAuditLog(&buf)
+	defer SetAuditLog(nil)
+	AddSecretValue("s3cr3t-from-keyring")
+
+	Audited("smtp_send", func(any, []any) any { return MakeUDFSuccessResult(nil, nil) })(
+		map[string]any{"to": "a@example.com", "body": "hi"},
+		[]any{"h:25", map[string]any{"username": "u", "password": "hunter2-SECRET", "headers": map[string]any{"X-Auth-Token": "abc"}}})
+	Audited("redis_get", func(any, []any) any {
+		return MakeUDFErrorResult(errors.New("redis_get: dial redis://:pw-REDIS@host:6379/0: connection refused"), nil)
+	})("key", []any{"redis://:pw-REDIS@host:6379/0"})
+	Audited("http", func(any, []any) any { return MakeUDFSuccessResult(nil, nil) })(
+		"https://api.example.com", []any{map[string]any{"query": "token is s3cr3t-from-keyring"}})
+
+	log := buf.String()
+	for _, leak := range []string{"hunter2-SECRET", "pw-REDIS", "abc", "s3cr3t-from-keyring"} {
+		if strings.Contains(log, leak) {
+			t.Errorf("audit log contains %q:\n%s", leak, log)
+		}
+	}
+	records := readAudit(t, &buf)
+	want := []any{"h:25", map[string]any{"username": "u", "password": "[redacted]", "headers": map[string]any{"X-Auth-Token": "[redacted]"}}}
+	if got := records[0]["args"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("smtp args = %v, want %v", got, want)
+	}
+	if got := records[1]["args"]; !reflect.DeepEqual(got, []any{"redis://host:6379/0"}) {
+		t.Errorf("redis args = %v", got)
+	}
+	if got := records[1]["error"]; got != "redis_get: dial redis://host:6379/0: connection refused" {
+		t.Errorf("redis error = %v", got)
+	}
+}
@@ -0,0 +1,71 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// BytesValue represents binary data as an array of byte values. Unlike a
+// string it survives JSON output and jq string functions intact, and UDFs
+// that take bytes accept it as input
+func BytesValue(b []byte) []any {
+	out := make([]any, len(b))
+	for i, c := range b {
+		out[i] = int(c)
+	}
+	return out
+}
+
+// BytesFromValue returns the bytes of an array made by BytesValue. It
+// reports false if any element is not an integer from 0 to 255
+func BytesFromValue(v any) ([]byte, bool) {
+	arr, ok := v.([]any)
+	if !ok {
+		return nil, false
+	}
+	out := make([]byte, len(arr))
+	for i, e := range arr {
+		switch n := e.(type) {
+		case int:
+			if n < 0 || n > 255 {
+				return nil, false
+			}
+			out[i] = byte(n)
+		case float64:
+			if n < 0 || n > 255 || n != math.Trunc(n) {
+				return nil, false
+			}
+			out[i] = byte(n)
+		default:
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// InputBytes returns the bytes of a string, a []byte, an array made by
+// BytesValue, a reader or a value with a String method. The error reads
+// well after the name of the UDF
+func InputBytes(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case []any:
+		if b, ok := BytesFromValue(v); ok {
+			return b, nil
+		}
+		return nil, Errorf(CodeInvalid, "array input must be bytes (integers 0-255)")
+	case io.Reader:
+		b, err := io.ReadAll(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input: %w", err)
+		}
+		return b, nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	}
+	return nil, Errorf(CodeInvalid, "argument must be a string or bytes, got %T", v)
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInputBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   any
+		want    []byte
+		wantErr string
+	}{
+		{
+			name:  "string",
+			input: "hi",
+			want:  []byte("hi"),
+		},
+		{
+			name:  "byte slice",
+			input: []byte{0, 255},
+			want:  []byte{0, 255},
+		},
+		{
+			name:  "bytes array",
+			input: BytesValue([]byte{1, 2, 200}),
+			want:  []byte{1, 2, 200},
+		},
+		{
+			name:  "bytes array of floats",
+			input: []any{104.0, 105.0},
+			want:  []byte("hi"),
+		},
+		{
+			name:  "reader",
+			input: strings.NewReader("hi"),
+			want:  []byte("hi"),
+		},
+		{
+			name:    "array out of range",
+			input:   []any{1, 256},
+			wantErr: "array input must be bytes (integers 0-255)",
+		},
+		{
+			name:    "number",
+			input:   42,
+			wantErr: "argument must be a string or bytes, got int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InputBytes(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("InputBytes() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InputBytes() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("InputBytes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	cacheMu  sync.Mutex
+	cacheDir string
+	cacheTTL time.Duration
+)
+
+// SetCache turns on the cache of network UDF responses, kept in dir, or
+// turns it off when dir is empty. ttl is how long a response is kept when
+// it does not say itself
+func SetCache(dir string, ttl time.Duration) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cacheDir, cacheTTL = dir, ttl
+}
+
+// CacheEnabled reports whether responses are cached at all
+func CacheEnabled() bool {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	return cacheDir != ""
+}
+
+type cacheEntry struct {
+	Key     string          `json:"key"`
+	Expires time.Time       `json:"expires"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// cachePath names the file of an entry after the SHA-256 of its key, in a
+// subdirectory per first byte to keep directories small
+func cachePath(dir, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(dir, name[:2], name+".json")
+}
+
+// CacheGet decodes the entry stored under key into v, and reports whether
+// there was one that has not expired
+func CacheGet(key string, v any) bool {
+	cacheMu.Lock()
+	dir := cacheDir
+	cacheMu.Unlock()
+	if dir == "" {
+		return false
+	}
+	data, err := os.ReadFile(cachePath(dir, key))
+	if err != nil {
+		return false
+	}
+	var e cacheEntry
+	if json.Unmarshal(data, &e) != nil || e.Key != key || time.Now().After(e.Expires) {
+		return false
+	}
+	return json.Unmarshal(e.Value, v) == nil
+}
+
+// CachePut stores v under key for maxAge, or for the TTL given to SetCache
+// when maxAge is negative
+func CachePut(key string, v any, maxAge time.Duration) error {
+	cacheMu.Lock()
+	dir, ttl := cacheDir, cacheTTL
+	cacheMu.Unlock()
+	if dir == "" {
+		return nil
+	}
+	if maxAge < 0 {
+		maxAge = ttl
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cacheEntry{key, time.Now().Add(maxAge).UTC(), value})
+	if err != nil {
+		return err
+	}
+	path := cachePath(dir, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Runs in parallel may fill the same entry; each sees a whole file
+	return WriteFileAtomic(path, data, 0600)
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	defer SetCache("", 0)
+
+	var v map[string]int
+	if CacheEnabled() || CacheGet("k", &v) {
+		t.Fatal("cache enabled by default")
+	}
+	if err := CachePut("k", map[string]int{"a": 1}, -1); err != nil {
+		t.Fatalf("CachePut with the cache off = %v", err)
+	}
+
+	SetCache(t.TempDir(), time.Hour)
+	if CacheGet("k", &v) {
+		t.Fatal("CacheGet found an entry in an empty cache")
+	}
+	if err := CachePut("k", map[string]int{"a": 1}, -1); err != nil {
+		t.Fatal(err)
+	}
+	if !CacheGet("k", &v) || v["a"] != 1 {
+		t.Errorf("CacheGet = %v, want the stored entry", v)
+	}
+	if CacheGet("other", &v) {
+		t.Errorf("CacheGet found an entry under another key")
+	}
+
+	// Entries past their age are gone
+	if err := CachePut("old", 1, time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	var n int
+	if CacheGet("old", &n) {
+		t.Errorf("CacheGet returned an expired entry")
+	}
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	contextMu  sync.Mutex
+	runContext = context.Background()
+	udfTimeout time.Duration
+)
+
+// SetContext sets the context every UDF call runs under, usually the one
+// bounding the whole run, and the time limit of a single call. A zero
+// timeout leaves calls bounded by ctx alone
+func SetContext(ctx context.Context, timeout time.Duration) {
+	contextMu.Lock()
+	defer contextMu.Unlock()
+	runContext, udfTimeout = ctx, timeout
+}
+
+// Context returns the context for a UDF call that waits on the network or
+// on other programs. The caller must call cancel once the call is done
+func Context() (context.Context, context.CancelFunc) {
+	contextMu.Lock()
+	ctx, timeout := runContext, udfTimeout
+	contextMu.Unlock()
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// SetDeadline applies the deadline of ctx, if it has one, to a connection
+func SetDeadline(ctx context.Context, conn interface{ SetDeadline(time.Time) error }) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+}
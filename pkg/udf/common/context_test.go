@@ -0,0 +1,35 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestContext(t *testing.T) {
+	defer SetContext(context.Background(), 0)
+
+	ctx, cancel := Context()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("default context has a deadline")
+	}
+	cancel()
+
+	SetContext(context.Background(), time.Minute)
+	ctx, cancel = Context()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("deadline = %v, %v, want within a minute", deadline, ok)
+	}
+	cancel()
+
+	run, stop := context.WithCancel(context.Background())
+	SetContext(run, time.Minute)
+	ctx, cancel = Context()
+	defer cancel()
+	stop()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("call context not done after the run was stopped")
+	}
+}
@@ -1,33 +1,233 @@
 package common
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Codes of the _err of UDF results, for queries to branch on, like
+// select(._err.code == "ENOENT")
+const (
+	CodeNotFound   = "ENOENT"    // a file, key or other resource doesn't exist
+	CodeExists     = "EEXIST"    // it exists, and must not
+	CodePermission = "EACCES"    // the system or the sandbox denied access
+	CodeInvalid    = "EINVAL"    // an argument or the input is not valid
+	CodeTimeout    = "ETIMEDOUT" // the call or the run ran out of time
+	CodeCanceled   = "ECANCELED" // the run was stopped
+	CodeNetwork    = "ENET"      // a connection failed or was cut
+	CodeExit       = "EEXIT"     // a program exited with a non-zero code
+	CodeFailed     = "EFAIL"     // any other failure
+)
+
+// UDFError is an error with the code and details the _err of a UDF result
+// carries. Other errors get a code from the errors they wrap, or else from
+// their message
+type UDFError struct {
+	Code    string
+	Message string
+	Details map[string]any // about the failure, like the path of a file
+	Err     error          // the error wrapped, if any
+}
+
+func (e *UDFError) Error() string {
+	return e.Message
+}
+
+func (e *UDFError) Unwrap() error {
+	return e.Err
+}
+
+// Errorf formats an error with a code, wrapping the error of a %w verb
+func Errorf(code, format string, args ...any) *UDFError {
+	err := fmt.Errorf(format, args...)
+	return &UDFError{Code: code, Message: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// WithDetails adds details about the failure to e, and returns it
+func (e *UDFError) WithDetails(details map[string]any) *UDFError {
+	if e.Details == nil {
+		e.Details = make(map[string]any, len(details))
+	}
+	for k, v := range details {
+		e.Details[k] = v
+	}
+	return e
+}
+
+// messageCodes classify errors by their message, for errors from other
+// packages that are not of a type ErrorCode knows. The first code matching
+// wins
+var messageCodes = []struct {
+	code    string
+	phrases []string
+}{
+	{CodeTimeout, []string{"timed out", "deadline exceeded"}},
+	{CodeCanceled, []string{"context canceled"}},
+	{CodePermission, []string{"permission denied", "operation not permitted"}},
+	{CodeNotFound, []string{"no such file", "does not exist", "not found"}},
+	{CodeExists, []string{"already exists", "file exists"}},
+	{CodeNetwork, []string{"connection refused", "connection reset", "no such host",
+		"network is unreachable", "broken pipe"}},
+	{CodeInvalid, []string{"invalid", "malformed", "syntax error", "unexpected eof"}},
+}
+
+// messageCode returns the code of the first messageCodes phrase in msg, or
+// CodeFailed
+func messageCode(msg string) string {
+	msg = strings.ToLower(msg)
+	for _, mc := range messageCodes {
+		for _, phrase := range mc.phrases {
+			if strings.Contains(msg, phrase) {
+				return mc.code
+			}
+		}
+	}
+	return CodeFailed
+}
+
+// ErrorCode returns the code of an error, one of the Code constants. It is
+// the code of the first UDFError err wraps, or else follows from the
+// errors of the standard library err wraps. As a last resort the message
+// of the innermost error is classified, if err wraps one: that is the
+// message of the package that failed, without the values a UDF put around
+// it, which may be anything the query gave
+func ErrorCode(err error) string {
+	var udfErr *UDFError
+	if errors.As(err, &udfErr) && udfErr.Code != "" {
+		return udfErr.Code
+	}
+	var (
+		netErr    net.Error
+		numErr    *strconv.NumError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, fs.ErrNotExist):
+		return CodeNotFound
+	case errors.Is(err, fs.ErrExist):
+		return CodeExists
+	case errors.Is(err, fs.ErrPermission):
+		return CodePermission
+	case netErr != nil, errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EHOSTUNREACH):
+		return CodeNetwork
+	case errors.As(err, &numErr), errors.As(err, &syntaxErr), errors.As(err, &typeErr),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return CodeInvalid
+	}
+	inner := err
+	for {
+		next := errors.Unwrap(inner)
+		if next == nil {
+			break
+		}
+		inner = next
+	}
+	if inner == err {
+		return CodeFailed
+	}
+	return messageCode(inner.Error())
+}
+
+// Retryable reports whether a call failing with the code may succeed if
+// made again
+func Retryable(code string) bool {
+	return code == CodeTimeout || code == CodeNetwork
+}
+
+// UDFErrorValue returns the _err of a UDF result failing with err:
+// {code, message, function, retryable, details}. The function is filled in
+// by WithFunction and WithIterFunction, and details are left out when there
+// are none
+func UDFErrorValue(err error) map[string]any {
+	code := ErrorCode(err)
+	value := map[string]any{
+		"code":      code,
+		"message":   err.Error(),
+		"function":  "",
+		"retryable": Retryable(code),
+	}
+	details := map[string]any{}
+	var udfErr *UDFError
+	if errors.As(err, &udfErr) {
+		for k, v := range udfErr.Details {
+			details[k] = v
+		}
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		details["path"], details["op"] = pathErr.Path, pathErr.Op
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		details["url"] = urlErr.URL
+	}
+	if len(details) > 0 {
+		value["details"] = details
+	}
+	return value
+}
+
 // MakeUDFErrorResult creates a UDF result object with an error
-// Returns {_val: null, _meta: {...}, _err: errorMessage}
+// Returns {_schema: 2, _val: null, _meta: {...}, _err: {code, message, function, retryable, details}}
 func MakeUDFErrorResult(err error, meta map[string]any) map[string]any {
 	if meta == nil {
 		meta = make(map[string]any)
 	}
-	
+
 	result := map[string]any{
-		"_val":  nil,
-		"_meta": meta,
-		"_err":  err.Error(),
+		"_schema": UDFSchemaVersion,
+		"_val":    nil,
+		"_meta":   meta,
+		"_err":    UDFErrorValue(err),
 	}
-	
+
 	return result
 }
 
 // MakeUDFSuccessResult creates a UDF result object with a value
-// Returns {_val: value, _meta: {...}}
+// Returns {_schema: 2, _val: value, _meta: {...}}, and with SetProvenance on, a record
+// of the call in _meta.chain
 func MakeUDFSuccessResult(value any, meta map[string]any) map[string]any {
 	if meta == nil {
 		meta = make(map[string]any)
 	}
-	
+	if recordingProvenance() {
+		meta["chain"] = []any{provenanceRecord(meta)}
+	}
+
 	result := map[string]any{
-		"_val":  value,
-		"_meta": meta,
+		"_schema": UDFSchemaVersion,
+		"_val":    value,
+		"_meta":   meta,
 	}
-	
+
 	return result
 }
 
+// nameUDFError fills in the function of the _err of a UDF result that
+// doesn't name one yet
+func nameUDFError(name string, v any) any {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	if e, ok := obj["_err"].(map[string]any); ok && e["function"] == "" {
+		e["function"] = name
+	}
+	return v
+}
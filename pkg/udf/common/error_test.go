@@ -0,0 +1,96 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func TestErrorCode(t *testing.T) {
+	_, statErr := os.Stat(filepath.Join(t.TempDir(), "missing"))
+	_, numErr := strconv.Atoi("x")
+	defer SetPolicy(Policy{})
+	SetPolicy(Policy{NoFS: true})
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"wrapped fs error", fmt.Errorf("cat: %w", statErr), CodeNotFound},
+		{"fs sentinel", fs.ErrExist, CodeExists},
+		{"deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), CodeTimeout},
+		{"canceled", context.Canceled, CodeCanceled},
+		{"refused", &url.Error{Op: "Get", URL: "http://timeout.example/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}, CodeNetwork},
+		{"number", fmt.Errorf("count: %w", numErr), CodeInvalid},
+		{"sandbox", CheckExec(), CodePermission},
+		{"library message", fmt.Errorf("parse %q: %w", "timed out", errors.New("invalid character")), CodeInvalid},
+		{"own message is not classified", errors.New("width must be positive, got timeout"), CodeFailed},
+		{"code wins over message", Errorf(CodeExit, "no such file"), CodeExit},
+		{"code wraps", fmt.Errorf("outer: %w", Errorf(CodeNetwork, "down")), CodeNetwork},
+		{"other", errors.New("something broke"), CodeFailed},
+	}
+	for _, tt := range tests {
+		if got := ErrorCode(tt.err); got != tt.want {
+			t.Errorf("%s: ErrorCode(%q) = %s, want %s", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestUDFErrorValue(t *testing.T) {
+	_, statErr := os.Stat("missing.txt")
+	got := UDFErrorValue(fmt.Errorf("stat: %w", statErr))
+	want := map[string]any{
+		"code":      CodeNotFound,
+		"message":   "stat: stat missing.txt: no such file or directory",
+		"function":  "",
+		"retryable": false,
+		"details":   map[string]any{"op": "stat", "path": "missing.txt"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got = UDFErrorValue(Errorf(CodeTimeout, "gave up after %ds", 5).WithDetails(map[string]any{"seconds": 5}))
+	want = map[string]any{
+		"code":      CodeTimeout,
+		"message":   "gave up after 5s",
+		"function":  "",
+		"retryable": true,
+		"details":   map[string]any{"seconds": 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestErrorFunctionName(t *testing.T) {
+	query, err := gojq.Parse(`fail, (fail | ._err.function)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query, WithFunction("fail", 0, 0, func(any, []any) any {
+		return MakeUDFErrorResult(errors.New("broken"), nil)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter := code.Run(nil)
+	first, _ := iter.Next()
+	if got := GetUDFErrorCode(first); got != CodeFailed {
+		t.Errorf("code = %q, want %s", got, CodeFailed)
+	}
+	if name, _ := iter.Next(); name != "fail" {
+		t.Errorf("function = %v, want fail", name)
+	}
+}
@@ -36,20 +36,19 @@ func ParseFileArgs(v any, args []any) (any, bool, error) {
 	return inputVal, isFile, nil
 }
 
-// ReadFileFromPath reads a file from a path string, handling ~ expansion and absolute path resolution.
-// Returns: fileData, absPath, fileSize, error
-func ReadFileFromPath(filePath string) ([]byte, string, int64, error) {
+// ResolvePath expands a leading ~ and converts the path to an absolute path
+func ResolvePath(filePath string) (string, error) {
 	// Expand ~ to home directory
 	if filePath == "~" {
 		home, err := os.UserHomeDir()
 		if err != nil {
-			return nil, "", 0, fmt.Errorf("cannot determine home directory: %v", err)
+			return "", fmt.Errorf("cannot determine home directory: %w", err)
 		}
 		filePath = home
 	} else if len(filePath) > 0 && filePath[0] == '~' && (len(filePath) == 1 || filePath[1] == '/') {
 		home, err := os.UserHomeDir()
 		if err != nil {
-			return nil, "", 0, fmt.Errorf("cannot determine home directory: %v", err)
+			return "", fmt.Errorf("cannot determine home directory: %w", err)
 		}
 		if len(filePath) > 1 {
 			filePath = filepath.Join(home, filePath[2:])
@@ -61,19 +60,26 @@ func ReadFileFromPath(filePath string) ([]byte, string, int64, error) {
 	// Convert to absolute path
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
-		return nil, "", 0, fmt.Errorf("cannot resolve path %q: %v", filePath, err)
+		return "", fmt.Errorf("cannot resolve path %q: %w", filePath, err)
+	}
+	return absPath, nil
+}
+
+// ReadFileFromPath reads a file from a path string, handling ~ expansion and absolute path resolution.
+// Returns: fileData, absPath, fileSize, error
+func ReadFileFromPath(filePath string) ([]byte, string, int64, error) {
+	absPath, err := ResolvePath(filePath)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if err := CheckRead(absPath); err != nil {
+		return nil, "", 0, err
 	}
 
 	// Read file contents
-	fileData, err := os.ReadFile(absPath)
+	fileData, err := ReadFile(absPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, "", 0, fmt.Errorf("file does not exist: %q", absPath)
-		}
-		if os.IsPermission(err) {
-			return nil, "", 0, fmt.Errorf("permission denied reading file: %q", absPath)
-		}
-		return nil, "", 0, fmt.Errorf("failed to read file %q: %v", absPath, err)
+		return nil, "", 0, fileError(absPath, err)
 	}
 
 	// Get file info for metadata
@@ -86,3 +92,67 @@ func ReadFileFromPath(filePath string) ([]byte, string, int64, error) {
 	return fileData, absPath, fileSize, nil
 }
 
+// OpenFileFromPath opens a file for streaming, with the same path handling
+// and error messages as ReadFileFromPath. The caller must close the file.
+// Returns: file, absPath, fileSize, error
+func OpenFileFromPath(filePath string) (*os.File, string, int64, error) {
+	absPath, err := ResolvePath(filePath)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if err := CheckRead(absPath); err != nil {
+		return nil, "", 0, err
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		return nil, "", 0, fileError(absPath, err)
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, "", 0, fmt.Errorf("failed to stat file %q: %w", absPath, err)
+	}
+	if fileInfo.IsDir() {
+		file.Close()
+		return nil, "", 0, Errorf(CodeInvalid, "path is a directory: %q", absPath)
+	}
+
+	return file, absPath, fileInfo.Size(), nil
+}
+
+// WriteFileAtomic replaces path with data through a temporary file in the
+// same directory, so readers see either the old or the new contents
+func WriteFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func fileError(absPath string, err error) error {
+	if os.IsNotExist(err) {
+		return Errorf(CodeNotFound, "file does not exist: %q", absPath).WithDetails(map[string]any{"path": absPath})
+	}
+	if os.IsPermission(err) {
+		return Errorf(CodePermission, "permission denied reading file: %q", absPath).WithDetails(map[string]any{"path": absPath})
+	}
+	return fmt.Errorf("failed to read file %q: %w", absPath, err)
+}
@@ -0,0 +1,176 @@
+package common
+
+import (
+	"sync"
+	"time"
+
+	"github.com/itchyny/gojq"
+)
+
+// Call describes one UDF call, or one value of a UDF yielding several, as
+// seen by a call observer
+type Call struct {
+	Name     string
+	Input    any
+	Args     []any
+	Output   any
+	Duration time.Duration // time taken to produce Output
+	Seq      int           // index of Output among the values of the call
+	End      bool          // the call yielded no more values; Output is unset
+	Site     int           // the place of the call in the query, from 1, when compiled with WithCallSite; 0 otherwise
+}
+
+var (
+	observeMu sync.RWMutex
+	observers = map[int]func(Call){}
+	observeID int
+)
+
+// AddCallObserver has f called after every call of a UDF registered through
+// WithFunction or WithIterFunction, possibly from several goroutines at once.
+// The returned function removes the observer
+func AddCallObserver(f func(Call)) (remove func()) {
+	observeMu.Lock()
+	defer observeMu.Unlock()
+	observeID++
+	id := observeID
+	observers[id] = f
+	return func() {
+		observeMu.Lock()
+		defer observeMu.Unlock()
+		delete(observers, id)
+	}
+}
+
+func observing() bool {
+	observeMu.RLock()
+	defer observeMu.RUnlock()
+	return len(observers) > 0
+}
+
+func notify(c Call) {
+	observeMu.RLock()
+	defer observeMu.RUnlock()
+	for _, f := range observers {
+		f(c)
+	}
+}
+
+// udfDef is a UDF as registered through WithFunction or WithIterFunction,
+// with one of f and iter set
+type udfDef struct {
+	minarity, maxarity int
+	f                  func(any, []any) any
+	iter               func(any, []any) gojq.Iter
+}
+
+var (
+	defsMu  sync.RWMutex
+	udfDefs = map[string]udfDef{}
+)
+
+func define(name string, def udfDef) {
+	defsMu.Lock()
+	defer defsMu.Unlock()
+	udfDefs[name] = def
+}
+
+// WithFunction is gojq.WithFunction for UDFs, making their calls visible to
+// call observers, naming the function in the _err of their results, and
+// carrying the provenance chain of the input to them
+func WithFunction(name string, minarity, maxarity int, f func(any, []any) any) gojq.CompilerOption {
+	define(name, udfDef{minarity: minarity, maxarity: maxarity, f: f})
+	return gojq.WithFunction(name, minarity, maxarity, observedFunction(name, 0, f))
+}
+
+// WithIterFunction is gojq.WithIterFunction for UDFs, making each value they
+// yield visible to call observers, naming the function in the _err of their
+// results, and carrying the provenance chain of the input to them
+func WithIterFunction(name string, minarity, maxarity int, f func(any, []any) gojq.Iter) gojq.CompilerOption {
+	define(name, udfDef{minarity: minarity, maxarity: maxarity, iter: f})
+	return gojq.WithIterFunction(name, minarity, maxarity, observedIterFunction(name, 0, f))
+}
+
+// WithCallSite registers the UDF name, as registered through WithFunction
+// or WithIterFunction, again as alias for one place in a query, so that
+// call observers see its calls from there with the Site given. A query
+// calling alias instead of name at that place then behaves the same. ok is
+// false if no UDF name was registered
+func WithCallSite(alias, name string, site int) (option gojq.CompilerOption, ok bool) {
+	defsMu.RLock()
+	def, ok := udfDefs[name]
+	defsMu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	if def.iter != nil {
+		return gojq.WithIterFunction(alias, def.minarity, def.maxarity, observedIterFunction(name, site, def.iter)), true
+	}
+	return gojq.WithFunction(alias, def.minarity, def.maxarity, observedFunction(name, site, def.f)), true
+}
+
+func observedFunction(name string, site int, f func(any, []any) any) func(any, []any) any {
+	return func(v any, args []any) any {
+		if !observing() {
+			return finishUDFResult(name, v, f(v, args))
+		}
+		start := time.Now()
+		result := finishUDFResult(name, v, f(v, args))
+		notify(Call{Name: name, Input: v, Args: args, Output: result, Duration: time.Since(start), Site: site})
+		return result
+	}
+}
+
+func observedIterFunction(name string, site int, f func(any, []any) gojq.Iter) func(any, []any) gojq.Iter {
+	return func(v any, args []any) gojq.Iter {
+		if !observing() {
+			return &namedIter{iter: f(v, args), name: name, input: v}
+		}
+		start := time.Now()
+		iter := &namedIter{iter: f(v, args), name: name, input: v}
+		return &observedIter{iter: iter, call: Call{Name: name, Input: v, Args: args, Site: site}, setup: time.Since(start)}
+	}
+}
+
+// namedIter finishes the values of an iterator like WithFunction does
+type namedIter struct {
+	iter  gojq.Iter
+	name  string
+	input any
+}
+
+func (it *namedIter) Next() (any, bool) {
+	v, ok := it.iter.Next()
+	return finishUDFResult(it.name, it.input, v), ok
+}
+
+// finishUDFResult names the function in a result of a UDF called with
+// input, and carries the provenance chain of the input to it
+func finishUDFResult(name string, input, v any) any {
+	return chainUDFResult(name, input, nameUDFError(name, v))
+}
+
+type observedIter struct {
+	iter  gojq.Iter
+	call  Call
+	setup time.Duration // time taken by the call itself, before any value
+	done  bool
+}
+
+func (it *observedIter) Next() (any, bool) {
+	start := time.Now()
+	v, ok := it.iter.Next()
+	if it.done {
+		return v, ok
+	}
+	c := it.call
+	c.Duration, it.setup = time.Since(start)+it.setup, 0
+	if ok {
+		c.Output = v
+	} else {
+		c.End, it.done = true, true
+	}
+	notify(c)
+	it.call.Seq++
+	return v, ok
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func TestCallObserver(t *testing.T) {
+	var mu sync.Mutex
+	var calls []Call
+	remove := AddCallObserver(func(c Call) {
+		mu.Lock()
+		defer mu.Unlock()
+		c.Duration = 0
+		calls = append(calls, c)
+	})
+
+	query, err := gojq.Parse(`double, (.[] | pair), (null | pair)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query,
+		WithFunction("double", 0, 0, func(v any, _ []any) any {
+			return MakeUDFSuccessResult(len(v.([]any))*2, nil)
+		}),
+		WithIterFunction("pair", 0, 0, func(v any, _ []any) gojq.Iter {
+			if v == nil {
+				return gojq.NewIter[any]()
+			}
+			return gojq.NewIter(v, v)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter := code.Run([]any{1})
+	for {
+		if _, ok := iter.Next(); !ok {
+			break
+		}
+	}
+	remove()
+	code.Run([]any{2}).Next()
+
+	want := []Call{
+		{Name: "double", Input: []any{1}, Args: []any{}, Output: MakeUDFSuccessResult(2, nil)},
+		{Name: "pair", Input: 1, Args: []any{}, Output: 1},
+		{Name: "pair", Input: 1, Args: []any{}, Output: 1, Seq: 1},
+		{Name: "pair", Input: 1, Args: []any{}, Seq: 2, End: true},
+		{Name: "pair", Args: []any{}, End: true},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+// Policy limits what UDFs may do, for running queries that are not trusted.
+// The zero Policy allows everything
+type Policy struct {
+	NoNet    bool     // no network access
+	NoFS     bool     // no filesystem access
+	ReadOnly bool     // files may be read but not created, changed or removed
+	Paths    []string // when set, files must be under one of these directories
+	Hosts    []string // when set, network access is limited to these hosts and their subdomains
+}
+
+var policy Policy
+
+// SetPolicy sets the policy the Check functions enforce. It must be set
+// before any query runs
+func SetPolicy(p Policy) error {
+	paths := make([]string, len(p.Paths))
+	for i, path := range p.Paths {
+		abs, err := ResolvePath(path)
+		if err != nil {
+			return err
+		}
+		paths[i] = realPath(abs)
+	}
+	hosts := make([]string, len(p.Hosts))
+	for i, host := range p.Hosts {
+		hosts[i] = strings.ToLower(strings.TrimPrefix(host, "."))
+	}
+	p.Paths, p.Hosts = paths, hosts
+	policy = p
+	return nil
+}
+
+// restricted reports whether the policy limits anything
+func (p Policy) restricted() bool {
+	return p.NoNet || p.NoFS || p.ReadOnly || len(p.Paths) > 0 || len(p.Hosts) > 0
+}
+
+// CheckRead reports whether a file or directory may be read
+func CheckRead(path string) error {
+	if policy.NoFS {
+		return Errorf(CodePermission, "filesystem access is disabled")
+	}
+	return checkPath(path)
+}
+
+// CheckWrite reports whether a file or directory may be created, changed or
+// removed
+func CheckWrite(path string) error {
+	if policy.NoFS {
+		return Errorf(CodePermission, "filesystem access is disabled")
+	}
+	if policy.ReadOnly {
+		return Errorf(CodePermission, "cannot write %q: filesystem is read-only", path)
+	}
+	return checkPath(path)
+}
+
+func checkPath(path string) error {
+	if len(policy.Paths) == 0 {
+		return nil
+	}
+	abs, err := ResolvePath(path)
+	if err != nil {
+		return err
+	}
+	// Following symlinks keeps a link inside an allowed directory from
+	// reaching outside it
+	real := realPath(abs)
+	for _, dir := range policy.Paths {
+		if rel, err := filepath.Rel(dir, real); err == nil &&
+			rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return Errorf(CodePermission, "access to %q is outside the allowed paths", path)
+}
+
+// realPath resolves the symlinks in path, as far as the path exists
+func realPath(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(realPath(parent), filepath.Base(path))
+}
+
+// CheckNet reports whether a host may be connected to, or listened on.
+// addr is a host name or address, with or without a port
+func CheckNet(addr string) error {
+	if policy.NoNet {
+		return Errorf(CodePermission, "network access is disabled")
+	}
+	if len(policy.Hosts) == 0 {
+		return nil
+	}
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	for _, allowed := range policy.Hosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+	return Errorf(CodePermission, "network access to %q is not allowed", host)
+}
+
+// CheckExec reports whether external programs may run. A program could do
+// anything, so any restriction rules them out
+func CheckExec() error {
+	if policy.restricted() {
+		return Errorf(CodePermission, "running external programs is disabled by the sandbox")
+	}
+	return nil
+}
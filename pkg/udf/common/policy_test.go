@@ -0,0 +1,107 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setPolicy(t *testing.T, p Policy) {
+	t.Helper()
+	if err := SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { policy = Policy{} })
+}
+
+func checkErr(t *testing.T, name string, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("%s: unexpected error: %v", name, err)
+	case want != "" && err == nil:
+		t.Errorf("%s: expected error containing %q", name, want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Errorf("%s: got error %q, want it to contain %q", name, err, want)
+	}
+}
+
+func TestPolicyDefault(t *testing.T) {
+	checkErr(t, "read", CheckRead("/etc/passwd"), "")
+	checkErr(t, "write", CheckWrite("/tmp/x"), "")
+	checkErr(t, "net", CheckNet("example.com:443"), "")
+	checkErr(t, "exec", CheckExec(), "")
+}
+
+func TestPolicyNoFSAndNoNet(t *testing.T) {
+	setPolicy(t, Policy{NoFS: true, NoNet: true})
+	checkErr(t, "read", CheckRead("x"), "filesystem access is disabled")
+	checkErr(t, "write", CheckWrite("x"), "filesystem access is disabled")
+	checkErr(t, "net", CheckNet("example.com"), "network access is disabled")
+	checkErr(t, "exec", CheckExec(), "running external programs is disabled")
+
+	_, _, _, err := ReadFileFromPath("policy.go")
+	checkErr(t, "ReadFileFromPath", err, "filesystem access is disabled")
+}
+
+func TestPolicyReadOnly(t *testing.T) {
+	setPolicy(t, Policy{ReadOnly: true})
+	checkErr(t, "read", CheckRead("policy.go"), "")
+	checkErr(t, "write", CheckWrite("out.json"), `cannot write "out.json": filesystem is read-only`)
+	checkErr(t, "net", CheckNet("example.com"), "")
+	checkErr(t, "exec", CheckExec(), "running external programs is disabled")
+}
+
+func TestPolicyPaths(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	if err := os.Mkdir(allowed, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A link inside the allowed directory to the directory above it
+	if err := os.Symlink(dir, filepath.Join(allowed, "up")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	setPolicy(t, Policy{Paths: []string{allowed}})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{allowed, ""},
+		{filepath.Join(allowed, "a.txt"), ""},
+		{filepath.Join(allowed, "new", "dir", "b.txt"), ""},
+		{filepath.Join(allowed, "..", "allowed", "c.txt"), ""},
+		{dir, "outside the allowed paths"},
+		{filepath.Join(dir, "allowed-not"), "outside the allowed paths"},
+		{filepath.Join(allowed, "..", "x"), "outside the allowed paths"},
+		{filepath.Join(allowed, "up", "secret"), "outside the allowed paths"},
+	}
+	for _, tt := range tests {
+		checkErr(t, "read "+tt.path, CheckRead(tt.path), tt.want)
+		checkErr(t, "write "+tt.path, CheckWrite(tt.path), tt.want)
+	}
+}
+
+func TestPolicyHosts(t *testing.T) {
+	setPolicy(t, Policy{Hosts: []string{"Example.com", ".internal", "127.0.0.1", "::1"}})
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"example.com", ""},
+		{"api.example.com:443", ""},
+		{"EXAMPLE.COM", ""},
+		{"db.internal:5432", ""},
+		{"127.0.0.1:6379", ""},
+		{"[::1]:8080", ""},
+		{"badexample.com", `network access to "badexample.com" is not allowed`},
+		{"example.com.evil.net", "is not allowed"},
+		{"10.0.0.1:80", "is not allowed"},
+		{"", "is not allowed"},
+	}
+	for _, tt := range tests {
+		checkErr(t, tt.addr, CheckNet(tt.addr), tt.want)
+	}
+}
@@ -0,0 +1,105 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Progress is an update on a long read by a UDF, such as a file being
+// hashed or a download
+type Progress struct {
+	Op      string        // "read" for files, "download" for http
+	Name    string        // the file path or URL
+	Done    int64         // bytes read so far
+	Total   int64         // bytes expected, or -1 when unknown
+	Elapsed time.Duration // since the read started
+	End     bool          // the read is over, whether or not it failed
+}
+
+var (
+	progressMu       sync.Mutex
+	progressFunc     func(Progress)
+	progressInterval time.Duration
+)
+
+// SetProgress sets the function that receives progress updates, or turns
+// progress off when f is nil. A read is reported once it has taken longer
+// than interval, then at most once per interval until it ends, so that
+// small reads make no noise at all
+func SetProgress(f func(Progress), interval time.Duration) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressFunc, progressInterval = f, interval
+}
+
+// ProgressReader returns r, counting what is read from it to report the
+// progress of the operation op on name. total is the expected size, or -1.
+// When progress is off, r is returned as is
+func ProgressReader(r io.Reader, op, name string, total int64) io.Reader {
+	progressMu.Lock()
+	f, interval := progressFunc, progressInterval
+	progressMu.Unlock()
+	if f == nil {
+		return r
+	}
+	now := time.Now()
+	return &progressReader{r: r, f: f, interval: interval, start: now, last: now,
+		p: Progress{Op: op, Name: name, Total: total}}
+}
+
+type progressReader struct {
+	r        io.Reader
+	f        func(Progress)
+	interval time.Duration
+	start    time.Time
+	last     time.Time
+	reported bool
+	p        Progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.p.Done += int64(n)
+	now := time.Now()
+	if err != nil {
+		// The end is only worth reporting for a read that was reported at all
+		if r.reported && !r.p.End {
+			r.p.End = true
+			r.report(now)
+		}
+	} else if now.Sub(r.last) >= r.interval {
+		r.report(now)
+	}
+	return n, err
+}
+
+func (r *progressReader) report(now time.Time) {
+	r.reported, r.last = true, now
+	r.p.Elapsed = now.Sub(r.start)
+	r.f(r.p)
+}
+
+// ReadFile reads a whole file like os.ReadFile, reporting progress on the
+// way. Errors are those of os.ReadFile, so os.IsNotExist and the like work
+func ReadFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	size := int64(-1)
+	if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+		size = fi.Size()
+	}
+	var buf bytes.Buffer
+	if size > 0 {
+		buf.Grow(int(size) + bytes.MinRead)
+	}
+	if _, err := buf.ReadFrom(ProgressReader(f, "read", path, size)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressReader(t *testing.T) {
+	defer SetProgress(nil, 0)
+
+	r := strings.NewReader("abc")
+	if got := ProgressReader(r, "read", "x", 3); got != io.Reader(r) {
+		t.Errorf("ProgressReader wrapped the reader with progress off")
+	}
+
+	var updates []Progress
+	SetProgress(func(p Progress) { updates = append(updates, p) }, 0)
+	data, err := io.ReadAll(ProgressReader(io.LimitReader(strings.NewReader("abcdef"), 6), "download", "u", -1))
+	if err != nil || string(data) != "abcdef" {
+		t.Fatalf("ReadAll = %q, %v", data, err)
+	}
+	if len(updates) < 2 {
+		t.Fatalf("got %d updates, want at least 2", len(updates))
+	}
+	last := updates[len(updates)-1]
+	if !last.End || last.Done != 6 || last.Total != -1 || last.Op != "download" || last.Name != "u" {
+		t.Errorf("last update = %+v", last)
+	}
+	for _, p := range updates[:len(updates)-1] {
+		if p.End {
+			t.Errorf("update before the end has End set: %+v", p)
+		}
+	}
+
+	// Reads shorter than the interval are not reported
+	updates = nil
+	SetProgress(func(p Progress) { updates = append(updates, p) }, time.Hour)
+	io.ReadAll(ProgressReader(strings.NewReader("abc"), "read", "x", 3))
+	if len(updates) != 0 {
+		t.Errorf("quick read reported %+v", updates)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	defer SetProgress(nil, 0)
+	var updates []Progress
+	SetProgress(func(p Progress) { updates = append(updates, p) }, 0)
+
+	path := filepath.Join(t.TempDir(), "data")
+	want := bytes.Repeat([]byte("pwrq"), 10000)
+	if err := os.WriteFile(path, want, 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFile(path)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("ReadFile = %d bytes, %v", len(got), err)
+	}
+	if len(updates) == 0 {
+		t.Fatal("no progress reported")
+	}
+	if last := updates[len(updates)-1]; !last.End || last.Done != int64(len(want)) || last.Total != int64(len(want)) {
+		t.Errorf("last update = %+v", last)
+	}
+
+	if _, err := ReadFile(filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Errorf("ReadFile of a missing file = %v, want a not-exist error", err)
+	}
+}
@@ -0,0 +1,108 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	provenanceMu sync.Mutex
+	provenance   bool
+
+	// provenanceNow stamps the records of the chain, replaced by tests
+	provenanceNow = time.Now
+)
+
+// SetProvenance turns the provenance chain on or off. While it is on,
+// MakeUDFSuccessResult appends a record of the call to _meta.chain, and
+// WithFunction and WithIterFunction carry the chain of the input in front
+// of it, so that a result lists every UDF that led to it
+func SetProvenance(on bool) {
+	provenanceMu.Lock()
+	defer provenanceMu.Unlock()
+	provenance = on
+}
+
+func recordingProvenance() bool {
+	provenanceMu.Lock()
+	defer provenanceMu.Unlock()
+	return provenance
+}
+
+// provenanceRecord describes the call making a result with meta: when, and
+// the scalar entries of meta, which hold the parameters that matter like
+// the algorithm or the path of a file. The function is filled in by
+// WithFunction and WithIterFunction
+func provenanceRecord(meta map[string]any) map[string]any {
+	params := map[string]any{}
+	for k, v := range meta {
+		switch v.(type) {
+		case string, bool, int, int64, float64:
+			if k != "chain" {
+				params[k] = v
+			}
+		}
+	}
+	return map[string]any{
+		"function":  "",
+		"timestamp": provenanceNow().UTC().Format(time.RFC3339Nano),
+		"params":    params,
+	}
+}
+
+// UDFChain returns the provenance chain of a UDF result, or nil. Like
+// ExtractUDFValue unwraps _val, it lets the chain follow the value into
+// the next UDF
+func UDFChain(v any) []any {
+	obj, ok := v.(map[string]any)
+	if !ok || !IsUDFResult(obj) {
+		return nil
+	}
+	meta, _ := obj["_meta"].(map[string]any)
+	chain, _ := meta["chain"].([]any)
+	return chain
+}
+
+// chainUDFResult puts the chain of the input of the function name in front
+// of the records of its result, v, and names the function in them. v is
+// copied rather than changed, as UDFs may hand out the same result twice
+func chainUDFResult(name string, input, v any) any {
+	if !recordingProvenance() {
+		return v
+	}
+	obj, ok := v.(map[string]any)
+	if !ok || !IsUDFResult(obj) {
+		return v
+	}
+	meta, ok := obj["_meta"].(map[string]any)
+	if !ok {
+		return v
+	}
+	own, _ := meta["chain"].([]any)
+	chain := append([]any{}, UDFChain(input)...)
+	for _, r := range own {
+		if record, ok := r.(map[string]any); ok && record["function"] == "" {
+			named := make(map[string]any, len(record))
+			for k, v := range record {
+				named[k] = v
+			}
+			named["function"] = name
+			r = named
+		}
+		chain = append(chain, r)
+	}
+	if len(chain) == 0 {
+		return v
+	}
+	result := make(map[string]any, len(obj))
+	for k, v := range obj {
+		result[k] = v
+	}
+	chained := make(map[string]any, len(meta)+1)
+	for k, v := range meta {
+		chained[k] = v
+	}
+	chained["chain"] = chain
+	result["_meta"] = chained
+	return result
+}
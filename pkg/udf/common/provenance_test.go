@@ -0,0 +1,63 @@
+package common
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
+)
+
+func TestProvenanceChain(t *testing.T) {
+	SetProvenance(true)
+	defer SetProvenance(false)
+	defer func(now func() time.Time) { provenanceNow = now }(provenanceNow)
+	provenanceNow = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	query, err := gojq.Parse(`(upper | twice | ._meta.chain), (upper | ._val | twice | ._meta.chain | length), (upper | fail | ._meta.chain | length)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query,
+		WithFunction("upper", 0, 0, func(v any, _ []any) any {
+			return MakeUDFSuccessResult(v, map[string]any{"mode": "ascii", "table": []any{}})
+		}),
+		WithIterFunction("twice", 0, 0, func(v any, _ []any) gojq.Iter {
+			v = ExtractUDFValue(v)
+			return gojq.NewIter(MakeUDFSuccessResult(v, map[string]any{"n": 1}))
+		}),
+		WithFunction("fail", 0, 0, func(any, []any) any {
+			return MakeUDFErrorResult(errors.New("broken"), nil)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []any
+	iter := code.Run("x")
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		got = append(got, v)
+	}
+	want := []any{
+		[]any{
+			map[string]any{"function": "upper", "timestamp": "2024-05-01T12:00:00Z", "params": map[string]any{"mode": "ascii"}},
+			map[string]any{"function": "twice", "timestamp": "2024-05-01T12:00:00Z", "params": map[string]any{"n": 1}},
+		},
+		1, 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestProvenanceOff(t *testing.T) {
+	result := MakeUDFSuccessResult("x", nil)
+	if _, ok := result["_meta"].(map[string]any)["chain"]; ok {
+		t.Errorf("chain recorded with provenance off: %v", result)
+	}
+}
@@ -0,0 +1,124 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate is a number of requests allowed per period. The zero Rate is no limit
+type Rate struct {
+	N   int
+	Per time.Duration
+}
+
+// ParseRate parses a rate like 10/s, 100/m or 1000/h. A bare number is per
+// second
+func ParseRate(s string) (Rate, error) {
+	num, unit, _ := strings.Cut(strings.TrimSpace(s), "/")
+	n, err := strconv.Atoi(num)
+	if err != nil || n <= 0 {
+		return Rate{}, Errorf(CodeInvalid, "invalid rate %q: expected a positive number of requests like 10/s", s)
+	}
+	per := time.Second
+	switch unit {
+	case "", "s":
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Rate{}, Errorf(CodeInvalid, "invalid rate %q: the period must be s, m or h", s)
+	}
+	return Rate{n, per}, nil
+}
+
+// limiter spaces requests evenly at its rate, so that a job never sends a
+// burst a provider could take for abuse
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(r Rate) *limiter {
+	if r.N <= 0 {
+		return nil
+	}
+	return &limiter{interval: r.Per / time.Duration(r.N)}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the rate limit: %w", ctx.Err())
+	}
+}
+
+var (
+	rateMu      sync.Mutex
+	globalLimit *limiter
+	hostLimits  map[string]*limiter
+)
+
+// SetRateLimits limits the requests of network UDFs to global across all
+// hosts, and to hosts[h] for host h and its subdomains
+func SetRateLimits(global Rate, hosts map[string]Rate) {
+	rateMu.Lock()
+	defer rateMu.Unlock()
+	globalLimit, hostLimits = newLimiter(global), nil
+	for h, r := range hosts {
+		if hostLimits == nil {
+			hostLimits = map[string]*limiter{}
+		}
+		hostLimits[strings.ToLower(strings.TrimPrefix(h, "."))] = newLimiter(r)
+	}
+}
+
+// WaitRate blocks until a request to addr, a host name or address with or
+// without a port, is allowed by the rate limits, or ctx is done
+func WaitRate(ctx context.Context, addr string) error {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	rateMu.Lock()
+	global := globalLimit
+	// The most specific host limit applies
+	var hostLimit *limiter
+	var match string
+	for h, l := range hostLimits {
+		if (host == h || strings.HasSuffix(host, "."+h)) && len(h) > len(match) {
+			hostLimit, match = l, h
+		}
+	}
+	rateMu.Unlock()
+	if err := hostLimit.wait(ctx); err != nil {
+		return err
+	}
+	return global.wait(ctx)
+}
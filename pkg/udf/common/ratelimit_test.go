@@ -0,0 +1,69 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		rate Rate
+		ok   bool
+	}{
+		{"10/s", Rate{10, time.Second}, true},
+		{"10", Rate{10, time.Second}, true},
+		{"100/m", Rate{100, time.Minute}, true},
+		{" 1/h ", Rate{1, time.Hour}, true},
+		{"0/s", Rate{}, false},
+		{"ten/s", Rate{}, false},
+		{"10/d", Rate{}, false},
+	} {
+		rate, err := ParseRate(tc.s)
+		if rate != tc.rate || (err == nil) != tc.ok {
+			t.Errorf("ParseRate(%q) = %v, %v, want %v, ok %v", tc.s, rate, err, tc.rate, tc.ok)
+		}
+	}
+}
+
+func TestWaitRate(t *testing.T) {
+	defer SetRateLimits(Rate{}, nil)
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 5 {
+		if err := WaitRate(ctx, "example.com:443"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("requests without limits took %v", d)
+	}
+
+	SetRateLimits(Rate{}, map[string]Rate{"example.com": {20, time.Second}})
+	start = time.Now()
+	for range 3 {
+		if err := WaitRate(ctx, "api.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("3 requests at 20/s took %v, want at least 100ms", d)
+	}
+	start = time.Now()
+	for range 3 {
+		WaitRate(ctx, "other.org")
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("requests to a host without a limit took %v", d)
+	}
+
+	SetRateLimits(Rate{1, time.Hour}, nil)
+	WaitRate(ctx, "example.com")
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := WaitRate(ctx, "example.com"); err == nil {
+		t.Errorf("WaitRate returned before the next slot")
+	}
+}
@@ -0,0 +1,152 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// UDFSchemaVersion is the version of the shape of UDF results, given in
+// their _schema. Results without a _schema are version 1
+//
+//	1: {_val, _meta, _err}, with _err a string
+//	2: {_schema, _val, _meta, _err}, with _err an object of code, message,
+//	   function, retryable and optional details
+const UDFSchemaVersion = 2
+
+// UDFSchema returns the schema version of a UDF result: its _schema, or 1
+// when it has none. ok is false if v is not a UDF result or its _schema is
+// not a positive integer
+func UDFSchema(v any) (version int, ok bool) {
+	obj, isObj := v.(map[string]any)
+	if !isObj || !IsUDFResult(obj) {
+		return 0, false
+	}
+	s, has := obj["_schema"]
+	if !has {
+		return 1, true
+	}
+	switch s := s.(type) {
+	case int:
+		version = s
+	case float64:
+		if s != float64(int(s)) {
+			return 0, false
+		}
+		version = int(s)
+	case json.Number:
+		n, err := s.Int64()
+		if err != nil {
+			return 0, false
+		}
+		version = int(n)
+	case *big.Int:
+		if !s.IsInt64() {
+			return 0, false
+		}
+		version = int(s.Int64())
+	default:
+		return 0, false
+	}
+	return version, version > 0
+}
+
+// ValidateUDFResult checks that v is a UDF result of the current schema
+// version, returning what is wrong with it first
+func ValidateUDFResult(v any) error {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("UDF result must be an object, got %T", v)
+	}
+	if _, ok := obj["_val"]; !ok {
+		return errors.New("UDF result has no _val")
+	}
+	if _, ok := obj["_meta"].(map[string]any); !ok {
+		return fmt.Errorf("UDF result _meta must be an object, got %T", obj["_meta"])
+	}
+	version, ok := UDFSchema(obj)
+	if !ok {
+		return fmt.Errorf("UDF result _schema must be a positive integer, got %v", obj["_schema"])
+	}
+	if version != UDFSchemaVersion {
+		return fmt.Errorf("UDF result _schema is %d, want %d", version, UDFSchemaVersion)
+	}
+	for key := range obj {
+		switch key {
+		case "_schema", "_val", "_meta", "_err":
+		default:
+			return fmt.Errorf("UDF result has unexpected key %q", key)
+		}
+	}
+	if e, has := obj["_err"]; has {
+		return validateUDFErrorValue(e)
+	}
+	return nil
+}
+
+// validateUDFErrorValue checks the _err of a UDF result
+func validateUDFErrorValue(v any) error {
+	e, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("UDF result _err must be an object, got %T", v)
+	}
+	for _, key := range []string{"code", "message", "function"} {
+		if _, ok := e[key].(string); !ok {
+			return fmt.Errorf("UDF result _err.%v must be a string, got %T", key, e[key])
+		}
+	}
+	if e["code"] == "" {
+		return errors.New("UDF result _err.code is empty")
+	}
+	if _, ok := e["retryable"].(bool); !ok {
+		return fmt.Errorf("UDF result _err.retryable must be a boolean, got %T", e["retryable"])
+	}
+	if details, has := e["details"]; has {
+		if _, ok := details.(map[string]any); !ok {
+			return fmt.Errorf("UDF result _err.details must be an object, got %T", details)
+		}
+	}
+	return nil
+}
+
+// MigrateUDFResult brings a UDF result of an older schema version, like one
+// saved to a file or returned by an older plugin, to the current version.
+// v is copied rather than changed. Results of a newer version than this
+// build knows are an error, as are values that are not UDF results
+func MigrateUDFResult(v any) (map[string]any, error) {
+	version, ok := UDFSchema(v)
+	if !ok {
+		return nil, errors.New("not a UDF result of a known schema version")
+	}
+	if version > UDFSchemaVersion {
+		return nil, fmt.Errorf("UDF result _schema %d is newer than %d", version, UDFSchemaVersion)
+	}
+	obj := v.(map[string]any)
+	result := make(map[string]any, len(obj)+1)
+	for k, v := range obj {
+		result[k] = v
+	}
+	if version < 2 {
+		migrateErrV1(result)
+	}
+	result["_schema"] = UDFSchemaVersion
+	return result, ValidateUDFResult(result)
+}
+
+// migrateErrV1 turns a version 1 _err string into an object. The message
+// is all there is to go on, so the code comes from its phrases, and the
+// function from _meta.operation when there is one
+func migrateErrV1(result map[string]any) {
+	msg, ok := result["_err"].(string)
+	if !ok {
+		return
+	}
+	e := UDFErrorValue(&UDFError{Code: messageCode(msg), Message: msg})
+	if meta, ok := result["_meta"].(map[string]any); ok {
+		if name, ok := meta["operation"].(string); ok {
+			e["function"] = name
+		}
+	}
+	result["_err"] = e
+}
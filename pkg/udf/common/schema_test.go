@@ -0,0 +1,68 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateUDFResult(t *testing.T) {
+	tests := []struct {
+		name  string
+		input any
+		want  string
+	}{
+		{"success", MakeUDFSuccessResult("x", nil), ""},
+		{"error", MakeUDFErrorResult(errors.New("broken"), nil), ""},
+		{"not an object", "x", "UDF result must be an object, got string"},
+		{"no _val", map[string]any{"_schema": 2, "_meta": map[string]any{}}, "UDF result has no _val"},
+		{"version 1", map[string]any{"_val": 1, "_meta": map[string]any{}}, "UDF result _schema is 1, want 2"},
+		{"bad version", map[string]any{"_schema": "2", "_val": 1, "_meta": map[string]any{}}, "UDF result _schema must be a positive integer, got 2"},
+		{"extra key", map[string]any{"_schema": 2, "_val": 1, "_meta": map[string]any{}, "_x": 1}, `UDF result has unexpected key "_x"`},
+		{"string _err", map[string]any{"_schema": 2, "_val": nil, "_meta": map[string]any{}, "_err": "broken"}, "UDF result _err must be an object, got string"},
+		{"no retryable", map[string]any{"_schema": 2, "_val": nil, "_meta": map[string]any{},
+			"_err": map[string]any{"code": "EFAIL", "message": "broken", "function": "f"}}, "UDF result _err.retryable must be a boolean, got <nil>"},
+	}
+	for _, tt := range tests {
+		var got string
+		if err := ValidateUDFResult(tt.input); err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateUDFResult(t *testing.T) {
+	var saved any
+	if err := json.Unmarshal([]byte(`{"_val":null,"_meta":{"operation":"cat"},"_err":"open x: no such file or directory"}`), &saved); err != nil {
+		t.Fatal(err)
+	}
+	got, err := MigrateUDFResult(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"_schema": UDFSchemaVersion,
+		"_val":    nil,
+		"_meta":   map[string]any{"operation": "cat"},
+		"_err":    map[string]any{"code": CodeNotFound, "message": "open x: no such file or directory", "function": "cat", "retryable": false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, ok := saved.(map[string]any)["_schema"]; ok {
+		t.Error("the result migrated was changed")
+	}
+
+	current := MakeUDFSuccessResult("x", nil)
+	if got, err := MigrateUDFResult(current); err != nil || !reflect.DeepEqual(got, current) {
+		t.Errorf("current version: got %v, %v", got, err)
+	}
+	if _, err := MigrateUDFResult(map[string]any{"_schema": 3.0, "_val": 1, "_meta": map[string]any{}}); err == nil ||
+		err.Error() != "UDF result _schema 3 is newer than 2" {
+		t.Errorf("newer version: got %v", err)
+	}
+}
@@ -27,16 +27,36 @@ func GetUDFError(v any) string {
 	if !ok {
 		return ""
 	}
-	if err, ok := obj["_err"].(string); ok {
+	switch err := obj["_err"].(type) {
+	case map[string]any:
+		msg, _ := err["message"].(string)
+		return msg
+	case string:
 		return err
 	}
 	return ""
 }
 
+// GetUDFErrorCode gets the error code from a UDF result object, like
+// "ENOENT", or returns empty string
+func GetUDFErrorCode(v any) string {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return ""
+	}
+	if err, ok := obj["_err"].(map[string]any); ok {
+		code, _ := err["code"].(string)
+		return code
+	}
+	return ""
+}
+
 // ExtractUDFValue extracts the _val from a UDF result object, or returns the value as-is
 // This allows UDFs to automatically unwrap _val when chaining UDFs together.
 // This is the standard behavior for all UDFs - if a UDF receives a UDF result object
 // and doesn't need to access _meta, it should automatically extract _val.
+// The _meta.chain of v, when provenance is on, still reaches the result:
+// WithFunction carries it, see UDFChain.
 func ExtractUDFValue(v any) any {
 	if IsUDFResult(v) {
 		obj := v.(map[string]any)
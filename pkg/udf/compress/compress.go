@@ -15,10 +15,10 @@ import (
 
 // RegisterGzipCompress registers the gzip_compress function with gojq
 func RegisterGzipCompress() gojq.CompilerOption {
-	return gojq.WithFunction("gzip_compress", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("gzip_compress", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -30,40 +30,33 @@ func RegisterGzipCompress() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "gzip_compress: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: %w", err), nil)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		// Compress with gzip
 		var buf bytes.Buffer
 		writer := gzip.NewWriter(&buf)
 		if _, err := writer.Write(inputBytes); err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: failed to write: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: failed to write: %w", err), nil)
 		}
 		if err := writer.Close(); err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: failed to close writer: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("gzip_compress: failed to close writer: %w", err), nil)
 		}
 		compressed := buf.Bytes()
 
@@ -86,10 +79,10 @@ func RegisterGzipCompress() gojq.CompilerOption {
 
 // RegisterGzipDecompress registers the gzip_decompress function with gojq
 func RegisterGzipDecompress() gojq.CompilerOption {
-	return gojq.WithFunction("gzip_decompress", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("gzip_decompress", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -101,44 +94,41 @@ func RegisterGzipDecompress() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "gzip_decompress: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: %w", err), nil)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				// Try to decode hex string first
-				decoded, err := hex.DecodeString(val)
-				if err == nil {
-					inputBytes = decoded
-				} else {
-					inputBytes = []byte(val)
+			// Try to decode hex string first
+			if val, ok := inputVal.(string); ok {
+				if decoded, err := hex.DecodeString(val); err == nil {
+					inputVal = decoded
 				}
-			case []byte:
-				inputBytes = val
-			default:
-				return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: argument must be a string or bytes, got %T", val), nil)
 			}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: %w", err), nil)
+			}
+			inputBytes = b
 		}
 
 		// Decompress with gzip
 		reader, err := gzip.NewReader(bytes.NewReader(inputBytes))
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: failed to create reader: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: failed to create reader: %w", err), nil)
 		}
 		defer reader.Close()
 
 		decompressed, err := io.ReadAll(reader)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: failed to decompress: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("gzip_decompress: failed to decompress: %w", err), nil)
 		}
 
 		meta := map[string]any{
@@ -160,10 +150,10 @@ func RegisterGzipDecompress() gojq.CompilerOption {
 
 // RegisterZlibCompress registers the zlib_compress function with gojq
 func RegisterZlibCompress() gojq.CompilerOption {
-	return gojq.WithFunction("zlib_compress", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("zlib_compress", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -175,40 +165,33 @@ func RegisterZlibCompress() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "zlib_compress: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: %w", err), nil)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		// Compress with zlib
 		var buf bytes.Buffer
 		writer := zlib.NewWriter(&buf)
 		if _, err := writer.Write(inputBytes); err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: failed to write: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: failed to write: %w", err), nil)
 		}
 		if err := writer.Close(); err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: failed to close writer: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("zlib_compress: failed to close writer: %w", err), nil)
 		}
 		compressed := buf.Bytes()
 
@@ -231,10 +214,10 @@ func RegisterZlibCompress() gojq.CompilerOption {
 
 // RegisterZlibDecompress registers the zlib_decompress function with gojq
 func RegisterZlibDecompress() gojq.CompilerOption {
-	return gojq.WithFunction("zlib_decompress", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("zlib_decompress", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -246,44 +229,41 @@ func RegisterZlibDecompress() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "zlib_decompress: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: %w", err), nil)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				// Try to decode hex string first
-				decoded, err := hex.DecodeString(val)
-				if err == nil {
-					inputBytes = decoded
-				} else {
-					inputBytes = []byte(val)
+			// Try to decode hex string first
+			if val, ok := inputVal.(string); ok {
+				if decoded, err := hex.DecodeString(val); err == nil {
+					inputVal = decoded
 				}
-			case []byte:
-				inputBytes = val
-			default:
-				return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: argument must be a string or bytes, got %T", val), nil)
 			}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: %w", err), nil)
+			}
+			inputBytes = b
 		}
 
 		// Decompress with zlib
 		reader, err := zlib.NewReader(bytes.NewReader(inputBytes))
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: failed to create reader: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: failed to create reader: %w", err), nil)
 		}
 		defer reader.Close()
 
 		decompressed, err := io.ReadAll(reader)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: failed to decompress: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("zlib_decompress: failed to decompress: %w", err), nil)
 		}
 
 		meta := map[string]any{
@@ -305,10 +285,10 @@ func RegisterZlibDecompress() gojq.CompilerOption {
 
 // RegisterDeflateCompress registers the deflate_compress function with gojq
 func RegisterDeflateCompress() gojq.CompilerOption {
-	return gojq.WithFunction("deflate_compress", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("deflate_compress", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -320,43 +300,36 @@ func RegisterDeflateCompress() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "deflate_compress: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: %w", err), nil)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		// Compress with deflate
 		var buf bytes.Buffer
 		writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: failed to create writer: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: failed to create writer: %w", err), nil)
 		}
 		if _, err := writer.Write(inputBytes); err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: failed to write: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: failed to write: %w", err), nil)
 		}
 		if err := writer.Close(); err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: failed to close writer: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("deflate_compress: failed to close writer: %w", err), nil)
 		}
 		compressed := buf.Bytes()
 
@@ -379,10 +352,10 @@ func RegisterDeflateCompress() gojq.CompilerOption {
 
 // RegisterDeflateDecompress registers the deflate_decompress function with gojq
 func RegisterDeflateDecompress() gojq.CompilerOption {
-	return gojq.WithFunction("deflate_decompress", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("deflate_decompress", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("deflate_decompress: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("deflate_decompress: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -394,32 +367,29 @@ func RegisterDeflateDecompress() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("deflate_decompress: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "deflate_decompress: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("deflate_decompress: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("deflate_decompress: %w", err), nil)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				// Try to decode hex string first
-				decoded, err := hex.DecodeString(val)
-				if err == nil {
-					inputBytes = decoded
-				} else {
-					inputBytes = []byte(val)
+			// Try to decode hex string first
+			if val, ok := inputVal.(string); ok {
+				if decoded, err := hex.DecodeString(val); err == nil {
+					inputVal = decoded
 				}
-			case []byte:
-				inputBytes = val
-			default:
-				return common.MakeUDFErrorResult(fmt.Errorf("deflate_decompress: argument must be a string or bytes, got %T", val), nil)
 			}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("deflate_decompress: %w", err), nil)
+			}
+			inputBytes = b
 		}
 
 		// Decompress with deflate
@@ -428,7 +398,7 @@ func RegisterDeflateDecompress() gojq.CompilerOption {
 
 		decompressed, err := io.ReadAll(reader)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("deflate_decompress: failed to decompress: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("deflate_decompress: failed to decompress: %w", err), nil)
 		}
 
 		meta := map[string]any{
@@ -0,0 +1,638 @@
+package cron
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// maxNext bounds how many fire times cron_next returns
+const maxNext = 1000
+
+// searchYears bounds how far ahead the next fire time is searched for, so
+// that schedules such as February 30 fail instead of looping
+const searchYears = 30
+
+// bounds are the limits of a field and the names its values may have
+type bounds struct {
+	name     string
+	min, max int
+	names    []string // names from min on, e.g. "jan" for 1
+}
+
+var (
+	secondBounds = bounds{name: "second", min: 0, max: 59}
+	minuteBounds = bounds{name: "minute", min: 0, max: 59}
+	hourBounds   = bounds{name: "hour", min: 0, max: 23}
+	domBounds    = bounds{name: "day of month", min: 1, max: 31}
+	monthBounds  = bounds{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	// 7 is Sunday as well as 0
+	dowBounds = bounds{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// macros are the @ shorthands and the schedules they stand for
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// part is one comma-separated term of a field: a value, a range, or
+// either with a step
+type part struct {
+	start, end, step int
+	star             bool
+}
+
+// field is a parsed schedule field
+type field struct {
+	raw   string
+	parts []part
+	bits  uint64
+	any   bool // * or ?, with no step
+	star  bool // starts with * or ?, which cron treats as unrestricted days
+}
+
+func (f field) has(v int) bool {
+	return f.bits&(1<<uint(v)) != 0
+}
+
+func parseValue(s string, b bounds) (int, error) {
+	for i, name := range b.names {
+		if strings.EqualFold(s, name) {
+			return b.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, common.Errorf(common.CodeInvalid, "invalid %v %q", b.name, s)
+	}
+	if n < b.min || n > b.max {
+		return 0, common.Errorf(common.CodeInvalid, "%v %d out of range %d-%d", b.name, n, b.min, b.max)
+	}
+	return n, nil
+}
+
+func parseField(s string, b bounds) (field, error) {
+	f := field{raw: s, star: strings.HasPrefix(s, "*") || strings.HasPrefix(s, "?")}
+	for _, term := range strings.Split(s, ",") {
+		p := part{step: 1}
+		rng, step, hasStep := strings.Cut(term, "/")
+		if hasStep {
+			n, err := strconv.Atoi(step)
+			if err != nil || n < 1 {
+				return f, common.Errorf(common.CodeInvalid, "invalid step %q in %v field", step, b.name)
+			}
+			p.step = n
+		}
+		switch {
+		case rng == "*" || rng == "?":
+			p.start, p.end, p.star = b.min, b.max, true
+			if b.name == "day of week" {
+				p.end = 6
+			}
+		case strings.Contains(rng, "-"):
+			lo, hi, _ := strings.Cut(rng, "-")
+			var err error
+			if p.start, err = parseValue(lo, b); err != nil {
+				return f, err
+			}
+			if p.end, err = parseValue(hi, b); err != nil {
+				return f, err
+			}
+			if p.start > p.end {
+				return f, common.Errorf(common.CodeInvalid, "invalid %v range %q", b.name, rng)
+			}
+		default:
+			v, err := parseValue(rng, b)
+			if err != nil {
+				return f, err
+			}
+			// "5/15" means from 5 to the end in steps of 15
+			p.start, p.end = v, v
+			if hasStep {
+				p.end = b.max
+			}
+		}
+		for v := p.start; v <= p.end; v += p.step {
+			f.bits |= 1 << uint(v)
+		}
+		if p.star && p.step == 1 {
+			f.any = true
+		}
+		f.parts = append(f.parts, p)
+	}
+	// Sunday is 0 when matching
+	if b.name == "day of week" && f.has(7) {
+		f.bits = f.bits&^(1<<7) | 1
+	}
+	return f, nil
+}
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	Expr    string
+	Macro   string // the @ shorthand the schedule was written as, if any
+	Command string // what followed the schedule in a crontab line
+	Seconds bool   // whether the expression has a seconds field
+	Reboot  bool   // @reboot, which has no fire times
+
+	second, minute, hour, dom, month, dow field
+}
+
+// Parse parses a cron expression: five fields (minute, hour, day of
+// month, month, day of week), six with a leading seconds field, or an @
+// shorthand. Text after the five fields of a crontab line is the command
+func Parse(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) == 0 {
+		return nil, common.Errorf(common.CodeInvalid, "empty expression")
+	}
+	s := &Schedule{Expr: strings.Join(fields, " ")}
+	if strings.HasPrefix(fields[0], "@") {
+		s.Macro = strings.ToLower(fields[0])
+		s.Command = strings.Join(fields[1:], " ")
+		if s.Macro == "@reboot" {
+			s.Reboot = true
+			return s, nil
+		}
+		std, ok := macros[s.Macro]
+		if !ok {
+			return nil, common.Errorf(common.CodeInvalid, "unknown shorthand %q", fields[0])
+		}
+		fields = strings.Fields(std)
+	}
+	if len(fields) < 5 {
+		return nil, common.Errorf(common.CodeInvalid, "expected 5 or 6 fields, got %d", len(fields))
+	}
+
+	if len(fields) == 6 && s.Macro == "" {
+		if err := s.parseFields(fields); err == nil {
+			s.Seconds = true
+			return s, nil
+		}
+	}
+	if s.Macro == "" {
+		s.Command = strings.Join(fields[5:], " ")
+	}
+	if err := s.parseFields(append([]string{"0"}, fields[:5]...)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schedule) parseFields(fields []string) error {
+	var err error
+	for i, dst := range []struct {
+		f *field
+		b bounds
+	}{
+		{&s.second, secondBounds}, {&s.minute, minuteBounds}, {&s.hour, hourBounds},
+		{&s.dom, domBounds}, {&s.month, monthBounds}, {&s.dow, dowBounds},
+	} {
+		if *dst.f, err = parseField(fields[i], dst.b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dayMatches applies cron's rule that when both day fields are restricted,
+// a day matching either one fires
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	if s.dom.star || s.dow.star {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first fire time after t, in t's location. A time skipped
+// when clocks go forward does not fire that day. A time repeated when clocks
+// go back fires only the first time, as in Vixie cron, unless the minute or
+// hour field starts with *, since such a job runs by the clock it sees
+func (s *Schedule) Next(t time.Time) (time.Time, error) {
+	for {
+		next, err := s.next(t)
+		if err != nil || s.minute.star || s.hour.star || !repeated(next) {
+			return next, err
+		}
+		t = next
+	}
+}
+
+// repeated reports whether the wall clock time of t already happened once,
+// in the hour that is repeated when clocks go back
+func repeated(t time.Time) bool {
+	_, offset := t.Zone()
+	// No zone changes its offset twice within three hours
+	_, before := t.Add(-3 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+	u := t.Add(-time.Duration(before-offset) * time.Second)
+	return u.Day() == t.Day() && u.Hour() == t.Hour() &&
+		u.Minute() == t.Minute() && u.Second() == t.Second()
+}
+
+func (s *Schedule) next(t time.Time) (time.Time, error) {
+	if s.Reboot {
+		return time.Time{}, fmt.Errorf("@reboot has no fire times")
+	}
+	loc := t.Location()
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	limit := t.Year() + searchYears
+	// Once a field is advanced, the lower ones start from their minimum
+	added := false
+
+wrap:
+	if t.Year() > limit {
+		return time.Time{}, fmt.Errorf("no fire time within %d years", searchYears)
+	}
+	for !s.month.has(int(t.Month())) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		// Midnight can be skipped or repeated by a DST change
+		if t.Hour() != 0 {
+			if t.Hour() > 12 {
+				t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+			} else {
+				t = t.Add(-time.Duration(t.Hour()) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+	for !s.hour.has(t.Hour()) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+	for !s.minute.has(t.Minute()) {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+	for !s.second.has(t.Second()) {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+	return t, nil
+}
+
+func weekdayName(v int) string { return time.Weekday(v % 7).String() }
+func monthName(v int) string   { return time.Month(v).String() }
+func number(v int) string      { return strconv.Itoa(v) }
+func clock(h, m int) string    { return fmt.Sprintf("%02d:%02d", h, m) }
+
+// joinWords joins items as "a, b and c"
+func joinWords(items []string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+// single returns the field's value when it is exactly one value
+func (f field) single() (int, bool) {
+	if len(f.parts) == 1 && f.parts[0].start == f.parts[0].end && !f.parts[0].star {
+		return f.parts[0].start, true
+	}
+	return 0, false
+}
+
+// everyStep returns n when the field is */n
+func (f field) everyStep() (int, bool) {
+	if len(f.parts) == 1 && f.parts[0].star && f.parts[0].step > 1 {
+		return f.parts[0].step, true
+	}
+	return 0, false
+}
+
+// values returns the field's values when it is a plain list of them
+func (f field) values() ([]int, bool) {
+	var vs []int
+	for _, p := range f.parts {
+		if p.star || p.start != p.end {
+			return nil, false
+		}
+		vs = append(vs, p.start)
+	}
+	return vs, true
+}
+
+// ordinal formats n as 1st, 2nd, 3rd...
+func ordinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// listText describes the values of a field, e.g. "Monday through Friday"
+// or "every 2nd month from March through December"
+func (f field) listText(name func(int) string, unit string, b bounds) string {
+	var items []string
+	for _, p := range f.parts {
+		switch {
+		case p.star:
+			items = append(items, fmt.Sprintf("every %s %s", ordinal(p.step), unit))
+		case p.start == p.end:
+			items = append(items, name(p.start))
+		case p.step > 1 && p.end == b.max:
+			items = append(items, fmt.Sprintf("every %s %s from %s", ordinal(p.step), unit, name(p.start)))
+		case p.step > 1:
+			items = append(items, fmt.Sprintf("every %s %s from %s through %s", ordinal(p.step), unit, name(p.start), name(p.end)))
+		default:
+			items = append(items, name(p.start)+" through "+name(p.end))
+		}
+	}
+	return joinWords(items)
+}
+
+// Describe returns a description of the schedule such as
+// "At 09:00, Monday through Friday"
+func (s *Schedule) Describe() string {
+	if s.Reboot {
+		return "At system startup"
+	}
+	text := s.describeTime()
+	var days []string
+	if !s.dom.any {
+		if v, ok := s.dom.single(); ok {
+			days = append(days, fmt.Sprintf("on day %d of the month", v))
+		} else if step, ok := s.dom.everyStep(); ok {
+			days = append(days, fmt.Sprintf("every %d days", step))
+		} else {
+			days = append(days, "on days "+s.dom.listText(number, "day", domBounds)+" of the month")
+		}
+	}
+	if !s.dow.any {
+		days = append(days, "on "+s.dow.listText(weekdayName, "day of the week", dowBounds))
+	}
+	if len(days) > 0 {
+		text += ", " + strings.Join(days, ", or ")
+	}
+	if !s.month.any {
+		text += ", in " + s.month.listText(monthName, "month", monthBounds)
+	}
+	return text
+}
+
+func (s *Schedule) describeTime() string {
+	sec, secSingle := s.second.single()
+	min, minSingle := s.minute.single()
+	hours, hourList := s.hour.values()
+
+	// Fixed times of day, e.g. "At 09:00 and 17:00"
+	if secSingle && minSingle && hourList && len(hours) <= 6 {
+		var times []string
+		for _, h := range hours {
+			t := clock(h, min)
+			if sec != 0 {
+				t += fmt.Sprintf(":%02d", sec)
+			}
+			times = append(times, t)
+		}
+		return "At " + joinWords(times)
+	}
+
+	text := describeUnit(s.minute, "minute", minuteBounds)
+	if s.Seconds && !(secSingle && sec == 0) {
+		text = describeUnit(s.second, "second", secondBounds)
+		if !s.minute.any {
+			minutes := describeUnit(s.minute, "minute", minuteBounds)
+			text += ", " + strings.ToLower(minutes[:1]) + minutes[1:]
+		}
+	}
+	if !s.hour.any {
+		if h, ok := s.hour.single(); ok {
+			text += fmt.Sprintf(", between %s and %s", clock(h, 0), clock(h, 59))
+		} else if step, ok := s.hour.everyStep(); ok {
+			text += fmt.Sprintf(", every %d hours", step)
+		} else {
+			text += ", past hours " + s.hour.listText(number, "hour", hourBounds)
+		}
+	}
+	return text
+}
+
+// describeUnit describes a seconds or minutes field
+func describeUnit(f field, unit string, b bounds) string {
+	if f.any {
+		return "Every " + unit
+	}
+	if step, ok := f.everyStep(); ok {
+		return fmt.Sprintf("Every %d %ss", step, unit)
+	}
+	if v, ok := f.single(); ok {
+		return fmt.Sprintf("At %s %d", unit, v)
+	}
+	if len(f.parts) == 1 && f.parts[0].step > 1 {
+		p := f.parts[0]
+		return fmt.Sprintf("Every %d %ss, %ss %d through %d", p.step, unit, unit, p.start, p.end)
+	}
+	return fmt.Sprintf("At %ss %s", unit, f.listText(number, unit, b))
+}
+
+// fieldMap lists the fields of s as written
+func (s *Schedule) fieldMap() map[string]any {
+	m := map[string]any{
+		"minute":       s.minute.raw,
+		"hour":         s.hour.raw,
+		"day_of_month": s.dom.raw,
+		"month":        s.month.raw,
+		"day_of_week":  s.dow.raw,
+	}
+	if s.Seconds {
+		m["second"] = s.second.raw
+	}
+	return m
+}
+
+func parseExprArg(name string, arg any) (*Schedule, error) {
+	expr, ok := common.ExtractUDFValue(arg).(string)
+	if !ok {
+		return nil, common.Errorf(common.CodeInvalid, "%v: expression must be a string, got %T", name, common.ExtractUDFValue(arg))
+	}
+	s, err := Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", name, err)
+	}
+	return s, nil
+}
+
+// parseFrom reads the from option: an RFC3339 string or Unix seconds
+func parseFrom(raw any, loc *time.Location) (time.Time, error) {
+	switch val := raw.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return time.Time{}, common.Errorf(common.CodeInvalid, "options.from must be an RFC3339 time, got %q", val)
+		}
+		return t.In(loc), nil
+	case int:
+		return time.Unix(int64(val), 0).In(loc), nil
+	case float64:
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return time.Time{}, common.Errorf(common.CodeInvalid, "options.from must be a finite number")
+		}
+		sec, frac := math.Modf(val)
+		return time.Unix(int64(sec), int64(frac*1e9)).In(loc), nil
+	}
+	return time.Time{}, common.Errorf(common.CodeInvalid, "options.from must be a string or a number, got %T", raw)
+}
+
+// RegisterCronNext registers the cron_next function with gojq
+func RegisterCronNext() gojq.CompilerOption {
+	return common.WithFunction("cron_next", 1, 3, func(v any, args []any) any {
+		// cron_next(expr), cron_next(expr; n) or cron_next(expr; n; options)
+		s, err := parseExprArg("cron_next", args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+		n := 1
+		if len(args) > 1 {
+			switch val := common.ExtractUDFValue(args[1]).(type) {
+			case int:
+				n = val
+			case float64:
+				if val != math.Trunc(val) {
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "cron_next: n must be an integer, got %v", val), nil)
+				}
+				n = int(val)
+			default:
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "cron_next: n must be a number, got %T", val), nil)
+			}
+			if n < 1 || n > maxNext {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "cron_next: n must be from 1 to %d, got %d", maxNext, n), nil)
+			}
+		}
+
+		loc := time.UTC
+		var fromRaw any
+		if len(args) > 2 {
+			opts, ok := common.ExtractUDFValue(args[2]).(map[string]any)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "cron_next: options must be an object, got %T", common.ExtractUDFValue(args[2])), nil)
+			}
+			for key, raw := range opts {
+				switch key {
+				case "from":
+					fromRaw = raw
+				case "tz":
+					name, ok := raw.(string)
+					if !ok {
+						return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "cron_next: options.tz must be a string, got %T", raw), nil)
+					}
+					if loc, err = time.LoadLocation(name); err != nil {
+						return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "cron_next: unknown time zone %q", name), nil)
+					}
+				default:
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "cron_next: unknown option %q", key), nil)
+				}
+			}
+		}
+		from := time.Now().In(loc)
+		if fromRaw != nil {
+			if from, err = parseFrom(fromRaw, loc); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("cron_next: %w", err), nil)
+			}
+		}
+
+		times := make([]any, 0, n)
+		t := from
+		for len(times) < n {
+			if t, err = s.Next(t); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("cron_next: %w", err), nil)
+			}
+			times = append(times, t.Format(time.RFC3339))
+		}
+		return common.MakeUDFSuccessResult(times, map[string]any{
+			"operation":   "cron_next",
+			"expr":        s.Expr,
+			"description": s.Describe(),
+			"from":        from.Format(time.RFC3339),
+			"tz":          loc.String(),
+			"count":       len(times),
+		})
+	})
+}
+
+// RegisterCronDescribe registers the cron_describe function with gojq
+func RegisterCronDescribe() gojq.CompilerOption {
+	return common.WithFunction("cron_describe", 0, 1, func(v any, args []any) any {
+		// cron_describe describes the input, cron_describe(expr) its argument
+		exprVal := v
+		if len(args) > 0 {
+			exprVal = args[0]
+		}
+		s, err := parseExprArg("cron_describe", exprVal)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+		meta := map[string]any{
+			"operation": "cron_describe",
+			"expr":      s.Expr,
+			"macro":     nil,
+			"command":   nil,
+		}
+		if !s.Reboot {
+			meta["fields"] = s.fieldMap()
+		}
+		if s.Macro != "" {
+			meta["macro"] = s.Macro
+		}
+		if s.Command != "" {
+			meta["command"] = s.Command
+		}
+		return common.MakeUDFSuccessResult(s.Describe(), meta)
+	})
+}
@@ -0,0 +1,240 @@
+package cron
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+func TestNext(t *testing.T) {
+	// A Friday
+	from := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"*/15 * * * *", []string{"2024-03-01T10:30:00Z", "2024-03-01T10:45:00Z", "2024-03-01T11:00:00Z"}},
+		{"0 9 * * 1-5", []string{"2024-03-04T09:00:00Z", "2024-03-05T09:00:00Z", "2024-03-06T09:00:00Z"}},
+		{"30 2 1 * *", []string{"2024-04-01T02:30:00Z", "2024-05-01T02:30:00Z", "2024-06-01T02:30:00Z"}},
+		{"0 0 29 2 *", []string{"2028-02-29T00:00:00Z", "2032-02-29T00:00:00Z", "2036-02-29T00:00:00Z"}},
+		// Both day fields restricted: the 15th or any Monday
+		{"0 12 15 * mon", []string{"2024-03-04T12:00:00Z", "2024-03-11T12:00:00Z", "2024-03-15T12:00:00Z"}},
+		// A starred day of week with a step still requires both: the 1st
+		// on a Sunday, Tuesday, Thursday or Saturday
+		{"0 0 1 * */2", []string{"2024-06-01T00:00:00Z", "2024-08-01T00:00:00Z", "2024-09-01T00:00:00Z"}},
+		{"0 0 * * 7", []string{"2024-03-03T00:00:00Z", "2024-03-10T00:00:00Z", "2024-03-17T00:00:00Z"}},
+		{"5/20 10 * * *", []string{"2024-03-01T10:25:00Z", "2024-03-01T10:45:00Z", "2024-03-02T10:05:00Z"}},
+		{"0 0 1 jan-mar/2 *", []string{"2025-01-01T00:00:00Z", "2025-03-01T00:00:00Z", "2026-01-01T00:00:00Z"}},
+		{"*/20 * * * * *", []string{"2024-03-01T10:20:40Z", "2024-03-01T10:21:00Z", "2024-03-01T10:21:20Z"}},
+		{"@hourly", []string{"2024-03-01T11:00:00Z", "2024-03-01T12:00:00Z", "2024-03-01T13:00:00Z"}},
+		{"@weekly", []string{"2024-03-03T00:00:00Z", "2024-03-10T00:00:00Z", "2024-03-17T00:00:00Z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			next := from
+			for range tt.want {
+				if next, err = s.Next(next); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, next.Format(time.RFC3339))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 02:30 does not exist on 2024-03-31 in Berlin, so that day is skipped
+	s, _ := Parse("30 2 * * *")
+	var got []string
+	next := time.Date(2024, 3, 30, 12, 0, 0, 0, berlin)
+	for range 2 {
+		next, _ = s.Next(next)
+		got = append(got, next.Format(time.RFC3339))
+	}
+	want := []string{"2024-04-01T02:30:00+02:00", "2024-04-02T02:30:00+02:00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+
+	// Hours are wall clock hours across the change back to winter time
+	s, _ = Parse("0 */6 * * *")
+	next = time.Date(2024, 10, 26, 20, 0, 0, 0, berlin)
+	got = nil
+	for range 3 {
+		next, _ = s.Next(next)
+		got = append(got, next.Format(time.RFC3339))
+	}
+	want = []string{"2024-10-27T00:00:00+02:00", "2024-10-27T06:00:00+01:00", "2024-10-27T12:00:00+01:00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+}
+
+func TestNextDSTNewYork(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		expr string
+		from time.Time
+		want []string
+	}{
+		// 01:30 happens twice on 2024-11-03 and fires only the first time
+		{"30 1 * * *", time.Date(2024, 11, 2, 12, 0, 0, 0, ny),
+			[]string{"2024-11-03T01:30:00-04:00", "2024-11-04T01:30:00-05:00"}},
+		// The repeated hour is skipped from inside it as well
+		{"30 1 * * *", time.Date(2024, 11, 3, 5, 45, 0, 0, time.UTC).In(ny),
+			[]string{"2024-11-04T01:30:00-05:00"}},
+		// Wildcard hours run by the clock, so the repeated hour fires again
+		{"0 * * * *", time.Date(2024, 11, 3, 0, 30, 0, 0, ny),
+			[]string{"2024-11-03T01:00:00-04:00", "2024-11-03T01:00:00-05:00", "2024-11-03T02:00:00-05:00"}},
+		// 02:30 does not exist on 2024-03-10, so that day is skipped
+		{"30 2 * * *", time.Date(2024, 3, 9, 12, 0, 0, 0, ny),
+			[]string{"2024-03-11T02:30:00-04:00"}},
+	}
+	for _, tt := range tests {
+		s, _ := Parse(tt.expr)
+		var got []string
+		next := tt.from
+		for range tt.want {
+			next, _ = s.Next(next)
+			got = append(got, next.Format(time.RFC3339))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s from %v: Next = %v, want %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := map[string]string{
+		"* * * * *":          "Every minute",
+		"*/5 * * * *":        "Every 5 minutes",
+		"0 9 * * 1-5":        "At 09:00, on Monday through Friday",
+		"0 9,17 * * *":       "At 09:00 and 17:00",
+		"30 2 1 * *":         "At 02:30, on day 1 of the month",
+		"0 */2 * * *":        "At minute 0, every 2 hours",
+		"*/10 9-17 * * *":    "Every 10 minutes, past hours 9 through 17",
+		"* 3 * * *":          "Every minute, between 03:00 and 03:59",
+		"0,30 * * * *":       "At minutes 0 and 30",
+		"15 10 * jan,jun *":  "At 10:15, in January and June",
+		"0 0 1,15 * sun":     "At 00:00, on days 1 and 15 of the month, or on Sunday",
+		"0 0 */2 * *":        "At 00:00, every 2 days",
+		"0 0 1 */3 *":        "At 00:00, on day 1 of the month, in every 3rd month",
+		"*/30 * * * * *":     "Every 30 seconds",
+		"15 30 8 * * *":      "At 08:30:15",
+		"@daily":             "At 00:00",
+		"@reboot /bin/start": "At system startup",
+	}
+	for expr, want := range tests {
+		s, err := Parse(expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", expr, err)
+			continue
+		}
+		if got := s.Describe(); got != want {
+			t.Errorf("Describe(%q) = %q, want %q", expr, got, want)
+		}
+	}
+}
+
+func TestCronUDFs(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterCronNext(), RegisterCronDescribe()}
+	tests := []struct {
+		query string
+		input any
+		want  any
+	}{
+		{`cron_next("0 9 * * 1-5"; 2; {from: "2024-03-01T10:00:00Z"}) | ._val`, nil, []any{"2024-03-04T09:00:00Z", "2024-03-05T09:00:00Z"}},
+		{`cron_next("0 9 * * *"; 1; {from: 1709287200, tz: "America/New_York"}) | ._val`, nil, []any{"2024-03-01T09:00:00-05:00"}},
+		{`cron_next("0 9 * * *"; 3; {from: "2024-03-01T10:00:00Z"}) | ._meta | [.count, .tz, .description]`, nil, []any{3, "UTC", "At 09:00"}},
+		{`cron_next("@daily") | ._val | length`, nil, 1},
+		{`cron_describe | ._val`, "0 9 * * 1-5", "At 09:00, on Monday through Friday"},
+		{`cron_describe("17 * * * * root cd / && run-parts /etc/cron.hourly") | ._meta | [.command, .fields.minute]`, nil, []any{"root cd / && run-parts /etc/cron.hourly", "17"}},
+		{`cron_describe("@weekly /usr/bin/backup") | ._meta | [.macro, .command]`, nil, []any{"@weekly", "/usr/bin/backup"}},
+		{`cron_describe("*/5 * * * * *") | ._meta.fields.second`, nil, "*/5"},
+	}
+	for _, tt := range tests {
+		got := runGojqQuery(t, tt.query, tt.input, opts...)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCronErrors(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterCronNext(), RegisterCronDescribe()}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`cron_next("* * *")`, "cron_next: expected 5 or 6 fields, got 3"},
+		{`cron_next("61 * * * *")`, "cron_next: minute 61 out of range 0-59"},
+		{`cron_next("* * * foo *")`, `cron_next: invalid month "foo"`},
+		{`cron_next("*/0 * * * *")`, `cron_next: invalid step "0" in minute field`},
+		{`cron_next("5-1 * * * *")`, `cron_next: invalid minute range "5-1"`},
+		{`cron_next("@often")`, `cron_next: unknown shorthand "@often"`},
+		{`cron_next("@reboot")`, "cron_next: @reboot has no fire times"},
+		{`cron_next("0 0 30 2 *")`, "cron_next: no fire time within 30 years"},
+		{`cron_next("* * * * *"; 0)`, "cron_next: n must be from 1 to 1000"},
+		{`cron_next("* * * * *"; 1.5)`, "cron_next: n must be an integer"},
+		{`cron_next("* * * * *"; 1; {tz: "Nowhere"})`, `cron_next: unknown time zone "Nowhere"`},
+		{`cron_next("* * * * *"; 1; {from: "today"})`, "cron_next: options.from must be an RFC3339 time"},
+		{`cron_next("* * * * *"; 1; {every: 1})`, `cron_next: unknown option "every"`},
+		{`cron_next(5)`, "cron_next: expression must be a string"},
+		{`cron_describe`, "cron_describe: expression must be a string"},
+		{`cron_describe("")`, "cron_describe: empty expression"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, nil, opts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
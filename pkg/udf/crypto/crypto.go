@@ -29,7 +29,7 @@ func parseKey(keyInput any, keyFormat string) ([]byte, error) {
 	case []byte:
 		keyBytes = val
 	default:
-		return nil, fmt.Errorf("key must be a string or bytes, got %T", val)
+		return nil, common.Errorf(common.CodeInvalid, "key must be a string or bytes, got %T", val)
 	}
 
 	// Decode key if format is specified
@@ -37,19 +37,19 @@ func parseKey(keyInput any, keyFormat string) ([]byte, error) {
 	case "hex":
 		decoded, err := hex.DecodeString(string(keyBytes))
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode hex key: %v", err)
+			return nil, fmt.Errorf("failed to decode hex key: %w", err)
 		}
 		return decoded, nil
 	case "base64":
 		decoded, err := base64.StdEncoding.DecodeString(string(keyBytes))
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode base64 key: %v", err)
+			return nil, fmt.Errorf("failed to decode base64 key: %w", err)
 		}
 		return decoded, nil
 	case "raw", "":
 		return keyBytes, nil
 	default:
-		return nil, fmt.Errorf("unsupported key format: %s (use 'hex', 'base64', or 'raw')", keyFormat)
+		return nil, common.Errorf(common.CodeInvalid, "unsupported key format: %v (use 'hex', 'base64', or 'raw')", keyFormat)
 	}
 }
 
@@ -64,7 +64,7 @@ func parseData(dataInput any, dataFormat string) ([]byte, error) {
 	case []byte:
 		dataBytes = val
 	default:
-		return nil, fmt.Errorf("data must be a string or bytes, got %T", val)
+		return nil, common.Errorf(common.CodeInvalid, "data must be a string or bytes, got %T", val)
 	}
 
 	// Decode data if format is specified
@@ -72,19 +72,19 @@ func parseData(dataInput any, dataFormat string) ([]byte, error) {
 	case "hex":
 		decoded, err := hex.DecodeString(string(dataBytes))
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode hex data: %v", err)
+			return nil, fmt.Errorf("failed to decode hex data: %w", err)
 		}
 		return decoded, nil
 	case "base64":
 		decoded, err := base64.StdEncoding.DecodeString(string(dataBytes))
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode base64 data: %v", err)
+			return nil, fmt.Errorf("failed to decode base64 data: %w", err)
 		}
 		return decoded, nil
 	case "raw", "":
 		return dataBytes, nil
 	default:
-		return nil, fmt.Errorf("unsupported data format: %s (use 'hex', 'base64', or 'raw')", dataFormat)
+		return nil, common.Errorf(common.CodeInvalid, "unsupported data format: %v (use 'hex', 'base64', or 'raw')", dataFormat)
 	}
 }
 
@@ -101,15 +101,15 @@ func pkcs7Pad(data []byte, blockSize int) []byte {
 // pkcs7Unpad removes PKCS7 padding
 func pkcs7Unpad(data []byte) ([]byte, error) {
 	if len(data) == 0 {
-		return nil, fmt.Errorf("data is empty")
+		return nil, common.Errorf(common.CodeInvalid, "data is empty")
 	}
 	padding := int(data[len(data)-1])
 	if padding > len(data) || padding == 0 {
-		return nil, fmt.Errorf("invalid padding")
+		return nil, common.Errorf(common.CodeInvalid, "invalid padding")
 	}
 	for i := len(data) - padding; i < len(data); i++ {
 		if data[i] != byte(padding) {
-			return nil, fmt.Errorf("invalid padding")
+			return nil, common.Errorf(common.CodeInvalid, "invalid padding")
 		}
 	}
 	return data[:len(data)-padding], nil
@@ -119,9 +119,9 @@ func pkcs7Unpad(data []byte) ([]byte, error) {
 
 // RegisterAESEncrypt registers AES encryption function
 func RegisterAESEncrypt() gojq.CompilerOption {
-	return gojq.WithFunction("aes_encrypt", 2, 5, func(v any, args []any) any {
+	return common.WithFunction("aes_encrypt", 2, 5, func(v any, args []any) any {
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_encrypt: requires at least 2 arguments (data, key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_encrypt: requires at least 2 arguments (data, key)"), nil)
 		}
 
 		// Parse arguments: data, key, mode (default CBC), keyFormat (default raw), dataFormat (default raw)
@@ -134,7 +134,7 @@ func RegisterAESEncrypt() gojq.CompilerOption {
 		dataInput = common.ExtractUDFValue(dataInput)
 
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_encrypt: requires at least 2 arguments (data, key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_encrypt: requires at least 2 arguments (data, key)"), nil)
 		}
 		keyInput := args[1]
 		mode := "CBC"
@@ -164,23 +164,23 @@ func RegisterAESEncrypt() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_encrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("aes_encrypt: %w", err), nil)
 		}
 
 		data, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_encrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("aes_encrypt: %w", err), nil)
 		}
 
 		// Validate key size
 		validKeySizes := map[int]bool{16: true, 24: true, 32: true} // 128, 192, 256 bits
 		if !validKeySizes[len(key)] {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_encrypt: invalid key size %d bytes (must be 16, 24, or 32)", len(key)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_encrypt: invalid key size %d bytes (must be 16, 24, or 32)", len(key)), nil)
 		}
 
 		block, err := aes.NewCipher(key)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_encrypt: failed to create cipher: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("aes_encrypt: failed to create cipher: %w", err), nil)
 		}
 
 		var ciphertext []byte
@@ -230,7 +230,7 @@ func RegisterAESEncrypt() gojq.CompilerOption {
 			ciphertext = make([]byte, len(data))
 			stream.XORKeyStream(ciphertext, data)
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_encrypt: unsupported mode %s (use ECB, CBC, CFB, OFB, or CTR)", mode), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_encrypt: unsupported mode %v (use ECB, CBC, CFB, OFB, or CTR)", mode), nil)
 		}
 
 		// Prepend IV for modes that use it
@@ -256,9 +256,9 @@ func RegisterAESEncrypt() gojq.CompilerOption {
 
 // RegisterAESDecrypt registers AES decryption function
 func RegisterAESDecrypt() gojq.CompilerOption {
-	return gojq.WithFunction("aes_decrypt", 2, 5, func(v any, args []any) any {
+	return common.WithFunction("aes_decrypt", 2, 5, func(v any, args []any) any {
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: requires at least 2 arguments (data, key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_decrypt: requires at least 2 arguments (data, key)"), nil)
 		}
 
 		// Parse arguments: data, key, mode (default CBC), keyFormat (default raw), dataFormat (default base64)
@@ -295,23 +295,23 @@ func RegisterAESDecrypt() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: %w", err), nil)
 		}
 
 		ciphertext, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: %w", err), nil)
 		}
 
 		// Validate key size
 		validKeySizes := map[int]bool{16: true, 24: true, 32: true}
 		if !validKeySizes[len(key)] {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: invalid key size %d bytes (must be 16, 24, or 32)", len(key)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_decrypt: invalid key size %d bytes (must be 16, 24, or 32)", len(key)), nil)
 		}
 
 		block, err := aes.NewCipher(key)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: failed to create cipher: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: failed to create cipher: %w", err), nil)
 		}
 
 		var plaintext []byte
@@ -322,7 +322,7 @@ func RegisterAESDecrypt() gojq.CompilerOption {
 			// ECB mode (no IV)
 			blockSize := block.BlockSize()
 			if len(ciphertext)%blockSize != 0 {
-				return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: ciphertext length must be multiple of %d", blockSize), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_decrypt: ciphertext length must be multiple of %d", blockSize), nil)
 			}
 			plaintext = make([]byte, len(ciphertext))
 			for i := 0; i < len(ciphertext); i += blockSize {
@@ -330,27 +330,27 @@ func RegisterAESDecrypt() gojq.CompilerOption {
 			}
 			plaintext, err = pkcs7Unpad(plaintext)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: failed to unpad: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: failed to unpad: %w", err), nil)
 			}
 		case "CBC":
 			if len(ciphertext) < aes.BlockSize {
-				return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: ciphertext too short"), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_decrypt: ciphertext too short"), nil)
 			}
 			iv = ciphertext[:aes.BlockSize]
 			ciphertext = ciphertext[aes.BlockSize:]
 			if len(ciphertext)%aes.BlockSize != 0 {
-				return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: ciphertext length must be multiple of %d", aes.BlockSize), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_decrypt: ciphertext length must be multiple of %d", aes.BlockSize), nil)
 			}
 			mode := cipher.NewCBCDecrypter(block, iv)
 			plaintext = make([]byte, len(ciphertext))
 			mode.CryptBlocks(plaintext, ciphertext)
 			plaintext, err = pkcs7Unpad(plaintext)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: failed to unpad: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: failed to unpad: %w", err), nil)
 			}
 		case "CFB":
 			if len(ciphertext) < aes.BlockSize {
-				return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: ciphertext too short"), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_decrypt: ciphertext too short"), nil)
 			}
 			iv = ciphertext[:aes.BlockSize]
 			ciphertext = ciphertext[aes.BlockSize:]
@@ -359,7 +359,7 @@ func RegisterAESDecrypt() gojq.CompilerOption {
 			stream.XORKeyStream(plaintext, ciphertext)
 		case "OFB":
 			if len(ciphertext) < aes.BlockSize {
-				return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: ciphertext too short"), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_decrypt: ciphertext too short"), nil)
 			}
 			iv = ciphertext[:aes.BlockSize]
 			ciphertext = ciphertext[aes.BlockSize:]
@@ -368,7 +368,7 @@ func RegisterAESDecrypt() gojq.CompilerOption {
 			stream.XORKeyStream(plaintext, ciphertext)
 		case "CTR":
 			if len(ciphertext) < aes.BlockSize {
-				return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: ciphertext too short"), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_decrypt: ciphertext too short"), nil)
 			}
 			iv = ciphertext[:aes.BlockSize]
 			ciphertext = ciphertext[aes.BlockSize:]
@@ -376,7 +376,7 @@ func RegisterAESDecrypt() gojq.CompilerOption {
 			plaintext = make([]byte, len(ciphertext))
 			stream.XORKeyStream(plaintext, ciphertext)
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("aes_decrypt: unsupported mode %s (use ECB, CBC, CFB, OFB, or CTR)", mode), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "aes_decrypt: unsupported mode %v (use ECB, CBC, CFB, OFB, or CTR)", mode), nil)
 		}
 
 		result := string(plaintext)
@@ -395,9 +395,9 @@ func RegisterAESDecrypt() gojq.CompilerOption {
 
 // RegisterXOR registers XOR encryption/decryption function
 func RegisterXOR() gojq.CompilerOption {
-	return gojq.WithFunction("xor", 1, 3, func(v any, args []any) any {
+	return common.WithFunction("xor", 1, 3, func(v any, args []any) any {
 		if len(args) < 1 {
-			return common.MakeUDFErrorResult(fmt.Errorf("xor: requires at least 1 argument (key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "xor: requires at least 1 argument (key)"), nil)
 		}
 
 		dataInput := common.ExtractUDFValue(v)
@@ -418,16 +418,16 @@ func RegisterXOR() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("xor: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("xor: %w", err), nil)
 		}
 
 		data, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("xor: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("xor: %w", err), nil)
 		}
 
 		if len(key) == 0 {
-			return common.MakeUDFErrorResult(fmt.Errorf("xor: key cannot be empty"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "xor: key cannot be empty"), nil)
 		}
 
 		// XOR operation
@@ -452,9 +452,9 @@ func RegisterXOR() gojq.CompilerOption {
 
 // RegisterRC4 registers RC4 encryption/decryption function
 func RegisterRC4() gojq.CompilerOption {
-	return gojq.WithFunction("rc4", 1, 3, func(v any, args []any) any {
+	return common.WithFunction("rc4", 1, 3, func(v any, args []any) any {
 		if len(args) < 1 {
-			return common.MakeUDFErrorResult(fmt.Errorf("rc4: requires at least 1 argument (key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "rc4: requires at least 1 argument (key)"), nil)
 		}
 
 		dataInput := common.ExtractUDFValue(v)
@@ -475,17 +475,17 @@ func RegisterRC4() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("rc4: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("rc4: %w", err), nil)
 		}
 
 		data, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("rc4: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("rc4: %w", err), nil)
 		}
 
 		cipher, err := rc4.NewCipher(key)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("rc4: failed to create cipher: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("rc4: failed to create cipher: %w", err), nil)
 		}
 
 		result := make([]byte, len(data))
@@ -507,9 +507,9 @@ func RegisterRC4() gojq.CompilerOption {
 
 // RegisterChaCha20 registers ChaCha20 encryption/decryption function
 func RegisterChaCha20() gojq.CompilerOption {
-	return gojq.WithFunction("chacha20", 1, 4, func(v any, args []any) any {
+	return common.WithFunction("chacha20", 1, 4, func(v any, args []any) any {
 		if len(args) < 1 {
-			return common.MakeUDFErrorResult(fmt.Errorf("chacha20: requires at least 1 argument (key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "chacha20: requires at least 1 argument (key)"), nil)
 		}
 
 		dataInput := common.ExtractUDFValue(v)
@@ -547,16 +547,16 @@ func RegisterChaCha20() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("chacha20: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("chacha20: %w", err), nil)
 		}
 
 		if len(key) != 32 {
-			return common.MakeUDFErrorResult(fmt.Errorf("chacha20: key must be 32 bytes (256 bits), got %d", len(key)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "chacha20: key must be 32 bytes (256 bits), got %d", len(key)), nil)
 		}
 
 		data, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("chacha20: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("chacha20: %w", err), nil)
 		}
 
 		// Generate nonce if not provided
@@ -569,7 +569,7 @@ func RegisterChaCha20() gojq.CompilerOption {
 
 		cipher, err := chacha20.NewUnauthenticatedCipher(key, nonce)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("chacha20: failed to create cipher: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("chacha20: failed to create cipher: %w", err), nil)
 		}
 
 		result := make([]byte, len(data))
@@ -593,9 +593,9 @@ func RegisterChaCha20() gojq.CompilerOption {
 
 // RegisterDESEncrypt registers DES encryption function
 func RegisterDESEncrypt() gojq.CompilerOption {
-	return gojq.WithFunction("des_encrypt", 2, 4, func(v any, args []any) any {
+	return common.WithFunction("des_encrypt", 2, 4, func(v any, args []any) any {
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("des_encrypt: requires at least 2 arguments (data, key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "des_encrypt: requires at least 2 arguments (data, key)"), nil)
 		}
 
 		dataInput := common.ExtractUDFValue(v)
@@ -621,21 +621,21 @@ func RegisterDESEncrypt() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("des_encrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("des_encrypt: %w", err), nil)
 		}
 
 		if len(key) != 8 {
-			return common.MakeUDFErrorResult(fmt.Errorf("des_encrypt: key must be 8 bytes (64 bits), got %d", len(key)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "des_encrypt: key must be 8 bytes (64 bits), got %d", len(key)), nil)
 		}
 
 		data, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("des_encrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("des_encrypt: %w", err), nil)
 		}
 
 		block, err := des.NewCipher(key)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("des_encrypt: failed to create cipher: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("des_encrypt: failed to create cipher: %w", err), nil)
 		}
 
 		var ciphertext []byte
@@ -659,7 +659,7 @@ func RegisterDESEncrypt() gojq.CompilerOption {
 			ciphertext = make([]byte, len(padded))
 			mode.CryptBlocks(ciphertext, padded)
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("des_encrypt: unsupported mode %s (use ECB or CBC)", mode), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "des_encrypt: unsupported mode %v (use ECB or CBC)", mode), nil)
 		}
 
 		if iv != nil {
@@ -680,9 +680,9 @@ func RegisterDESEncrypt() gojq.CompilerOption {
 
 // RegisterDESDecrypt registers DES decryption function
 func RegisterDESDecrypt() gojq.CompilerOption {
-	return gojq.WithFunction("des_decrypt", 2, 4, func(v any, args []any) any {
+	return common.WithFunction("des_decrypt", 2, 4, func(v any, args []any) any {
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: requires at least 2 arguments (data, key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "des_decrypt: requires at least 2 arguments (data, key)"), nil)
 		}
 
 		dataInput := common.ExtractUDFValue(v)
@@ -708,21 +708,21 @@ func RegisterDESDecrypt() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: %w", err), nil)
 		}
 
 		if len(key) != 8 {
-			return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: key must be 8 bytes (64 bits), got %d", len(key)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "des_decrypt: key must be 8 bytes (64 bits), got %d", len(key)), nil)
 		}
 
 		ciphertext, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: %w", err), nil)
 		}
 
 		block, err := des.NewCipher(key)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: failed to create cipher: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: failed to create cipher: %w", err), nil)
 		}
 
 		var plaintext []byte
@@ -732,7 +732,7 @@ func RegisterDESDecrypt() gojq.CompilerOption {
 		case "ECB":
 			blockSize := block.BlockSize()
 			if len(ciphertext)%blockSize != 0 {
-				return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: ciphertext length must be multiple of %d", blockSize), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "des_decrypt: ciphertext length must be multiple of %d", blockSize), nil)
 			}
 			plaintext = make([]byte, len(ciphertext))
 			for i := 0; i < len(ciphertext); i += blockSize {
@@ -740,26 +740,26 @@ func RegisterDESDecrypt() gojq.CompilerOption {
 			}
 			plaintext, err = pkcs7Unpad(plaintext)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: failed to unpad: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: failed to unpad: %w", err), nil)
 			}
 		case "CBC":
 			if len(ciphertext) < des.BlockSize {
-				return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: ciphertext too short"), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "des_decrypt: ciphertext too short"), nil)
 			}
 			iv = ciphertext[:des.BlockSize]
 			ciphertext = ciphertext[des.BlockSize:]
 			if len(ciphertext)%des.BlockSize != 0 {
-				return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: ciphertext length must be multiple of %d", des.BlockSize), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "des_decrypt: ciphertext length must be multiple of %d", des.BlockSize), nil)
 			}
 			mode := cipher.NewCBCDecrypter(block, iv)
 			plaintext = make([]byte, len(ciphertext))
 			mode.CryptBlocks(plaintext, ciphertext)
 			plaintext, err = pkcs7Unpad(plaintext)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: failed to unpad: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: failed to unpad: %w", err), nil)
 			}
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("des_decrypt: unsupported mode %s (use ECB or CBC)", mode), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "des_decrypt: unsupported mode %v (use ECB or CBC)", mode), nil)
 		}
 
 		result := string(plaintext)
@@ -778,9 +778,9 @@ func RegisterDESDecrypt() gojq.CompilerOption {
 
 // Register3DESEncrypt registers 3DES encryption function
 func Register3DESEncrypt() gojq.CompilerOption {
-	return gojq.WithFunction("3des_encrypt", 2, 4, func(v any, args []any) any {
+	return common.WithFunction("3des_encrypt", 2, 4, func(v any, args []any) any {
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_encrypt: requires at least 2 arguments (data, key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "3des_encrypt: requires at least 2 arguments (data, key)"), nil)
 		}
 
 		dataInput := common.ExtractUDFValue(v)
@@ -806,22 +806,22 @@ func Register3DESEncrypt() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_encrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("3des_encrypt: %w", err), nil)
 		}
 
 		// 3DES key can be 16 or 24 bytes
 		if len(key) != 16 && len(key) != 24 {
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_encrypt: key must be 16 or 24 bytes, got %d", len(key)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "3des_encrypt: key must be 16 or 24 bytes, got %d", len(key)), nil)
 		}
 
 		data, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_encrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("3des_encrypt: %w", err), nil)
 		}
 
 		block, err := des.NewTripleDESCipher(key)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_encrypt: failed to create cipher: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("3des_encrypt: failed to create cipher: %w", err), nil)
 		}
 
 		var ciphertext []byte
@@ -845,7 +845,7 @@ func Register3DESEncrypt() gojq.CompilerOption {
 			ciphertext = make([]byte, len(padded))
 			mode.CryptBlocks(ciphertext, padded)
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_encrypt: unsupported mode %s (use ECB or CBC)", mode), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "3des_encrypt: unsupported mode %v (use ECB or CBC)", mode), nil)
 		}
 
 		if iv != nil {
@@ -866,9 +866,9 @@ func Register3DESEncrypt() gojq.CompilerOption {
 
 // Register3DESDecrypt registers 3DES decryption function
 func Register3DESDecrypt() gojq.CompilerOption {
-	return gojq.WithFunction("3des_decrypt", 2, 4, func(v any, args []any) any {
+	return common.WithFunction("3des_decrypt", 2, 4, func(v any, args []any) any {
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: requires at least 2 arguments (data, key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "3des_decrypt: requires at least 2 arguments (data, key)"), nil)
 		}
 
 		dataInput := common.ExtractUDFValue(v)
@@ -894,21 +894,21 @@ func Register3DESDecrypt() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: %w", err), nil)
 		}
 
 		if len(key) != 16 && len(key) != 24 {
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: key must be 16 or 24 bytes, got %d", len(key)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "3des_decrypt: key must be 16 or 24 bytes, got %d", len(key)), nil)
 		}
 
 		ciphertext, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: %w", err), nil)
 		}
 
 		block, err := des.NewTripleDESCipher(key)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: failed to create cipher: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: failed to create cipher: %w", err), nil)
 		}
 
 		var plaintext []byte
@@ -918,7 +918,7 @@ func Register3DESDecrypt() gojq.CompilerOption {
 		case "ECB":
 			blockSize := block.BlockSize()
 			if len(ciphertext)%blockSize != 0 {
-				return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: ciphertext length must be multiple of %d", blockSize), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "3des_decrypt: ciphertext length must be multiple of %d", blockSize), nil)
 			}
 			plaintext = make([]byte, len(ciphertext))
 			for i := 0; i < len(ciphertext); i += blockSize {
@@ -926,26 +926,26 @@ func Register3DESDecrypt() gojq.CompilerOption {
 			}
 			plaintext, err = pkcs7Unpad(plaintext)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: failed to unpad: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: failed to unpad: %w", err), nil)
 			}
 		case "CBC":
 			if len(ciphertext) < des.BlockSize {
-				return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: ciphertext too short"), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "3des_decrypt: ciphertext too short"), nil)
 			}
 			iv = ciphertext[:des.BlockSize]
 			ciphertext = ciphertext[des.BlockSize:]
 			if len(ciphertext)%des.BlockSize != 0 {
-				return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: ciphertext length must be multiple of %d", des.BlockSize), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "3des_decrypt: ciphertext length must be multiple of %d", des.BlockSize), nil)
 			}
 			mode := cipher.NewCBCDecrypter(block, iv)
 			plaintext = make([]byte, len(ciphertext))
 			mode.CryptBlocks(plaintext, ciphertext)
 			plaintext, err = pkcs7Unpad(plaintext)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: failed to unpad: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: failed to unpad: %w", err), nil)
 			}
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("3des_decrypt: unsupported mode %s (use ECB or CBC)", mode), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "3des_decrypt: unsupported mode %v (use ECB or CBC)", mode), nil)
 		}
 
 		result := string(plaintext)
@@ -964,9 +964,9 @@ func Register3DESDecrypt() gojq.CompilerOption {
 
 // RegisterBlowfishEncrypt registers Blowfish encryption function
 func RegisterBlowfishEncrypt() gojq.CompilerOption {
-	return gojq.WithFunction("blowfish_encrypt", 2, 4, func(v any, args []any) any {
+	return common.WithFunction("blowfish_encrypt", 2, 4, func(v any, args []any) any {
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_encrypt: requires at least 2 arguments (data, key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "blowfish_encrypt: requires at least 2 arguments (data, key)"), nil)
 		}
 
 		dataInput := common.ExtractUDFValue(v)
@@ -992,21 +992,21 @@ func RegisterBlowfishEncrypt() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_encrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_encrypt: %w", err), nil)
 		}
 
 		if len(key) < 4 || len(key) > 56 {
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_encrypt: key must be 4-56 bytes, got %d", len(key)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "blowfish_encrypt: key must be 4-56 bytes, got %d", len(key)), nil)
 		}
 
 		data, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_encrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_encrypt: %w", err), nil)
 		}
 
 		block, err := blowfish.NewCipher(key)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_encrypt: failed to create cipher: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_encrypt: failed to create cipher: %w", err), nil)
 		}
 
 		var ciphertext []byte
@@ -1030,7 +1030,7 @@ func RegisterBlowfishEncrypt() gojq.CompilerOption {
 			ciphertext = make([]byte, len(padded))
 			mode.CryptBlocks(ciphertext, padded)
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_encrypt: unsupported mode %s (use ECB or CBC)", mode), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "blowfish_encrypt: unsupported mode %v (use ECB or CBC)", mode), nil)
 		}
 
 		if iv != nil {
@@ -1051,9 +1051,9 @@ func RegisterBlowfishEncrypt() gojq.CompilerOption {
 
 // RegisterBlowfishDecrypt registers Blowfish decryption function
 func RegisterBlowfishDecrypt() gojq.CompilerOption {
-	return gojq.WithFunction("blowfish_decrypt", 2, 4, func(v any, args []any) any {
+	return common.WithFunction("blowfish_decrypt", 2, 4, func(v any, args []any) any {
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: requires at least 2 arguments (data, key)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "blowfish_decrypt: requires at least 2 arguments (data, key)"), nil)
 		}
 
 		dataInput := common.ExtractUDFValue(v)
@@ -1079,21 +1079,21 @@ func RegisterBlowfishDecrypt() gojq.CompilerOption {
 
 		key, err := parseKey(keyInput, keyFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: %w", err), nil)
 		}
 
 		if len(key) < 4 || len(key) > 56 {
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: key must be 4-56 bytes, got %d", len(key)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "blowfish_decrypt: key must be 4-56 bytes, got %d", len(key)), nil)
 		}
 
 		ciphertext, err := parseData(dataInput, dataFormat)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: %w", err), nil)
 		}
 
 		block, err := blowfish.NewCipher(key)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: failed to create cipher: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: failed to create cipher: %w", err), nil)
 		}
 
 		var plaintext []byte
@@ -1103,7 +1103,7 @@ func RegisterBlowfishDecrypt() gojq.CompilerOption {
 		case "ECB":
 			blockSize := block.BlockSize()
 			if len(ciphertext)%blockSize != 0 {
-				return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: ciphertext length must be multiple of %d", blockSize), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "blowfish_decrypt: ciphertext length must be multiple of %d", blockSize), nil)
 			}
 			plaintext = make([]byte, len(ciphertext))
 			for i := 0; i < len(ciphertext); i += blockSize {
@@ -1111,26 +1111,26 @@ func RegisterBlowfishDecrypt() gojq.CompilerOption {
 			}
 			plaintext, err = pkcs7Unpad(plaintext)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: failed to unpad: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: failed to unpad: %w", err), nil)
 			}
 		case "CBC":
 			if len(ciphertext) < blowfish.BlockSize {
-				return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: ciphertext too short"), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "blowfish_decrypt: ciphertext too short"), nil)
 			}
 			iv = ciphertext[:blowfish.BlockSize]
 			ciphertext = ciphertext[blowfish.BlockSize:]
 			if len(ciphertext)%blowfish.BlockSize != 0 {
-				return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: ciphertext length must be multiple of %d", blowfish.BlockSize), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "blowfish_decrypt: ciphertext length must be multiple of %d", blowfish.BlockSize), nil)
 			}
 			mode := cipher.NewCBCDecrypter(block, iv)
 			plaintext = make([]byte, len(ciphertext))
 			mode.CryptBlocks(plaintext, ciphertext)
 			plaintext, err = pkcs7Unpad(plaintext)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: failed to unpad: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: failed to unpad: %w", err), nil)
 			}
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("blowfish_decrypt: unsupported mode %s (use ECB or CBC)", mode), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "blowfish_decrypt: unsupported mode %v (use ECB or CBC)", mode), nil)
 		}
 
 		result := string(plaintext)
@@ -1,73 +1,289 @@
 package csv
 
 import (
-	"encoding/csv"
 	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/udf/common"
 )
 
-// RegisterCSVParse registers the csv_parse function with gojq
-func RegisterCSVParse() gojq.CompilerOption {
-	return gojq.WithFunction("csv_parse", 0, 3, func(v any, args []any) any {
-		// Parse arguments: optional delimiter, optional file flag
-		var delimiter rune = ','
-		var inputVal any
-		var isFile bool
-
-		if len(args) > 0 {
-			// Check if first arg is delimiter (string) or file flag (bool)
-			if delimStr, ok := args[0].(string); ok && len(delimStr) > 0 {
-				delimiter = rune(delimStr[0])
-				// Check for file flag as second arg
-				if len(args) > 1 {
-					if fileFlag, ok := args[1].(bool); ok {
-						isFile = fileFlag
-						inputVal = v
-					} else {
-						inputVal = args[1]
-						if len(args) > 2 {
-							if fileFlag, ok := args[2].(bool); ok {
-								isFile = fileFlag
-							}
+// options are the settings shared by csv_parse and csv_stringify. They can
+// be given as a trailing object argument, e.g. csv_parse({headers: true})
+type options struct {
+	Dialect
+	Headers    bool     // first row is a header (parse) / write a header row (stringify)
+	HeadersSet bool     // headers was given explicitly
+	Columns    []string // explicit column names, implies headers
+	File       bool     // input is a file path
+	Stream     bool     // emit rows one at a time
+	QuoteMode  QuoteMode
+	CRLF       bool
+}
+
+// parseArgs handles the positional forms (delimiter, [input], [file]) and
+// an optional trailing options object
+func parseArgs(name string, v any, args []any) (any, options, error) {
+	opts := options{Dialect: DefaultDialect}
+
+	var optsMap map[string]any
+	if n := len(args); n > 0 {
+		if m, ok := args[n-1].(map[string]any); ok && !common.IsUDFResult(m) {
+			optsMap, args = m, args[:n-1]
+		}
+	}
+
+	// Parse arguments: optional delimiter, optional file flag
+	var inputVal any
+	if len(args) > 0 {
+		// Check if first arg is delimiter (string) or file flag (bool)
+		if delimStr, ok := args[0].(string); ok && len(delimStr) > 0 {
+			opts.Delimiter = rune(delimStr[0])
+			// Check for file flag as second arg
+			if len(args) > 1 {
+				if fileFlag, ok := args[1].(bool); ok {
+					opts.File = fileFlag
+					inputVal = v
+				} else {
+					inputVal = args[1]
+					if len(args) > 2 {
+						if fileFlag, ok := args[2].(bool); ok {
+							opts.File = fileFlag
 						}
 					}
-				} else {
-					inputVal = v
 				}
-			} else if fileFlag, ok := args[0].(bool); ok {
-				isFile = fileFlag
-				inputVal = v
 			} else {
-				inputVal = args[0]
+				inputVal = v
 			}
-		} else {
+		} else if fileFlag, ok := args[0].(bool); ok {
+			opts.File = fileFlag
 			inputVal = v
+		} else {
+			inputVal = args[0]
+		}
+	} else {
+		inputVal = v
+	}
+
+	if optsMap != nil {
+		if err := opts.apply(optsMap); err != nil {
+			return nil, opts, fmt.Errorf("%v: %w", name, err)
+		}
+	}
+	return common.ExtractUDFValue(inputVal), opts, nil
+}
+
+func (opts *options) apply(m map[string]any) error {
+	escapeSet := false
+	for key, raw := range m {
+		var err error
+		switch key {
+		case "delimiter":
+			opts.Delimiter, err = optionRune(key, raw, false)
+		case "quote":
+			opts.Quote, err = optionRune(key, raw, true)
+		case "escape":
+			opts.Escape, err = optionRune(key, raw, true)
+			escapeSet = true
+		case "comment":
+			opts.Comment, err = optionRune(key, raw, true)
+		case "lazy_quotes":
+			opts.LazyQuotes, err = optionBool(key, raw)
+		case "trim_space":
+			opts.TrimSpace, err = optionBool(key, raw)
+		case "file":
+			opts.File, err = optionBool(key, raw)
+		case "stream":
+			opts.Stream, err = optionBool(key, raw)
+		case "crlf":
+			opts.CRLF, err = optionBool(key, raw)
+		case "quote_mode":
+			s, ok := raw.(string)
+			if !ok {
+				return common.Errorf(common.CodeInvalid, "option quote_mode must be a string, got %T", raw)
+			}
+			opts.QuoteMode = QuoteMode(s)
+		case "headers":
+			switch h := raw.(type) {
+			case bool:
+				opts.Headers = h
+			case []any:
+				opts.Headers = true
+				for _, c := range h {
+					name, ok := c.(string)
+					if !ok {
+						return common.Errorf(common.CodeInvalid, "option headers must be a boolean or an array of strings, got element %T", c)
+					}
+					opts.Columns = append(opts.Columns, name)
+				}
+			default:
+				return common.Errorf(common.CodeInvalid, "option headers must be a boolean or an array of strings, got %T", raw)
+			}
+			opts.HeadersSet = true
+		default:
+			return common.Errorf(common.CodeInvalid, "unknown option %q", key)
 		}
+		if err != nil {
+			return err
+		}
+	}
+	// The escape character defaults to the quote character, i.e. doubling
+	if !escapeSet || opts.Escape == 0 {
+		opts.Escape = opts.Quote
+	}
+	if opts.Delimiter == '\n' || opts.Delimiter == '\r' || (opts.Quote != 0 && opts.Delimiter == opts.Quote) {
+		return common.Errorf(common.CodeInvalid, "invalid delimiter %q", opts.Delimiter)
+	}
+	return nil
+}
+
+func optionRune(key string, raw any, allowEmpty bool) (rune, error) {
+	s, ok := raw.(string)
+	if !ok {
+		return 0, common.Errorf(common.CodeInvalid, "option %v must be a string, got %T", key, raw)
+	}
+	if s == "" && allowEmpty {
+		return 0, nil
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, common.Errorf(common.CodeInvalid, "option %v must be a single character, got %q", key, s)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+func optionBool(key string, raw any) (bool, error) {
+	b, ok := raw.(bool)
+	if !ok {
+		return false, common.Errorf(common.CodeInvalid, "option %v must be a boolean, got %T", key, raw)
+	}
+	return b, nil
+}
 
-		inputVal = common.ExtractUDFValue(inputVal)
+// rowReader turns records into rows: arrays, or objects keyed by column name
+// in header mode
+type rowReader struct {
+	r       *Reader
+	closer  io.Closer
+	headers []string
+	opts    options
+	started bool
+}
 
-		var input string
-		var filePath string
-		var fileSize int64
+func (rr *rowReader) next() (any, error) {
+	if !rr.started {
+		rr.started = true
+		rr.headers = rr.opts.Columns
+		if rr.opts.Headers && rr.headers == nil {
+			record, err := rr.r.Read()
+			if err != nil {
+				return nil, err
+			}
+			rr.headers = uniqueHeaders(record)
+		}
+	}
 
-		if isFile {
+	record, err := rr.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	if rr.headers == nil {
+		row := make([]any, len(record))
+		for i, field := range record {
+			row[i] = field
+		}
+		return row, nil
+	}
+	if len(record) > len(rr.headers) {
+		return nil, &ParseError{rr.r.Line(), common.Errorf(common.CodeInvalid, "record has %d fields, header has %d", len(record), len(rr.headers))}
+	}
+	row := make(map[string]any, len(rr.headers))
+	for i, name := range rr.headers {
+		if i < len(record) {
+			row[name] = record[i]
+		} else {
+			row[name] = nil
+		}
+	}
+	return row, nil
+}
+
+func (rr *rowReader) close() {
+	if rr.closer != nil {
+		rr.closer.Close()
+		rr.closer = nil
+	}
+}
+
+// uniqueHeaders names empty columns by position and numbers repeated names,
+// so no value is lost when rows become objects
+func uniqueHeaders(record []string) []string {
+	headers := make([]string, len(record))
+	seen := map[string]int{}
+	for i, name := range record {
+		if name == "" {
+			name = "column_" + strconv.Itoa(i+1)
+		}
+		if n := seen[name]; n > 0 {
+			seen[name] = n + 1
+			name += "_" + strconv.Itoa(n+1)
+		} else {
+			seen[name] = 1
+		}
+		headers[i] = name
+	}
+	return headers
+}
+
+// rowIter emits rows one at a time for stream mode
+type rowIter struct {
+	rr   *rowReader
+	done bool
+}
+
+func (it *rowIter) Next() (any, bool) {
+	if it.done {
+		return nil, false
+	}
+	row, err := it.rr.next()
+	if err != nil {
+		it.done = true
+		it.rr.close()
+		if err == io.EOF {
+			return nil, false
+		}
+		return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "csv_parse: failed to parse CSV: %w", err), nil), true
+	}
+	return row, true
+}
+
+// RegisterCSVParse registers the csv_parse function with gojq
+func RegisterCSVParse() gojq.CompilerOption {
+	return common.WithIterFunction("csv_parse", 0, 3, func(v any, args []any) gojq.Iter {
+		inputVal, opts, err := parseArgs("csv_parse", v, args)
+		if err != nil {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(err, nil))
+		}
+
+		rr := &rowReader{opts: opts}
+		if opts.File {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("csv_parse: file argument requires string path, got %T", inputVal), nil)
+				return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "csv_parse: file argument requires string path, got %T", inputVal), nil))
 			}
 
-			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
+			file, _, _, err := common.OpenFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("csv_parse: %v", err), nil)
+				return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("csv_parse: %w", err), nil))
 			}
-
-			input = string(fileData)
-			filePath = absPath
-			fileSize = size
+			rr.r, rr.closer = NewReader(file, opts.Dialect), file
 		} else {
+			var input string
 			switch val := inputVal.(type) {
 			case string:
 				input = val
@@ -77,137 +293,152 @@ func RegisterCSVParse() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("csv_parse: argument must be a string, got %T", val), nil)
+					return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "csv_parse: argument must be a string, got %T", val), nil))
 				}
 			}
+			rr.r = NewReader(strings.NewReader(input), opts.Dialect)
 		}
 
-		// Parse CSV
-		reader := csv.NewReader(strings.NewReader(input))
-		reader.Comma = delimiter
-		records, err := reader.ReadAll()
-		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("csv_parse: failed to parse CSV: %v", err), nil)
+		if opts.Stream {
+			return &rowIter{rr: rr}
 		}
 
-		// Convert to array of arrays
-		result := make([]any, len(records))
-		for i, record := range records {
-			row := make([]any, len(record))
-			for j, field := range record {
-				row[j] = field
+		defer rr.close()
+		result := []any{}
+		for {
+			row, err := rr.next()
+			if err == io.EOF {
+				break
 			}
-			result[i] = row
-		}
-
-		meta := map[string]any{
-			"operation": "csv_parse",
-			"delimiter": string(delimiter),
-			"rows":      len(records),
-		}
-
-		if isFile {
-			meta["file_path"] = filePath
-			meta["file_size"] = int(fileSize)
-		} else {
-			meta["input_length"] = len(input)
+			if err != nil {
+				return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "csv_parse: failed to parse CSV: %w", err), nil))
+			}
+			result = append(result, row)
 		}
 
 		// Return array directly (not wrapped in _val/_meta) for easier manipulation
-		return result
+		return gojq.NewIter[any](result)
 	})
 }
 
+// toField converts a jq value into CSV text. Strings are written as-is,
+// null as an empty field, and other values in their JSON form
+func toField(v any) Field {
+	switch val := v.(type) {
+	case nil:
+		return Field{}
+	case string:
+		return Field{Value: val}
+	case int, float64, *big.Int:
+		b, _ := gojq.Marshal(val)
+		return Field{Value: string(b), Numeric: true}
+	default:
+		b, _ := gojq.Marshal(val)
+		return Field{Value: string(b)}
+	}
+}
+
 // RegisterCSVStringify registers the csv_stringify function with gojq
 func RegisterCSVStringify() gojq.CompilerOption {
-	return gojq.WithFunction("csv_stringify", 0, 3, func(v any, args []any) any {
-		// Parse arguments: optional delimiter, optional file flag
-		var delimiter rune = ','
-		var inputVal any
-		var isFile bool
-
-		if len(args) > 0 {
-			// Check if first arg is delimiter (string) or file flag (bool)
-			if delimStr, ok := args[0].(string); ok && len(delimStr) > 0 {
-				delimiter = rune(delimStr[0])
-				// Check for file flag as second arg
-				if len(args) > 1 {
-					if fileFlag, ok := args[1].(bool); ok {
-						isFile = fileFlag
-						inputVal = v
-					} else {
-						inputVal = args[1]
-						if len(args) > 2 {
-							if fileFlag, ok := args[2].(bool); ok {
-								isFile = fileFlag
-							}
-						}
-					}
-				} else {
-					inputVal = v
-				}
-			} else if fileFlag, ok := args[0].(bool); ok {
-				isFile = fileFlag
-				inputVal = v
-			} else {
-				inputVal = args[0]
-			}
-		} else {
-			inputVal = v
+	return common.WithFunction("csv_stringify", 0, 3, func(v any, args []any) any {
+		inputVal, opts, err := parseArgs("csv_stringify", v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
 		}
 
-		inputVal = common.ExtractUDFValue(inputVal)
+		// Input should be an array of arrays, or an array of objects
+		rows, ok := inputVal.([]any)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "csv_stringify: input must be an array of arrays, got %T", inputVal), nil)
+		}
 
-		// Input should be an array of arrays
-		var records [][]string
-		switch val := inputVal.(type) {
-		case []any:
-			records = make([][]string, len(val))
-			for i, row := range val {
-				switch rowVal := row.(type) {
-				case []any:
-					records[i] = make([]string, len(rowVal))
-					for j, field := range rowVal {
-						records[i][j] = fmt.Sprintf("%v", field)
-					}
-				default:
-					return common.MakeUDFErrorResult(fmt.Errorf("csv_stringify: each row must be an array, got %T at index %d", rowVal, i), nil)
-				}
+		columns := opts.Columns
+		hasObjects := false
+		for i, row := range rows {
+			switch rowVal := row.(type) {
+			case []any:
+			case map[string]any:
+				hasObjects = true
+			default:
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "csv_stringify: each row must be an array or an object, got %T at index %d", rowVal, i), nil)
 			}
-		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("csv_stringify: input must be an array of arrays, got %T", val), nil)
 		}
+		if hasObjects && columns == nil {
+			columns = objectColumns(rows)
+		}
+		// Objects get a header row unless headers is explicitly false
+		writeHeader := opts.Headers || (hasObjects && !opts.HeadersSet)
 
-		// Convert to CSV
 		var buf strings.Builder
-		writer := csv.NewWriter(&buf)
-		writer.Comma = delimiter
-		if err := writer.WriteAll(records); err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("csv_stringify: failed to write CSV: %v", err), nil)
+		writer, err := NewWriter(&buf, opts.Dialect, opts.QuoteMode, opts.CRLF)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("csv_stringify: %w", err), nil)
+		}
+		if writeHeader && columns != nil {
+			header := make([]Field, len(columns))
+			for i, name := range columns {
+				header[i] = Field{Value: name}
+			}
+			if err := writer.Write(header); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("csv_stringify: failed to write CSV: %w", err), nil)
+			}
+		}
+		for i, row := range rows {
+			var record []Field
+			switch rowVal := row.(type) {
+			case []any:
+				record = make([]Field, len(rowVal))
+				for j, field := range rowVal {
+					record[j] = toField(field)
+				}
+			case map[string]any:
+				record = make([]Field, len(columns))
+				for j, name := range columns {
+					record[j] = toField(rowVal[name])
+				}
+			}
+			if err := writer.Write(record); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("csv_stringify: failed to write row %d: %w", i, err), nil)
+			}
 		}
-		writer.Flush()
 
 		result := buf.String()
 
 		meta := map[string]any{
-			"operation": "csv_stringify",
-			"delimiter": string(delimiter),
-			"rows":      len(records),
+			"operation":     "csv_stringify",
+			"delimiter":     string(opts.Delimiter),
+			"rows":          len(rows),
 			"output_length": len(result),
 		}
-
-		if isFile {
-			filePathStr, ok := inputVal.(string)
-			if ok {
-				_, absPath, size, err := common.ReadFileFromPath(filePathStr)
-				if err == nil {
-					meta["file_path"] = absPath
-					meta["file_size"] = int(size)
-				}
-			}
+		if columns != nil {
+			meta["columns"] = len(columns)
 		}
 
-  return common.MakeUDFSuccessResult(result, meta)
+		return common.MakeUDFSuccessResult(result, meta)
 	})
 }
 
+// objectColumns collects the keys of all object rows. Keys of each row are
+// sorted, and columns keep the order in which they first appear
+func objectColumns(rows []any) []string {
+	var columns []string
+	seen := map[string]bool{}
+	for _, row := range rows {
+		obj, ok := row.(map[string]any)
+		if !ok {
+			continue
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			if !seen[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			seen[k] = true
+			columns = append(columns, k)
+		}
+	}
+	return columns
+}
@@ -2,10 +2,53 @@ package csv
 
 import (
 	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
 )
 
+// Helper to compile and run a gojq query, collecting every output
+func runGojqQueryAll(t *testing.T, query string, input any, options ...gojq.CompilerOption) []any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var results []any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+// Helper to run a gojq query that produces a single output
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	results := runGojqQueryAll(t, query, input, options...)
+	if len(results) != 1 {
+		t.Fatalf("Query %q produced %d outputs, want 1: %v", query, len(results), results)
+	}
+	return results[0]
+}
+
 func TestCSVParse(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -115,3 +158,234 @@ func TestCSVRoundTrip(t *testing.T) {
 	}
 }
 
+
+func TestDialectReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		dialect Dialect
+		want    [][]string
+		wantErr string
+	}{
+		{"quoted fields", "a,\"b,c\",\"d\"\"e\"\r\n1,2,3\n", DefaultDialect, [][]string{{"a", "b,c", `d"e`}, {"1", "2", "3"}}, ""},
+		{"multiline field", "\"x\ny\",z\n\n", DefaultDialect, [][]string{{"x\ny", "z"}}, ""},
+		{"empty fields", ",,\n", DefaultDialect, [][]string{{"", "", ""}}, ""},
+		{"single quote", "'a,b',c", Dialect{Delimiter: ',', Quote: '\'', Escape: '\''}, [][]string{{"a,b", "c"}}, ""},
+		{"backslash escape", `"a\"b",c`, Dialect{Delimiter: ',', Quote: '"', Escape: '\\'}, [][]string{{`a"b`, "c"}}, ""},
+		{"no quoting", `"a",b`, Dialect{Delimiter: ','}, [][]string{{`"a"`, "b"}}, ""},
+		{"comments", "# header\na,b\n", Dialect{Delimiter: ',', Quote: '"', Escape: '"', Comment: '#'}, [][]string{{"a", "b"}}, ""},
+		{"trim space", "a,  \"b\"", Dialect{Delimiter: ',', Quote: '"', Escape: '"', TrimSpace: true}, [][]string{{"a", "b"}}, ""},
+		{"lazy quotes", `a"b,"c"d"`, Dialect{Delimiter: ',', Quote: '"', Escape: '"', LazyQuotes: true}, [][]string{{`a"b`, `c"d`}}, ""},
+		{"bare quote", "a\nb\"c", DefaultDialect, nil, "line 2: bare quote"},
+		{"extraneous", `"a"b`, DefaultDialect, nil, "line 1: unexpected character"},
+		{"unterminated", "a\n\"b\nc", DefaultDialect, nil, "line 2: quoted field is not terminated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.input), tt.dialect)
+			var got [][]string
+			for {
+				record, err := r.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					if tt.wantErr == "" || !strings.HasPrefix(err.Error(), tt.wantErr) {
+						t.Fatalf("Read() error = %v, want %q", err, tt.wantErr)
+					}
+					return
+				}
+				got = append(got, record)
+			}
+			if tt.wantErr != "" {
+				t.Fatalf("Read() expected error %q, got %v", tt.wantErr, got)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialectWriter(t *testing.T) {
+	record := []Field{{Value: "a"}, {Value: "b,c"}, {Value: `d"e`}, {Value: "1", Numeric: true}, {Value: ""}}
+	tests := []struct {
+		name    string
+		dialect Dialect
+		mode    QuoteMode
+		want    string
+		wantErr string
+	}{
+		{"minimal", DefaultDialect, QuoteMinimal, "a,\"b,c\",\"d\"\"e\",1,\n", ""},
+		{"all", DefaultDialect, QuoteAll, "\"a\",\"b,c\",\"d\"\"e\",\"1\",\"\"\n", ""},
+		{"nonnumeric", DefaultDialect, QuoteNonNumeric, "\"a\",\"b,c\",\"d\"\"e\",1,\"\"\n", ""},
+		{"backslash escape", Dialect{Delimiter: ',', Quote: '"', Escape: '\\'}, QuoteMinimal, `a,"b,c","d\"e",1,` + "\n", ""},
+		{"none", Dialect{Delimiter: ',', Escape: '\\'}, QuoteNone, `a,b\,c,d"e,1,` + "\n", ""},
+		{"none without escape", DefaultDialect, QuoteNone, "", "field \"b,c\" needs quoting"},
+		{"unknown mode", DefaultDialect, "smart", "", "unknown quote_mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			w, err := NewWriter(&buf, tt.dialect, tt.mode, false)
+			if err == nil {
+				err = w.Write(record)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("Write() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Write() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVParseUDF(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterCSVParse()}
+
+	tests := []struct {
+		name  string
+		query string
+		input any
+		want  any
+	}{
+		{"arrays", `csv_parse`, "a,b\n1,2\n", []any{[]any{"a", "b"}, []any{"1", "2"}}},
+		{"empty", `csv_parse`, "", []any{}},
+		{"delimiter", `csv_parse(";")`, "a;b", []any{[]any{"a", "b"}}},
+		{"delimiter option", `csv_parse({delimiter: "\t"})`, "a\tb", []any{[]any{"a", "b"}}},
+		{"headers", `csv_parse({headers: true})`, "name,age\nada,36\nbob\n",
+			[]any{map[string]any{"name": "ada", "age": "36"}, map[string]any{"name": "bob", "age": nil}}},
+		{"header names", `csv_parse({headers: ["x", "y"]})`, "1,2\n", []any{map[string]any{"x": "1", "y": "2"}}},
+		{"duplicate headers", `csv_parse({headers: true})`, "a,a,\n1,2,3", []any{map[string]any{"a": "1", "a_2": "2", "column_3": "3"}}},
+		{"quote and escape", `csv_parse({quote: "'", escape: "\\"})`, `'it\'s',x`, []any{[]any{"it's", "x"}}},
+		{"positional input", `csv_parse("|"; "a|b")`, nil, []any{[]any{"a", "b"}}},
+		{"positional with options", `csv_parse("|"; "a|b"; {headers: ["k", "v"]})`, nil, []any{map[string]any{"k": "a", "v": "b"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query, tt.input, opts...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVParseStream(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterCSVParse()}
+	path := filepath.Join(t.TempDir(), "people.csv")
+	if err := os.WriteFile(path, []byte("name,age\nada,36\nbob,41\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := runGojqQueryAll(t, `csv_parse({file: true, stream: true, headers: true})`, path, opts...)
+	want := []any{map[string]any{"name": "ada", "age": "36"}, map[string]any{"name": "bob", "age": "41"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stream = %v, want %v", got, want)
+	}
+
+	// Rows are produced lazily, so limit stops reading early
+	got = runGojqQueryAll(t, `limit(1; csv_parse({stream: true}))`, "a\nb\n\"", opts...)
+	if !reflect.DeepEqual(got, []any{[]any{"a"}}) {
+		t.Errorf("Limited stream = %v", got)
+	}
+
+	// Rows before a malformed record are still emitted, followed by the error
+	got = runGojqQueryAll(t, `csv_parse({stream: true})`, "a\nb\n\"c", opts...)
+	if len(got) != 3 {
+		t.Fatalf("Expected 2 rows and an error, got %v", got)
+	}
+	errStr := common.GetUDFError(got[2])
+	if !strings.Contains(errStr, "line 3: quoted field is not terminated") {
+		t.Errorf("Unexpected stream error %v", got[2])
+	}
+
+	// The legacy file flag still reads the whole file
+	got = runGojqQueryAll(t, `csv_parse(","; true)`, path, opts...)
+	if len(got) != 1 || len(got[0].([]any)) != 3 {
+		t.Errorf("File parse = %v", got)
+	}
+}
+
+func TestCSVStringifyUDF(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterCSVStringify()}
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"arrays", `[["a", "b,c"], [1, null, true]] | csv_stringify`, "a,\"b,c\"\n1,,true\n"},
+		{"delimiter", `[["a", "b"]] | csv_stringify("\t")`, "a\tb\n"},
+		{"objects", `[{name: "ada", age: 36}, {name: "bob", city: "x"}] | csv_stringify`, "age,name,city\n36,ada,\n,bob,x\n"},
+		{"objects without header", `[{b: 1, a: 2}] | csv_stringify({headers: false})`, "2,1\n"},
+		{"header order", `[{b: 1, a: 2, c: 3}] | csv_stringify({headers: ["b", "a"]})`, "b,a\n1,2\n"},
+		{"header for arrays", `[[1, 2]] | csv_stringify({headers: ["x", "y"]})`, "x,y\n1,2\n"},
+		{"nested values", `[[{a: 1}, [1, 2]]] | csv_stringify`, "\"{\"\"a\"\":1}\",\"[1,2]\"\n"},
+		{"quote all", `[["a", 1]] | csv_stringify({quote_mode: "all"})`, "\"a\",\"1\"\n"},
+		{"quote nonnumeric", `[["a", 1]] | csv_stringify({quote_mode: "nonnumeric"})`, "\"a\",1\n"},
+		{"single quote", `[["it's", "b"]] | csv_stringify({quote: "'"})`, "'it''s',b\n"},
+		{"escape", `[["say \"hi\"", "b"]] | csv_stringify({escape: "\\"})`, `"say \"hi\"",b` + "\n"},
+		{"crlf", `[["a"], ["b"]] | csv_stringify({crlf: true})`, "a\r\nb\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query+` | ._val`, nil, opts...)
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVRoundTripUDF(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterCSVParse(), RegisterCSVStringify()}
+	rows := []any{map[string]any{"name": "a \"quoted\" value", "note": "line1\nline2"}, map[string]any{"name": " x", "note": "y;z"}}
+
+	got := runGojqQuery(t, `csv_stringify({delimiter: ";"}) | ._val | csv_parse({delimiter: ";", headers: true})`, rows, opts...)
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("Round trip = %v, want %v", got, rows)
+	}
+}
+
+func TestCSVErrors(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterCSVParse(), RegisterCSVStringify()}
+
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`csv_parse({headers: true})`, "a\n1,2", "csv_parse: failed to parse CSV: line 2: record has 2 fields, header has 1"},
+		{`csv_parse`, "a\"b", "csv_parse: failed to parse CSV: line 1: bare quote"},
+		{`csv_parse({delimiter: "ab"})`, "", "csv_parse: option delimiter must be a single character"},
+		{`csv_parse({bogus: 1})`, "", `csv_parse: unknown option "bogus"`},
+		{`csv_parse({headers: 1})`, "", "csv_parse: option headers must be a boolean or an array of strings"},
+		{`csv_parse({file: true})`, "/nonexistent/file.csv", "csv_parse: file does not exist"},
+		{`csv_parse`, 5, "csv_parse: argument must be a string"},
+		{`csv_stringify`, "x", "csv_stringify: input must be an array of arrays"},
+		{`csv_stringify`, []any{"x"}, "csv_stringify: each row must be an array or an object"},
+		{`csv_stringify({quote_mode: "smart"})`, []any{}, "csv_stringify: unknown quote_mode"},
+		{`csv_stringify({quote: ""})`, []any{[]any{"a"}}, "csv_stringify: quoting is disabled"},
+		{`csv_stringify({quote: "", quote_mode: "none"})`, []any{[]any{"a,b"}}, "csv_stringify: failed to write row 0: field"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, opts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
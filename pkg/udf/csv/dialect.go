@@ -0,0 +1,326 @@
+package csv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Dialect describes how fields are separated, quoted and escaped
+type Dialect struct {
+	Delimiter  rune // field separator, ',' by default
+	Quote      rune // quote character, 0 disables quoting
+	Escape     rune // escape inside quoted fields; equal to Quote means doubling ("")
+	Comment    rune // lines starting with this rune are skipped, 0 for none
+	LazyQuotes bool // tolerate stray quotes instead of failing
+	TrimSpace  bool // ignore leading whitespace before each field
+}
+
+// DefaultDialect is RFC 4180 CSV
+var DefaultDialect = Dialect{Delimiter: ',', Quote: '"', Escape: '"'}
+
+// ParseError reports a malformed record with its position in the input
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+var (
+	errBareQuote      = errors.New("bare quote in unquoted field (use lazy_quotes to allow)")
+	errExtraneous     = errors.New("unexpected character after closing quote (use lazy_quotes to allow)")
+	errUnterminated   = errors.New("quoted field is not terminated")
+	errDanglingEscape = errors.New("escape character at end of input")
+)
+
+// Reader reads records one at a time
+type Reader struct {
+	d    Dialect
+	r    *bufio.Reader
+	line int
+
+	pending    rune
+	hasPending bool
+}
+
+// NewReader returns a Reader for the dialect
+func NewReader(r io.Reader, d Dialect) *Reader {
+	return &Reader{d: d, r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Line returns the line number of the last line read
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// readRune reads the next rune, folding "\r\n" into '\n'
+func (r *Reader) readRune() (rune, error) {
+	if r.hasPending {
+		r.hasPending = false
+		return r.pending, nil
+	}
+	c, _, err := r.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if c == '\r' {
+		if next, _, err := r.r.ReadRune(); err == nil {
+			if next == '\n' {
+				return '\n', nil
+			}
+			r.r.UnreadRune()
+		}
+	}
+	return c, nil
+}
+
+// Read returns the next record. Blank lines and comment lines are skipped.
+// It returns io.EOF when the input is exhausted
+func (r *Reader) Read() ([]string, error) {
+	for {
+		c, err := r.readRune()
+		if err != nil {
+			return nil, err
+		}
+		r.line++
+		if c == '\n' {
+			continue
+		}
+		if r.d.Comment != 0 && c == r.d.Comment {
+			if err := r.skipLine(); err != nil && err != io.EOF {
+				return nil, err
+			}
+			continue
+		}
+		r.pending, r.hasPending = c, true
+		return r.readRecord()
+	}
+}
+
+func (r *Reader) skipLine() error {
+	for {
+		c, err := r.readRune()
+		if err != nil || c == '\n' {
+			return err
+		}
+	}
+}
+
+func (r *Reader) readRecord() ([]string, error) {
+	startLine := r.line
+	var record []string
+	var field strings.Builder
+	for {
+		field.Reset()
+		c, err := r.readRune()
+		if r.d.TrimSpace {
+			for err == nil && (c == ' ' || c == '\t') {
+				c, err = r.readRune()
+			}
+		}
+
+		if err == nil && r.d.Quote != 0 && c == r.d.Quote {
+			end, err := r.readQuoted(&field, startLine)
+			if err != nil {
+				return nil, err
+			}
+			record = append(record, field.String())
+			if end {
+				return record, nil
+			}
+			continue
+		}
+
+		// Unquoted field
+		for err == nil && c != r.d.Delimiter && c != '\n' {
+			if r.d.Quote != 0 && c == r.d.Quote && !r.d.LazyQuotes {
+				return nil, &ParseError{r.line, errBareQuote}
+			}
+			field.WriteRune(c)
+			c, err = r.readRune()
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		record = append(record, field.String())
+		if err == io.EOF || c == '\n' {
+			return record, nil
+		}
+	}
+}
+
+// readQuoted reads the rest of a quoted field after its opening quote. It
+// reports whether the record ended after the field
+func (r *Reader) readQuoted(field *strings.Builder, startLine int) (bool, error) {
+	for {
+		c, err := r.readRune()
+		if err == io.EOF {
+			if r.d.LazyQuotes {
+				return true, nil
+			}
+			return false, &ParseError{startLine, errUnterminated}
+		}
+		if err != nil {
+			return false, err
+		}
+		if c == '\n' {
+			r.line++
+			field.WriteRune('\n')
+			continue
+		}
+
+		if r.d.Escape != r.d.Quote && c == r.d.Escape {
+			next, err := r.readRune()
+			if err != nil {
+				return false, &ParseError{r.line, errDanglingEscape}
+			}
+			if next == '\n' {
+				r.line++
+			}
+			field.WriteRune(next)
+			continue
+		}
+		if c != r.d.Quote {
+			field.WriteRune(c)
+			continue
+		}
+
+		// A quote either ends the field or, when doubled, is a literal quote
+		next, err := r.readRune()
+		switch {
+		case err == io.EOF:
+			return true, nil
+		case err != nil:
+			return false, err
+		case next == r.d.Quote && r.d.Escape == r.d.Quote:
+			field.WriteRune(r.d.Quote)
+		case next == r.d.Delimiter:
+			return false, nil
+		case next == '\n':
+			return true, nil
+		case r.d.LazyQuotes:
+			field.WriteRune(c)
+			field.WriteRune(next)
+		default:
+			return false, &ParseError{r.line, errExtraneous}
+		}
+	}
+}
+
+// QuoteMode controls which fields a Writer quotes
+type QuoteMode string
+
+const (
+	QuoteMinimal    QuoteMode = "minimal"    // only fields that need it
+	QuoteAll        QuoteMode = "all"        // every field
+	QuoteNonNumeric QuoteMode = "nonnumeric" // every field that is not a number
+	QuoteNone       QuoteMode = "none"       // never; special characters are escaped
+)
+
+// Field is a value to write along with whether it came from a number
+type Field struct {
+	Value   string
+	Numeric bool
+}
+
+// Writer writes records using a dialect
+type Writer struct {
+	d    Dialect
+	mode QuoteMode
+	crlf bool
+	w    *strings.Builder
+}
+
+// NewWriter returns a Writer appending to w
+func NewWriter(w *strings.Builder, d Dialect, mode QuoteMode, crlf bool) (*Writer, error) {
+	switch mode {
+	case "":
+		mode = QuoteMinimal
+	case QuoteMinimal, QuoteAll, QuoteNonNumeric, QuoteNone:
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "unknown quote_mode %q (supported: minimal, all, nonnumeric, none)", mode)
+	}
+	if mode != QuoteNone && d.Quote == 0 {
+		return nil, common.Errorf(common.CodeInvalid, "quoting is disabled; set quote_mode to \"none\"")
+	}
+	return &Writer{d: d, mode: mode, crlf: crlf, w: w}, nil
+}
+
+// Write writes a single record
+func (w *Writer) Write(record []Field) error {
+	for i, f := range record {
+		if i > 0 {
+			w.w.WriteRune(w.d.Delimiter)
+		}
+		if err := w.writeField(f); err != nil {
+			return err
+		}
+	}
+	if w.crlf {
+		w.w.WriteString("\r\n")
+	} else {
+		w.w.WriteByte('\n')
+	}
+	return nil
+}
+
+func (w *Writer) special(r rune) bool {
+	return r == w.d.Delimiter || r == '\n' || r == '\r' ||
+		(w.d.Quote != 0 && r == w.d.Quote) || (w.d.Escape != 0 && r == w.d.Escape)
+}
+
+func (w *Writer) needsQuotes(f Field) bool {
+	switch w.mode {
+	case QuoteAll:
+		return true
+	case QuoteNonNumeric:
+		return !f.Numeric
+	case QuoteNone:
+		return false
+	}
+	if f.Value == "" {
+		return false
+	}
+	if f.Value[0] == ' ' || f.Value[0] == '\t' {
+		return true
+	}
+	return strings.IndexFunc(f.Value, w.special) >= 0
+}
+
+func (w *Writer) writeField(f Field) error {
+	if !w.needsQuotes(f) {
+		if w.mode != QuoteNone {
+			w.w.WriteString(f.Value)
+			return nil
+		}
+		// Without quoting, special characters must be escaped
+		for _, r := range f.Value {
+			if w.special(r) {
+				if w.d.Escape == 0 || w.d.Escape == w.d.Quote {
+					return common.Errorf(common.CodeInvalid, "field %v needs quoting or an escape character", strconv.Quote(f.Value))
+				}
+				w.w.WriteRune(w.d.Escape)
+			}
+			w.w.WriteRune(r)
+		}
+		return nil
+	}
+
+	w.w.WriteRune(w.d.Quote)
+	for _, r := range f.Value {
+		if r == w.d.Quote || (r == w.d.Escape && w.d.Escape != w.d.Quote) {
+			w.w.WriteRune(w.d.Escape)
+		}
+		w.w.WriteRune(r)
+	}
+	w.w.WriteRune(w.d.Quote)
+	return nil
+}
@@ -10,10 +10,10 @@ import (
 
 // RegisterEntropy registers the entropy function with gojq
 func RegisterEntropy() gojq.CompilerOption {
-	return gojq.WithFunction("entropy", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("entropy", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("entropy: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("entropy: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -25,7 +25,7 @@ func RegisterEntropy() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("entropy: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "entropy: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -33,25 +33,18 @@ func RegisterEntropy() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "entropy",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("entropy: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("entropy: %w", err), meta)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("entropy: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("entropy: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		if len(inputBytes) == 0 {
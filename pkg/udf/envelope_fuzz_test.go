@@ -0,0 +1,206 @@
+package udf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// sideEffectCategories lists metadata categories whose functions touch the
+// filesystem, network, or spawn processes. They are never fed fuzz input.
+var sideEffectCategories = map[string]bool{
+	"File Operations": true,
+	"System":          true,
+	"HTTP":            true,
+	"Network":         true,
+}
+
+// envelopeCase is a compiled call of a single UDF with a fixed number of
+// string arguments bound to $a0..$aN.
+type envelopeCase struct {
+	name  string
+	query string
+	arity int
+	code  *gojq.Code
+}
+
+// pureEnvelopeCases compiles every registered side-effect free UDF at each
+// arity it accepts (capped at 3, which covers all positional arguments).
+func pureEnvelopeCases(t testing.TB) []envelopeCase {
+	options := DefaultRegistry().Options()
+	var cases []envelopeCase
+	for _, meta := range GetFunctionMetadata() {
+		if sideEffectCategories[meta.Category] {
+			continue
+		}
+		for arity := meta.MinArgs; arity <= meta.MaxArgs && arity <= 3; arity++ {
+			vars := make([]string, arity)
+			for i := range vars {
+				vars[i] = fmt.Sprintf("$a%d", i)
+			}
+			query := meta.Name
+			if arity > 0 {
+				query += "(" + strings.Join(vars, "; ") + ")"
+			}
+			parsed, err := gojq.Parse(query)
+			if err != nil {
+				// Names such as 3des_encrypt are not valid jq identifiers
+				// and cannot be reached from a query at all
+				break
+			}
+			code, err := gojq.Compile(parsed, append([]gojq.CompilerOption{gojq.WithVariables(vars)}, options...)...)
+			if err != nil {
+				t.Fatalf("Failed to compile query %q: %v", query, err)
+			}
+			cases = append(cases, envelopeCase{meta.Name, query, arity, code})
+		}
+	}
+	return cases
+}
+
+// runEnvelopeCase runs the case, converting panics into test failures.
+func runEnvelopeCase(t testing.TB, c envelopeCase, input any, args []any) (results []any) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("%s panicked on input %q args %q: %v", c.query, input, args, r)
+		}
+	}()
+	iter := c.code.Run(input, args[:c.arity]...)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+// checkEnvelope asserts the {_schema,_val,_meta,_err} invariants on a single result.
+func checkEnvelope(t testing.TB, c envelopeCase, v any) {
+	if _, ok := v.(error); ok {
+		// gojq-level errors (e.g. argument type errors) are not envelopes
+		return
+	}
+	obj, ok := v.(map[string]any)
+	if !ok || !common.IsUDFResult(obj) {
+		// json_parse and csv_parse return bare values by design
+		return
+	}
+	if err := common.ValidateUDFResult(obj); err != nil {
+		t.Errorf("%s: %v", c.query, err)
+	}
+	if common.HasUDFError(obj) {
+		if common.GetUDFError(obj) == "" || obj["_err"].(map[string]any)["function"] == "" {
+			t.Errorf("%s: _err must have a message and function, got %v", c.query, obj["_err"])
+		}
+		if obj["_val"] != nil {
+			t.Errorf("%s: _val must be null when _err is set, got %v", c.query, obj["_val"])
+		}
+	}
+}
+
+// metaKeys returns the sorted _meta keys of an envelope, or nil.
+func metaKeys(v any) []string {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	meta, ok := obj["_meta"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func checkAllEnvelopes(t testing.TB, cases []envelopeCase, input any, args []any) {
+	for _, c := range cases {
+		first := runEnvelopeCase(t, c, input, args)
+		for _, v := range first {
+			checkEnvelope(t, c, v)
+		}
+		// Metadata keys must be a function of the input, not of the run
+		second := runEnvelopeCase(t, c, input, args)
+		if len(first) != len(second) {
+			t.Fatalf("%s: result count changed between runs: %d != %d", c.query, len(first), len(second))
+		}
+		for i := range first {
+			a, b := metaKeys(first[i]), metaKeys(second[i])
+			if strings.Join(a, ",") != strings.Join(b, ",") {
+				t.Errorf("%s: _meta keys changed between runs: %v != %v", c.query, a, b)
+			}
+		}
+	}
+}
+
+func TestUDFEnvelopeInvariants(t *testing.T) {
+	cases := pureEnvelopeCases(t)
+	inputs := []any{
+		nil,
+		"",
+		"hello",
+		"\x00\xff\xfe\x80",
+		"\xef\xbb\xbf{\"a\":",
+		strings.Repeat("A", 4096),
+		"1f8b0800000000000000",
+		"H4sIAAAAAAAA/w==",
+		42,
+		3.5,
+		true,
+		[]any{"a", 1, nil},
+		map[string]any{"_val": "\xff", "_meta": map[string]any{}},
+		map[string]any{"key": []any{map[string]any{}}},
+	}
+	args := []any{"key", "\x00", ","}
+	for _, input := range inputs {
+		checkAllEnvelopes(t, cases, input, args)
+	}
+}
+
+func FuzzUDFEnvelope(f *testing.F) {
+	f.Add("hello", "key", ",")
+	f.Add("", "", "")
+	f.Add("\x00\xff", "0123456789abcdef", "hex")
+	f.Add("H4sIAAAAAAAA/w==", "CBC", "base64")
+	f.Add("<a><b>1</b></a>", "\"", "a,b\n\"c")
+	cases := pureEnvelopeCases(f)
+	f.Fuzz(func(t *testing.T, input, arg0, arg1 string) {
+		checkAllEnvelopes(t, cases, input, []any{arg0, arg1, input})
+	})
+}
+
+func TestUDFErrorCodes(t *testing.T) {
+	options := DefaultRegistry().Options()
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`[[1, 2]] | struct_pack("<B")`, common.CodeInvalid},
+		{`random_int(5; 1)`, common.CodeInvalid},
+		{`"someday" | date_parse`, common.CodeInvalid},
+		{`1 | base64_decode`, common.CodeInvalid},
+		{`"/nonexistent/timeout" | cat`, common.CodeNotFound},
+	}
+	for _, tt := range tests {
+		parsed, err := gojq.Parse(tt.query + ` | ._err.code`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := gojq.Compile(parsed, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := code.Run(nil).Next(); got != tt.want {
+			t.Errorf("%s: code = %v, want %s", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package fake
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+var (
+	firstNames = []string{"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda", "David", "Elizabeth",
+		"William", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah", "Charles", "Karen",
+		"Daniel", "Lisa", "Matthew", "Nancy", "Anthony", "Sandra", "Mark", "Ashley", "Priya", "Wei",
+		"Aisha", "Carlos", "Yuki", "Olga", "Mohammed", "Sofia", "Lucas", "Amara", "Mateo", "Ingrid"}
+	lastNames = []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+		"Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin",
+		"Lee", "Perez", "Thompson", "White", "Harris", "Clark", "Lewis", "Walker", "Patel", "Nguyen",
+		"Kim", "Chen", "Singh", "Okafor", "Novak", "Schmidt", "Rossi", "Silva", "Tanaka", "Larsen"}
+	streetNames = []string{"Main", "Oak", "Pine", "Maple", "Cedar", "Elm", "Washington", "Lake", "Hill", "Park",
+		"Sunset", "River", "Church", "Mill", "Spring", "Highland", "Meadow", "Forest", "Willow", "Chestnut"}
+	streetSuffixes = []string{"St", "Ave", "Rd", "Blvd", "Ln", "Dr", "Ct", "Way", "Pl", "Terrace"}
+	cities         = []string{"Springfield", "Riverside", "Fairview", "Franklin", "Greenville", "Bristol", "Clinton", "Georgetown",
+		"Salem", "Madison", "Arlington", "Ashland", "Dover", "Oxford", "Milton", "Newport", "Burlington", "Manchester"}
+	states        = []string{"AL", "AZ", "CA", "CO", "FL", "GA", "IL", "MA", "MI", "MN", "NC", "NY", "OH", "OR", "PA", "TX", "VA", "WA"}
+	countries     = []string{"United States", "Canada", "United Kingdom", "Germany", "France", "Japan", "Brazil", "India", "Australia", "Nigeria", "Mexico", "Sweden"}
+	companyWords  = []string{"Acme", "Globex", "Initech", "Umbrella", "Stark", "Wayne", "Vandelay", "Hooli", "Soylent", "Cyberdyne", "Aperture", "Tyrell"}
+	companySuffix = []string{"Inc", "LLC", "Ltd", "Group", "Corp", "Labs", "Systems", "Partners"}
+	emailDomains  = []string{"example.com", "example.org", "example.net"}
+	tlds          = []string{"com", "net", "org", "io", "dev"}
+	loremWords    = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit", "sed", "do",
+		"eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore", "magna", "aliqua", "enim",
+		"ad", "minim", "veniam", "quis", "nostrud", "exercitation", "ullamco", "laboris", "nisi", "aliquip",
+		"ex", "ea", "commodo", "consequat", "duis", "aute", "irure", "in", "reprehenderit", "voluptate"}
+)
+
+// generators make a value of each kind
+var generators = map[string]func(r *rand.Rand) any{
+	"first_name": func(r *rand.Rand) any { return pick(r, firstNames) },
+	"last_name":  func(r *rand.Rand) any { return pick(r, lastNames) },
+	"name":       func(r *rand.Rand) any { return pick(r, firstNames) + " " + pick(r, lastNames) },
+	"username":   func(r *rand.Rand) any { return username(r) },
+	"email": func(r *rand.Rand) any {
+		return username(r) + "@" + pick(r, emailDomains)
+	},
+	"phone": func(r *rand.Rand) any {
+		// 555-01xx numbers are reserved for fiction
+		return fmt.Sprintf("+1-%03d-555-01%02d", 200+r.IntN(800), r.IntN(100))
+	},
+	"ipv4": func(r *rand.Rand) any {
+		return fmt.Sprintf("%d.%d.%d.%d", 1+r.IntN(223), r.IntN(256), r.IntN(256), 1+r.IntN(254))
+	},
+	"ipv6": func(r *rand.Rand) any {
+		ip := make(net.IP, 16)
+		for i := range ip {
+			ip[i] = byte(r.UintN(256))
+		}
+		// Keep it in global unicast 2000::/3
+		ip[0] = 0x20 | ip[0]&0x1f
+		return ip.String()
+	},
+	"mac": func(r *rand.Rand) any {
+		mac := make(net.HardwareAddr, 6)
+		for i := range mac {
+			mac[i] = byte(r.UintN(256))
+		}
+		// Locally administered and unicast, so it is never a real vendor's
+		mac[0] = mac[0]&0xfc | 0x02
+		return mac.String()
+	},
+	"credit_card": func(r *rand.Rand) any { return creditCard(r) },
+	"street":      func(r *rand.Rand) any { return street(r) },
+	"city":        func(r *rand.Rand) any { return pick(r, cities) },
+	"state":       func(r *rand.Rand) any { return pick(r, states) },
+	"zip":         func(r *rand.Rand) any { return fmt.Sprintf("%05d", 1000+r.IntN(98000)) },
+	"country":     func(r *rand.Rand) any { return pick(r, countries) },
+	"address": func(r *rand.Rand) any {
+		return fmt.Sprintf("%s, %s, %s %05d", street(r), pick(r, cities), pick(r, states), 1000+r.IntN(98000))
+	},
+	"company": func(r *rand.Rand) any { return pick(r, companyWords) + " " + pick(r, companySuffix) },
+	"domain":  func(r *rand.Rand) any { return domain(r) },
+	"url": func(r *rand.Rand) any {
+		return "https://" + domain(r) + "/" + pick(r, loremWords) + "/" + pick(r, loremWords)
+	},
+	"word":     func(r *rand.Rand) any { return pick(r, loremWords) },
+	"sentence": func(r *rand.Rand) any { return sentence(r) },
+	"paragraph": func(r *rand.Rand) any {
+		sentences := make([]string, 3+r.IntN(4))
+		for i := range sentences {
+			sentences[i] = sentence(r)
+		}
+		return strings.Join(sentences, " ")
+	},
+	"person": func(r *rand.Rand) any {
+		first, last := pick(r, firstNames), pick(r, lastNames)
+		return map[string]any{
+			"name":    first + " " + last,
+			"email":   strings.ToLower(first+"."+last) + "@" + pick(r, emailDomains),
+			"phone":   fmt.Sprintf("+1-%03d-555-01%02d", 200+r.IntN(800), r.IntN(100)),
+			"address": fmt.Sprintf("%s, %s, %s %05d", street(r), pick(r, cities), pick(r, states), 1000+r.IntN(98000)),
+		}
+	},
+}
+
+// Kinds lists the kinds fake can generate
+func Kinds() []string {
+	kinds := make([]string, 0, len(generators))
+	for k := range generators {
+		kinds = append(kinds, k)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+func pick(r *rand.Rand, list []string) string {
+	return list[r.IntN(len(list))]
+}
+
+func username(r *rand.Rand) string {
+	return strings.ToLower(pick(r, firstNames)) + "." + strings.ToLower(pick(r, lastNames)) + fmt.Sprint(r.IntN(100))
+}
+
+func street(r *rand.Rand) string {
+	return fmt.Sprintf("%d %s %s", 1+r.IntN(9999), pick(r, streetNames), pick(r, streetSuffixes))
+}
+
+func domain(r *rand.Rand) string {
+	return strings.ToLower(pick(r, companyWords)) + "-" + pick(r, loremWords) + "." + pick(r, tlds)
+}
+
+func sentence(r *rand.Rand) string {
+	words := make([]string, 5+r.IntN(8))
+	for i := range words {
+		words[i] = pick(r, loremWords)
+	}
+	s := strings.Join(words, " ") + "."
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// creditCard makes a number in a Visa, Mastercard or Amex range that passes
+// the Luhn check
+func creditCard(r *rand.Rand) string {
+	var prefix string
+	length := 16
+	switch r.IntN(3) {
+	case 0:
+		prefix = "4"
+	case 1:
+		prefix = fmt.Sprint(51 + r.IntN(5))
+	default:
+		prefix, length = pick(r, []string{"34", "37"}), 15
+	}
+	digits := []byte(prefix)
+	for len(digits) < length-1 {
+		digits = append(digits, byte('0'+r.IntN(10)))
+	}
+	return string(append(digits, LuhnDigit(string(digits))))
+}
+
+// LuhnDigit is the check digit to append to digits
+func LuhnDigit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		// Double every second digit from the right of the final number,
+		// starting with the last one here
+		if (len(digits)-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// seedArg reads a seed: an integer, or a string, which is hashed so
+// the same value always gets the same fake
+func seedArg(raw any) (uint64, error) {
+	switch val := common.ExtractUDFValue(raw).(type) {
+	case int:
+		return uint64(val), nil
+	case float64:
+		if val != math.Trunc(val) {
+			return 0, common.Errorf(common.CodeInvalid, "options.seed must be an integer or a string, got %v", val)
+		}
+		return uint64(int64(val)), nil
+	case string:
+		h := fnv.New64a()
+		h.Write([]byte(val))
+		return h.Sum64(), nil
+	case nil:
+		return 0, common.Errorf(common.CodeInvalid, "options.seed must be an integer or a string, got null")
+	default:
+		return 0, common.Errorf(common.CodeInvalid, "options.seed must be an integer or a string, got %T", val)
+	}
+}
+
+// RegisterFake registers the fake function with gojq
+func RegisterFake() gojq.CompilerOption {
+	return common.WithFunction("fake", 1, 2, func(v any, args []any) any {
+		// fake(kind) or fake(kind; {seed}). With a seed the value is
+		// reproducible: the same kind and seed always give the same value
+		kind, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "fake: kind must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		gen, ok := generators[kind]
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "fake: unknown kind %q, must be one of %v", kind, strings.Join(Kinds(), ", ")), nil)
+		}
+
+		meta := map[string]any{
+			"operation": "fake",
+			"kind":      kind,
+		}
+		r := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+		if len(args) > 1 {
+			opts, ok := common.ExtractUDFValue(args[1]).(map[string]any)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "fake: options must be an object, got %T", common.ExtractUDFValue(args[1])), nil)
+			}
+			for key, raw := range opts {
+				switch key {
+				case "seed":
+					seed, err := seedArg(raw)
+					if err != nil {
+						return common.MakeUDFErrorResult(fmt.Errorf("fake: %w", err), nil)
+					}
+					// Mix in the kind so fake("name") and fake("email")
+					// with one seed are not drawn from the same stream
+					h := fnv.New64a()
+					h.Write([]byte(kind))
+					r = rand.New(rand.NewPCG(seed, h.Sum64()))
+					meta["seed"] = common.ExtractUDFValue(raw)
+				default:
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "fake: unknown option %q", key), nil)
+				}
+			}
+		}
+
+		return common.MakeUDFSuccessResult(gen(r), meta)
+	})
+}
@@ -0,0 +1,131 @@
+package fake
+
+import (
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+func luhnValid(s string) bool {
+	return LuhnDigit(s[:len(s)-1]) == s[len(s)-1]
+}
+
+func TestFakeKinds(t *testing.T) {
+	tests := []struct {
+		kind  string
+		check func(string) bool
+	}{
+		{"name", regexp.MustCompile(`^[A-Z][a-z]+ [A-Z][a-z]+$`).MatchString},
+		{"email", regexp.MustCompile(`^[a-z]+\.[a-z]+\d+@example\.(com|org|net)$`).MatchString},
+		{"ipv4", func(s string) bool { return net.ParseIP(s).To4() != nil }},
+		{"ipv6", func(s string) bool { ip := net.ParseIP(s); return ip != nil && ip.To4() == nil && ip.IsGlobalUnicast() }},
+		{"mac", func(s string) bool { m, err := net.ParseMAC(s); return err == nil && m[0]&0x03 == 0x02 }},
+		{"credit_card", func(s string) bool { return regexp.MustCompile(`^\d{15,16}$`).MatchString(s) && luhnValid(s) }},
+		{"phone", regexp.MustCompile(`^\+1-\d{3}-555-01\d{2}$`).MatchString},
+		{"zip", regexp.MustCompile(`^\d{5}$`).MatchString},
+		{"address", regexp.MustCompile(`^\d+ \w+ \w+, \w+, [A-Z]{2} \d{5}$`).MatchString},
+		{"sentence", regexp.MustCompile(`^[A-Z][a-z]*( [a-z]+)+\.$`).MatchString},
+		{"url", regexp.MustCompile(`^https://[a-z]+-[a-z]+\.[a-z]+/[a-z]+/[a-z]+$`).MatchString},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			res := runGojqQuery(t, `fake("`+tt.kind+`")`, nil, RegisterFake()).(map[string]any)
+			s, ok := res["_val"].(string)
+			if !ok || !tt.check(s) {
+				t.Fatalf("fake(%q) = %v", tt.kind, res)
+			}
+		}
+	}
+
+	for _, kind := range Kinds() {
+		res := runGojqQuery(t, `fake("`+kind+`")`, nil, RegisterFake()).(map[string]any)
+		if res["_val"] == nil || res["_meta"].(map[string]any)["kind"] != kind {
+			t.Errorf("fake(%q) = %v", kind, res)
+		}
+	}
+
+	person := runGojqQuery(t, `fake("person") | ._val | keys`, nil, RegisterFake())
+	if !reflect.DeepEqual(person, []any{"address", "email", "name", "phone"}) {
+		t.Errorf("person keys = %v", person)
+	}
+}
+
+func TestFakeSeed(t *testing.T) {
+	query := `[fake("name"; {seed: 42}), fake("name"; {seed: 42}), fake("name"; {seed: 43})] | map(._val)`
+	got := runGojqQuery(t, query, nil, RegisterFake()).([]any)
+	if got[0] != got[1] {
+		t.Errorf("same seed gave %v and %v", got[0], got[1])
+	}
+
+	// String seeds map the same input to the same fake, for anonymizing
+	query = `[.[] | fake("email"; {seed: .})._val]`
+	emails := runGojqQuery(t, query, []any{"alice@corp", "bob@corp", "alice@corp"}, RegisterFake()).([]any)
+	if emails[0] != emails[2] || emails[0] == emails[1] {
+		t.Errorf("emails = %v", emails)
+	}
+
+	seed := runGojqQuery(t, `fake("word"; {seed: "x"}) | ._meta.seed`, nil, RegisterFake())
+	if seed != "x" {
+		t.Errorf("meta seed = %v", seed)
+	}
+}
+
+func TestLuhnDigit(t *testing.T) {
+	for _, number := range []string{"4111111111111111", "5500005555555559", "378282246310005", "79927398713"} {
+		if !luhnValid(number) {
+			t.Errorf("LuhnDigit(%q) = %c", number[:len(number)-1], LuhnDigit(number[:len(number)-1]))
+		}
+	}
+}
+
+func TestFakeErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`fake("dragon")`, `fake: unknown kind "dragon", must be one of address,`},
+		{`fake(1)`, "fake: kind must be a string"},
+		{`fake("name"; "x")`, "fake: options must be an object"},
+		{`fake("name"; {seed: 1.5})`, "fake: options.seed must be an integer or a string"},
+		{`fake("name"; {seed: null})`, "fake: options.seed must be an integer or a string, got null"},
+		{`fake("name"; {locale: "de"})`, `fake: unknown option "locale"`},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, nil, RegisterFake()).(map[string]any)
+		if got := common.GetUDFError(res); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package fileattr
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// pathArg reads and resolves the path argument of the file to change
+func pathArg(raw any) (string, error) {
+	p, ok := common.ExtractUDFValue(raw).(string)
+	if !ok {
+		return "", common.Errorf(common.CodeInvalid, "path must be a string, got %T", common.ExtractUDFValue(raw))
+	}
+	if p == "" {
+		return "", common.Errorf(common.CodeInvalid, "path cannot be empty")
+	}
+	absPath, err := common.ResolvePath(p)
+	if err != nil {
+		return "", err
+	}
+	return absPath, common.CheckWrite(absPath)
+}
+
+// statError describes a failure to find path
+func statError(absPath string, err error) error {
+	if os.IsNotExist(err) {
+		return common.Errorf(common.CodeNotFound, "file does not exist: %q", absPath)
+	}
+	if os.IsPermission(err) {
+		return common.Errorf(common.CodePermission, "permission denied: %q", absPath)
+	}
+	return err
+}
+
+// timeArg reads a time as an RFC3339 string or Unix seconds
+func timeArg(name string, raw any) (time.Time, error) {
+	switch val := common.ExtractUDFValue(raw).(type) {
+	case int:
+		return time.Unix(int64(val), 0), nil
+	case float64:
+		sec, frac := math.Modf(val)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, val)
+		if err != nil {
+			return time.Time{}, common.Errorf(common.CodeInvalid, "options.%v must be an RFC3339 time, got %q", name, val)
+		}
+		return t, nil
+	default:
+		return time.Time{}, common.Errorf(common.CodeInvalid, "options.%v must be an RFC3339 string or Unix seconds, got %T", name, val)
+	}
+}
+
+// RegisterTouch registers the touch function with gojq
+func RegisterTouch() gojq.CompilerOption {
+	return common.WithFunction("touch", 1, 2, common.Audited("touch", func(v any, args []any) any {
+		// touch(path) or touch(path; {time, atime, mtime, no_create})
+		absPath, err := pathArg(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("touch: %w", err), nil)
+		}
+		now := time.Now()
+		atime, mtime := now, now
+		noCreate := false
+		if len(args) > 1 {
+			opts, ok := common.ExtractUDFValue(args[1]).(map[string]any)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "touch: options must be an object, got %T", common.ExtractUDFValue(args[1])), nil)
+			}
+			if raw, ok := opts["time"]; ok {
+				if atime, err = timeArg("time", raw); err != nil {
+					return common.MakeUDFErrorResult(fmt.Errorf("touch: %w", err), nil)
+				}
+				mtime = atime
+			}
+			for key, raw := range opts {
+				switch key {
+				case "time":
+				case "atime":
+					if atime, err = timeArg(key, raw); err != nil {
+						return common.MakeUDFErrorResult(fmt.Errorf("touch: %w", err), nil)
+					}
+				case "mtime":
+					if mtime, err = timeArg(key, raw); err != nil {
+						return common.MakeUDFErrorResult(fmt.Errorf("touch: %w", err), nil)
+					}
+				case "no_create":
+					if noCreate, ok = raw.(bool); !ok {
+						return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "touch: options.no_create must be a boolean, got %T", raw), nil)
+					}
+				default:
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "touch: unknown option %q", key), nil)
+				}
+			}
+		}
+
+		meta := map[string]any{
+			"operation": "touch",
+			"path":      absPath,
+		}
+		created := false
+		if _, err := os.Stat(absPath); os.IsNotExist(err) {
+			if noCreate {
+				meta["created"] = false
+				return common.MakeUDFSuccessResult(absPath, meta)
+			}
+			f, err := os.OpenFile(absPath, os.O_WRONLY|os.O_CREATE, 0644)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("touch: cannot create file %q: %w", absPath, err), meta)
+			}
+			f.Close()
+			created = true
+		}
+		if err := os.Chtimes(absPath, atime, mtime); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("touch: %w", statError(absPath, err)), meta)
+		}
+
+		meta["created"] = created
+		meta["atime"] = atime.UTC().Format(time.RFC3339Nano)
+		meta["mtime"] = mtime.UTC().Format(time.RFC3339Nano)
+		return common.MakeUDFSuccessResult(absPath, meta)
+	}))
+}
+
+// ParseMode applies mode to the permissions cur. mode is octal digits, as
+// in "0755", or symbolic clauses like "u+x,go-w" or "a=r"
+func ParseMode(mode string, cur os.FileMode, isDir bool) (os.FileMode, error) {
+	if mode == "" {
+		return 0, common.Errorf(common.CodeInvalid, "mode cannot be empty")
+	}
+	if mode[0] >= '0' && mode[0] <= '7' {
+		n, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || n > 07777 {
+			return 0, common.Errorf(common.CodeInvalid, "invalid octal mode %q", mode)
+		}
+		return fromUnix(uint32(n)), nil
+	}
+
+	bits := toUnix(cur)
+	for _, clause := range strings.Split(mode, ",") {
+		i := 0
+		var who uint32
+		for ; i < len(clause) && strings.IndexByte("ugoa", clause[i]) >= 0; i++ {
+			who |= map[byte]uint32{'u': 04700, 'g': 02070, 'o': 01007, 'a': 07777}[clause[i]]
+		}
+		if who == 0 {
+			who = 07777
+		}
+		if i == len(clause) {
+			return 0, common.Errorf(common.CodeInvalid, "invalid mode %q: %q has no operator", mode, clause)
+		}
+		for i < len(clause) {
+			op := clause[i]
+			if op != '+' && op != '-' && op != '=' {
+				return 0, common.Errorf(common.CodeInvalid, "invalid mode %q: unexpected %q", mode, op)
+			}
+			i++
+			var perm uint32
+			for ; i < len(clause) && strings.IndexByte("+-=", clause[i]) < 0; i++ {
+				switch clause[i] {
+				case 'r':
+					perm |= 0444
+				case 'w':
+					perm |= 0222
+				case 'x':
+					perm |= 0111
+				case 'X':
+					// Execute only for directories or files some class can
+					// already execute
+					if isDir || bits&0111 != 0 {
+						perm |= 0111
+					}
+				case 's':
+					perm |= 06000
+				case 't':
+					perm |= 01000
+				default:
+					return 0, common.Errorf(common.CodeInvalid, "invalid mode %q: unknown permission %q", mode, clause[i])
+				}
+			}
+			perm &= who
+			switch op {
+			case '+':
+				bits |= perm
+			case '-':
+				bits &^= perm
+			case '=':
+				bits = bits&^who | perm
+			}
+		}
+	}
+	return fromUnix(bits), nil
+}
+
+// toUnix and fromUnix convert between os.FileMode and Unix permission bits,
+// which differ for setuid, setgid and sticky
+func toUnix(m os.FileMode) uint32 {
+	bits := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return bits
+}
+
+func fromUnix(bits uint32) os.FileMode {
+	m := os.FileMode(bits & 0777)
+	if bits&04000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// RegisterChmod registers the chmod function with gojq
+func RegisterChmod() gojq.CompilerOption {
+	return common.WithFunction("chmod", 2, 2, common.Audited("chmod", func(v any, args []any) any {
+		// A number is read like the chmod command reads it, so 755 is
+		// rwxr-xr-x rather than decimal 755
+		absPath, err := pathArg(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("chmod: %w", err), nil)
+		}
+		var mode string
+		switch val := common.ExtractUDFValue(args[1]).(type) {
+		case string:
+			mode = val
+		case int:
+			mode = strconv.Itoa(val)
+		case float64:
+			if val != math.Trunc(val) || val < 0 {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "chmod: invalid mode %v", val), nil)
+			}
+			mode = strconv.FormatFloat(val, 'f', 0, 64)
+		default:
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "chmod: mode must be a string or number, got %T", val), nil)
+		}
+
+		meta := map[string]any{
+			"operation": "chmod",
+			"path":      absPath,
+		}
+		info, err := os.Stat(absPath)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("chmod: %w", statError(absPath, err)), meta)
+		}
+		newMode, err := ParseMode(mode, info.Mode(), info.IsDir())
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("chmod: %w", err), meta)
+		}
+		if err := os.Chmod(absPath, newMode); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("chmod: %w", statError(absPath, err)), meta)
+		}
+
+		meta["previous_mode"] = fmt.Sprintf("%04o", toUnix(info.Mode()))
+		meta["mode"] = fmt.Sprintf("%04o", toUnix(newMode))
+		meta["permissions"] = newMode.String()
+		return common.MakeUDFSuccessResult(absPath, meta)
+	}))
+}
+
+// lookupID reads a user or group as a number, a name, or null or -1 to
+// leave it unchanged
+func lookupID(kind string, raw any, lookup func(string) (string, error)) (int, error) {
+	switch val := common.ExtractUDFValue(raw).(type) {
+	case nil:
+		return -1, nil
+	case int:
+		return val, nil
+	case float64:
+		if val != math.Trunc(val) {
+			return 0, common.Errorf(common.CodeInvalid, "%v must be an integer or a name, got %v", kind, val)
+		}
+		return int(val), nil
+	case string:
+		if n, err := strconv.Atoi(val); err == nil {
+			return n, nil
+		}
+		id, err := lookup(val)
+		if err != nil {
+			return 0, common.Errorf(common.CodeInvalid, "unknown %v %q", kind, val)
+		}
+		return strconv.Atoi(id)
+	default:
+		return 0, common.Errorf(common.CodeInvalid, "%v must be an integer or a name, got %T", kind, val)
+	}
+}
+
+// RegisterChown registers the chown function with gojq
+func RegisterChown() gojq.CompilerOption {
+	return common.WithFunction("chown", 3, 3, common.Audited("chown", func(v any, args []any) any {
+		absPath, err := pathArg(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("chown: %w", err), nil)
+		}
+		uid, err := lookupID("user", args[1], func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("chown: %w", err), nil)
+		}
+		gid, err := lookupID("group", args[2], func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("chown: %w", err), nil)
+		}
+
+		meta := map[string]any{
+			"operation": "chown",
+			"path":      absPath,
+			"uid":       uid,
+			"gid":       gid,
+		}
+		if err := os.Chown(absPath, uid, gid); err != nil {
+			if os.IsPermission(err) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodePermission, "chown: operation not permitted: %q", absPath), meta)
+			}
+			return common.MakeUDFErrorResult(fmt.Errorf("chown: %w", statError(absPath, err)), meta)
+		}
+		return common.MakeUDFSuccessResult(absPath, meta)
+	}))
+}
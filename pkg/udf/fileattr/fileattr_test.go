@@ -0,0 +1,181 @@
+package fileattr
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+func TestTouch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stamp")
+
+	res := runGojqQuery(t, `touch("`+path+`")`, nil, RegisterTouch()).(map[string]any)
+	if res["_val"] != path || res["_meta"].(map[string]any)["created"] != true {
+		t.Fatalf("touch new = %v", res)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Fatalf("touch did not create an empty file: %v", err)
+	}
+
+	res = runGojqQuery(t, `touch("`+path+`"; {time: "2020-01-02T03:04:05Z"})`, nil, RegisterTouch()).(map[string]any)
+	if res["_meta"].(map[string]any)["created"] != false {
+		t.Errorf("touch existing = %v", res)
+	}
+	info, _ := os.Stat(path)
+	if want := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC); !info.ModTime().Equal(want) {
+		t.Errorf("mtime = %v, want %v", info.ModTime(), want)
+	}
+
+	runGojqQuery(t, `touch("`+path+`"; {mtime: 1700000000})`, nil, RegisterTouch())
+	info, _ = os.Stat(path)
+	if info.ModTime().Unix() != 1700000000 {
+		t.Errorf("mtime = %v", info.ModTime())
+	}
+
+	missing := filepath.Join(dir, "missing")
+	res = runGojqQuery(t, `touch("`+missing+`"; {no_create: true})`, nil, RegisterTouch()).(map[string]any)
+	if _, err := os.Stat(missing); !os.IsNotExist(err) || res["_err"] != nil {
+		t.Errorf("no_create made the file: %v", res)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		mode  string
+		cur   os.FileMode
+		isDir bool
+		want  string
+	}{
+		{"755", 0644, false, "0755"},
+		{"0600", 0644, false, "0600"},
+		{"4755", 0644, false, "4755"},
+		{"u+x", 0644, false, "0744"},
+		{"go-w", 0666, false, "0644"},
+		{"a=r", 0755, false, "0444"},
+		{"u=rwx,go=rx", 0, false, "0755"},
+		{"+x", 0600, false, "0711"},
+		{"a+X", 0644, false, "0644"},
+		{"a+X", 0644, true, "0755"},
+		{"a+X", 0744, false, "0755"},
+		{"u+s", 0755, false, "4755"},
+		{"+t", 0777, true, "1777"},
+		{"u-w+x", 0644, false, "0544"},
+	}
+	for _, tt := range tests {
+		got, err := ParseMode(tt.mode, tt.cur, tt.isDir)
+		if err != nil {
+			t.Errorf("ParseMode(%q, %o) error: %v", tt.mode, tt.cur, err)
+			continue
+		}
+		if s := formatMode(got); s != tt.want {
+			t.Errorf("ParseMode(%q, %o) = %s, want %s", tt.mode, tt.cur, s, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "8", "u", "u*x", "u+q", "77777"} {
+		if _, err := ParseMode(bad, 0644, false); err == nil {
+			t.Errorf("ParseMode(%q) should fail", bad)
+		}
+	}
+}
+
+func formatMode(m os.FileMode) string {
+	b := toUnix(m)
+	return string([]byte{'0' + byte(b>>9&7), '0' + byte(b>>6&7), '0' + byte(b>>3&7), '0' + byte(b&7)})
+}
+
+func TestChmod(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.sh")
+	os.WriteFile(path, []byte("#!/bin/sh\n"), 0644)
+
+	res := runGojqQuery(t, `chmod("`+path+`"; 755)`, nil, RegisterChmod()).(map[string]any)
+	meta := res["_meta"].(map[string]any)
+	if meta["mode"] != "0755" || meta["previous_mode"] != "0644" || meta["permissions"] != "-rwxr-xr-x" {
+		t.Errorf("chmod 755 = %v", res)
+	}
+	runGojqQuery(t, `chmod("`+path+`"; "go-rx")`, nil, RegisterChmod())
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0700 {
+		t.Errorf("mode = %v, want 0700", info.Mode())
+	}
+}
+
+func TestChown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "owned")
+	os.WriteFile(path, nil, 0644)
+
+	uid, gid := os.Getuid(), os.Getgid()
+	q, _ := gojq.Parse(`chown($p; $u; $g)`)
+	code, _ := gojq.Compile(q, RegisterChown(), gojq.WithVariables([]string{"$p", "$u", "$g"}))
+	out, _ := code.Run(nil, path, uid, gid).Next()
+	meta := out.(map[string]any)["_meta"].(map[string]any)
+	if out.(map[string]any)["_err"] != nil || meta["uid"] != uid || meta["gid"] != gid {
+		t.Errorf("chown = %v", out)
+	}
+
+	if u, err := user.Current(); err == nil {
+		out := runGojqQuery(t, `chown("`+path+`"; "`+u.Username+`"; -1)`, nil, RegisterChown()).(map[string]any)
+		if out["_err"] != nil || out["_meta"].(map[string]any)["uid"] != uid {
+			t.Errorf("chown by name = %v", out)
+		}
+	}
+}
+
+func TestFileAttrErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`touch("` + missing + `"; {time: "yesterday"})`, "touch: options.time must be an RFC3339 time"},
+		{`touch("` + missing + `"; {size: 1})`, `touch: unknown option "size"`},
+		{`touch("` + filepath.Join(missing, "f") + `")`, "touch: cannot create file"},
+		{`chmod("` + missing + `"; "755")`, "chmod: file does not exist"},
+		{`chmod("` + dir + `"; "u+q")`, `chmod: invalid mode "u+q"`},
+		{`chmod("` + dir + `"; 789)`, `chmod: invalid octal mode "789"`},
+		{`chmod("` + dir + `"; true)`, "chmod: mode must be a string or number"},
+		{`chown("` + dir + `"; "no-such-user-xyz"; null)`, `chown: unknown user "no-such-user-xyz"`},
+		{`chown("` + missing + `"; null; null)`, "chown: file does not exist"},
+		{`chown(1; null; null)`, "chown: path must be a string"},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, nil, RegisterTouch(), RegisterChmod(), RegisterChown()).(map[string]any)
+		if got := common.GetUDFError(res); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, got, tt.want)
+		}
+	}
+}
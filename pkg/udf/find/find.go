@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/udf/common"
@@ -13,108 +16,182 @@ import (
 // FindOptions represents options for the find function
 type FindOptions struct {
 	Path     string
-	Type     string // "file", "dir", or "" for both
-	MaxDepth int    // -1 for unlimited
-	MinDepth int    // minimum depth (default 0)
+	Type     string         // "file", "dir", or "" for both
+	MaxDepth int            // -1 for unlimited
+	MinDepth int            // minimum depth (default 0)
+	MinSize  *int64         // minimum file size in bytes, nil for none
+	MaxSize  *int64         // maximum file size in bytes, nil for none
+	Newer    time.Time      // only paths modified after this, zero for none
+	Name     string         // glob matched against the base name
+	Regex    *regexp.Regexp // matched against the absolute path
+	Filters  map[string]any // the filters given, reported in _meta
 }
 
-// findFiles performs the actual file finding
-func findFiles(opts FindOptions) ([]any, error) {
-	var results []any
+// matchFilters reports whether a path passes the size, time, name and
+// regex filters. Size filters only match regular files
+func matchFilters(opts FindOptions, path string, info os.FileInfo) bool {
+	if opts.MinSize != nil || opts.MaxSize != nil {
+		if !info.Mode().IsRegular() {
+			return false
+		}
+		if opts.MinSize != nil && info.Size() < *opts.MinSize {
+			return false
+		}
+		if opts.MaxSize != nil && info.Size() > *opts.MaxSize {
+			return false
+		}
+	}
+	if !opts.Newer.IsZero() && !info.ModTime().After(opts.Newer) {
+		return false
+	}
+	if opts.Name != "" {
+		if ok, _ := filepath.Match(opts.Name, info.Name()); !ok {
+			return false
+		}
+	}
+	if opts.Regex != nil && !opts.Regex.MatchString(path) {
+		return false
+	}
+	return true
+}
+
+// findDir is a directory whose entries are still being walked
+type findDir struct {
+	path    string
+	depth   int
+	entries []os.DirEntry
+}
+
+// findIter walks a tree depth first in lexical order, like filepath.Walk,
+// reading one directory at a time so a result is yielded as soon as it is
+// found and memory stays bounded by the depth of the tree
+type findIter struct {
+	opts  FindOptions
+	root  string
+	stack []*findDir
+	err   error
+	done  bool
+}
 
+// newFindIter checks the starting path and returns an iterator over the
+// paths below it
+func newFindIter(opts FindOptions) (*findIter, error) {
 	// Convert starting path to absolute
 	startPath, err := filepath.Abs(opts.Path)
 	if err != nil {
-		return nil, fmt.Errorf("find: cannot resolve path %q: %v", opts.Path, err)
+		return nil, fmt.Errorf("cannot resolve path %q: %w", opts.Path, err)
+	}
+	if err := common.CheckRead(startPath); err != nil {
+		return nil, err
 	}
 
 	// Check if path exists
-	_, err = os.Stat(startPath)
-	if err != nil {
-		return nil, fmt.Errorf("find: path %q does not exist: %v", startPath, err)
+	if _, err := os.Stat(startPath); err != nil {
+		return nil, fmt.Errorf("path %q does not exist: %w", startPath, err)
 	}
+	return &findIter{opts: opts, root: filepath.Clean(startPath)}, nil
+}
 
-	err = filepath.Walk(startPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			// Skip permission errors and continue
-			if os.IsPermission(err) {
-				return nil
-			}
-			return err
-		}
-
-		// Calculate depth relative to the starting path
-		relPath, err := filepath.Rel(startPath, path)
-		if err != nil {
+// push queues the entries of a directory to be walked. Directories that
+// cannot be read are skipped, like permission errors in filepath.Walk
+func (it *findIter) push(path string, depth int) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if os.IsPermission(err) || os.IsNotExist(err) {
 			return nil
 		}
+		return err
+	}
+	it.stack = append(it.stack, &findDir{path: path, depth: depth, entries: entries})
+	return nil
+}
 
-		// Skip the root path itself if it's a file and we're looking for files
-		if relPath == "." {
-			if opts.Type == "file" && info.IsDir() {
-				return nil
-			}
-			if opts.Type == "dir" && !info.IsDir() {
-				return nil
-			}
+// visit walks into path if it is a directory within the depth limit, and
+// returns its result if it passes the filters
+func (it *findIter) visit(path string, info os.FileInfo, depth int) (any, bool) {
+	if info.IsDir() && (it.opts.MaxDepth < 0 || depth < it.opts.MaxDepth) {
+		if err := it.push(path, depth); err != nil {
+			it.err = err
 		}
+	}
 
-		depth := 0
-		if relPath != "." {
-			depth = len(strings.Split(relPath, string(filepath.Separator)))
-		}
+	if depth < it.opts.MinDepth {
+		return nil, false
+	}
+	if it.opts.Type == "file" && info.IsDir() {
+		return nil, false
+	}
+	if it.opts.Type == "dir" && !info.IsDir() {
+		return nil, false
+	}
+	if !matchFilters(it.opts, path, info) {
+		return nil, false
+	}
 
-		// Check min depth
-		if depth < opts.MinDepth {
-			if info.IsDir() {
-				return nil
-			}
-			return nil
+	// Determine type for metadata
+	pathType := "file"
+	if info.IsDir() {
+		pathType = "dir"
+	}
+
+	// Return object with _val and _meta keys
+	meta := map[string]any{
+		"type": pathType,
+	}
+	if len(it.opts.Filters) > 0 {
+		meta["filters"] = it.opts.Filters
+	}
+	return map[string]any{
+		"_schema": common.UDFSchemaVersion,
+		"_val":    path,
+		"_meta":   meta,
+	}, true
+}
+
+func (it *findIter) Next() (any, bool) {
+	for !it.done {
+		if it.err != nil {
+			err := it.err
+			it.done = true
+			it.stack = nil
+			return fmt.Errorf("find: %w", err), true
 		}
 
-		// Check max depth
-		if opts.MaxDepth >= 0 && depth > opts.MaxDepth {
-			if info.IsDir() {
-				return filepath.SkipDir
+		if it.stack == nil {
+			// The starting path itself, at depth 0
+			it.stack = []*findDir{}
+			info, err := os.Lstat(it.root)
+			if err != nil {
+				it.err = err
+				continue
 			}
-			return nil
+			if result, ok := it.visit(it.root, info, 0); ok {
+				return result, true
+			}
+			continue
 		}
 
-		// Check type filter
-		if opts.Type == "file" && info.IsDir() {
-			return nil
+		if len(it.stack) == 0 {
+			it.done = true
+			break
 		}
-		if opts.Type == "dir" && !info.IsDir() {
-			return nil
+		dir := it.stack[len(it.stack)-1]
+		if len(dir.entries) == 0 {
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+		entry := dir.entries[0]
+		dir.entries = dir.entries[1:]
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since the directory was read
+			continue
+		}
+		if result, ok := it.visit(filepath.Join(dir.path, entry.Name()), info, dir.depth+1); ok {
+			return result, true
 		}
-		
-		// Path from Walk is already absolute (since startPath is absolute)
-		// But ensure it's normalized
-		absPath := filepath.Clean(path)
-		
-		// Determine type for metadata
-		pathType := "file"
-		if info.IsDir() {
-			pathType = "dir"
-		}
-		
-		// Return object with _val and _meta keys
-		result := map[string]any{
-			"_val": absPath,
-			"_meta": map[string]any{
-				"type": pathType,
-			},
-		}
-		
-		results = append(results, result)
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
 	}
-
-	return results, nil
+	return nil, false
 }
 
 // parseFindArgs parses arguments to the find function
@@ -126,29 +203,29 @@ func parseFindArgs(args []any) (FindOptions, error) {
 	}
 
 	if len(args) == 0 {
-		return opts, fmt.Errorf("find: expected at least 1 argument (path)")
+		return opts, common.Errorf(common.CodeInvalid, "find: expected at least 1 argument (path)")
 	}
-	
+
 	// Extract _val from UDF result objects (standard behavior for all UDFs)
 	pathArg := common.ExtractUDFValue(args[0])
-	
+
 	// First argument is always the path
 	path, ok := pathArg.(string)
 	if !ok {
-		return opts, fmt.Errorf("find: first argument must be a string (path)")
+		return opts, common.Errorf(common.CodeInvalid, "find: first argument must be a string (path)")
 	}
 
 	// Expand ~ to home directory
 	if path == "~" {
 		home, err := os.UserHomeDir()
 		if err != nil {
-			return opts, fmt.Errorf("find: cannot determine home directory: %v", err)
+			return opts, fmt.Errorf("find: cannot determine home directory: %w", err)
 		}
 		path = home
 	} else if strings.HasPrefix(path, "~/") {
 		home, err := os.UserHomeDir()
 		if err != nil {
-			return opts, fmt.Errorf("find: cannot determine home directory: %v", err)
+			return opts, fmt.Errorf("find: cannot determine home directory: %w", err)
 		}
 		path = filepath.Join(home, path[2:])
 	}
@@ -159,7 +236,7 @@ func parseFindArgs(args []any) (FindOptions, error) {
 	for i := 1; i < len(args); i++ {
 		// Extract _val from UDF result objects (standard behavior for all UDFs)
 		arg := common.ExtractUDFValue(args[i])
-		
+
 		switch v := arg.(type) {
 		case string:
 			// String argument could be type specification
@@ -168,7 +245,7 @@ func parseFindArgs(args []any) (FindOptions, error) {
 			} else if v == "dir" || v == "dirs" || v == "directory" || v == "directories" {
 				opts.Type = "dir"
 			} else {
-				return opts, fmt.Errorf("find: unknown string option %q (expected 'file' or 'dir')", v)
+				return opts, common.Errorf(common.CodeInvalid, "find: unknown string option %q (expected 'file' or 'dir')", v)
 			}
 		case float64:
 			// Numeric argument is maxdepth
@@ -177,66 +254,173 @@ func parseFindArgs(args []any) (FindOptions, error) {
 			opts.MaxDepth = v
 		case map[string]any:
 			// Object with options
-			if t, ok := v["type"].(string); ok {
-				if t == "file" || t == "files" {
-					opts.Type = "file"
-				} else if t == "dir" || t == "dirs" || t == "directory" || t == "directories" {
-					opts.Type = "dir"
-				}
-			}
-			if md, ok := v["maxdepth"].(float64); ok {
-				opts.MaxDepth = int(md)
-			} else if md, ok := v["maxdepth"].(int); ok {
-				opts.MaxDepth = md
-			}
-			if md, ok := v["mindepth"].(float64); ok {
-				opts.MinDepth = int(md)
-			} else if md, ok := v["mindepth"].(int); ok {
-				opts.MinDepth = md
+			if err := parseFindObject(&opts, v); err != nil {
+				return opts, fmt.Errorf("find: %w", err)
 			}
 		default:
-			return opts, fmt.Errorf("find: unsupported argument type %T", arg)
+			return opts, common.Errorf(common.CodeInvalid, "find: unsupported argument type %T", arg)
 		}
 	}
 
 	return opts, nil
 }
 
-// RegisterFind registers the find function with gojq
-func RegisterFind() gojq.CompilerOption {
-	return gojq.WithIterFunction("find", 1, 4, func(v any, args []any) gojq.Iter {
-		opts, err := parseFindArgs(args)
-		if err != nil {
-			return gojq.NewIter(err)
+// parseFindObject applies an options object to opts
+func parseFindObject(opts *FindOptions, m map[string]any) error {
+	filters := map[string]any{}
+	// type, maxdepth and mindepth keep their original leniency: values of
+	// the wrong kind are ignored, as are keys find does not know
+	if t, ok := m["type"].(string); ok {
+		if t == "file" || t == "files" {
+			opts.Type = "file"
+			filters["type"] = opts.Type
+		} else if t == "dir" || t == "dirs" || t == "directory" || t == "directories" {
+			opts.Type = "dir"
+			filters["type"] = opts.Type
 		}
-
-		results, err := findFiles(opts)
-		if err != nil {
-			return gojq.NewIter(fmt.Errorf("find: %v", err))
+	}
+	for _, key := range []string{"maxdepth", "mindepth"} {
+		var n int
+		if md, ok := m[key].(float64); ok {
+			n = int(md)
+		} else if md, ok := m[key].(int); ok {
+			n = md
+		} else {
+			continue
 		}
-
-		// Convert []any to variadic arguments for NewIter
-		if len(results) == 0 {
-			return gojq.NewIter[string]()
+		if key == "maxdepth" {
+			opts.MaxDepth = n
+		} else {
+			opts.MinDepth = n
+		}
+		filters[key] = n
+	}
+	for key, raw := range m {
+		raw = common.ExtractUDFValue(raw)
+		switch key {
+		case "min_size", "max_size":
+			n, err := ParseSize(raw)
+			if err != nil {
+				return fmt.Errorf("options.%v: %w", key, err)
+			}
+			if key == "min_size" {
+				opts.MinSize = &n
+			} else {
+				opts.MaxSize = &n
+			}
+			filters[key] = n
+		case "newer":
+			t, err := parseNewer(raw)
+			if err != nil {
+				return fmt.Errorf("options.newer: %w", err)
+			}
+			opts.Newer = t
+			filters["newer"] = t.UTC().Format(time.RFC3339)
+		case "name":
+			name, ok := raw.(string)
+			if !ok || name == "" {
+				return common.Errorf(common.CodeInvalid, "options.name must be a non-empty string, got %v", raw)
+			}
+			if _, err := filepath.Match(name, ""); err != nil {
+				return common.Errorf(common.CodeInvalid, "options.name: invalid pattern %q", name)
+			}
+			opts.Name = name
+			filters["name"] = name
+		case "regex":
+			expr, ok := raw.(string)
+			if !ok {
+				return common.Errorf(common.CodeInvalid, "options.regex must be a string, got %T", raw)
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("options.regex: %w", err)
+			}
+			opts.Regex = re
+			filters["regex"] = expr
 		}
+	}
+	if len(filters) > 0 {
+		opts.Filters = filters
+	}
+	return nil
+}
 
-		// Create a slice iterator manually since NewIter needs type parameter
-		iter := &stringSliceIter{values: results, index: 0}
-		return iter
-	})
+// sizeUnits are the suffixes ParseSize accepts, in powers of 1024
+var sizeUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
 }
 
-// stringSliceIter is an iterator over a slice of strings
-type stringSliceIter struct {
-	values []any
-	index  int
+// ParseSize reads a size as a number of bytes or a string like "10k",
+// "1.5M" or "2G"
+func ParseSize(raw any) (int64, error) {
+	switch v := raw.(type) {
+	case int:
+		if v >= 0 {
+			return int64(v), nil
+		}
+	case float64:
+		if v >= 0 && v == float64(int64(v)) {
+			return int64(v), nil
+		}
+	case string:
+		s := strings.ToLower(strings.TrimSpace(v))
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "ib"), "b")
+		i := len(s)
+		for i > 0 && (s[i-1] < '0' || s[i-1] > '9') {
+			i--
+		}
+		unit, ok := sizeUnits[s[i:]]
+		n, err := strconv.ParseFloat(s[:i], 64)
+		if !ok || err != nil || n < 0 {
+			return 0, common.Errorf(common.CodeInvalid, "invalid size %q", v)
+		}
+		return int64(n * float64(unit)), nil
+	default:
+		return 0, common.Errorf(common.CodeInvalid, "size must be a number of bytes or a string like \"10k\", got %T", raw)
+	}
+	return 0, common.Errorf(common.CodeInvalid, "size must be a non-negative integer, got %v", raw)
 }
 
-func (iter *stringSliceIter) Next() (any, bool) {
-	if iter.index >= len(iter.values) {
-		return nil, false
+// parseNewer reads a modified-since time as an RFC3339 string, a duration
+// before now like "24h", or Unix seconds
+func parseNewer(raw any) (time.Time, error) {
+	switch v := raw.(type) {
+	case int:
+		return time.Unix(int64(v), 0), nil
+	case float64:
+		return time.Unix(int64(v), 0), nil
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return time.Now().Add(-d), nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, common.Errorf(common.CodeInvalid, "must be an RFC3339 time or a duration like \"24h\", got %q", v)
+		}
+		return t, nil
+	default:
+		return time.Time{}, common.Errorf(common.CodeInvalid, "must be a time string or Unix seconds, got %T", raw)
 	}
-	value := iter.values[iter.index]
-	iter.index++
-	return value, true
+}
+
+// RegisterFind registers the find function with gojq. Each path is a
+// separate output, yielded as the walk reaches it
+func RegisterFind() gojq.CompilerOption {
+	return common.WithIterFunction("find", 1, 4, common.AuditedIter("find", func(v any, args []any) gojq.Iter {
+		opts, err := parseFindArgs(args)
+		if err != nil {
+			return gojq.NewIter(err)
+		}
+
+		it, err := newFindIter(opts)
+		if err != nil {
+			return gojq.NewIter(fmt.Errorf("find: %w", err))
+		}
+		return it
+	}))
 }
@@ -75,15 +75,15 @@ func TestFindWithUDFResultInput(t *testing.T) {
 				MinDepth: 0,
 			}
 
-			results, err := findFiles(opts)
+			results, err := collectFind(opts)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("findFiles() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("collectFind() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
 			if !tt.wantErr {
 				if len(results) == 0 {
-					t.Error("findFiles() returned no results")
+					t.Error("collectFind() returned no results")
 				}
 				
 				// Verify results have correct structure
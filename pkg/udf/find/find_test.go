@@ -1,11 +1,38 @@
 package find
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
 )
 
+// collectFind runs the iterator RegisterFind returns and gathers its
+// results, stopping at the first error
+func collectFind(opts FindOptions) ([]any, error) {
+	it, err := newFindIter(opts)
+	if err != nil {
+		return nil, fmt.Errorf("find: %v", err)
+	}
+	var results []any
+	for {
+		v, ok := it.Next()
+		if !ok {
+			return results, nil
+		}
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		results = append(results, v)
+	}
+}
+
 func TestFindFiles(t *testing.T) {
 	// Create a temporary directory structure for testing
 	tmpDir, err := os.MkdirTemp("", "pwrq-find-test-*")
@@ -142,9 +169,9 @@ func TestFindFiles(t *testing.T) {
 				return
 			}
 
-			results, err := findFiles(opts)
+			results, err := collectFind(opts)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("findFiles() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("collectFind() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err != nil {
@@ -152,7 +179,7 @@ func TestFindFiles(t *testing.T) {
 			}
 
 			if !tt.check(results) {
-				t.Errorf("findFiles() results did not pass check: %v", results)
+				t.Errorf("collectFind() results did not pass check: %v", results)
 			}
 		})
 	}
@@ -244,3 +271,171 @@ func TestParseFindArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestFindFilters(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]int{
+		"small.txt":         10,
+		"big.log":           4096,
+		"sub/medium.txt":    1500,
+		"sub/deep/huge.bin": 10000,
+	}
+	for name, size := range files {
+		p := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(tmpDir, "big.log"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options map[string]any
+		want    []string
+	}{
+		{"min_size", map[string]any{"min_size": "1k"}, []string{"big.log", "sub/deep/huge.bin", "sub/medium.txt"}},
+		{"size range", map[string]any{"min_size": 1000, "max_size": "4k"}, []string{"big.log", "sub/medium.txt"}},
+		{"newer", map[string]any{"newer": "24h", "type": "file"}, []string{"small.txt", "sub/deep/huge.bin", "sub/medium.txt"}},
+		{"name", map[string]any{"name": "*.txt"}, []string{"small.txt", "sub/medium.txt"}},
+		{"regex", map[string]any{"regex": `/sub/.*\.(bin|txt)$`}, []string{"sub/deep/huge.bin", "sub/medium.txt"}},
+		{"maxdepth with name", map[string]any{"name": "*.txt", "maxdepth": 1}, []string{"small.txt"}},
+		{"dirs", map[string]any{"type": "dir", "mindepth": 1}, []string{"sub", "sub/deep"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseFindArgs([]any{tmpDir, tt.options})
+			if err != nil {
+				t.Fatalf("parseFindArgs() error = %v", err)
+			}
+			results, err := collectFind(opts)
+			if err != nil {
+				t.Fatalf("collectFind() error = %v", err)
+			}
+			var got []string
+			for _, r := range results {
+				m := r.(map[string]any)
+				rel, _ := filepath.Rel(tmpDir, m["_val"].(string))
+				got = append(got, filepath.ToSlash(rel))
+				filters, ok := m["_meta"].(map[string]any)["filters"].(map[string]any)
+				if !ok || len(filters) != len(tt.options) {
+					t.Errorf("_meta.filters = %v, want one entry per option", filters)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("find = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindFilterErrors(t *testing.T) {
+	tests := []struct {
+		options map[string]any
+		want    string
+	}{
+		{map[string]any{"min_size": "ten"}, `find: options.min_size: invalid size "ten"`},
+		{map[string]any{"max_size": -1}, "find: options.max_size: size must be a non-negative integer"},
+		{map[string]any{"newer": "yesterday"}, "find: options.newer: must be an RFC3339 time"},
+		{map[string]any{"regex": "("}, "find: options.regex:"},
+		{map[string]any{"name": "[a"}, `find: options.name: invalid pattern "[a"`},
+	}
+	for _, tt := range tests {
+		_, err := parseFindArgs([]any{"/tmp", tt.options})
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("parseFindArgs(%v) error = %v, want prefix %q", tt.options, err, tt.want)
+		}
+	}
+}
+
+func TestFindObjectLenient(t *testing.T) {
+	// Unknown keys and misspelled types are ignored, as they always were
+	opts, err := parseFindArgs([]any{"/tmp", map[string]any{"type": "socket", "depth": 1, "maxdepth": 2}})
+	if err != nil {
+		t.Fatalf("parseFindArgs() error = %v", err)
+	}
+	if opts.Type != "" || opts.MaxDepth != 2 {
+		t.Errorf("parseFindArgs() = %+v", opts)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[any]int64{
+		float64(512): 512,
+		"100":        100,
+		"10k":        10 << 10,
+		"1.5M":       3 << 19,
+		"2GiB":       2 << 30,
+		"3kb":        3 << 10,
+	}
+	for in, want := range tests {
+		got, err := ParseSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%v) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+}
+
+func TestFindStreams(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"b/2.txt", "b/1.txt", "a/x/3.txt", "c.txt"} {
+		p := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Results come in the same order as filepath.Walk
+	var want []any
+	filepath.Walk(tmpDir, func(p string, _ os.FileInfo, _ error) error {
+		want = append(want, p)
+		return nil
+	})
+	it, err := newFindIter(FindOptions{Path: tmpDir, MaxDepth: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []any
+	for {
+		v, ok := it.Next()
+		if !ok {
+			break
+		}
+		got = append(got, v.(map[string]any)["_val"])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("find order = %v, want %v", got, want)
+	}
+
+	// Stopping early leaves the rest of the tree unread
+	it, _ = newFindIter(FindOptions{Path: tmpDir, MaxDepth: -1, Type: "file"})
+	first, ok := it.Next()
+	if !ok || first.(map[string]any)["_val"] != filepath.Join(tmpDir, "a/x/3.txt") {
+		t.Fatalf("first result = %v", first)
+	}
+	if len(it.stack) != 3 || len(it.stack[0].entries) != 2 {
+		t.Errorf("after one result the walk is not paused inside a/x")
+	}
+
+	query, err := gojq.Parse(`[limit(2; find($dir; "file")) | ._val]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query, gojq.WithVariables([]string{"$dir"}), RegisterFind())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := code.Run(nil, tmpDir).Next()
+	if want := []any{filepath.Join(tmpDir, "a/x/3.txt"), filepath.Join(tmpDir, "b/1.txt")}; !reflect.DeepEqual(v, want) {
+		t.Errorf("limit(2; find) = %v, want %v", v, want)
+	}
+}
@@ -0,0 +1,292 @@
+package glob
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Options are the optional settings accepted by glob
+type Options struct {
+	Type   string // "file", "dir", or "" for both
+	Hidden bool   // let wildcards match names starting with a dot
+}
+
+func parseOptions(v any) (Options, error) {
+	var opts Options
+	m, ok := common.ExtractUDFValue(v).(map[string]any)
+	if !ok {
+		return opts, common.Errorf(common.CodeInvalid, "options must be an object, got %T", common.ExtractUDFValue(v))
+	}
+	for key, raw := range m {
+		switch key {
+		case "type":
+			s, ok := raw.(string)
+			if !ok || (s != "file" && s != "dir") {
+				return opts, common.Errorf(common.CodeInvalid, `options.type must be "file" or "dir", got %v`, raw)
+			}
+			opts.Type = s
+		case "hidden":
+			if opts.Hidden, ok = raw.(bool); !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.hidden must be a boolean, got %T", raw)
+			}
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// ExpandBraces expands {a,b} alternatives, which may nest, into every
+// pattern they stand for. A backslash escapes a brace or comma
+func ExpandBraces(pattern string) ([]string, error) {
+	open := -1
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				open = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				return nil, common.Errorf(common.CodeInvalid, "unmatched } in %q", pattern)
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			// Split the outermost group on its top-level commas
+			var alts []string
+			start, inner := open+1, 0
+			for j := open + 1; j < i; j++ {
+				switch pattern[j] {
+				case '\\':
+					j++
+				case '{':
+					inner++
+				case '}':
+					inner--
+				case ',':
+					if inner == 0 {
+						alts = append(alts, pattern[start:j])
+						start = j + 1
+					}
+				}
+			}
+			alts = append(alts, pattern[start:i])
+			var out []string
+			for _, alt := range alts {
+				expanded, err := ExpandBraces(pattern[:open] + alt + pattern[i+1:])
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, expanded...)
+			}
+			return out, nil
+		}
+	}
+	if depth > 0 {
+		return nil, common.Errorf(common.CodeInvalid, "unmatched { in %q", pattern)
+	}
+	return []string{pattern}, nil
+}
+
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+// matcher matches paths, split into names, against a pattern split into
+// segments, where a ** segment matches any number of names
+type matcher struct {
+	hidden bool
+}
+
+func (m matcher) matchName(seg, name string) bool {
+	if !m.hidden && strings.HasPrefix(name, ".") && !strings.HasPrefix(seg, ".") {
+		return false
+	}
+	ok, _ := path.Match(seg, name)
+	return ok
+}
+
+// match reports whether names matches segs exactly
+func (m matcher) match(segs, names []string) bool {
+	if len(segs) == 0 {
+		return len(names) == 0
+	}
+	if segs[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if i > 0 && !m.hidden && strings.HasPrefix(names[i-1], ".") {
+				return false
+			}
+			if m.match(segs[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	return len(names) > 0 && m.matchName(segs[0], names[0]) && m.match(segs[1:], names[1:])
+}
+
+// prefix reports whether names could be the start of a match, so the
+// directory it names is worth walking into
+func (m matcher) prefix(segs, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	if segs[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if i > 0 && !m.hidden && strings.HasPrefix(names[i-1], ".") {
+				return false
+			}
+			if m.prefix(segs[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	return m.matchName(segs[0], names[0]) && m.prefix(segs[1:], names[1:])
+}
+
+// Match is a path matched by a pattern
+type Match struct {
+	Path string
+	Dir  bool
+}
+
+// Glob returns the paths matching pattern, in lexical order
+func Glob(pattern string, opts Options) ([]Match, error) {
+	// Split off the literal directory the pattern starts from
+	segs := strings.Split(filepath.ToSlash(pattern), "/")
+	root := ""
+	i := 0
+	for ; i < len(segs)-1 && !hasMeta(segs[i]); i++ {
+		root = path.Join(root, segs[i])
+		if segs[i] == "" {
+			root = "/"
+		}
+	}
+	segs = segs[i:]
+	for _, seg := range segs {
+		if seg != "**" && strings.Contains(seg, "**") {
+			return nil, common.Errorf(common.CodeInvalid, "** must be a whole path segment in %q", pattern)
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, common.Errorf(common.CodeInvalid, "invalid pattern %q", pattern)
+		}
+	}
+
+	walkRoot := root
+	if walkRoot == "" {
+		walkRoot = "."
+	} else if walkRoot == "~" || strings.HasPrefix(walkRoot, "~/") {
+		var err error
+		if walkRoot, err = common.ResolvePath(walkRoot); err != nil {
+			return nil, err
+		}
+		root = walkRoot
+	}
+	if err := common.CheckRead(walkRoot); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(walkRoot); err != nil {
+		return nil, nil
+	}
+
+	m := matcher{hidden: opts.Hidden}
+	var matches []Match
+	err := filepath.WalkDir(walkRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip what cannot be read, like a shell glob
+			return nil
+		}
+		rel, _ := filepath.Rel(walkRoot, p)
+		var names []string
+		if rel != "." {
+			names = strings.Split(filepath.ToSlash(rel), "/")
+		}
+		if d.IsDir() && !m.prefix(segs, names) {
+			return filepath.SkipDir
+		}
+		if len(names) == 0 || !m.match(segs, names) {
+			return nil
+		}
+		isDir := d.IsDir()
+		if d.Type()&fs.ModeSymlink != 0 {
+			if info, err := os.Stat(p); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if (opts.Type == "file" && isDir) || (opts.Type == "dir" && !isDir) {
+			return nil
+		}
+		matches = append(matches, Match{Path: filepath.Join(root, rel), Dir: isDir})
+		return nil
+	})
+	return matches, err
+}
+
+// RegisterGlob registers the glob function with gojq
+func RegisterGlob() gojq.CompilerOption {
+	return common.WithIterFunction("glob", 0, 2, common.AuditedIter("glob", func(v any, args []any) gojq.Iter {
+		// glob with the pattern from the pipeline, glob(pattern), or
+		// glob(pattern; options). Each match is a separate output
+		patVal := v
+		if len(args) > 0 {
+			patVal = args[0]
+		}
+		pattern, ok := common.ExtractUDFValue(patVal).(string)
+		if !ok || pattern == "" {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "glob: pattern must be a non-empty string, got %T", common.ExtractUDFValue(patVal)), nil))
+		}
+		var opts Options
+		if len(args) > 1 {
+			var err error
+			if opts, err = parseOptions(args[1]); err != nil {
+				return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("glob: %w", err), nil))
+			}
+		}
+
+		patterns, err := ExpandBraces(pattern)
+		if err != nil {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("glob: %w", err), nil))
+		}
+		var results []any
+		seen := map[string]bool{}
+		for _, p := range patterns {
+			matches, err := Glob(p, opts)
+			if err != nil {
+				return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("glob: %w", err), nil))
+			}
+			for _, match := range matches {
+				if seen[match.Path] {
+					continue
+				}
+				seen[match.Path] = true
+				pathType := "file"
+				if match.Dir {
+					pathType = "dir"
+				}
+				results = append(results, common.MakeUDFSuccessResult(match.Path, map[string]any{
+					"operation": "glob",
+					"pattern":   pattern,
+					"type":      pathType,
+				}))
+			}
+		}
+		return gojq.NewIter(results...)
+	}))
+}
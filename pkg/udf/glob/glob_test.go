@@ -0,0 +1,149 @@
+package glob
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query, collecting every output
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) []any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var results []any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"a", []string{"a"}},
+		{"*.{go,md}", []string{"*.go", "*.md"}},
+		{"{a,b}{1,2}", []string{"a1", "a2", "b1", "b2"}},
+		{"x{a,{b,c}d}", []string{"xa", "xbd", "xcd"}},
+		{"{,pre}fix", []string{"fix", "prefix"}},
+		{`a\{b,c\}`, []string{`a\{b,c\}`}},
+	}
+	for _, tt := range tests {
+		got, err := ExpandBraces(tt.pattern)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExpandBraces(%q) = %v, %v; want %v", tt.pattern, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"{a,b", "a}b"} {
+		if _, err := ExpandBraces(bad); err == nil {
+			t.Errorf("ExpandBraces(%q) should fail", bad)
+		}
+	}
+}
+
+func makeTree(t *testing.T) string {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"main.go", "README.md", ".env",
+		"cmd/app/main.go", "cmd/app/app_test.go",
+		"pkg/a/a.go", "pkg/a/b/b.go", "pkg/a/b/notes.txt",
+		".git/config", ".git/hooks/pre-commit.go",
+	} {
+		p := filepath.Join(dir, f)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, nil, 0644)
+	}
+	return dir
+}
+
+func TestGlob(t *testing.T) {
+	dir := makeTree(t)
+	t.Chdir(dir)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`glob("*.go")`, []string{"main.go"}},
+		{`glob("**/*.go")`, []string{"cmd/app/app_test.go", "cmd/app/main.go", "main.go", "pkg/a/a.go", "pkg/a/b/b.go"}},
+		{`glob("pkg/**/*.go")`, []string{"pkg/a/a.go", "pkg/a/b/b.go"}},
+		{`glob("pkg/**")`, []string{"pkg/a", "pkg/a/a.go", "pkg/a/b", "pkg/a/b/b.go", "pkg/a/b/notes.txt"}},
+		{`glob("*/app/*_test.go")`, []string{"cmd/app/app_test.go"}},
+		{`glob("**/*.{md,txt}")`, []string{"README.md", "pkg/a/b/notes.txt"}},
+		{`glob("{cmd,pkg}/*"; {type: "dir"})`, []string{"cmd/app", "pkg/a"}},
+		{`glob("pkg/a/?.go")`, []string{"pkg/a/a.go"}},
+		{`glob("[a-m]*")`, []string{"cmd", "main.go"}},
+		{`glob("*"; {type: "file"})`, []string{"README.md", "main.go"}},
+		{`glob(".*")`, []string{".env", ".git"}},
+		{`glob("**/*.go"; {hidden: true})`, []string{".git/hooks/pre-commit.go", "cmd/app/app_test.go", "cmd/app/main.go", "main.go", "pkg/a/a.go", "pkg/a/b/b.go"}},
+		{`"cmd/*" | glob`, []string{"cmd/app"}},
+		{`glob("nothing/*")`, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range runGojqQuery(t, tt.query, nil, RegisterGlob()) {
+			m := r.(map[string]any)
+			if m["_err"] != nil {
+				t.Fatalf("%s: %v", tt.query, m["_err"])
+			}
+			got = append(got, filepath.ToSlash(m["_val"].(string)))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Absolute patterns give absolute paths
+	res := runGojqQuery(t, `glob("`+filepath.ToSlash(dir)+`/cmd/*/main.go")`, nil, RegisterGlob())
+	if len(res) != 1 || res[0].(map[string]any)["_val"] != filepath.Join(dir, "cmd", "app", "main.go") {
+		t.Errorf("absolute glob = %v", res)
+	}
+	if meta := res[0].(map[string]any)["_meta"].(map[string]any); meta["type"] != "file" || meta["operation"] != "glob" {
+		t.Errorf("meta = %v", meta)
+	}
+}
+
+func TestGlobErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`glob("[")`, `glob: invalid pattern "["`},
+		{`glob("a**/b")`, "glob: ** must be a whole path segment"},
+		{`glob("{a")`, "glob: unmatched {"},
+		{`glob(1)`, "glob: pattern must be a non-empty string"},
+		{`glob("*"; {type: "link"})`, `glob: options.type must be "file" or "dir"`},
+		{`glob("*"; {follow: true})`, `glob: unknown option "follow"`},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, nil, RegisterGlob())
+		if len(res) != 1 {
+			t.Fatalf("%s: %d outputs", tt.query, len(res))
+		}
+		if got := common.GetUDFError(res[0]); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, got, tt.want)
+		}
+	}
+}
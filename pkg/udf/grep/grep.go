@@ -0,0 +1,370 @@
+package grep
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	"github.com/xen0bit/pwrq/pkg/udf/regex"
+)
+
+// binarySniffLen is how much of a file is checked for NUL bytes
+const binarySniffLen = 8000
+
+// Options are the settings accepted by grep
+type Options struct {
+	Recursive bool
+	Flags     string // regex flags, see regex.Compile
+	Fixed     bool   // pattern is a literal string
+	Invert    bool   // select lines that do not match
+	Before    int    // context lines before each match
+	After     int    // context lines after each match
+	MaxCount  int    // matches per file, 0 for unlimited
+	Binary    bool   // search binary files instead of skipping them
+	Include   []string
+	Exclude   []string
+}
+
+func intOption(key string, raw any) (int, error) {
+	var n int
+	switch val := raw.(type) {
+	case int:
+		n = val
+	case float64:
+		if val != math.Trunc(val) {
+			return 0, common.Errorf(common.CodeInvalid, "options.%v must be an integer, got %v", key, val)
+		}
+		n = int(val)
+	default:
+		return 0, common.Errorf(common.CodeInvalid, "options.%v must be a number, got %T", key, raw)
+	}
+	if n < 0 {
+		return 0, common.Errorf(common.CodeInvalid, "options.%v must not be negative, got %d", key, n)
+	}
+	return n, nil
+}
+
+func globsOption(key string, raw any) ([]string, error) {
+	switch val := raw.(type) {
+	case string:
+		return []string{val}, nil
+	case []any:
+		var globs []string
+		for _, g := range val {
+			s, ok := g.(string)
+			if !ok {
+				return nil, common.Errorf(common.CodeInvalid, "options.%v must be a string or an array of strings, got element %T", key, g)
+			}
+			globs = append(globs, s)
+		}
+		return globs, nil
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "options.%v must be a string or an array of strings, got %T", key, raw)
+	}
+}
+
+func parseOptions(m map[string]any) (Options, error) {
+	var opts Options
+	for key, raw := range m {
+		var err error
+		switch key {
+		case "recursive", "fixed", "invert", "binary":
+			b, ok := raw.(bool)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.%v must be a boolean, got %T", key, raw)
+			}
+			switch key {
+			case "recursive":
+				opts.Recursive = b
+			case "fixed":
+				opts.Fixed = b
+			case "invert":
+				opts.Invert = b
+			case "binary":
+				opts.Binary = b
+			}
+		case "ignore_case":
+			b, ok := raw.(bool)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.%v must be a boolean, got %T", key, raw)
+			}
+			if b {
+				opts.Flags += "i"
+			}
+		case "flags":
+			s, ok := raw.(string)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.flags must be a string, got %T", raw)
+			}
+			opts.Flags += s
+		case "context":
+			var n int
+			if n, err = intOption(key, raw); err == nil {
+				opts.Before, opts.After = n, n
+			}
+		case "before":
+			opts.Before, err = intOption(key, raw)
+		case "after":
+			opts.After, err = intOption(key, raw)
+		case "max_count":
+			opts.MaxCount, err = intOption(key, raw)
+		case "include":
+			opts.Include, err = globsOption(key, raw)
+		case "exclude":
+			opts.Exclude, err = globsOption(key, raw)
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "unknown option %q", key)
+		}
+		if err != nil {
+			return opts, err
+		}
+	}
+	for _, g := range append(opts.Include, opts.Exclude...) {
+		if _, err := filepath.Match(g, ""); err != nil {
+			return opts, common.Errorf(common.CodeInvalid, "invalid glob %q: %w", g, err)
+		}
+	}
+	return opts, nil
+}
+
+// matchesGlobs reports whether the base name of path matches any glob
+func matchesGlobs(globs []string, path string) bool {
+	base := filepath.Base(path)
+	for _, g := range globs {
+		if ok, _ := filepath.Match(g, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// listFiles returns the files to search under root. A file root is
+// searched even when it does not match include
+func listFiles(root string, opts Options) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.Errorf(common.CodeNotFound, "path does not exist: %q", root)
+		}
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+	if !opts.Recursive {
+		return nil, common.Errorf(common.CodeInvalid, "%q is a directory (set recursive: true to search it)", root)
+	}
+
+	var files []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable directories and continue
+			if os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != root && matchesGlobs(opts.Exclude, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if len(opts.Include) > 0 && !matchesGlobs(opts.Include, path) {
+			return nil
+		}
+		if matchesGlobs(opts.Exclude, path) {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files, err
+}
+
+// contextLine is a line around a match, kept until it is needed
+type contextLine struct {
+	lineno int
+	text   string
+}
+
+func contextLines(lines []contextLine) []any {
+	result := make([]any, len(lines))
+	for i, l := range lines {
+		result[i] = map[string]any{"lineno": l.lineno, "line": l.text}
+	}
+	return result
+}
+
+// searchFile returns the matching lines of one file. Binary files are
+// skipped unless opts.Binary is set
+func searchFile(path string, re *regexp.Regexp, opts Options) ([]map[string]any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	if !opts.Binary {
+		head, _ := r.Peek(binarySniffLen)
+		if bytes.IndexByte(head, 0) >= 0 {
+			return nil, nil
+		}
+	}
+
+	var results []map[string]any
+	var before []contextLine
+	var waiting []map[string]any // matches still collecting after-context
+	lineno := 0
+	for {
+		text, err := r.ReadString('\n')
+		if text == "" && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return results, err
+		}
+		lineno++
+		text = strings.TrimRight(text, "\r\n")
+
+		// Every line is after-context for the matches still waiting for it
+		kept := waiting[:0]
+		for _, m := range waiting {
+			after := m["after"].([]any)
+			if len(after) < opts.After {
+				m["after"] = append(after, map[string]any{"lineno": lineno, "line": text})
+			}
+			if len(m["after"].([]any)) < opts.After {
+				kept = append(kept, m)
+			}
+		}
+		waiting = kept
+
+		loc := re.FindStringIndex(text)
+		limited := opts.MaxCount > 0 && len(results) >= opts.MaxCount
+		if (loc != nil) != opts.Invert && !limited {
+			result := map[string]any{
+				"file":   path,
+				"lineno": lineno,
+				"line":   text,
+				"match":  nil,
+			}
+			if loc != nil {
+				result["match"] = text[loc[0]:loc[1]]
+			}
+			if opts.Before > 0 {
+				result["before"] = contextLines(before)
+			}
+			if opts.After > 0 {
+				result["after"] = []any{}
+				waiting = append(waiting, result)
+			}
+			results = append(results, result)
+		}
+		// Stop once the last match has its after-context
+		if opts.MaxCount > 0 && len(results) >= opts.MaxCount && len(waiting) == 0 {
+			break
+		}
+
+		if opts.Before > 0 {
+			before = append(before, contextLine{lineno, text})
+			if len(before) > opts.Before {
+				before = before[1:]
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return results, nil
+}
+
+// grepIter searches files one at a time, so results from the first files
+// are available before the whole tree has been read
+type grepIter struct {
+	files   []string
+	re      *regexp.Regexp
+	opts    Options
+	pending []map[string]any
+}
+
+func (it *grepIter) Next() (any, bool) {
+	for len(it.pending) == 0 {
+		if len(it.files) == 0 {
+			return nil, false
+		}
+		path := it.files[0]
+		it.files = it.files[1:]
+		// Files that cannot be read are skipped, like grep -s
+		it.pending, _ = searchFile(path, it.re, it.opts)
+	}
+	result := it.pending[0]
+	it.pending = it.pending[1:]
+	return result, true
+}
+
+// RegisterGrep registers the grep function with gojq
+func RegisterGrep() gojq.CompilerOption {
+	return common.WithIterFunction("grep", 1, 3, common.AuditedIter("grep", func(v any, args []any) gojq.Iter {
+		// grep(pattern) with the path from the pipeline, grep(pattern; path),
+		// or grep(pattern; path; options)
+		pattern, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "grep: pattern must be a string, got %T", common.ExtractUDFValue(args[0])), nil))
+		}
+		pathVal := v
+		if len(args) > 1 {
+			pathVal = args[1]
+		}
+		var opts Options
+		if len(args) > 2 {
+			m, ok := common.ExtractUDFValue(args[2]).(map[string]any)
+			if !ok {
+				return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "grep: options must be an object, got %T", common.ExtractUDFValue(args[2])), nil))
+			}
+			var err error
+			if opts, err = parseOptions(m); err != nil {
+				return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("grep: %w", err), nil))
+			}
+		}
+
+		path, ok := common.ExtractUDFValue(pathVal).(string)
+		if !ok || path == "" {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "grep: path must be a non-empty string, got %T", common.ExtractUDFValue(pathVal)), nil))
+		}
+		absPath, err := common.ResolvePath(path)
+		if err == nil {
+			err = common.CheckRead(absPath)
+		}
+		if err != nil {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("grep: %w", err), nil))
+		}
+
+		if opts.Fixed {
+			pattern = regexp.QuoteMeta(pattern)
+		}
+		re, err := regex.Compile(pattern, opts.Flags)
+		if err != nil {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("grep: %w", err), nil))
+		}
+
+		files, err := listFiles(absPath, opts)
+		if err != nil {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("grep: %w", err), nil))
+		}
+		return &grepIter{files: files, re: re, opts: opts}
+	}))
+}
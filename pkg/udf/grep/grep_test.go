@@ -0,0 +1,198 @@
+package grep
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query, collecting every output
+func runGojqQueryAll(t *testing.T, query string, input any, options ...gojq.CompilerOption) []any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var results []any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+// writeTree creates a small source tree and returns its root
+func writeTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"main.go":           "package main\n\n// TODO: flags\nfunc main() {\n\t// todo: exit code\n}\n",
+		"README.md":         "# Demo\nTODO: docs\n",
+		"lib/util.go":       "package lib\n// TODO one\n// TODO two\n// TODO three\n",
+		"vendor/dep/dep.go": "// TODO vendored\n",
+		"bin/tool":          "TODO\x00binary",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// locations reduces results to "relative/path:lineno" strings
+func locations(t *testing.T, root string, results []any) []string {
+	t.Helper()
+	var locs []string
+	for _, r := range results {
+		obj := r.(map[string]any)
+		if errStr, ok := obj["_err"]; ok {
+			t.Fatalf("Unexpected error result %v", errStr)
+		}
+		rel, _ := filepath.Rel(root, obj["file"].(string))
+		locs = append(locs, filepath.ToSlash(rel)+":"+strconv.Itoa(obj["lineno"].(int)))
+	}
+	return locs
+}
+
+var grepOpts = []gojq.CompilerOption{RegisterGrep()}
+
+func TestGrepFile(t *testing.T) {
+	root := writeTree(t)
+	path := filepath.Join(root, "main.go")
+
+	results := runGojqQueryAll(t, `grep("TODO: (\\w+)")`, path, grepOpts...)
+	want := []any{map[string]any{"file": path, "lineno": 3, "line": "// TODO: flags", "match": "TODO: flags"}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("grep mismatch:\n got: %v\nwant: %v", results, want)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"ignore case", `grep("todo"; .; {ignore_case: true})`, []string{"main.go:3", "main.go:5"}},
+		{"flags", `grep("^func"; .; {flags: "m"})`, []string{"main.go:4"}},
+		{"fixed", `grep("main()"; .; {fixed: true})`, []string{"main.go:4"}},
+		{"invert", `grep("\\S"; .; {invert: true})`, []string{"main.go:2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := locations(t, root, runGojqQueryAll(t, tt.query, path, grepOpts...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrepRecursive(t *testing.T) {
+	root := writeTree(t)
+
+	tests := []struct {
+		name string
+		opts string
+		want []string
+	}{
+		// The binary file is skipped; files are visited in lexical order
+		{"all", `{recursive: true}`, []string{"README.md:2", "lib/util.go:2", "lib/util.go:3", "lib/util.go:4", "main.go:3", "vendor/dep/dep.go:1"}},
+		{"include", `{recursive: true, include: "*.go"}`, []string{"lib/util.go:2", "lib/util.go:3", "lib/util.go:4", "main.go:3", "vendor/dep/dep.go:1"}},
+		{"exclude dir", `{recursive: true, include: ["*.go"], exclude: "vendor"}`, []string{"lib/util.go:2", "lib/util.go:3", "lib/util.go:4", "main.go:3"}},
+		{"max count", `{recursive: true, max_count: 1}`, []string{"README.md:2", "lib/util.go:2", "main.go:3", "vendor/dep/dep.go:1"}},
+		{"binary", `{recursive: true, binary: true, include: "tool"}`, []string{"bin/tool:1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := locations(t, root, runGojqQueryAll(t, `grep("TODO"; .; `+tt.opts+`)`, root, grepOpts...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.opts, got, tt.want)
+			}
+		})
+	}
+
+	// Paths from find can be piped straight in
+	results := runGojqQueryAll(t, `grep("TODO"; "`+filepath.Join(root, "README.md")+`") | .line`, nil, grepOpts...)
+	if !reflect.DeepEqual(results, []any{"TODO: docs"}) {
+		t.Errorf("Unexpected lines %v", results)
+	}
+}
+
+func TestGrepContext(t *testing.T) {
+	root := writeTree(t)
+	path := filepath.Join(root, "lib", "util.go")
+
+	results := runGojqQueryAll(t, `grep("two"; .; {context: 1})`, path, grepOpts...)
+	want := []any{map[string]any{
+		"file":   path,
+		"lineno": 3,
+		"line":   "// TODO two",
+		"match":  "two",
+		"before": []any{map[string]any{"lineno": 2, "line": "// TODO one"}},
+		"after":  []any{map[string]any{"lineno": 4, "line": "// TODO three"}},
+	}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Context mismatch:\n got: %v\nwant: %v", results, want)
+	}
+
+	// Context is cut short at the start and end of the file, and max_count
+	// still collects the after-context of the last match
+	results = runGojqQueryAll(t, `grep("TODO"; .; {before: 2, after: 5, max_count: 1}) | [(.before | length), (.after | length)]`, path, grepOpts...)
+	if !reflect.DeepEqual(results, []any{[]any{1, 2}}) {
+		t.Errorf("Unexpected context sizes %v", results)
+	}
+}
+
+func TestGrepErrors(t *testing.T) {
+	root := writeTree(t)
+
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`grep("x")`, root, "grep: " + `"` + root + `" is a directory (set recursive: true to search it)`},
+		{`grep("x")`, filepath.Join(root, "missing"), "grep: path does not exist"},
+		{`grep("(")`, root, `grep: invalid pattern "("`},
+		{`grep(1)`, root, "grep: pattern must be a string"},
+		{`grep("x")`, 5, "grep: path must be a non-empty string"},
+		{`grep("x"; .; 5)`, root, "grep: options must be an object"},
+		{`grep("x"; .; {context: -1})`, root, "grep: options.context must not be negative"},
+		{`grep("x"; .; {include: "["})`, root, `grep: invalid glob "["`},
+		{`grep("x"; .; {bogus: 1})`, root, `grep: unknown option "bogus"`},
+	}
+	for _, tt := range tests {
+		results := runGojqQueryAll(t, tt.query, tt.input, grepOpts...)
+		if len(results) != 1 {
+			t.Errorf("%s: expected a single error result, got %v", tt.query, results)
+			continue
+		}
+		obj, _ := results[0].(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, results[0])
+		}
+	}
+}
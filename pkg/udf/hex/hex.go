@@ -10,10 +10,10 @@ import (
 
 // RegisterHexEncode registers the hex_encode function with gojq
 func RegisterHexEncode() gojq.CompilerOption {
-	return gojq.WithFunction("hex_encode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("hex_encode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("hex_encode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("hex_encode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -25,7 +25,7 @@ func RegisterHexEncode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("hex_encode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "hex_encode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -33,25 +33,18 @@ func RegisterHexEncode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "hex_encode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("hex_encode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("hex_encode: %w", err), meta)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("hex_encode: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("hex_encode: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		encoded := hex.EncodeToString(inputBytes)
@@ -73,10 +66,10 @@ func RegisterHexEncode() gojq.CompilerOption {
 
 // RegisterHexDecode registers the hex_decode function with gojq
 func RegisterHexDecode() gojq.CompilerOption {
-	return gojq.WithFunction("hex_decode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("hex_decode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("hex_decode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("hex_decode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -88,7 +81,7 @@ func RegisterHexDecode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("hex_decode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "hex_decode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -96,7 +89,7 @@ func RegisterHexDecode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "hex_decode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("hex_decode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("hex_decode: %w", err), meta)
 			}
 
 			input = string(fileData)
@@ -112,7 +105,7 @@ func RegisterHexDecode() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("hex_decode: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "hex_decode: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -128,7 +121,7 @@ func RegisterHexDecode() gojq.CompilerOption {
 			} else {
 				meta["original_length"] = len(input)
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("hex_decode: invalid hex string: %v", err), meta)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "hex_decode: invalid hex string: %w", err), meta)
 		}
 
 		meta := map[string]any{
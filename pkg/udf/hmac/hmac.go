@@ -29,7 +29,7 @@ func getHashFunc(algorithm string) (func() hash.Hash, error) {
 	case "sha512_256":
 		return sha512.New512_256, nil
 	default:
-		return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+		return nil, common.Errorf(common.CodeInvalid, "unsupported hash algorithm: %v", algorithm)
 	}
 }
 
@@ -42,9 +42,9 @@ func RegisterHMAC(algorithm string) gojq.CompilerOption {
 
 	funcName := fmt.Sprintf("hmac_%s", algorithm)
 
-	return gojq.WithFunction(funcName, 1, 3, func(v any, args []any) any {
+	return common.WithFunction(funcName, 1, 3, func(v any, args []any) any {
 		if len(args) < 1 {
-			return common.MakeUDFErrorResult(fmt.Errorf("%s: expected at least 1 argument (key)", funcName), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "%v: expected at least 1 argument (key)", funcName), nil)
 		}
 
 		// First argument is the key
@@ -56,7 +56,7 @@ func RegisterHMAC(algorithm string) gojq.CompilerOption {
 		case []byte:
 			key = val
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("%s: key must be a string or bytes, got %T", funcName, val), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "%v: key must be a string or bytes, got %T", funcName, val), nil)
 		}
 
 		// Parse remaining arguments for message and file flag
@@ -88,30 +88,23 @@ func RegisterHMAC(algorithm string) gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("%s: file argument requires string path, got %T", funcName, inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "%v: file argument requires string path, got %T", funcName, inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("%s: %v", funcName, err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("%v: %w", funcName, err), nil)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("%s: message must be a string or bytes, got %T", funcName, val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("%v: %w", funcName, err), nil)
 			}
+			inputBytes = b
 		}
 
 		// Compute HMAC
@@ -10,10 +10,10 @@ import (
 
 // RegisterHTMLEncode registers the html_encode function with gojq
 func RegisterHTMLEncode() gojq.CompilerOption {
-	return gojq.WithFunction("html_encode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("html_encode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("html_encode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("html_encode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -25,7 +25,7 @@ func RegisterHTMLEncode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("html_encode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "html_encode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -33,7 +33,7 @@ func RegisterHTMLEncode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "html_encode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("html_encode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("html_encode: %w", err), meta)
 			}
 
 			input = string(fileData)
@@ -49,7 +49,7 @@ func RegisterHTMLEncode() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("html_encode: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "html_encode: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -73,10 +73,10 @@ func RegisterHTMLEncode() gojq.CompilerOption {
 
 // RegisterHTMLDecode registers the html_decode function with gojq
 func RegisterHTMLDecode() gojq.CompilerOption {
-	return gojq.WithFunction("html_decode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("html_decode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("html_decode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("html_decode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -88,7 +88,7 @@ func RegisterHTMLDecode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("html_decode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "html_decode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -96,7 +96,7 @@ func RegisterHTMLDecode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "html_decode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("html_decode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("html_decode: %w", err), meta)
 			}
 
 			input = string(fileData)
@@ -112,7 +112,7 @@ func RegisterHTMLDecode() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("html_decode: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "html_decode: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
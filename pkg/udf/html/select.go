@@ -0,0 +1,285 @@
+package html
+
+import (
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Elements selected by html_select are objects of the form
+//
+//	{tag: "a", attrs: {href: "/"}, text: "Home", html: "<a href=\"/\">Home</a>"}
+//
+// so they can be inspected directly or passed back into html_select,
+// html_text and html_attr.
+
+// parseNodes parses a page or fragment. Full documents go through the
+// HTML5 document algorithm; fragments are parsed in a <template> context so
+// elements such as <td> or <li> survive outside of their usual parents
+func parseNodes(input string) ([]*xhtml.Node, error) {
+	head := strings.ToLower(strings.TrimSpace(input))
+	if len(head) > 64 {
+		head = head[:64]
+	}
+	if strings.HasPrefix(head, "<!doctype") || strings.HasPrefix(head, "<html") || strings.HasPrefix(head, "<?xml") {
+		doc, err := xhtml.Parse(strings.NewReader(input))
+		if err != nil {
+			return nil, err
+		}
+		return []*xhtml.Node{doc}, nil
+	}
+	context := &xhtml.Node{Type: xhtml.ElementNode, Data: "template", DataAtom: atom.Template}
+	return xhtml.ParseFragment(strings.NewReader(input), context)
+}
+
+// inputNodes parses the input of html_select, html_text or html_attr: an
+// HTML string or an element object
+func inputNodes(name string, v any) ([]*xhtml.Node, error) {
+	var input string
+	switch val := v.(type) {
+	case string:
+		input = val
+	case []byte:
+		input = string(val)
+	case map[string]any:
+		s, ok := val["html"].(string)
+		if !ok {
+			return nil, common.Errorf(common.CodeInvalid, "%v: element object must have an html field", name)
+		}
+		input = s
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "%v: input must be an HTML string or an element, got %T", name, v)
+	}
+	nodes, err := parseNodes(input)
+	if err != nil {
+		return nil, common.Errorf(common.CodeInvalid, "%v: failed to parse HTML: %w", name, err)
+	}
+	return nodes, nil
+}
+
+// eachInput applies fn to the input, or to each item when the input is an
+// array, collecting the results in the same shape
+func eachInput(v any, fn func(any) (any, error)) (any, error) {
+	list, ok := v.([]any)
+	if !ok {
+		return fn(v)
+	}
+	results := make([]any, len(list))
+	for i, item := range list {
+		r, err := fn(common.ExtractUDFValue(item))
+		if err != nil {
+			return nil, err
+		}
+		results[i] = r
+	}
+	return results, nil
+}
+
+func elementObject(n *xhtml.Node) map[string]any {
+	attrs := map[string]any{}
+	for _, a := range n.Attr {
+		key := a.Key
+		if a.Namespace != "" {
+			key = a.Namespace + ":" + a.Key
+		}
+		if _, ok := attrs[key]; !ok {
+			attrs[key] = a.Val
+		}
+	}
+	var sb strings.Builder
+	xhtml.Render(&sb, n)
+	return map[string]any{
+		"tag":   n.Data,
+		"attrs": attrs,
+		"text":  nodeText(n),
+		"html":  sb.String(),
+	}
+}
+
+// blockElements separate their text from the surrounding text
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Br: true, atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true, atom.Form: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Nav: true,
+	atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true, atom.Table: true,
+	atom.Td: true, atom.Th: true, atom.Tr: true, atom.Ul: true,
+}
+
+// nodeText returns the visible text of a node with runs of whitespace
+// collapsed to single spaces. Scripts, styles and comments are skipped
+func nodeText(n *xhtml.Node) string {
+	var sb strings.Builder
+	var walk func(*xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		switch n.Type {
+		case xhtml.TextNode:
+			sb.WriteString(n.Data)
+			return
+		case xhtml.ElementNode:
+			switch n.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript, atom.Template:
+				return
+			}
+		case xhtml.CommentNode, xhtml.DoctypeNode:
+			return
+		}
+		block := n.Type == xhtml.ElementNode && blockElements[n.DataAtom]
+		if block {
+			sb.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if block {
+			sb.WriteByte(' ')
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// RegisterHTMLSelect registers the html_select function with gojq
+func RegisterHTMLSelect() gojq.CompilerOption {
+	return common.WithFunction("html_select", 1, 2, func(v any, args []any) any {
+		selector, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "html_select: selector must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		sel, err := cascadia.Compile(selector)
+		if err != nil {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "html_select: invalid selector %q: %w", selector, err), nil)
+		}
+
+		inputVal := v
+		if len(args) > 1 {
+			inputVal = args[1]
+		}
+		inputVal = common.ExtractUDFValue(inputVal)
+
+		// An array of pages or elements is searched item by item and the
+		// matches are concatenated
+		items, ok := inputVal.([]any)
+		if !ok {
+			items = []any{inputVal}
+		}
+		matches := []any{}
+		for _, item := range items {
+			nodes, err := inputNodes("html_select", common.ExtractUDFValue(item))
+			if err != nil {
+				return common.MakeUDFErrorResult(err, nil)
+			}
+			for _, n := range nodes {
+				for _, m := range sel.MatchAll(n) {
+					matches = append(matches, elementObject(m))
+				}
+			}
+		}
+
+		meta := map[string]any{
+			"operation": "html_select",
+			"selector":  selector,
+			"count":     len(matches),
+		}
+		return common.MakeUDFSuccessResult(matches, meta)
+	})
+}
+
+// RegisterHTMLText registers the html_text function with gojq
+func RegisterHTMLText() gojq.CompilerOption {
+	return common.WithFunction("html_text", 0, 1, func(v any, args []any) any {
+		inputVal := v
+		if len(args) > 0 {
+			inputVal = args[0]
+		}
+
+		result, err := eachInput(common.ExtractUDFValue(inputVal), func(item any) (any, error) {
+			nodes, err := inputNodes("html_text", item)
+			if err != nil {
+				return nil, err
+			}
+			texts := make([]string, 0, len(nodes))
+			for _, n := range nodes {
+				if t := nodeText(n); t != "" {
+					texts = append(texts, t)
+				}
+			}
+			return strings.Join(texts, " "), nil
+		})
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		meta := map[string]any{
+			"operation": "html_text",
+		}
+		return common.MakeUDFSuccessResult(result, meta)
+	})
+}
+
+// RegisterHTMLAttr registers the html_attr function with gojq
+func RegisterHTMLAttr() gojq.CompilerOption {
+	return common.WithFunction("html_attr", 1, 2, func(v any, args []any) any {
+		name, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "html_attr: attribute name must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		name = strings.ToLower(name)
+
+		inputVal := v
+		if len(args) > 1 {
+			inputVal = args[1]
+		}
+
+		result, err := eachInput(common.ExtractUDFValue(inputVal), func(item any) (any, error) {
+			// Element objects already carry their attributes
+			if obj, ok := item.(map[string]any); ok {
+				if attrs, ok := obj["attrs"].(map[string]any); ok {
+					return attrs[name], nil
+				}
+			}
+			// Otherwise the attribute of the first element is used
+			nodes, err := inputNodes("html_attr", item)
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range nodes {
+				if first := firstElement(n); first != nil {
+					for _, a := range first.Attr {
+						if a.Namespace == "" && a.Key == name {
+							return a.Val, nil
+						}
+					}
+					return nil, nil
+				}
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		meta := map[string]any{
+			"operation": "html_attr",
+			"attribute": name,
+		}
+		return common.MakeUDFSuccessResult(result, meta)
+	})
+}
+
+func firstElement(n *xhtml.Node) *xhtml.Node {
+	if n.Type == xhtml.ElementNode {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if e := firstElement(c); e != nil {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package html
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+const page = `<!DOCTYPE html>
+<html lang="en">
+<head><title>Shop</title><style>p { color: red }</style></head>
+<body>
+  <ul id="products">
+    <li class="item" data-id="1"><a href="/a">Apple</a> <span class="price">1.20</span></li>
+    <li class="item sale" data-id="2"><a href="/b">Banana</a> <span class="price">0.50</span></li>
+  </ul>
+  <table><tr><td>x</td><td>y</td></tr></table>
+  <p>Hello<br>world <!-- hidden --><script>var x = 1;</script></p>
+</body>
+</html>`
+
+var selectOpts = []gojq.CompilerOption{RegisterHTMLSelect(), RegisterHTMLText(), RegisterHTMLAttr()}
+
+func TestHTMLSelect(t *testing.T) {
+	result := runGojqQuery(t, `html_select("li.sale a")`, page, selectOpts...)
+	got := result.(map[string]any)
+	want := []any{map[string]any{
+		"tag":   "a",
+		"attrs": map[string]any{"href": "/b"},
+		"text":  "Banana",
+		"html":  `<a href="/b">Banana</a>`,
+	}}
+	if !reflect.DeepEqual(got["_val"], want) {
+		t.Errorf("Select mismatch:\n got: %v\nwant: %v", got["_val"], want)
+	}
+	meta := got["_meta"].(map[string]any)
+	if meta["selector"] != "li.sale a" || meta["count"] != 1 {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  any
+	}{
+		{"attribute selector", `html_select("[data-id=\"1\"] .price") | ._val | map(.text)`, []any{"1.20"}},
+		{"no matches", `html_select("div.missing") | ._val`, []any{}},
+		{"table cells", `html_select("td") | ._val | map(.text)`, []any{"x", "y"}},
+		// Selected elements can be searched again, including table cells
+		// that a document parser would drop outside of a table
+		{"nested select", `html_select("li") | ._val | html_select("span") | ._val | map(.text)`, []any{"1.20", "0.50"}},
+		{"select cells from row", `html_select("tr") | ._val[0] | html_select("td:last-child") | ._val[0].text`, "y"},
+		{"fragment input", `html_select("b"; "<p>a <b>bold</b> move</p>") | ._val[0].text`, "bold"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query, page, selectOpts...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLText(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  any
+	}{
+		{"document", `html_select("p") | ._val[0] | html_text | ._val`, "Hello world"},
+		{"array", `html_select("li") | html_text | ._val`, []any{"Apple 1.20", "Banana 0.50"}},
+		{"string", `html_text("<div>a</div><div>b   c</div>") | ._val`, "a b c"},
+		{"skips style", `html_select("head") | ._val[0].text`, "Shop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query, page, selectOpts...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLAttr(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  any
+	}{
+		{"array of elements", `html_select("a") | html_attr("href") | ._val`, []any{"/a", "/b"}},
+		{"single element", `html_select("li") | ._val[1] | html_attr("class") | ._val`, "item sale"},
+		{"missing attribute", `html_select("a") | ._val[0] | html_attr("title") | ._val`, nil},
+		{"document root", `html_attr("lang") | ._val`, "en"},
+		{"case insensitive", `html_attr("HREF"; "<a href='/x'>x</a>") | ._val`, "/x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query, page, selectOpts...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLSelectErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`html_select("a[")`, page, `html_select: invalid selector "a["`},
+		{`html_select(5)`, page, "html_select: selector must be a string"},
+		{`html_select("a")`, 5, "html_select: input must be an HTML string or an element"},
+		{`html_select("a")`, map[string]any{"tag": "a"}, "html_select: element object must have an html field"},
+		{`html_text`, nil, "html_text: input must be an HTML string or an element"},
+		{`html_attr(1)`, page, "html_attr: attribute name must be a string"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, selectOpts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cachedResponse is a GET response as kept by the --cache of the command
+type cachedResponse struct {
+	Status     int         `json:"status"`
+	StatusText string      `json:"statusText"`
+	Header     http.Header `json:"headers"`
+	Body       []byte      `json:"body"`
+}
+
+// cacheableStatus are the statuses a response may be cached with without
+// saying so, per RFC 9110. A 404 is worth keeping: lookups of unknown
+// indicators are as repetitive as the others
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// cacheMaxAge reads how long a response may be kept from its Cache-Control
+// and Expires headers. It is negative when they don't say, and ok is false
+// when the response must not be cached at all
+func cacheMaxAge(header http.Header) (maxAge time.Duration, ok bool) {
+	maxAge = -1
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0, false
+		case "max-age":
+			secs, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || secs <= 0 {
+				return 0, false
+			}
+			maxAge = time.Duration(secs) * time.Second
+		}
+	}
+	if maxAge < 0 {
+		if expires := header.Get("Expires"); expires != "" {
+			t, err := http.ParseTime(expires)
+			if err != nil || !t.After(time.Now()) {
+				return 0, false
+			}
+			maxAge = time.Until(t)
+		}
+	}
+	return maxAge, true
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -18,7 +19,7 @@ import (
 
 // RegisterHTTP registers the http function with gojq
 func RegisterHTTP() gojq.CompilerOption {
-	return gojq.WithFunction("http", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("http", 0, 2, common.Audited("http", func(v any, args []any) any {
 		var method string = "POST" // default method
 		var url string
 
@@ -29,7 +30,7 @@ func RegisterHTTP() gojq.CompilerOption {
 			if urlStr, ok := inputVal.(string); ok {
 				url = urlStr
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("http: URL must be provided as argument or from pipeline, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http: URL must be provided as argument or from pipeline, got %T", inputVal), nil)
 			}
 		} else if len(args) == 1 {
 			// One argument: could be method or URL
@@ -40,7 +41,7 @@ func RegisterHTTP() gojq.CompilerOption {
 				url = urlStr
 				// Method stays as default POST
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("http: URL argument must be a string, got %T", argVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http: URL argument must be a string, got %T", argVal), nil)
 			}
 		} else if len(args) == 2 {
 			// Two arguments: method, url
@@ -50,19 +51,19 @@ func RegisterHTTP() gojq.CompilerOption {
 			if methodStr, ok := methodVal.(string); ok {
 				method = strings.ToUpper(methodStr)
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("http: method argument must be a string, got %T", methodVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http: method argument must be a string, got %T", methodVal), nil)
 			}
 
 			if urlStr, ok := urlVal.(string); ok {
 				url = urlStr
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("http: URL argument must be a string, got %T", urlVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http: URL argument must be a string, got %T", urlVal), nil)
 			}
 		}
 
 		// Validate URL is provided
 		if url == "" {
-			return common.MakeUDFErrorResult(fmt.Errorf("http: URL is required but was not provided"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http: URL is required but was not provided"), nil)
 		}
 
 		// Validate method
@@ -71,7 +72,7 @@ func RegisterHTTP() gojq.CompilerOption {
 			"DELETE": true, "HEAD": true, "OPTIONS": true,
 		}
 		if !validMethods[method] {
-			return common.MakeUDFErrorResult(fmt.Errorf("http: invalid method %q, must be one of: GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS", method), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http: invalid method %q, must be one of: GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS", method), nil)
 		}
 
 		// Prepare request body from pipeline input
@@ -107,7 +108,7 @@ func RegisterHTTP() gojq.CompilerOption {
 					// JSON object or array - stringify it
 					jsonBytes, err := json.Marshal(b)
 					if err != nil {
-						return common.MakeUDFErrorResult(fmt.Errorf("http: failed to marshal request body to JSON: %v", err), nil)
+						return common.MakeUDFErrorResult(fmt.Errorf("http: failed to marshal request body to JSON: %w", err), nil)
 					}
 					bodyBytes = jsonBytes
 					bodyString = string(jsonBytes)
@@ -134,7 +135,7 @@ func RegisterHTTP() gojq.CompilerOption {
 					// JSON object or array - stringify it
 					jsonBytes, err := json.Marshal(b)
 					if err != nil {
-						return common.MakeUDFErrorResult(fmt.Errorf("http: failed to marshal request body to JSON: %v", err), nil)
+						return common.MakeUDFErrorResult(fmt.Errorf("http: failed to marshal request body to JSON: %w", err), nil)
 					}
 					bodyBytes = jsonBytes
 					bodyString = string(jsonBytes)
@@ -151,9 +152,18 @@ func RegisterHTTP() gojq.CompilerOption {
 		}
 
 		// Create HTTP request
-		req, err := http.NewRequest(method, url, bodyReader)
+		ctx, cancel := common.Context()
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("http: failed to create request: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("http: failed to create request: %w", err), nil)
+		}
+		if err := common.CheckNet(req.URL.Host); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("http: %w", err), map[string]any{
+				"operation": "http",
+				"method":    method,
+				"url":       url,
+			})
 		}
 
 		// Set Content-Type header if we have a body
@@ -169,12 +179,39 @@ func RegisterHTTP() gojq.CompilerOption {
 			}
 		}
 
+		// GETs without a body are answered from the cache, when there is one
+		var cacheKey string
+		if method == "GET" && !hasBody && common.CacheEnabled() {
+			cacheKey = "http GET " + url
+			var cached cachedResponse
+			if common.CacheGet(cacheKey, &cached) {
+				meta := responseMeta(method, url, cached.Status, cached.StatusText, cached.Header)
+				meta["responseBodySize"] = len(cached.Body)
+				meta["cached"] = true
+				return common.MakeUDFSuccessResult(string(cached.Body), meta)
+			}
+		}
+
 		// Create HTTP client with timeout
 		client := &http.Client{
 			Timeout: 30 * time.Second,
+			// Redirects are held to the sandbox policy too
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 10 {
+					return errors.New("stopped after 10 redirects")
+				}
+				return common.CheckNet(req.URL.Host)
+			},
 		}
 
-		// Make the request
+		// Make the request, once the rate limits allow it
+		if err := common.WaitRate(ctx, req.URL.Host); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("http: %w", err), map[string]any{
+				"operation": "http",
+				"method":    method,
+				"url":       url,
+			})
+		}
 		resp, err := client.Do(req)
 		if err != nil {
 			meta := map[string]any{
@@ -182,12 +219,12 @@ func RegisterHTTP() gojq.CompilerOption {
 				"method":    method,
 				"url":       url,
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("http: request failed: %v", err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("http: request failed: %w", err), meta)
 		}
 		defer resp.Body.Close()
 
 		// Read response body
-		respBody, err := io.ReadAll(resp.Body)
+		respBody, err := io.ReadAll(common.ProgressReader(resp.Body, "download", url, resp.ContentLength))
 		if err != nil {
 			meta := map[string]any{
 				"operation":  "http",
@@ -196,30 +233,19 @@ func RegisterHTTP() gojq.CompilerOption {
 				"status":     resp.StatusCode,
 				"statusText": resp.Status,
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("http: failed to read response body: %v", err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("http: failed to read response body: %w", err), meta)
 		}
 
-		// Convert response headers to map
-		headers := make(map[string]any)
-		for key, values := range resp.Header {
-			if len(values) == 1 {
-				headers[key] = values[0]
-			} else {
-				headers[key] = values
+		if cacheKey != "" && cacheableStatus[resp.StatusCode] {
+			if maxAge, ok := cacheMaxAge(resp.Header); ok {
+				common.CachePut(cacheKey, cachedResponse{resp.StatusCode, resp.Status, resp.Header, respBody}, maxAge)
 			}
 		}
 
 		// Return response body as string
 		responseBody := string(respBody)
 
-		meta := map[string]any{
-			"operation":  "http",
-			"method":     method,
-			"url":        url,
-			"status":     resp.StatusCode,
-			"statusText": resp.Status,
-			"headers":    headers,
-		}
+		meta := responseMeta(method, url, resp.StatusCode, resp.Status, resp.Header)
 
 		if hasBody {
 			meta["requestBody"] = bodyString
@@ -229,15 +255,36 @@ func RegisterHTTP() gojq.CompilerOption {
 		meta["responseBodySize"] = len(respBody)
 
 		return common.MakeUDFSuccessResult(responseBody, meta)
-	})
+	}))
+}
+
+// responseMeta is the _meta of a response, whether fresh or from the cache
+func responseMeta(method, url string, status int, statusText string, header http.Header) map[string]any {
+	// Convert response headers to map
+	headers := make(map[string]any)
+	for key, values := range header {
+		if len(values) == 1 {
+			headers[key] = values[0]
+		} else {
+			headers[key] = values
+		}
+	}
+	return map[string]any{
+		"operation":  "http",
+		"method":     method,
+		"url":        url,
+		"status":     status,
+		"statusText": statusText,
+		"headers":    headers,
+	}
 }
 
 // RegisterHTTPServe registers the http_serve function with gojq
 func RegisterHTTPServe() gojq.CompilerOption {
-	return gojq.WithFunction("http_serve", 2, 2, func(v any, args []any) any {
+	return common.WithFunction("http_serve", 2, 2, common.Audited("http_serve", func(v any, args []any) any {
 		// Parse arguments: host, port
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("http_serve: expected 2 arguments (host, port), got %d", len(args)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http_serve: expected 2 arguments (host, port), got %d", len(args)), nil)
 		}
 
 		hostVal := common.ExtractUDFValue(args[0])
@@ -250,7 +297,7 @@ func RegisterHTTPServe() gojq.CompilerOption {
 		if hostStr, ok := hostVal.(string); ok {
 			host = hostStr
 		} else {
-			return common.MakeUDFErrorResult(fmt.Errorf("http_serve: host argument must be a string, got %T", hostVal), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http_serve: host argument must be a string, got %T", hostVal), nil)
 		}
 
 		// Parse port
@@ -264,15 +311,19 @@ func RegisterHTTPServe() gojq.CompilerOption {
 			var err error
 			_, err = fmt.Sscanf(p, "%d", &port)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("http_serve: port argument must be an integer or integer string, got %q", p), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http_serve: port argument must be an integer or integer string, got %q", p), nil)
 			}
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("http_serve: port argument must be an integer, got %T", portVal), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http_serve: port argument must be an integer, got %T", portVal), nil)
 		}
 
 		// Validate port range (0 is allowed - OS will assign)
 		if port < 0 || port > 65535 {
-			return common.MakeUDFErrorResult(fmt.Errorf("http_serve: port must be between 0 and 65535, got %d", port), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "http_serve: port must be between 0 and 65535, got %d", port), nil)
+		}
+
+		if err := common.CheckNet(host); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("http_serve: %w", err), nil)
 		}
 
 		// Get the input value from the pipeline
@@ -296,7 +347,7 @@ func RegisterHTTPServe() gojq.CompilerOption {
 		// Listen on the address
 		listener, err := lc.Listen(context.Background(), "tcp", fmt.Sprintf("%s:%d", host, port))
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("http_serve: failed to listen on %s:%d: %v", host, port, err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("http_serve: failed to listen on %v:%d: %w", host, port, err), nil)
 		}
 
 		// Get the actual address (in case port was 0)
@@ -379,7 +430,9 @@ func RegisterHTTPServe() gojq.CompilerOption {
 		// Give the server a moment to start
 		time.Sleep(100 * time.Millisecond)
 
-		// Block waiting for either GET or POST request
+		// Block waiting for either GET or POST request, or the time limit
+		ctx, cancel := common.Context()
+		defer cancel()
 		select {
 		case result := <-resultChan:
 			// Close the server
@@ -416,7 +469,17 @@ func RegisterHTTPServe() gojq.CompilerOption {
 				"port":      actualPort,
 				"url":       serverURL,
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("http_serve: server error: %v", err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("http_serve: server error: %w", err), meta)
+		case <-ctx.Done():
+			server.Close()
+			listener.Close()
+			meta := map[string]any{
+				"operation": "http_serve",
+				"host":      host,
+				"port":      actualPort,
+				"url":       serverURL,
+			}
+			return common.MakeUDFErrorResult(fmt.Errorf("http_serve: no request received: %w", ctx.Err()), meta)
 		}
-	})
+	}))
 }
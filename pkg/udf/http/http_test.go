@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
 )
 
 // Helper to compile and run a gojq query
@@ -518,3 +519,59 @@ func TestHTTPServeErrorInvalidHost(t *testing.T) {
 	}
 }
 
+
+func TestHTTPCache(t *testing.T) {
+	common.SetCache(t.TempDir(), time.Hour)
+	defer common.SetCache("", 0)
+
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		fmt.Fprintf(w, "hit %d", hits)
+	}))
+	defer server.Close()
+
+	for i, want := range []struct {
+		query  string
+		val    string
+		cached bool
+	}{
+		{`http("GET"; "%s/a")`, "hit 1", false},
+		{`http("GET"; "%s/a")`, "hit 1", true},
+		{`"x" | http("GET"; "%s/a")`, "hit 2", false},
+		{`http("POST"; "%s/a")`, "hit 3", false},
+		{`http("GET"; "%s/private")`, "hit 4", false},
+		{`http("GET"; "%s/private")`, "hit 5", false},
+	} {
+		result := runGojqQuery(t, fmt.Sprintf(want.query, server.URL), nil, RegisterHTTP()).(map[string]any)
+		if result["_val"] != want.val {
+			t.Errorf("request %d: _val = %v, want %q", i, result["_val"], want.val)
+		}
+		if cached, _ := result["_meta"].(map[string]any)["cached"].(bool); cached != want.cached {
+			t.Errorf("request %d: cached = %v, want %v", i, cached, want.cached)
+		}
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	for _, tc := range []struct {
+		header http.Header
+		maxAge time.Duration
+		ok     bool
+	}{
+		{http.Header{}, -1, true},
+		{http.Header{"Cache-Control": {"public, max-age=60"}}, time.Minute, true},
+		{http.Header{"Cache-Control": {"max-age=0"}}, 0, false},
+		{http.Header{"Cache-Control": {"private, no-cache"}}, 0, false},
+		{http.Header{"Cache-Control": {"no-store"}}, 0, false},
+		{http.Header{"Expires": {"Thu, 01 Jan 1970 00:00:00 GMT"}}, 0, false},
+	} {
+		maxAge, ok := cacheMaxAge(tc.header)
+		if maxAge != tc.maxAge || ok != tc.ok {
+			t.Errorf("cacheMaxAge(%v) = %v, %v, want %v, %v", tc.header, maxAge, ok, tc.maxAge, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package ini
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// valueKey holds a leaf value when the same key is also used as a section or
+// key prefix, e.g. "logging.level=INFO" next to "logging.level.root=WARN"
+const valueKey = "_value"
+
+// setValue stores value at path inside root. A key seen more than once turns
+// into an array of all its values, in order
+func setValue(root map[string]any, path []string, value any) {
+	node := root
+	for _, part := range path[:len(path)-1] {
+		node = childTable(node, part)
+	}
+	key := path[len(path)-1]
+	switch existing := node[key].(type) {
+	case nil:
+		node[key] = value
+	case map[string]any:
+		appendValue(existing, valueKey, value)
+	default:
+		appendValue(node, key, value)
+	}
+}
+
+// appendValue sets key, or collects repeated values into an array
+func appendValue(node map[string]any, key string, value any) {
+	switch existing := node[key].(type) {
+	case nil:
+		node[key] = value
+	case []any:
+		node[key] = append(existing, value)
+	default:
+		node[key] = []any{existing, value}
+	}
+}
+
+// childTable returns the nested object for key, creating it if needed. A
+// scalar already stored at key moves to the _value slot of the new object
+func childTable(node map[string]any, key string) map[string]any {
+	switch existing := node[key].(type) {
+	case map[string]any:
+		return existing
+	case nil:
+		child := map[string]any{}
+		node[key] = child
+		return child
+	default:
+		child := map[string]any{valueKey: existing}
+		node[key] = child
+		return child
+	}
+}
+
+// unquote strips matching single or double quotes around a value
+func unquote(s string) (string, bool) {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '"' {
+			if u, err := strconv.Unquote(s); err == nil {
+				return u, true
+			}
+		}
+		return s[1 : len(s)-1], true
+	}
+	return s, false
+}
+
+// stripInlineComment removes a trailing " ;" or " #" comment
+func stripInlineComment(s string) string {
+	for i := 1; i < len(s); i++ {
+		if (s[i] == ';' || s[i] == '#') && (s[i-1] == ' ' || s[i-1] == '\t') {
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return s
+}
+
+// ParseINI parses INI text into nested objects. Sections become objects and
+// dotted section names ([server.http]) nest. Keys before the first section
+// live at the top level. Full-line comments start with ; or #, and inline
+// comments need whitespace before the marker. A key without "=" is true
+func ParseINI(input string) (map[string]any, error) {
+	root := map[string]any{}
+	var section []string
+
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				return nil, common.Errorf(common.CodeInvalid, "line %d: unterminated section header %q", lineNum, line)
+			}
+			name := strings.TrimSpace(line[1:end])
+			if name == "" {
+				return nil, common.Errorf(common.CodeInvalid, "line %d: empty section name", lineNum)
+			}
+			section = nil
+			for _, part := range strings.Split(name, ".") {
+				section = append(section, strings.TrimSpace(part))
+			}
+			// Create the section even if it has no keys
+			node := root
+			for _, part := range section {
+				node = childTable(node, part)
+			}
+			continue
+		}
+
+		var key string
+		var value any
+		if i := strings.IndexAny(line, "=:"); i >= 0 {
+			key = strings.TrimSpace(line[:i])
+			raw := strings.TrimSpace(line[i+1:])
+			if s, quoted := unquote(raw); quoted {
+				value = s
+			} else {
+				value = stripInlineComment(raw)
+			}
+		} else {
+			key = stripInlineComment(line)
+			value = true
+		}
+		if key == "" {
+			return nil, common.Errorf(common.CodeInvalid, "line %d: missing key", lineNum)
+		}
+		setValue(root, append(append([]string{}, section...), key), value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// ParseProperties parses Java .properties text. Dotted keys nest into
+// objects. Comments start with # or !, separators are =, :, or whitespace,
+// a trailing backslash continues the line, and \t \n \r \f \uXXXX escapes
+// are decoded
+func ParseProperties(input string) (map[string]any, error) {
+	root := map[string]any{}
+
+	lines := strings.Split(strings.TrimPrefix(input, "\ufeff"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNum := i + 1
+		line := strings.TrimLeft(strings.TrimRight(lines[i], "\r"), " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		// Join continuation lines (an odd number of trailing backslashes)
+		for endsWithContinuation(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(strings.TrimRight(lines[i], "\r"), " \t\f")
+		}
+		line = strings.TrimSuffix(line, "\\")
+
+		keyEnd := len(line)
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if line[j] == '=' || line[j] == ':' || line[j] == ' ' || line[j] == '\t' || line[j] == '\f' {
+				keyEnd = j
+				break
+			}
+		}
+		rest := strings.TrimLeft(line[keyEnd:], " \t\f")
+		if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+			rest = strings.TrimLeft(rest[1:], " \t\f")
+		}
+
+		key, err := unescapeProperty(line[:keyEnd])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		value, err := unescapeProperty(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		setValue(root, strings.Split(key, "."), value)
+	}
+	return root, nil
+}
+
+func endsWithContinuation(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// unescapeProperty decodes .properties escape sequences
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", common.Errorf(common.CodeInvalid, "malformed \\u escape in %q", s)
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", common.Errorf(common.CodeInvalid, "malformed \\u escape in %q", s)
+			}
+			sb.WriteRune(rune(r))
+			i += 4
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// registerParser registers a *_parse function that reads from the pipeline,
+// an argument, or a file, and returns the parsed object directly
+func registerParser(name string, parse func(string) (map[string]any, error)) gojq.CompilerOption {
+	return common.WithFunction(name, 0, 2, func(v any, args []any) any {
+		inputVal, isFile, err := common.ParseFileArgs(v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("%v: %w", name, err), nil)
+		}
+
+		inputVal = common.ExtractUDFValue(inputVal)
+
+		var input string
+		meta := map[string]any{
+			"operation": name,
+		}
+
+		if isFile {
+			filePathStr, ok := inputVal.(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "%v: file argument requires string path, got %T", name, inputVal), nil)
+			}
+
+			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("%v: %w", name, err), nil)
+			}
+			input = string(fileData)
+			meta["file_path"] = absPath
+			meta["file_size"] = int(size)
+		} else {
+			switch val := inputVal.(type) {
+			case map[string]any:
+				// Already parsed, return as-is
+				return val
+			case string:
+				input = val
+			case []byte:
+				input = string(val)
+			default:
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "%v: argument must be a string, got %T", name, val), nil)
+			}
+		}
+
+		result, err := parse(input)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("%v: %w", name, err), meta)
+		}
+
+		// Return the parsed object directly (not wrapped in _val/_meta), like json_parse
+		return result
+	})
+}
+
+// RegisterINIParse registers the ini_parse function with gojq
+func RegisterINIParse() gojq.CompilerOption {
+	return registerParser("ini_parse", ParseINI)
+}
+
+// RegisterPropertiesParse registers the properties_parse function with gojq
+func RegisterPropertiesParse() gojq.CompilerOption {
+	return registerParser("properties_parse", ParseProperties)
+}
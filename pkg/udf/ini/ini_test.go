@@ -0,0 +1,188 @@
+package ini
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+func TestParseINI(t *testing.T) {
+	input := "\ufeff; global settings\n" +
+		"name = demo\n" +
+		"\n" +
+		"[server]\n" +
+		"host = 0.0.0.0   ; bind address\n" +
+		"port: 8080\n" +
+		"# repeated keys collect into arrays\n" +
+		"allow = 10.0.0.1\n" +
+		"allow = 10.0.0.2\n" +
+		"allow = 10.0.0.3\n" +
+		"\n" +
+		"[server.tls]\n" +
+		"cert = \"/etc/ssl/a b.pem\"\n" +
+		"motd = 'hello ; world'\n" +
+		"url = http://example.com/#anchor\n" +
+		"\n" +
+		"[mysqld]\n" +
+		"skip-networking\n" +
+		"\n" +
+		"[empty]\n"
+
+	got, err := ParseINI(input)
+	if err != nil {
+		t.Fatalf("ParseINI failed: %v", err)
+	}
+	want := map[string]any{
+		"name": "demo",
+		"server": map[string]any{
+			"host":  "0.0.0.0",
+			"port":  "8080",
+			"allow": []any{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			"tls": map[string]any{
+				"cert": "/etc/ssl/a b.pem",
+				"motd": "hello ; world",
+				"url":  "http://example.com/#anchor",
+			},
+		},
+		"mysqld": map[string]any{"skip-networking": true},
+		"empty":  map[string]any{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseINI mismatch:\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestParseINIConflicts(t *testing.T) {
+	// A key that is later reused as a section keeps its value under _value
+	got, err := ParseINI("a = 1\n[a]\nb = 2\n[a]\nb = 3\n")
+	if err != nil {
+		t.Fatalf("ParseINI failed: %v", err)
+	}
+	want := map[string]any{
+		"a": map[string]any{"_value": "1", "b": []any{"2", "3"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseINI mismatch:\n got: %v\nwant: %v", got, want)
+	}
+
+	for _, input := range []string{"[broken\n", "[]\n", "= value\n"} {
+		if _, err := ParseINI(input); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	input := "# Spring config\n" +
+		"! another comment\n" +
+		"spring.datasource.url=jdbc:postgresql://localhost/db\n" +
+		"spring.datasource.username : admin\n" +
+		"logging.level=INFO\n" +
+		"logging.level.root=WARN\n" +
+		"greeting   Hello \\\n" +
+		"    World\n" +
+		"path=C:\\\\temp\\tnext\n" +
+		"unicode=caf\\u00e9\n" +
+		"key\\ with\\ spaces=v\n" +
+		"dup=1\n" +
+		"dup=2\n" +
+		"empty=\n"
+
+	got, err := ParseProperties(input)
+	if err != nil {
+		t.Fatalf("ParseProperties failed: %v", err)
+	}
+	want := map[string]any{
+		"spring": map[string]any{
+			"datasource": map[string]any{
+				"url":      "jdbc:postgresql://localhost/db",
+				"username": "admin",
+			},
+		},
+		"logging":         map[string]any{"level": map[string]any{"_value": "INFO", "root": "WARN"}},
+		"greeting":        "Hello World",
+		"path":            "C:\\temp\tnext",
+		"unicode":         "café",
+		"key with spaces": "v",
+		"dup":             []any{"1", "2"},
+		"empty":           "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseProperties mismatch:\n got: %v\nwant: %v", got, want)
+	}
+
+	if _, err := ParseProperties("bad=\\u12\n"); err == nil {
+		t.Error("Expected error for malformed unicode escape")
+	}
+}
+
+func TestINIParseUDF(t *testing.T) {
+	options := []gojq.CompilerOption{RegisterINIParse(), RegisterPropertiesParse()}
+
+	result := runGojqQuery(t, `ini_parse | .server.port`, "[server]\nport=80\n", options...)
+	if result != "80" {
+		t.Errorf("Expected 80, got %v", result)
+	}
+
+	result = runGojqQuery(t, `properties_parse | .a.b`, "a.b=c\n", options...)
+	if result != "c" {
+		t.Errorf("Expected c, got %v", result)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.ini")
+	if err := os.WriteFile(path, []byte("[db]\nuser=root\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result = runGojqQuery(t, `ini_parse(true) | .db.user`, path, options...)
+	if result != "root" {
+		t.Errorf("Expected root, got %v", result)
+	}
+	result = runGojqQuery(t, `ini_parse("`+path+`"; true) | .db.user`, nil, options...)
+	if result != "root" {
+		t.Errorf("Expected root, got %v", result)
+	}
+
+	result = runGojqQuery(t, `ini_parse`, "[broken\n", options...)
+	errStr := common.GetUDFError(result)
+	if !strings.HasPrefix(errStr, "ini_parse: line 1") {
+		t.Errorf("Expected line-numbered error, got %v", result)
+	}
+
+	result = runGojqQuery(t, `properties_parse`, 42, options...)
+	errStr = common.GetUDFError(result)
+	if !strings.Contains(errStr, "must be a string") {
+		t.Errorf("Expected type error, got %v", result)
+	}
+}
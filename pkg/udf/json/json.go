@@ -10,10 +10,10 @@ import (
 
 // RegisterJSONParse registers the json_parse function with gojq
 func RegisterJSONParse() gojq.CompilerOption {
-	return gojq.WithFunction("json_parse", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("json_parse", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("json_parse: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("json_parse: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -25,17 +25,17 @@ func RegisterJSONParse() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("json_parse: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "json_parse: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("json_parse: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("json_parse: %w", err), nil)
 			}
 
 			// Parse JSON from file
 			if err := json.Unmarshal(fileData, &result); err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("json_parse: invalid JSON in file: %v", err), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "json_parse: invalid JSON in file: %w", err), nil)
 			}
 			filePath = absPath
 			fileSize = size
@@ -48,18 +48,18 @@ func RegisterJSONParse() gojq.CompilerOption {
 			case string:
 				// Parse JSON string
 				if err := json.Unmarshal([]byte(val), &result); err != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("json_parse: invalid JSON: %v", err), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "json_parse: invalid JSON: %w", err), nil)
 				}
 			case []byte:
 				// Parse JSON bytes
 				if err := json.Unmarshal(val, &result); err != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("json_parse: invalid JSON: %v", err), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "json_parse: invalid JSON: %w", err), nil)
 				}
 			default:
 				// Try to convert to string and parse
 				if str, ok := val.(fmt.Stringer); ok {
 					if err := json.Unmarshal([]byte(str.String()), &result); err != nil {
-						return common.MakeUDFErrorResult(fmt.Errorf("json_parse: invalid JSON: %v", err), nil)
+						return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "json_parse: invalid JSON: %w", err), nil)
 					}
 				} else {
 					// If it's a simple type (number, bool, null), return as-is
@@ -85,10 +85,10 @@ func RegisterJSONParse() gojq.CompilerOption {
 
 // RegisterJSONStringify registers the json_stringify function with gojq
 func RegisterJSONStringify() gojq.CompilerOption {
-	return gojq.WithFunction("json_stringify", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("json_stringify", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("json_stringify: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("json_stringify: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -96,7 +96,7 @@ func RegisterJSONStringify() gojq.CompilerOption {
 		// Stringify the input value
 		jsonBytes, err := json.Marshal(inputVal)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("json_stringify: failed to marshal: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("json_stringify: failed to marshal: %w", err), nil)
 		}
 
 		result := string(jsonBytes)
@@ -0,0 +1,356 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itchyny/gojq"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// defaultTimeout bounds how long kafka_consume waits for messages
+const defaultTimeout = 10 * time.Second
+
+// commitTimeout bounds how long a group consumer waits to commit offsets
+const commitTimeout = 5 * time.Second
+
+// parseBrokers accepts a comma-separated string or an array of broker addresses,
+// each of which the sandbox policy must allow
+func parseBrokers(v any) ([]string, error) {
+	var brokers []string
+	switch val := common.ExtractUDFValue(v).(type) {
+	case string:
+		for _, b := range strings.Split(val, ",") {
+			if b = strings.TrimSpace(b); b != "" {
+				brokers = append(brokers, b)
+			}
+		}
+	case []any:
+		for i, item := range val {
+			b, ok := common.ExtractUDFValue(item).(string)
+			if !ok {
+				return nil, common.Errorf(common.CodeInvalid, "brokers[%d] must be a string, got %T", i, item)
+			}
+			brokers = append(brokers, b)
+		}
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "brokers must be a string or array of strings, got %T", val)
+	}
+	if len(brokers) == 0 {
+		return nil, common.Errorf(common.CodeInvalid, "at least one broker is required")
+	}
+	for _, b := range brokers {
+		if err := common.CheckNet(b); err != nil {
+			return nil, err
+		}
+	}
+	return brokers, nil
+}
+
+// encodeValue converts a jq value into message bytes. Strings are sent as-is,
+// everything else as JSON
+func encodeValue(v any) ([]byte, error) {
+	switch val := common.ExtractUDFValue(v).(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(val), nil
+	default:
+		return json.Marshal(val)
+	}
+}
+
+// messageToMap converts a consumed message into a jq object
+func messageToMap(m kafkago.Message) map[string]any {
+	headers := make(map[string]any, len(m.Headers))
+	for _, h := range m.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	var key any
+	if m.Key != nil {
+		key = string(m.Key)
+	}
+	return map[string]any{
+		"topic":     m.Topic,
+		"partition": m.Partition,
+		"offset":    int(m.Offset),
+		"key":       key,
+		"value":     string(m.Value),
+		"headers":   headers,
+		"time":      m.Time.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// RegisterKafkaProduce registers the kafka_produce function with gojq
+func RegisterKafkaProduce() gojq.CompilerOption {
+	return common.WithFunction("kafka_produce", 2, 3, common.Audited("kafka_produce", func(v any, args []any) any {
+		brokers, err := parseBrokers(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("kafka_produce: %w", err), nil)
+		}
+		topic, ok := common.ExtractUDFValue(args[1]).(string)
+		if !ok || topic == "" {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "kafka_produce: topic must be a non-empty string, got %T", common.ExtractUDFValue(args[1])), nil)
+		}
+
+		value, err := encodeValue(v)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("kafka_produce: failed to encode value: %w", err), nil)
+		}
+		msg := kafkago.Message{Value: value}
+		if len(args) > 2 {
+			if msg.Key, err = encodeValue(args[2]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("kafka_produce: failed to encode key: %w", err), nil)
+			}
+		}
+
+		meta := map[string]any{
+			"operation":    "kafka_produce",
+			"brokers":      strings.Join(brokers, ","),
+			"topic":        topic,
+			"value_length": len(value),
+		}
+
+		w := &kafkago.Writer{
+			Addr:         kafkago.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafkago.Hash{},
+			RequiredAcks: kafkago.RequireAll,
+			MaxAttempts:  3,
+		}
+		defer w.Close()
+
+		base, cancelBase := common.Context()
+		defer cancelBase()
+		ctx, cancel := context.WithTimeout(base, defaultTimeout)
+		defer cancel()
+		if err := w.WriteMessages(ctx, msg); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("kafka_produce: %w", err), meta)
+		}
+		return common.MakeUDFSuccessResult(topic, meta)
+	}))
+}
+
+// consumeOptions are the optional settings accepted by kafka_consume
+type consumeOptions struct {
+	group   string
+	latest  bool
+	timeout time.Duration
+}
+
+func parseConsumeOptions(v any) (consumeOptions, error) {
+	opts := consumeOptions{timeout: defaultTimeout}
+	m, ok := common.ExtractUDFValue(v).(map[string]any)
+	if !ok {
+		return opts, common.Errorf(common.CodeInvalid, "options must be an object, got %T", common.ExtractUDFValue(v))
+	}
+	if group, ok := m["group"].(string); ok {
+		opts.group = group
+	}
+	switch from := m["from"].(type) {
+	case nil:
+	case string:
+		switch from {
+		case "earliest":
+		case "latest":
+			opts.latest = true
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "from must be \"earliest\" or \"latest\", got %q", from)
+		}
+	default:
+		return opts, common.Errorf(common.CodeInvalid, "from must be a string, got %T", from)
+	}
+	switch timeout := m["timeout"].(type) {
+	case nil:
+	case int:
+		opts.timeout = time.Duration(timeout) * time.Second
+	case float64:
+		opts.timeout = time.Duration(timeout * float64(time.Second))
+	default:
+		return opts, common.Errorf(common.CodeInvalid, "timeout must be a number of seconds, got %T", timeout)
+	}
+	return opts, nil
+}
+
+// RegisterKafkaConsume registers the kafka_consume function with gojq
+func RegisterKafkaConsume() gojq.CompilerOption {
+	return common.WithFunction("kafka_consume", 3, 4, common.Audited("kafka_consume", func(v any, args []any) any {
+		brokers, err := parseBrokers(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("kafka_consume: %w", err), nil)
+		}
+		topic, ok := common.ExtractUDFValue(args[1]).(string)
+		if !ok || topic == "" {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "kafka_consume: topic must be a non-empty string, got %T", common.ExtractUDFValue(args[1])), nil)
+		}
+		var n int
+		switch count := common.ExtractUDFValue(args[2]).(type) {
+		case int:
+			n = count
+		case float64:
+			n = int(count)
+		default:
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "kafka_consume: n must be a number, got %T", count), nil)
+		}
+		if n <= 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "kafka_consume: n must be positive, got %d", n), nil)
+		}
+		opts := consumeOptions{timeout: defaultTimeout}
+		if len(args) > 3 {
+			if opts, err = parseConsumeOptions(args[3]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("kafka_consume: %w", err), nil)
+			}
+		}
+
+		meta := map[string]any{
+			"operation": "kafka_consume",
+			"brokers":   strings.Join(brokers, ","),
+			"topic":     topic,
+			"requested": n,
+		}
+		if opts.group != "" {
+			meta["group"] = opts.group
+		}
+
+		startOffset := kafkago.FirstOffset
+		if opts.latest {
+			startOffset = kafkago.LastOffset
+		}
+		base, cancelBase := common.Context()
+		defer cancelBase()
+		ctx, cancel := context.WithTimeout(base, opts.timeout)
+		defer cancel()
+
+		var messages []any
+		var readErr error
+		if opts.group != "" {
+			messages, readErr = consumeAll(ctx, []kafkago.ReaderConfig{{
+				Brokers:     brokers,
+				Topic:       topic,
+				GroupID:     opts.group,
+				StartOffset: startOffset,
+			}}, n)
+		} else {
+			// Without a group, read every partition of the topic directly
+			partitions, err := kafkago.DefaultDialer.LookupPartitions(ctx, "tcp", brokers[0], topic)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("kafka_consume: %w", err), meta)
+			}
+			meta["partitions"] = len(partitions)
+			configs := make([]kafkago.ReaderConfig, len(partitions))
+			for i, p := range partitions {
+				configs[i] = kafkago.ReaderConfig{
+					Brokers:     brokers,
+					Topic:       topic,
+					Partition:   p.ID,
+					StartOffset: startOffset,
+				}
+			}
+			messages, readErr = consumeAll(ctx, configs, n)
+		}
+		if messages == nil {
+			messages = []any{}
+		}
+		meta["count"] = len(messages)
+
+		// Hitting the timeout with fewer than n messages is a short sample, not
+		// an error, unless it was the run or --udf-timeout that ran out
+		if readErr != nil && (!errors.Is(readErr, context.DeadlineExceeded) || base.Err() != nil) {
+			return common.MakeUDFErrorResult(fmt.Errorf("kafka_consume: %w", readErr), meta)
+		}
+		return common.MakeUDFSuccessResult(messages, meta)
+	}))
+}
+
+// consumeAll reads from every reader concurrently, so an idle partition does
+// not starve the others, and stops once n messages have arrived. Messages are
+// fetched without committing; a group reader commits only the messages that
+// are returned, so the ones left over on a timeout are delivered again
+func consumeAll(ctx context.Context, configs []kafkago.ReaderConfig, n int) ([]any, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	readers := make([]*kafkago.Reader, len(configs))
+	for i, cfg := range configs {
+		readers[i] = kafkago.NewReader(cfg)
+	}
+	defer func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}()
+
+	type result struct {
+		reader *kafkago.Reader
+		msg    kafkago.Message
+		err    error
+	}
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for _, r := range readers {
+		wg.Add(1)
+		go func(r *kafkago.Reader) {
+			defer wg.Done()
+			for {
+				m, err := r.FetchMessage(ctx)
+				select {
+				case results <- result{r, m, err}:
+				case <-ctx.Done():
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(r)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var messages []any
+	emitted := map[*kafkago.Reader][]kafkago.Message{}
+	var firstErr error
+	for res := range results {
+		if len(messages) >= n {
+			continue // drain so the readers can exit
+		}
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+		messages = append(messages, messageToMap(res.msg))
+		emitted[res.reader] = append(emitted[res.reader], res.msg)
+		if len(messages) >= n {
+			cancel()
+		}
+	}
+
+	// The read context may have expired, so commit with a fresh one
+	commitCtx, commitCancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer commitCancel()
+	for r, msgs := range emitted {
+		if r.Config().GroupID == "" {
+			continue
+		}
+		if err := r.CommitMessages(commitCtx, msgs...); err != nil {
+			return messages, fmt.Errorf("failed to commit offsets: %w", err)
+		}
+	}
+	if len(messages) >= n {
+		return messages, nil
+	}
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return messages, firstErr
+}
@@ -0,0 +1,148 @@
+package kafka
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+// closedAddr returns an address on which nothing is listening
+func closedAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestKafkaArgumentErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		err   string
+	}{
+		{"produce empty brokers", `kafka_produce(""; "t")`, "at least one broker"},
+		{"produce bad brokers", `kafka_produce(1; "t")`, "brokers must be"},
+		{"produce empty topic", `kafka_produce("b:9092"; "")`, "topic must be"},
+		{"consume bad n", `kafka_consume("b:9092"; "t"; "x")`, "n must be a number"},
+		{"consume zero n", `kafka_consume("b:9092"; "t"; 0)`, "n must be positive"},
+		{"consume bad from", `kafka_consume("b:9092"; "t"; 1; {from: "middle"})`, "from must be"},
+		{"consume bad timeout", `kafka_consume("b:9092"; "t"; 1; {timeout: "1s"})`, "timeout must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runGojqQuery(t, tt.query, "v", RegisterKafkaProduce(), RegisterKafkaConsume())
+			errStr := common.GetUDFError(result)
+			if !strings.Contains(errStr, tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, result)
+			}
+		})
+	}
+}
+
+func TestKafkaConsumeUnreachable(t *testing.T) {
+	addr := closedAddr(t)
+	start := time.Now()
+	result := runGojqQuery(t, `kafka_consume("`+addr+`"; "events"; 5; {timeout: 2})`, nil, RegisterKafkaConsume())
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Consume should respect the timeout, took %v", time.Since(start))
+	}
+	resultMap := result.(map[string]any)
+	if resultMap["_err"] == nil {
+		t.Fatal("Expected error for an unreachable broker")
+	}
+	meta := resultMap["_meta"].(map[string]any)
+	if meta["topic"] != "events" || meta["brokers"] != addr {
+		t.Errorf("Expected topic and brokers in metadata, got %v", meta)
+	}
+}
+
+func TestParseBrokers(t *testing.T) {
+	brokers, err := parseBrokers("a:9092, b:9092,")
+	if err != nil || len(brokers) != 2 || brokers[1] != "b:9092" {
+		t.Errorf("Unexpected brokers %v (%v)", brokers, err)
+	}
+	brokers, err = parseBrokers([]any{"a:9092", "b:9092"})
+	if err != nil || len(brokers) != 2 {
+		t.Errorf("Unexpected brokers %v (%v)", brokers, err)
+	}
+	if _, err := parseBrokers([]any{1}); err == nil {
+		t.Error("Expected error for non-string broker")
+	}
+}
+
+func TestEncodeValue(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{"raw text", "raw text"},
+		{map[string]any{"a": 1}, `{"a":1}`},
+		{[]any{1, "x"}, `[1,"x"]`},
+		{map[string]any{"_val": "inner", "_meta": map[string]any{}}, "inner"},
+	}
+	for _, tt := range tests {
+		got, err := encodeValue(tt.in)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("encodeValue(%v) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMessageToMap(t *testing.T) {
+	m := messageToMap(kafkago.Message{
+		Topic:     "events",
+		Partition: 2,
+		Offset:    42,
+		Key:       []byte("k"),
+		Value:     []byte(`{"a":1}`),
+		Headers:   []kafkago.Header{{Key: "source", Value: []byte("test")}},
+		Time:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	if m["offset"] != 42 || m["partition"] != 2 || m["key"] != "k" || m["value"] != `{"a":1}` {
+		t.Errorf("Unexpected message map %v", m)
+	}
+	if m["headers"].(map[string]any)["source"] != "test" {
+		t.Errorf("Expected headers to be decoded, got %v", m["headers"])
+	}
+	if m["time"] != "2024-01-02T03:04:05Z" {
+		t.Errorf("Unexpected time %v", m["time"])
+	}
+	if messageToMap(kafkago.Message{})["key"] != nil {
+		t.Error("Expected null key for a keyless message")
+	}
+}
@@ -0,0 +1,272 @@
+package lang
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// maxRunes bounds how much of the input is examined
+const maxRunes = 20000
+
+// language describes a language written in a script shared with others,
+// recognized by its most frequent words and its letters
+type language struct {
+	code      string
+	words     string // frequent words, space separated
+	hints     string // letters typical of the language
+	forbidden string // letters the language does not use
+	wordSet   map[string]bool
+}
+
+var latin = []*language{
+	{code: "en", words: "the and of to in is that it was for on are with as be this have from by not but what all were when we there can an which their has had if you they will would been more who its about out them than"},
+	{code: "de", words: "der die und das ist nicht zu den von mit sich des auf für im dem ein eine auch es als nach wie aus bei sind wird noch nur oder aber hat werden über ich sie wir", hints: "ßäöü"},
+	{code: "fr", words: "le la les de des et est un une du en que qui dans pour pas sur au avec ce il elle ne se plus par sont mais nous vous ou ces été être cette aux", hints: "éèêàçœëîôù"},
+	{code: "es", words: "el la los las de del y que en un una es por con para no se lo al como más pero sus le ya fue este ha sí porque esta entre cuando muy sin sobre también", hints: "ñ¿¡áíóú"},
+	{code: "it", words: "il lo la gli le di del della che e è un una per non con sono da dei nel alla si come ma anche più questo ha ci ho nella delle essere", hints: "àèìòù"},
+	{code: "pt", words: "o a os as de do da dos das e que em um uma é para com não por se mais como mas foi ao ele ela seu sua ou são está isso também muito", hints: "ãõçáâêô"},
+	{code: "nl", words: "de het een en van is dat in op te niet met zijn voor ook er aan om als maar door bij dit die wat nog wordt naar kan hij ze we zo"},
+	{code: "sv", words: "och att det som en på är av för med till den har inte om ett de var jag sig men så från vid eller kan man när hade också", hints: "åäö", forbidden: "æø"},
+	{code: "da", words: "og at det er en til på som med af for ikke den har de jeg var et sig men så fra kan være vil om eller også blev hvad mig efter nu", hints: "æøå", forbidden: "äö"},
+	{code: "no", words: "og i det som er en på til av for med at ikke den har de jeg var et seg men så fra kan være vil om eller også ble hva meg etter nå", hints: "æøå", forbidden: "äö"},
+	{code: "fi", words: "ja on ei se että oli ovat mutta kun tai myös hän joka sen kuin niin ole olla mitä vain jo nyt tämä ne siitä voi ollut sitä", hints: "äö", forbidden: "å"},
+	{code: "pl", words: "i w na z się nie do to jest że o a jak po co tak za od ale czy przez dla jego jej są może być tylko już go", hints: "ąęłńśźż"},
+	{code: "cs", words: "a se na je v že to s z do o jako by pro ale jsou tak po byl jeho které není jsem už také jen k od při být", hints: "řěůčšž"},
+	{code: "hu", words: "a az és hogy nem is egy van meg de ez csak ha már mint volt el kell még azt vagy ki lesz amely sem pedig szerint", hints: "őű"},
+	{code: "ro", words: "și în de la a cu că nu pe din se o un care este mai pentru sau ce să fost au sunt dar lui ca fi acest", hints: "ășțşţ"},
+	{code: "tr", words: "ve bir bu da de için ile çok ne olarak daha gibi olan ama en kadar sonra var değil ben sen o ki mi her şey", hints: "ğışİ"},
+	{code: "id", words: "yang dan di ini itu dengan untuk dari tidak dalam akan pada juga ke ada oleh karena saya kami mereka bisa sudah adalah atau"},
+	{code: "vi", words: "là và của có không được cho với những các một người này trong đã để khi cũng như thì từ về", hints: "ăđơưạảấầẩẫậắằẳẵặẹẻẽếềểễệỉịọỏốồổỗộớờởỡợụủứừửữựỳỵỷỹ"},
+}
+
+var cyrillic = []*language{
+	{code: "ru", words: "и в не на что с он как это по но к из у за то так же от все она был для его мы вы они было бы ты только когда уже если или", hints: "ыэё", forbidden: "іїєґ"},
+	{code: "uk", words: "і в не на що з він як це по але до із у за та так від все вона був для його ми ви вони було б ти тільки коли вже якщо або", hints: "іїєґ", forbidden: "ыэёъ"},
+	{code: "bg", words: "и в не на че с той като това по но да за от се е са във със ще беше много има няма тя те ние вие след при които този", hints: "ъ", forbidden: "ыэёіїє"},
+}
+
+func init() {
+	for _, l := range append(append([]*language{}, latin...), cyrillic...) {
+		l.wordSet = map[string]bool{}
+		for _, w := range strings.Fields(l.words) {
+			l.wordSet[w] = true
+		}
+	}
+}
+
+// scriptLanguages maps scripts that are (nearly) always one language to it
+var scriptLanguages = map[string]string{
+	"Hangul":     "ko",
+	"Greek":      "el",
+	"Hebrew":     "he",
+	"Thai":       "th",
+	"Devanagari": "hi",
+	"Bengali":    "bn",
+	"Tamil":      "ta",
+	"Telugu":     "te",
+	"Gujarati":   "gu",
+	"Gurmukhi":   "pa",
+	"Kannada":    "kn",
+	"Malayalam":  "ml",
+	"Georgian":   "ka",
+	"Armenian":   "hy",
+	"Khmer":      "km",
+	"Lao":        "lo",
+	"Myanmar":    "my",
+	"Sinhala":    "si",
+	"Ethiopic":   "am",
+}
+
+// scripts that are checked for every letter, most common first
+var scriptOrder = []string{"Latin", "Cyrillic", "Han", "Hiragana", "Katakana", "Hangul", "Arabic", "Greek", "Hebrew", "Thai", "Devanagari", "Bengali", "Tamil", "Telugu", "Gujarati", "Gurmukhi", "Kannada", "Malayalam", "Georgian", "Armenian", "Khmer", "Lao", "Myanmar", "Sinhala", "Ethiopic"}
+
+func scriptOf(r rune) string {
+	for _, name := range scriptOrder {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Candidate is a possible language of a text with a confidence from 0 to 1
+type Candidate struct {
+	Lang       string
+	Confidence float64
+}
+
+// Detect returns the likely languages of text, best first, and the script
+// the text is mostly written in. It is empty when there is too little text
+// to tell
+func Detect(text string) ([]Candidate, string) {
+	counts := map[string]int{}
+	letters := 0
+	var sample []rune
+	for _, r := range text {
+		if len(sample) >= maxRunes {
+			break
+		}
+		sample = append(sample, r)
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if s := scriptOf(r); s != "" {
+			counts[s]++
+		}
+	}
+	if letters == 0 {
+		return nil, ""
+	}
+
+	// Kana and Han are counted together, since Japanese mixes them
+	cjk := counts["Han"] + counts["Hiragana"] + counts["Katakana"]
+	script, best := "", 0
+	for _, name := range scriptOrder {
+		n := counts[name]
+		if name == "Han" || name == "Hiragana" || name == "Katakana" {
+			n = cjk
+		}
+		if n > best {
+			script, best = name, n
+		}
+	}
+	if script == "" {
+		return nil, ""
+	}
+	share := float64(best) / float64(letters)
+
+	switch script {
+	case "Han", "Hiragana", "Katakana":
+		// Any amount of kana means Japanese; Chinese does not use them
+		if kana := counts["Hiragana"] + counts["Katakana"]; kana*20 >= cjk {
+			return []Candidate{{"ja", share}}, "Han"
+		}
+		return []Candidate{{"zh", share}}, "Han"
+	case "Arabic":
+		return []Candidate{{arabicLanguage(sample), share}}, script
+	case "Latin":
+		return scoreWords(sample, latin, share), script
+	case "Cyrillic":
+		return scoreWords(sample, cyrillic, share), script
+	}
+	return []Candidate{{scriptLanguages[script], share}}, script
+}
+
+// arabicLanguage tells Persian and Urdu from Arabic by the letters they add
+func arabicLanguage(sample []rune) string {
+	for _, r := range sample {
+		switch r {
+		case 'ٹ', 'ڈ', 'ڑ', 'ں', 'ے', 'ھ':
+			return "ur"
+		}
+	}
+	for _, r := range sample {
+		switch r {
+		case 'پ', 'چ', 'ژ', 'گ', 'ک', 'ی':
+			return "fa"
+		}
+	}
+	return "ar"
+}
+
+// scoreWords scores each language by its frequent words and letters
+func scoreWords(sample []rune, langs []*language, share float64) []Candidate {
+	lower := strings.ToLower(string(sample))
+	scores := make([]float64, len(langs))
+	for _, word := range strings.FieldsFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for i, l := range langs {
+			if l.wordSet[word] {
+				scores[i]++
+			}
+		}
+	}
+	for _, r := range lower {
+		if r < 0x80 {
+			continue
+		}
+		for i, l := range langs {
+			if strings.ContainsRune(l.hints, r) {
+				scores[i] += 0.5
+			}
+			if strings.ContainsRune(l.forbidden, r) {
+				scores[i]--
+			}
+		}
+	}
+
+	var total, best float64
+	for _, s := range scores {
+		if s > 0 {
+			total += s
+			best = max(best, s)
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	// Few matching words are weak evidence
+	evidence := min(best/5, 1)
+
+	var candidates []Candidate
+	for i, s := range scores {
+		if s > 0 {
+			candidates = append(candidates, Candidate{langs[i].code, s / total * evidence * share})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+	return candidates
+}
+
+// RegisterLangDetect registers the lang_detect function with gojq
+func RegisterLangDetect() gojq.CompilerOption {
+	return common.WithFunction("lang_detect", 0, 1, func(v any, args []any) any {
+		inputVal := v
+		if len(args) > 0 {
+			inputVal = args[0]
+		}
+		var input string
+		switch val := common.ExtractUDFValue(inputVal).(type) {
+		case string:
+			input = val
+		case []byte:
+			input = string(val)
+		default:
+			if str, ok := val.(fmt.Stringer); ok {
+				input = str.String()
+			} else {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "lang_detect: input must be a string, got %T", val), nil)
+			}
+		}
+
+		candidates, script := Detect(input)
+		list := make([]any, 0, 3)
+		for i, c := range candidates {
+			if i == 3 {
+				break
+			}
+			list = append(list, map[string]any{"lang": c.Lang, "confidence": c.Confidence})
+		}
+		meta := map[string]any{
+			"operation":  "lang_detect",
+			"script":     nil,
+			"confidence": 0.0,
+			"candidates": list,
+		}
+		if script != "" {
+			meta["script"] = script
+		}
+		if len(candidates) == 0 {
+			return common.MakeUDFSuccessResult(nil, meta)
+		}
+		meta["confidence"] = candidates[0].Confidence
+		return common.MakeUDFSuccessResult(candidates[0].Lang, meta)
+	})
+}
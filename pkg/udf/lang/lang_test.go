@@ -0,0 +1,121 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		want string
+		text string
+	}{
+		{"en", "Your account has been suspended. Please verify your details within 24 hours, or we will close it."},
+		{"de", "Ihr Konto wurde gesperrt. Bitte bestätigen Sie Ihre Daten, sonst wird es nach drei Tagen gelöscht und ist nicht mehr verfügbar."},
+		{"fr", "Votre compte a été suspendu. Merci de confirmer vos informations dans les 24 heures pour éviter la fermeture."},
+		{"es", "Su cuenta ha sido suspendida. Por favor, confirme sus datos en las próximas 24 horas para que no se cierre."},
+		{"it", "Il tuo account è stato sospeso. Per favore conferma i tuoi dati entro 24 ore, altrimenti non sarà più disponibile."},
+		{"pt", "A sua conta foi suspensa. Por favor, confirme os seus dados em 24 horas para que não seja encerrada."},
+		{"nl", "Uw account is geblokkeerd. Bevestig uw gegevens binnen 24 uur, anders wordt het niet meer mogelijk om in te loggen."},
+		{"sv", "Ditt konto har spärrats. Bekräfta dina uppgifter inom 24 timmar, annars kommer det att stängas och det går inte att logga in."},
+		{"da", "Din konto er blevet spærret. Bekræft dine oplysninger inden for 24 timer, ellers vil den blive lukket, og det er ikke muligt at logge ind."},
+		{"no", "Kontoen din er sperret. Bekreft opplysningene dine innen 24 timer, ellers vil den bli stengt, og det er ikke mulig å logge inn etter det."},
+		{"fi", "Tilisi on suljettu. Vahvista tietosi 24 tunnin kuluessa, tai tili poistetaan eikä sitä voi enää käyttää."},
+		{"pl", "Twoje konto zostało zablokowane. Potwierdź swoje dane w ciągu 24 godzin, bo nie będzie można się zalogować."},
+		{"cs", "Váš účet byl zablokován. Potvrďte prosím své údaje do 24 hodin, jinak už se nebude možné přihlásit a účet bude zrušen."},
+		{"hu", "A fiókját zároltuk. Kérjük, erősítse meg az adatait 24 órán belül, különben nem lesz lehetőség a belépésre."},
+		{"ro", "Contul dumneavoastră a fost suspendat. Vă rugăm să confirmați datele în 24 de ore, altfel nu mai este posibilă conectarea."},
+		{"tr", "Hesabınız askıya alındı. Lütfen bilgilerinizi 24 saat içinde onaylayın, aksi takdirde hesap kapatılacak ve bu işlem geri alınamaz."},
+		{"id", "Akun Anda telah ditangguhkan. Silakan konfirmasi data Anda dalam 24 jam agar akun tidak ditutup oleh sistem kami."},
+		{"vi", "Tài khoản của bạn đã bị khóa. Vui lòng xác nhận thông tin trong 24 giờ để không bị xóa vĩnh viễn."},
+		{"ru", "Ваш аккаунт был заблокирован. Пожалуйста, подтвердите данные в течение суток, иначе он будет удалён, и вы не сможете войти."},
+		{"uk", "Ваш обліковий запис було заблоковано. Будь ласка, підтвердіть дані протягом доби, інакше його буде видалено, і ви не зможете увійти."},
+		{"bg", "Вашият акаунт беше блокиран. Моля, потвърдете данните си в рамките на 24 часа, иначе той ще бъде изтрит и няма да можете да влезете."},
+		{"ja", "お客様のアカウントは停止されました。24時間以内に情報を確認してください。"},
+		{"zh", "您的账户已被暂停。请在24小时内确认您的信息，否则账户将被关闭。"},
+		{"ko", "귀하의 계정이 정지되었습니다. 24시간 이내에 정보를 확인해 주세요."},
+		{"el", "Ο λογαριασμός σας έχει ανασταλεί. Παρακαλούμε επιβεβαιώστε τα στοιχεία σας."},
+		{"he", "החשבון שלך הושעה. אנא אשר את הפרטים שלך תוך 24 שעות."},
+		{"ar", "تم تعليق حسابك. يرجى تأكيد بياناتك خلال 24 ساعة."},
+		{"fa", "حساب شما مسدود شده است. لطفا اطلاعات خود را ظرف ۲۴ ساعت تایید کنید."},
+		{"th", "บัญชีของคุณถูกระงับ กรุณายืนยันข้อมูลของคุณภายใน 24 ชั่วโมง"},
+		{"hi", "आपका खाता निलंबित कर दिया गया है। कृपया 24 घंटे के भीतर अपनी जानकारी की पुष्टि करें।"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			candidates, _ := Detect(tt.text)
+			if len(candidates) == 0 || candidates[0].Lang != tt.want {
+				t.Errorf("Detect = %+v, want %s first", candidates, tt.want)
+			}
+		})
+	}
+
+	for _, text := range []string{"", "12345 !!", "xyzzy"} {
+		if candidates, _ := Detect(text); len(candidates) != 0 {
+			t.Errorf("Detect(%q) = %+v, want no candidates", text, candidates)
+		}
+	}
+}
+
+func TestLangDetectUDF(t *testing.T) {
+	text := "The quick brown fox jumps over the lazy dog, and then it runs away from the farm."
+	result := runGojqQuery(t, `lang_detect`, text, RegisterLangDetect())
+	got := result.(map[string]any)
+	if got["_val"] != "en" {
+		t.Errorf("Expected en, got %v", result)
+	}
+	meta := got["_meta"].(map[string]any)
+	if meta["script"] != "Latin" {
+		t.Errorf("Expected Latin script, got %v", meta)
+	}
+	if conf, _ := meta["confidence"].(float64); conf < 0.5 || conf > 1 {
+		t.Errorf("Expected a confident detection, got %v", meta)
+	}
+
+	// A few words give less confidence than a sentence
+	short := runGojqQuery(t, `lang_detect("the end") | ._meta.confidence`, nil, RegisterLangDetect())
+	if short.(float64) >= meta["confidence"].(float64) {
+		t.Errorf("Expected lower confidence for short text, got %v", short)
+	}
+
+	result = runGojqQuery(t, `lang_detect`, "42", RegisterLangDetect())
+	if got := result.(map[string]any); got["_val"] != nil || got["_meta"].(map[string]any)["script"] != nil {
+		t.Errorf("Expected null language, got %v", result)
+	}
+
+	result = runGojqQuery(t, `lang_detect`, 42, RegisterLangDetect())
+	obj, _ := result.(map[string]any)
+	if errStr := common.GetUDFError(obj); !strings.HasPrefix(errStr, "lang_detect: input must be a string") {
+		t.Errorf("Expected input error, got %v", result)
+	}
+}
@@ -0,0 +1,327 @@
+package udf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// Diagnostic is a problem Lint found in a query
+type Diagnostic struct {
+	Severity string `json:"severity"` // "error" or "warning"
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Function string `json:"function,omitempty"` // the function the problem is about
+}
+
+// deprecatedFuncs are jq functions that are deprecated, with what to use
+// instead
+var deprecatedFuncs = map[string]string{
+	"leaf_paths":   "paths(scalars)",
+	"recurse_down": "recurse",
+}
+
+// valueFuncs are jq builtins that work on strings or numbers, and so on
+// nothing useful when given a UDF result object
+var valueFuncs = map[string]bool{
+	"ascii_downcase": true, "ascii_upcase": true, "explode": true, "fromjson": true,
+	"ltrimstr": true, "rtrimstr": true, "startswith": true, "endswith": true,
+	"test": true, "match": true, "capture": true, "scan": true, "splits": true,
+	"sub": true, "gsub": true, "tonumber": true, "utf8bytelength": true,
+	"ltrim": true, "rtrim": true, "fromdate": true, "todate": true,
+	"floor": true, "ceil": true, "round": true, "sqrt": true, "fabs": true,
+}
+
+// envelopeKeys are the keys of a UDF result
+var envelopeKeys = map[string]bool{"_schema": true, "_val": true, "_meta": true, "_err": true}
+
+// Lint looks for mistakes in a query that compiling it does not catch, or
+// reports badly: UDFs called with the wrong number of arguments, deprecated
+// functions, and UDF results used as if they were their _val
+func Lint(query *gojq.Query) []Diagnostic {
+	metadata := map[string]FunctionMetadata{}
+	for _, m := range GetFunctionMetadata() {
+		metadata[m.Name] = m
+	}
+	// Functions the query defines hide UDFs and builtins of the same arity
+	defined := map[string]bool{}
+	eachQuery(query, func(q *gojq.Query) {
+		for _, fd := range q.FuncDefs {
+			defined[fmt.Sprintf("%s/%d", fd.Name, len(fd.Args))] = true
+			for _, arg := range fd.Args {
+				defined[arg+"/0"] = true
+			}
+		}
+	})
+	isUDF := func(f *gojq.Func) bool {
+		m, ok := metadata[f.Name]
+		return ok && len(f.Args) >= m.MinArgs && len(f.Args) <= m.MaxArgs &&
+			!defined[fmt.Sprintf("%s/%d", f.Name, len(f.Args))]
+	}
+
+	var diags []Diagnostic
+	seen := map[Diagnostic]bool{}
+	report := func(d Diagnostic) {
+		if !seen[d] {
+			seen[d] = true
+			diags = append(diags, d)
+		}
+	}
+	missingVal := func(udf, use string) {
+		report(Diagnostic{"warning", "missing-val", fmt.Sprintf(
+			"%s returns an object with _val, _meta and _err; add | ._val before %s", udf, use), udf})
+	}
+
+	eachQuery(query, func(q *gojq.Query) {
+		if t := q.Term; t != nil && t.Func != nil && !strings.HasPrefix(t.Func.Name, "$") {
+			f := t.Func
+			arity := len(f.Args)
+			if m, ok := metadata[f.Name]; ok && !defined[fmt.Sprintf("%s/%d", f.Name, arity)] &&
+				(arity < m.MinArgs || arity > m.MaxArgs) {
+				report(Diagnostic{"error", "arity", fmt.Sprintf("%s takes %s, got %d",
+					f.Name, argCount(m.MinArgs, m.MaxArgs), arity), f.Name})
+			}
+			if use, ok := deprecatedFuncs[f.Name]; ok && !defined[fmt.Sprintf("%s/%d", f.Name, arity)] {
+				report(Diagnostic{"warning", "deprecated", fmt.Sprintf(
+					"%s is deprecated in jq and not supported; use %s", f.Name, use), f.Name})
+			}
+			// A field other than those of a result, right on the call
+			if isUDF(f) && len(t.SuffixList) > 0 && t.SuffixList[0].Index != nil {
+				if name := t.SuffixList[0].Index.Name; name != "" && !envelopeKeys[name] {
+					missingVal(f.Name, "."+name)
+				}
+			}
+		}
+		if t := q.Term; t != nil && t.Str != nil {
+			for _, part := range t.Str.Queries {
+				if f := resultFunc(part, isUDF); f != "" {
+					missingVal(f, "using it in a string")
+				}
+			}
+		}
+		switch q.Op {
+		case gojq.OpPipe:
+			if f := resultFunc(q.Left, isUDF); f != "" {
+				if use := valueUse(q.Right, isUDF); use != "" {
+					missingVal(f, use)
+				}
+			}
+		case gojq.OpAdd, gojq.OpEq, gojq.OpNe, gojq.OpLt, gojq.OpGt, gojq.OpLe, gojq.OpGe:
+			// Comparing or adding a result to a literal
+			for _, side := range [][2]*gojq.Query{{q.Left, q.Right}, {q.Right, q.Left}} {
+				if f := resultFunc(side[0], isUDF); f != "" && isLiteral(side[1]) {
+					missingVal(f, fmt.Sprintf("using %s on it", q.Op))
+				}
+			}
+		}
+	})
+	return diags
+}
+
+// resultFunc returns the UDF whose result q outputs as is, or ""
+func resultFunc(q *gojq.Query, isUDF func(*gojq.Func) bool) string {
+	if q == nil {
+		return ""
+	}
+	if q.Op == gojq.OpPipe {
+		return resultFunc(q.Right, isUDF)
+	}
+	t := q.Term
+	if q.Op != 0 || t == nil || len(t.SuffixList) > 0 || len(q.Patterns) > 0 {
+		return ""
+	}
+	if t.Query != nil {
+		return resultFunc(t.Query, isUDF)
+	}
+	if t.Func != nil && isUDF(t.Func) {
+		return t.Func.Name
+	}
+	return ""
+}
+
+// valueUse describes how q uses its input as a plain value, like .name or
+// ascii_downcase, or returns "" when it does not
+func valueUse(q *gojq.Query, isUDF func(*gojq.Func) bool) string {
+	if q == nil {
+		return ""
+	}
+	if q.Op == gojq.OpPipe {
+		return valueUse(q.Left, isUDF)
+	}
+	t := q.Term
+	if q.Op != 0 || t == nil {
+		return ""
+	}
+	switch {
+	case t.Index != nil && t.Index.Name != "" && !envelopeKeys[t.Index.Name]:
+		return "." + t.Index.Name
+	case t.Func != nil && valueFuncs[t.Func.Name] && !isUDF(t.Func):
+		return t.Func.Name
+	case t.Format != "" && t.Str == nil:
+		return t.Format
+	}
+	return ""
+}
+
+func isLiteral(q *gojq.Query) bool {
+	if q == nil || q.Op != 0 || q.Term == nil || len(q.Term.SuffixList) > 0 {
+		return false
+	}
+	t := q.Term
+	return t.Number != "" || (t.Str != nil && t.Str.Queries == nil && t.Format == "")
+}
+
+func argCount(min, max int) string {
+	switch {
+	case min == max && min == 1:
+		return "1 argument"
+	case min == max:
+		return fmt.Sprintf("%d arguments", min)
+	}
+	return fmt.Sprintf("%d to %d arguments", min, max)
+}
+
+// eachQuery calls f on q and every query nested in it
+func eachQuery(q *gojq.Query, f func(*gojq.Query)) {
+	if q == nil {
+		return
+	}
+	f(q)
+	for _, fd := range q.FuncDefs {
+		eachQuery(fd.Body, f)
+	}
+	eachTermQuery(q.Term, f)
+	eachQuery(q.Left, f)
+	eachQuery(q.Right, f)
+	for _, p := range q.Patterns {
+		eachPatternQuery(p, f)
+	}
+}
+
+func eachTermQuery(t *gojq.Term, f func(*gojq.Query)) {
+	if t == nil {
+		return
+	}
+	eachIndexQuery(t.Index, f)
+	if t.Func != nil {
+		for _, arg := range t.Func.Args {
+			eachQuery(arg, f)
+		}
+	}
+	if t.Object != nil {
+		for _, kv := range t.Object.KeyVals {
+			eachStringQuery(kv.KeyString, f)
+			eachQuery(kv.KeyQuery, f)
+			eachQuery(kv.Val, f)
+		}
+	}
+	if t.Array != nil {
+		eachQuery(t.Array.Query, f)
+	}
+	if t.Unary != nil {
+		eachTermQuery(t.Unary.Term, f)
+	}
+	eachStringQuery(t.Str, f)
+	if t.If != nil {
+		eachQuery(t.If.Cond, f)
+		eachQuery(t.If.Then, f)
+		for _, elif := range t.If.Elif {
+			eachQuery(elif.Cond, f)
+			eachQuery(elif.Then, f)
+		}
+		eachQuery(t.If.Else, f)
+	}
+	if t.Try != nil {
+		eachQuery(t.Try.Body, f)
+		eachQuery(t.Try.Catch, f)
+	}
+	if t.Reduce != nil {
+		eachQuery(t.Reduce.Query, f)
+		eachPatternQuery(t.Reduce.Pattern, f)
+		eachQuery(t.Reduce.Start, f)
+		eachQuery(t.Reduce.Update, f)
+	}
+	if t.Foreach != nil {
+		eachQuery(t.Foreach.Query, f)
+		eachPatternQuery(t.Foreach.Pattern, f)
+		eachQuery(t.Foreach.Start, f)
+		eachQuery(t.Foreach.Update, f)
+		eachQuery(t.Foreach.Extract, f)
+	}
+	if t.Label != nil {
+		eachQuery(t.Label.Body, f)
+	}
+	eachQuery(t.Query, f)
+	for _, suffix := range t.SuffixList {
+		eachIndexQuery(suffix.Index, f)
+	}
+}
+
+func eachIndexQuery(index *gojq.Index, f func(*gojq.Query)) {
+	if index != nil {
+		eachStringQuery(index.Str, f)
+		eachQuery(index.Start, f)
+		eachQuery(index.End, f)
+	}
+}
+
+func eachStringQuery(s *gojq.String, f func(*gojq.Query)) {
+	if s != nil {
+		for _, q := range s.Queries {
+			eachQuery(q, f)
+		}
+	}
+}
+
+func eachPatternQuery(p *gojq.Pattern, f func(*gojq.Query)) {
+	if p == nil {
+		return
+	}
+	for _, e := range p.Array {
+		eachPatternQuery(e, f)
+	}
+	for _, kv := range p.Object {
+		eachStringQuery(kv.KeyString, f)
+		eachQuery(kv.KeyQuery, f)
+		eachPatternQuery(kv.Val, f)
+	}
+}
+
+// SuggestFunction returns the UDF whose name is closest to name, for
+// messages about misspelt functions, or "" when none is close
+func SuggestFunction(name string) string {
+	best, bestDist := "", min(2, len(name)/2)+1
+	for _, m := range GetFunctionMetadata() {
+		if d := editDistance(name, m.Name); d < bestDist {
+			best, bestDist = m.Name, d
+		}
+	}
+	return best
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps
+// of adjacent letters that turn a into b
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
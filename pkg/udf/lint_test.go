@@ -0,0 +1,63 @@
+package udf
+
+import (
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		query string
+		codes []string
+	}{
+		{`md5 | ._val | ascii_downcase`, nil},
+		{`.[] | sha256(true) | ._val`, nil},
+		{`md5 | ascii_downcase`, []string{"missing-val"}},
+		{`md5 | .hash`, []string{"missing-val"}},
+		{`sha256.hex`, []string{"missing-val"}},
+		{`(.a | md5) == "abc"`, []string{"missing-val"}},
+		{`"hash: \(md5)"`, []string{"missing-val"}},
+		{`md5 | @base64`, []string{"missing-val"}},
+		// UDFs take results as they are
+		{`upper | md5 | ._val`, nil},
+		{`md5(1; 2; 3)`, []string{"arity"}},
+		{`leaf_paths`, []string{"deprecated"}},
+		// A definition hides the UDF
+		{`def md5: "x"; md5 | ascii_downcase`, nil},
+		{`def md5(a; b; c): a; md5(1; 2; 3)`, nil},
+		{`if . then md5(1; 2; 3) | .x else empty end`, []string{"arity"}},
+	}
+	for _, tt := range tests {
+		query, err := gojq.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		var codes []string
+		for _, d := range Lint(query) {
+			codes = append(codes, d.Code)
+		}
+		if len(codes) != len(tt.codes) {
+			t.Errorf("Lint(%s) = %v, want %v", tt.query, Lint(query), tt.codes)
+			continue
+		}
+		for i := range codes {
+			if codes[i] != tt.codes[i] {
+				t.Errorf("Lint(%s) = %v, want %v", tt.query, Lint(query), tt.codes)
+			}
+		}
+	}
+}
+
+func TestSuggestFunction(t *testing.T) {
+	for name, want := range map[string]string{
+		"sha265":   "sha256",
+		"md4":      "md5",
+		"http_get": "",
+		"x":        "",
+	} {
+		if got := SuggestFunction(name); got != want {
+			t.Errorf("SuggestFunction(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// Options are the settings accepted by md_to_html and md_parse
+type Options struct {
+	File       bool // input is a file path
+	GFM        bool // tables, strikethrough, autolinks and task lists
+	Unsafe     bool // keep raw HTML instead of replacing it with a comment
+	HardWraps  bool // render soft line breaks as <br>
+	HeadingIDs bool // add id attributes to headings
+}
+
+func parseOptions(m map[string]any) (Options, error) {
+	opts := Options{GFM: true}
+	for key, raw := range m {
+		b, ok := raw.(bool)
+		if !ok {
+			return opts, common.Errorf(common.CodeInvalid, "option %v must be a boolean, got %T", key, raw)
+		}
+		switch key {
+		case "file":
+			opts.File = b
+		case "gfm":
+			opts.GFM = b
+		case "unsafe":
+			opts.Unsafe = b
+		case "hard_wraps":
+			opts.HardWraps = b
+		case "heading_ids":
+			opts.HeadingIDs = b
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+func newMarkdown(opts Options) goldmark.Markdown {
+	var exts []goldmark.Extender
+	if opts.GFM {
+		exts = append(exts, extension.GFM)
+	}
+	var parserOpts []parser.Option
+	if opts.HeadingIDs {
+		parserOpts = append(parserOpts, parser.WithAutoHeadingID())
+	}
+	var htmlOpts []renderer.Option
+	if opts.Unsafe {
+		htmlOpts = append(htmlOpts, html.WithUnsafe())
+	}
+	if opts.HardWraps {
+		htmlOpts = append(htmlOpts, html.WithHardWraps())
+	}
+	return goldmark.New(
+		goldmark.WithExtensions(exts...),
+		goldmark.WithParserOptions(parserOpts...),
+		goldmark.WithRendererOptions(htmlOpts...),
+	)
+}
+
+// readInput parses the arguments shared by both functions: an optional
+// input and either the file flag or an options object
+func readInput(name string, v any, args []any) ([]byte, Options, map[string]any, error) {
+	opts := Options{GFM: true}
+	if n := len(args); n > 0 {
+		if m, ok := args[n-1].(map[string]any); ok && !common.IsUDFResult(m) {
+			var err error
+			if opts, err = parseOptions(m); err != nil {
+				return nil, opts, nil, fmt.Errorf("%v: %w", name, err)
+			}
+			args = args[:n-1]
+		}
+	}
+	inputVal, isFile, err := common.ParseFileArgs(v, args)
+	if err != nil {
+		return nil, opts, nil, fmt.Errorf("%v: %w", name, err)
+	}
+	opts.File = opts.File || isFile
+	inputVal = common.ExtractUDFValue(inputVal)
+
+	meta := map[string]any{}
+	if opts.File {
+		filePathStr, ok := inputVal.(string)
+		if !ok {
+			return nil, opts, nil, common.Errorf(common.CodeInvalid, "%v: file argument requires string path, got %T", name, inputVal)
+		}
+		fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
+		if err != nil {
+			return nil, opts, nil, fmt.Errorf("%v: %w", name, err)
+		}
+		meta["file_path"] = absPath
+		meta["file_size"] = size
+		return fileData, opts, meta, nil
+	}
+
+	switch val := inputVal.(type) {
+	case string:
+		return []byte(val), opts, meta, nil
+	case []byte:
+		return val, opts, meta, nil
+	default:
+		if str, ok := val.(fmt.Stringer); ok {
+			return []byte(str.String()), opts, meta, nil
+		}
+		return nil, opts, nil, common.Errorf(common.CodeInvalid, "%v: argument must be a string, got %T", name, val)
+	}
+}
+
+// RegisterMDToHTML registers the md_to_html function with gojq
+func RegisterMDToHTML() gojq.CompilerOption {
+	return common.WithFunction("md_to_html", 0, 3, func(v any, args []any) any {
+		source, opts, meta, err := readInput("md_to_html", v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		var buf bytes.Buffer
+		if err := newMarkdown(opts).Convert(source, &buf); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("md_to_html: %w", err), nil)
+		}
+
+		meta["operation"] = "md_to_html"
+		meta["input_length"] = len(source)
+		meta["output_length"] = buf.Len()
+		return common.MakeUDFSuccessResult(buf.String(), meta)
+	})
+}
+
+// RegisterMDParse registers the md_parse function with gojq
+func RegisterMDParse() gojq.CompilerOption {
+	return common.WithFunction("md_parse", 0, 3, func(v any, args []any) any {
+		source, opts, _, err := readInput("md_parse", v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		doc := newMarkdown(opts).Parser().Parse(text.NewReader(source))
+		// Return the tree directly (not wrapped in _val/_meta), like json_parse
+		return (&converter{source: source}).node(doc)
+	})
+}
+
+// converter turns a goldmark AST into jq values
+type converter struct {
+	source []byte
+}
+
+// node converts n and its children. Every node has a snake_case "type";
+// block nodes also carry the 1-based "line" where they start
+func (c *converter) node(n ast.Node) map[string]any {
+	obj := map[string]any{"type": snakeCase(n.Kind().String())}
+	if n.Type() == ast.TypeBlock && n.Lines().Len() > 0 {
+		obj["line"] = bytes.Count(c.source[:n.Lines().At(0).Start], []byte{'\n'}) + 1
+	}
+
+	switch node := n.(type) {
+	case *ast.Heading:
+		obj["level"] = node.Level
+		obj["text"] = c.plainText(node)
+		if id, ok := node.AttributeString("id"); ok {
+			obj["id"] = string(id.([]byte))
+		}
+	case *ast.TextBlock:
+		// Paragraphs in tight lists; they render the same way
+		obj["type"] = "paragraph"
+	case *ast.FencedCodeBlock:
+		obj["language"] = nil
+		if lang := node.Language(c.source); lang != nil {
+			obj["language"] = string(lang)
+		}
+		obj["text"] = c.lines(node)
+		return obj
+	case *ast.CodeBlock:
+		obj["text"] = c.lines(node)
+		return obj
+	case *ast.HTMLBlock:
+		html := c.lines(node)
+		if node.HasClosure() {
+			html += string(node.ClosureLine.Value(c.source))
+		}
+		obj["text"] = html
+		return obj
+	case *ast.List:
+		obj["ordered"] = node.IsOrdered()
+		obj["tight"] = node.IsTight
+		if node.IsOrdered() {
+			obj["start"] = node.Start
+		}
+	case *ast.Emphasis:
+		obj["level"] = node.Level
+	case *ast.Link:
+		obj["destination"] = string(node.Destination)
+		obj["title"] = string(node.Title)
+	case *ast.Image:
+		obj["destination"] = string(node.Destination)
+		obj["title"] = string(node.Title)
+		obj["alt"] = c.plainText(node)
+		return obj
+	case *ast.AutoLink:
+		obj["url"] = string(node.URL(c.source))
+		return obj
+	case *ast.Text:
+		obj["text"] = string(node.Segment.Value(c.source))
+		switch {
+		case node.HardLineBreak():
+			obj["break"] = "hard"
+		case node.SoftLineBreak():
+			obj["break"] = "soft"
+		}
+		return obj
+	case *ast.String:
+		obj["type"] = "text"
+		obj["text"] = string(node.Value)
+		return obj
+	case *ast.CodeSpan:
+		obj["text"] = c.plainText(node)
+		return obj
+	case *ast.RawHTML:
+		var sb strings.Builder
+		for i := 0; i < node.Segments.Len(); i++ {
+			seg := node.Segments.At(i)
+			sb.Write(seg.Value(c.source))
+		}
+		obj["text"] = sb.String()
+		return obj
+	case *east.Table:
+		aligns := make([]any, len(node.Alignments))
+		for i, a := range node.Alignments {
+			aligns[i] = a.String()
+		}
+		obj["alignments"] = aligns
+	case *east.TableCell:
+		obj["align"] = node.Alignment.String()
+	case *east.TaskCheckBox:
+		obj["checked"] = node.IsChecked
+		return obj
+	}
+
+	children := []any{}
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		children = append(children, c.node(child))
+	}
+	obj["children"] = children
+	return obj
+}
+
+// lines returns the raw source lines of a code or HTML block
+func (c *converter) lines(n ast.Node) string {
+	var sb strings.Builder
+	for i := 0; i < n.Lines().Len(); i++ {
+		seg := n.Lines().At(i)
+		sb.Write(seg.Value(c.source))
+	}
+	return sb.String()
+}
+
+// plainText concatenates the text of all inline descendants
+func (c *converter) plainText(n ast.Node) string {
+	var sb strings.Builder
+	ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := child.(type) {
+		case *ast.Text:
+			sb.Write(t.Segment.Value(c.source))
+			if t.SoftLineBreak() || t.HardLineBreak() {
+				sb.WriteByte(' ')
+			}
+		case *ast.String:
+			sb.Write(t.Value)
+		case *ast.AutoLink:
+			sb.Write(t.Label(c.source))
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(sb.String())
+}
+
+// snakeCase converts a goldmark kind such as "FencedCodeBlock" to
+// "fenced_code_block"
+func snakeCase(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			// Keep acronyms together: "HTMLBlock" becomes "html_block"
+			if i > 0 && (!unicode.IsUpper(rune(name[i-1])) || (i+1 < len(name) && unicode.IsLower(rune(name[i+1])))) {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,189 @@
+package markdown
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+var mdOpts = []gojq.CompilerOption{RegisterMDToHTML(), RegisterMDParse()}
+
+func TestMDToHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		input string
+		want  string
+	}{
+		{"heading", `md_to_html`, "# Hi *there*", "<h1>Hi <em>there</em></h1>\n"},
+		{"gfm table", `md_to_html`, "| a |\n|---|\n| 1 |", "<table>\n<thead>\n<tr>\n<th>a</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td>1</td>\n</tr>\n</tbody>\n</table>\n"},
+		{"strikethrough", `md_to_html`, "~~x~~", "<p><del>x</del></p>\n"},
+		{"without gfm", `md_to_html({gfm: false})`, "~~x~~", "<p>~~x~~</p>\n"},
+		{"raw html omitted", `md_to_html`, "<b>x</b>", "<p><!-- raw HTML omitted -->x<!-- raw HTML omitted --></p>\n"},
+		{"unsafe", `md_to_html({unsafe: true})`, "<b>x</b>", "<p><b>x</b></p>\n"},
+		{"hard wraps", `md_to_html({hard_wraps: true})`, "a\nb", "<p>a<br>\nb</p>\n"},
+		{"heading ids", `md_to_html({heading_ids: true})`, "## Getting Started", "<h2 id=\"getting-started\">Getting Started</h2>\n"},
+		{"input argument", `md_to_html("*x*")`, "", "<p><em>x</em></p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query+` | ._val`, tt.input, mdOpts...)
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	result := runGojqQuery(t, `md_to_html`, "# x", mdOpts...)
+	meta := result.(map[string]any)["_meta"].(map[string]any)
+	if meta["operation"] != "md_to_html" || meta["input_length"] != 3 || meta["output_length"] != 11 {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+}
+
+func TestMDToHTMLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "README.md")
+	if err := os.WriteFile(path, []byte("# Title\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{`md_to_html(true)`, `md_to_html(.; true)`, `md_to_html({file: true})`} {
+		result := runGojqQuery(t, query, path, mdOpts...)
+		got := result.(map[string]any)
+		if got["_val"] != "<h1>Title</h1>\n" || got["_meta"].(map[string]any)["file_path"] != path {
+			t.Errorf("%s: unexpected result %v", query, got)
+		}
+	}
+
+	result := runGojqQuery(t, `md_parse(true) | .children[0].text`, path, mdOpts...)
+	if result != "Title" {
+		t.Errorf("Expected Title, got %v", result)
+	}
+}
+
+func TestMDParse(t *testing.T) {
+	doc := "# Intro *now*\n\nSee [docs](https://x.dev \"Docs\") and `code`.\n\n" +
+		"- [x] done\n- todo\n\n```go\nfmt.Println()\n```\n\n| a | b |\n|:--|--:|\n| 1 | 2 |\n"
+
+	result := runGojqQuery(t, `md_parse`, doc, mdOpts...)
+	root := result.(map[string]any)
+	if root["type"] != "document" {
+		t.Fatalf("Expected document root, got %v", root["type"])
+	}
+	children := root["children"].([]any)
+	if len(children) != 5 {
+		t.Fatalf("Expected 5 blocks, got %d: %v", len(children), children)
+	}
+
+	heading := children[0].(map[string]any)
+	if heading["type"] != "heading" || heading["level"] != 1 || heading["text"] != "Intro now" || heading["line"] != 1 {
+		t.Errorf("Unexpected heading %v", heading)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  any
+	}{
+		{"block types", `md_parse | .children | map(.type)`, []any{"heading", "paragraph", "list", "fenced_code_block", "table"}},
+		{"link", `md_parse | [.. | objects | select(.type == "link")][0] | {destination, title}`, map[string]any{"destination": "https://x.dev", "title": "Docs"}},
+		{"code span", `md_parse | [.. | objects | select(.type == "code_span") | .text]`, []any{"code"}},
+		{"list", `md_parse | .children[2] | {ordered, tight}`, map[string]any{"ordered": false, "tight": true}},
+		{"task", `md_parse | [.. | objects | select(.type == "task_check_box") | .checked]`, []any{true}},
+		{"code block", `md_parse | .children[3] | {language, text, line}`, map[string]any{"language": "go", "text": "fmt.Println()\n", "line": 9}},
+		{"table", `md_parse | .children[4].alignments`, []any{"left", "right"}},
+		{"table cells", `md_parse | [.children[4] | .. | objects | select(.type == "table_cell") | .children[0].text]`, []any{"a", "b", "1", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query, doc, mdOpts...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMDParseInline(t *testing.T) {
+	got := runGojqQuery(t, `md_parse | .children[0].children`, "a  \n![pic *1*](p.png) <https://x.dev> <i>", mdOpts...)
+	want := []any{
+		map[string]any{"type": "text", "text": "a", "break": "hard"},
+		map[string]any{"type": "image", "destination": "p.png", "title": "", "alt": "pic 1"},
+		map[string]any{"type": "text", "text": " "},
+		map[string]any{"type": "auto_link", "url": "https://x.dev"},
+		map[string]any{"type": "text", "text": " "},
+		map[string]any{"type": "raw_html", "text": "<i>"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inline mismatch:\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestKindName(t *testing.T) {
+	tests := map[string]string{
+		"Document":        "document",
+		"FencedCodeBlock": "fenced_code_block",
+		"HTMLBlock":       "html_block",
+		"RawHTML":         "raw_html",
+		"TaskCheckBox":    "task_check_box",
+	}
+	for kind, want := range tests {
+		if got := snakeCase(kind); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", kind, got, want)
+		}
+	}
+}
+
+func TestMDErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`md_to_html`, 5, "md_to_html: argument must be a string"},
+		{`md_to_html({gfm: 1})`, "", "md_to_html: option gfm must be a boolean"},
+		{`md_to_html({bogus: true})`, "", `md_to_html: unknown option "bogus"`},
+		{`md_to_html(true)`, "/nonexistent/README.md", "md_to_html: file does not exist"},
+		{`md_parse`, nil, "md_parse: argument must be a string"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, mdOpts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
@@ -2,124 +2,292 @@ package udf
 
 // FunctionMetadata holds information about a UDF
 type FunctionMetadata struct {
-	Name        string
-	MinArgs     int
-	MaxArgs     int
-	Description string
-	Category    string
-	Examples    []string
+	Name        string   `json:"name"`
+	MinArgs     int      `json:"min_args"`
+	MaxArgs     int      `json:"max_args"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Examples    []string `json:"examples"`
+	// Input is the type the function reads from its input, and Output the
+	// type of the _val of its results: a jq type name like "string", or ""
+	// when it varies or isn't used
+	Input  string `json:"input,omitempty"`
+	Output string `json:"output,omitempty"`
+}
+
+// extraMetadata describes functions registered outside DefaultRegistry
+var extraMetadata []FunctionMetadata
+
+// SetExtraFunctionMetadata sets the functions registered outside
+// DefaultRegistry, such as those of plugins, that GetFunctionMetadata
+// lists after the built-in ones
+func SetExtraFunctionMetadata(m []FunctionMetadata) {
+	extraMetadata = m
+}
+
+// impureCategories are the categories of the UDFs PureRegistry leaves out,
+// with what they need
+var impureCategories = map[string]string{
+	"File Operations": "filesystem",
+	"HTTP":            "network",
+	"Network":         "network",
+	"System":          "system",
+}
+
+// PureFunctionMetadata returns metadata for the functions PureRegistry
+// registers
+func PureFunctionMetadata() []FunctionMetadata {
+	var pure []FunctionMetadata
+	for _, m := range GetFunctionMetadata() {
+		if impureCategories[m.Category] == "" {
+			pure = append(pure, m)
+		}
+	}
+	return pure
+}
+
+// FunctionCapability tells whether a UDF is in PureRegistry, and if not,
+// what it needs: "filesystem", "network", or "system" for programs, the
+// environment and standard input
+type FunctionCapability struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Pure     bool   `json:"pure"`
+	Needs    string `json:"needs,omitempty"`
+}
+
+// FunctionCapabilities returns the capabilities of all registered
+// functions, in the order of GetFunctionMetadata
+func FunctionCapabilities() []FunctionCapability {
+	metadata := GetFunctionMetadata()
+	capabilities := make([]FunctionCapability, len(metadata))
+	for i, m := range metadata {
+		needs := impureCategories[m.Category]
+		capabilities[i] = FunctionCapability{Name: m.Name, Category: m.Category, Pure: needs == "", Needs: needs}
+	}
+	return capabilities
 }
 
 // GetFunctionMetadata returns metadata for all registered functions
 func GetFunctionMetadata() []FunctionMetadata {
-	return []FunctionMetadata{
+	return append([]FunctionMetadata{
 		// File operations
-		{"find", 1, 2, "Find files/directories matching criteria", "File Operations", []string{`find("path"; "file")`, `find("path"; "dir")`}},
-		{"cat", 0, 1, "Read and return contents of a file (filepath from pipe or argument)", "File Operations", []string{`cat("file.txt")`, `"file.txt" | cat`, `find("."; "file") | cat`}},
-		{"mkdir", 1, 1, "Create a directory (creates parent directories if needed)", "File Operations", []string{`mkdir("/tmp/mydir")`, `mkdir("nested/path/to/dir")`}},
-		{"rm", 2, 2, "Remove a file or folder (path, type: 'file' or 'folder')", "File Operations", []string{`rm("/tmp/file.txt"; "file")`, `rm("/tmp/mydir"; "folder")`}},
+		{"find", 1, 2, "Find files/directories matching criteria (type, depth, size, mtime, name, regex)", "File Operations", []string{`find("path"; "file")`, `find("path"; "dir")`, `find("path"; {"name": "*.go", "min_size": "1k", "newer": "24h"})`}, "", "string"},
+		{"glob", 0, 2, "Yield paths matching a glob pattern with ** and {a,b} (pattern, [{type, hidden}])", "File Operations", []string{`glob("**/*.go")`, `glob("src/**/*.{js,ts}"; {type: "file"})`, `glob("logs/*.log") | grep("ERROR")`}, "", "string"},
+		{"watch", 1, 2, "Yield create/modify/delete/rename events on a file or directory (path, [count, duration or {count, duration, recursive, events}])", "File Operations", []string{`watch("incoming"; 10)`, `watch("src"; "5m")`, `watch("inbox"; {recursive: true, events: ["create"]}) | ._val | cat`}, "", "string"},
+		{"grep", 1, 3, "Search lines of a file or directory tree, yielding {file, lineno, line, match} (pattern, [path], [{recursive, ignore_case, flags, fixed, invert, context, before, after, max_count, binary, include, exclude}])", "File Operations", []string{`"app.log" | grep("ERROR")`, `grep("TODO"; "src"; {recursive: true, include: "*.go"})`, `find("."; "file") | grep("password"; .; {ignore_case: true})`}, "string", "object"},
+		{"sed", 2, 4, "Replace regex matches line by line in a file, returning the changed lines (pattern, replacement, [path], [{flags, fixed, global, dry_run, backup}])", "File Operations", []string{`"app.conf" | sed("^port=.*"; "port=8080")`, `sed("debug=true"; "debug=false"; "app.conf"; {dry_run: true})`, `find("etc"; "file") | sed("old.example.com"; "new.example.com"; .; {fixed: true, backup: ".orig"})`}, "string", "array"},
+		{"cat", 0, 2, "Read and return contents of a file (filepath from pipe or argument) as text, base64 or bytes", "File Operations", []string{`cat("file.txt")`, `"file.txt" | cat`, `find("."; "file") | cat`, `cat("image.png"; "bytes") | sha256`}, "string", "string"},
+		{"mkdir", 1, 1, "Create a directory (creates parent directories if needed)", "File Operations", []string{`mkdir("/tmp/mydir")`, `mkdir("nested/path/to/dir")`}, "", "string"},
+		{"rm", 2, 2, "Remove a file or folder (path, type: 'file' or 'folder')", "File Operations", []string{`rm("/tmp/file.txt"; "file")`, `rm("/tmp/mydir"; "folder")`}, "", "string"},
+		{"write_file", 1, 2, "Write the input to a file, atomically replacing it (path, [mode: 'write', 'append' or 'create']); strings are written as-is, other values (bytes arrays included) as JSON; use tee's bytes format for binary", "File Operations", []string{`"hello" | write_file("/tmp/out.txt")`, `.[] | write_file("events.jsonl"; "append")`, `{a: 1} | write_file("config.json"; "create")`}, "", "string"},
+		{"touch", 1, 2, "Create an empty file or update its times (path, [{time, atime, mtime, no_create}])", "File Operations", []string{`touch("/tmp/stamp")`, `touch("build.ok"; {time: "2024-01-01T00:00:00Z"})`}, "", "string"},
+		{"chmod", 2, 2, "Change file permissions (path, mode: octal like 755 or \"0644\", or symbolic like \"u+x,go-w\")", "File Operations", []string{`chmod("run.sh"; 755)`, `chmod("secret.key"; "go-rwx")`}, "", "string"},
+		{"chown", 3, 3, "Change file owner and group (path, user, group: IDs or names, null to leave unchanged)", "File Operations", []string{`chown("data"; "www-data"; "www-data")`, `chown("data"; 1000; null)`}, "", "string"},
+		{"symlink", 2, 2, "Create a symbolic link (target, link); the target is stored as given", "File Operations", []string{`symlink("app-1.2"; "/opt/app")`, `symlink("../lib/libfoo.so.1"; "lib/libfoo.so")`}, "", "string"},
+		{"readlink", 0, 1, "Read the target of a symbolic link (path from pipe or argument)", "File Operations", []string{`readlink("/usr/bin/python3")`, `find("/etc/systemd"; "file") | ._val | readlink`}, "string", "string"},
+		{"resolve", 0, 1, "Follow every symbolic link in a path, with the chain of hops and loop detection", "File Operations", []string{`resolve("/usr/bin/java")`, `resolve("~/.config/autostart/x.desktop") | ._meta.chain`}, "string", "string"},
 		
 		// Encoding/Decoding
-		{"base64_encode", 0, 2, "Encode to base64 (optional file arg)", "Encoding", []string{`base64_encode`, `base64_encode(true)`}},
-		{"base64_decode", 0, 2, "Decode from base64 (optional file arg)", "Encoding", []string{`base64_decode`, `base64_decode(true)`}},
-		{"hex_encode", 0, 2, "Encode to hexadecimal (optional file arg)", "Encoding", []string{`hex_encode`, `hex_encode(true)`}},
-		{"hex_decode", 0, 2, "Decode from hexadecimal (optional file arg)", "Encoding", []string{`hex_decode`, `hex_decode(true)`}},
-		{"base32_encode", 0, 2, "Encode to base32 (optional file arg)", "Encoding", []string{`base32_encode`, `base32_encode(true)`}},
-		{"base32_decode", 0, 2, "Decode from base32 (optional file arg)", "Encoding", []string{`base32_decode`, `base32_decode(true)`}},
-		{"base85_encode", 0, 2, "Encode to base85 (optional file arg)", "Encoding", []string{`base85_encode`, `base85_encode(true)`}},
-		{"base85_decode", 0, 2, "Decode from base85 (optional file arg)", "Encoding", []string{`base85_decode`, `base85_decode(true)`}},
-		{"binary_encode", 0, 2, "Encode to binary (optional file arg)", "Encoding", []string{`binary_encode`, `binary_encode(true)`}},
-		{"binary_decode", 0, 2, "Decode from binary (optional file arg)", "Encoding", []string{`binary_decode`, `binary_decode(true)`}},
-		{"url_encode", 0, 2, "URL encode (optional file arg)", "Encoding", []string{`url_encode`, `url_encode(true)`}},
-		{"url_decode", 0, 2, "URL decode (optional file arg)", "Encoding", []string{`url_decode`, `url_decode(true)`}},
-		{"html_encode", 0, 2, "HTML entity encode (optional file arg)", "Encoding", []string{`html_encode`, `html_encode(true)`}},
-		{"html_decode", 0, 2, "HTML entity decode (optional file arg)", "Encoding", []string{`html_decode`, `html_decode(true)`}},
+		{"base64_encode", 0, 2, "Encode to base64 (optional file arg)", "Encoding", []string{`base64_encode`, `base64_encode(true)`}, "string", "string"},
+		{"base64_decode", 0, 2, "Decode from base64 (optional file arg)", "Encoding", []string{`base64_decode`, `base64_decode(true)`}, "string", "string"},
+		{"hex_encode", 0, 2, "Encode to hexadecimal (optional file arg)", "Encoding", []string{`hex_encode`, `hex_encode(true)`}, "string", "string"},
+		{"hex_decode", 0, 2, "Decode from hexadecimal (optional file arg)", "Encoding", []string{`hex_decode`, `hex_decode(true)`}, "string", "string"},
+		{"base32_encode", 0, 2, "Encode to base32 (optional file arg)", "Encoding", []string{`base32_encode`, `base32_encode(true)`}, "string", "string"},
+		{"base32_decode", 0, 2, "Decode from base32 (optional file arg)", "Encoding", []string{`base32_decode`, `base32_decode(true)`}, "string", "string"},
+		{"base85_encode", 0, 2, "Encode to base85 (optional file arg)", "Encoding", []string{`base85_encode`, `base85_encode(true)`}, "string", "string"},
+		{"base85_decode", 0, 2, "Decode from base85 (optional file arg)", "Encoding", []string{`base85_decode`, `base85_decode(true)`}, "string", "string"},
+		{"binary_encode", 0, 2, "Encode to binary (optional file arg)", "Encoding", []string{`binary_encode`, `binary_encode(true)`}, "string", "string"},
+		{"binary_decode", 0, 2, "Decode from binary (optional file arg)", "Encoding", []string{`binary_decode`, `binary_decode(true)`}, "string", "string"},
+		{"url_encode", 0, 2, "URL encode (optional file arg)", "Encoding", []string{`url_encode`, `url_encode(true)`}, "string", "string"},
+		{"url_decode", 0, 2, "URL decode (optional file arg)", "Encoding", []string{`url_decode`, `url_decode(true)`}, "string", "string"},
+		{"html_encode", 0, 2, "HTML entity encode (optional file arg)", "Encoding", []string{`html_encode`, `html_encode(true)`}, "string", "string"},
+		{"html_decode", 0, 2, "HTML entity decode (optional file arg)", "Encoding", []string{`html_decode`, `html_decode(true)`}, "string", "string"},
+		{"charset_detect", 0, 2, "Detect the character set of text or a file: UTF-8/16/32, Shift_JIS, EUC-JP, GB18030, Big5, EUC-KR, windows-1251, KOI8-R, windows-1252 (optional file arg)", "Encoding", []string{`charset_detect`, `charset_detect(true)`, `"legacy.log" | charset_detect(true) | ._val`}, "string", "string"},
+		{"iconv", 2, 3, "Convert text between character sets; from may be \"auto\" ([{file, invalid: error|replace|skip}])", "Encoding", []string{`iconv("Shift_JIS"; "UTF-8")`, `iconv("auto"; "UTF-8"; {file: true})`, `iconv("UTF-8"; "windows-1252"; {invalid: "replace"})`}, "string", "string"},
+		{"base_convert", 2, 3, "Convert an integer between bases 2 to 62 (from 0 detects 0x/0b/0o prefixes)", "Encoding", []string{`"ff" | base_convert(16; 10)`, `base_convert("0x1f"; 0; 2)`, `3232235777 | base_convert(10; 16)`}, "", "string"},
+		{"struct_unpack", 1, 2, "Unpack binary data with a Python struct layout ([{offset, names, repeat, file}])", "Encoding", []string{`struct_unpack("<4sHHI")`, `struct_unpack(">I4sII"; {offset: 8, names: ["length", "type", "width", "height"]})`, `"records.bin" | struct_unpack("<IH"; {file: true, repeat: true})`}, "string", ""},
+		{"struct_pack", 1, 2, "Pack an array (or object with names) into binary data with a Python struct layout ([{names, repeat}])", "Encoding", []string{`[13, "IHDR"] | struct_pack(">I4s")`, `{a: 1, b: 2} | struct_pack("<HH"; {names: ["a", "b"]})`}, "", "string"},
+		{"bytes_to_int", 1, 2, "Read a string of bytes as a big or little endian integer (optional signed)", "Encoding", []string{`"\u0001\u0002" | bytes_to_int("big")`, `hex_decode | bytes_to_int("little"; true)`}, "string", "number"},
+		{"int_to_bytes", 2, 2, "Write an integer as a string of bytes of the given width and endianness", "Encoding", []string{`258 | int_to_bytes(4; "big")`, `-2 | int_to_bytes(2; "little") | ._val | hex_encode`}, "number", "string"},
+		{"bswap", 0, 1, "Reverse the bytes of a string, or of an integer of the given width", "Encoding", []string{`bswap`, `305419896 | bswap(4)`}, "", ""},
+		
+		// Bitwise
+		{"band", 1, 1, "Bitwise AND of numbers or hex strings", "Bitwise", []string{`12 | band(10)`, `"0xab" | band("0x0f")`}, "", ""},
+		{"bor", 1, 1, "Bitwise OR of numbers or hex strings", "Bitwise", []string{`12 | bor(3)`, `"00ff" | bor("0100")`}, "", ""},
+		{"bxor", 1, 1, "Bitwise XOR of numbers or hex strings", "Bitwise", []string{`12 | bxor(10)`, `"0b1100" | bxor("0b0110")`}, "", ""},
+		{"bnot", 0, 1, "Bitwise NOT; hex strings flip their digits, numbers need a bit width or give -(n+1)", "Bitwise", []string{`5 | bnot(8)`, `"0x00f0" | bnot`}, "", ""},
+		{"shl", 1, 1, "Shift left by n bits", "Bitwise", []string{`1 | shl(4)`, `"0xff" | shl(8)`}, "", ""},
+		{"shr", 1, 1, "Shift right by n bits", "Bitwise", []string{`256 | shr(4)`, `"0xff00" | shr(8)`}, "", ""},
+		{"popcount", 0, 0, "Count the set bits of a number or hex string", "Bitwise", []string{`255 | popcount`, `"0xf0f0" | popcount`}, "", "number"},
+		{"float_bits", 0, 1, "IEEE 754 bits of a number as hex, with sign, exponent and mantissa (width 32 or 64)", "Bitwise", []string{`1.5 | float_bits`, `0.1 | float_bits(32)`}, "number", "string"},
+		{"bits_float", 0, 1, "Number from IEEE 754 bits given as an integer or hex string (width 32 or 64)", "Bitwise", []string{`"0x3fc00000" | bits_float(32)`, `"3ff8000000000000" | bits_float`}, "", "number"},
+		
+		// Identifiers
+		{"uuid", 0, 1, "Generate a random v4 or time-ordered v7 UUID", "Identifiers", []string{`uuid`, `uuid(7)`}, "", "string"},
+		{"uuid_parse", 0, 1, "Parse a UUID: version, variant, and time, clock sequence and node for v1/v6/v7", "Identifiers", []string{`uuid_parse`, `uuid_parse("017f22e2-79b0-7cc3-98c4-dc0c0c07398f") | ._val.time`}, "string", "object"},
+		{"ulid", 0, 0, "Generate a ULID", "Identifiers", []string{`ulid`}, "", "string"},
+		{"ulid_parse", 0, 1, "Parse a ULID into its time and randomness", "Identifiers", []string{`ulid_parse`, `ulid_parse("01ARZ3NDEKTSV4RRFFQ69G5FAV") | ._val.time`}, "string", "object"},
+		
+		// Random data
+		{"random_bytes", 1, 2, "Generate n cryptographically random bytes, as hex, base64, base64url, base32 or raw", "Random", []string{`random_bytes(32)`, `random_bytes(12; "base64")`}, "", "string"},
+		{"random_string", 1, 2, "Generate a random string of n characters from a named charset or the given characters", "Random", []string{`random_string(16)`, `random_string(6; "digits")`, `random_string(8; "ACGT")`}, "", "string"},
+		{"random_int", 2, 2, "Generate a random integer from min to max, both included", "Random", []string{`random_int(1; 6)`}, "", "number"},
+		{"fake", 1, 2, "Generate fake test data of a kind (name, email, ipv4, credit_card, address, sentence, person, ...), optionally from a seed", "Random", []string{`fake("name")`, `fake("email"; {seed: 42})`, `.email |= fake("email"; {seed: .})._val`}, "", ""},
 		
 		// Compression
-		{"gzip_compress", 0, 2, "Compress with gzip (optional file arg)", "Compression", []string{`gzip_compress`, `gzip_compress(true)`}},
-		{"gzip_decompress", 0, 2, "Decompress gzip (optional file arg)", "Compression", []string{`gzip_decompress`, `gzip_decompress(true)`}},
-		{"zlib_compress", 0, 2, "Compress with zlib (optional file arg)", "Compression", []string{`zlib_compress`, `zlib_compress(true)`}},
-		{"zlib_decompress", 0, 2, "Decompress zlib (optional file arg)", "Compression", []string{`zlib_decompress`, `zlib_decompress(true)`}},
-		{"deflate_compress", 0, 2, "Compress with deflate (optional file arg)", "Compression", []string{`deflate_compress`, `deflate_compress(true)`}},
-		{"deflate_decompress", 0, 2, "Decompress deflate (optional file arg)", "Compression", []string{`deflate_decompress`, `deflate_decompress(true)`}},
+		{"gzip_compress", 0, 2, "Compress with gzip (optional file arg)", "Compression", []string{`gzip_compress`, `gzip_compress(true)`}, "string", "string"},
+		{"gzip_decompress", 0, 2, "Decompress gzip (optional file arg)", "Compression", []string{`gzip_decompress`, `gzip_decompress(true)`}, "string", "string"},
+		{"zlib_compress", 0, 2, "Compress with zlib (optional file arg)", "Compression", []string{`zlib_compress`, `zlib_compress(true)`}, "string", "string"},
+		{"zlib_decompress", 0, 2, "Decompress zlib (optional file arg)", "Compression", []string{`zlib_decompress`, `zlib_decompress(true)`}, "string", "string"},
+		{"deflate_compress", 0, 2, "Compress with deflate (optional file arg)", "Compression", []string{`deflate_compress`, `deflate_compress(true)`}, "string", "string"},
+		{"deflate_decompress", 0, 2, "Decompress deflate (optional file arg)", "Compression", []string{`deflate_decompress`, `deflate_decompress(true)`}, "string", "string"},
 		
 		// String operations
-		{"upper", 0, 2, "Convert to uppercase (optional file arg)", "String", []string{`upper`, `upper(true)`}},
-		{"lower", 0, 2, "Convert to lowercase (optional file arg)", "String", []string{`lower`, `lower(true)`}},
-		{"reverse_string", 0, 2, "Reverse string (optional file arg)", "String", []string{`reverse_string`, `reverse_string(true)`}},
-		{"replace", 2, 4, "Replace substring (old, new, [input], [file])", "String", []string{`replace("old"; "new")`, `replace("old"; "new"; "text")`}},
-		{"trim", 0, 2, "Trim whitespace (optional file arg)", "String", []string{`trim`, `trim(true)`}},
-		{"split", 1, 3, "Split string by separator (separator, [input], [file])", "String", []string{`split(",")`, `split(","; "a,b,c")`}},
-		{"join_string", 1, 1, "Join array with separator (separator)", "String", []string{`join_string(",")`, `["a","b"] | join_string(",")`}},
+		{"upper", 0, 2, "Convert to uppercase (optional file arg)", "String", []string{`upper`, `upper(true)`}, "string", "string"},
+		{"lower", 0, 2, "Convert to lowercase (optional file arg)", "String", []string{`lower`, `lower(true)`}, "string", "string"},
+		{"reverse_string", 0, 2, "Reverse string (optional file arg)", "String", []string{`reverse_string`, `reverse_string(true)`}, "string", "string"},
+		{"replace", 2, 4, "Replace substring (old, new, [input], [file])", "String", []string{`replace("old"; "new")`, `replace("old"; "new"; "text")`}, "string", "string"},
+		{"trim", 0, 2, "Trim whitespace (optional file arg)", "String", []string{`trim`, `trim(true)`}, "string", "string"},
+		{"split", 1, 3, "Split string by separator (separator, [input], [file])", "String", []string{`split(",")`, `split(","; "a,b,c")`}, "string", "array"},
+		{"join_string", 1, 1, "Join array with separator (separator)", "String", []string{`join_string(",")`, `["a","b"] | join_string(",")`}, "array", "string"},
+		
+		// Regular expressions
+		{"regex_match", 1, 3, "First regex match with groups and named groups, or null (pattern, [flags], [input])", "String", []string{`regex_match("(?P<user>\\w+)@(?P<host>.+)")`, `regex_match("^error"; "im") | ._val != null`}, "string", "object"},
+		{"regex_extract_all", 1, 3, "All regex matches; named groups become objects (pattern, [flags], [input])", "String", []string{`regex_extract_all("\\d+")`, `regex_extract_all("(?P<k>\\w+)=(?P<v>\\w*)")`}, "string", "array"},
+		{"regex_replace", 2, 4, "Replace all regex matches, $1 and ${name} expand groups (pattern, replacement, [flags], [input])", "String", []string{`regex_replace("\\s+"; " ")`, `regex_replace("(?P<y>\\d{4})-(?P<m>\\d\\d)"; "${m}/${y}")`}, "string", "string"},
+		
+		// Unicode
+		{"unicode_normalize", 1, 2, "Normalize text to NFC, NFD, NFKC or NFKD (form, [input])", "String", []string{`unicode_normalize("NFC")`, `unicode_normalize("NFKC"; "ｆｕｌｌｗｉｄｔｈ")`}, "string", "string"},
+		{"unicode_names", 0, 1, "List the characters of a string with codepoint, name, category and script", "String", []string{`unicode_names`, `"é" | unicode_names | ._val[].name`}, "string", "array"},
+		{"unicode_inspect", 0, 1, "Find invisible and bidi characters, lookalike letters and mixed scripts; returns {skeleton, scripts, mixed_script, invisible, confusables, suspicious}", "String", []string{`unicode_inspect`, `select(unicode_inspect | ._val.suspicious)`, `(unicode_inspect | ._val.skeleton) == ("paypal" | unicode_inspect | ._val.skeleton)`}, "string", "object"},
+		
+		// Language detection
+		{"lang_detect", 0, 1, "Detect the language of text as an ISO 639-1 code, with confidence in _meta", "String", []string{`lang_detect`, `lang_detect(.subject) | ._val`, `select(lang_detect | ._val != "en")`}, "string", "string"},
 		
 		// Hash functions
-		{"md5", 0, 2, "MD5 hash (optional file arg)", "Hash", []string{`md5`, `md5(true)`}},
-		{"sha1", 0, 2, "SHA1 hash (optional file arg)", "Hash", []string{`sha1`, `sha1(true)`}},
-		{"sha224", 0, 2, "SHA224 hash (optional file arg)", "Hash", []string{`sha224`, `sha224(true)`}},
-		{"sha256", 0, 2, "SHA256 hash (optional file arg)", "Hash", []string{`sha256`, `sha256(true)`}},
-		{"sha384", 0, 2, "SHA384 hash (optional file arg)", "Hash", []string{`sha384`, `sha384(true)`}},
-		{"sha512", 0, 2, "SHA512 hash (optional file arg)", "Hash", []string{`sha512`, `sha512(true)`}},
-		{"sha512_224", 0, 2, "SHA512/224 hash (optional file arg)", "Hash", []string{`sha512_224`, `sha512_224(true)`}},
-		{"sha512_256", 0, 2, "SHA512/256 hash (optional file arg)", "Hash", []string{`sha512_256`, `sha512_256(true)`}},
+		{"md5", 0, 2, "MD5 hash (optional file arg)", "Hash", []string{`md5`, `md5(true)`}, "string", "string"},
+		{"sha1", 0, 2, "SHA1 hash (optional file arg)", "Hash", []string{`sha1`, `sha1(true)`}, "string", "string"},
+		{"sha224", 0, 2, "SHA224 hash (optional file arg)", "Hash", []string{`sha224`, `sha224(true)`}, "string", "string"},
+		{"sha256", 0, 2, "SHA256 hash (optional file arg)", "Hash", []string{`sha256`, `sha256(true)`}, "string", "string"},
+		{"sha384", 0, 2, "SHA384 hash (optional file arg)", "Hash", []string{`sha384`, `sha384(true)`}, "string", "string"},
+		{"sha512", 0, 2, "SHA512 hash (optional file arg)", "Hash", []string{`sha512`, `sha512(true)`}, "string", "string"},
+		{"sha512_224", 0, 2, "SHA512/224 hash (optional file arg)", "Hash", []string{`sha512_224`, `sha512_224(true)`}, "string", "string"},
+		{"sha512_256", 0, 2, "SHA512/256 hash (optional file arg)", "Hash", []string{`sha512_256`, `sha512_256(true)`}, "string", "string"},
 		
 		// HMAC functions
-		{"hmac_md5", 1, 3, "HMAC-MD5 (key, [message], [file])", "HMAC", []string{`hmac_md5("key")`, `hmac_md5("key"; "message")`}},
-		{"hmac_sha1", 1, 3, "HMAC-SHA1 (key, [message], [file])", "HMAC", []string{`hmac_sha1("key")`, `hmac_sha1("key"; "message")`}},
-		{"hmac_sha224", 1, 3, "HMAC-SHA224 (key, [message], [file])", "HMAC", []string{`hmac_sha224("key")`, `hmac_sha224("key"; "message")`}},
-		{"hmac_sha256", 1, 3, "HMAC-SHA256 (key, [message], [file])", "HMAC", []string{`hmac_sha256("key")`, `hmac_sha256("key"; "message")`}},
-		{"hmac_sha384", 1, 3, "HMAC-SHA384 (key, [message], [file])", "HMAC", []string{`hmac_sha384("key")`, `hmac_sha384("key"; "message")`}},
-		{"hmac_sha512", 1, 3, "HMAC-SHA512 (key, [message], [file])", "HMAC", []string{`hmac_sha512("key")`, `hmac_sha512("key"; "message")`}},
-		{"hmac_sha512_224", 1, 3, "HMAC-SHA512/224 (key, [message], [file])", "HMAC", []string{`hmac_sha512_224("key")`, `hmac_sha512_224("key"; "message")`}},
-		{"hmac_sha512_256", 1, 3, "HMAC-SHA512/256 (key, [message], [file])", "HMAC", []string{`hmac_sha512_256("key")`, `hmac_sha512_256("key"; "message")`}},
+		{"hmac_md5", 1, 3, "HMAC-MD5 (key, [message], [file])", "HMAC", []string{`hmac_md5("key")`, `hmac_md5("key"; "message")`}, "string", "string"},
+		{"hmac_sha1", 1, 3, "HMAC-SHA1 (key, [message], [file])", "HMAC", []string{`hmac_sha1("key")`, `hmac_sha1("key"; "message")`}, "string", "string"},
+		{"hmac_sha224", 1, 3, "HMAC-SHA224 (key, [message], [file])", "HMAC", []string{`hmac_sha224("key")`, `hmac_sha224("key"; "message")`}, "string", "string"},
+		{"hmac_sha256", 1, 3, "HMAC-SHA256 (key, [message], [file])", "HMAC", []string{`hmac_sha256("key")`, `hmac_sha256("key"; "message")`}, "string", "string"},
+		{"hmac_sha384", 1, 3, "HMAC-SHA384 (key, [message], [file])", "HMAC", []string{`hmac_sha384("key")`, `hmac_sha384("key"; "message")`}, "string", "string"},
+		{"hmac_sha512", 1, 3, "HMAC-SHA512 (key, [message], [file])", "HMAC", []string{`hmac_sha512("key")`, `hmac_sha512("key"; "message")`}, "string", "string"},
+		{"hmac_sha512_224", 1, 3, "HMAC-SHA512/224 (key, [message], [file])", "HMAC", []string{`hmac_sha512_224("key")`, `hmac_sha512_224("key"; "message")`}, "string", "string"},
+		{"hmac_sha512_256", 1, 3, "HMAC-SHA512/256 (key, [message], [file])", "HMAC", []string{`hmac_sha512_256("key")`, `hmac_sha512_256("key"; "message")`}, "string", "string"},
 		
 		// Timestamp operations
-		{"timestamp_to_date", 0, 2, "Convert Unix timestamp to date (optional file arg)", "Timestamp", []string{`timestamp_to_date`, `1609459200 | timestamp_to_date`}},
-		{"date_to_timestamp", 0, 2, "Convert date to Unix timestamp (optional file arg)", "Timestamp", []string{`date_to_timestamp`, `"2021-01-01T00:00:00Z" | date_to_timestamp`}},
+		{"timestamp_to_date", 0, 2, "Convert Unix timestamp to date (optional file arg)", "Timestamp", []string{`timestamp_to_date`, `1609459200 | timestamp_to_date`}, "number", "string"},
+		{"date_to_timestamp", 0, 2, "Convert date to Unix timestamp (optional file arg)", "Timestamp", []string{`date_to_timestamp`, `"2021-01-01T00:00:00Z" | date_to_timestamp`}, "string", "number"},
+		{"date_parse", 0, 2, "Parse a date by layout, known log formats or epoch number into RFC3339 and components", "Timestamp", []string{`date_parse`, `"Mar  1 10:20:30" | date_parse`, `date_parse("%d/%m/%Y %H:%M"; {tz: "Europe/Berlin"})`}, "", "string"},
+		{"tz_convert", 1, 2, "Convert a time to an IANA time zone, with DST (optional zone of times without offset)", "Timestamp", []string{`tz_convert("America/New_York")`, `"2024-03-01 09:00:00" | tz_convert("UTC"; "Asia/Tokyo")`}, "string", "string"},
+		{"tz_list", 0, 1, "List IANA time zone names (optional prefix)", "Timestamp", []string{`tz_list`, `tz_list("Europe/")`}, "", "array"},
+		{"cron_next", 1, 3, "Next fire times of a cron expression (optional count, {from, tz})", "Timestamp", []string{`cron_next("0 9 * * 1-5")`, `cron_next("*/15 * * * *"; 4; {tz: "Europe/Berlin"})`}, "", "array"},
+		{"cron_describe", 0, 1, "Describe a cron expression or crontab line in words", "Timestamp", []string{`cron_describe("0 9 * * 1-5")`, `"@weekly /usr/bin/backup" | cron_describe`}, "string", "string"},
 		
 		// JSON operations
-		{"json_parse", 0, 2, "Parse JSON string (optional file arg)", "JSON", []string{`json_parse`, `"{\"key\":\"value\"}" | json_parse`}},
-		{"json_stringify", 0, 2, "Convert to JSON string (optional file arg)", "JSON", []string{`json_stringify`, `{"key":"value"} | json_stringify`}},
+		{"json_parse", 0, 2, "Parse JSON string (optional file arg)", "JSON", []string{`json_parse`, `"{\"key\":\"value\"}" | json_parse`}, "string", ""},
+		{"json_stringify", 0, 2, "Convert to JSON string (optional file arg)", "JSON", []string{`json_stringify`, `{"key":"value"} | json_stringify`}, "", "string"},
 		
 		// CSV operations
-		{"csv_parse", 0, 3, "Parse CSV (delimiter, [input], [file])", "CSV", []string{`csv_parse`, `csv_parse(",")`, `csv_parse(","; "a,b,c")`}},
-		{"csv_stringify", 0, 3, "Convert to CSV (delimiter, [input], [file])", "CSV", []string{`csv_stringify`, `csv_stringify(",")`, `[[["a","b"]]] | csv_stringify(",")`}},
+		{"csv_parse", 0, 3, "Parse CSV (delimiter, [input], [file], [options]); options: headers, quote, escape, comment, stream", "CSV", []string{`csv_parse`, `csv_parse(",")`, `csv_parse(","; "a,b,c")`, `csv_parse({headers: true})`, `"data.csv" | csv_parse({file: true, stream: true})`}, "string", "array"},
+		{"csv_stringify", 0, 3, "Convert arrays or objects to CSV (delimiter, [input], [options]); options: headers, quote, escape, quote_mode, crlf", "CSV", []string{`csv_stringify`, `csv_stringify(",")`, `[[["a","b"]]] | csv_stringify(",")`, `[{a: 1}] | csv_stringify`, `csv_stringify({quote_mode: "all"})`}, "array", "string"},
 		
 		// XML operations
-		{"xml_parse", 0, 2, "Parse XML string (optional file arg)", "XML", []string{`xml_parse`, `"<root>test</root>" | xml_parse`}},
-		{"xml_stringify", 0, 2, "Convert to XML string (optional file arg)", "XML", []string{`xml_stringify`, `{"_tag":"root","_content":"test"} | xml_stringify`}},
+		{"xml_parse", 0, 2, "Parse XML string (optional file arg)", "XML", []string{`xml_parse`, `"<root>test</root>" | xml_parse`}, "string", "object"},
+		{"xml_stringify", 0, 2, "Convert to XML string (optional file arg)", "XML", []string{`xml_stringify`, `{"_tag":"root","_content":"test"} | xml_stringify`}, "object", "string"},
+		
+		// TOML operations
+		{"toml_parse", 0, 2, "Parse TOML string (optional file arg)", "TOML", []string{`toml_parse`, `"Cargo.toml" | toml_parse(true) | .dependencies`, `toml_parse("pyproject.toml"; true) | .tool.poetry.version`}, "string", "object"},
+		{"toml_stringify", 0, 2, "Convert object to TOML string (optional file arg reads a JSON file)", "TOML", []string{`toml_stringify`, `{"package":{"name":"demo"}} | toml_stringify`, `"config.json" | toml_stringify(true)`}, "object", "string"},
+		
+		// INI and .properties parsing
+		{"ini_parse", 0, 2, "Parse INI into nested section objects; repeated keys become arrays (optional file arg)", "Config", []string{`ini_parse`, `"php.ini" | ini_parse(true) | .PHP.memory_limit`, `"[db]\nhost=localhost" | ini_parse | .db.host`}, "string", "object"},
+		{"properties_parse", 0, 2, "Parse Java .properties; dotted keys nest, repeated keys become arrays (optional file arg)", "Config", []string{`properties_parse`, `"application.properties" | properties_parse(true) | .spring.datasource`, `"a.b=c" | properties_parse | .a.b`}, "string", "object"},
+		
+		// Protocol Buffers
+		{"protobuf_decode", 0, 2, "Decode protobuf wire format without a schema, or to named JSON with {descriptor_set, message} (options: file, encoding)", "Protobuf", []string{`protobuf_decode`, `"089601" | protobuf_decode({encoding: "hex"}) | ._val[0].value`, `"msg.bin" | protobuf_decode({file: true, descriptor_set: "api.pb", message: "pkg.Msg"})`}, "string", ""},
+		
+		// Parquet
+		{"parquet_read", 0, 2, "Stream rows of a Parquet file as objects (path, optional {columns, limit, offset})", "Parquet", []string{`"events.parquet" | parquet_read`, `parquet_read("events.parquet"; {columns: ["id", "ts"], limit: 10})`, `[parquet_read("events.parquet") | select(.status >= 500)] | length`}, "string", "object"},
+		
+		// Avro
+		{"avro_decode", 1, 3, "Decode Avro binary or an object container file (schema, [data], [{file, encoding, confluent}])", "Avro", []string{`base64_decode | avro_decode($schema)`, `avro_decode(null; "users.avro"; {file: true})`, `avro_decode($schema; .value; {confluent: true, encoding: "base64"})`}, "string", ""},
+		{"avro_encode", 1, 3, "Encode to Avro binary or an object container file (schema, [value], [{container, codec, encoding, schema_id}])", "Avro", []string{`avro_encode($schema)`, `avro_encode("long"; 150; {encoding: "hex"})`, `[.[] | .user] | avro_encode($schema; .; {container: true, codec: "deflate"})`}, "", "string"},
+		
+		// XLSX
+		{"xlsx_read", 0, 2, "Read a sheet of an .xlsx workbook as rows (path, [sheet name/index or {sheet, headers}])", "XLSX", []string{`"report.xlsx" | xlsx_read`, `xlsx_read("report.xlsx"; "Q3")`, `xlsx_read("report.xlsx"; {sheet: 0, headers: true}) | ._val[]`}, "string", "array"},
+		{"xlsx_sheets", 0, 1, "List the sheets of an .xlsx workbook", "XLSX", []string{`"report.xlsx" | xlsx_sheets`, `xlsx_sheets("report.xlsx") | ._val[].name`}, "string", "array"},
+		
+		// HTML parsing
+		{"html_select", 1, 2, "Select elements from HTML with a CSS selector (selector, [input]); elements are {tag, attrs, text, html}", "HTML", []string{`http("https://example.com") | html_select("a[href]")`, `html_select("table tr") | ._val | html_select("td")`, `html_select("h1"; $page) | ._val[0].text`}, "string", "array"},
+		{"html_text", 0, 1, "Visible text of HTML or selected elements, whitespace collapsed", "HTML", []string{`html_text`, `html_select("p") | html_text | ._val`}, "", "string"},
+		{"html_attr", 1, 2, "Attribute of selected elements or of the first element of HTML (name, [input])", "HTML", []string{`html_select("a") | html_attr("href") | ._val`, `html_attr("src"; "<img src=x.png>")`}, "", ""},
+		
+		// Markdown
+		{"md_to_html", 0, 3, "Render Markdown to HTML ([input], [file], [{gfm, unsafe, hard_wraps, heading_ids, file}])", "Markdown", []string{`md_to_html`, `"README.md" | md_to_html(true) | ._val`, `md_to_html({heading_ids: true, unsafe: true})`}, "string", "string"},
+		{"md_parse", 0, 3, "Parse Markdown into an AST of {type, children, ...} nodes ([input], [file], [options])", "Markdown", []string{`md_parse`, `"README.md" | md_parse(true) | [.children[] | select(.type == "heading") | .text]`, `md_parse | [.. | objects | select(.type == "link") | .destination]`}, "string", "object"},
 		
 		// Entropy
-		{"entropy", 0, 2, "Calculate Shannon entropy (optional file arg)", "Entropy", []string{`entropy`, `entropy(true)`, `"hello" | entropy`}},
+		{"entropy", 0, 2, "Calculate Shannon entropy (optional file arg)", "Entropy", []string{`entropy`, `entropy(true)`, `"hello" | entropy`}, "string", "number"},
 		
 		// SSDeep (fuzzy hashing)
-		{"ssdeep", 0, 2, "Calculate ssdeep fuzzy hash (optional file arg)", "SSDeep", []string{`ssdeep`, `ssdeep(true)`, `"hello" | ssdeep`}},
-		{"ssdeep_compare", 2, 2, "Compare two ssdeep hashes (hash1, hash2)", "SSDeep", []string{`ssdeep_compare("hash1"; "hash2")`, `ssdeep("text1") | ssdeep_compare(.; ssdeep("text2"))`}},
+		{"ssdeep", 0, 2, "Calculate ssdeep fuzzy hash (optional file arg)", "SSDeep", []string{`ssdeep`, `ssdeep(true)`, `"hello" | ssdeep`}, "string", "string"},
+		{"ssdeep_compare", 2, 2, "Compare two ssdeep hashes (hash1, hash2)", "SSDeep", []string{`ssdeep_compare("hash1"; "hash2")`, `ssdeep("text1") | ssdeep_compare(.; ssdeep("text2"))`}, "", "number"},
 		
 		// Tee (write to stderr or file)
-		{"tee", 0, 1, "Write JSON to stderr (default) or file (optional filepath arg)", "File Operations", []string{`tee`, `tee("/tmp/output.json")`, `{"key":"value"} | tee`}},
+		{"tee", 0, 2, "Write JSON to stderr (default), a file, or several destinations, as NDJSON, pretty JSON, raw strings or exact bytes", "File Operations", []string{`tee`, `tee("/tmp/output.json")`, `{"key":"value"} | tee`, `tee(["stderr", "out.ndjson"]; {append: false})`, `.msg | tee("log.txt"; {format: "raw"})`, `cat("in.bin"; "bytes")._val | tee("out.bin"; {append: false, format: "bytes"})`}, "", ""},
 		
 		// Shell command execution
-		{"sh", 0, 1, "Execute a shell command (command from pipe or argument)", "System", []string{`sh("echo hello")`, `"echo test" | sh(.)`, `sh("ls -la")`}},
+		{"sh", 0, 2, "Execute a shell command; with sh(cmd) the input is its stdin (optional {timeout, env, clear_env, dir, stdin})", "System", []string{`sh("echo hello")`, `"echo test" | sh`, `"hello" | sh("tr a-z A-Z")`, `sh("make test"; {timeout: 60, dir: "src"})`}, "", "string"},
+		{"exec", 1, 2, "Run a program from an argv array without a shell, with the input as stdin (optional {timeout, env, clear_env, dir, stdin})", "System", []string{`exec(["ls", "-la"])`, `.body | exec(["jq", "-c", ".items"])`}, "", "string"},
+		
+		// Standard input
+		{"stdin_lines", 0, 1, "Yield each line of standard input as it is read (optional count)", "System", []string{`stdin_lines`, `stdin_lines(10)`, `stdin_lines | ._val | fromjson? // .`}, "", "string"},
+		{"secret", 1, 1, "Look up a secret at runtime in $PWRQ_SECRET_NAME, ~/.pwrq/secrets/name or the OS keyring, or in one source with env:, file: or keyring:", "System", []string{`secret("shodan")`, `secret("env:GITHUB_TOKEN")`, `secret("file:~/.config/vt/key")`, `{Authorization: "Bearer \(secret("api") | ._val)"}`}, "", "string"},
 		
 		// Temporary directory
-		{"tempdir", 0, 2, "Create a temporary directory (optional prefix, optional dir)", "File Operations", []string{`tempdir`, `tempdir("prefix_")`, `tempdir("prefix_"; "/tmp")`, `tempdir(""; "/tmp")`}},
+		{"tempdir", 0, 2, "Create a temporary directory (optional prefix, optional dir)", "File Operations", []string{`tempdir`, `tempdir("prefix_")`, `tempdir("prefix_"; "/tmp")`, `tempdir(""; "/tmp")`}, "", "string"},
+		{"tempfile", 0, 3, "Create a temporary file holding the input, unless it is null (optional prefix, ext, dir)", "File Operations", []string{`tempfile`, `tempfile("report-"; "csv")`, `.config | tempfile("cfg-"; "json") | sh("mytool --config " + ._val)`}, "", "string"},
 		
 		// HTTP requests
-		{"http", 0, 2, "Make HTTP request (method default POST, url required)", "HTTP", []string{`http("https://example.com")`, `"https://example.com" | http`, `http("GET"; "https://example.com")`, `{"key":"value"} | http("POST"; "https://api.example.com")`}},
-		{"http_serve", 2, 2, "Start HTTP server (host, port) - returns server URL", "HTTP", []string{`http_serve("127.0.0.1"; 8080)`, `http_serve("0.0.0.0"; 0)`}},
+		{"http", 0, 2, "Make HTTP request (method default POST, url required)", "HTTP", []string{`http("https://example.com")`, `"https://example.com" | http`, `http("GET"; "https://example.com")`, `{"key":"value"} | http("POST"; "https://api.example.com")`}, "", "string"},
+		{"http_serve", 2, 2, "Start HTTP server (host, port) - returns server URL", "HTTP", []string{`http_serve("127.0.0.1"; 8080)`, `http_serve("0.0.0.0"; 0)`}, "", "string"},
+		
+		// Email
+		{"smtp_send", 1, 2, "Send email via SMTP (server host:port, options {from,to,cc,bcc,subject,body,html,attachments,username,password,starttls,tls})", "Network", []string{`smtp_send("smtp.example.com:587"; {from: "a@example.com", to: "b@example.com", subject: "Report", username: "a", password: "secret"})`, `{from: "a@example.com", to: ["b@example.com"], body: "hi", starttls: false} | smtp_send("localhost:25")`, `report | smtp_send("localhost:25"; {from: "a@example.com", to: "b@example.com", starttls: false, attachments: ["/tmp/report.csv"]})`}, "", "string"},
+		
+		// Redis (server arg or $PWRQ_REDIS_URL / $REDIS_URL, default localhost:6379)
+		{"redis_get", 0, 2, "Get a Redis key (key from pipe or argument, optional server)", "Network", []string{`redis_get("user:1")`, `"user:1" | redis_get`, `redis_get("user:1"; "redis://:pw@cache:6379/1") | ._val | fromjson`}, "string", "string"},
+		{"redis_set", 1, 3, "Set a Redis key (key, value from pipe or argument, optional server or {server, ttl})", "Network", []string{`redis_set("greeting"; "hello")`, `{a: 1} | redis_set("user:1")`, `redis_set("k"; "v"; {server: "cache:6379", ttl: 60})`}, "", "string"},
+		{"redis_keys", 0, 2, "List Redis keys matching a glob pattern via SCAN (default *, optional server)", "Network", []string{`redis_keys`, `redis_keys("user:*")`, `redis_keys("user:*") | ._val[] | redis_get`}, "", "array"},
+		{"redis_cmd", 0, 2, "Run an arbitrary Redis command (array or space-separated string, optional server)", "Network", []string{`redis_cmd(["HGETALL", "h"])`, `"INCR counter" | redis_cmd`, `redis_cmd(["TTL", "k"]; "cache:6379")`}, "", ""},
+		
+		// Kafka
+		{"kafka_produce", 2, 3, "Publish the input to a Kafka topic (brokers, topic, optional key)", "Network", []string{`{"event":"login"} | kafka_produce("localhost:9092"; "events")`, `.value | kafka_produce("b1:9092,b2:9092"; "out"; "user-1")`}, "", "string"},
+		{"kafka_consume", 3, 4, "Read up to n messages from a Kafka topic (brokers, topic, n, optional {group, from, timeout})", "Network", []string{`kafka_consume("localhost:9092"; "events"; 10)`, `kafka_consume("localhost:9092"; "events"; 5; {from: "latest", timeout: 30})`, `kafka_consume("b:9092"; "in"; 100) | ._val[] | .value | fromjson | select(.level == "error") | kafka_produce("b:9092"; "errors")`}, "", "array"},
 		
 		// Encryption/Decryption
-		{"aes_encrypt", 2, 5, "AES encryption (data, key, [mode=CBC], [keyFormat=raw], [dataFormat=raw])", "Encryption", []string{`aes_encrypt("data"; "key")`, `aes_encrypt("data"; "key"; "CBC")`, `aes_encrypt("data"; "key"; "ECB")`}},
-		{"aes_decrypt", 2, 5, "AES decryption (data, key, [mode=CBC], [keyFormat=raw], [dataFormat=base64])", "Encryption", []string{`aes_decrypt("encrypted"; "key")`, `aes_decrypt("encrypted"; "key"; "CBC")`}},
-		{"des_encrypt", 2, 4, "DES encryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`des_encrypt("data"; "key")`, `des_encrypt("data"; "key"; "CBC")`}},
-		{"des_decrypt", 2, 4, "DES decryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`des_decrypt("encrypted"; "key")`, `des_decrypt("encrypted"; "key"; "CBC")`}},
-		{"3des_encrypt", 2, 4, "Triple DES encryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`3des_encrypt("data"; "key")`, `3des_encrypt("data"; "key"; "CBC")`}},
-		{"3des_decrypt", 2, 4, "Triple DES decryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`3des_decrypt("encrypted"; "key")`, `3des_decrypt("encrypted"; "key"; "CBC")`}},
-		{"blowfish_encrypt", 2, 4, "Blowfish encryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`blowfish_encrypt("data"; "key")`, `blowfish_encrypt("data"; "key"; "CBC")`}},
-		{"blowfish_decrypt", 2, 4, "Blowfish decryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`blowfish_decrypt("encrypted"; "key")`, `blowfish_decrypt("encrypted"; "key"; "CBC")`}},
-		{"rc4", 1, 3, "RC4 encryption/decryption (key, [keyFormat=raw], [dataFormat=raw])", "Encryption", []string{`rc4("key")`, `"data" | rc4("key")`}},
-		{"chacha20", 1, 4, "ChaCha20 encryption/decryption (key, [nonce], [keyFormat=raw], [dataFormat=raw])", "Encryption", []string{`chacha20("key")`, `"data" | chacha20("key")`}},
-		{"xor", 1, 3, "XOR encryption/decryption (key, [keyFormat=raw], [dataFormat=raw])", "Encryption", []string{`xor("key")`, `"data" | xor("key")`}},
-	}
+		{"aes_encrypt", 2, 5, "AES encryption (data, key, [mode=CBC], [keyFormat=raw], [dataFormat=raw])", "Encryption", []string{`aes_encrypt("data"; "key")`, `aes_encrypt("data"; "key"; "CBC")`, `aes_encrypt("data"; "key"; "ECB")`}, "string", "string"},
+		{"aes_decrypt", 2, 5, "AES decryption (data, key, [mode=CBC], [keyFormat=raw], [dataFormat=base64])", "Encryption", []string{`aes_decrypt("encrypted"; "key")`, `aes_decrypt("encrypted"; "key"; "CBC")`}, "string", "string"},
+		{"des_encrypt", 2, 4, "DES encryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`des_encrypt("data"; "key")`, `des_encrypt("data"; "key"; "CBC")`}, "string", "string"},
+		{"des_decrypt", 2, 4, "DES decryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`des_decrypt("encrypted"; "key")`, `des_decrypt("encrypted"; "key"; "CBC")`}, "string", "string"},
+		{"3des_encrypt", 2, 4, "Triple DES encryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`3des_encrypt("data"; "key")`, `3des_encrypt("data"; "key"; "CBC")`}, "string", "string"},
+		{"3des_decrypt", 2, 4, "Triple DES decryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`3des_decrypt("encrypted"; "key")`, `3des_decrypt("encrypted"; "key"; "CBC")`}, "string", "string"},
+		{"blowfish_encrypt", 2, 4, "Blowfish encryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`blowfish_encrypt("data"; "key")`, `blowfish_encrypt("data"; "key"; "CBC")`}, "string", "string"},
+		{"blowfish_decrypt", 2, 4, "Blowfish decryption (data, key, [mode=CBC], [keyFormat=raw])", "Encryption", []string{`blowfish_decrypt("encrypted"; "key")`, `blowfish_decrypt("encrypted"; "key"; "CBC")`}, "string", "string"},
+		{"rc4", 1, 3, "RC4 encryption/decryption (key, [keyFormat=raw], [dataFormat=raw])", "Encryption", []string{`rc4("key")`, `"data" | rc4("key")`}, "string", "string"},
+		{"chacha20", 1, 4, "ChaCha20 encryption/decryption (key, [nonce], [keyFormat=raw], [dataFormat=raw])", "Encryption", []string{`chacha20("key")`, `"data" | chacha20("key")`}, "string", "string"},
+		{"xor", 1, 3, "XOR encryption/decryption (key, [keyFormat=raw], [dataFormat=raw])", "Encryption", []string{`xor("key")`, `"data" | xor("key")`}, "string", "string"},
+	}, extraMetadata...)
 }
 
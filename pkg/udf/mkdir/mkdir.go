@@ -11,12 +11,12 @@ import (
 
 // RegisterMkdir registers the mkdir function with gojq
 func RegisterMkdir() gojq.CompilerOption {
-	return gojq.WithFunction("mkdir", 1, 1, func(v any, args []any) any {
+	return common.WithFunction("mkdir", 1, 1, common.Audited("mkdir", func(v any, args []any) any {
 		var dirPath string
 
 		// Parse required argument: directory path
 		if len(args) == 0 {
-			return common.MakeUDFErrorResult(fmt.Errorf("mkdir: path argument is required"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "mkdir: path argument is required"), nil)
 		}
 
 		// Extract path from argument
@@ -28,7 +28,7 @@ func RegisterMkdir() gojq.CompilerOption {
 			if pathStr, ok := pathVal.(string); ok {
 				dirPath = pathStr
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("mkdir: argument must be a string path, got %T", args[0]), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "mkdir: argument must be a string path, got %T", args[0]), nil)
 			}
 		}
 
@@ -39,13 +39,13 @@ func RegisterMkdir() gojq.CompilerOption {
 			if dirPath == "~" {
 				home, homeErr := os.UserHomeDir()
 				if homeErr != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("mkdir: cannot determine home directory: %v", homeErr), nil)
+					return common.MakeUDFErrorResult(fmt.Errorf("mkdir: cannot determine home directory: %w", homeErr), nil)
 				}
 				absPath = home
 			} else if len(dirPath) > 0 && dirPath[0] == '~' && (len(dirPath) == 1 || dirPath[1] == '/') {
 				home, homeErr := os.UserHomeDir()
 				if homeErr != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("mkdir: cannot determine home directory: %v", homeErr), nil)
+					return common.MakeUDFErrorResult(fmt.Errorf("mkdir: cannot determine home directory: %w", homeErr), nil)
 				}
 				if len(dirPath) > 1 {
 					absPath = filepath.Join(home, dirPath[2:])
@@ -54,13 +54,19 @@ func RegisterMkdir() gojq.CompilerOption {
 				}
 				absPath, err = filepath.Abs(absPath)
 				if err != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("mkdir: cannot resolve path %q: %v", dirPath, err), nil)
+					return common.MakeUDFErrorResult(fmt.Errorf("mkdir: cannot resolve path %q: %w", dirPath, err), nil)
 				}
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("mkdir: cannot resolve path %q: %v", dirPath, err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("mkdir: cannot resolve path %q: %w", dirPath, err), nil)
 			}
 		}
 		dirPath = absPath
+		if err := common.CheckWrite(dirPath); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("mkdir: %w", err), map[string]any{
+				"operation": "mkdir",
+				"path":      dirPath,
+			})
+		}
 
 		// Check if path already exists
 		existingInfo, err := os.Stat(dirPath)
@@ -80,7 +86,7 @@ func RegisterMkdir() gojq.CompilerOption {
 					"operation": "mkdir",
 					"path":      dirPath,
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("mkdir: path %q already exists and is not a directory", dirPath), meta)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeExists, "mkdir: path %q already exists and is not a directory", dirPath), meta)
 			}
 		}
 
@@ -92,9 +98,9 @@ func RegisterMkdir() gojq.CompilerOption {
 				"path":      dirPath,
 			}
 			if os.IsPermission(err) {
-				return common.MakeUDFErrorResult(fmt.Errorf("mkdir: permission denied creating directory: %q", dirPath), meta)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodePermission, "mkdir: permission denied creating directory: %q", dirPath), meta)
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("mkdir: failed to create directory %q: %v", dirPath, err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("mkdir: failed to create directory %q: %w", dirPath, err), meta)
 		}
 
 		// Verify the directory was created
@@ -104,14 +110,14 @@ func RegisterMkdir() gojq.CompilerOption {
 				"operation": "mkdir",
 				"path":      dirPath,
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("mkdir: directory was created but cannot be accessed: %v", err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("mkdir: directory was created but cannot be accessed: %w", err), meta)
 		}
 		if !info.IsDir() {
 			meta := map[string]any{
 				"operation": "mkdir",
 				"path":      dirPath,
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("mkdir: created path %q is not a directory", dirPath), meta)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "mkdir: created path %q is not a directory", dirPath), meta)
 		}
 
 		meta := map[string]any{
@@ -121,6 +127,6 @@ func RegisterMkdir() gojq.CompilerOption {
 		}
 
 		return common.MakeUDFSuccessResult(dirPath, meta)
-	})
+	}))
 }
 
@@ -228,10 +228,11 @@ func TestMkdir_InvalidPath(t *testing.T) {
 		t.Fatalf("Expected _err field in result")
 	}
 
-	errStr, ok := errVal.(string)
+	errObj, ok := errVal.(map[string]any)
 	if !ok {
-		t.Fatalf("Expected _err to be string, got %T", errVal)
+		t.Fatalf("Expected _err to be an object, got %T", errVal)
 	}
+	errStr, _ := errObj["message"].(string)
 
 	if errStr == "" {
 		t.Errorf("Expected error message, got empty string")
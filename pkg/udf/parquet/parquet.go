@@ -0,0 +1,408 @@
+package parquet
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// readBatchSize is the number of rows read from a row group at a time
+const readBatchSize = 64
+
+// Options are the settings accepted by parquet_read
+type Options struct {
+	Columns []string // top-level columns to keep, in the file's order when empty
+	Limit   int      // maximum number of rows to emit, -1 for all
+	Offset  int      // number of rows to skip first
+}
+
+func parseOptions(v any) (Options, error) {
+	opts := Options{Limit: -1}
+	m, ok := common.ExtractUDFValue(v).(map[string]any)
+	if !ok {
+		return opts, common.Errorf(common.CodeInvalid, "options must be an object, got %T", common.ExtractUDFValue(v))
+	}
+	if cols, ok := m["columns"]; ok && cols != nil {
+		list, ok := cols.([]any)
+		if !ok {
+			return opts, common.Errorf(common.CodeInvalid, "options.columns must be an array of strings, got %T", cols)
+		}
+		for _, c := range list {
+			name, ok := c.(string)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.columns must be an array of strings, got element %T", c)
+			}
+			opts.Columns = append(opts.Columns, name)
+		}
+	}
+	for key, dst := range map[string]*int{"limit": &opts.Limit, "offset": &opts.Offset} {
+		raw, ok := m[key]
+		if !ok || raw == nil {
+			continue
+		}
+		var n int
+		switch val := raw.(type) {
+		case int:
+			n = val
+		case float64:
+			if val != math.Trunc(val) {
+				return opts, common.Errorf(common.CodeInvalid, "options.%v must be an integer, got %v", key, val)
+			}
+			n = int(val)
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "options.%v must be a number, got %T", key, raw)
+		}
+		if n < 0 {
+			return opts, common.Errorf(common.CodeInvalid, "options.%v must not be negative, got %d", key, n)
+		}
+		*dst = n
+	}
+	return opts, nil
+}
+
+// rowIter lazily reads rows one row group at a time, so only the rows that
+// are actually consumed are decoded
+type rowIter struct {
+	file      *os.File
+	schema    *pq.Schema
+	rowGroups []pq.RowGroup
+	fields    map[string]pq.Node
+	columns   []string
+
+	group     int
+	rows      pq.Rows
+	buf       []pq.Row
+	pending   []pq.Row
+	skip      int64
+	remaining int
+	done      bool
+}
+
+// Open opens a parquet file and returns an iterator over its rows as objects
+func Open(path string, opts Options) (gojq.Iter, error) {
+	f, _, size, err := common.OpenFileFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	pf, err := pq.OpenFile(f, size)
+	if err != nil {
+		f.Close()
+		return nil, common.Errorf(common.CodeInvalid, "invalid parquet file: %w", err)
+	}
+
+	iter := &rowIter{
+		file:      f,
+		schema:    pf.Schema(),
+		rowGroups: pf.RowGroups(),
+		fields:    map[string]pq.Node{},
+		columns:   opts.Columns,
+		buf:       make([]pq.Row, readBatchSize),
+		skip:      int64(opts.Offset),
+		remaining: opts.Limit,
+	}
+	var names []string
+	for _, field := range pf.Schema().Fields() {
+		iter.fields[field.Name()] = field
+		names = append(names, field.Name())
+	}
+	for _, c := range opts.Columns {
+		if _, ok := iter.fields[c]; !ok {
+			f.Close()
+			return nil, common.Errorf(common.CodeInvalid, "unknown column %q (available: %v)", c, strings.Join(names, ", "))
+		}
+	}
+	return iter, nil
+}
+
+func (it *rowIter) Next() (any, bool) {
+	if it.done {
+		return nil, false
+	}
+	if it.remaining == 0 {
+		it.close()
+		return nil, false
+	}
+	for len(it.pending) == 0 {
+		if err := it.fill(); err != nil {
+			it.close()
+			if err == io.EOF {
+				return nil, false
+			}
+			return common.MakeUDFErrorResult(fmt.Errorf("parquet_read: %w", err), nil), true
+		}
+	}
+
+	row := it.pending[0]
+	it.pending = it.pending[1:]
+	record := map[string]any{}
+	if err := it.schema.Reconstruct(&record, row); err != nil {
+		it.close()
+		return common.MakeUDFErrorResult(fmt.Errorf("parquet_read: %w", err), nil), true
+	}
+	if it.remaining > 0 {
+		it.remaining--
+	}
+	return it.project(record), true
+}
+
+// fill reads the next batch of rows, moving on to the next row group when the
+// current one is exhausted. Row groups entirely before the offset are skipped
+// without being read
+func (it *rowIter) fill() error {
+	for it.rows == nil {
+		if it.group >= len(it.rowGroups) {
+			return io.EOF
+		}
+		rg := it.rowGroups[it.group]
+		it.group++
+		if n := rg.NumRows(); it.skip >= n {
+			it.skip -= n
+			continue
+		}
+		it.rows = rg.Rows()
+		if it.skip > 0 {
+			if err := it.rows.SeekToRow(it.skip); err != nil {
+				return err
+			}
+			it.skip = 0
+		}
+	}
+
+	n, err := it.rows.ReadRows(it.buf)
+	it.pending = it.buf[:n]
+	if err != nil {
+		it.rows.Close()
+		it.rows = nil
+		if err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// project keeps the requested columns and converts values for gojq
+func (it *rowIter) project(record map[string]any) map[string]any {
+	out := make(map[string]any, len(record))
+	if len(it.columns) == 0 {
+		for name, value := range record {
+			out[name] = normalize(value, it.fields[name])
+		}
+		return out
+	}
+	for _, name := range it.columns {
+		out[name] = normalize(record[name], it.fields[name])
+	}
+	return out
+}
+
+func (it *rowIter) close() {
+	if it.done {
+		return
+	}
+	it.done = true
+	if it.rows != nil {
+		it.rows.Close()
+		it.rows = nil
+	}
+	it.file.Close()
+}
+
+// normalize converts a reconstructed value into types gojq understands,
+// using the schema node for logical types such as timestamps and dates
+func normalize(v any, node pq.Node) any {
+	if v == nil {
+		return nil
+	}
+	if node != nil && node.Leaf() {
+		if lt := node.Type().LogicalType(); lt != nil {
+			switch {
+			case lt.Timestamp != nil:
+				if n, ok := v.(int64); ok {
+					unit := time.Nanosecond
+					switch {
+					case lt.Timestamp.Unit.Millis != nil:
+						unit = time.Millisecond
+					case lt.Timestamp.Unit.Micros != nil:
+						unit = time.Microsecond
+					}
+					return time.Unix(0, n*int64(unit)).UTC().Format(time.RFC3339Nano)
+				}
+			case lt.Date != nil:
+				if n, ok := v.(int32); ok {
+					return time.Unix(int64(n)*86400, 0).UTC().Format("2006-01-02")
+				}
+			}
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = normalize(item, childNode(node, k))
+		}
+		return val
+	case []any:
+		elem := elementNode(node)
+		for i, item := range val {
+			val[i] = normalize(item, elem)
+		}
+		return val
+	case string, bool, float64:
+		return val
+	case int:
+		return val
+	case int32:
+		return int(val)
+	case int64:
+		if int64(int(val)) == val {
+			return int(val)
+		}
+		return new(big.Int).SetInt64(val)
+	case uint32:
+		return int(val)
+	case uint64:
+		if val <= math.MaxInt64 && uint64(int(val)) == val {
+			return int(val)
+		}
+		return new(big.Int).SetUint64(val)
+	case float32:
+		// Round-trip through the shortest float32 form so 0.1 stays 0.1
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(val), 'g', -1, 32), 64)
+		return f
+	case []byte:
+		if utf8.Valid(val) {
+			return string(val)
+		}
+		return base64.StdEncoding.EncodeToString(val)
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano)
+	}
+
+	// Typed slices and maps produced for repeated and MAP columns
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return normalize(rv.Bytes(), node)
+		}
+		elem := elementNode(node)
+		out := make([]any, rv.Len())
+		for i := range out {
+			out[i] = normalize(rv.Index(i).Interface(), elem)
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]any, rv.Len())
+		valueNode := mapValueNode(node)
+		iter := rv.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = normalize(iter.Value().Interface(), valueNode)
+		}
+		return out
+	}
+	return fmt.Sprint(v)
+}
+
+// childNode returns the field of a group node with the given name, looking
+// through the key/value group of a MAP column
+func childNode(node pq.Node, name string) pq.Node {
+	if node == nil || node.Leaf() {
+		return nil
+	}
+	if lt := node.Type().LogicalType(); lt != nil && lt.Map != nil {
+		return mapValueNode(node)
+	}
+	for _, f := range node.Fields() {
+		if f.Name() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// elementNode returns the node describing the items of a LIST column or of a
+// repeated field
+func elementNode(node pq.Node) pq.Node {
+	if node == nil {
+		return nil
+	}
+	if lt := node.Type().LogicalType(); lt != nil && lt.List != nil {
+		fields := node.Fields()
+		if len(fields) == 1 {
+			if inner := fields[0].Fields(); len(inner) == 1 {
+				return inner[0]
+			}
+			return fields[0]
+		}
+		return nil
+	}
+	if node.Repeated() {
+		return pq.Required(node)
+	}
+	return nil
+}
+
+// mapValueNode returns the value node of a MAP column
+func mapValueNode(node pq.Node) pq.Node {
+	if node == nil || node.Leaf() {
+		return nil
+	}
+	fields := node.Fields()
+	if len(fields) != 1 || fields[0].Leaf() {
+		return nil
+	}
+	for _, f := range fields[0].Fields() {
+		if f.Name() == "value" {
+			return f
+		}
+	}
+	return nil
+}
+
+// RegisterParquetRead registers the parquet_read function with gojq
+func RegisterParquetRead() gojq.CompilerOption {
+	return common.WithIterFunction("parquet_read", 0, 2, func(v any, args []any) gojq.Iter {
+		// parquet_read, parquet_read(path), parquet_read(options),
+		// or parquet_read(path; options)
+		pathVal := v
+		opts := Options{Limit: -1}
+		var err error
+		switch len(args) {
+		case 1:
+			if m, ok := common.ExtractUDFValue(args[0]).(map[string]any); ok {
+				opts, err = parseOptions(m)
+			} else {
+				pathVal = args[0]
+			}
+		case 2:
+			pathVal = args[0]
+			opts, err = parseOptions(args[1])
+		}
+		if err != nil {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("parquet_read: %w", err), nil))
+		}
+
+		path, ok := common.ExtractUDFValue(pathVal).(string)
+		if !ok || path == "" {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "parquet_read: path must be a non-empty string, got %T", common.ExtractUDFValue(pathVal)), nil))
+		}
+
+		iter, err := Open(path, opts)
+		if err != nil {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("parquet_read: %w", err), nil))
+		}
+		return iter
+	})
+}
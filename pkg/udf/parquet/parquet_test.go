@@ -0,0 +1,203 @@
+package parquet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query, collecting every output
+func runGojqQueryAll(t *testing.T, query string, input any, options ...gojq.CompilerOption) []any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var results []any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+type address struct {
+	City string `parquet:"city"`
+	Zip  string `parquet:"zip,optional"`
+}
+
+type event struct {
+	ID      int64     `parquet:"id"`
+	Name    string    `parquet:"name"`
+	Score   float32   `parquet:"score"`
+	Active  bool      `parquet:"active"`
+	At      time.Time `parquet:"at,timestamp(millisecond)"`
+	Day     int32     `parquet:"day,date"`
+	Tags    []string  `parquet:"tags,list"`
+	Home    address   `parquet:"home"`
+	Comment *string   `parquet:"comment,optional"`
+}
+
+// writeEvents writes n events in row groups of groupSize rows
+func writeEvents(t *testing.T, n, groupSize int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "events.parquet")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := pq.NewGenericWriter[event](f)
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		e := event{
+			ID:     int64(i),
+			Name:   fmt.Sprintf("event-%d", i),
+			Score:  0.1 * float32(i),
+			Active: i%2 == 0,
+			At:     base.Add(time.Duration(i) * time.Minute),
+			Day:    int32(base.Unix()/86400) + int32(i),
+			Tags:   []string{"a", fmt.Sprint(i)},
+			Home:   address{City: "Oslo"},
+		}
+		if i == 0 {
+			c := "first"
+			e.Comment = &c
+		}
+		if _, err := w.Write([]event{e}); err != nil {
+			t.Fatal(err)
+		}
+		if (i+1)%groupSize == 0 {
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParquetRead(t *testing.T) {
+	path := writeEvents(t, 3, 10)
+
+	rows := runGojqQueryAll(t, `parquet_read`, path, RegisterParquetRead())
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d: %v", len(rows), rows)
+	}
+	want := map[string]any{
+		"id":      0,
+		"name":    "event-0",
+		"score":   0.0,
+		"active":  true,
+		"at":      "2024-03-01T12:00:00Z",
+		"day":     "2024-03-01",
+		"tags":    []any{"a", "0"},
+		"home":    map[string]any{"city": "Oslo", "zip": nil},
+		"comment": "first",
+	}
+	if !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("Row mismatch:\n got: %#v\nwant: %#v", rows[0], want)
+	}
+	second := rows[1].(map[string]any)
+	if second["score"] != 0.1 || second["comment"] != nil || second["at"] != "2024-03-01T12:01:00Z" {
+		t.Errorf("Unexpected second row %v", second)
+	}
+}
+
+func TestParquetReadOptions(t *testing.T) {
+	// 25 rows in row groups of 10, so offsets cross row group boundaries
+	path := writeEvents(t, 25, 10)
+	opt := RegisterParquetRead()
+
+	rows := runGojqQueryAll(t, `parquet_read(.; {columns: ["id", "name"], offset: 12, limit: 3})`, path, opt)
+	want := []any{
+		map[string]any{"id": 12, "name": "event-12"},
+		map[string]any{"id": 13, "name": "event-13"},
+		map[string]any{"id": 14, "name": "event-14"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Projection mismatch:\n got: %v\nwant: %v", rows, want)
+	}
+
+	rows = runGojqQueryAll(t, `[parquet_read({offset: 20}) | .id]`, path, opt)
+	if !reflect.DeepEqual(rows, []any{[]any{20, 21, 22, 23, 24}}) {
+		t.Errorf("Unexpected offset result %v", rows)
+	}
+
+	rows = runGojqQueryAll(t, `[parquet_read("`+path+`") | select(.active)] | length`, nil, opt)
+	if !reflect.DeepEqual(rows, []any{13}) {
+		t.Errorf("Expected 13 active rows, got %v", rows)
+	}
+
+	rows = runGojqQueryAll(t, `first(parquet_read) | .id`, path, opt)
+	if !reflect.DeepEqual(rows, []any{0}) {
+		t.Errorf("Expected first row, got %v", rows)
+	}
+
+	rows = runGojqQueryAll(t, `[parquet_read({offset: 100})] | length`, path, opt)
+	if !reflect.DeepEqual(rows, []any{0}) {
+		t.Errorf("Expected no rows past the end, got %v", rows)
+	}
+}
+
+func TestParquetReadErrors(t *testing.T) {
+	path := writeEvents(t, 1, 10)
+	opt := RegisterParquetRead()
+
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`parquet_read({columns: ["nope"]})`, path, `unknown column "nope"`},
+		{`parquet_read({limit: -1})`, path, "must not be negative"},
+		{`parquet_read({columns: "id"})`, path, "must be an array of strings"},
+		{`parquet_read`, "/nonexistent/file.parquet", "does not exist"},
+		{`parquet_read`, 42, "path must be a non-empty string"},
+		{`parquet_read`, filepath.Join("testdata", "missing"), "does not exist"},
+	}
+	for _, tt := range tests {
+		rows := runGojqQueryAll(t, tt.query, tt.input, opt)
+		if len(rows) != 1 {
+			t.Errorf("%s: expected a single error result, got %v", tt.query, rows)
+			continue
+		}
+		errStr := common.GetUDFError(rows[0])
+		if !strings.HasPrefix(errStr, "parquet_read: ") || !strings.Contains(errStr, tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.query, tt.want, rows[0])
+		}
+	}
+
+	notParquet := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(notParquet, []byte("a,b\n1,2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rows := runGojqQueryAll(t, `parquet_read`, notParquet, opt)
+	errStr := common.GetUDFError(rows[0])
+	if !strings.Contains(errStr, "invalid parquet file") {
+		t.Errorf("Expected invalid file error, got %v", rows)
+	}
+}
@@ -0,0 +1,285 @@
+// Package plugin runs UDFs shipped as separate executables. A plugin reads
+// JSON-RPC 2.0 requests from its standard input, one per line, and writes
+// one response line for each to its standard output. Standard error is
+// passed through.
+//
+// pwrq first sends the describe method, and the plugin answers with the
+// functions it provides:
+//
+//	{"jsonrpc":"2.0","id":1,"method":"describe"}
+//	{"jsonrpc":"2.0","id":1,"result":{"functions":[{"name":"rdns","min_args":0,"max_args":1,
+//	 "description":"Reverse DNS lookup","category":"Network","examples":["\"8.8.8.8\" | rdns"]}]}}
+//
+// A function may also give the jq types of its input and of its result
+// value, as "input":"string" and "output":"string", for pwrq graph.
+//
+// Each call of such a function is a call request. The input and arguments
+// are passed as JSON, with UDF results unwrapped to their _val. The result
+// value and meta become the _val and _meta of the UDF result, and an error
+// response becomes its _err, with the _err code and details of its data if
+// it has them:
+//
+//	{"jsonrpc":"2.0","id":2,"method":"call","params":{"function":"rdns","input":"8.8.8.8","args":[]}}
+//	{"jsonrpc":"2.0","id":2,"result":{"value":"dns.google","meta":{"ttl":300}}}
+//	{"jsonrpc":"2.0","id":2,"error":{"code":-32000,"message":"no PTR record","data":{"code":"ENOENT"}}}
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// DefaultCategory is the category of plugin functions that do not name one
+const DefaultCategory = "Plugin"
+
+// describeTimeout bounds how long a plugin may take to start and describe
+// its functions
+var describeTimeout = 5 * time.Second
+
+// Function describes a function provided by a plugin
+type Function struct {
+	Name        string   `json:"name"`
+	MinArgs     int      `json:"min_args"`
+	MaxArgs     int      `json:"max_args"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Examples    []string `json:"examples"`
+	Input       string   `json:"input,omitempty"`
+	Output      string   `json:"output,omitempty"`
+}
+
+var funcName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (f Function) validate() error {
+	if !funcName.MatchString(f.Name) {
+		return common.Errorf(common.CodeInvalid, "invalid function name %q", f.Name)
+	}
+	if f.MinArgs < 0 || f.MinArgs > f.MaxArgs || f.MaxArgs > 30 {
+		return common.Errorf(common.CodeInvalid, "function %v: invalid arity %d to %d", f.Name, f.MinArgs, f.MaxArgs)
+	}
+	return nil
+}
+
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type callParams struct {
+	Function string `json:"function"`
+	Input    any    `json:"input"`
+	Args     []any  `json:"args"`
+}
+
+type response struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			Code    string         `json:"code"`
+			Details map[string]any `json:"details"`
+		} `json:"data"`
+	} `json:"error"`
+}
+
+// Plugin is a running plugin process
+type Plugin struct {
+	Name      string // file name of the executable
+	Path      string
+	Functions []Function
+
+	mu     sync.Mutex // one request at a time
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	id     int
+	err    error // set once the plugin has failed
+}
+
+// Start runs the plugin at path and asks it for its functions
+func Start(path string, stderr io.Writer) (*Plugin, error) {
+	p := &Plugin{Name: filepath.Base(path), Path: path}
+	p.cmd = exec.Command(path)
+	p.cmd.Stderr = stderr
+	var err error
+	if p.stdin, err = p.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	p.stdout = bufio.NewReader(stdout)
+	if err := p.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	// A plugin that never answers is killed, which ends the read below
+	timer := time.AfterFunc(describeTimeout, func() { p.cmd.Process.Kill() })
+	var result struct {
+		Functions []Function `json:"functions"`
+	}
+	err = p.request("describe", nil, &result)
+	if !timer.Stop() {
+		err = fmt.Errorf("no answer to describe within %v", describeTimeout)
+	}
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	for i, f := range result.Functions {
+		if err := f.validate(); err != nil {
+			p.Close()
+			return nil, err
+		}
+		if f.Category == "" {
+			result.Functions[i].Category = DefaultCategory
+		}
+	}
+	p.Functions = result.Functions
+	return p, nil
+}
+
+// request sends a request and decodes the result into v. Once the plugin
+// has exited or broken the protocol, every request fails
+func (p *Plugin) request(method string, params, v any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.id++
+	line, err := json.Marshal(request{JSONRPC: "2.0", ID: p.id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		p.err = fmt.Errorf("plugin is not running: %w", err)
+		return p.err
+	}
+	reply, err := p.stdout.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = errors.New("plugin exited")
+		}
+		p.err = err
+		return p.err
+	}
+	var resp response
+	if err := json.Unmarshal(reply, &resp); err != nil || resp.ID != p.id {
+		p.err = common.Errorf(common.CodeInvalid, "invalid response %q", strings.TrimSpace(string(reply)))
+		return p.err
+	}
+	if resp.Error != nil {
+		return &common.UDFError{Code: resp.Error.Data.Code, Message: resp.Error.Message, Details: resp.Error.Data.Details}
+	}
+	return json.Unmarshal(resp.Result, v)
+}
+
+// Call runs a function of the plugin
+func (p *Plugin) Call(function string, input any, args []any) (any, map[string]any, error) {
+	var result struct {
+		Value any            `json:"value"`
+		Meta  map[string]any `json:"meta"`
+	}
+	err := p.request("call", callParams{Function: function, Input: input, Args: args}, &result)
+	return result.Value, result.Meta, err
+}
+
+// Close ends the plugin by closing its standard input, and kills it if it
+// does not exit soon after
+func (p *Plugin) Close() error {
+	p.stdin.Close()
+	timer := time.AfterFunc(time.Second, func() { p.cmd.Process.Kill() })
+	defer timer.Stop()
+	return p.cmd.Wait()
+}
+
+// Options returns the compiler options registering the plugin's functions
+func (p *Plugin) Options() []gojq.CompilerOption {
+	options := make([]gojq.CompilerOption, len(p.Functions))
+	for i, f := range p.Functions {
+		options[i] = common.WithFunction(f.Name, f.MinArgs, f.MaxArgs, func(v any, args []any) any {
+			var value any
+			var meta map[string]any
+			// A plugin is an external program, out of reach of the sandbox
+			err := common.CheckExec()
+			if err == nil {
+				unwrapped := make([]any, len(args))
+				for i, arg := range args {
+					unwrapped[i] = common.ExtractUDFValue(arg)
+				}
+				value, meta, err = p.Call(f.Name, common.ExtractUDFValue(v), unwrapped)
+			}
+			if meta == nil {
+				meta = map[string]any{}
+			}
+			meta["operation"] = f.Name
+			meta["plugin"] = p.Name
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("%v: %w", f.Name, err), meta)
+			}
+			return common.MakeUDFSuccessResult(value, meta)
+		})
+	}
+	return options
+}
+
+// Discover starts the plugins in dirs: executable files not starting with
+// a dot, in name order. A missing directory has no plugins. Plugins that
+// fail to start are reported in errs and skipped
+func Discover(dirs []string, stderr io.Writer) (plugins []*Plugin, errs []error) {
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || !isExecutable(entry.Name(), info) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			p, err := Start(path, stderr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("plugin %v: %w", path, err))
+				continue
+			}
+			plugins = append(plugins, p)
+		}
+	}
+	return plugins, errs
+}
+
+func isExecutable(name string, info os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(name), ".exe")
+	}
+	return info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
@@ -0,0 +1,197 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
+)
+
+// The test binary doubles as the plugin, run by a shell script that sets
+// PWRQ_TEST_PLUGIN to the behavior wanted
+func TestMain(m *testing.M) {
+	if mode := os.Getenv("PWRQ_TEST_PLUGIN"); mode != "" {
+		fakePlugin(mode)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func fakePlugin(mode string) {
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Function string `json:"function"`
+				Input    any    `json:"input"`
+				Args     []any  `json:"args"`
+			} `json:"params"`
+		}
+		json.Unmarshal(in.Bytes(), &req)
+		reply := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		switch {
+		case mode == "silent":
+			time.Sleep(time.Minute)
+		case mode == "exit":
+			return
+		case mode == "garbage":
+			fmt.Println("not json")
+			continue
+		case req.Method == "describe" && mode == "badname":
+			reply["result"] = map[string]any{"functions": []any{map[string]any{"name": "bad-name"}}}
+		case req.Method == "describe":
+			reply["result"] = map[string]any{"functions": []any{
+				map[string]any{"name": "double", "min_args": 0, "max_args": 1, "description": "Multiply the input", "category": "Math"},
+				map[string]any{"name": "crash", "min_args": 0, "max_args": 0},
+			}}
+		case req.Params.Function == "crash":
+			return
+		case req.Params.Function == "double":
+			n, ok := req.Params.Input.(float64)
+			if !ok {
+				reply["error"] = map[string]any{"code": -32000, "message": fmt.Sprintf("input must be a number, got %v", req.Params.Input),
+					"data": map[string]any{"code": "ENAN", "details": map[string]any{"input": req.Params.Input}}}
+				break
+			}
+			factor := 2.0
+			if len(req.Params.Args) > 0 {
+				factor = req.Params.Args[0].(float64)
+			}
+			reply["result"] = map[string]any{"value": n * factor, "meta": map[string]any{"factor": factor}}
+		}
+		line, _ := json.Marshal(reply)
+		fmt.Println(string(line))
+	}
+}
+
+func writePlugin(t *testing.T, dir, name, mode string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts in these tests")
+	}
+	path := filepath.Join(dir, name)
+	script := fmt.Sprintf("#!/bin/sh\nPWRQ_TEST_PLUGIN=%s exec '%s'\n", mode, os.Args[0])
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "calc", "ok")
+	writePlugin(t, dir, ".hidden", "ok")
+	writePlugin(t, dir, "broken", "exit")
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	plugins, errs := Discover([]string{dir, filepath.Join(dir, "missing")}, io.Discard)
+	defer func() {
+		for _, p := range plugins {
+			p.Close()
+		}
+	}()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "broken: plugin exited") {
+		t.Errorf("errs = %v, want the broken plugin", errs)
+	}
+	if len(plugins) != 1 || plugins[0].Name != "calc" {
+		t.Fatalf("plugins = %v, want calc", plugins)
+	}
+	want := []Function{
+		{Name: "double", MinArgs: 0, MaxArgs: 1, Description: "Multiply the input", Category: "Math"},
+		{Name: "crash", Category: DefaultCategory},
+	}
+	if !reflect.DeepEqual(plugins[0].Functions, want) {
+		t.Errorf("functions = %+v, want %+v", plugins[0].Functions, want)
+	}
+}
+
+func runQuery(t *testing.T, p *Plugin, query string, input any) []any {
+	t.Helper()
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(q, p.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			return results
+		}
+		if err, ok := v.(error); ok {
+			t.Fatal(err)
+		}
+		results = append(results, v)
+	}
+}
+
+func TestCall(t *testing.T) {
+	p, err := Start(writePlugin(t, t.TempDir(), "calc", "ok"), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	got := runQuery(t, p, `double, double(10), ({_val: 4, _meta: {}} | double), ("x" | double)`, 3)
+	want := []any{
+		map[string]any{"_schema": 2, "_val": 6.0, "_meta": map[string]any{"factor": 2.0, "operation": "double", "plugin": "calc"}},
+		map[string]any{"_schema": 2, "_val": 30.0, "_meta": map[string]any{"factor": 10.0, "operation": "double", "plugin": "calc"}},
+		map[string]any{"_schema": 2, "_val": 8.0, "_meta": map[string]any{"factor": 2.0, "operation": "double", "plugin": "calc"}},
+		map[string]any{"_schema": 2, "_val": nil, "_meta": map[string]any{"operation": "double", "plugin": "calc"}, "_err": map[string]any{"code": "ENAN", "message": "double: input must be a number, got x", "function": "double", "retryable": false,
+			"details": map[string]any{"input": "x"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Once the plugin is gone, every call fails
+	got = runQuery(t, p, `crash, double | ._err.message`, 3)
+	if !reflect.DeepEqual(got, []any{"crash: plugin exited", "double: plugin exited"}) {
+		t.Errorf("after exit got %v", got)
+	}
+}
+
+func TestStartErrors(t *testing.T) {
+	defer func(d time.Duration) { describeTimeout = d }(describeTimeout)
+	dir := t.TempDir()
+	tests := []struct {
+		mode    string
+		timeout time.Duration
+		want    string
+	}{
+		{"badname", 5 * time.Second, `invalid function name "bad-name"`},
+		{"exit", 5 * time.Second, "plugin exited"},
+		{"garbage", 5 * time.Second, `invalid response "not json"`},
+		{"silent", 200 * time.Millisecond, "no answer to describe within 200ms"},
+	}
+	for _, tt := range tests {
+		describeTimeout = tt.timeout
+		p, err := Start(writePlugin(t, dir, tt.mode, tt.mode), io.Discard)
+		if err == nil {
+			p.Close()
+			t.Errorf("%s: expected an error", tt.mode)
+		} else if err.Error() != tt.want {
+			t.Errorf("%s: got error %q, want %q", tt.mode, err, tt.want)
+		}
+	}
+}
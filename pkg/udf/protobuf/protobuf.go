@@ -0,0 +1,367 @@
+package protobuf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// maxDepth bounds how deeply length-delimited fields are guessed as messages
+const maxDepth = 64
+
+// Options are the settings accepted by protobuf_decode
+type Options struct {
+	File          bool   // input is a file path
+	Encoding      string // "raw" (default), "base64", or "hex"
+	DescriptorSet string // path to a FileDescriptorSet (protoc -o / buf build -o)
+	Message       string // fully qualified message name, required with DescriptorSet
+}
+
+func parseOptions(v any) (Options, error) {
+	var opts Options
+	m, ok := common.ExtractUDFValue(v).(map[string]any)
+	if !ok {
+		return opts, common.Errorf(common.CodeInvalid, "options must be an object, got %T", common.ExtractUDFValue(v))
+	}
+	if file, ok := m["file"].(bool); ok {
+		opts.File = file
+	}
+	if enc, ok := m["encoding"].(string); ok {
+		opts.Encoding = enc
+	}
+	if ds, ok := m["descriptor_set"].(string); ok {
+		opts.DescriptorSet = ds
+	}
+	if msg, ok := m["message"].(string); ok {
+		opts.Message = strings.TrimPrefix(msg, ".")
+	}
+	if opts.DescriptorSet != "" && opts.Message == "" {
+		return opts, common.Errorf(common.CodeInvalid, "options.message is required with descriptor_set")
+	}
+	return opts, nil
+}
+
+// decodeInput converts the text form of the payload into bytes
+func decodeInput(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", "raw":
+		return data, nil
+	case "base64":
+		s := strings.TrimSpace(string(data))
+		if decoded, err := base64.StdEncoding.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+		if decoded, err := base64.URLEncoding.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+		return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	case "hex":
+		return hex.DecodeString(strings.TrimSpace(string(data)))
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "unsupported encoding %q (supported: raw, base64, hex)", encoding)
+	}
+}
+
+// uintValue returns v as an int when it fits, otherwise as a *big.Int
+func uintValue(v uint64) any {
+	if v <= math.MaxInt64 && uint64(int(v)) == v {
+		return int(v)
+	}
+	return new(big.Int).SetUint64(v)
+}
+
+// isText reports whether b looks like human-readable UTF-8
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeRaw decodes a message without a schema. Every field becomes an entry
+// with its number, wire type, and value. Length-delimited fields are guessed
+// as text, then as a nested message, then fall back to base64 bytes
+func DecodeRaw(b []byte) ([]any, error) {
+	fields, rest, err := decodeFields(b, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, common.Errorf(common.CodeInvalid, "unexpected end group")
+	}
+	return fields, nil
+}
+
+// decodeFields decodes fields until the input ends or, inside a group, until
+// the matching end-group tag. It returns the remaining input
+func decodeFields(b []byte, depth int, inGroup bool) ([]any, []byte, error) {
+	fields := []any{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, nil, common.Errorf(common.CodeInvalid, "invalid tag: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+		entry := map[string]any{"field": int(num)}
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, nil, common.Errorf(common.CodeInvalid, "field %d: invalid varint: %w", num, protowire.ParseError(n))
+			}
+			b = b[n:]
+			entry["wire_type"] = "varint"
+			entry["value"] = uintValue(v)
+			if int64(v) < 0 {
+				entry["int"] = int(int64(v))
+			}
+			entry["sint"] = int(protowire.DecodeZigZag(v))
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(b)
+			if n < 0 {
+				return nil, nil, common.Errorf(common.CodeInvalid, "field %d: invalid fixed32: %w", num, protowire.ParseError(n))
+			}
+			b = b[n:]
+			entry["wire_type"] = "fixed32"
+			entry["value"] = int(v)
+			entry["float"] = floatValue(float64(math.Float32frombits(v)))
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return nil, nil, common.Errorf(common.CodeInvalid, "field %d: invalid fixed64: %w", num, protowire.ParseError(n))
+			}
+			b = b[n:]
+			entry["wire_type"] = "fixed64"
+			entry["value"] = uintValue(v)
+			entry["double"] = floatValue(math.Float64frombits(v))
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, nil, common.Errorf(common.CodeInvalid, "field %d: invalid length-delimited value: %w", num, protowire.ParseError(n))
+			}
+			b = b[n:]
+			entry["wire_type"] = "bytes"
+			guessBytes(entry, v, depth)
+		case protowire.StartGroupType:
+			if depth >= maxDepth {
+				return nil, nil, common.Errorf(common.CodeInvalid, "field %d: groups nested too deeply", num)
+			}
+			group, rest, err := decodeFields(b, depth+1, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			b = rest
+			entry["wire_type"] = "group"
+			entry["value"] = group
+		case protowire.EndGroupType:
+			if !inGroup {
+				return nil, nil, common.Errorf(common.CodeInvalid, "field %d: unexpected end group", num)
+			}
+			return fields, b, nil
+		default:
+			return nil, nil, common.Errorf(common.CodeInvalid, "field %d: unknown wire type %d", num, typ)
+		}
+		fields = append(fields, entry)
+	}
+	if inGroup {
+		return nil, nil, common.Errorf(common.CodeInvalid, "unterminated group")
+	}
+	return fields, b, nil
+}
+
+// guessBytes fills in the type and value of a length-delimited field
+func guessBytes(entry map[string]any, v []byte, depth int) {
+	if len(v) > 0 && isText(v) {
+		entry["type"] = "string"
+		entry["value"] = string(v)
+		return
+	}
+	if len(v) > 0 && depth < maxDepth {
+		if nested, rest, err := decodeFields(v, depth+1, false); err == nil && len(rest) == 0 {
+			entry["type"] = "message"
+			entry["value"] = nested
+			return
+		}
+	}
+	if len(v) == 0 {
+		entry["type"] = "string"
+		entry["value"] = ""
+		return
+	}
+	entry["type"] = "bytes"
+	entry["value"] = base64.StdEncoding.EncodeToString(v)
+}
+
+// floatValue keeps NaN and infinities representable in JSON
+func floatValue(f float64) any {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprint(f)
+	}
+	return f
+}
+
+// DecodeWithDescriptor decodes b as the named message using a serialized
+// FileDescriptorSet and returns its protojson form with original field names
+func DecodeWithDescriptor(b, descriptorSet []byte, messageName string) (any, error) {
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptorSet, &fds); err != nil {
+		return nil, common.Errorf(common.CodeInvalid, "invalid FileDescriptorSet: %w", err)
+	}
+	files, err := protodesc.NewFiles(&fds)
+	if err != nil {
+		return nil, common.Errorf(common.CodeInvalid, "invalid FileDescriptorSet: %w", err)
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(messageName))
+	if err != nil {
+		return nil, common.Errorf(common.CodeNotFound, "message %q not found in descriptor set", messageName)
+	}
+	msgDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, common.Errorf(common.CodeInvalid, "%q is not a message", messageName)
+	}
+
+	msg := dynamicpb.NewMessage(msgDesc)
+	if err := (proto.UnmarshalOptions{Resolver: dynamicpb.NewTypes(files)}).Unmarshal(b, msg); err != nil {
+		return nil, fmt.Errorf("failed to decode %v: %w", messageName, err)
+	}
+	out, err := protojson.MarshalOptions{UseProtoNames: true, Resolver: dynamicpb.NewTypes(files)}.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %v to JSON: %w", messageName, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+	var result any
+	if err := dec.Decode(&result); err != nil {
+		return nil, err
+	}
+	return fromJSONNumbers(result), nil
+}
+
+// fromJSONNumbers converts json.Number values into ints or floats
+func fromJSONNumbers(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = fromJSONNumbers(item)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = fromJSONNumbers(item)
+		}
+		return val
+	case json.Number:
+		if n, err := val.Int64(); err == nil && int64(int(n)) == n {
+			return int(n)
+		}
+		f, _ := val.Float64()
+		return f
+	default:
+		return val
+	}
+}
+
+// RegisterProtobufDecode registers the protobuf_decode function with gojq
+func RegisterProtobufDecode() gojq.CompilerOption {
+	return common.WithFunction("protobuf_decode", 0, 2, func(v any, args []any) any {
+		// protobuf_decode, protobuf_decode(file), protobuf_decode(options),
+		// or protobuf_decode(input; options)
+		inputVal := v
+		var opts Options
+		var err error
+		switch len(args) {
+		case 1:
+			if file, ok := args[0].(bool); ok {
+				opts.File = file
+			} else if opts, err = parseOptions(args[0]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("protobuf_decode: %w", err), nil)
+			}
+		case 2:
+			inputVal = args[0]
+			if opts, err = parseOptions(args[1]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("protobuf_decode: %w", err), nil)
+			}
+		}
+		inputVal = common.ExtractUDFValue(inputVal)
+
+		meta := map[string]any{
+			"operation": "protobuf_decode",
+		}
+
+		var data []byte
+		if opts.File {
+			filePathStr, ok := inputVal.(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "protobuf_decode: file argument requires string path, got %T", inputVal), nil)
+			}
+			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("protobuf_decode: %w", err), meta)
+			}
+			data = fileData
+			meta["file_path"] = absPath
+			meta["file_size"] = int(size)
+		} else {
+			switch val := inputVal.(type) {
+			case string:
+				data = []byte(val)
+			case []byte:
+				data = val
+			default:
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "protobuf_decode: input must be a string or bytes, got %T", val), nil)
+			}
+		}
+
+		data, err = decodeInput(data, opts.Encoding)
+		if err != nil {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "protobuf_decode: invalid %v input: %w", opts.Encoding, err), meta)
+		}
+		meta["input_length"] = len(data)
+
+		if opts.DescriptorSet == "" {
+			fields, err := DecodeRaw(data)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("protobuf_decode: %w", err), meta)
+			}
+			meta["mode"] = "raw"
+			meta["fields"] = len(fields)
+			return common.MakeUDFSuccessResult(fields, meta)
+		}
+
+		descriptorSet, absPath, _, err := common.ReadFileFromPath(opts.DescriptorSet)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("protobuf_decode: descriptor_set: %w", err), meta)
+		}
+		meta["mode"] = "descriptor"
+		meta["descriptor_set"] = absPath
+		meta["message"] = opts.Message
+		result, err := DecodeWithDescriptor(data, descriptorSet, opts.Message)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("protobuf_decode: %w", err), meta)
+		}
+		return common.MakeUDFSuccessResult(result, meta)
+	})
+}
@@ -0,0 +1,246 @@
+package protobuf
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+// testDescriptorSet builds a FileDescriptorSet for:
+//
+//	package demo;
+//	message Address { string city = 1; }
+//	message Person { string name = 1; int32 id = 2; repeated string tags = 3; Address home = 4; }
+func testDescriptorSet(t *testing.T) *descriptorpb.FileDescriptorSet {
+	t.Helper()
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(num),
+			Type:     typ.Enum(),
+			Label:    label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	opt := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	rep := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	return &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("demo.proto"),
+			Package: proto.String("demo"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{
+				{
+					Name:  proto.String("Address"),
+					Field: []*descriptorpb.FieldDescriptorProto{field("city", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt, "")},
+				},
+				{
+					Name: proto.String("Person"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt, ""),
+						field("id", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, opt, ""),
+						field("tags", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, rep, ""),
+						field("home", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, opt, ".demo.Address"),
+					},
+				},
+			},
+		}},
+	}
+}
+
+// personBytes is demo.Person{name: "Ada", id: 150, tags: ["x", "y"], home: {city: "London"}}
+func personBytes() []byte {
+	var home []byte
+	home = protowire.AppendTag(home, 1, protowire.BytesType)
+	home = protowire.AppendString(home, "London")
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, "Ada")
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, 150)
+	for _, tag := range []string{"x", "y"} {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, tag)
+	}
+	b = protowire.AppendTag(b, 4, protowire.BytesType)
+	b = protowire.AppendBytes(b, home)
+	return b
+}
+
+func TestDecodeRaw(t *testing.T) {
+	fields, err := DecodeRaw([]byte{0x08, 0x96, 0x01})
+	if err != nil {
+		t.Fatalf("DecodeRaw failed: %v", err)
+	}
+	want := []any{map[string]any{"field": 1, "wire_type": "varint", "value": 150, "sint": 75}}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("DecodeRaw mismatch:\n got: %v\nwant: %v", fields, want)
+	}
+
+	fields, err = DecodeRaw(personBytes())
+	if err != nil {
+		t.Fatalf("DecodeRaw failed: %v", err)
+	}
+	if len(fields) != 5 {
+		t.Fatalf("Expected 5 fields, got %v", fields)
+	}
+	name := fields[0].(map[string]any)
+	if name["type"] != "string" || name["value"] != "Ada" {
+		t.Errorf("Expected string guess for field 1, got %v", name)
+	}
+	home := fields[4].(map[string]any)
+	if home["type"] != "message" {
+		t.Fatalf("Expected nested message guess for field 4, got %v", home)
+	}
+	city := home["value"].([]any)[0].(map[string]any)
+	if city["field"] != 1 || city["value"] != "London" {
+		t.Errorf("Unexpected nested field %v", city)
+	}
+
+	// Fixed-width fields carry their float interpretation, binary blobs stay base64
+	var b []byte
+	b = protowire.AppendTag(b, 5, protowire.Fixed32Type)
+	b = protowire.AppendFixed32(b, 0x3fc00000) // 1.5
+	b = protowire.AppendTag(b, 6, protowire.BytesType)
+	b = protowire.AppendBytes(b, []byte{0xff, 0x00})
+	fields, err = DecodeRaw(b)
+	if err != nil {
+		t.Fatalf("DecodeRaw failed: %v", err)
+	}
+	if f := fields[0].(map[string]any); f["wire_type"] != "fixed32" || f["float"] != 1.5 {
+		t.Errorf("Unexpected fixed32 field %v", f)
+	}
+	if f := fields[1].(map[string]any); f["type"] != "bytes" || f["value"] != "/wA=" {
+		t.Errorf("Unexpected bytes field %v", f)
+	}
+
+	for _, input := range [][]byte{{0x08}, {0x0a, 0x05, 'a'}, {0x0c}, {0x0b, 0x08, 0x01}} {
+		if _, err := DecodeRaw(input); err == nil {
+			t.Errorf("Expected error for % x", input)
+		}
+	}
+}
+
+func TestProtobufDecodeUDF(t *testing.T) {
+	opt := RegisterProtobufDecode()
+	encoded := base64.StdEncoding.EncodeToString(personBytes())
+
+	result := runGojqQuery(t, `protobuf_decode({encoding: "base64"}) | ._val[1].value`, encoded, opt)
+	if result != 150 {
+		t.Errorf("Expected 150, got %v", result)
+	}
+
+	result = runGojqQuery(t, `protobuf_decode(.; {encoding: "hex"}) | ._meta`, "089601", opt)
+	meta := result.(map[string]any)
+	if meta["mode"] != "raw" || meta["fields"] != 1 || meta["input_length"] != 3 {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+
+	path := filepath.Join(t.TempDir(), "person.bin")
+	if err := os.WriteFile(path, personBytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result = runGojqQuery(t, `protobuf_decode(true) | ._val[0].value`, path, opt)
+	if result != "Ada" {
+		t.Errorf("Expected Ada, got %v", result)
+	}
+
+	result = runGojqQuery(t, `protobuf_decode({encoding: "base64"})`, "!!!", opt)
+	errStr := common.GetUDFError(result)
+	if !strings.HasPrefix(errStr, "protobuf_decode: invalid base64 input") {
+		t.Errorf("Expected base64 error, got %v", result)
+	}
+
+	result = runGojqQuery(t, `protobuf_decode`, 42, opt)
+	errStr = common.GetUDFError(result)
+	if !strings.Contains(errStr, "must be a string") {
+		t.Errorf("Expected type error, got %v", result)
+	}
+
+	result = runGojqQuery(t, `protobuf_decode({descriptor_set: "x.pb"})`, "", opt)
+	errStr = common.GetUDFError(result)
+	if !strings.Contains(errStr, "options.message is required") {
+		t.Errorf("Expected missing message error, got %v", result)
+	}
+}
+
+func TestProtobufDecodeDescriptor(t *testing.T) {
+	fdsBytes, err := proto.Marshal(testDescriptorSet(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	fdsPath := filepath.Join(dir, "demo.pb")
+	if err := os.WriteFile(fdsPath, fdsBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dataPath := filepath.Join(dir, "person.bin")
+	if err := os.WriteFile(dataPath, personBytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := RegisterProtobufDecode()
+	query := `protobuf_decode({file: true, descriptor_set: "` + fdsPath + `", message: "demo.Person"})`
+	result := runGojqQuery(t, query, dataPath, opt).(map[string]any)
+	want := map[string]any{
+		"name": "Ada",
+		"id":   150,
+		"tags": []any{"x", "y"},
+		"home": map[string]any{"city": "London"},
+	}
+	if !reflect.DeepEqual(result["_val"], want) {
+		t.Errorf("Descriptor decode mismatch:\n got: %v\nwant: %v", result["_val"], want)
+	}
+	meta := result["_meta"].(map[string]any)
+	if meta["mode"] != "descriptor" || meta["message"] != "demo.Person" {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+
+	query = `protobuf_decode({file: true, descriptor_set: "` + fdsPath + `", message: "demo.Missing"})`
+	result = runGojqQuery(t, query, dataPath, opt).(map[string]any)
+	errStr := common.GetUDFError(result)
+	if !strings.Contains(errStr, "not found in descriptor set") {
+		t.Errorf("Expected not found error, got %v", result)
+	}
+}
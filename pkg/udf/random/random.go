@@ -0,0 +1,228 @@
+package random
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// maxLength bounds the bytes or characters generated in one call
+const maxLength = 1 << 20
+
+// Charsets are the named character sets of random_string; any other string
+// is used as the set of characters itself
+var Charsets = map[string]string{
+	"alnum":   "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"alpha":   "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"lower":   "abcdefghijklmnopqrstuvwxyz",
+	"upper":   "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"digits":  "0123456789",
+	"hex":     "0123456789abcdef",
+	"base32":  "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567",
+	"base64":  "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/",
+	"urlsafe": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_",
+	"printable": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789" +
+		"!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+}
+
+// lengthArg reads a byte or character count
+func lengthArg(raw any) (int, error) {
+	var n int
+	switch val := common.ExtractUDFValue(raw).(type) {
+	case int:
+		n = val
+	case float64:
+		if val != math.Trunc(val) || math.Abs(val) > maxLength+1 {
+			return 0, common.Errorf(common.CodeInvalid, "length must be an integer, got %v", val)
+		}
+		n = int(val)
+	default:
+		return 0, common.Errorf(common.CodeInvalid, "length must be a number, got %T", val)
+	}
+	if n < 0 || n > maxLength {
+		return 0, common.Errorf(common.CodeInvalid, "length must be from 0 to %d, got %d", maxLength, n)
+	}
+	return n, nil
+}
+
+// integerArg reads a bound of random_int
+func integerArg(name string, raw any) (*big.Int, error) {
+	switch val := common.ExtractUDFValue(raw).(type) {
+	case int:
+		return big.NewInt(int64(val)), nil
+	case float64:
+		if val != math.Trunc(val) || math.IsInf(val, 0) {
+			return nil, common.Errorf(common.CodeInvalid, "%v must be an integer, got %v", name, val)
+		}
+		n, _ := big.NewFloat(val).Int(nil)
+		return n, nil
+	case *big.Int:
+		return val, nil
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "%v must be an integer, got %T", name, val)
+	}
+}
+
+// Encode writes b in format: "hex", "base64", "base64url", "base32" or
+// "raw" for a string of the bytes themselves
+func Encode(b []byte, format string) (string, error) {
+	switch format {
+	case "hex":
+		return hex.EncodeToString(b), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(b), nil
+	case "base32":
+		return base32.StdEncoding.EncodeToString(b), nil
+	case "raw":
+		return string(b), nil
+	}
+	return "", common.Errorf(common.CodeInvalid, `format must be "hex", "base64", "base64url", "base32" or "raw", got %q`, format)
+}
+
+// String returns n characters picked uniformly from chars
+func String(n int, chars []rune) (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(chars)))
+	for range n {
+		i, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune(chars[i.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// Int returns an integer picked uniformly from min to max, both included
+func Int(min, max *big.Int) (*big.Int, error) {
+	span := new(big.Int).Sub(max, min)
+	n, err := rand.Int(rand.Reader, span.Add(span, big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	return n.Add(n, min), nil
+}
+
+// RegisterRandomBytes registers the random_bytes function with gojq
+func RegisterRandomBytes() gojq.CompilerOption {
+	return common.WithFunction("random_bytes", 1, 2, func(v any, args []any) any {
+		// random_bytes(n) is hex; random_bytes(n; format) picks the encoding
+		n, err := lengthArg(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("random_bytes: %w", err), nil)
+		}
+		format := "hex"
+		if len(args) > 1 {
+			s, ok := common.ExtractUDFValue(args[1]).(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "random_bytes: format must be a string, got %T", common.ExtractUDFValue(args[1])), nil)
+			}
+			format = strings.ToLower(s)
+		}
+		if _, err := Encode(nil, format); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("random_bytes: %w", err), nil)
+		}
+
+		b := make([]byte, n)
+		if _, err := rand.Read(b); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("random_bytes: %w", err), nil)
+		}
+		out, _ := Encode(b, format)
+		return common.MakeUDFSuccessResult(out, map[string]any{
+			"operation": "random_bytes",
+			"length":    n,
+			"bits":      n * 8,
+			"format":    format,
+		})
+	})
+}
+
+// RegisterRandomString registers the random_string function with gojq
+func RegisterRandomString() gojq.CompilerOption {
+	return common.WithFunction("random_string", 1, 2, func(v any, args []any) any {
+		// random_string(n; charset) takes a name from Charsets or the
+		// characters to pick from; the default is alnum
+		n, err := lengthArg(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("random_string: %w", err), nil)
+		}
+		charset := "alnum"
+		if len(args) > 1 {
+			s, ok := common.ExtractUDFValue(args[1]).(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "random_string: charset must be a string, got %T", common.ExtractUDFValue(args[1])), nil)
+			}
+			charset = s
+		}
+		chars := charset
+		if named, ok := Charsets[charset]; ok {
+			chars = named
+		}
+		if !utf8.ValidString(chars) {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "random_string: charset is not valid UTF-8"), nil)
+		}
+		// Repeated characters would be picked more often
+		runes := []rune(chars)
+		slices.Sort(runes)
+		runes = slices.Compact(runes)
+		if len(runes) == 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "random_string: charset is empty"), nil)
+		}
+
+		s, err := String(n, runes)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("random_string: %w", err), nil)
+		}
+		return common.MakeUDFSuccessResult(s, map[string]any{
+			"operation":    "random_string",
+			"length":       n,
+			"charset":      charset,
+			"charset_size": len(runes),
+			"bits":         float64(n) * math.Log2(float64(len(runes))),
+		})
+	})
+}
+
+// RegisterRandomInt registers the random_int function with gojq
+func RegisterRandomInt() gojq.CompilerOption {
+	return common.WithFunction("random_int", 2, 2, func(v any, args []any) any {
+		// Both bounds are included, so random_int(1; 6) rolls a die
+		min, err := integerArg("min", args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("random_int: %w", err), nil)
+		}
+		max, err := integerArg("max", args[1])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("random_int: %w", err), nil)
+		}
+		if min.Cmp(max) > 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "random_int: min %v is greater than max %v", min, max), nil)
+		}
+
+		n, err := Int(min, max)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("random_int: %w", err), nil)
+		}
+		var val any = n
+		if n.IsInt64() && n.Int64() >= math.MinInt && n.Int64() <= math.MaxInt {
+			val = int(n.Int64())
+		}
+		return common.MakeUDFSuccessResult(val, map[string]any{
+			"operation": "random_int",
+			"min":       min.String(),
+			"max":       max.String(),
+		})
+	})
+}
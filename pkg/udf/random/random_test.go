@@ -0,0 +1,152 @@
+package random
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+var randomOpts = []gojq.CompilerOption{RegisterRandomBytes(), RegisterRandomString(), RegisterRandomInt()}
+
+func TestRandomBytes(t *testing.T) {
+	tests := []struct {
+		query  string
+		decode func(string) ([]byte, error)
+		length int
+	}{
+		{`random_bytes(16)`, hex.DecodeString, 16},
+		{`random_bytes(16; "hex")`, hex.DecodeString, 16},
+		{`random_bytes(32; "base64")`, base64.StdEncoding.DecodeString, 32},
+		{`random_bytes(12; "BASE64URL")`, base64.RawURLEncoding.DecodeString, 12},
+		{`random_bytes(0)`, hex.DecodeString, 0},
+		{`random_bytes(5; "raw")`, func(s string) ([]byte, error) { return []byte(s), nil }, 5},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, nil, randomOpts...).(map[string]any)
+		s, ok := res["_val"].(string)
+		if !ok {
+			t.Fatalf("%s = %v", tt.query, res)
+		}
+		b, err := tt.decode(s)
+		if err != nil || len(b) != tt.length {
+			t.Errorf("%s = %q: %d bytes, %v", tt.query, s, len(b), err)
+		}
+		if got := res["_meta"].(map[string]any)["bits"]; got != tt.length*8 {
+			t.Errorf("%s bits = %v", tt.query, got)
+		}
+	}
+
+	a := runGojqQuery(t, `random_bytes(16) | ._val`, nil, randomOpts...)
+	b := runGojqQuery(t, `random_bytes(16) | ._val`, nil, randomOpts...)
+	if a == b {
+		t.Errorf("two calls gave the same bytes %v", a)
+	}
+}
+
+func TestRandomString(t *testing.T) {
+	tests := []struct {
+		query   string
+		length  int
+		allowed string
+		size    int
+	}{
+		{`random_string(20)`, 20, Charsets["alnum"], 62},
+		{`random_string(10; "digits")`, 10, "0123456789", 10},
+		{`random_string(8; "hex")`, 8, "0123456789abcdef", 16},
+		{`random_string(30; "ab")`, 30, "ab", 2},
+		{`random_string(30; "aab")`, 30, "ab", 2},
+		{`random_string(6; "αβγ")`, 6, "αβγ", 3},
+		{`random_string(0)`, 0, "", 62},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, nil, randomOpts...).(map[string]any)
+		s := res["_val"].(string)
+		if n := len([]rune(s)); n != tt.length {
+			t.Errorf("%s = %q: %d characters, want %d", tt.query, s, n, tt.length)
+		}
+		for _, r := range s {
+			if !strings.ContainsRune(tt.allowed, r) {
+				t.Errorf("%s = %q: unexpected %q", tt.query, s, r)
+			}
+		}
+		if got := res["_meta"].(map[string]any)["charset_size"]; got != tt.size {
+			t.Errorf("%s charset_size = %v, want %d", tt.query, got, tt.size)
+		}
+	}
+}
+
+func TestRandomInt(t *testing.T) {
+	seen := map[int]bool{}
+	for range 200 {
+		n := runGojqQuery(t, `random_int(1; 6) | ._val`, nil, randomOpts...).(int)
+		if n < 1 || n > 6 {
+			t.Fatalf("random_int(1; 6) = %d", n)
+		}
+		seen[n] = true
+	}
+	if len(seen) != 6 {
+		t.Errorf("random_int(1; 6) gave only %v in 200 rolls", seen)
+	}
+
+	if got := runGojqQuery(t, `random_int(-5; -5) | ._val`, nil, randomOpts...); got != -5 {
+		t.Errorf("random_int(-5; -5) = %v", got)
+	}
+	big := runGojqQuery(t, `random_int(100000000000000000000; 100000000000000000001) | ._meta.min`, nil, randomOpts...)
+	if big != "100000000000000000000" {
+		t.Errorf("big min = %v", big)
+	}
+}
+
+func TestRandomErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`random_bytes(-1)`, "random_bytes: length must be from 0 to"},
+		{`random_bytes(1.5)`, "random_bytes: length must be an integer"},
+		{`random_bytes("8")`, "random_bytes: length must be a number"},
+		{`random_bytes(8; "base58")`, `random_bytes: format must be "hex"`},
+		{`random_string(8; "")`, "random_string: charset is empty"},
+		{`random_string(8; 3)`, "random_string: charset must be a string"},
+		{`random_int(6; 1)`, "random_int: min 6 is greater than max 1"},
+		{`random_int(1.5; 2)`, "random_int: min must be an integer"},
+		{`random_int(1; "x")`, "random_int: max must be an integer"},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, nil, randomOpts...).(map[string]any)
+		if got := common.GetUDFError(res); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, got, tt.want)
+		}
+	}
+}
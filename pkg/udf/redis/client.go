@@ -0,0 +1,222 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// DefaultAddr is used when neither an explicit server nor an environment
+// variable is set
+const DefaultAddr = "localhost:6379"
+
+// maxReplyLen is the largest bulk string or array a reply may declare. It
+// matches the server's default proto-max-bulk-len, so a corrupt or hostile
+// length cannot make the client allocate without limit
+const maxReplyLen = 512 * 1024 * 1024
+
+// Config describes how to reach a Redis server
+type Config struct {
+	Addr     string
+	Username string
+	Password string
+	DB       int
+}
+
+// ParseServer parses a "host:port" address or a redis:// URL
+// (redis://[user:password@]host[:port][/db]). An empty server falls back to
+// $PWRQ_REDIS_URL, then $REDIS_URL, then DefaultAddr
+func ParseServer(server string) (Config, error) {
+	if server == "" {
+		server = os.Getenv("PWRQ_REDIS_URL")
+	}
+	if server == "" {
+		server = os.Getenv("REDIS_URL")
+	}
+	if server == "" {
+		return Config{Addr: DefaultAddr}, nil
+	}
+	if !strings.Contains(server, "://") {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "6379")
+		}
+		return Config{Addr: server}, nil
+	}
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return Config{}, common.Errorf(common.CodeInvalid, "invalid server URL %q: %w", server, err)
+	}
+	if u.Scheme != "redis" {
+		return Config{}, common.Errorf(common.CodeInvalid, "unsupported server scheme %q (expected redis://)", u.Scheme)
+	}
+	cfg := Config{Addr: u.Host}
+	if u.Port() == "" {
+		cfg.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		cfg.Username = u.User.Username()
+		cfg.Password, _ = u.User.Password()
+		// redis://:password@host authenticates as the default user
+		if _, hasPassword := u.User.Password(); !hasPassword {
+			cfg.Username, cfg.Password = "", cfg.Username
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if cfg.DB, err = strconv.Atoi(db); err != nil {
+			return Config{}, common.Errorf(common.CodeInvalid, "invalid database number %q", db)
+		}
+	}
+	return cfg, nil
+}
+
+// Error is an error reply sent by the server
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Conn is a single RESP connection
+type Conn struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	deadline time.Time
+}
+
+// Dial connects to the server and performs AUTH and SELECT as configured.
+// No command on the connection runs past the deadline of ctx
+func Dial(ctx context.Context, cfg Config) (*Conn, error) {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	nc, err := dialer.DialContext(ctx, "tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %v: %w", cfg.Addr, err)
+	}
+	c := &Conn{conn: nc, r: bufio.NewReader(nc)}
+	c.deadline, _ = ctx.Deadline()
+	if cfg.Password != "" {
+		args := []string{"AUTH", cfg.Password}
+		if cfg.Username != "" {
+			args = []string{"AUTH", cfg.Username, cfg.Password}
+		}
+		if _, err := c.Do(args...); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+	if cfg.DB != 0 {
+		if _, err := c.Do("SELECT", strconv.Itoa(cfg.DB)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to select database %d: %w", cfg.DB, err)
+		}
+	}
+	return c, nil
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends a command and returns its reply converted to gojq values:
+// strings, ints, []any, or nil. Server error replies are returned as Error
+func (c *Conn) Do(args ...string) (any, error) {
+	deadline := time.Now().Add(30 * time.Second)
+	if !c.deadline.IsZero() && c.deadline.Before(deadline) {
+		deadline = c.deadline
+	}
+	c.conn.SetDeadline(deadline)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, sb.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *Conn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", common.Errorf(common.CodeInvalid, "malformed reply line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+func (c *Conn) readReply() (any, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, common.Errorf(common.CodeInvalid, "empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, common.Errorf(common.CodeInvalid, "malformed integer reply %q", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, common.Errorf(common.CodeInvalid, "malformed bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxReplyLen {
+			return nil, common.Errorf(common.CodeInvalid, "bulk length %d exceeds %d bytes", n, maxReplyLen)
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, common.Errorf(common.CodeInvalid, "malformed array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxReplyLen {
+			return nil, common.Errorf(common.CodeInvalid, "array length %d exceeds %d elements", n, maxReplyLen)
+		}
+		// Grow as elements arrive rather than trusting the length up front
+		items := make([]any, 0, min(n, 1024))
+		for range n {
+			item, err := c.readReply()
+			// Error replies inside arrays (e.g. EXEC) are kept as values
+			if e, ok := err.(Error); ok {
+				items = append(items, map[string]any{"error": string(e)})
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "unexpected reply type %q", line[0])
+	}
+}
@@ -0,0 +1,284 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// toArg converts a jq value into a command argument. Objects and arrays are
+// stored as JSON so they can be read back with fromjson
+func toArg(v any) (string, error) {
+	switch val := common.ExtractUDFValue(v).(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	case int:
+		return strconv.Itoa(val), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	default:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+// parseConnArg accepts a server string or an options object ({server, ...})
+func parseConnArg(v any) (string, map[string]any, error) {
+	switch val := common.ExtractUDFValue(v).(type) {
+	case nil:
+		return "", nil, nil
+	case string:
+		return val, nil, nil
+	case map[string]any:
+		server, _ := val["server"].(string)
+		return server, val, nil
+	default:
+		return "", nil, common.Errorf(common.CodeInvalid, "server must be a string or object, got %T", val)
+	}
+}
+
+// withConn dials the configured server, runs f, and closes the connection.
+// The resolved address is recorded in meta
+func withConn(server string, meta map[string]any, f func(*Conn) (any, error)) (any, error) {
+	cfg, err := ParseServer(server)
+	if err != nil {
+		return nil, err
+	}
+	meta["server"] = cfg.Addr
+	if cfg.DB != 0 {
+		meta["db"] = cfg.DB
+	}
+	if err := common.CheckNet(cfg.Addr); err != nil {
+		return nil, err
+	}
+	ctx, cancel := common.Context()
+	defer cancel()
+	conn, err := Dial(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return f(conn)
+}
+
+// RegisterRedisGet registers the redis_get function with gojq
+func RegisterRedisGet() gojq.CompilerOption {
+	return common.WithFunction("redis_get", 0, 2, common.Audited("redis_get", func(v any, args []any) any {
+		keyVal := v
+		if len(args) > 0 {
+			keyVal = args[0]
+		}
+		key, ok := common.ExtractUDFValue(keyVal).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "redis_get: key must be a string, got %T", common.ExtractUDFValue(keyVal)), nil)
+		}
+		var server string
+		if len(args) > 1 {
+			var err error
+			if server, _, err = parseConnArg(args[1]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("redis_get: %w", err), nil)
+			}
+		}
+
+		meta := map[string]any{
+			"operation": "redis_get",
+			"key":       key,
+		}
+		val, err := withConn(server, meta, func(c *Conn) (any, error) {
+			return c.Do("GET", key)
+		})
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("redis_get: %w", err), meta)
+		}
+		meta["exists"] = val != nil
+		return common.MakeUDFSuccessResult(val, meta)
+	}))
+}
+
+// RegisterRedisSet registers the redis_set function with gojq
+func RegisterRedisSet() gojq.CompilerOption {
+	return common.WithFunction("redis_set", 1, 3, common.Audited("redis_set", func(v any, args []any) any {
+		key, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "redis_set: key must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+
+		// Value comes from the second argument, or the pipeline
+		valueArg := v
+		if len(args) > 1 {
+			valueArg = args[1]
+		}
+		value, err := toArg(valueArg)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("redis_set: failed to encode value: %w", err), nil)
+		}
+
+		var server string
+		var opts map[string]any
+		if len(args) > 2 {
+			if server, opts, err = parseConnArg(args[2]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("redis_set: %w", err), nil)
+			}
+		}
+		cmd := []string{"SET", key, value}
+		meta := map[string]any{
+			"operation":    "redis_set",
+			"key":          key,
+			"value_length": len(value),
+		}
+		switch ttl := opts["ttl"].(type) {
+		case nil:
+		case int:
+			if ttl <= 0 {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "redis_set: ttl must be positive, got %d", ttl), nil)
+			}
+			cmd = append(cmd, "EX", strconv.Itoa(ttl))
+			meta["ttl"] = ttl
+		case float64:
+			if !(ttl > 0) || math.IsInf(ttl, 0) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "redis_set: ttl must be positive, got %v", ttl), nil)
+			}
+			// Round up so a sub-millisecond ttl still expires rather than
+			// sending PX 0, which the server rejects
+			cmd = append(cmd, "PX", strconv.FormatInt(int64(math.Ceil(ttl*1000)), 10))
+			meta["ttl"] = ttl
+		default:
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "redis_set: ttl must be a number of seconds, got %T", ttl), nil)
+		}
+
+		if _, err := withConn(server, meta, func(c *Conn) (any, error) {
+			return c.Do(cmd...)
+		}); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("redis_set: %w", err), meta)
+		}
+		return common.MakeUDFSuccessResult(key, meta)
+	}))
+}
+
+// RegisterRedisKeys registers the redis_keys function with gojq.
+// Keys are collected with SCAN rather than KEYS so large databases are not blocked
+func RegisterRedisKeys() gojq.CompilerOption {
+	return common.WithFunction("redis_keys", 0, 2, common.Audited("redis_keys", func(v any, args []any) any {
+		pattern := "*"
+		if len(args) > 0 {
+			p, ok := common.ExtractUDFValue(args[0]).(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "redis_keys: pattern must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+			}
+			pattern = p
+		}
+		var server string
+		if len(args) > 1 {
+			var err error
+			if server, _, err = parseConnArg(args[1]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("redis_keys: %w", err), nil)
+			}
+		}
+
+		meta := map[string]any{
+			"operation": "redis_keys",
+			"pattern":   pattern,
+		}
+		val, err := withConn(server, meta, func(c *Conn) (any, error) {
+			seen := map[string]bool{}
+			cursor := "0"
+			for {
+				reply, err := c.Do("SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+				if err != nil {
+					return nil, err
+				}
+				parts, ok := reply.([]any)
+				if !ok || len(parts) != 2 {
+					return nil, common.Errorf(common.CodeInvalid, "unexpected SCAN reply %v", reply)
+				}
+				keys, _ := parts[1].([]any)
+				for _, k := range keys {
+					if s, ok := k.(string); ok {
+						seen[s] = true
+					}
+				}
+				if cursor, _ = parts[0].(string); cursor == "0" || cursor == "" {
+					break
+				}
+			}
+			keys := make([]string, 0, len(seen))
+			for k := range seen {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			result := make([]any, len(keys))
+			for i, k := range keys {
+				result[i] = k
+			}
+			return result, nil
+		})
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("redis_keys: %w", err), meta)
+		}
+		meta["count"] = len(val.([]any))
+		return common.MakeUDFSuccessResult(val, meta)
+	}))
+}
+
+// RegisterRedisCmd registers the redis_cmd function with gojq
+func RegisterRedisCmd() gojq.CompilerOption {
+	return common.WithFunction("redis_cmd", 0, 2, common.Audited("redis_cmd", func(v any, args []any) any {
+		cmdVal := v
+		if len(args) > 0 {
+			cmdVal = args[0]
+		}
+
+		var cmd []string
+		switch val := common.ExtractUDFValue(cmdVal).(type) {
+		case string:
+			cmd = strings.Fields(val)
+		case []any:
+			for _, item := range val {
+				arg, err := toArg(item)
+				if err != nil {
+					return common.MakeUDFErrorResult(fmt.Errorf("redis_cmd: failed to encode argument: %w", err), nil)
+				}
+				cmd = append(cmd, arg)
+			}
+		default:
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "redis_cmd: command must be a string or array, got %T", val), nil)
+		}
+		if len(cmd) == 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "redis_cmd: command cannot be empty"), nil)
+		}
+
+		var server string
+		if len(args) > 1 {
+			var err error
+			if server, _, err = parseConnArg(args[1]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("redis_cmd: %w", err), nil)
+			}
+		}
+
+		meta := map[string]any{
+			"operation": "redis_cmd",
+			"command":   strings.ToUpper(cmd[0]),
+			"args":      len(cmd) - 1,
+		}
+		val, err := withConn(server, meta, func(c *Conn) (any, error) {
+			return c.Do(cmd...)
+		})
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("redis_cmd: %w", err), meta)
+		}
+		return common.MakeUDFSuccessResult(val, meta)
+	}))
+}
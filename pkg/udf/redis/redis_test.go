@@ -0,0 +1,328 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+// fakeRedis is an in-memory server speaking enough RESP for the UDFs
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu    sync.Mutex
+	store map[string]string
+	last  []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &fakeRedis{listener: l, password: password, store: map[string]string{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *fakeRedis) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := s.password == ""
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.last = cmd
+		reply := s.exec(cmd, &authed)
+		s.mu.Unlock()
+		io.WriteString(conn, reply)
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	cmd := make([]string, n)
+	for i := range cmd {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		cmd[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return cmd, nil
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func (s *fakeRedis) exec(cmd []string, authed *bool) string {
+	name := strings.ToUpper(cmd[0])
+	if name == "AUTH" {
+		if cmd[len(cmd)-1] != s.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		*authed = true
+		return "+OK\r\n"
+	}
+	if !*authed {
+		return "-NOAUTH Authentication required.\r\n"
+	}
+	switch name {
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		if v, ok := s.store[cmd[1]]; ok {
+			return bulk(v)
+		}
+		return "$-1\r\n"
+	case "SET":
+		s.store[cmd[1]] = cmd[2]
+		return "+OK\r\n"
+	case "INCR":
+		n, _ := strconv.Atoi(s.store[cmd[1]])
+		s.store[cmd[1]] = strconv.Itoa(n + 1)
+		return fmt.Sprintf(":%d\r\n", n+1)
+	case "SCAN":
+		var keys []string
+		for k := range s.store {
+			if ok, _ := path.Match(cmd[3], k); ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		out := fmt.Sprintf("*2\r\n%s*%d\r\n", bulk("0"), len(keys))
+		for _, k := range keys {
+			out += bulk(k)
+		}
+		return out
+	default:
+		return "-ERR unknown command '" + cmd[0] + "'\r\n"
+	}
+}
+
+func TestRedisSetGet(t *testing.T) {
+	server := newFakeRedis(t, "")
+	opts := []gojq.CompilerOption{RegisterRedisGet(), RegisterRedisSet(), RegisterRedisKeys(), RegisterRedisCmd()}
+
+	result := runGojqQuery(t, fmt.Sprintf(`{a: 1} | redis_set("user:1"; .; %q)`, server.addr()), nil, opts...)
+	resultMap := result.(map[string]any)
+	if resultMap["_err"] != nil {
+		t.Fatalf("Unexpected error: %v", resultMap["_err"])
+	}
+	if resultMap["_val"] != "user:1" {
+		t.Errorf("Expected key as _val, got %v", resultMap["_val"])
+	}
+
+	result = runGojqQuery(t, fmt.Sprintf(`redis_get("user:1"; %q) | ._val | fromjson | .a == 1`, server.addr()), nil, opts...)
+	if result != true {
+		t.Errorf("Expected round-tripped object, got %v", result)
+	}
+
+	result = runGojqQuery(t, fmt.Sprintf(`"missing" | redis_get(.; %q)`, server.addr()), nil, opts...)
+	resultMap = result.(map[string]any)
+	if resultMap["_val"] != nil {
+		t.Errorf("Expected null for a missing key, got %v", resultMap["_val"])
+	}
+	if resultMap["_meta"].(map[string]any)["exists"] != false {
+		t.Error("Expected exists to be false for a missing key")
+	}
+}
+
+func TestRedisSetTTL(t *testing.T) {
+	server := newFakeRedis(t, "")
+	runGojqQuery(t, fmt.Sprintf(`redis_set("k"; "v"; {server: %q, ttl: 60})`, server.addr()), nil, RegisterRedisSet())
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if strings.Join(server.last, " ") != "SET k v EX 60" {
+		t.Errorf("Expected SET with EX, got %v", server.last)
+	}
+}
+
+func TestRedisSetTTLRounding(t *testing.T) {
+	server := newFakeRedis(t, "")
+	runGojqQuery(t, fmt.Sprintf(`redis_set("k"; "v"; {server: %q, ttl: 0.0004})`, server.addr()), nil, RegisterRedisSet())
+
+	server.mu.Lock()
+	got := strings.Join(server.last, " ")
+	server.mu.Unlock()
+	if got != "SET k v PX 1" {
+		t.Errorf("Expected a sub-millisecond ttl to round up, got %v", got)
+	}
+
+	for _, ttl := range []string{"0", "-1", "-0.5"} {
+		result := runGojqQuery(t, fmt.Sprintf(`redis_set("k"; "v"; {server: %q, ttl: %s})`, server.addr(), ttl), nil, RegisterRedisSet())
+		errStr := common.GetUDFError(result)
+		if !strings.HasPrefix(errStr, "redis_set: ttl must be positive") {
+			t.Errorf("ttl %s: expected an error, got %v", ttl, result)
+		}
+	}
+}
+
+func TestReadReplyLengthLimit(t *testing.T) {
+	for _, reply := range []string{"$9999999999\r\n", "*9999999999\r\n"} {
+		c := &Conn{r: bufio.NewReader(strings.NewReader(reply))}
+		if _, err := c.readReply(); err == nil || !strings.Contains(err.Error(), "exceeds") {
+			t.Errorf("%q: expected a length error, got %v", reply, err)
+		}
+	}
+}
+
+func TestRedisKeys(t *testing.T) {
+	server := newFakeRedis(t, "")
+	server.store["user:2"] = "b"
+	server.store["user:1"] = "a"
+	server.store["session:1"] = "c"
+
+	result := runGojqQuery(t, fmt.Sprintf(`redis_keys("user:*"; %q)`, server.addr()), nil, RegisterRedisKeys())
+	resultMap := result.(map[string]any)
+	keys, ok := resultMap["_val"].([]any)
+	if !ok || len(keys) != 2 || keys[0] != "user:1" || keys[1] != "user:2" {
+		t.Errorf("Expected sorted user keys, got %v", resultMap["_val"])
+	}
+	if resultMap["_meta"].(map[string]any)["count"] != 2 {
+		t.Errorf("Expected count 2, got %v", resultMap["_meta"])
+	}
+}
+
+func TestRedisCmd(t *testing.T) {
+	server := newFakeRedis(t, "")
+
+	result := runGojqQuery(t, fmt.Sprintf(`redis_cmd(["INCR", "counter"]; %q) | ._val`, server.addr()), nil, RegisterRedisCmd())
+	if result != 1 {
+		t.Errorf("Expected integer reply 1, got %v (%T)", result, result)
+	}
+
+	result = runGojqQuery(t, fmt.Sprintf(`"INCR counter" | redis_cmd(.; %q) | ._val`, server.addr()), nil, RegisterRedisCmd())
+	if result != 2 {
+		t.Errorf("Expected integer reply 2, got %v", result)
+	}
+
+	result = runGojqQuery(t, fmt.Sprintf(`redis_cmd(["BOGUS"]; %q)`, server.addr()), nil, RegisterRedisCmd())
+	errStr := common.GetUDFError(result)
+	if !strings.Contains(errStr, "unknown command") {
+		t.Errorf("Expected server error in _err, got %v", result)
+	}
+}
+
+func TestRedisAuth(t *testing.T) {
+	server := newFakeRedis(t, "s3cret")
+	server.store["k"] = "v"
+
+	result := runGojqQuery(t, fmt.Sprintf(`redis_get("k"; "redis://:s3cret@%s/2") | ._val`, server.addr()), nil, RegisterRedisGet())
+	if result != "v" {
+		t.Errorf("Expected authenticated GET to succeed, got %v", result)
+	}
+
+	result = runGojqQuery(t, fmt.Sprintf(`redis_get("k"; "redis://:wrong@%s")`, server.addr()), nil, RegisterRedisGet())
+	errStr := common.GetUDFError(result)
+	if !strings.Contains(errStr, "authentication failed") {
+		t.Errorf("Expected authentication error, got %v", result)
+	}
+}
+
+func TestRedisServerFromEnv(t *testing.T) {
+	server := newFakeRedis(t, "")
+	server.store["k"] = "from env"
+	t.Setenv("PWRQ_REDIS_URL", "redis://"+server.addr())
+
+	result := runGojqQuery(t, `redis_get("k")`, nil, RegisterRedisGet())
+	resultMap := result.(map[string]any)
+	if resultMap["_val"] != "from env" {
+		t.Errorf("Expected value via $PWRQ_REDIS_URL, got %v", result)
+	}
+	if resultMap["_meta"].(map[string]any)["server"] != server.addr() {
+		t.Errorf("Expected server in metadata, got %v", resultMap["_meta"])
+	}
+}
+
+func TestParseServer(t *testing.T) {
+	t.Setenv("PWRQ_REDIS_URL", "")
+	t.Setenv("REDIS_URL", "")
+	tests := []struct {
+		in   string
+		want Config
+	}{
+		{"", Config{Addr: DefaultAddr}},
+		{"cache", Config{Addr: "cache:6379"}},
+		{"cache:7000", Config{Addr: "cache:7000"}},
+		{"redis://cache/3", Config{Addr: "cache:6379", DB: 3}},
+		{"redis://:pw@cache:7000", Config{Addr: "cache:7000", Password: "pw"}},
+		{"redis://user:pw@cache:7000/1", Config{Addr: "cache:7000", Username: "user", Password: "pw", DB: 1}},
+	}
+	for _, tt := range tests {
+		got, err := ParseServer(tt.in)
+		if err != nil {
+			t.Errorf("ParseServer(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseServer(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseServer("http://cache"); err == nil {
+		t.Error("Expected error for non-redis scheme")
+	}
+}
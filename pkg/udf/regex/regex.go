@@ -0,0 +1,222 @@
+package regex
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// maxCached bounds the compiled pattern cache; it is cleared when full
+const maxCached = 256
+
+var (
+	cacheMu sync.Mutex
+	cache   = map[string]*regexp.Regexp{}
+)
+
+// Compile compiles pattern with flags: i (case-insensitive), m (^ and $
+// match at line breaks), s (. matches newlines) and U (ungreedy).
+// Compiled patterns are cached, since filters usually run the same
+// pattern for every input
+func Compile(pattern, flags string) (*regexp.Regexp, error) {
+	var prefix strings.Builder
+	for _, f := range flags {
+		switch f {
+		case 'i', 'm', 's', 'U':
+			if !strings.ContainsRune(prefix.String(), f) {
+				prefix.WriteRune(f)
+			}
+		default:
+			return nil, common.Errorf(common.CodeInvalid, "unknown flag %q (supported: i, m, s, U)", f)
+		}
+	}
+	expr := pattern
+	if prefix.Len() > 0 {
+		expr = "(?" + prefix.String() + ")" + pattern
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if re, ok := cache[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, common.Errorf(common.CodeInvalid, "invalid pattern %q: %w", pattern, err)
+	}
+	if len(cache) >= maxCached {
+		cache = map[string]*regexp.Regexp{}
+	}
+	cache[expr] = re
+	return re, nil
+}
+
+// parseArgs reads the pattern, optional flags and optional input, which
+// follow any leading arguments such as the replacement
+func parseArgs(name string, v any, args []any) (*regexp.Regexp, string, string, error) {
+	pattern, ok := common.ExtractUDFValue(args[0]).(string)
+	if !ok {
+		return nil, "", "", common.Errorf(common.CodeInvalid, "%v: pattern must be a string, got %T", name, common.ExtractUDFValue(args[0]))
+	}
+	flags := ""
+	if len(args) > 1 && args[1] != nil {
+		if flags, ok = args[1].(string); !ok {
+			return nil, "", "", common.Errorf(common.CodeInvalid, "%v: flags must be a string, got %T", name, args[1])
+		}
+	}
+	inputVal := v
+	if len(args) > 2 {
+		inputVal = args[2]
+	}
+
+	var input string
+	switch val := common.ExtractUDFValue(inputVal).(type) {
+	case string:
+		input = val
+	case []byte:
+		input = string(val)
+	default:
+		if str, ok := val.(fmt.Stringer); ok {
+			input = str.String()
+		} else {
+			return nil, "", "", common.Errorf(common.CodeInvalid, "%v: input must be a string, got %T", name, val)
+		}
+	}
+
+	re, err := Compile(pattern, flags)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("%v: %w", name, err)
+	}
+	return re, flags, input, nil
+}
+
+// matchObject describes a match. Offsets are in characters, as in jq's
+// match. Groups that did not participate are null
+func matchObject(re *regexp.Regexp, input string, loc []int) map[string]any {
+	groups := []any{}
+	named := map[string]any{}
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		var val any
+		if loc[2*i] >= 0 {
+			val = input[loc[2*i]:loc[2*i+1]]
+		}
+		groups = append(groups, val)
+		if name != "" {
+			named[name] = val
+		}
+	}
+	return map[string]any{
+		"match":  input[loc[0]:loc[1]],
+		"offset": utf8.RuneCountInString(input[:loc[0]]),
+		"length": utf8.RuneCountInString(input[loc[0]:loc[1]]),
+		"groups": groups,
+		"named":  named,
+	}
+}
+
+// extracted returns the value regex_extract_all produces for a match: the
+// named groups as an object, the only group, all groups, or the whole match
+func extracted(re *regexp.Regexp, input string, loc []int) any {
+	m := matchObject(re, input, loc)
+	groups := m["groups"].([]any)
+	switch {
+	case len(m["named"].(map[string]any)) > 0:
+		return m["named"]
+	case len(groups) == 1:
+		return groups[0]
+	case len(groups) > 1:
+		return groups
+	default:
+		return m["match"]
+	}
+}
+
+// RegisterRegexMatch registers the regex_match function with gojq
+func RegisterRegexMatch() gojq.CompilerOption {
+	return common.WithFunction("regex_match", 1, 3, func(v any, args []any) any {
+		re, flags, input, err := parseArgs("regex_match", v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		var result any
+		if loc := re.FindStringSubmatchIndex(input); loc != nil {
+			result = matchObject(re, input, loc)
+		}
+
+		meta := map[string]any{
+			"operation": "regex_match",
+			"pattern":   common.ExtractUDFValue(args[0]),
+			"flags":     flags,
+			"matched":   result != nil,
+		}
+		return common.MakeUDFSuccessResult(result, meta)
+	})
+}
+
+// RegisterRegexExtractAll registers the regex_extract_all function with gojq
+func RegisterRegexExtractAll() gojq.CompilerOption {
+	return common.WithFunction("regex_extract_all", 1, 3, func(v any, args []any) any {
+		re, flags, input, err := parseArgs("regex_extract_all", v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		results := []any{}
+		for _, loc := range re.FindAllStringSubmatchIndex(input, -1) {
+			results = append(results, extracted(re, input, loc))
+		}
+
+		meta := map[string]any{
+			"operation": "regex_extract_all",
+			"pattern":   common.ExtractUDFValue(args[0]),
+			"flags":     flags,
+			"count":     len(results),
+		}
+		return common.MakeUDFSuccessResult(results, meta)
+	})
+}
+
+// RegisterRegexReplace registers the regex_replace function with gojq
+func RegisterRegexReplace() gojq.CompilerOption {
+	return common.WithFunction("regex_replace", 2, 4, func(v any, args []any) any {
+		replacement, ok := common.ExtractUDFValue(args[1]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "regex_replace: replacement must be a string, got %T", common.ExtractUDFValue(args[1])), nil)
+		}
+		// Pattern, flags and input surround the replacement argument
+		rest := append([]any{args[0]}, args[2:]...)
+		re, flags, input, err := parseArgs("regex_replace", v, rest)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		count := 0
+		var sb strings.Builder
+		last := 0
+		for _, loc := range re.FindAllStringSubmatchIndex(input, -1) {
+			sb.WriteString(input[last:loc[0]])
+			sb.Write(re.ExpandString(nil, replacement, input, loc))
+			last = loc[1]
+			count++
+		}
+		sb.WriteString(input[last:])
+		result := sb.String()
+
+		meta := map[string]any{
+			"operation":    "regex_replace",
+			"pattern":      common.ExtractUDFValue(args[0]),
+			"flags":        flags,
+			"replacements": count,
+		}
+		return common.MakeUDFSuccessResult(result, meta)
+	})
+}
@@ -0,0 +1,174 @@
+package regex
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+var regexOpts = []gojq.CompilerOption{RegisterRegexMatch(), RegisterRegexExtractAll(), RegisterRegexReplace()}
+
+func TestRegexMatch(t *testing.T) {
+	result := runGojqQuery(t, `regex_match("(?P<user>\\pL+)@(?P<host>[\\w.]+)(:(\\d+))?")`, "mail: ünï@example.com", regexOpts...)
+	got := result.(map[string]any)
+	want := map[string]any{
+		"match":  "ünï@example.com",
+		"offset": 6,
+		"length": 15,
+		"groups": []any{"ünï", "example.com", nil, nil},
+		"named":  map[string]any{"user": "ünï", "host": "example.com"},
+	}
+	if !reflect.DeepEqual(got["_val"], want) {
+		t.Errorf("Match mismatch:\n got: %v\nwant: %v", got["_val"], want)
+	}
+	if meta := got["_meta"].(map[string]any); meta["matched"] != true || meta["pattern"] == nil {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		input string
+		want  any
+	}{
+		{"no match", `regex_match("z") | ._val`, "abc", nil},
+		{"case insensitive", `regex_match("ABC"; "i") | ._val.match`, "xabc", "abc"},
+		{"multiline", `regex_match("^b$"; "m") | ._val.offset`, "a\nb\nc", 2},
+		{"without multiline", `regex_match("^b$") | ._val`, "a\nb\nc", nil},
+		{"dotall", `regex_match("a.b"; "s") | ._val.match`, "a\nb", "a\nb"},
+		{"ungreedy", `regex_match("<.+>"; "U") | ._val.match`, "<a><b>", "<a>"},
+		{"null flags", `regex_match("b"; null) | ._val.offset`, "ab", 1},
+		{"input argument", `regex_match("\\d+"; ""; "id 42") | ._val.match`, "", "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query, tt.input, regexOpts...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegexExtractAll(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		input string
+		want  any
+	}{
+		{"whole matches", `regex_extract_all("\\d+")`, "a1 b22 c333", []any{"1", "22", "333"}},
+		{"single group", `regex_extract_all("(\\w)=\\d")`, "a=1 b=2", []any{"a", "b"}},
+		{"several groups", `regex_extract_all("(\\w)=(\\d)?")`, "a=1 b=", []any{[]any{"a", "1"}, []any{"b", nil}}},
+		{"named groups", `regex_extract_all("(?P<k>\\w+)=(?P<v>\\w+)")`, "x=1&y=2",
+			[]any{map[string]any{"k": "x", "v": "1"}, map[string]any{"k": "y", "v": "2"}}},
+		{"no matches", `regex_extract_all("z")`, "abc", []any{}},
+		{"multiline anchors", `regex_extract_all("^\\w+"; "m")`, "one two\nthree", []any{"one", "three"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query+` | ._val`, tt.input, regexOpts...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegexReplace(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		input string
+		want  string
+	}{
+		{"all occurrences", `regex_replace("\\d+"; "#")`, "a1 b22", "a# b#"},
+		{"numbered groups", `regex_replace("(\\w+)@(\\w+)"; "${2}:${1}")`, "ada@host", "host:ada"},
+		{"named groups", `regex_replace("(?P<y>\\d{4})-(?P<m>\\d\\d)"; "$m/$y")`, "2024-05", "05/2024"},
+		{"literal dollar", `regex_replace("x"; "$$")`, "axb", "a$b"},
+		{"flags", `regex_replace("^\\s+"; ""; "m")`, "  a\n  b", "a\nb"},
+		{"input argument", `regex_replace("o"; "0"; ""; "foo")`, "", "f00"},
+		{"no match", `regex_replace("z"; "y")`, "abc", "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query+` | ._val`, tt.input, regexOpts...)
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	result := runGojqQuery(t, `regex_replace("a"; "b")`, "banana", regexOpts...)
+	if meta := result.(map[string]any)["_meta"].(map[string]any); meta["replacements"] != 3 {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+}
+
+func TestCompileCache(t *testing.T) {
+	a, err := Compile("a+", "i")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Compile("a+", "ii")
+	if a != b {
+		t.Error("Expected repeated flags to share a cached pattern")
+	}
+	if a.String() != "(?i)a+" {
+		t.Errorf("Unexpected expression %q", a.String())
+	}
+}
+
+func TestRegexErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`regex_match("(")`, "x", `regex_match: invalid pattern "("`},
+		{`regex_match("a"; "x")`, "x", `regex_match: unknown flag 'x'`},
+		{`regex_match("a"; 1)`, "x", "regex_match: flags must be a string"},
+		{`regex_match(1)`, "x", "regex_match: pattern must be a string"},
+		{`regex_extract_all("a")`, 5, "regex_extract_all: input must be a string"},
+		{`regex_replace("a"; 1)`, "x", "regex_replace: replacement must be a string"},
+		{`regex_replace("["; "b")`, "x", `regex_replace: invalid pattern "["`},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, regexOpts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
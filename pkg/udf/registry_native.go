@@ -0,0 +1,84 @@
+//go:build !js
+
+package udf
+
+import (
+	"github.com/xen0bit/pwrq/pkg/udf/cat"
+	"github.com/xen0bit/pwrq/pkg/udf/fileattr"
+	"github.com/xen0bit/pwrq/pkg/udf/find"
+	"github.com/xen0bit/pwrq/pkg/udf/glob"
+	"github.com/xen0bit/pwrq/pkg/udf/grep"
+	"github.com/xen0bit/pwrq/pkg/udf/http"
+	"github.com/xen0bit/pwrq/pkg/udf/kafka"
+	"github.com/xen0bit/pwrq/pkg/udf/mkdir"
+	"github.com/xen0bit/pwrq/pkg/udf/redis"
+	"github.com/xen0bit/pwrq/pkg/udf/rm"
+	"github.com/xen0bit/pwrq/pkg/udf/secret"
+	"github.com/xen0bit/pwrq/pkg/udf/sed"
+	"github.com/xen0bit/pwrq/pkg/udf/sh"
+	"github.com/xen0bit/pwrq/pkg/udf/smtp"
+	"github.com/xen0bit/pwrq/pkg/udf/stdin"
+	"github.com/xen0bit/pwrq/pkg/udf/symlink"
+	"github.com/xen0bit/pwrq/pkg/udf/tee"
+	"github.com/xen0bit/pwrq/pkg/udf/tempdir"
+	"github.com/xen0bit/pwrq/pkg/udf/watch"
+	"github.com/xen0bit/pwrq/pkg/udf/writefile"
+)
+
+// DefaultRegistry returns the default registry with all built-in UDFs
+func DefaultRegistry() *Registry {
+	reg := PureRegistry()
+
+	// File operations
+	reg.Register(find.RegisterFind())
+	reg.Register(glob.RegisterGlob())
+	reg.Register(watch.RegisterWatch())
+	reg.Register(grep.RegisterGrep())
+	reg.Register(sed.RegisterSed())
+	reg.Register(cat.RegisterCat())
+	reg.Register(mkdir.RegisterMkdir())
+	reg.Register(rm.RegisterRm())
+	reg.Register(writefile.RegisterWriteFile())
+	reg.Register(fileattr.RegisterTouch())
+	reg.Register(fileattr.RegisterChmod())
+	reg.Register(fileattr.RegisterChown())
+	reg.Register(symlink.RegisterSymlink())
+	reg.Register(symlink.RegisterReadlink())
+	reg.Register(symlink.RegisterResolve())
+
+	// Tee (write to stderr or file)
+	reg.Register(tee.RegisterTee())
+
+	// Shell command execution
+	reg.Register(sh.RegisterSh())
+	reg.Register(sh.RegisterExec())
+
+	// Standard input
+	reg.Register(stdin.RegisterStdinLines())
+
+	// Secrets
+	reg.Register(secret.RegisterSecret())
+
+	// Temporary directory
+	reg.Register(tempdir.RegisterTempDir())
+	reg.Register(tempdir.RegisterTempFile())
+
+	// HTTP requests
+	reg.Register(http.RegisterHTTP())
+	reg.Register(http.RegisterHTTPServe())
+
+	// Email
+	reg.Register(smtp.RegisterSMTPSend())
+
+	// Redis
+	reg.Register(redis.RegisterRedisGet())
+	reg.Register(redis.RegisterRedisSet())
+	reg.Register(redis.RegisterRedisKeys())
+	reg.Register(redis.RegisterRedisCmd())
+
+	// Kafka
+	reg.Register(kafka.RegisterKafkaProduce())
+	reg.Register(kafka.RegisterKafkaConsume())
+
+	return reg
+}
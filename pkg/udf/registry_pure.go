@@ -0,0 +1,235 @@
+package udf
+
+import (
+	"github.com/xen0bit/pwrq/pkg/udf/avro"
+	"github.com/xen0bit/pwrq/pkg/udf/base32"
+	"github.com/xen0bit/pwrq/pkg/udf/base64"
+	"github.com/xen0bit/pwrq/pkg/udf/base85"
+	"github.com/xen0bit/pwrq/pkg/udf/baseconv"
+	"github.com/xen0bit/pwrq/pkg/udf/binary"
+	"github.com/xen0bit/pwrq/pkg/udf/bitwise"
+	"github.com/xen0bit/pwrq/pkg/udf/charset"
+	"github.com/xen0bit/pwrq/pkg/udf/compress"
+	"github.com/xen0bit/pwrq/pkg/udf/cron"
+	"github.com/xen0bit/pwrq/pkg/udf/crypto"
+	"github.com/xen0bit/pwrq/pkg/udf/csv"
+	"github.com/xen0bit/pwrq/pkg/udf/entropy"
+	"github.com/xen0bit/pwrq/pkg/udf/fake"
+	"github.com/xen0bit/pwrq/pkg/udf/hex"
+	"github.com/xen0bit/pwrq/pkg/udf/hmac"
+	"github.com/xen0bit/pwrq/pkg/udf/html"
+	"github.com/xen0bit/pwrq/pkg/udf/ini"
+	"github.com/xen0bit/pwrq/pkg/udf/json"
+	"github.com/xen0bit/pwrq/pkg/udf/lang"
+	"github.com/xen0bit/pwrq/pkg/udf/markdown"
+	md5udf "github.com/xen0bit/pwrq/pkg/udf/md5"
+	"github.com/xen0bit/pwrq/pkg/udf/parquet"
+	"github.com/xen0bit/pwrq/pkg/udf/protobuf"
+	"github.com/xen0bit/pwrq/pkg/udf/random"
+	"github.com/xen0bit/pwrq/pkg/udf/regex"
+	"github.com/xen0bit/pwrq/pkg/udf/sha1"
+	"github.com/xen0bit/pwrq/pkg/udf/sha224"
+	"github.com/xen0bit/pwrq/pkg/udf/sha256"
+	"github.com/xen0bit/pwrq/pkg/udf/sha384"
+	"github.com/xen0bit/pwrq/pkg/udf/sha512"
+	"github.com/xen0bit/pwrq/pkg/udf/sha512_224"
+	"github.com/xen0bit/pwrq/pkg/udf/sha512_256"
+	"github.com/xen0bit/pwrq/pkg/udf/ssdeep"
+	"github.com/xen0bit/pwrq/pkg/udf/string"
+	"github.com/xen0bit/pwrq/pkg/udf/structpack"
+	"github.com/xen0bit/pwrq/pkg/udf/timestamp"
+	"github.com/xen0bit/pwrq/pkg/udf/toml"
+	"github.com/xen0bit/pwrq/pkg/udf/unicode"
+	"github.com/xen0bit/pwrq/pkg/udf/url"
+	"github.com/xen0bit/pwrq/pkg/udf/uuid"
+	"github.com/xen0bit/pwrq/pkg/udf/xlsx"
+	"github.com/xen0bit/pwrq/pkg/udf/xml"
+)
+
+// PureRegistry returns a registry with the built-in UDFs that work on their
+// input alone, without the network, the filesystem or other programs. File
+// arguments some of them take are still subject to the sandbox policy
+func PureRegistry() *Registry {
+	reg := NewRegistry()
+
+	// Encoding/Decoding
+	reg.Register(base64.RegisterBase64Encode())
+	reg.Register(base64.RegisterBase64Decode())
+	reg.Register(hex.RegisterHexEncode())
+	reg.Register(hex.RegisterHexDecode())
+	reg.Register(url.RegisterURLEncode())
+	reg.Register(url.RegisterURLDecode())
+	reg.Register(html.RegisterHTMLEncode())
+	reg.Register(html.RegisterHTMLDecode())
+
+	// Additional encodings
+	reg.Register(base32.RegisterBase32Encode())
+	reg.Register(base32.RegisterBase32Decode())
+	reg.Register(base85.RegisterBase85Encode())
+	reg.Register(base85.RegisterBase85Decode())
+	reg.Register(binary.RegisterBinaryEncode())
+	reg.Register(binary.RegisterBinaryDecode())
+
+	// Character sets
+	reg.Register(charset.RegisterCharsetDetect())
+	reg.Register(charset.RegisterIconv())
+
+	// Number bases
+	reg.Register(baseconv.RegisterBaseConvert())
+
+	// Binary structures
+	reg.Register(structpack.RegisterStructUnpack())
+	reg.Register(structpack.RegisterStructPack())
+	reg.Register(structpack.RegisterBytesToInt())
+	reg.Register(structpack.RegisterIntToBytes())
+	reg.Register(structpack.RegisterBswap())
+
+	// Bitwise operations
+	reg.Register(bitwise.RegisterBand())
+	reg.Register(bitwise.RegisterBor())
+	reg.Register(bitwise.RegisterBxor())
+	reg.Register(bitwise.RegisterBnot())
+	reg.Register(bitwise.RegisterShl())
+	reg.Register(bitwise.RegisterShr())
+	reg.Register(bitwise.RegisterPopcount())
+	reg.Register(bitwise.RegisterFloatBits())
+	reg.Register(bitwise.RegisterBitsFloat())
+
+	// UUIDs and ULIDs
+	reg.Register(uuid.RegisterUUID())
+	reg.Register(uuid.RegisterUUIDParse())
+	reg.Register(uuid.RegisterULID())
+	reg.Register(uuid.RegisterULIDParse())
+
+	// Random data
+	reg.Register(random.RegisterRandomBytes())
+	reg.Register(random.RegisterRandomString())
+	reg.Register(random.RegisterRandomInt())
+	reg.Register(fake.RegisterFake())
+
+	// Compression
+	reg.Register(compress.RegisterGzipCompress())
+	reg.Register(compress.RegisterGzipDecompress())
+	reg.Register(compress.RegisterZlibCompress())
+	reg.Register(compress.RegisterZlibDecompress())
+	reg.Register(compress.RegisterDeflateCompress())
+	reg.Register(compress.RegisterDeflateDecompress())
+
+	// String operations
+	reg.Register(string.RegisterUpper())
+	reg.Register(string.RegisterLower())
+	reg.Register(string.RegisterReverse())
+	reg.Register(string.RegisterReplace())
+	reg.Register(string.RegisterTrim())
+	reg.Register(string.RegisterSplit())
+	reg.Register(string.RegisterJoin())
+
+	// Regular expressions
+	reg.Register(regex.RegisterRegexMatch())
+	reg.Register(regex.RegisterRegexExtractAll())
+	reg.Register(regex.RegisterRegexReplace())
+
+	// Unicode
+	reg.Register(unicode.RegisterUnicodeNormalize())
+	reg.Register(unicode.RegisterUnicodeNames())
+	reg.Register(unicode.RegisterUnicodeInspect())
+
+	// Language detection
+	reg.Register(lang.RegisterLangDetect())
+
+	// Timestamp operations
+	reg.Register(timestamp.RegisterTimestampToDate())
+	reg.Register(timestamp.RegisterDateToTimestamp())
+	reg.Register(timestamp.RegisterDateParse())
+	reg.Register(timestamp.RegisterTZConvert())
+	reg.Register(timestamp.RegisterTZList())
+
+	// Cron expressions
+	reg.Register(cron.RegisterCronNext())
+	reg.Register(cron.RegisterCronDescribe())
+
+	// JSON operations
+	reg.Register(json.RegisterJSONParse())
+	reg.Register(json.RegisterJSONStringify())
+
+	// CSV operations
+	reg.Register(csv.RegisterCSVParse())
+	reg.Register(csv.RegisterCSVStringify())
+
+	// XML operations
+	reg.Register(xml.RegisterXMLParse())
+	reg.Register(xml.RegisterXMLStringify())
+
+	// TOML operations
+	reg.Register(toml.RegisterTOMLParse())
+	reg.Register(toml.RegisterTOMLStringify())
+
+	// INI and .properties parsing
+	reg.Register(ini.RegisterINIParse())
+	reg.Register(ini.RegisterPropertiesParse())
+
+	// Protocol Buffers
+	reg.Register(protobuf.RegisterProtobufDecode())
+
+	// Parquet
+	reg.Register(parquet.RegisterParquetRead())
+
+	// Avro
+	reg.Register(avro.RegisterAvroDecode())
+	reg.Register(avro.RegisterAvroEncode())
+
+	// XLSX
+	reg.Register(xlsx.RegisterXLSXRead())
+	reg.Register(xlsx.RegisterXLSXSheets())
+
+	// HTML parsing
+	reg.Register(html.RegisterHTMLSelect())
+	reg.Register(html.RegisterHTMLText())
+	reg.Register(html.RegisterHTMLAttr())
+
+	// Markdown
+	reg.Register(markdown.RegisterMDToHTML())
+	reg.Register(markdown.RegisterMDParse())
+
+	// Entropy
+	reg.Register(entropy.RegisterEntropy())
+
+	// SSDeep (fuzzy hashing)
+	reg.Register(ssdeep.RegisterSSDeep())
+	reg.Register(ssdeep.RegisterSSDeepCompare())
+
+	// Encryption/Decryption functions
+	reg.Register(crypto.RegisterAESEncrypt())
+	reg.Register(crypto.RegisterAESDecrypt())
+	reg.Register(crypto.RegisterDESEncrypt())
+	reg.Register(crypto.RegisterDESDecrypt())
+	reg.Register(crypto.Register3DESEncrypt())
+	reg.Register(crypto.Register3DESDecrypt())
+	reg.Register(crypto.RegisterBlowfishEncrypt())
+	reg.Register(crypto.RegisterBlowfishDecrypt())
+	reg.Register(crypto.RegisterRC4())
+	reg.Register(crypto.RegisterChaCha20())
+	reg.Register(crypto.RegisterXOR())
+
+	// Hash functions (all support optional file argument)
+	reg.Register(md5udf.RegisterMD5())
+	reg.Register(sha1.RegisterSHA1())
+	reg.Register(sha224.RegisterSHA224())
+	reg.Register(sha256.RegisterSHA256())
+	reg.Register(sha384.RegisterSHA384())
+	reg.Register(sha512.RegisterSHA512())
+	reg.Register(sha512_224.RegisterSHA512_224())
+	reg.Register(sha512_256.RegisterSHA512_256())
+
+	// HMAC functions (key, message, optional file flag)
+	reg.Register(hmac.RegisterHMACMD5())
+	reg.Register(hmac.RegisterHMACSHA1())
+	reg.Register(hmac.RegisterHMACSHA224())
+	reg.Register(hmac.RegisterHMACSHA256())
+	reg.Register(hmac.RegisterHMACSHA384())
+	reg.Register(hmac.RegisterHMACSHA512())
+	reg.Register(hmac.RegisterHMACSHA512_224())
+	reg.Register(hmac.RegisterHMACSHA512_256())
+
+	return reg
+}
@@ -12,13 +12,13 @@ import (
 
 // RegisterRm registers the rm function with gojq
 func RegisterRm() gojq.CompilerOption {
-	return gojq.WithFunction("rm", 2, 2, func(v any, args []any) any {
+	return common.WithFunction("rm", 2, 2, common.Audited("rm", func(v any, args []any) any {
 		var targetPath string
 		var targetType string
 
 		// Parse required arguments: path and type
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("rm: requires 2 arguments (path, type), got %d", len(args)), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "rm: requires 2 arguments (path, type), got %d", len(args)), nil)
 		}
 
 		// Extract path from first argument
@@ -30,7 +30,7 @@ func RegisterRm() gojq.CompilerOption {
 			if pathStr, ok := pathVal.(string); ok {
 				targetPath = pathStr
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("rm: first argument (path) must be a string, got %T", args[0]), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "rm: first argument (path) must be a string, got %T", args[0]), nil)
 			}
 		}
 
@@ -43,13 +43,13 @@ func RegisterRm() gojq.CompilerOption {
 			if typeStr, ok := typeVal.(string); ok {
 				targetType = strings.ToLower(typeStr)
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("rm: second argument (type) must be a string, got %T", args[1]), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "rm: second argument (type) must be a string, got %T", args[1]), nil)
 			}
 		}
 
 		// Validate type argument
 		if targetType != "file" && targetType != "folder" {
-			return common.MakeUDFErrorResult(fmt.Errorf("rm: type must be 'file' or 'folder', got %q", targetType), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "rm: type must be 'file' or 'folder', got %q", targetType), nil)
 		}
 
 		// Expand ~ to home directory and get absolute path
@@ -59,13 +59,13 @@ func RegisterRm() gojq.CompilerOption {
 			if targetPath == "~" {
 				home, homeErr := os.UserHomeDir()
 				if homeErr != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("rm: cannot determine home directory: %v", homeErr), nil)
+					return common.MakeUDFErrorResult(fmt.Errorf("rm: cannot determine home directory: %w", homeErr), nil)
 				}
 				absPath = home
 			} else if len(targetPath) > 0 && targetPath[0] == '~' && (len(targetPath) == 1 || targetPath[1] == '/') {
 				home, homeErr := os.UserHomeDir()
 				if homeErr != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("rm: cannot determine home directory: %v", homeErr), nil)
+					return common.MakeUDFErrorResult(fmt.Errorf("rm: cannot determine home directory: %w", homeErr), nil)
 				}
 				if len(targetPath) > 1 {
 					absPath = filepath.Join(home, targetPath[2:])
@@ -74,13 +74,20 @@ func RegisterRm() gojq.CompilerOption {
 				}
 				absPath, err = filepath.Abs(absPath)
 				if err != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("rm: cannot resolve path %q: %v", targetPath, err), nil)
+					return common.MakeUDFErrorResult(fmt.Errorf("rm: cannot resolve path %q: %w", targetPath, err), nil)
 				}
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("rm: cannot resolve path %q: %v", targetPath, err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("rm: cannot resolve path %q: %w", targetPath, err), nil)
 			}
 		}
 		targetPath = absPath
+		if err := common.CheckWrite(targetPath); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("rm: %w", err), map[string]any{
+				"operation": "rm",
+				"path":      targetPath,
+				"type":      targetType,
+			})
+		}
 
 		// Check if path exists
 		info, err := os.Stat(targetPath)
@@ -91,7 +98,7 @@ func RegisterRm() gojq.CompilerOption {
 					"path":       targetPath,
 					"type":       targetType,
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("rm: path does not exist: %q", targetPath), meta)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeNotFound, "rm: path does not exist: %q", targetPath), meta)
 			}
 			if os.IsPermission(err) {
 				meta := map[string]any{
@@ -99,14 +106,14 @@ func RegisterRm() gojq.CompilerOption {
 					"path":       targetPath,
 					"type":       targetType,
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("rm: permission denied accessing path: %q", targetPath), meta)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodePermission, "rm: permission denied accessing path: %q", targetPath), meta)
 			}
 			meta := map[string]any{
 				"operation": "rm",
 				"path":      targetPath,
 				"type":      targetType,
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("rm: failed to access path %q: %v", targetPath, err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("rm: failed to access path %q: %w", targetPath, err), meta)
 		}
 
 		// Verify type matches
@@ -117,7 +124,7 @@ func RegisterRm() gojq.CompilerOption {
 				"path":      targetPath,
 				"type":      targetType,
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("rm: path %q is a directory, but type 'file' was specified", targetPath), meta)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "rm: path %q is a directory, but type 'file' was specified", targetPath), meta)
 		}
 		if targetType == "folder" && !isDir {
 			meta := map[string]any{
@@ -125,7 +132,7 @@ func RegisterRm() gojq.CompilerOption {
 				"path":      targetPath,
 				"type":      targetType,
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("rm: path %q is a file, but type 'folder' was specified", targetPath), meta)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "rm: path %q is a file, but type 'folder' was specified", targetPath), meta)
 		}
 
 		// Remove the file or folder
@@ -138,9 +145,9 @@ func RegisterRm() gojq.CompilerOption {
 					"type":       targetType,
 				}
 				if os.IsPermission(err) {
-					return common.MakeUDFErrorResult(fmt.Errorf("rm: permission denied removing file: %q", targetPath), meta)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodePermission, "rm: permission denied removing file: %q", targetPath), meta)
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("rm: failed to remove file %q: %v", targetPath, err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("rm: failed to remove file %q: %w", targetPath, err), meta)
 			}
 		} else { // folder
 			err = os.RemoveAll(targetPath)
@@ -151,9 +158,9 @@ func RegisterRm() gojq.CompilerOption {
 					"type":       targetType,
 				}
 				if os.IsPermission(err) {
-					return common.MakeUDFErrorResult(fmt.Errorf("rm: permission denied removing folder: %q", targetPath), meta)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodePermission, "rm: permission denied removing folder: %q", targetPath), meta)
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("rm: failed to remove folder %q: %v", targetPath, err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("rm: failed to remove folder %q: %w", targetPath, err), meta)
 			}
 		}
 
@@ -173,7 +180,7 @@ func RegisterRm() gojq.CompilerOption {
 				"path":       targetPath,
 				"type":       targetType,
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("rm: unexpected error checking removal: %v", err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("rm: unexpected error checking removal: %w", err), meta)
 		}
 
 		meta := map[string]any{
@@ -184,6 +191,6 @@ func RegisterRm() gojq.CompilerOption {
 		}
 
 		return common.MakeUDFSuccessResult(targetPath, meta)
-	})
+	}))
 }
 
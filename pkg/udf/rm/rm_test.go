@@ -192,10 +192,11 @@ func TestRm_FileNotFound(t *testing.T) {
 		t.Fatalf("Expected _err field in result")
 	}
 
-	errStr, ok := errVal.(string)
+	errObj, ok := errVal.(map[string]any)
 	if !ok {
-		t.Fatalf("Expected _err to be string, got %T", errVal)
+		t.Fatalf("Expected _err to be an object, got %T", errVal)
 	}
+	errStr, _ := errObj["message"].(string)
 
 	if errStr == "" {
 		t.Errorf("Expected error message, got empty string")
@@ -229,10 +230,11 @@ func TestRm_TypeMismatch(t *testing.T) {
 		t.Fatalf("Expected _err field in result")
 	}
 
-	errStr, ok := errVal.(string)
+	errObj, ok := errVal.(map[string]any)
 	if !ok {
-		t.Fatalf("Expected _err to be string, got %T", errVal)
+		t.Fatalf("Expected _err to be an object, got %T", errVal)
 	}
+	errStr, _ := errObj["message"].(string)
 
 	if errStr == "" {
 		t.Errorf("Expected error message, got empty string")
@@ -271,10 +273,11 @@ func TestRm_InvalidType(t *testing.T) {
 		t.Fatalf("Expected _err field in result")
 	}
 
-	errStr, ok := errVal.(string)
+	errObj, ok := errVal.(map[string]any)
 	if !ok {
-		t.Fatalf("Expected _err to be string, got %T", errVal)
+		t.Fatalf("Expected _err to be an object, got %T", errVal)
 	}
+	errStr, _ := errObj["message"].(string)
 
 	if errStr == "" {
 		t.Errorf("Expected error message, got empty string")
@@ -0,0 +1,166 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// keyringService is the service name secrets are stored under in the OS
+// keyring
+const keyringService = "pwrq"
+
+// validName limits the names of secrets looked up everywhere, so that a name
+// is safe in an environment variable and as a file name
+var validName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+var errNotFound = errors.New("not found")
+
+// RegisterSecret registers the secret function with gojq
+func RegisterSecret() gojq.CompilerOption {
+	return common.WithFunction("secret", 1, 1, common.Audited("secret", func(v any, args []any) any {
+		name, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "secret: name must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		meta := map[string]any{
+			"operation": "secret",
+			"name":      name,
+		}
+		value, source, err := lookup(name)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("secret: %w", err), meta)
+		}
+		// The value itself stays out of _meta, which is easily printed,
+		// and out of the audit log of the UDFs it is passed to
+		common.AddSecretValue(value)
+		meta["source"] = source
+		return common.MakeUDFSuccessResult(value, meta)
+	}))
+}
+
+// lookup resolves a secret, returning its value and where it came from.
+// env:NAME, file:PATH and keyring:NAME read a single source; a bare name is
+// looked up in $PWRQ_SECRET_NAME, then ~/.pwrq/secrets/name, then the
+// keyring
+func lookup(name string) (string, string, error) {
+	source, ref, ok := strings.Cut(name, ":")
+	if ok {
+		var value string
+		var err error
+		switch source {
+		case "env":
+			value, ok = os.LookupEnv(ref)
+			if !ok {
+				err = common.Errorf(common.CodeNotFound, "environment variable %v is not set", ref)
+			}
+		case "file":
+			value, err = readFile(ref)
+		case "keyring":
+			value, err = readKeyring(ref)
+			if err == errNotFound {
+				err = common.Errorf(common.CodeNotFound, "%q is not in the keyring", ref)
+			}
+		default:
+			return "", "", common.Errorf(common.CodeInvalid, "unknown source %q in %q (expected env, file or keyring)", source, name)
+		}
+		return value, source, err
+	}
+
+	if !validName.MatchString(name) {
+		return "", "", common.Errorf(common.CodeInvalid, "invalid name %q: use letters, digits, '_', '.' and '-'", name)
+	}
+	if value, ok := os.LookupEnv(envName(name)); ok {
+		return value, "env", nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		value, err := readFile(filepath.Join(home, ".pwrq", "secrets", name))
+		if err == nil {
+			return value, "file", nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", "", err
+		}
+	}
+	value, err := readKeyring(name)
+	if err == nil {
+		return value, "keyring", nil
+	} else if err != errNotFound {
+		return "", "", err
+	}
+	return "", "", common.Errorf(common.CodeNotFound, "%q not found in $%v, ~/.pwrq/secrets/%v or the keyring", name, envName(name), name)
+}
+
+// envName is the environment variable of a secret: api-key is
+// PWRQ_SECRET_API_KEY
+func envName(name string) string {
+	return "PWRQ_SECRET_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// readFile reads a secret from a file, without the trailing newline that
+// editors and echo leave
+func readFile(path string) (string, error) {
+	path, err := common.ResolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	if err := common.CheckRead(path); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// readKeyring reads a secret from the OS keyring with the tool the system
+// provides for it. It returns errNotFound when there is no such secret or no
+// keyring at all
+func readKeyring(name string) (string, error) {
+	var argv []string
+	switch runtime.GOOS {
+	case "darwin":
+		argv = []string{"security", "find-generic-password", "-s", keyringService, "-a", name, "-w"}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		argv = []string{"secret-tool", "lookup", "service", keyringService, "account", name}
+	default:
+		return "", errNotFound
+	}
+	if _, err := exec.LookPath(argv[0]); err != nil {
+		return "", errNotFound
+	}
+	if err := common.CheckExec(); err != nil {
+		return "", err
+	}
+	ctx, cancel := common.Context()
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// secret-tool exits 1 for a missing item, and security 44
+		if e, ok := err.(*exec.ExitError); ok && (e.ExitCode() == 1 || e.ExitCode() == 44) {
+			return "", errNotFound
+		}
+		return "", fmt.Errorf("keyring: %w: %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
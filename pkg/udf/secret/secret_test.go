@@ -0,0 +1,99 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+func TestSecret(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PWRQ_SECRET_API_KEY", "from-env")
+	t.Setenv("OTHER_TOKEN", "plain-env")
+	// The keyring is left out of the test, whatever the machine has
+	t.Setenv("PATH", "")
+	if err := os.MkdirAll(filepath.Join(home, ".pwrq", "secrets"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".pwrq", "secrets", "db"), []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	token := filepath.Join(home, "token")
+	if err := os.WriteFile(token, []byte("s3cr3t\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		value  string
+		source string
+	}{
+		{"api-key", "from-env", "env"},
+		{"db", "from-file", "file"},
+		{"env:OTHER_TOKEN", "plain-env", "env"},
+		{"file:" + token, "s3cr3t", "file"},
+	} {
+		q, _ := gojq.Parse(`secret($name)`)
+		code, err := gojq.Compile(q, RegisterSecret(), gojq.WithVariables([]string{"$name"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := code.Run(nil, tc.name).Next()
+		m := v.(map[string]any)
+		if m["_val"] != tc.value {
+			t.Errorf("secret(%q) = %v, want %q", tc.name, m, tc.value)
+		}
+		if source := m["_meta"].(map[string]any)["source"]; source != tc.source {
+			t.Errorf("secret(%q) source = %v, want %q", tc.name, source, tc.source)
+		}
+	}
+
+	for _, tc := range []struct {
+		query string
+		err   string
+	}{
+		{`secret("missing")`, `secret: "missing" not found in $PWRQ_SECRET_MISSING, ~/.pwrq/secrets/missing or the keyring`},
+		{`secret("env:NOPE")`, "secret: environment variable NOPE is not set"},
+		{`secret("vault:x")`, `secret: unknown source "vault" in "vault:x" (expected env, file or keyring)`},
+		{`secret("../etc/passwd")`, `secret: invalid name "../etc/passwd"`},
+		{`secret("keyring:x")`, `secret: "x" is not in the keyring`},
+		{`secret(1)`, "secret: name must be a string, got int"},
+	} {
+		m := runGojqQuery(t, tc.query, nil, RegisterSecret()).(map[string]any)
+		if err := common.GetUDFError(m); !strings.HasPrefix(err, tc.err) {
+			t.Errorf("%s: _err = %q, want %q", tc.query, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package sed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	"github.com/xen0bit/pwrq/pkg/udf/regex"
+)
+
+// Options are the settings accepted by sed
+type Options struct {
+	Flags  string // regex flags, see regex.Compile
+	Fixed  bool   // pattern is a literal string
+	DryRun bool   // report changes without writing
+	Backup string // suffix of the backup copy, empty for none
+	Global bool   // replace every match on a line, not just the first
+}
+
+func parseOptions(m map[string]any) (Options, error) {
+	opts := Options{Global: true}
+	for key, raw := range m {
+		switch key {
+		case "flags":
+			s, ok := raw.(string)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.flags must be a string, got %T", raw)
+			}
+			opts.Flags = s
+		case "backup":
+			switch b := raw.(type) {
+			case bool:
+				if b {
+					opts.Backup = ".bak"
+				}
+			case string:
+				if b == "" || strings.ContainsRune(b, filepath.Separator) {
+					return opts, common.Errorf(common.CodeInvalid, "options.backup must be a non-empty suffix without path separators, got %q", b)
+				}
+				opts.Backup = b
+			default:
+				return opts, common.Errorf(common.CodeInvalid, "options.backup must be a boolean or a suffix string, got %T", raw)
+			}
+		case "fixed", "dry_run", "global":
+			b, ok := raw.(bool)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.%v must be a boolean, got %T", key, raw)
+			}
+			switch key {
+			case "fixed":
+				opts.Fixed = b
+			case "dry_run":
+				opts.DryRun = b
+			case "global":
+				opts.Global = b
+			}
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// replaceLine applies the replacement to one line and returns the new line
+// and the number of replacements
+func replaceLine(re *regexp.Regexp, line, replacement string, global bool) (string, int) {
+	n := -1
+	if !global {
+		n = 1
+	}
+	matches := re.FindAllStringSubmatchIndex(line, n)
+	if len(matches) == 0 {
+		return line, 0
+	}
+	var sb strings.Builder
+	last := 0
+	for _, loc := range matches {
+		sb.WriteString(line[last:loc[0]])
+		sb.Write(re.ExpandString(nil, replacement, line, loc))
+		last = loc[1]
+	}
+	sb.WriteString(line[last:])
+	return sb.String(), len(matches)
+}
+
+// Edit applies the replacement line by line. It returns the new content,
+// the changed lines and the number of replacements
+func Edit(content string, re *regexp.Regexp, replacement string, global bool) (string, []any, int) {
+	var out strings.Builder
+	changes := []any{}
+	total := 0
+	lineno := 0
+	for len(content) > 0 {
+		lineno++
+		line := content
+		ending := ""
+		if i := strings.IndexByte(content, '\n'); i >= 0 {
+			line, content = content[:i], content[i+1:]
+			ending = "\n"
+		} else {
+			content = ""
+		}
+		// Line endings are kept as they are and never matched
+		if strings.HasSuffix(line, "\r") {
+			line = line[:len(line)-1]
+			ending = "\r" + ending
+		}
+
+		replaced, n := replaceLine(re, line, replacement, global)
+		if n > 0 && replaced != line {
+			changes = append(changes, map[string]any{
+				"lineno": lineno,
+				"before": line,
+				"after":  replaced,
+			})
+		}
+		total += n
+		out.WriteString(replaced)
+		out.WriteString(ending)
+	}
+	return out.String(), changes, total
+}
+
+// RegisterSed registers the sed function with gojq
+func RegisterSed() gojq.CompilerOption {
+	return common.WithFunction("sed", 2, 4, common.Audited("sed", func(v any, args []any) any {
+		// sed(pattern; replacement) with the path from the pipeline,
+		// sed(pattern; replacement; path), or with options as a fourth argument
+		pattern, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "sed: pattern must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		replacement, ok := common.ExtractUDFValue(args[1]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "sed: replacement must be a string, got %T", common.ExtractUDFValue(args[1])), nil)
+		}
+		pathVal := v
+		if len(args) > 2 {
+			pathVal = args[2]
+		}
+		opts := Options{Global: true}
+		if len(args) > 3 {
+			m, ok := common.ExtractUDFValue(args[3]).(map[string]any)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "sed: options must be an object, got %T", common.ExtractUDFValue(args[3])), nil)
+			}
+			var err error
+			if opts, err = parseOptions(m); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("sed: %w", err), nil)
+			}
+		}
+
+		if opts.Fixed {
+			pattern = regexp.QuoteMeta(pattern)
+			replacement = strings.ReplaceAll(replacement, "$", "$$")
+		}
+		re, err := regex.Compile(pattern, opts.Flags)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("sed: %w", err), nil)
+		}
+
+		path, ok := common.ExtractUDFValue(pathVal).(string)
+		if !ok || path == "" {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "sed: path must be a non-empty string, got %T", common.ExtractUDFValue(pathVal)), nil)
+		}
+		f, absPath, _, err := common.OpenFileFromPath(path)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("sed: %w", err), nil)
+		}
+		info, err := f.Stat()
+		f.Close()
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("sed: %w", err), nil)
+		}
+		data, err := os.ReadFile(absPath)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("sed: failed to read file %q: %w", absPath, err), nil)
+		}
+
+		edited, changes, count := Edit(string(data), re, replacement, opts.Global)
+
+		meta := map[string]any{
+			"operation":     "sed",
+			"file_path":     absPath,
+			"replacements":  count,
+			"lines_changed": len(changes),
+			"dry_run":       opts.DryRun,
+			"modified":      false,
+		}
+		// Files without changes are left alone, including their mtime
+		if opts.DryRun || edited == string(data) {
+			return common.MakeUDFSuccessResult(changes, meta)
+		}
+		if err := common.CheckWrite(absPath); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("sed: %w", err), meta)
+		}
+
+		if opts.Backup != "" {
+			backupPath := absPath + opts.Backup
+			if err := os.WriteFile(backupPath, data, info.Mode().Perm()); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("sed: failed to write backup %q: %w", backupPath, err), meta)
+			}
+			meta["backup_path"] = backupPath
+		}
+		if err := common.WriteFileAtomic(absPath, []byte(edited), info.Mode().Perm()); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("sed: failed to write file %q: %w", absPath, err), meta)
+		}
+		meta["modified"] = true
+		return common.MakeUDFSuccessResult(changes, meta)
+	}))
+}
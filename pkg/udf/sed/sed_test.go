@@ -0,0 +1,206 @@
+package sed
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	"github.com/xen0bit/pwrq/pkg/udf/regex"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+// writeFile creates a file in a fresh temporary directory
+func writeFile(t *testing.T, content string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.conf")
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestEdit(t *testing.T) {
+	tests := []struct {
+		name        string
+		pattern     string
+		replacement string
+		global      bool
+		input       string
+		want        string
+		count       int
+	}{
+		{"global", `o`, "0", true, "foo\nbar\nboo\n", "f00\nbar\nb00\n", 4},
+		{"first only", `o`, "0", false, "foo\nboo", "f0o\nb0o", 2},
+		{"groups", `^(\w+)=(\w+)$`, "$2=$1", true, "a=b\nc=d\n", "b=a\nd=c\n", 2},
+		{"crlf kept", `x$`, "y", true, "ax\r\nbx\r\n", "ay\r\nby\r\n", 2},
+		{"no trailing newline", `end`, "END", true, "the end", "the END", 1},
+		{"no match", `zzz`, "", true, "abc\n", "abc\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re, err := regex.Compile(tt.pattern, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, count := Edit(tt.input, re, tt.replacement, tt.global)
+			if got != tt.want || count != tt.count {
+				t.Errorf("Edit(%q) = %q, %d; want %q, %d", tt.input, got, count, tt.want, tt.count)
+			}
+		})
+	}
+}
+
+func TestSedUDF(t *testing.T) {
+	path := writeFile(t, "host=localhost\nport=80\n# port=22\n", 0600)
+
+	result := runGojqQuery(t, `sed("^port=\\d+"; "port=8080")`, path, RegisterSed())
+	got := result.(map[string]any)
+	want := []any{map[string]any{"lineno": 2, "before": "port=80", "after": "port=8080"}}
+	if !reflect.DeepEqual(got["_val"], want) {
+		t.Errorf("Changes mismatch:\n got: %v\nwant: %v", got["_val"], want)
+	}
+	meta := got["_meta"].(map[string]any)
+	if meta["replacements"] != 1 || meta["lines_changed"] != 1 || meta["modified"] != true || meta["dry_run"] != false {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+	if _, ok := meta["backup_path"]; ok {
+		t.Errorf("No backup was requested, got %v", meta["backup_path"])
+	}
+	if content := readFile(t, path); content != "host=localhost\nport=8080\n# port=22\n" {
+		t.Errorf("Unexpected content %q", content)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("File mode changed to %v", info.Mode().Perm())
+	}
+	// Only the edited file is left in the directory
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the edited file, found %d entries", len(entries))
+	}
+}
+
+func TestSedDryRun(t *testing.T) {
+	original := "debug=true\nverbose=true\n"
+	path := writeFile(t, original, 0644)
+
+	result := runGojqQuery(t, `sed("true"; "false"; .; {dry_run: true})`, path, RegisterSed())
+	got := result.(map[string]any)
+	if changes := got["_val"].([]any); len(changes) != 2 {
+		t.Errorf("Expected 2 changed lines, got %v", changes)
+	}
+	meta := got["_meta"].(map[string]any)
+	if meta["dry_run"] != true || meta["modified"] != false || meta["replacements"] != 2 {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+	if content := readFile(t, path); content != original {
+		t.Errorf("Dry run modified the file: %q", content)
+	}
+}
+
+func TestSedBackup(t *testing.T) {
+	tests := []struct {
+		name   string
+		backup string
+		suffix string
+	}{
+		{"default suffix", `true`, ".bak"},
+		{"custom suffix", `".orig"`, ".orig"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, "a.b\n", 0644)
+			query := `sed("."; "-"; .; {fixed: true, backup: ` + tt.backup + `})`
+			result := runGojqQuery(t, query, path, RegisterSed())
+			meta := result.(map[string]any)["_meta"].(map[string]any)
+			if meta["backup_path"] != path+tt.suffix {
+				t.Errorf("backup_path = %v, want %v", meta["backup_path"], path+tt.suffix)
+			}
+			if content := readFile(t, path+tt.suffix); content != "a.b\n" {
+				t.Errorf("Unexpected backup content %q", content)
+			}
+			// fixed treats the pattern as a literal dot
+			if content := readFile(t, path); content != "a-b\n" {
+				t.Errorf("Unexpected content %q", content)
+			}
+		})
+	}
+
+	// No backup is written when nothing changes
+	path := writeFile(t, "abc\n", 0644)
+	runGojqQuery(t, `sed("x"; "y"; .; {backup: true})`, path, RegisterSed())
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("Unexpected backup for an unchanged file: %v", err)
+	}
+}
+
+func TestSedErrors(t *testing.T) {
+	path := writeFile(t, "abc\n", 0644)
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`sed(1; "x")`, path, "sed: pattern must be a string"},
+		{`sed("a"; 1)`, path, "sed: replacement must be a string"},
+		{`sed("a"; "b")`, nil, "sed: path must be a non-empty string"},
+		{`sed("("; "b")`, path, `sed: invalid pattern "("`},
+		{`sed("a"; "b"; .; {flags: "q"})`, path, "sed: unknown flag"},
+		{`sed("a"; "b"; .; {bogus: 1})`, path, `sed: unknown option "bogus"`},
+		{`sed("a"; "b"; .; {backup: 1})`, path, "sed: options.backup must be a boolean or a suffix string"},
+		{`sed("a"; "b"; .; {backup: "/x"})`, path, "sed: options.backup must be a non-empty suffix"},
+		{`sed("a"; "b"; .; "opts")`, path, "sed: options must be an object"},
+		{`sed("a"; "b")`, filepath.Join(filepath.Dir(path), "missing"), "sed: file does not exist"},
+		{`sed("a"; "b")`, filepath.Dir(path), "sed: path is a directory"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, RegisterSed())
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
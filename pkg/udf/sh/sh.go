@@ -1,18 +1,193 @@
 package sh
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/udf/common"
 )
 
+// runOptions are the optional settings accepted by sh and exec
+type runOptions struct {
+	timeout  time.Duration
+	env      []string
+	clearEnv bool
+	dir      string
+	stdin    any
+	hasStdin bool
+}
+
+func parseRunOptions(v any) (runOptions, error) {
+	var opts runOptions
+	m, ok := common.ExtractUDFValue(v).(map[string]any)
+	if !ok {
+		return opts, common.Errorf(common.CodeInvalid, "options must be an object, got %T", common.ExtractUDFValue(v))
+	}
+	for key, raw := range m {
+		switch key {
+		case "timeout":
+			switch timeout := raw.(type) {
+			case int:
+				opts.timeout = time.Duration(timeout) * time.Second
+			case float64:
+				opts.timeout = time.Duration(timeout * float64(time.Second))
+			default:
+				return opts, common.Errorf(common.CodeInvalid, "options.timeout must be a number of seconds, got %T", raw)
+			}
+			if opts.timeout <= 0 {
+				return opts, common.Errorf(common.CodeInvalid, "options.timeout must be positive, got %v", raw)
+			}
+		case "env":
+			env, ok := raw.(map[string]any)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.env must be an object, got %T", raw)
+			}
+			for name, val := range env {
+				switch val.(type) {
+				case string, int, float64, bool:
+					opts.env = append(opts.env, name+"="+fmt.Sprint(val))
+				default:
+					return opts, common.Errorf(common.CodeInvalid, "options.env.%v must be a string, got %T", name, val)
+				}
+			}
+		case "clear_env":
+			if opts.clearEnv, ok = raw.(bool); !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.clear_env must be a boolean, got %T", raw)
+			}
+		case "dir":
+			if opts.dir, ok = raw.(string); !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.dir must be a string, got %T", raw)
+			}
+		case "stdin":
+			opts.stdin, opts.hasStdin = raw, true
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// stdinBytes is what a command reads on stdin for the value v: strings as
+// they are, null as nothing, and anything else as JSON
+func stdinBytes(v any) ([]byte, error) {
+	switch val := common.ExtractUDFValue(v).(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(val), nil
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return nil, fmt.Errorf("cannot write %T to stdin: %w", val, err)
+		}
+		return append(b, '\n'), nil
+	}
+}
+
+// run runs argv and builds the result: stdout in _val, and on a non-zero
+// exit stderr as the message of _err. meta already names the operation and
+// command
+func run(name string, argv []string, stdin []byte, opts runOptions, meta map[string]any) any {
+	if err := common.CheckExec(); err != nil {
+		return common.MakeUDFErrorResult(fmt.Errorf("%v: %w", name, err), meta)
+	}
+	// The run and --udf-timeout bound the command as well as options.timeout
+	outer, cancel := common.Context()
+	defer cancel()
+	ctx := outer
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(outer, opts.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	// Don't wait forever on children that inherited stdout
+	cmd.WaitDelay = time.Second
+	cmd.Dir = opts.dir
+	if opts.clearEnv {
+		cmd.Env = opts.env
+	} else if len(opts.env) > 0 {
+		cmd.Env = append(os.Environ(), opts.env...)
+	}
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	meta["duration_ms"] = int(time.Since(start).Milliseconds())
+	stdoutStr := strings.TrimSpace(stdout.String())
+	stderrStr := strings.TrimSpace(stderr.String())
+	meta["stderr"] = stderrStr
+
+	if ctx.Err() != nil {
+		meta["exit_code"] = -1
+		meta["timed_out"] = true
+		err := common.Errorf(common.CodeTimeout, "%s: command timed out after %v", name, opts.timeout)
+		if outer.Err() != nil {
+			err = common.Errorf(common.ErrorCode(outer.Err()), "%s: command stopped: %w", name, outer.Err())
+		}
+		return map[string]any{
+			"_schema": common.UDFSchemaVersion,
+			"_val":    stdoutStr,
+			"_meta":   meta,
+			"_err":    common.UDFErrorValue(err),
+		}
+	}
+
+	// Get exit code
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		} else {
+			// If it's not an ExitError, it's a different kind of error (e.g., command not found)
+			delete(meta, "stderr")
+			delete(meta, "duration_ms")
+			return common.MakeUDFErrorResult(fmt.Errorf("%v: failed to execute command: %w", name, err), meta)
+		}
+	}
+	meta["exit_code"] = exitCode
+
+	// If exit code is non-zero, return error result with stderr
+	if exitCode != 0 {
+		msg := stderrStr
+		if msg == "" {
+			msg = fmt.Sprintf("command exited with code %d", exitCode)
+		}
+		err := &common.UDFError{Code: common.CodeExit, Message: msg, Details: map[string]any{"exit_code": exitCode}}
+
+		// Return error result with stdout in _val and stderr in _err
+		return map[string]any{
+			"_schema": common.UDFSchemaVersion,
+			"_val":    stdoutStr,
+			"_meta":   meta,
+			"_err":    common.UDFErrorValue(err),
+		}
+	}
+
+	// Success: return stdout
+	return common.MakeUDFSuccessResult(stdoutStr, meta)
+}
+
 // RegisterSh registers the sh function with gojq
 func RegisterSh() gojq.CompilerOption {
-	return gojq.WithFunction("sh", 0, 1, func(v any, args []any) any {
+	return common.WithFunction("sh", 0, 2, common.Audited("sh", func(v any, args []any) any {
+		// With no argument the input is the command. Given sh(cmd), the
+		// input is the command's stdin instead
 		var command string
+		var stdin []byte
 
 		// Parse argument: command string can come from pipe or as argument
 		if len(args) == 0 {
@@ -21,81 +196,94 @@ func RegisterSh() gojq.CompilerOption {
 			if cmdStr, ok := inputVal.(string); ok {
 				command = cmdStr
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("sh: command must be a string, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "sh: command must be a string, got %T", inputVal), nil)
 			}
 		} else {
 			// Command provided as argument
-			if cmd, ok := args[0].(string); ok {
-				command = cmd
+			cmdVal := common.ExtractUDFValue(args[0])
+			if cmdStr, ok := cmdVal.(string); ok {
+				command = cmdStr
 			} else {
-				// Try to extract from UDF result
-				cmdVal := common.ExtractUDFValue(args[0])
-				if cmdStr, ok := cmdVal.(string); ok {
-					command = cmdStr
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("sh: argument must be a string command, got %T", args[0]), nil)
-				}
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "sh: argument must be a string command, got %T", args[0]), nil)
 			}
 		}
 
 		if command == "" {
-			return common.MakeUDFErrorResult(fmt.Errorf("sh: command cannot be empty"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "sh: command cannot be empty"), nil)
 		}
 
-		// Execute command using sh -c
-		cmd := exec.Command("sh", "-c", command)
-		
-		// Capture stdout and stderr
-		stdout, err := cmd.Output()
-		stderr := []byte{}
-		if err != nil {
-			// If there's an error, try to get stderr from the exec.ExitError
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				stderr = exitErr.Stderr
+		var opts runOptions
+		if len(args) > 1 {
+			var err error
+			if opts, err = parseRunOptions(args[1]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("sh: %w", err), nil)
 			}
 		}
-
-		// Get exit code
-		exitCode := 0
-		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				exitCode = exitErr.ExitCode()
-			} else {
-				// If it's not an ExitError, it's a different kind of error (e.g., command not found)
-				meta := map[string]any{
-					"operation": "sh",
-					"command":   command,
-				}
-				return common.MakeUDFErrorResult(fmt.Errorf("sh: failed to execute command: %v", err), meta)
+		if len(args) > 0 || opts.hasStdin {
+			stdinVal := v
+			if opts.hasStdin {
+				stdinVal = opts.stdin
+			}
+			var err error
+			if stdin, err = stdinBytes(stdinVal); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("sh: %w", err), nil)
 			}
 		}
 
-		// Prepare metadata
-		meta := map[string]any{
+		// Execute command using sh -c
+		return run("sh", []string{"sh", "-c", command}, stdin, opts, map[string]any{
 			"operation": "sh",
 			"command":   command,
-			"exit_code": exitCode,
-		}
+		})
+	}))
+}
 
-		// If exit code is non-zero, return error result with stderr
-		if exitCode != 0 {
-			stderrStr := strings.TrimSpace(string(stderr))
-			if stderrStr == "" {
-				stderrStr = fmt.Sprintf("command exited with code %d", exitCode)
+// RegisterExec registers the exec function with gojq
+func RegisterExec() gojq.CompilerOption {
+	return common.WithFunction("exec", 1, 2, common.Audited("exec", func(v any, args []any) any {
+		// exec(argv) runs a program directly, without a shell, so its
+		// arguments need no quoting. The input is its stdin
+		list, ok := common.ExtractUDFValue(args[0]).([]any)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "exec: argv must be an array of strings, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		if len(list) == 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "exec: argv cannot be empty"), nil)
+		}
+		argv := make([]string, len(list))
+		for i, arg := range list {
+			switch val := arg.(type) {
+			case string:
+				argv[i] = val
+			case int, float64:
+				argv[i] = fmt.Sprint(val)
+			default:
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "exec: argv[%d] must be a string, got %T", i, arg), nil)
 			}
-			
-			// Return error result with stdout in _val and stderr in _err
-			result := map[string]any{
-				"_val":  strings.TrimSpace(string(stdout)),
-				"_meta": meta,
-				"_err":  stderrStr,
+		}
+		if argv[0] == "" {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "exec: program name cannot be empty"), nil)
+		}
+
+		var opts runOptions
+		if len(args) > 1 {
+			var err error
+			if opts, err = parseRunOptions(args[1]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("exec: %w", err), nil)
 			}
-			return result
+		}
+		stdinVal := v
+		if opts.hasStdin {
+			stdinVal = opts.stdin
+		}
+		stdin, err := stdinBytes(stdinVal)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("exec: %w", err), nil)
 		}
 
-		// Success: return stdout
-		stdoutStr := strings.TrimSpace(string(stdout))
-		return common.MakeUDFSuccessResult(stdoutStr, meta)
-	})
+		return run("exec", argv, stdin, opts, map[string]any{
+			"operation": "exec",
+			"argv":      list,
+		})
+	}))
 }
-
@@ -3,6 +3,7 @@ package sh
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/udf/common"
@@ -113,10 +114,11 @@ func TestSh_NonZeroExitCode(t *testing.T) {
 		t.Fatalf("Expected _err field in result for non-zero exit code")
 	}
 
-	errStr, ok := errVal.(string)
+	errObj, ok := errVal.(map[string]any)
 	if !ok {
-		t.Fatalf("Expected _err to be string, got %T", errVal)
+		t.Fatalf("Expected _err to be an object, got %T", errVal)
 	}
+	errStr, _ := errObj["message"].(string)
 
 	if errStr == "" {
 		t.Errorf("Expected error message, got empty string")
@@ -158,10 +160,11 @@ func TestSh_CommandWithStderr(t *testing.T) {
 		t.Fatalf("Expected _err field in result")
 	}
 
-	errStr, ok := errVal.(string)
+	errObj, ok := errVal.(map[string]any)
 	if !ok {
-		t.Fatalf("Expected _err to be string, got %T", errVal)
+		t.Fatalf("Expected _err to be an object, got %T", errVal)
 	}
+	errStr, _ := errObj["message"].(string)
 
 	// Should contain the error message
 	if !strings.Contains(errStr, "error message") && !strings.Contains(errStr, "1") {
@@ -235,10 +238,11 @@ func TestSh_EmptyCommand(t *testing.T) {
 		t.Fatalf("Expected _err field in result")
 	}
 
-	errStr, ok := errVal.(string)
+	errObj, ok := errVal.(map[string]any)
 	if !ok {
-		t.Fatalf("Expected _err to be string, got %T", errVal)
+		t.Fatalf("Expected _err to be an object, got %T", errVal)
 	}
+	errStr, _ := errObj["message"].(string)
 
 	if errStr == "" {
 		t.Errorf("Expected error message, got empty string")
@@ -270,3 +274,94 @@ func TestSh_CommandNotFound(t *testing.T) {
 	}
 }
 
+
+func TestSh_Stdin(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`sh("tr a-z A-Z")`, "hello", "HELLO"},
+		{`sh("wc -c")`, nil, "0"},
+		{`sh("cat")`, map[string]any{"a": 1}, `{"a":1}`},
+		{`sh("cat"; {stdin: "override"})`, "ignored", "override"},
+		{`"printf piped" | sh`, nil, "piped"},
+		{`exec(["tr", "a-z", "A-Z"])`, "argv", "ARGV"},
+		{`exec(["printf", "%s|%s", "a b", 2])`, nil, "a b|2"},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, tt.input, RegisterSh(), RegisterExec()).(map[string]any)
+		if got, _ := res["_val"].(string); strings.TrimSpace(got) != tt.want {
+			t.Errorf("%s = %v, want %q", tt.query, res, tt.want)
+		}
+	}
+}
+
+func TestSh_Options(t *testing.T) {
+	res := runGojqQuery(t, `sh("echo $GREETING-$N"; {env: {GREETING: "hi", N: 3}})`, nil, RegisterSh()).(map[string]any)
+	if res["_val"] != "hi-3" {
+		t.Errorf("env: %v", res)
+	}
+
+	res = runGojqQuery(t, `exec(["/usr/bin/env"]; {env: {ONLY: "me"}, clear_env: true})`, nil, RegisterExec()).(map[string]any)
+	if res["_val"] != "ONLY=me" {
+		t.Errorf("clear_env: %v", res)
+	}
+
+	dir := t.TempDir()
+	res = runGojqQuery(t, `sh("pwd"; {dir: "`+dir+`"})`, nil, RegisterSh()).(map[string]any)
+	if res["_val"] != dir {
+		t.Errorf("dir: pwd = %v, want %s", res["_val"], dir)
+	}
+
+	res = runGojqQuery(t, `sh("echo warn >&2; echo ok")`, nil, RegisterSh()).(map[string]any)
+	meta := res["_meta"].(map[string]any)
+	if res["_val"] != "ok" || meta["stderr"] != "warn" || meta["exit_code"] != 0 {
+		t.Errorf("stderr on success: %v", res)
+	}
+}
+
+func TestSh_Timeout(t *testing.T) {
+	start := time.Now()
+	res := runGojqQuery(t, `sh("echo started; sleep 10"; {timeout: 0.2})`, nil, RegisterSh()).(map[string]any)
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("timeout did not stop the command")
+	}
+	meta := res["_meta"].(map[string]any)
+	if common.GetUDFError(res) != "sh: command timed out after 200ms" || common.GetUDFErrorCode(res) != common.CodeTimeout ||
+		meta["timed_out"] != true || res["_val"] != "started" {
+		t.Errorf("timeout: %v", res)
+	}
+}
+
+func TestSh_ExitCodeFromExec(t *testing.T) {
+	res := runGojqQuery(t, `exec(["sh", "-c", "echo oops >&2; exit 3"])`, nil, RegisterExec()).(map[string]any)
+	meta := res["_meta"].(map[string]any)
+	details, _ := res["_err"].(map[string]any)["details"].(map[string]any)
+	if common.GetUDFError(res) != "oops" || common.GetUDFErrorCode(res) != common.CodeExit || details["exit_code"] != 3 || meta["exit_code"] != 3 {
+		t.Errorf("exec exit: %v", res)
+	}
+}
+
+func TestSh_OptionErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`sh("true"; {timeout: "5s"})`, "sh: options.timeout must be a number of seconds"},
+		{`sh("true"; {timeout: 0})`, "sh: options.timeout must be positive"},
+		{`sh("true"; {env: {A: [1]}})`, "sh: options.env.A must be a string"},
+		{`sh("true"; {shell: "bash"})`, `sh: unknown option "shell"`},
+		{`sh("true"; "x")`, "sh: options must be an object"},
+		{`exec("ls")`, "exec: argv must be an array of strings"},
+		{`exec([])`, "exec: argv cannot be empty"},
+		{`exec(["ls", null])`, "exec: argv[1] must be a string"},
+		{`exec(["nonexistentcommand12345"])`, "exec: failed to execute command"},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, nil, RegisterSh(), RegisterExec()).(map[string]any)
+		if got := common.GetUDFError(res); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package sha1
 import (
 	"crypto/sha1"
 	"fmt"
-	"io"
 
 	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/udf/common"
@@ -11,10 +10,10 @@ import (
 
 // RegisterSHA1 registers the sha1 function with gojq
 func RegisterSHA1() gojq.CompilerOption {
-	return gojq.WithFunction("sha1", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("sha1", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("sha1: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("sha1: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -26,7 +25,7 @@ func RegisterSHA1() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("sha1: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "sha1: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -34,31 +33,18 @@ func RegisterSHA1() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "sha1",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("sha1: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("sha1: %w", err), meta)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			case io.Reader:
-				readBytes, err := io.ReadAll(val)
-				if err != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("sha1: failed to read input: %v", err), nil)
-				}
-				inputBytes = readBytes
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("sha1: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("sha1: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		hash := sha1.Sum(inputBytes)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/udf/common"
 )
 
@@ -70,3 +71,24 @@ func TestSHA256(t *testing.T) {
 	}
 }
 
+
+func TestSHA256ByteArray(t *testing.T) {
+	data := []byte{0x00, 0xff, 0x80, 'a'}
+	query, err := gojq.Parse(`sha256 | ._val`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query, RegisterSHA256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := code.Run(common.BytesValue(data)).Next()
+	if want := fmt.Sprintf("%x", sha256.Sum256(data)); got != want {
+		t.Errorf("sha256 of byte array = %v, want %v", got, want)
+	}
+
+	got, _ = code.Run([]any{1, 256}).Next()
+	if got != nil {
+		t.Errorf("sha256 of non-byte array = %v, want an error", got)
+	}
+}
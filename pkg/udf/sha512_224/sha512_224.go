@@ -3,7 +3,6 @@ package sha512_224
 import (
 	"crypto/sha512"
 	"fmt"
-	"io"
 
 	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/udf/common"
@@ -11,10 +10,10 @@ import (
 
 // RegisterSHA512_224 registers the sha512_224 function with gojq
 func RegisterSHA512_224() gojq.CompilerOption {
-	return gojq.WithFunction("sha512_224", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("sha512_224", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("sha512_224: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("sha512_224: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -26,7 +25,7 @@ func RegisterSHA512_224() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("sha512_224: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "sha512_224: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -34,31 +33,18 @@ func RegisterSHA512_224() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "sha512_224",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("sha512_224: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("sha512_224: %w", err), meta)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			case io.Reader:
-				readBytes, err := io.ReadAll(val)
-				if err != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("sha512_224: failed to read input: %v", err), nil)
-				}
-				inputBytes = readBytes
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("sha512_224: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("sha512_224: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		hash := sha512.Sum512_224(inputBytes)
@@ -0,0 +1,421 @@
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Attachment is a file attached to an outgoing message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message holds the options accepted by smtp_send
+type Message struct {
+	From        string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	Subject     string
+	Body        string
+	HTML        bool
+	Attachments []Attachment
+	Username    string
+	Password    string
+	StartTLS    bool // require STARTTLS, unless TLS is set; on unless the options turn it off
+	TLS         bool
+	SkipVerify  bool
+}
+
+// parseAddressList accepts a single address string or an array of addresses
+func parseAddressList(v any, field string) ([]string, error) {
+	switch val := common.ExtractUDFValue(v).(type) {
+	case nil:
+		return nil, nil
+	case string:
+		var addrs []string
+		for _, addr := range strings.Split(val, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+		return addrs, nil
+	case []any:
+		addrs := make([]string, 0, len(val))
+		for i, item := range val {
+			addr, ok := common.ExtractUDFValue(item).(string)
+			if !ok {
+				return nil, common.Errorf(common.CodeInvalid, "%v[%d] must be a string, got %T", field, i, item)
+			}
+			addrs = append(addrs, addr)
+		}
+		return addrs, nil
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "%v must be a string or array of strings, got %T", field, val)
+	}
+}
+
+// parseAttachment converts an attachment option (a file path or an object) into an Attachment
+func parseAttachment(v any, index int) (Attachment, error) {
+	switch val := common.ExtractUDFValue(v).(type) {
+	case string:
+		data, absPath, _, err := common.ReadFileFromPath(val)
+		if err != nil {
+			return Attachment{}, err
+		}
+		return Attachment{Filename: filepath.Base(absPath), Data: data}, nil
+	case map[string]any:
+		var att Attachment
+		if name, ok := val["filename"].(string); ok {
+			att.Filename = name
+		}
+		if ct, ok := val["content_type"].(string); ok {
+			att.ContentType = ct
+		}
+		if path, ok := val["path"].(string); ok {
+			data, absPath, _, err := common.ReadFileFromPath(path)
+			if err != nil {
+				return Attachment{}, err
+			}
+			att.Data = data
+			if att.Filename == "" {
+				att.Filename = filepath.Base(absPath)
+			}
+		} else if content, ok := common.ExtractUDFValue(val["content"]).(string); ok {
+			att.Data = []byte(content)
+			if enc, _ := val["encoding"].(string); enc == "base64" {
+				decoded, err := base64.StdEncoding.DecodeString(content)
+				if err != nil {
+					return Attachment{}, common.Errorf(common.CodeInvalid, "attachments[%d]: invalid base64 content: %w", index, err)
+				}
+				att.Data = decoded
+			}
+		} else {
+			return Attachment{}, common.Errorf(common.CodeInvalid, "attachments[%d] requires either path or content", index)
+		}
+		if att.Filename == "" {
+			att.Filename = fmt.Sprintf("attachment%d", index+1)
+		}
+		return att, nil
+	default:
+		return Attachment{}, common.Errorf(common.CodeInvalid, "attachments[%d] must be a file path or object, got %T", index, val)
+	}
+}
+
+// ParseMessage builds a Message from the smtp_send options object
+func ParseMessage(opts map[string]any) (*Message, error) {
+	msg := &Message{StartTLS: true}
+
+	from, ok := opts["from"].(string)
+	if !ok || from == "" {
+		return nil, common.Errorf(common.CodeInvalid, "options.from is required")
+	}
+	msg.From = from
+
+	var err error
+	if msg.To, err = parseAddressList(opts["to"], "to"); err != nil {
+		return nil, err
+	}
+	if msg.Cc, err = parseAddressList(opts["cc"], "cc"); err != nil {
+		return nil, err
+	}
+	if msg.Bcc, err = parseAddressList(opts["bcc"], "bcc"); err != nil {
+		return nil, err
+	}
+	if len(msg.To)+len(msg.Cc)+len(msg.Bcc) == 0 {
+		return nil, common.Errorf(common.CodeInvalid, "at least one recipient is required in to, cc, or bcc")
+	}
+
+	if subject, ok := opts["subject"].(string); ok {
+		msg.Subject = subject
+	}
+	switch body := common.ExtractUDFValue(opts["body"]).(type) {
+	case nil:
+	case string:
+		msg.Body = body
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "options.body must be a string, got %T", body)
+	}
+	if html, ok := opts["html"].(bool); ok {
+		msg.HTML = html
+	}
+
+	if atts, ok := opts["attachments"].([]any); ok {
+		for i, a := range atts {
+			att, err := parseAttachment(a, i)
+			if err != nil {
+				return nil, err
+			}
+			msg.Attachments = append(msg.Attachments, att)
+		}
+	} else if opts["attachments"] != nil {
+		return nil, common.Errorf(common.CodeInvalid, "options.attachments must be an array, got %T", opts["attachments"])
+	}
+
+	if username, ok := opts["username"].(string); ok {
+		msg.Username = username
+	}
+	if password, ok := opts["password"].(string); ok {
+		msg.Password = password
+	}
+	if starttls, ok := opts["starttls"].(bool); ok {
+		msg.StartTLS = starttls
+	}
+	if useTLS, ok := opts["tls"].(bool); ok {
+		msg.TLS = useTLS
+	}
+	if skip, ok := opts["insecure_skip_verify"].(bool); ok {
+		msg.SkipVerify = skip
+	}
+
+	return msg, nil
+}
+
+// Recipients returns every envelope recipient (to, cc, and bcc)
+func (m *Message) Recipients() []string {
+	recipients := make([]string, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	recipients = append(recipients, m.To...)
+	recipients = append(recipients, m.Cc...)
+	return append(recipients, m.Bcc...)
+}
+
+// randomBoundary returns a random MIME boundary or Message-ID component
+func randomBoundary() string {
+	var buf [12]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%x", buf[:])
+}
+
+// writeBase64Lines writes data as base64 wrapped at 76 characters per RFC 2045
+func writeBase64Lines(buf *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76])
+		buf.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+	buf.WriteString("\r\n")
+}
+
+// Build renders the message as RFC 5322 bytes and returns them with the Message-ID
+func (m *Message) Build(host string) ([]byte, string) {
+	var buf bytes.Buffer
+	messageID := fmt.Sprintf("<%s@%s>", randomBoundary(), host)
+
+	buf.WriteString("From: " + m.From + "\r\n")
+	if len(m.To) > 0 {
+		buf.WriteString("To: " + strings.Join(m.To, ", ") + "\r\n")
+	}
+	if len(m.Cc) > 0 {
+		buf.WriteString("Cc: " + strings.Join(m.Cc, ", ") + "\r\n")
+	}
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", m.Subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("Message-ID: " + messageID + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	bodyType := "text/plain"
+	if m.HTML {
+		bodyType = "text/html"
+	}
+
+	if len(m.Attachments) == 0 {
+		buf.WriteString("Content-Type: " + bodyType + "; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		writeBase64Lines(&buf, []byte(m.Body))
+		return buf.Bytes(), messageID
+	}
+
+	boundary := randomBoundary()
+	buf.WriteString("Content-Type: multipart/mixed; boundary=\"" + boundary + "\"\r\n\r\n")
+
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: " + bodyType + "; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	writeBase64Lines(&buf, []byte(m.Body))
+
+	for _, att := range m.Attachments {
+		contentType := att.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(att.Filename))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		buf.WriteString("--" + boundary + "\r\n")
+		buf.WriteString("Content-Type: " + contentType + "\r\n")
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+		buf.WriteString("Content-Disposition: " + mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename}) + "\r\n\r\n")
+		writeBase64Lines(&buf, att.Data)
+	}
+	buf.WriteString("--" + boundary + "--\r\n")
+
+	return buf.Bytes(), messageID
+}
+
+// Send delivers the message through the given server ("host:port"). The
+// whole exchange stops at the deadline of ctx
+func (m *Message) Send(ctx context.Context, server string, data []byte) (bool, error) {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return false, common.Errorf(common.CodeInvalid, "invalid server address %q: %w", server, err)
+	}
+	if err := common.CheckNet(host); err != nil {
+		return false, err
+	}
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: m.SkipVerify}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if m.TLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", server)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", server)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to %v: %w", server, err)
+	}
+	common.SetDeadline(ctx, conn)
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return false, fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if hostname, err := os.Hostname(); err == nil {
+		if err := client.Hello(hostname); err != nil {
+			return false, fmt.Errorf("HELO failed: %w", err)
+		}
+	}
+
+	// Only an explicit starttls: false sends the message, and any
+	// credentials, in plaintext
+	usedStartTLS := false
+	if !m.TLS && m.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return false, common.Errorf(common.CodeFailed, "server does not support STARTTLS; set starttls: false to send in plaintext")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return false, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+		usedStartTLS = true
+	}
+
+	if m.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return usedStartTLS, fmt.Errorf("server does not support AUTH")
+		}
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return usedStartTLS, fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.From); err != nil {
+		return usedStartTLS, fmt.Errorf("MAIL FROM rejected: %w", err)
+	}
+	for _, rcpt := range m.Recipients() {
+		if err := client.Rcpt(rcpt); err != nil {
+			return usedStartTLS, fmt.Errorf("RCPT TO %q rejected: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return usedStartTLS, fmt.Errorf("DATA rejected: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return usedStartTLS, fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return usedStartTLS, fmt.Errorf("message rejected: %w", err)
+	}
+
+	return usedStartTLS, client.Quit()
+}
+
+// RegisterSMTPSend registers the smtp_send function with gojq
+func RegisterSMTPSend() gojq.CompilerOption {
+	return common.WithFunction("smtp_send", 1, 2, common.Audited("smtp_send", func(v any, args []any) any {
+		server, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok || server == "" {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "smtp_send: server argument must be a \"host:port\" string, got %T", args[0]), nil)
+		}
+
+		// Options come from the second argument, or the pipeline value
+		var optsVal any
+		if len(args) > 1 {
+			optsVal = common.ExtractUDFValue(args[1])
+		} else {
+			optsVal = common.ExtractUDFValue(v)
+		}
+		opts, ok := optsVal.(map[string]any)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "smtp_send: options must be an object, got %T", optsVal), nil)
+		}
+
+		msg, err := ParseMessage(opts)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("smtp_send: %w", err), nil)
+		}
+
+		// With explicit options, the pipeline value becomes the body when none is set
+		if len(args) > 1 && opts["body"] == nil {
+			switch body := common.ExtractUDFValue(v).(type) {
+			case nil:
+			case string:
+				msg.Body = body
+			default:
+				encoded, err := json.MarshalIndent(body, "", "  ")
+				if err != nil {
+					return common.MakeUDFErrorResult(fmt.Errorf("smtp_send: failed to encode body: %w", err), nil)
+				}
+				msg.Body = string(encoded)
+			}
+		}
+
+		host, _, _ := net.SplitHostPort(server)
+		data, messageID := msg.Build(host)
+
+		meta := map[string]any{
+			"operation":    "smtp_send",
+			"server":       server,
+			"from":         msg.From,
+			"recipients":   len(msg.Recipients()),
+			"attachments":  len(msg.Attachments),
+			"message_size": len(data),
+			"message_id":   messageID,
+		}
+
+		ctx, cancel := common.Context()
+		defer cancel()
+		usedStartTLS, err := msg.Send(ctx, server, data)
+		meta["starttls"] = usedStartTLS
+		meta["tls"] = msg.TLS
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("smtp_send: %w", err), meta)
+		}
+
+		return common.MakeUDFSuccessResult(messageID, meta)
+	}))
+}
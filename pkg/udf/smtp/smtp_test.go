@@ -0,0 +1,274 @@
+package smtp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+// fakeServer is a minimal SMTP server that records a single session
+type fakeServer struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	auth  string
+	from  string
+	rcpts []string
+	data  string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &fakeServer{listener: l}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(func() {
+		l.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) serve() {
+	defer s.wg.Done()
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.mu.Lock()
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			s.auth = line
+			reply("235 ok")
+		case "MAIL":
+			s.from = line
+			reply("250 ok")
+		case "RCPT":
+			s.rcpts = append(s.rcpts, line)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var sb strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					s.mu.Unlock()
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				sb.WriteString(l)
+			}
+			s.data = sb.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			reply("502 unknown")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestSMTPSend(t *testing.T) {
+	server := newFakeServer(t)
+
+	tmpDir := t.TempDir()
+	attPath := filepath.Join(tmpDir, "report.txt")
+	if err := os.WriteFile(attPath, []byte("report contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	query := fmt.Sprintf(`smtp_send(%q; {from: "a@example.com", to: ["b@example.com"], bcc: "c@example.com", subject: "Report", username: "user", password: "pass", starttls: false, attachments: [%q]})`, server.addr(), attPath)
+	result := runGojqQuery(t, query, "body from pipeline", RegisterSMTPSend())
+
+	resultMap, ok := result.(map[string]any)
+	if !ok {
+		t.Fatalf("Expected map, got %T", result)
+	}
+	if resultMap["_err"] != nil {
+		t.Fatalf("Unexpected error: %v", resultMap["_err"])
+	}
+	messageID, ok := resultMap["_val"].(string)
+	if !ok || !strings.HasPrefix(messageID, "<") {
+		t.Errorf("Expected Message-ID as _val, got %v", resultMap["_val"])
+	}
+
+	meta := resultMap["_meta"].(map[string]any)
+	if meta["operation"] != "smtp_send" {
+		t.Errorf("Expected operation smtp_send, got %v", meta["operation"])
+	}
+	if meta["recipients"] != 2 {
+		t.Errorf("Expected 2 recipients, got %v", meta["recipients"])
+	}
+	if meta["attachments"] != 1 {
+		t.Errorf("Expected 1 attachment, got %v", meta["attachments"])
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !strings.HasPrefix(server.auth, "AUTH PLAIN") {
+		t.Errorf("Expected AUTH PLAIN, got %q", server.auth)
+	}
+	if server.from != "MAIL FROM:<a@example.com>" {
+		t.Errorf("Unexpected MAIL FROM: %q", server.from)
+	}
+	if len(server.rcpts) != 2 {
+		t.Errorf("Expected 2 RCPT commands, got %v", server.rcpts)
+	}
+	if strings.Contains(server.data, "c@example.com") {
+		t.Error("Bcc recipient must not appear in message headers")
+	}
+	if !strings.Contains(server.data, "Subject: Report") {
+		t.Error("Message should contain the subject header")
+	}
+	if !strings.Contains(server.data, base64.StdEncoding.EncodeToString([]byte("body from pipeline"))) {
+		t.Error("Message should contain the pipeline value as body")
+	}
+	if !strings.Contains(server.data, `filename=report.txt`) {
+		t.Error("Message should contain the attachment")
+	}
+}
+
+func TestSMTPSendRequiresStartTLS(t *testing.T) {
+	for _, options := range []string{
+		`{from: "a@example.com", to: "b@example.com"}`,
+		`{from: "a@example.com", to: "b@example.com", starttls: true}`,
+		`{from: "a@example.com", to: "b@example.com", username: "user", password: "pass"}`,
+	} {
+		server := newFakeServer(t)
+		query := fmt.Sprintf(`smtp_send(%q; %s)`, server.addr(), options)
+		result := runGojqQuery(t, query, "body", RegisterSMTPSend())
+		if errStr := common.GetUDFError(result); !strings.Contains(errStr, "server does not support STARTTLS") {
+			t.Errorf("%s: expected a STARTTLS error, got %v", options, errStr)
+		}
+		server.mu.Lock()
+		if server.auth != "" || server.from != "" {
+			t.Errorf("%s: sent %q and %q in plaintext", options, server.auth, server.from)
+		}
+		server.mu.Unlock()
+	}
+}
+
+func TestSMTPSendErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		input any
+		err   string
+	}{
+		{"missing from", `smtp_send("127.0.0.1:25"; {to: "b@example.com"})`, nil, "from is required"},
+		{"missing recipients", `smtp_send("127.0.0.1:25"; {from: "a@example.com"})`, nil, "at least one recipient"},
+		{"non-object options", `smtp_send("127.0.0.1:25")`, "text", "options must be an object"},
+		{"bad attachment", `smtp_send("127.0.0.1:25"; {from: "a@example.com", to: "b@example.com", attachments: [{filename: "x"}]})`, nil, "requires either path or content"},
+		{"bad server", `smtp_send("no-port"; {from: "a@example.com", to: "b@example.com"})`, nil, "invalid server address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runGojqQuery(t, tt.query, tt.input, RegisterSMTPSend())
+			resultMap := result.(map[string]any)
+			if errStr := common.GetUDFError(resultMap); !strings.Contains(errStr, tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, resultMap["_err"])
+			}
+		})
+	}
+}
+
+func TestMessageBuild(t *testing.T) {
+	msg, err := ParseMessage(map[string]any{
+		"from":    "a@example.com",
+		"to":      "b@example.com, c@example.com",
+		"subject": "Grüße",
+		"body":    "<p>hi</p>",
+		"html":    true,
+		"attachments": []any{
+			map[string]any{"filename": "data.json", "content": "e30=", "encoding": "base64"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if len(msg.To) != 2 {
+		t.Errorf("Expected 2 To addresses, got %v", msg.To)
+	}
+	if string(msg.Attachments[0].Data) != "{}" {
+		t.Errorf("Expected decoded attachment content, got %q", msg.Attachments[0].Data)
+	}
+
+	data, messageID := msg.Build("example.com")
+	out := string(data)
+	if !strings.Contains(out, "Message-ID: "+messageID) {
+		t.Error("Message should contain its Message-ID")
+	}
+	if !strings.Contains(out, "Subject: =?utf-8?q?") {
+		t.Error("Non-ASCII subject should be Q-encoded")
+	}
+	if !strings.Contains(out, "multipart/mixed") || !strings.Contains(out, "text/html") {
+		t.Error("Message should be multipart with an HTML body part")
+	}
+	if !strings.Contains(out, "Content-Type: application/json") {
+		t.Error("Attachment content type should be inferred from its extension")
+	}
+}
@@ -10,10 +10,10 @@ import (
 
 // RegisterSSDeep registers the ssdeep function with gojq
 func RegisterSSDeep() gojq.CompilerOption {
-	return gojq.WithFunction("ssdeep", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("ssdeep", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("ssdeep: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("ssdeep: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -25,7 +25,7 @@ func RegisterSSDeep() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("ssdeep: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "ssdeep: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -34,25 +34,18 @@ func RegisterSSDeep() gojq.CompilerOption {
 					"operation": "ssdeep",
 					"file_path": absPath,
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("ssdeep: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("ssdeep: %w", err), meta)
 			}
 
 			inputBytes = fileData
 			filePath = absPath
 			fileSize = size
 		} else {
-			switch val := inputVal.(type) {
-			case string:
-				inputBytes = []byte(val)
-			case []byte:
-				inputBytes = val
-			default:
-				if str, ok := val.(fmt.Stringer); ok {
-					inputBytes = []byte(str.String())
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("ssdeep: argument must be a string or bytes, got %T", val), nil)
-				}
+			b, err := common.InputBytes(inputVal)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("ssdeep: %w", err), nil)
 			}
+			inputBytes = b
 		}
 
 		// Calculate ssdeep hash
@@ -71,9 +64,9 @@ func RegisterSSDeep() gojq.CompilerOption {
 			
 			// Check if it's the "file too small" error
 			if err.Error() == "did not process files large enough to produce meaningful results" {
-				return common.MakeUDFErrorResult(fmt.Errorf("ssdeep: input too small (minimum 4096 bytes required, got %d bytes)", len(inputBytes)), meta)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "ssdeep: input too small (minimum 4096 bytes required, got %d bytes)", len(inputBytes)), meta)
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("ssdeep: failed to calculate hash: %v", err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("ssdeep: failed to calculate hash: %w", err), meta)
 		}
 
 		meta := map[string]any{
@@ -94,9 +87,9 @@ func RegisterSSDeep() gojq.CompilerOption {
 
 // RegisterSSDeepCompare registers the ssdeep_compare function with gojq
 func RegisterSSDeepCompare() gojq.CompilerOption {
-	return gojq.WithFunction("ssdeep_compare", 2, 2, func(v any, args []any) any {
+	return common.WithFunction("ssdeep_compare", 2, 2, func(v any, args []any) any {
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("ssdeep_compare: expected 2 arguments (hash1, hash2)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "ssdeep_compare: expected 2 arguments (hash1, hash2)"), nil)
 		}
 
 		hash1Val := common.ExtractUDFValue(args[0])
@@ -113,7 +106,7 @@ func RegisterSSDeepCompare() gojq.CompilerOption {
 			if str, ok := val.(fmt.Stringer); ok {
 				hash1 = str.String()
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("ssdeep_compare: first argument must be a string, got %T", val), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "ssdeep_compare: first argument must be a string, got %T", val), nil)
 			}
 		}
 
@@ -126,7 +119,7 @@ func RegisterSSDeepCompare() gojq.CompilerOption {
 			if str, ok := val.(fmt.Stringer); ok {
 				hash2 = str.String()
 			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("ssdeep_compare: second argument must be a string, got %T", val), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "ssdeep_compare: second argument must be a string, got %T", val), nil)
 			}
 		}
 
@@ -138,7 +131,7 @@ func RegisterSSDeepCompare() gojq.CompilerOption {
 				"hash1":     hash1,
 				"hash2":     hash2,
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("ssdeep_compare: failed to compare hashes: %v", err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("ssdeep_compare: failed to compare hashes: %w", err), meta)
 		}
 
 		meta := map[string]any{
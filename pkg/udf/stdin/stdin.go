@@ -0,0 +1,105 @@
+package stdin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// lineReader is shared by every call, so a second stdin_lines continues
+// where the first stopped instead of losing what the first buffered
+type lineReader struct {
+	mu     sync.Mutex
+	src    io.Reader
+	reader *bufio.Reader
+	line   int
+}
+
+var input = &lineReader{src: os.Stdin}
+
+// next reads one line without its line ending. ok is false at the end of
+// the input
+func (r *lineReader) next() (line string, number int, ok bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.reader == nil {
+		r.reader = bufio.NewReader(r.src)
+	}
+	s, err := r.reader.ReadString('\n')
+	if err == io.EOF {
+		if s == "" {
+			return "", r.line, false, nil
+		}
+		err = nil
+	}
+	if err != nil {
+		return "", r.line, false, err
+	}
+	r.line++
+	s = strings.TrimSuffix(s, "\n")
+	s = strings.TrimSuffix(s, "\r")
+	return s, r.line, true, nil
+}
+
+// linesIter yields lines as they are read, up to max when it is positive
+type linesIter struct {
+	max  int
+	seen int
+	done bool
+}
+
+func (it *linesIter) Next() (any, bool) {
+	if it.done || (it.max > 0 && it.seen >= it.max) {
+		return nil, false
+	}
+	line, number, ok, err := input.next()
+	if err != nil {
+		it.done = true
+		return common.MakeUDFErrorResult(fmt.Errorf("stdin_lines: %w", err), map[string]any{
+			"operation":   "stdin_lines",
+			"line_number": number,
+		}), true
+	}
+	if !ok {
+		it.done = true
+		return nil, false
+	}
+	it.seen++
+	return common.MakeUDFSuccessResult(line, map[string]any{
+		"operation":   "stdin_lines",
+		"line_number": number,
+	}), true
+}
+
+// RegisterStdinLines registers the stdin_lines function with gojq
+func RegisterStdinLines() gojq.CompilerOption {
+	return common.WithIterFunction("stdin_lines", 0, 1, func(v any, args []any) gojq.Iter {
+		// Each line is a separate output, read only when the pipeline asks
+		// for it, so a live stream is processed as it arrives
+		it := &linesIter{}
+		if len(args) > 0 {
+			switch n := common.ExtractUDFValue(args[0]).(type) {
+			case int:
+				it.max = n
+			case float64:
+				if n != math.Trunc(n) || n > math.MaxInt32 {
+					return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "stdin_lines: count must be an integer, got %v", n), nil))
+				}
+				it.max = int(n)
+			default:
+				return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "stdin_lines: count must be a number, got %T", n), nil))
+			}
+			if it.max <= 0 {
+				return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "stdin_lines: count must be positive, got %v", it.max), nil))
+			}
+		}
+		return it
+	})
+}
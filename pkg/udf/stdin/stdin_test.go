@@ -0,0 +1,90 @@
+package stdin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query, returning every output
+func runGojqQuery(t *testing.T, query string, input any) []any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+	code, err := gojq.Compile(q, RegisterStdinLines())
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+	var results []any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+func setInput(t *testing.T, s string) {
+	old := input
+	input = &lineReader{src: strings.NewReader(s)}
+	t.Cleanup(func() { input = old })
+}
+
+func TestStdinLines(t *testing.T) {
+	setInput(t, "alpha\r\nbeta\n\ngamma")
+	got := runGojqQuery(t, `stdin_lines | [._val, ._meta.line_number]`, nil)
+	want := []any{
+		[]any{"alpha", 1},
+		[]any{"beta", 2},
+		[]any{"", 3},
+		[]any{"gamma", 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stdin_lines = %v, want %v", got, want)
+	}
+}
+
+func TestStdinLinesContinues(t *testing.T) {
+	// A count stops reading, and a later call picks up the next line
+	setInput(t, "1\n2\n3\n4\n")
+	got := runGojqQuery(t, `[stdin_lines(2) | ._val], [first(stdin_lines) | ._val], [stdin_lines | ._meta.line_number]`, nil)
+	want := []any{[]any{"1", "2"}, []any{"3"}, []any{4}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stdin_lines = %v, want %v", got, want)
+	}
+}
+
+func TestStdinLinesErrors(t *testing.T) {
+	setInput(t, "")
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`stdin_lines(0)`, "stdin_lines: count must be positive"},
+		{`stdin_lines(1.5)`, "stdin_lines: count must be an integer"},
+		{`stdin_lines("all")`, "stdin_lines: count must be a number"},
+	}
+	for _, tt := range tests {
+		results := runGojqQuery(t, tt.query, nil)
+		if len(results) != 1 {
+			t.Fatalf("%s: got %d results, want 1", tt.query, len(results))
+		}
+		msg := common.GetUDFError(results[0])
+		if !strings.HasPrefix(msg, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, msg, tt.want)
+		}
+	}
+	if results := runGojqQuery(t, `stdin_lines`, nil); len(results) != 0 {
+		t.Errorf("stdin_lines on empty input = %v, want nothing", results)
+	}
+}
@@ -10,10 +10,10 @@ import (
 
 // RegisterUpper registers the upper function with gojq
 func RegisterUpper() gojq.CompilerOption {
-	return gojq.WithFunction("upper", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("upper", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("upper: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("upper: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -25,12 +25,12 @@ func RegisterUpper() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("upper: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "upper: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("upper: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("upper: %w", err), nil)
 			}
 
 			input = string(fileData)
@@ -46,7 +46,7 @@ func RegisterUpper() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("upper: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "upper: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -70,10 +70,10 @@ func RegisterUpper() gojq.CompilerOption {
 
 // RegisterLower registers the lower function with gojq
 func RegisterLower() gojq.CompilerOption {
-	return gojq.WithFunction("lower", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("lower", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("lower: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("lower: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -85,12 +85,12 @@ func RegisterLower() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("lower: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "lower: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("lower: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("lower: %w", err), nil)
 			}
 
 			input = string(fileData)
@@ -106,7 +106,7 @@ func RegisterLower() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("lower: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "lower: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -130,10 +130,10 @@ func RegisterLower() gojq.CompilerOption {
 
 // RegisterReverse registers the reverse_string function with gojq
 func RegisterReverse() gojq.CompilerOption {
-	return gojq.WithFunction("reverse_string", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("reverse_string", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("reverse: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("reverse: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -145,12 +145,12 @@ func RegisterReverse() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("reverse: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "reverse: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("reverse: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("reverse: %w", err), nil)
 			}
 
 			input = string(fileData)
@@ -166,7 +166,7 @@ func RegisterReverse() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("reverse: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "reverse: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -195,20 +195,20 @@ func RegisterReverse() gojq.CompilerOption {
 
 // RegisterReplace registers the replace function with gojq
 func RegisterReplace() gojq.CompilerOption {
-	return gojq.WithFunction("replace", 2, 4, func(v any, args []any) any {
+	return common.WithFunction("replace", 2, 4, func(v any, args []any) any {
 		// Parse arguments: old, new, optional input, optional file flag
 		if len(args) < 2 {
-			return common.MakeUDFErrorResult(fmt.Errorf("replace: expected at least 2 arguments (old, new)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "replace: expected at least 2 arguments (old, new)"), nil)
 		}
 
 		oldStr, ok := args[0].(string)
 		if !ok {
-			return common.MakeUDFErrorResult(fmt.Errorf("replace: first argument (old) must be a string, got %T", args[0]), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "replace: first argument (old) must be a string, got %T", args[0]), nil)
 		}
 
 		newStr, ok := args[1].(string)
 		if !ok {
-			return common.MakeUDFErrorResult(fmt.Errorf("replace: second argument (new) must be a string, got %T", args[1]), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "replace: second argument (new) must be a string, got %T", args[1]), nil)
 		}
 
 		var inputVal any
@@ -241,12 +241,12 @@ func RegisterReplace() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("replace: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "replace: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("replace: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("replace: %w", err), nil)
 			}
 
 			input = string(fileData)
@@ -262,7 +262,7 @@ func RegisterReplace() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("replace: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "replace: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
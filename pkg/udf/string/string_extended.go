@@ -10,10 +10,10 @@ import (
 
 // RegisterTrim registers the trim function with gojq
 func RegisterTrim() gojq.CompilerOption {
-	return gojq.WithFunction("trim", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("trim", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("trim: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("trim: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -25,12 +25,12 @@ func RegisterTrim() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("trim: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "trim: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("trim: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("trim: %w", err), nil)
 			}
 
 			input = string(fileData)
@@ -46,7 +46,7 @@ func RegisterTrim() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("trim: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "trim: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -71,14 +71,14 @@ func RegisterTrim() gojq.CompilerOption {
 
 // RegisterSplit registers the split function with gojq
 func RegisterSplit() gojq.CompilerOption {
-	return gojq.WithFunction("split", 1, 3, func(v any, args []any) any {
+	return common.WithFunction("split", 1, 3, func(v any, args []any) any {
 		if len(args) < 1 {
-			return common.MakeUDFErrorResult(fmt.Errorf("split: expected at least 1 argument (separator)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "split: expected at least 1 argument (separator)"), nil)
 		}
 
 		separator, ok := args[0].(string)
 		if !ok {
-			return common.MakeUDFErrorResult(fmt.Errorf("split: first argument (separator) must be a string, got %T", args[0]), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "split: first argument (separator) must be a string, got %T", args[0]), nil)
 		}
 
 		var inputVal any
@@ -109,12 +109,12 @@ func RegisterSplit() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("split: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "split: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("split: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("split: %w", err), nil)
 			}
 
 			input = string(fileData)
@@ -130,7 +130,7 @@ func RegisterSplit() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("split: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "split: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -161,14 +161,14 @@ func RegisterSplit() gojq.CompilerOption {
 
 // RegisterJoin registers the join_string function with gojq (renamed to avoid conflict with gojq's built-in join)
 func RegisterJoin() gojq.CompilerOption {
-	return gojq.WithFunction("join_string", 1, 1, func(v any, args []any) any {
+	return common.WithFunction("join_string", 1, 1, func(v any, args []any) any {
 		if len(args) < 1 {
-			return common.MakeUDFErrorResult(fmt.Errorf("join_string: expected at least 1 argument (separator)"), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "join_string: expected at least 1 argument (separator)"), nil)
 		}
 
 		separator, ok := args[0].(string)
 		if !ok {
-			return common.MakeUDFErrorResult(fmt.Errorf("join_string: first argument (separator) must be a string, got %T", args[0]), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "join_string: first argument (separator) must be a string, got %T", args[0]), nil)
 		}
 
 		// Extract _val if it's a UDF result
@@ -180,7 +180,7 @@ func RegisterJoin() gojq.CompilerOption {
 		case []any:
 			arr = val
 		default:
-			return common.MakeUDFErrorResult(fmt.Errorf("join_string: input must be an array, got %T", val), nil)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "join_string: input must be an array, got %T", val), nil)
 		}
 
 		// Convert array elements to strings
@@ -0,0 +1,227 @@
+package structpack
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// maxWidth bounds the byte width of int_to_bytes and bswap
+const maxWidth = 4096
+
+// parseEndianness accepts "big"/"be" and "little"/"le"
+func parseEndianness(raw any) (string, error) {
+	s, ok := common.ExtractUDFValue(raw).(string)
+	if !ok {
+		return "", common.Errorf(common.CodeInvalid, "endianness must be a string, got %T", common.ExtractUDFValue(raw))
+	}
+	switch strings.ToLower(s) {
+	case "big", "be":
+		return "big", nil
+	case "little", "le":
+		return "little", nil
+	}
+	return "", common.Errorf(common.CodeInvalid, `endianness must be "big" or "little", got %q`, s)
+}
+
+// widthArg reads a byte width
+func widthArg(raw any) (int, error) {
+	var n int
+	switch val := common.ExtractUDFValue(raw).(type) {
+	case int:
+		n = val
+	case float64:
+		if val != math.Trunc(val) || math.Abs(val) > maxWidth+1 {
+			return 0, common.Errorf(common.CodeInvalid, "width must be an integer, got %v", val)
+		}
+		n = int(val)
+	default:
+		return 0, common.Errorf(common.CodeInvalid, "width must be a number, got %T", val)
+	}
+	if n < 1 || n > maxWidth {
+		return 0, common.Errorf(common.CodeInvalid, "width must be from 1 to %d, got %d", maxWidth, n)
+	}
+	return n, nil
+}
+
+// bytesArg reads binary data, given as a string of bytes or an array of
+// byte values
+func bytesArg(v any) ([]byte, error) {
+	switch val := common.ExtractUDFValue(v).(type) {
+	case string, []byte, []any:
+		return common.InputBytes(val)
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "input must be a string of bytes, got %T", val)
+	}
+}
+
+// integerArg reads an integer value
+func integerArg(v any) (*big.Int, error) {
+	switch val := common.ExtractUDFValue(v).(type) {
+	case int:
+		return big.NewInt(int64(val)), nil
+	case float64:
+		if val != math.Trunc(val) || math.IsInf(val, 0) {
+			return nil, common.Errorf(common.CodeInvalid, "input must be an integer, got %v", val)
+		}
+		n, _ := big.NewFloat(val).Int(nil)
+		return n, nil
+	case *big.Int:
+		return val, nil
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "input must be an integer, got %T", val)
+	}
+}
+
+// BytesToInt reads b as an unsigned, or two's complement signed, integer
+func BytesToInt(b []byte, endianness string, signed bool) *big.Int {
+	be := slices.Clone(b)
+	if endianness == "little" {
+		slices.Reverse(be)
+	}
+	n := new(big.Int).SetBytes(be)
+	if signed && len(be) > 0 && be[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(be)*8)))
+	}
+	return n
+}
+
+// IntToBytes writes n in width bytes, negative numbers in two's complement
+func IntToBytes(n *big.Int, width int, endianness string) ([]byte, error) {
+	bits := uint(width * 8)
+	limit := new(big.Int).Lsh(big.NewInt(1), bits)
+	u := new(big.Int).Set(n)
+	if n.Sign() < 0 {
+		// The most negative value of the width is -2^(bits-1)
+		if new(big.Int).Neg(n).Cmp(new(big.Int).Rsh(limit, 1)) > 0 {
+			return nil, common.Errorf(common.CodeInvalid, "%v does not fit in a %d-byte integer", n, width)
+		}
+		u.Add(u, limit)
+	} else if n.Cmp(limit) >= 0 {
+		return nil, common.Errorf(common.CodeInvalid, "%v does not fit in a %d-byte integer", n, width)
+	}
+	b := u.FillBytes(make([]byte, width))
+	if endianness == "little" {
+		slices.Reverse(b)
+	}
+	return b, nil
+}
+
+// intResult converts n to an int when it fits
+func intResult(n *big.Int) any {
+	if n.IsInt64() && n.Int64() >= math.MinInt && n.Int64() <= math.MaxInt {
+		return int(n.Int64())
+	}
+	return n
+}
+
+// RegisterBytesToInt registers the bytes_to_int function with gojq
+func RegisterBytesToInt() gojq.CompilerOption {
+	return common.WithFunction("bytes_to_int", 1, 2, func(v any, args []any) any {
+		// bytes_to_int(endianness) or bytes_to_int(endianness; signed)
+		endianness, err := parseEndianness(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("bytes_to_int: %w", err), nil)
+		}
+		signed := false
+		if len(args) > 1 {
+			b, ok := common.ExtractUDFValue(args[1]).(bool)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "bytes_to_int: signed must be a boolean, got %T", common.ExtractUDFValue(args[1])), nil)
+			}
+			signed = b
+		}
+		data, err := bytesArg(v)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("bytes_to_int: %w", err), nil)
+		}
+		if len(data) == 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "bytes_to_int: input is empty"), nil)
+		}
+
+		return common.MakeUDFSuccessResult(intResult(BytesToInt(data, endianness, signed)), map[string]any{
+			"operation":  "bytes_to_int",
+			"endianness": endianness,
+			"signed":     signed,
+			"width":      len(data),
+		})
+	})
+}
+
+// RegisterIntToBytes registers the int_to_bytes function with gojq
+func RegisterIntToBytes() gojq.CompilerOption {
+	return common.WithFunction("int_to_bytes", 2, 2, func(v any, args []any) any {
+		width, err := widthArg(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("int_to_bytes: %w", err), nil)
+		}
+		endianness, err := parseEndianness(args[1])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("int_to_bytes: %w", err), nil)
+		}
+		n, err := integerArg(v)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("int_to_bytes: %w", err), nil)
+		}
+		b, err := IntToBytes(n, width, endianness)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("int_to_bytes: %w", err), nil)
+		}
+
+		return common.MakeUDFSuccessResult(string(b), map[string]any{
+			"operation":  "int_to_bytes",
+			"endianness": endianness,
+			"width":      width,
+			"signed":     n.Sign() < 0,
+		})
+	})
+}
+
+// RegisterBswap registers the bswap function with gojq
+func RegisterBswap() gojq.CompilerOption {
+	return common.WithFunction("bswap", 0, 1, func(v any, args []any) any {
+		// Strings of bytes are reversed; integers need the width to swap in,
+		// bswap(width), and are treated as unsigned
+		input := common.ExtractUDFValue(v)
+		if s, ok := input.(string); ok {
+			if len(args) > 0 {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "bswap: width only applies to integers"), nil)
+			}
+			b := []byte(s)
+			slices.Reverse(b)
+			return common.MakeUDFSuccessResult(string(b), map[string]any{
+				"operation": "bswap",
+				"width":     len(b),
+			})
+		}
+
+		n, err := integerArg(input)
+		if err != nil {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "bswap: input must be a string of bytes or an integer, got %T", input), nil)
+		}
+		if len(args) == 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "bswap: width is required for integers, e.g. bswap(4)"), nil)
+		}
+		width, err := widthArg(args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("bswap: %w", err), nil)
+		}
+		if n.Sign() < 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "bswap: integer must not be negative, got %v", n), nil)
+		}
+		b, err := IntToBytes(n, width, "big")
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("bswap: %w", err), nil)
+		}
+
+		return common.MakeUDFSuccessResult(intResult(BytesToInt(b, "little", false)), map[string]any{
+			"operation": "bswap",
+			"width":     width,
+		})
+	})
+}
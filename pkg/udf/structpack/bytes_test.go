@@ -0,0 +1,86 @@
+package structpack
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+var bytesOpts = []gojq.CompilerOption{RegisterBytesToInt(), RegisterIntToBytes(), RegisterBswap()}
+
+func TestBytesUDFs(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  any
+	}{
+		{`bytes_to_int("big") | ._val`, "\x01\x02", 258},
+		{`bytes_to_int("little") | ._val`, "\x01\x02", 513},
+		{`bytes_to_int("le") | ._val`, "\xff\xff", 65535},
+		{`bytes_to_int("le"; true) | ._val`, "\xff\xff", -1},
+		{`bytes_to_int("be"; true) | ._val`, "\x80\x00\x00\x00", -2147483648},
+		{`bytes_to_int("be"; true) | ._val`, "\x7f", 127},
+		{`bytes_to_int("big") | ._val`, []any{1, 2}, 258},
+		{`bytes_to_int("big") | ._meta | [.endianness, .width, .signed]`, "\x00\x00\x01", []any{"big", 3, false}},
+		{`int_to_bytes(4; "big") | ._val`, 258, "\x00\x00\x01\x02"},
+		{`int_to_bytes(2; "little") | ._val`, 258, "\x02\x01"},
+		{`int_to_bytes(2; "little") | ._val`, -2, "\xfe\xff"},
+		{`int_to_bytes(1; "big") | ._val`, -128, "\x80"},
+		{`int_to_bytes(8; "little") | bytes_to_int("little"; true) | ._val`, -1234567890123, -1234567890123},
+		{`bswap | ._val`, "\x01\x02\x03", "\x03\x02\x01"},
+		{`bswap(4) | ._val`, 0x12345678, 0x78563412},
+		{`bswap(2) | ._val`, 0x00ff, 0xff00},
+		{`bswap(8) | ._val`, 1, 72057594037927936},
+	}
+	for _, tt := range tests {
+		got := runGojqQuery(t, tt.query, tt.input, bytesOpts...)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s on %q = %#v, want %#v", tt.query, tt.input, got, tt.want)
+		}
+	}
+
+	// Integers wider than an int come back as *big.Int
+	got := runGojqQuery(t, `bytes_to_int("big") | ._val`, strings.Repeat("\xff", 16), bytesOpts...)
+	want, _ := new(big.Int).SetString("340282366920938463463374607431768211455", 10)
+	if n, ok := got.(*big.Int); !ok || n.Cmp(want) != 0 {
+		t.Errorf("bytes_to_int of 16 bytes = %v", got)
+	}
+}
+
+func TestBytesErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`bytes_to_int("middle")`, "a", `bytes_to_int: endianness must be "big" or "little", got "middle"`},
+		{`bytes_to_int(1)`, "a", "bytes_to_int: endianness must be a string"},
+		{`bytes_to_int("big"; "yes")`, "a", "bytes_to_int: signed must be a boolean"},
+		{`bytes_to_int("big")`, "", "bytes_to_int: input is empty"},
+		{`bytes_to_int("big")`, 5, "bytes_to_int: input must be a string of bytes"},
+		{`bytes_to_int("big")`, []any{1, 256}, "bytes_to_int: array input must be bytes (integers 0-255)"},
+		{`int_to_bytes(1; "big")`, 256, "int_to_bytes: 256 does not fit in a 1-byte integer"},
+		{`int_to_bytes(1; "big")`, -129, "int_to_bytes: -129 does not fit in a 1-byte integer"},
+		{`int_to_bytes(0; "big")`, 1, "int_to_bytes: width must be from 1 to 4096, got 0"},
+		{`int_to_bytes(1.5; "big")`, 1, "int_to_bytes: width must be an integer"},
+		{`int_to_bytes(2; "big")`, 1.5, "int_to_bytes: input must be an integer"},
+		{`int_to_bytes(2; "big")`, "1", "int_to_bytes: input must be an integer"},
+		{`bswap`, 5, "bswap: width is required for integers"},
+		{`bswap(2)`, "ab", "bswap: width only applies to integers"},
+		{`bswap(2)`, 65536, "bswap: 65536 does not fit in a 2-byte integer"},
+		{`bswap(2)`, -1, "bswap: integer must not be negative"},
+		{`bswap`, true, "bswap: input must be a string of bytes or an integer"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, bytesOpts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
@@ -0,0 +1,560 @@
+package structpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Item is one value of a layout, or padding
+type Item struct {
+	Code byte
+	Size int // bytes; the length for s
+}
+
+// ByteOrder reads and appends integers in a byte order
+type ByteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// Layout is a compiled struct layout
+type Layout struct {
+	Order     ByteOrder
+	OrderName string // "little" or "big"
+	Items     []Item
+	Size      int // bytes of one record
+}
+
+// sizes are the standard sizes of the format codes, as in Python's struct
+// module with "<", ">", "=" or "!"
+var sizes = map[byte]int{
+	'x': 1, 'c': 1, 'b': 1, 'B': 1, '?': 1,
+	'h': 2, 'H': 2, 'e': 2,
+	'i': 4, 'I': 4, 'l': 4, 'L': 4, 'f': 4,
+	'q': 8, 'Q': 8, 'd': 8,
+	's': 1,
+}
+
+// Compile parses a layout such as "<4sHHI": an optional byte order (@ and
+// = native, < little, > and ! big), then format codes, each optionally
+// preceded by a repeat count, which for s is the length. Sizes are always
+// the standard ones and there is no alignment padding
+func Compile(layout string) (*Layout, error) {
+	l := &Layout{Order: binary.NativeEndian, OrderName: nativeName()}
+	s := layout
+	if s != "" {
+		switch s[0] {
+		case '@', '=':
+			s = s[1:]
+		case '<':
+			l.Order, l.OrderName, s = binary.LittleEndian, "little", s[1:]
+		case '>', '!':
+			l.Order, l.OrderName, s = binary.BigEndian, "big", s[1:]
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		if unicode.IsSpace(rune(s[i])) {
+			continue
+		}
+		count, hasCount := 1, false
+		if s[i] >= '0' && s[i] <= '9' {
+			j := i
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			n, err := strconv.Atoi(s[i:j])
+			if err != nil || n > 1<<24 {
+				return nil, common.Errorf(common.CodeInvalid, "invalid count %q in layout", s[i:j])
+			}
+			if j == len(s) {
+				return nil, common.Errorf(common.CodeInvalid, "count %d without a format code", n)
+			}
+			count, hasCount, i = n, true, j
+		}
+		code := s[i]
+		size, ok := sizes[code]
+		if !ok {
+			return nil, common.Errorf(common.CodeInvalid, "unknown format code %q", code)
+		}
+		if code == 's' {
+			if !hasCount {
+				count = 1
+			}
+			l.Items = append(l.Items, Item{Code: 's', Size: count})
+			l.Size += count
+			continue
+		}
+		for range count {
+			l.Items = append(l.Items, Item{Code: code, Size: size})
+		}
+		l.Size += count * size
+	}
+	return l, nil
+}
+
+func nativeName() string {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) == 1 {
+		return "little"
+	}
+	return "big"
+}
+
+// Values is the number of values a record has, padding excluded
+func (l *Layout) Values() int {
+	n := 0
+	for _, item := range l.Items {
+		if item.Code != 'x' {
+			n++
+		}
+	}
+	return n
+}
+
+// Unpack decodes one record from the start of data
+func (l *Layout) Unpack(data []byte) ([]any, error) {
+	if len(data) < l.Size {
+		return nil, common.Errorf(common.CodeInvalid, "need %d bytes, have %d", l.Size, len(data))
+	}
+	values := make([]any, 0, len(l.Items))
+	for _, item := range l.Items {
+		b := data[:item.Size]
+		data = data[item.Size:]
+		switch item.Code {
+		case 'x':
+			continue
+		case 'c', 's':
+			values = append(values, string(b))
+		case '?':
+			values = append(values, b[0] != 0)
+		case 'b':
+			values = append(values, int(int8(b[0])))
+		case 'B':
+			values = append(values, int(b[0]))
+		case 'h':
+			values = append(values, int(int16(l.Order.Uint16(b))))
+		case 'H':
+			values = append(values, int(l.Order.Uint16(b)))
+		case 'i', 'l':
+			values = append(values, int(int32(l.Order.Uint32(b))))
+		case 'I', 'L':
+			values = append(values, int(l.Order.Uint32(b)))
+		case 'q':
+			values = append(values, int(int64(l.Order.Uint64(b))))
+		case 'Q':
+			n := l.Order.Uint64(b)
+			if n > math.MaxInt64 {
+				values = append(values, new(big.Int).SetUint64(n))
+			} else {
+				values = append(values, int(n))
+			}
+		case 'e':
+			values = append(values, float64(halfToFloat(l.Order.Uint16(b))))
+		case 'f':
+			values = append(values, float64(math.Float32frombits(l.Order.Uint32(b))))
+		case 'd':
+			values = append(values, math.Float64frombits(l.Order.Uint64(b)))
+		}
+	}
+	return values, nil
+}
+
+// Pack encodes values, one per item other than padding
+func (l *Layout) Pack(values []any) ([]byte, error) {
+	if len(values) != l.Values() {
+		return nil, common.Errorf(common.CodeInvalid, "layout has %d values, got %d", l.Values(), len(values))
+	}
+	out := make([]byte, 0, l.Size)
+	i := 0
+	for _, item := range l.Items {
+		if item.Code == 'x' {
+			out = append(out, 0)
+			continue
+		}
+		v := values[i]
+		i++
+		switch item.Code {
+		case 'c', 's':
+			s, ok := v.(string)
+			if !ok {
+				return nil, common.Errorf(common.CodeInvalid, "value %d for %c must be a string, got %T", i-1, item.Code, v)
+			}
+			if item.Code == 'c' && len(s) != 1 {
+				return nil, common.Errorf(common.CodeInvalid, "value %d for c must be 1 byte, got %d", i-1, len(s))
+			}
+			// Strings are cut or padded with NULs to the length
+			b := make([]byte, item.Size)
+			copy(b, s)
+			out = append(out, b...)
+		case '?':
+			b, ok := v.(bool)
+			if !ok {
+				return nil, common.Errorf(common.CodeInvalid, "value %d for ? must be a boolean, got %T", i-1, v)
+			}
+			out = append(out, map[bool]byte{false: 0, true: 1}[b])
+		case 'e', 'f', 'd':
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, common.Errorf(common.CodeInvalid, "value %d for %c must be a number, got %T", i-1, item.Code, v)
+			}
+			switch item.Code {
+			case 'e':
+				out = l.Order.AppendUint16(out, floatToHalf(float32(f)))
+			case 'f':
+				out = l.Order.AppendUint32(out, math.Float32bits(float32(f)))
+			default:
+				out = l.Order.AppendUint64(out, math.Float64bits(f))
+			}
+		default:
+			n, err := toInt(v, item)
+			if err != nil {
+				return nil, fmt.Errorf("value %d: %w", i-1, err)
+			}
+			switch item.Size {
+			case 1:
+				out = append(out, byte(n.Int64()))
+			case 2:
+				out = l.Order.AppendUint16(out, uint16(n.Int64()))
+			case 4:
+				out = l.Order.AppendUint32(out, uint32(n.Int64()))
+			default:
+				if n.Sign() < 0 {
+					out = l.Order.AppendUint64(out, uint64(n.Int64()))
+				} else {
+					out = l.Order.AppendUint64(out, n.Uint64())
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f, true
+	}
+	return 0, false
+}
+
+// toInt converts v to an integer in the range of item
+func toInt(v any, item Item) (*big.Int, error) {
+	var n *big.Int
+	switch val := v.(type) {
+	case int:
+		n = big.NewInt(int64(val))
+	case float64:
+		if val != math.Trunc(val) || math.IsInf(val, 0) {
+			return nil, common.Errorf(common.CodeInvalid, "%c must be an integer, got %v", item.Code, val)
+		}
+		n, _ = big.NewFloat(val).Int(nil)
+	case *big.Int:
+		n = val
+	case bool:
+		n = big.NewInt(0)
+		if val {
+			n.SetInt64(1)
+		}
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "%c must be an integer, got %T", item.Code, v)
+	}
+	bits := uint(item.Size * 8)
+	lo, hi := big.NewInt(0), new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+	// Lower-case codes are signed
+	if item.Code >= 'a' && item.Code <= 'z' {
+		hi.Rsh(hi, 1)
+		lo.Neg(hi).Sub(lo, big.NewInt(1))
+	}
+	if n.Cmp(lo) < 0 || n.Cmp(hi) > 0 {
+		return nil, common.Errorf(common.CodeInvalid, "%v out of range for %c (%v to %v)", n, item.Code, lo, hi)
+	}
+	return n, nil
+}
+
+// halfToFloat converts an IEEE 754 half precision float
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+	switch {
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | frac<<13)
+	case exp != 0:
+		return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+	case frac == 0:
+		return math.Float32frombits(sign)
+	}
+	// Subnormal
+	f := float32(frac) / (1 << 24)
+	if sign != 0 {
+		f = -f
+	}
+	return f
+}
+
+// floatToHalf converts to an IEEE 754 half precision float, rounding to
+// nearest even and overflowing to infinity
+func floatToHalf(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127 + 15
+	frac := bits & 0x7fffff
+	switch {
+	case bits&0x7fffffff > 0x7f800000:
+		return sign | 0x7e00
+	case exp >= 0x1f:
+		return sign | 0x7c00
+	case exp <= 0:
+		if exp < -10 {
+			return sign
+		}
+		frac |= 0x800000
+		shift := uint(14 - exp)
+		h := frac >> shift
+		if rem := frac & (1<<shift - 1); rem > 1<<(shift-1) || (rem == 1<<(shift-1) && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	}
+	h := uint32(exp)<<10 | frac>>13
+	if rem := frac & 0x1fff; rem > 0x1000 || (rem == 0x1000 && h&1 == 1) {
+		h++
+	}
+	return sign | uint16(h)
+}
+
+// structOptions are the options shared by struct_unpack and struct_pack
+type structOptions struct {
+	offset int
+	file   bool
+	repeat bool
+	names  []string
+}
+
+func parseStructOptions(raw any, pack bool) (structOptions, error) {
+	var opts structOptions
+	m, ok := common.ExtractUDFValue(raw).(map[string]any)
+	if !ok {
+		return opts, common.Errorf(common.CodeInvalid, "options must be an object, got %T", common.ExtractUDFValue(raw))
+	}
+	for key, val := range m {
+		switch {
+		case key == "names":
+			list, ok := val.([]any)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.names must be an array of strings")
+			}
+			for _, name := range list {
+				s, ok := name.(string)
+				if !ok {
+					return opts, common.Errorf(common.CodeInvalid, "options.names must be an array of strings")
+				}
+				opts.names = append(opts.names, s)
+			}
+		case key == "offset" && !pack:
+			n, ok := val.(int)
+			if f, isFloat := val.(float64); isFloat && f == math.Trunc(f) && f >= 0 && f <= math.MaxInt32 {
+				n, ok = int(f), true
+			}
+			if !ok || n < 0 {
+				return opts, common.Errorf(common.CodeInvalid, "options.offset must be a non-negative integer, got %v", val)
+			}
+			opts.offset = n
+		case key == "file" && !pack:
+			b, ok := val.(bool)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.file must be a boolean, got %T", val)
+			}
+			opts.file = b
+		case key == "repeat":
+			b, ok := val.(bool)
+			if !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.repeat must be a boolean, got %T", val)
+			}
+			opts.repeat = b
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+func compileArg(name string, raw any) (*Layout, error) {
+	s, ok := common.ExtractUDFValue(raw).(string)
+	if !ok {
+		return nil, common.Errorf(common.CodeInvalid, "%v: layout must be a string, got %T", name, common.ExtractUDFValue(raw))
+	}
+	l, err := Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", name, err)
+	}
+	return l, nil
+}
+
+// record names the values of a record when names are given
+func record(values []any, names []string) any {
+	if names == nil {
+		return values
+	}
+	obj := make(map[string]any, len(values))
+	for i, name := range names {
+		obj[name] = values[i]
+	}
+	return obj
+}
+
+// RegisterStructUnpack registers the struct_unpack function with gojq
+func RegisterStructUnpack() gojq.CompilerOption {
+	return common.WithFunction("struct_unpack", 1, 2, func(v any, args []any) any {
+		l, err := compileArg("struct_unpack", args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+		var opts structOptions
+		if len(args) > 1 {
+			if opts, err = parseStructOptions(args[1], false); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("struct_unpack: %w", err), nil)
+			}
+		}
+		if opts.names != nil && len(opts.names) != l.Values() {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "struct_unpack: layout has %d values, got %d names", l.Values(), len(opts.names)), nil)
+		}
+
+		meta := map[string]any{
+			"operation":  "struct_unpack",
+			"layout":     common.ExtractUDFValue(args[0]),
+			"byte_order": l.OrderName,
+			"size":       l.Size,
+			"offset":     opts.offset,
+		}
+		var data []byte
+		switch val := common.ExtractUDFValue(v).(type) {
+		case string:
+			if opts.file {
+				fileData, absPath, _, err := common.ReadFileFromPath(val)
+				if err != nil {
+					return common.MakeUDFErrorResult(fmt.Errorf("struct_unpack: %w", err), nil)
+				}
+				data = fileData
+				meta["file_path"] = absPath
+			} else {
+				data = []byte(val)
+			}
+		case []byte:
+			data = val
+		case []any:
+			b, err := common.InputBytes(val)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("struct_unpack: %w", err), nil)
+			}
+			data = b
+		default:
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "struct_unpack: input must be a string, got %T", val), nil)
+		}
+		if opts.offset > len(data) {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "struct_unpack: offset %d is past the end of %d bytes", opts.offset, len(data)), nil)
+		}
+		data = data[opts.offset:]
+		meta["input_length"] = len(data)
+
+		if !opts.repeat {
+			values, err := l.Unpack(data)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("struct_unpack: %w", err), nil)
+			}
+			return common.MakeUDFSuccessResult(record(values, opts.names), meta)
+		}
+
+		// Records until the data runs out; a partial one at the end is
+		// reported rather than decoded
+		if l.Values() == 0 {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "struct_unpack: repeat needs a layout with at least one value"), nil)
+		}
+		records := make([]any, 0, len(data)/l.Size)
+		for len(data) >= l.Size {
+			values, _ := l.Unpack(data)
+			records = append(records, record(values, opts.names))
+			data = data[l.Size:]
+		}
+		meta["records"] = len(records)
+		meta["trailing_bytes"] = len(data)
+		return common.MakeUDFSuccessResult(records, meta)
+	})
+}
+
+// RegisterStructPack registers the struct_pack function with gojq
+func RegisterStructPack() gojq.CompilerOption {
+	return common.WithFunction("struct_pack", 1, 2, func(v any, args []any) any {
+		l, err := compileArg("struct_pack", args[0])
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+		var opts structOptions
+		if len(args) > 1 {
+			if opts, err = parseStructOptions(args[1], true); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("struct_pack: %w", err), nil)
+			}
+		}
+
+		// Takes a record, or with repeat an array of them; a record is an
+		// array of values, or an object with names
+		input := common.ExtractUDFValue(v)
+		records := []any{input}
+		if opts.repeat {
+			list, ok := input.([]any)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "struct_pack: input must be an array of records, got %T", input), nil)
+			}
+			records = list
+		}
+		var out []byte
+		for i, rec := range records {
+			var values []any
+			switch val := rec.(type) {
+			case []any:
+				values = val
+			case map[string]any:
+				if opts.names == nil {
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "struct_pack: packing an object needs options.names"), nil)
+				}
+				for _, name := range opts.names {
+					field, ok := val[name]
+					if !ok {
+						return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "struct_pack: record %d has no field %q", i, name), nil)
+					}
+					values = append(values, field)
+				}
+			default:
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "struct_pack: record must be an array or an object, got %T", val), nil)
+			}
+			packed, err := l.Pack(values)
+			if err != nil {
+				if opts.repeat {
+					return common.MakeUDFErrorResult(fmt.Errorf("struct_pack: record %d: %w", i, err), nil)
+				}
+				return common.MakeUDFErrorResult(fmt.Errorf("struct_pack: %w", err), nil)
+			}
+			out = append(out, packed...)
+		}
+
+		return common.MakeUDFSuccessResult(string(out), map[string]any{
+			"operation":  "struct_pack",
+			"layout":     common.ExtractUDFValue(args[0]),
+			"byte_order": l.OrderName,
+			"size":       l.Size,
+			"records":    len(records),
+			"length":     len(out),
+		})
+	})
+}
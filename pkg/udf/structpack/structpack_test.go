@@ -0,0 +1,207 @@
+package structpack
+
+import (
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+var structOpts = []gojq.CompilerOption{RegisterStructUnpack(), RegisterStructPack()}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		layout string
+		size   int
+		values int
+		order  string
+	}{
+		{"<4sHHI", 12, 4, "little"},
+		{">2xhq", 12, 2, "big"},
+		{"!3B 2?", 5, 5, "big"},
+		{"10s0sc", 11, 3, nativeName()},
+		{"", 0, 0, nativeName()},
+	}
+	for _, tt := range tests {
+		l, err := Compile(tt.layout)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.layout, err)
+			continue
+		}
+		if l.Size != tt.size || l.Values() != tt.values || l.OrderName != tt.order {
+			t.Errorf("Compile(%q) = size %d, %d values, %s", tt.layout, l.Size, l.Values(), l.OrderName)
+		}
+	}
+	for _, bad := range []string{"<z", "<4", "<99999999999s"} {
+		if _, err := Compile(bad); err == nil {
+			t.Errorf("Compile(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		layout string
+		values []any
+	}{
+		{"<bBhHiIqQ", []any{-128, 255, -32768, 65535, math.MinInt32, math.MaxUint32, math.MinInt64, math.MaxInt64}},
+		{">lL?c", []any{-1, 7, true, "Z"}},
+		{"<fde", []any{1.5, math.Pi, 0.333251953125}},
+		{"<e", []any{65504.0}},
+		{"<e", []any{5.960464477539063e-08}},
+		{"<4s2x3s", []any{"MZ\x90\x00", "abc"}},
+	}
+	for _, tt := range tests {
+		l, err := Compile(tt.layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packed, err := l.Pack(tt.values)
+		if err != nil {
+			t.Errorf("Pack(%q, %v): %v", tt.layout, tt.values, err)
+			continue
+		}
+		got, err := l.Unpack(packed)
+		if err != nil {
+			t.Errorf("Unpack(%q): %v", tt.layout, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.values) {
+			t.Errorf("%q: round trip = %v, want %v", tt.layout, got, tt.values)
+		}
+	}
+
+	l, _ := Compile("<Q")
+	got, _ := l.Unpack([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	if n, ok := got[0].(*big.Int); !ok || n.String() != "18446744073709551615" {
+		t.Errorf("Unpack of max uint64 = %v", got)
+	}
+}
+
+func TestHalfFloat(t *testing.T) {
+	tests := map[float32]uint16{
+		1:                    0x3c00,
+		-2:                   0xc000,
+		65504:                0x7bff,
+		1e6:                  0x7c00,
+		0.1:                  0x2e66,
+		6.103515625e-05:      0x0400,
+		5.960464477539063e-8: 0x0001,
+		1e-9:                 0x0000,
+	}
+	for f, want := range tests {
+		if got := floatToHalf(f); got != want {
+			t.Errorf("floatToHalf(%v) = %#04x, want %#04x", f, got, want)
+		}
+	}
+	if got := halfToFloat(0x7e00); !math.IsNaN(float64(got)) {
+		t.Errorf("halfToFloat(NaN) = %v", got)
+	}
+}
+
+func TestStructUDFs(t *testing.T) {
+	// A PNG signature and IHDR chunk header
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR\x00\x00\x01\x00\x00\x00\x00\x80\x08\x06"
+	dir := t.TempDir()
+	path := filepath.Join(dir, "image.png")
+	if err := os.WriteFile(path, []byte(png), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		input any
+		want  any
+	}{
+		{`struct_unpack(">I4sII"; {offset: 8}) | ._val`, png, []any{13, "IHDR", 256, 128}},
+		{`struct_unpack(">I4sIIBB"; {offset: 8, names: ["length", "type", "width", "height", "depth", "color"]}) | ._val | [.width, .height, .color]`, png, []any{256, 128, 6}},
+		{`struct_unpack(">8x4x4sII"; {file: true}) | ._val`, path, []any{"IHDR", 256, 128}},
+		{`struct_unpack("<HH"; {repeat: true}) | [._val, ._meta.records, ._meta.trailing_bytes]`, "\x01\x00\x02\x00\x03\x00\x04\x00\x05", []any{[]any{[]any{1, 2}, []any{3, 4}}, 2, 1}},
+		{`struct_unpack("<B"; {repeat: true, names: ["n"]}) | ._val`, "\x01\x02", []any{map[string]any{"n": 1}, map[string]any{"n": 2}}},
+		{`struct_unpack("<HB") | ._val`, []any{1, 0, 255}, []any{1, 255}},
+		{`struct_pack(">I4s") | ._val`, []any{13, "IHDR"}, "\x00\x00\x00\x0dIHDR"},
+		{`struct_pack("<hH"; {names: ["a", "b"]}) | ._val`, map[string]any{"b": 2, "a": -1}, "\xff\xff\x02\x00"},
+		{`struct_pack("<B"; {repeat: true}) | [._val, ._meta.records, ._meta.length]`, []any{[]any{1}, []any{2}}, []any{"\x01\x02", 2, 2}},
+		{`struct_pack("<3s") | ._val`, []any{"abcdef"}, "abc"},
+		{`struct_pack("<5s") | ._val`, []any{"ab"}, "ab\x00\x00\x00"},
+		{`struct_pack("<id") | struct_unpack("<id") | ._val`, []any{-7, 2.25}, []any{-7, 2.25}},
+	}
+	for _, tt := range tests {
+		got := runGojqQuery(t, tt.query, tt.input, structOpts...)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`struct_unpack("<I")`, "ab", "struct_unpack: need 4 bytes, have 2"},
+		{`struct_unpack("<y")`, "ab", `struct_unpack: unknown format code 'y'`},
+		{`struct_unpack(1)`, "ab", "struct_unpack: layout must be a string"},
+		{`struct_unpack("<B"; {offset: 3})`, "ab", "struct_unpack: offset 3 is past the end of 2 bytes"},
+		{`struct_unpack("<B"; {offset: -1})`, "ab", "struct_unpack: options.offset must be a non-negative integer"},
+		{`struct_unpack("<BB"; {names: ["a"]})`, "ab", "struct_unpack: layout has 2 values, got 1 names"},
+		{`struct_unpack("<B"; {bogus: 1})`, "ab", `struct_unpack: unknown option "bogus"`},
+		{`struct_unpack("2x"; {repeat: true})`, "ab", "struct_unpack: repeat needs"},
+		{`struct_unpack(""; {repeat: true})`, "ab", "struct_unpack: repeat needs"},
+		{`struct_unpack("<B"; {file: true})`, "/nonexistent/file", "struct_unpack: file does not exist"},
+		{`struct_unpack("<B")`, 5, "struct_unpack: input must be a string"},
+		{`struct_pack("<B")`, []any{256}, "struct_pack: value 0: 256 out of range for B (0 to 255)"},
+		{`struct_pack("<b")`, []any{-129}, "struct_pack: value 0: -129 out of range for b (-128 to 127)"},
+		{`struct_pack("<H")`, []any{1.5}, "struct_pack: value 0: H must be an integer"},
+		{`struct_pack("<HH")`, []any{1}, "struct_pack: layout has 2 values, got 1"},
+		{`struct_pack("<c")`, []any{"ab"}, "struct_pack: value 0 for c must be 1 byte"},
+		{`struct_pack("<?")`, []any{1}, "struct_pack: value 0 for ? must be a boolean"},
+		{`struct_pack("<B")`, map[string]any{"a": 1}, "struct_pack: packing an object needs options.names"},
+		{`struct_pack("<B"; {names: ["b"]})`, map[string]any{"a": 1}, `struct_pack: record 0 has no field "b"`},
+		{`struct_pack("<B"; {repeat: true})`, []any{[]any{1}, []any{300}}, "struct_pack: record 1: value 0: 300 out of range"},
+		{`struct_pack("<B"; {offset: 1})`, []any{1}, `struct_pack: unknown option "offset"`},
+		{`struct_pack("<B")`, "x", "struct_pack: record must be an array or an object"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, structOpts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package symlink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// maxHops bounds how many links resolve follows, as the kernel does with
+// ELOOP
+const maxHops = 255
+
+// Hop is one link followed while resolving a path
+type Hop struct {
+	Link   string
+	Target string
+}
+
+// ErrLoop reports a chain of links that never ends
+type ErrLoop struct {
+	Link string
+}
+
+func (e *ErrLoop) Error() string {
+	return fmt.Sprintf("symlink loop at %q", e.Link)
+}
+
+// Resolve follows every link in the absolute path p, in any component, and
+// returns the final path with the links followed. A missing component is
+// not an error: the path is dangling and exists is false
+func Resolve(p string) (final string, chain []Hop, exists bool, err error) {
+	vol := filepath.VolumeName(p)
+	rest := splitPath(p[len(vol):])
+	cur := vol + string(filepath.Separator)
+	seen := map[string]bool{}
+	for len(rest) > 0 {
+		name := rest[0]
+		rest = rest[1:]
+		switch name {
+		case ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+			continue
+		}
+		next := filepath.Join(cur, name)
+		info, err := os.Lstat(next)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.Join(append([]string{next}, rest...)...), chain, false, nil
+			}
+			return next, chain, false, err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+
+		target, err := os.Readlink(next)
+		if err != nil {
+			return next, chain, false, err
+		}
+		chain = append(chain, Hop{Link: next, Target: target})
+		// The same link with the same path left to resolve can only lead
+		// back here
+		key := next + "\x00" + strings.Join(rest, "/")
+		if seen[key] || len(chain) > maxHops {
+			return next, chain, false, &ErrLoop{Link: next}
+		}
+		seen[key] = true
+		if filepath.IsAbs(target) {
+			vol = filepath.VolumeName(target)
+			cur = vol + string(filepath.Separator)
+			target = target[len(vol):]
+		}
+		rest = append(splitPath(target), rest...)
+	}
+	return cur, chain, true, nil
+}
+
+func splitPath(p string) []string {
+	var parts []string
+	for _, part := range strings.Split(filepath.ToSlash(p), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func chainValue(chain []Hop) []any {
+	out := make([]any, len(chain))
+	for i, h := range chain {
+		out[i] = map[string]any{"link": h.Link, "target": h.Target}
+	}
+	return out
+}
+
+// pathArg reads a path from an argument, or from the input if there is none
+func pathArg(name string, v any, args []any) (string, error) {
+	val := v
+	if len(args) > 0 {
+		val = args[0]
+	}
+	p, ok := common.ExtractUDFValue(val).(string)
+	if !ok || p == "" {
+		return "", common.Errorf(common.CodeInvalid, "%v: path must be a non-empty string, got %T", name, common.ExtractUDFValue(val))
+	}
+	abs, err := common.ResolvePath(p)
+	if err != nil {
+		return "", fmt.Errorf("%v: %w", name, err)
+	}
+	return abs, nil
+}
+
+// RegisterSymlink registers the symlink function with gojq
+func RegisterSymlink() gojq.CompilerOption {
+	return common.WithFunction("symlink", 2, 2, common.Audited("symlink", func(v any, args []any) any {
+		// The target is stored as given, so relative targets stay relative
+		// to the link's directory
+		target, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok || target == "" {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "symlink: target must be a non-empty string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		link, err := pathArg("symlink", nil, args[1:])
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+		if err := common.CheckWrite(link); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("symlink: %w", err), nil)
+		}
+
+		meta := map[string]any{
+			"operation": "symlink",
+			"link":      link,
+			"target":    target,
+		}
+		if err := os.Symlink(target, link); err != nil {
+			if os.IsExist(err) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeExists, "symlink: path already exists: %q", link), meta)
+			}
+			if os.IsNotExist(err) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeNotFound, "symlink: directory does not exist: %q", filepath.Dir(link)), meta)
+			}
+			return common.MakeUDFErrorResult(fmt.Errorf("symlink: %w", err), meta)
+		}
+		_, statErr := os.Stat(link)
+		meta["dangling"] = statErr != nil
+		return common.MakeUDFSuccessResult(link, meta)
+	}))
+}
+
+// RegisterReadlink registers the readlink function with gojq
+func RegisterReadlink() gojq.CompilerOption {
+	return common.WithFunction("readlink", 0, 1, common.Audited("readlink", func(v any, args []any) any {
+		link, err := pathArg("readlink", v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+		// The link is read, not what it points to
+		if err := common.CheckRead(filepath.Dir(link)); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("readlink: %w", err), nil)
+		}
+		meta := map[string]any{
+			"operation": "readlink",
+			"path":      link,
+		}
+		target, err := os.Readlink(link)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeNotFound, "readlink: file does not exist: %q", link), meta)
+			}
+			if info, statErr := os.Lstat(link); statErr == nil && info.Mode()&os.ModeSymlink == 0 {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "readlink: not a symlink: %q", link), meta)
+			}
+			return common.MakeUDFErrorResult(fmt.Errorf("readlink: %w", err), meta)
+		}
+
+		abs := target
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(filepath.Dir(link), target)
+		}
+		_, statErr := os.Stat(link)
+		meta["absolute_target"] = abs
+		meta["relative"] = !filepath.IsAbs(target)
+		meta["dangling"] = statErr != nil
+		return common.MakeUDFSuccessResult(target, meta)
+	}))
+}
+
+// RegisterResolve registers the resolve function with gojq
+func RegisterResolve() gojq.CompilerOption {
+	return common.WithFunction("resolve", 0, 1, common.Audited("resolve", func(v any, args []any) any {
+		p, err := pathArg("resolve", v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+		if err := common.CheckRead(p); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("resolve: %w", err), nil)
+		}
+		final, chain, exists, err := Resolve(p)
+		meta := map[string]any{
+			"operation": "resolve",
+			"path":      p,
+			"chain":     chainValue(chain),
+			"hops":      len(chain),
+		}
+		if err != nil {
+			if _, ok := err.(*ErrLoop); ok {
+				meta["loop"] = true
+			}
+			return common.MakeUDFErrorResult(fmt.Errorf("resolve: %w", err), meta)
+		}
+		meta["exists"] = exists
+		return common.MakeUDFSuccessResult(final, meta)
+	}))
+}
@@ -0,0 +1,138 @@
+package symlink
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+var linkOpts = []gojq.CompilerOption{RegisterSymlink(), RegisterReadlink(), RegisterResolve()}
+
+// realDir is a temporary directory with its own links resolved, since the
+// system temp directory may itself be a link
+func realDir(t *testing.T) string {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSymlinkAndReadlink(t *testing.T) {
+	dir := realDir(t)
+	os.WriteFile(filepath.Join(dir, "real.txt"), []byte("x"), 0644)
+	link := filepath.Join(dir, "link.txt")
+
+	res := runGojqQuery(t, `symlink("real.txt"; "`+link+`")`, nil, linkOpts...).(map[string]any)
+	if res["_val"] != link || res["_meta"].(map[string]any)["dangling"] != false {
+		t.Fatalf("symlink = %v", res)
+	}
+	if target, _ := os.Readlink(link); target != "real.txt" {
+		t.Errorf("stored target = %q, want it kept relative", target)
+	}
+
+	res = runGojqQuery(t, `"`+link+`" | readlink`, nil, linkOpts...).(map[string]any)
+	meta := res["_meta"].(map[string]any)
+	if res["_val"] != "real.txt" || meta["absolute_target"] != filepath.Join(dir, "real.txt") || meta["relative"] != true {
+		t.Errorf("readlink = %v", res)
+	}
+
+	res = runGojqQuery(t, `symlink("/nonexistent/payload"; "`+filepath.Join(dir, "dangling")+`")`, nil, linkOpts...).(map[string]any)
+	if res["_meta"].(map[string]any)["dangling"] != true {
+		t.Errorf("dangling symlink = %v", res)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := realDir(t)
+	os.MkdirAll(filepath.Join(dir, "opt", "app-1.2", "bin"), 0755)
+	os.WriteFile(filepath.Join(dir, "opt", "app-1.2", "bin", "app"), nil, 0755)
+	os.Symlink("app-1.2", filepath.Join(dir, "opt", "app"))
+	os.Symlink(filepath.Join(dir, "opt", "app", "bin", "app"), filepath.Join(dir, "usr-bin-app"))
+	os.Symlink("usr-bin-app", filepath.Join(dir, "alias"))
+	os.Symlink("loop-b", filepath.Join(dir, "loop-a"))
+	os.Symlink("loop-a", filepath.Join(dir, "loop-b"))
+	os.Symlink("gone/file", filepath.Join(dir, "broken"))
+
+	// alias -> usr-bin-app -> .../opt/app/bin/app, with opt/app -> app-1.2
+	res := runGojqQuery(t, `resolve("`+filepath.Join(dir, "alias")+`")`, nil, linkOpts...).(map[string]any)
+	meta := res["_meta"].(map[string]any)
+	if res["_val"] != filepath.Join(dir, "opt", "app-1.2", "bin", "app") || meta["hops"] != 3 || meta["exists"] != true {
+		t.Errorf("resolve chain = %v", res)
+	}
+	chain := meta["chain"].([]any)
+	if chain[0].(map[string]any)["target"] != "usr-bin-app" || chain[2].(map[string]any)["link"] != filepath.Join(dir, "opt", "app") {
+		t.Errorf("chain = %v", chain)
+	}
+
+	res = runGojqQuery(t, `resolve("`+filepath.Join(dir, "broken")+`")`, nil, linkOpts...).(map[string]any)
+	meta = res["_meta"].(map[string]any)
+	if res["_val"] != filepath.Join(dir, "gone", "file") || meta["exists"] != false || meta["hops"] != 1 {
+		t.Errorf("resolve dangling = %v", res)
+	}
+
+	res = runGojqQuery(t, `resolve("`+filepath.Join(dir, "loop-a")+`")`, nil, linkOpts...).(map[string]any)
+	if got := common.GetUDFError(res); !strings.HasPrefix(got, "resolve: symlink loop at") || res["_meta"].(map[string]any)["loop"] != true {
+		t.Errorf("resolve loop = %v", res)
+	}
+
+	// A plain path resolves to itself
+	res = runGojqQuery(t, `resolve("`+filepath.Join(dir, "opt", ".", "app-1.2", "..", "app-1.2")+`")`, nil, linkOpts...).(map[string]any)
+	if res["_val"] != filepath.Join(dir, "opt", "app-1.2") || res["_meta"].(map[string]any)["hops"] != 0 {
+		t.Errorf("resolve plain = %v", res)
+	}
+}
+
+func TestSymlinkErrors(t *testing.T) {
+	dir := realDir(t)
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0644)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`symlink("x"; "` + file + `")`, "symlink: path already exists"},
+		{`symlink("x"; "` + filepath.Join(dir, "no", "link") + `")`, "symlink: directory does not exist"},
+		{`symlink(""; "l")`, "symlink: target must be a non-empty string"},
+		{`readlink("` + file + `")`, "readlink: not a symlink"},
+		{`readlink("` + filepath.Join(dir, "missing") + `")`, "readlink: file does not exist"},
+		{`resolve(1)`, "resolve: path must be a non-empty string"},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, nil, linkOpts...).(map[string]any)
+		if got := common.GetUDFError(res); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -4,101 +4,191 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
+	"sync"
 
 	"github.com/itchyny/gojq"
 	"github.com/xen0bit/pwrq/pkg/udf/common"
 )
 
+// Options control how tee writes each value
+type Options struct {
+	Append bool   // add to existing files rather than replacing them
+	Format string // "ndjson", "pretty", "raw" or "bytes"
+}
+
+var formats = []string{"ndjson", "pretty", "raw", "bytes"}
+
+func defaultOptions() Options {
+	return Options{Append: true, Format: "ndjson"}
+}
+
+func parseOptions(v any) (Options, error) {
+	opts := defaultOptions()
+	m, ok := common.ExtractUDFValue(v).(map[string]any)
+	if !ok {
+		return opts, common.Errorf(common.CodeInvalid, "options must be an object, got %T", common.ExtractUDFValue(v))
+	}
+	for key, raw := range m {
+		switch key {
+		case "append":
+			if opts.Append, ok = raw.(bool); !ok {
+				return opts, common.Errorf(common.CodeInvalid, "options.append must be a boolean, got %T", raw)
+			}
+		case "format":
+			f, _ := raw.(string)
+			if !slices.Contains(formats, f) {
+				return opts, common.Errorf(common.CodeInvalid, `options.format must be "ndjson", "pretty", "raw" or "bytes", got %v`, raw)
+			}
+			opts.Format = f
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// parseDestinations reads one destination or an array of them. "stderr"
+// names standard error, anything else is a file path
+func parseDestinations(v any) ([]string, error) {
+	var raw []any
+	switch val := common.ExtractUDFValue(v).(type) {
+	case string:
+		raw = []any{val}
+	case []any:
+		if len(val) == 0 {
+			return nil, common.Errorf(common.CodeInvalid, "destinations cannot be empty")
+		}
+		raw = val
+	default:
+		return nil, common.Errorf(common.CodeInvalid, "argument must be a string file path or an array of destinations, got %T", val)
+	}
+	var dests []string
+	for _, d := range raw {
+		s, ok := common.ExtractUDFValue(d).(string)
+		if !ok || s == "" {
+			return nil, common.Errorf(common.CodeInvalid, "destination must be a non-empty string, got %v", d)
+		}
+		if s != "stderr" {
+			abs, err := common.ResolvePath(s)
+			if err != nil {
+				return nil, fmt.Errorf("cannot resolve path %q: %w", s, err)
+			}
+			if err := common.CheckWrite(abs); err != nil {
+				return nil, err
+			}
+			s = abs
+		}
+		if !slices.Contains(dests, s) {
+			dests = append(dests, s)
+		}
+	}
+	return dests, nil
+}
+
+// encode renders a value as one record in the given format. The bytes
+// format writes a string or a bytes array exactly, with no newline added
+func encode(val any, format string) ([]byte, error) {
+	var data []byte
+	var err error
+	switch format {
+	case "bytes":
+		return common.InputBytes(val)
+	case "pretty":
+		data, err = json.MarshalIndent(val, "", "  ")
+	case "raw":
+		if s, ok := val.(string); ok {
+			data = []byte(s)
+			break
+		}
+		fallthrough
+	default:
+		data, err = json.Marshal(val)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
 // RegisterTee registers the tee function with gojq
 func RegisterTee() gojq.CompilerOption {
-	return gojq.WithFunction("tee", 0, 1, func(v any, args []any) any {
-		inputVal := common.ExtractUDFValue(v)
+	// With append off, a file is truncated the first time it is written and
+	// then appended to, like the tee command, so it ends up holding every
+	// value of the run rather than only the last one
+	var mu sync.Mutex
+	truncated := map[string]bool{}
 
-		var filePath string
-		writeToFile := false
+	return common.WithFunction("tee", 0, 2, common.Audited("tee", func(v any, args []any) any {
+		inputVal := common.ExtractUDFValue(v)
 
-		// Parse arguments: optional file path
+		dests := []string{"stderr"}
+		opts := defaultOptions()
 		if len(args) > 0 {
-			if path, ok := args[0].(string); ok {
-				filePath = path
-				writeToFile = true
-			} else {
-				return common.MakeUDFErrorResult(fmt.Errorf("tee: argument must be a string file path, got %T", args[0]), nil)
+			var err error
+			if dests, err = parseDestinations(args[0]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("tee: %w", err), nil)
+			}
+		}
+		if len(args) > 1 {
+			var err error
+			if opts, err = parseOptions(args[1]); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("tee: %w", err), nil)
 			}
 		}
 
-		// Marshal input to JSON
-		jsonBytes, err := json.Marshal(inputVal)
+		data, err := encode(inputVal, opts.Format)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("tee: failed to marshal JSON: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("tee: %w", err), nil)
 		}
 
-		// Write to file or stderr
-		if writeToFile {
-			// Expand ~ to home directory and get absolute path
-			absPath, err := filepath.Abs(filePath)
-			if err != nil {
-				// Try to expand ~ first
-				if filePath == "~" {
-					home, homeErr := os.UserHomeDir()
-					if homeErr != nil {
-						return common.MakeUDFErrorResult(fmt.Errorf("tee: cannot determine home directory: %v", homeErr), nil)
-					}
-					absPath = home
-				} else if len(filePath) > 0 && filePath[0] == '~' && (len(filePath) == 1 || filePath[1] == '/') {
-					home, homeErr := os.UserHomeDir()
-					if homeErr != nil {
-						return common.MakeUDFErrorResult(fmt.Errorf("tee: cannot determine home directory: %v", homeErr), nil)
-					}
-					if len(filePath) > 1 {
-						absPath = filepath.Join(home, filePath[2:])
-					} else {
-						absPath = home
-					}
-					absPath, err = filepath.Abs(absPath)
-					if err != nil {
-						return common.MakeUDFErrorResult(fmt.Errorf("tee: cannot resolve path %q: %v", filePath, err), nil)
-					}
-				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("tee: cannot resolve path %q: %v", filePath, err), nil)
-				}
+		destVals := make([]any, len(dests))
+		for i, d := range dests {
+			destVals[i] = d
+		}
+		meta := map[string]any{
+			"operation":    "tee",
+			"format":       opts.Format,
+			"append":       opts.Append,
+			"destinations": destVals,
+		}
+		if len(dests) == 1 {
+			if dests[0] == "stderr" {
+				meta["written_to"] = "stderr"
+			} else {
+				meta["file_path"] = dests[0]
 			}
-			filePath = absPath
+		}
 
-			// Write to file in append mode
-			file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
-				meta := map[string]any{
-					"operation": "tee",
-					"file_path": filePath,
-				}
-				return common.MakeUDFErrorResult(fmt.Errorf("tee: failed to open file %q: %v", filePath, err), meta)
+		written := 0
+		for _, dest := range dests {
+			if dest == "stderr" {
+				n, _ := os.Stderr.Write(data)
+				written += n
+				continue
 			}
-			defer file.Close()
 
-			_, err = file.Write(jsonBytes)
+			flag := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+			mu.Lock()
+			if !opts.Append && !truncated[dest] {
+				flag |= os.O_TRUNC
+				truncated[dest] = true
+			}
+			mu.Unlock()
+			file, err := os.OpenFile(dest, flag, 0644)
 			if err != nil {
-				meta := map[string]any{
-					"operation": "tee",
-					"file_path": filePath,
-				}
-				return common.MakeUDFErrorResult(fmt.Errorf("tee: failed to write to file %q: %v", filePath, err), meta)
+				meta["bytes_written"] = written
+				return common.MakeUDFErrorResult(fmt.Errorf("tee: failed to open file %q: %w", dest, err), meta)
+			}
+			n, err := file.Write(data)
+			written += n
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
 			}
-
-			// Write newline after JSON
-			_, err = file.Write([]byte("\n"))
 			if err != nil {
-				meta := map[string]any{
-					"operation": "tee",
-					"file_path": filePath,
-				}
-				return common.MakeUDFErrorResult(fmt.Errorf("tee: failed to write newline to file %q: %v", filePath, err), meta)
+				meta["bytes_written"] = written
+				return common.MakeUDFErrorResult(fmt.Errorf("tee: failed to write to file %q: %w", dest, err), meta)
 			}
-		} else {
-			// Write to stderr
-			os.Stderr.Write(jsonBytes)
-			os.Stderr.Write([]byte("\n"))
 		}
 
 		// Return the input unchanged (pass through)
@@ -107,19 +197,12 @@ func RegisterTee() gojq.CompilerOption {
 			return v
 		}
 
-		meta := map[string]any{
-			"operation": "tee",
-		}
-		if writeToFile {
-			meta["file_path"] = filePath
+		if meta["file_path"] != nil {
 			meta["written"] = true
-			meta["bytes_written"] = len(jsonBytes)
-		} else {
-			meta["written_to"] = "stderr"
-			meta["bytes_written"] = len(jsonBytes)
 		}
+		meta["bytes_written"] = written
 
 		// Return input with metadata
 		return common.MakeUDFSuccessResult(inputVal, meta)
-	})
+	}))
 }
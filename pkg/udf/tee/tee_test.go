@@ -5,9 +5,11 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
 	stringudf "github.com/xen0bit/pwrq/pkg/udf/string"
 )
 
@@ -187,7 +189,7 @@ func TestTeeErrorHandling(t *testing.T) {
 		// Check if it's an error result object
 		resMap, ok := result.(map[string]any)
 		if ok {
-			if errStr, hasErr := resMap["_err"].(string); hasErr {
+			if errStr := common.GetUDFError(resMap); errStr != "" {
 				t.Logf("Got error in _err field: %s", errStr)
 				return
 			}
@@ -258,3 +260,87 @@ func TestTeeGojqIntegration(t *testing.T) {
 		})
 	}
 }
+
+func TestTeeFormatsAndSinks(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// append off truncates each file once, then every value is kept
+	query := `.[] | tee([$a, $b]; {append: false, format: "raw"})`
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(q, gojq.WithVariables([]string{"$a", "$b"}), RegisterTee())
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter := code.Run([]any{"one", map[string]any{"n": 2}}, a, b)
+	var last any
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		last = v
+	}
+	meta := last.(map[string]any)["_meta"].(map[string]any)
+	if meta["bytes_written"] != 2*len("{\"n\":2}\n") || len(meta["destinations"].([]any)) != 2 {
+		t.Errorf("_meta = %v", meta)
+	}
+	for _, p := range []string{a, b} {
+		got, _ := os.ReadFile(p)
+		if want := "one\n{\"n\":2}\n"; string(got) != want {
+			t.Errorf("%s = %q, want %q", p, got, want)
+		}
+	}
+
+	// The default appends, and pretty indents
+	result := runGojqQuery(t, `tee("`+a+`"; {format: "pretty"})`, map[string]any{"k": "v"}, RegisterTee())
+	got, _ := os.ReadFile(a)
+	if want := "one\n{\"n\":2}\n{\n  \"k\": \"v\"\n}\n"; string(got) != want {
+		t.Errorf("after append %q, want %q", got, want)
+	}
+	if meta := result.(map[string]any)["_meta"].(map[string]any); meta["file_path"] != a || meta["bytes_written"] != len("{\n  \"k\": \"v\"\n}\n") {
+		t.Errorf("_meta = %v", meta)
+	}
+
+	// Bytes arrays are written exactly
+	result = runGojqQuery(t, `tee("`+b+`"; {append: false, format: "bytes"})`, []any{0, 255, 10}, RegisterTee())
+	if got, _ := os.ReadFile(b); string(got) != "\x00\xff\n" {
+		t.Errorf("bytes format wrote %q", got)
+	}
+	if meta := result.(map[string]any)["_meta"].(map[string]any); meta["bytes_written"] != 3 {
+		t.Errorf("_meta = %v", meta)
+	}
+
+	result = runGojqQuery(t, `tee(["stderr", "`+b+`"])`, "x", RegisterTee())
+	if meta := result.(map[string]any)["_meta"].(map[string]any); meta["bytes_written"] != 2*len("\"x\"\n") || meta["written_to"] != nil {
+		t.Errorf("_meta = %v", meta)
+	}
+}
+
+func TestTeeOptionErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`tee([])`, "tee: destinations cannot be empty"},
+		{`tee([1])`, "tee: destination must be a non-empty string"},
+		{`tee("stderr"; {format: "yaml"})`, `tee: options.format must be "ndjson", "pretty", "raw" or "bytes"`},
+		{`tee("stderr"; {append: 1})`, "tee: options.append must be a boolean"},
+		{`tee("stderr"; {mode: "a"})`, `tee: unknown option "mode"`},
+		{`tee("stderr"; "a")`, "tee: options must be an object"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, "x", RegisterTee())
+		msg := common.GetUDFError(result)
+		if !strings.HasPrefix(msg, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, msg, tt.want)
+		}
+	}
+}
@@ -11,7 +11,7 @@ import (
 
 // RegisterTempDir registers the tempdir function with gojq
 func RegisterTempDir() gojq.CompilerOption {
-	return gojq.WithFunction("tempdir", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("tempdir", 0, 2, common.Audited("tempdir", func(v any, args []any) any {
 		var prefix string
 		var dir string
 
@@ -25,7 +25,7 @@ func RegisterTempDir() gojq.CompilerOption {
 				if prefixStr, ok := prefixVal.(string); ok {
 					prefix = prefixStr
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("tempdir: first argument (prefix) must be a string, got %T", args[0]), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tempdir: first argument (prefix) must be a string, got %T", args[0]), nil)
 				}
 			}
 		}
@@ -39,7 +39,7 @@ func RegisterTempDir() gojq.CompilerOption {
 				if dirStr, ok := dirVal.(string); ok {
 					dir = dirStr
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("tempdir: second argument (dir) must be a string, got %T", args[1]), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tempdir: second argument (dir) must be a string, got %T", args[1]), nil)
 				}
 			}
 
@@ -50,13 +50,13 @@ func RegisterTempDir() gojq.CompilerOption {
 				if dir == "~" {
 					home, homeErr := os.UserHomeDir()
 					if homeErr != nil {
-						return common.MakeUDFErrorResult(fmt.Errorf("tempdir: cannot determine home directory: %v", homeErr), nil)
+						return common.MakeUDFErrorResult(fmt.Errorf("tempdir: cannot determine home directory: %w", homeErr), nil)
 					}
 					absDir = home
 				} else if len(dir) > 0 && dir[0] == '~' && (len(dir) == 1 || dir[1] == '/') {
 					home, homeErr := os.UserHomeDir()
 					if homeErr != nil {
-						return common.MakeUDFErrorResult(fmt.Errorf("tempdir: cannot determine home directory: %v", homeErr), nil)
+						return common.MakeUDFErrorResult(fmt.Errorf("tempdir: cannot determine home directory: %w", homeErr), nil)
 					}
 					if len(dir) > 1 {
 						absDir = filepath.Join(home, dir[2:])
@@ -65,10 +65,10 @@ func RegisterTempDir() gojq.CompilerOption {
 					}
 					absDir, err = filepath.Abs(absDir)
 					if err != nil {
-						return common.MakeUDFErrorResult(fmt.Errorf("tempdir: cannot resolve directory path %q: %v", dir, err), nil)
+						return common.MakeUDFErrorResult(fmt.Errorf("tempdir: cannot resolve directory path %q: %w", dir, err), nil)
 					}
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("tempdir: cannot resolve directory path %q: %v", dir, err), nil)
+					return common.MakeUDFErrorResult(fmt.Errorf("tempdir: cannot resolve directory path %q: %w", dir, err), nil)
 				}
 			}
 			dir = absDir
@@ -77,18 +77,27 @@ func RegisterTempDir() gojq.CompilerOption {
 			dirInfo, err := os.Stat(dir)
 			if err != nil {
 				if os.IsNotExist(err) {
-					return common.MakeUDFErrorResult(fmt.Errorf("tempdir: directory does not exist: %q", dir), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeNotFound, "tempdir: directory does not exist: %q", dir), nil)
 				}
 				if os.IsPermission(err) {
-					return common.MakeUDFErrorResult(fmt.Errorf("tempdir: permission denied accessing directory: %q", dir), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodePermission, "tempdir: permission denied accessing directory: %q", dir), nil)
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("tempdir: failed to access directory %q: %v", dir, err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("tempdir: failed to access directory %q: %w", dir, err), nil)
 			}
 			if !dirInfo.IsDir() {
-				return common.MakeUDFErrorResult(fmt.Errorf("tempdir: %q is not a directory", dir), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tempdir: %q is not a directory", dir), nil)
 			}
 		}
 
+		// Without a directory, the system temp directory is written to
+		parent := dir
+		if parent == "" {
+			parent = os.TempDir()
+		}
+		if err := common.CheckWrite(parent); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("tempdir: %w", err), nil)
+		}
+
 		// Create temporary directory
 		tempDir, err := os.MkdirTemp(dir, prefix)
 		if err != nil {
@@ -101,7 +110,7 @@ func RegisterTempDir() gojq.CompilerOption {
 			if prefix != "" {
 				meta["prefix"] = prefix
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("tempdir: failed to create temporary directory: %v", err), meta)
+			return common.MakeUDFErrorResult(fmt.Errorf("tempdir: failed to create temporary directory: %w", err), meta)
 		}
 
 		// Get absolute path
@@ -123,6 +132,6 @@ func RegisterTempDir() gojq.CompilerOption {
 		}
 
 		return common.MakeUDFSuccessResult(absTempDir, meta)
-	})
+	}))
 }
 
@@ -0,0 +1,109 @@
+package tempdir
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// RegisterTempFile registers the tempfile function with gojq
+func RegisterTempFile() gojq.CompilerOption {
+	return common.WithFunction("tempfile", 0, 3, common.Audited("tempfile", func(v any, args []any) any {
+		// tempfile(prefix; ext; dir). The input, unless it is null, is
+		// written to the file: strings as they are, other values as JSON
+		var strArgs [3]string
+		for i, name := range []string{"prefix", "ext", "dir"} {
+			if i >= len(args) {
+				break
+			}
+			s, ok := common.ExtractUDFValue(args[i]).(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tempfile: %v must be a string, got %T", name, common.ExtractUDFValue(args[i])), nil)
+			}
+			strArgs[i] = s
+		}
+		prefix, ext, dir := strArgs[0], strArgs[1], strArgs[2]
+		if strings.ContainsAny(prefix+ext, `/\`) {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tempfile: prefix and ext cannot contain path separators"), nil)
+		}
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if dir != "" {
+			absDir, err := common.ResolvePath(dir)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("tempfile: %w", err), nil)
+			}
+			dir = absDir
+			dirInfo, err := os.Stat(dir)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeNotFound, "tempfile: directory does not exist: %q", dir), nil)
+				}
+				return common.MakeUDFErrorResult(fmt.Errorf("tempfile: failed to access directory %q: %w", dir, err), nil)
+			}
+			if !dirInfo.IsDir() {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tempfile: %q is not a directory", dir), nil)
+			}
+		}
+
+		var data []byte
+		switch val := common.ExtractUDFValue(v).(type) {
+		case nil:
+		case string:
+			data = []byte(val)
+		default:
+			b, err := json.Marshal(val)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("tempfile: failed to marshal JSON: %w", err), nil)
+			}
+			data = append(b, '\n')
+		}
+
+		meta := map[string]any{
+			"operation": "tempfile",
+		}
+		if prefix != "" {
+			meta["prefix"] = prefix
+		}
+		if ext != "" {
+			meta["ext"] = ext
+		}
+		if dir != "" {
+			meta["dir"] = dir
+		}
+
+		parent := dir
+		if parent == "" {
+			parent = os.TempDir()
+		}
+		if err := common.CheckWrite(parent); err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("tempfile: %w", err), meta)
+		}
+
+		f, err := os.CreateTemp(dir, prefix+"*"+ext)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("tempfile: failed to create temporary file: %w", err), meta)
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return common.MakeUDFErrorResult(fmt.Errorf("tempfile: failed to write temporary file: %w", err), meta)
+		}
+
+		path, err := common.ResolvePath(f.Name())
+		if err != nil {
+			path = f.Name()
+		}
+		meta["path"] = path
+		meta["bytes_written"] = len(data)
+		return common.MakeUDFSuccessResult(path, meta)
+	}))
+}
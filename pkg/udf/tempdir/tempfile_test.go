@@ -0,0 +1,73 @@
+package tempdir
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+func TestTempFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		query   string
+		input   any
+		prefix  string
+		suffix  string
+		content string
+	}{
+		{"empty", `tempfile(""; ""; "` + dir + `")`, nil, "", "", ""},
+		{"prefix and ext", `tempfile("report-"; "csv"; "` + dir + `")`, "a,b\n1,2\n", "report-", ".csv", "a,b\n1,2\n"},
+		{"dotted ext", `tempfile("x"; ".json"; "` + dir + `")`, map[string]any{"k": "v"}, "x", ".json", "{\"k\":\"v\"}\n"},
+		{"envelope input", `{_val: "inner", _meta: {}} | tempfile("e"; ""; "` + dir + `")`, nil, "e", "", "inner"},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, tt.input, RegisterTempFile()).(map[string]any)
+		path, ok := res["_val"].(string)
+		if !ok {
+			t.Fatalf("%s: %v", tt.name, res)
+		}
+		base := filepath.Base(path)
+		if filepath.Dir(path) != dir || !strings.HasPrefix(base, tt.prefix) || !strings.HasSuffix(base, tt.suffix) {
+			t.Errorf("%s: path = %q", tt.name, path)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != tt.content {
+			t.Errorf("%s: content = %q, %v; want %q", tt.name, got, err, tt.content)
+		}
+		if n := res["_meta"].(map[string]any)["bytes_written"]; n != len(tt.content) {
+			t.Errorf("%s: bytes_written = %v", tt.name, n)
+		}
+	}
+
+	// Default directory and unique names
+	a := runGojqQuery(t, `tempfile`, nil, RegisterTempFile()).(map[string]any)["_val"].(string)
+	b := runGojqQuery(t, `tempfile`, nil, RegisterTempFile()).(map[string]any)["_val"].(string)
+	defer os.Remove(a)
+	defer os.Remove(b)
+	if a == b || !filepath.IsAbs(a) {
+		t.Errorf("tempfile paths %q and %q", a, b)
+	}
+}
+
+func TestTempFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`tempfile("p"; "txt"; "` + filepath.Join(dir, "missing") + `")`, "tempfile: directory does not exist"},
+		{`tempfile("a/b")`, "tempfile: prefix and ext cannot contain path separators"},
+		{`tempfile(1)`, "tempfile: prefix must be a string"},
+		{`tempfile("p"; 2)`, "tempfile: ext must be a string"},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, nil, RegisterTempFile()).(map[string]any)
+		if got := common.GetUDFError(res); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, got, tt.want)
+		}
+	}
+}
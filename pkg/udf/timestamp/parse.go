@@ -0,0 +1,303 @@
+package timestamp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// knownFormats are tried in order when no layout is given. Go accepts a
+// fractional second after the seconds field even when the layout has none
+var knownFormats = []struct {
+	name   string
+	layout string
+}{
+	{"RFC3339", time.RFC3339},
+	{"ISO8601", "2006-01-02T15:04:05Z0700"},
+	{"ISO8601", "2006-01-02T15:04:05"},
+	{"ISO8601", "2006-01-02 15:04:05Z07:00"},
+	{"ISO8601", "2006-01-02 15:04:05Z0700"},
+	{"ISO8601", "2006-01-02 15:04:05 -0700 MST"},
+	{"ISO8601", "2006-01-02 15:04:05 -0700"},
+	{"ISO8601", "2006-01-02 15:04:05"},
+	{"ISO8601", "2006-01-02T15:04Z07:00"},
+	{"ISO8601", "2006-01-02T15:04"},
+	{"ISO8601", "2006-01-02 15:04"},
+	{"ISO8601 basic", "20060102T150405Z0700"},
+	{"ISO8601 basic", "20060102T150405"},
+	{"date", "2006-01-02"},
+	{"RFC1123Z", time.RFC1123Z},
+	{"RFC1123", time.RFC1123},
+	{"RFC1123Z", "Mon, _2 Jan 2006 15:04:05 -0700"},
+	{"RFC1123Z", "Mon, _2 Jan 2006 15:04:05 -0700 (MST)"},
+	{"RFC850", time.RFC850},
+	{"RFC822Z", time.RFC822Z},
+	{"RFC822", time.RFC822},
+	{"ANSIC", time.ANSIC},
+	{"UnixDate", time.UnixDate},
+	{"RubyDate", time.RubyDate},
+	{"apache", "02/Jan/2006:15:04:05 -0700"},
+	{"syslog", "Jan _2 15:04:05"},
+	{"syslog", "Jan _2 2006 15:04:05"},
+	{"slash", "2006/01/02 15:04:05"},
+	{"slash", "2006/01/02"},
+	{"windows", "1/2/2006 3:04:05 PM"},
+	{"windows", "1/2/2006 15:04:05"},
+	{"windows", "1/2/2006"},
+	{"dmy", "02-Jan-2006 15:04:05"},
+	{"dmy", "_2 Jan 2006 15:04:05"},
+	{"dmy", "_2 Jan 2006"},
+	{"text", "January _2, 2006 3:04 PM"},
+	{"text", "January _2, 2006"},
+	{"text", "Jan _2, 2006"},
+}
+
+// strftimeLayouts maps strftime directives to Go layout elements
+var strftimeLayouts = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'j': "002",
+	'H': "15", 'I': "03", 'M': "04", 'S': "05", 'f': "000000", 'p': "PM",
+	'b': "Jan", 'h': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday",
+	'z': "-0700", 'Z': "MST", 'T': "15:04:05", 'D': "01/02/06", 'F': "2006-01-02",
+	'%': "%",
+}
+
+// goLayout converts a strftime layout such as "%Y-%m-%d" to a Go layout.
+// Layouts without % are Go layouts already
+func goLayout(layout string) (string, error) {
+	if !strings.Contains(layout, "%") {
+		return layout, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			sb.WriteByte(layout[i])
+			continue
+		}
+		if i+1 == len(layout) {
+			return "", common.Errorf(common.CodeInvalid, "layout ends with %%")
+		}
+		i++
+		elem, ok := strftimeLayouts[layout[i]]
+		if !ok {
+			return "", common.Errorf(common.CodeInvalid, "unsupported directive %%%c", layout[i])
+		}
+		sb.WriteString(elem)
+	}
+	return sb.String(), nil
+}
+
+// dateParseOptions are the settings accepted by date_parse
+type dateParseOptions struct {
+	Layout string
+	Loc    *time.Location // zone for times without one
+	Year   int            // year for times without one, 0 for automatic
+	Unit   string         // unit of numeric input, "" to guess from magnitude
+}
+
+func parseDateOptions(m map[string]any, opts *dateParseOptions) error {
+	for key, raw := range m {
+		switch key {
+		case "layout":
+			s, ok := raw.(string)
+			if !ok {
+				return common.Errorf(common.CodeInvalid, "options.layout must be a string, got %T", raw)
+			}
+			opts.Layout = s
+		case "tz":
+			s, ok := raw.(string)
+			if !ok {
+				return common.Errorf(common.CodeInvalid, "options.tz must be a string, got %T", raw)
+			}
+			loc, err := time.LoadLocation(s)
+			if err != nil {
+				return common.Errorf(common.CodeInvalid, "unknown time zone %q", s)
+			}
+			opts.Loc = loc
+		case "year":
+			f, ok := raw.(float64)
+			if n, isInt := raw.(int); isInt {
+				f, ok = float64(n), true
+			}
+			if !ok || f != math.Trunc(f) || f < 1 || f > 9999 {
+				return common.Errorf(common.CodeInvalid, "options.year must be an integer from 1 to 9999, got %v", raw)
+			}
+			opts.Year = int(f)
+		case "unit":
+			s, _ := raw.(string)
+			switch s {
+			case "s", "ms", "us", "ns":
+				opts.Unit = s
+			default:
+				return common.Errorf(common.CodeInvalid, `options.unit must be "s", "ms", "us" or "ns", got %v`, raw)
+			}
+		default:
+			return common.Errorf(common.CodeInvalid, "unknown option %q", key)
+		}
+	}
+	return nil
+}
+
+// fromEpoch converts an epoch number. Without a unit, the magnitude
+// decides: seconds up to 1e11 (the year 5138), then milliseconds,
+// microseconds and nanoseconds
+func fromEpoch(n float64, unit string, loc *time.Location) (time.Time, string) {
+	if unit == "" {
+		switch abs := math.Abs(n); {
+		case abs < 1e11:
+			unit = "s"
+		case abs < 1e14:
+			unit = "ms"
+		case abs < 1e17:
+			unit = "us"
+		default:
+			unit = "ns"
+		}
+	}
+	scale := map[string]float64{"s": 1, "ms": 1e3, "us": 1e6, "ns": 1e9}[unit]
+	sec, frac := math.Modf(n / scale)
+	// Round to microseconds; a float64 does not hold more precision
+	nsec := math.Round(frac*1e6) * 1e3
+	return time.Unix(int64(sec), int64(nsec)).In(loc), "epoch_" + unit
+}
+
+// resolveYear fills in the year of a syslog-style time that has none: the
+// current year, or the previous one if that would put the time more than a
+// day in the future
+func resolveYear(t time.Time, year int, now time.Time) time.Time {
+	withYear := func(year int) time.Time {
+		return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	}
+	if year != 0 {
+		return withYear(year)
+	}
+	year = now.In(t.Location()).Year()
+	if withYear(year).After(now.Add(24 * time.Hour)) {
+		year--
+	}
+	return withYear(year)
+}
+
+// ParseDate parses s with layout, or with the known formats when layout is
+// empty. It returns the time, the name of the format that matched, and
+// whether the year was missing and guessed from now
+func ParseDate(s string, opts dateParseOptions, now time.Time) (time.Time, string, bool, error) {
+	s = strings.TrimSpace(s)
+	if opts.Layout != "" {
+		layout, err := goLayout(opts.Layout)
+		if err != nil {
+			return time.Time{}, "", false, err
+		}
+		t, err := time.ParseInLocation(layout, s, opts.Loc)
+		if err != nil {
+			return time.Time{}, "", false, common.Errorf(common.CodeInvalid, "cannot parse %q with layout %q", s, opts.Layout)
+		}
+		// Layouts without a year parse as year 0
+		if t.Year() == 0 {
+			return resolveYear(t, opts.Year, now), "layout", opts.Year == 0, nil
+		}
+		return t, "layout", false, nil
+	}
+
+	// Numbers in strings are epoch times
+	if n, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "eEnN") {
+		t, format := fromEpoch(n, opts.Unit, opts.Loc)
+		return t, format, false, nil
+	}
+	// Access logs wrap the time in brackets: [10/Oct/2000:13:55:36 -0700]
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	for _, f := range knownFormats {
+		t, err := time.ParseInLocation(f.layout, s, opts.Loc)
+		if err != nil {
+			continue
+		}
+		if t.Year() == 0 {
+			return resolveYear(t, opts.Year, now), f.name, opts.Year == 0, nil
+		}
+		return t, f.name, false, nil
+	}
+	return time.Time{}, "", false, common.Errorf(common.CodeInvalid, "unrecognized date format %q", s)
+}
+
+// components breaks t into its fields
+func components(t time.Time) map[string]any {
+	zone, offset := t.Zone()
+	return map[string]any{
+		"year":       t.Year(),
+		"month":      int(t.Month()),
+		"day":        t.Day(),
+		"hour":       t.Hour(),
+		"minute":     t.Minute(),
+		"second":     t.Second(),
+		"nanosecond": t.Nanosecond(),
+		"weekday":    t.Weekday().String(),
+		"yday":       t.YearDay(),
+		"zone":       zone,
+		"offset":     offset,
+	}
+}
+
+// RegisterDateParse registers the date_parse function with gojq
+func RegisterDateParse() gojq.CompilerOption {
+	return common.WithFunction("date_parse", 0, 2, func(v any, args []any) any {
+		// date_parse, date_parse(layout), date_parse(options) or
+		// date_parse(layout; options); a null layout detects the format
+		opts := dateParseOptions{Loc: time.UTC}
+		for i, arg := range args {
+			switch val := common.ExtractUDFValue(arg).(type) {
+			case nil:
+			case string:
+				if i > 0 {
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "date_parse: options must be an object, got string"), nil)
+				}
+				opts.Layout = val
+			case map[string]any:
+				if err := parseDateOptions(val, &opts); err != nil {
+					return common.MakeUDFErrorResult(fmt.Errorf("date_parse: %w", err), nil)
+				}
+			default:
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "date_parse: layout must be a string and options an object, got %T", val), nil)
+			}
+		}
+
+		var t time.Time
+		var format string
+		var yearAssumed bool
+		switch val := common.ExtractUDFValue(v).(type) {
+		case int:
+			t, format = fromEpoch(float64(val), opts.Unit, opts.Loc)
+		case float64:
+			if math.IsNaN(val) || math.IsInf(val, 0) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "date_parse: invalid epoch time %v", val), nil)
+			}
+			t, format = fromEpoch(val, opts.Unit, opts.Loc)
+		case string:
+			var err error
+			if t, format, yearAssumed, err = ParseDate(val, opts, time.Now()); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("date_parse: %w", err), nil)
+			}
+		default:
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "date_parse: input must be a string or a number, got %T", val), nil)
+		}
+
+		meta := map[string]any{
+			"operation":  "date_parse",
+			"format":     format,
+			"timestamp":  float64(t.Unix()) + float64(t.Nanosecond())/1e9,
+			"components": components(t),
+		}
+		if opts.Layout != "" {
+			meta["layout"] = opts.Layout
+		}
+		if yearAssumed {
+			meta["year_assumed"] = true
+		}
+		return common.MakeUDFSuccessResult(t.Format(time.RFC3339Nano), meta)
+	})
+}
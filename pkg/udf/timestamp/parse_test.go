@@ -0,0 +1,169 @@
+package timestamp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input  string
+		want   string
+		format string
+	}{
+		{"2024-03-01T10:20:30Z", "2024-03-01T10:20:30Z", "RFC3339"},
+		{"2024-03-01T10:20:30.123456+02:00", "2024-03-01T10:20:30.123456+02:00", "RFC3339"},
+		{"2024-03-01 10:20:30", "2024-03-01T10:20:30Z", "ISO8601"},
+		{"2024-03-01 10:20:30,250", "2024-03-01T10:20:30.25Z", "ISO8601"},
+		{"2024-03-01T10:20:30+0100", "2024-03-01T10:20:30+01:00", "ISO8601"},
+		{"20240301T102030Z", "2024-03-01T10:20:30Z", "ISO8601 basic"},
+		{"2024-03-01", "2024-03-01T00:00:00Z", "date"},
+		{"Fri, 01 Mar 2024 10:20:30 +0000", "2024-03-01T10:20:30Z", "RFC1123Z"},
+		{"Fri, 1 Mar 2024 10:20:30 -0500", "2024-03-01T10:20:30-05:00", "RFC1123Z"},
+		{"Fri Mar  1 10:20:30 2024", "2024-03-01T10:20:30Z", "ANSIC"},
+		{"01/Mar/2024:10:20:30 +0200", "2024-03-01T10:20:30+02:00", "apache"},
+		{"[10/Oct/2000:13:55:36 -0700]", "2000-10-10T13:55:36-07:00", "apache"},
+		{"Mar  1 10:20:30", "2024-03-01T10:20:30Z", "syslog"},
+		// Later in the year than now means last year
+		{"Dec 31 23:59:59", "2023-12-31T23:59:59Z", "syslog"},
+		{"2024/03/01 10:20:30", "2024-03-01T10:20:30Z", "slash"},
+		{"3/1/2024 1:20:30 PM", "2024-03-01T13:20:30Z", "windows"},
+		{"1 Mar 2024", "2024-03-01T00:00:00Z", "dmy"},
+		{"March 1, 2024", "2024-03-01T00:00:00Z", "text"},
+		{"1709288430", "2024-03-01T10:20:30Z", "epoch_s"},
+		{"1709288430250", "2024-03-01T10:20:30.25Z", "epoch_ms"},
+		{"1709288430250000", "2024-03-01T10:20:30.25Z", "epoch_us"},
+		{"1709288430250000000", "2024-03-01T10:20:30.25Z", "epoch_ns"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, format, _, err := ParseDate(tt.input, dateParseOptions{Loc: time.UTC}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format(time.RFC3339Nano) != tt.want || format != tt.format {
+				t.Errorf("ParseDate(%q) = %s (%s), want %s (%s)", tt.input, got.Format(time.RFC3339Nano), format, tt.want, tt.format)
+			}
+		})
+	}
+}
+
+func TestGoLayout(t *testing.T) {
+	tests := map[string]string{
+		"%Y-%m-%d %H:%M:%S": "2006-01-02 15:04:05",
+		"%d/%b/%Y:%T %z":    "02/Jan/2006:15:04:05 -0700",
+		"%F %I%p 100%%":     "2006-01-02 03PM 100%",
+		"2006-01-02":        "2006-01-02",
+	}
+	for in, want := range tests {
+		if got, err := goLayout(in); err != nil || got != want {
+			t.Errorf("goLayout(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := goLayout("%Q"); err == nil {
+		t.Error("Expected an error for an unsupported directive")
+	}
+}
+
+func TestDateParseUDF(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		input any
+		want  any
+	}{
+		{"auto", `date_parse | ._val`, "Fri, 01 Mar 2024 10:20:30 +0000", "2024-03-01T10:20:30Z"},
+		{"strftime layout", `date_parse("%d.%m.%Y %H:%M") | ._val`, "01.03.2024 10:20", "2024-03-01T10:20:00Z"},
+		{"go layout", `date_parse("02.01.2006") | ._val`, "01.03.2024", "2024-03-01T00:00:00Z"},
+		{"time zone", `date_parse({tz: "America/New_York"}) | ._val`, "2024-03-01 10:20:30", "2024-03-01T10:20:30-05:00"},
+		{"layout and options", `date_parse("%b %d %H:%M:%S"; {year: 2020}) | ._val`, "Feb 29 10:20:30", "2020-02-29T10:20:30Z"},
+		{"syslog year", `date_parse({year: 2019}) | ._val`, "Mar  1 10:20:30", "2019-03-01T10:20:30Z"},
+		{"null layout", `date_parse(null; {tz: "Asia/Tokyo"}) | ._val`, "2024-03-01 10:20:30", "2024-03-01T10:20:30+09:00"},
+		{"epoch number", `date_parse | ._val`, 1709288430, "2024-03-01T10:20:30Z"},
+		{"epoch float", `date_parse | ._val`, 1709288430.5, "2024-03-01T10:20:30.5Z"},
+		{"epoch unit", `date_parse({unit: "ms"}) | ._val`, 1000, "1970-01-01T00:00:01Z"},
+		{"timestamp", `date_parse | ._meta.timestamp`, "2024-03-01T10:20:30.5Z", 1709288430.5},
+		{"format", `date_parse | ._meta.format`, "01/Mar/2024:10:20:30 +0000", "apache"},
+		{"bracketed", `date_parse | ._val`, "[10/Oct/2000:13:55:36 -0700]", "2000-10-10T13:55:36-07:00"},
+		{"year assumed", `date_parse | ._meta.year_assumed`, "Mar  1 10:20:30", true},
+		{"year given", `date_parse({year: 2019}) | ._meta.year_assumed`, "Mar  1 10:20:30", nil},
+		{"year in input", `date_parse | ._meta.year_assumed`, "2024-03-01", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query, tt.input, RegisterDateParse())
+			if got != tt.want {
+				t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	got := runGojqQuery(t, `date_parse | ._meta.components`, "2024-03-01T10:20:30.25+02:00", RegisterDateParse())
+	want := map[string]any{
+		"year": 2024, "month": 3, "day": 1, "hour": 10, "minute": 20, "second": 30,
+		"nanosecond": 250000000, "weekday": "Friday", "yday": 61, "zone": "", "offset": 7200,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("components = %v, want %v", got, want)
+	}
+}
+
+func TestDateParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`date_parse`, "not a date", `date_parse: unrecognized date format "not a date"`},
+		{`date_parse("%Y-%m-%d")`, "2024/03/01", `date_parse: cannot parse "2024/03/01" with layout "%Y-%m-%d"`},
+		{`date_parse("%Q")`, "x", "date_parse: unsupported directive %Q"},
+		{`date_parse({tz: "Mars/Base"})`, "2024-03-01", `date_parse: unknown time zone "Mars/Base"`},
+		{`date_parse({year: 1.5})`, "Mar  1 10:20:30", "date_parse: options.year must be an integer"},
+		{`date_parse({unit: "m"})`, 1, "date_parse: options.unit must be"},
+		{`date_parse({bogus: 1})`, "x", `date_parse: unknown option "bogus"`},
+		{`date_parse("%Y"; "x")`, "x", "date_parse: options must be an object"},
+		{`date_parse(5)`, "x", "date_parse: layout must be a string"},
+		{`date_parse`, true, "date_parse: input must be a string or a number"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, RegisterDateParse())
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
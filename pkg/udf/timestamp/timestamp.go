@@ -12,10 +12,10 @@ import (
 
 // RegisterTimestampToDate registers the timestamp_to_date function with gojq
 func RegisterTimestampToDate() gojq.CompilerOption {
-	return gojq.WithFunction("timestamp_to_date", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("timestamp_to_date", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("timestamp_to_date: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("timestamp_to_date: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -27,19 +27,19 @@ func RegisterTimestampToDate() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("timestamp_to_date: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "timestamp_to_date: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
 			if err != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("timestamp_to_date: %v", err), nil)
+				return common.MakeUDFErrorResult(fmt.Errorf("timestamp_to_date: %w", err), nil)
 			}
 
 			// Parse timestamp from file
 			tsStr := strings.TrimSpace(string(fileData))
 			ts, parseErr := strconv.ParseInt(tsStr, 10, 64)
 			if parseErr != nil {
-				return common.MakeUDFErrorResult(fmt.Errorf("timestamp_to_date: invalid timestamp in file: %v", parseErr), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "timestamp_to_date: invalid timestamp in file: %w", parseErr), nil)
 			}
 			timestamp = ts
 			filePath = absPath
@@ -56,7 +56,7 @@ func RegisterTimestampToDate() gojq.CompilerOption {
 			case string:
 				ts, parseErr := strconv.ParseInt(val, 10, 64)
 				if parseErr != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("timestamp_to_date: invalid timestamp: %v", parseErr), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "timestamp_to_date: invalid timestamp: %w", parseErr), nil)
 				}
 				timestamp = ts
 			default:
@@ -64,7 +64,7 @@ func RegisterTimestampToDate() gojq.CompilerOption {
 				valStr := fmt.Sprintf("%v", val)
 				ts, parseErr := strconv.ParseInt(valStr, 10, 64)
 				if parseErr != nil {
-					return common.MakeUDFErrorResult(fmt.Errorf("timestamp_to_date: invalid timestamp %q: %v", valStr, parseErr), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "timestamp_to_date: invalid timestamp %q: %w", valStr, parseErr), nil)
 				}
 				timestamp = ts
 			}
@@ -100,10 +100,10 @@ func RegisterTimestampToDate() gojq.CompilerOption {
 
 // RegisterDateToTimestamp registers the date_to_timestamp function with gojq
 func RegisterDateToTimestamp() gojq.CompilerOption {
-	return gojq.WithFunction("date_to_timestamp", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("date_to_timestamp", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("date_to_timestamp: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("date_to_timestamp: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -115,7 +115,7 @@ func RegisterDateToTimestamp() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("date_to_timestamp: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "date_to_timestamp: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -123,7 +123,7 @@ func RegisterDateToTimestamp() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "date_to_timestamp",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("date_to_timestamp: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("date_to_timestamp: %w", err), meta)
 			}
 
 			dateStr = strings.TrimSpace(string(fileData))
@@ -139,7 +139,7 @@ func RegisterDateToTimestamp() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					dateStr = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("date_to_timestamp: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "date_to_timestamp: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -172,7 +172,7 @@ func RegisterDateToTimestamp() gojq.CompilerOption {
 				meta["file_path"] = filePath
 				meta["file_size"] = int(fileSize)
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("date_to_timestamp: unable to parse date %q: %v", dateStr, parseErr), meta)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "date_to_timestamp: unable to parse date %q: %w", dateStr, parseErr), meta)
 		}
 
 		timestamp := t.Unix()
@@ -0,0 +1,218 @@
+package timestamp
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// zoneDirs are the directories searched for the IANA database, in the
+// order the time package uses
+var zoneDirs = []string{
+	"/usr/share/zoneinfo/",
+	"/usr/share/lib/zoneinfo/",
+	"/usr/lib/locale/TZ/",
+	"/etc/zoneinfo/",
+}
+
+// isZoneName reports whether name is a zone rather than a database file
+// or one of the legacy trees that duplicate every zone
+func isZoneName(name string) bool {
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return false
+	}
+	switch strings.SplitN(name, "/", 2)[0] {
+	case "Etc", "SystemV":
+		return strings.HasPrefix(name, "Etc/")
+	case "Factory":
+		return false
+	}
+	return !strings.Contains(name, ".")
+}
+
+// ListZones returns the names of the zones in the IANA database and where
+// it was found: $ZONEINFO, a system directory, or Go's zoneinfo.zip
+func ListZones() ([]string, string, error) {
+	dirs := zoneDirs
+	if env := os.Getenv("ZONEINFO"); env != "" {
+		dirs = append([]string{env}, dirs...)
+	}
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			if names, err := zipZones(dir); err == nil {
+				return names, dir, nil
+			}
+			continue
+		}
+		var names []string
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			name, _ := filepath.Rel(dir, path)
+			name = filepath.ToSlash(name)
+			if isZoneName(name) && isTZif(path) {
+				names = append(names, name)
+			}
+			return nil
+		})
+		if len(names) > 0 {
+			sort.Strings(names)
+			return names, dir, nil
+		}
+	}
+	zip := filepath.Join(runtime.GOROOT(), "lib", "time", "zoneinfo.zip")
+	names, err := zipZones(zip)
+	if err != nil {
+		return nil, "", common.Errorf(common.CodeNotFound, "time zone database not found")
+	}
+	return names, zip, nil
+}
+
+// isTZif reports whether path is a compiled zone file
+func isTZif(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	_, err = f.Read(magic)
+	return err == nil && bytes.Equal(magic, []byte("TZif"))
+}
+
+func zipZones(path string) ([]string, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var names []string
+	for _, f := range r.File {
+		if isZoneName(f.Name) && !strings.HasSuffix(f.Name, "/") {
+			names = append(names, f.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// loadZone loads an IANA zone, or "Local"
+func loadZone(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, common.Errorf(common.CodeInvalid, "zone must not be empty")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, common.Errorf(common.CodeInvalid, "unknown time zone %q", name)
+	}
+	return loc, nil
+}
+
+// zoneInfo describes t's zone at t
+func zoneInfo(t time.Time) map[string]any {
+	abbr, offset := t.Zone()
+	return map[string]any{
+		"zone":         t.Location().String(),
+		"abbreviation": abbr,
+		"offset":       offset,
+		"dst":          t.IsDST(),
+	}
+}
+
+// RegisterTZConvert registers the tz_convert function with gojq
+func RegisterTZConvert() gojq.CompilerOption {
+	return common.WithFunction("tz_convert", 1, 2, func(v any, args []any) any {
+		// tz_convert(zone) or tz_convert(zone; from), where from is the
+		// zone of input times that have no offset (default UTC)
+		zone, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tz_convert: zone must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		loc, err := loadZone(zone)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("tz_convert: %w", err), nil)
+		}
+		opts := dateParseOptions{Loc: time.UTC}
+		if len(args) > 1 {
+			from, ok := common.ExtractUDFValue(args[1]).(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tz_convert: from must be a string, got %T", common.ExtractUDFValue(args[1])), nil)
+			}
+			if opts.Loc, err = loadZone(from); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("tz_convert: %w", err), nil)
+			}
+		}
+
+		// Accepts anything date_parse does, including its results
+		var t time.Time
+		switch val := common.ExtractUDFValue(v).(type) {
+		case int:
+			t, _ = fromEpoch(float64(val), "", opts.Loc)
+		case float64:
+			if math.IsNaN(val) || math.IsInf(val, 0) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tz_convert: invalid epoch time %v", val), nil)
+			}
+			t, _ = fromEpoch(val, "", opts.Loc)
+		case string:
+			if t, _, _, err = ParseDate(val, opts, time.Now()); err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("tz_convert: %w", err), nil)
+			}
+		default:
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tz_convert: input must be a string or a number, got %T", val), nil)
+		}
+
+		converted := t.In(loc)
+		meta := zoneInfo(converted)
+		meta["operation"] = "tz_convert"
+		meta["from"] = zoneInfo(t)
+		meta["timestamp"] = float64(t.Unix()) + float64(t.Nanosecond())/1e9
+		meta["components"] = components(converted)
+		return common.MakeUDFSuccessResult(converted.Format(time.RFC3339Nano), meta)
+	})
+}
+
+// RegisterTZList registers the tz_list function with gojq
+func RegisterTZList() gojq.CompilerOption {
+	return common.WithFunction("tz_list", 0, 1, func(v any, args []any) any {
+		// tz_list or tz_list(prefix), e.g. tz_list("Europe/")
+		prefix := ""
+		if len(args) > 0 {
+			s, ok := common.ExtractUDFValue(args[0]).(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "tz_list: prefix must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+			}
+			prefix = s
+		}
+		names, source, err := ListZones()
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("tz_list: %w", err), nil)
+		}
+		zones := make([]any, 0, len(names))
+		for _, name := range names {
+			if strings.HasPrefix(name, prefix) {
+				zones = append(zones, name)
+			}
+		}
+		return common.MakeUDFSuccessResult(zones, map[string]any{
+			"operation": "tz_list",
+			"count":     len(zones),
+			"source":    source,
+		})
+	})
+}
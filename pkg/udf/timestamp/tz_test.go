@@ -0,0 +1,103 @@
+package timestamp
+
+import (
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+func TestTZConvert(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		input any
+		want  any
+	}{
+		{"winter", `tz_convert("America/New_York") | ._val`, "2024-01-15T12:00:00Z", "2024-01-15T07:00:00-05:00"},
+		{"summer", `tz_convert("America/New_York") | ._val`, "2024-07-15T12:00:00Z", "2024-07-15T08:00:00-04:00"},
+		{"dst", `tz_convert("Europe/Berlin") | ._meta | [.abbreviation, .offset, .dst]`, "2024-07-15T12:00:00Z", []any{"CEST", 7200, true}},
+		// 02:30 local does not exist on the day clocks spring forward
+		{"spring forward", `tz_convert("Europe/Berlin") | ._val`, "2024-03-31T01:30:00Z", "2024-03-31T03:30:00+02:00"},
+		{"from zone", `tz_convert("UTC"; "Asia/Tokyo") | ._val`, "2024-03-01 09:00:00", "2024-03-01T00:00:00Z"},
+		{"from offset", `tz_convert("Asia/Kolkata") | ._meta.from.offset`, "2024-03-01T09:00:00-03:00", -10800},
+		{"epoch", `tz_convert("Australia/Sydney") | ._val`, 1709288430, "2024-03-01T21:20:30+11:00"},
+		{"date_parse result", `date_parse | tz_convert("Asia/Kathmandu") | ._val`, "01/Mar/2024:10:20:30 +0000", "2024-03-01T16:05:30+05:45"},
+		{"components", `tz_convert("Pacific/Auckland") | ._meta.components | [.day, .hour]`, "2024-03-01T12:00:00Z", []any{2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGojqQuery(t, tt.query, tt.input, RegisterTZConvert(), RegisterDateParse())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTZList(t *testing.T) {
+	result := runGojqQuery(t, `tz_list`, nil, RegisterTZList())
+	obj := result.(map[string]any)
+	zones, _ := obj["_val"].([]any)
+	if len(zones) < 300 {
+		t.Fatalf("Expected the IANA zones, got %v", obj["_meta"])
+	}
+	seen := map[any]bool{}
+	for _, z := range zones {
+		seen[z] = true
+	}
+	for _, want := range []string{"Europe/Berlin", "America/Argentina/Buenos_Aires", "UTC", "Etc/GMT+5"} {
+		if !seen[want] {
+			t.Errorf("Expected %s in tz_list", want)
+		}
+	}
+	for _, unwanted := range []string{"posixrules", "localtime", "zone.tab", "Factory", "posix/UTC"} {
+		if seen[unwanted] {
+			t.Errorf("Did not expect %s in tz_list", unwanted)
+		}
+	}
+
+	result = runGojqQuery(t, `tz_list("Europe/") | [._meta.count == (._val | length), (._val | all(startswith("Europe/")))]`, nil, RegisterTZList())
+	if !reflect.DeepEqual(result, []any{true, true}) {
+		t.Errorf("Expected only European zones, got %v", result)
+	}
+}
+
+func TestListZonesFromZip(t *testing.T) {
+	zip := filepath.Join(runtime.GOROOT(), "lib", "time", "zoneinfo.zip")
+	t.Setenv("ZONEINFO", zip)
+	names, source, err := ListZones()
+	if err != nil {
+		t.Skipf("zoneinfo.zip not available: %v", err)
+	}
+	if source != zip || len(names) < 300 {
+		t.Errorf("Expected zones from %s, got %d from %s", zip, len(names), source)
+	}
+}
+
+func TestTZErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`tz_convert("Mars/Base")`, "2024-03-01", `tz_convert: unknown time zone "Mars/Base"`},
+		{`tz_convert("")`, "2024-03-01", "tz_convert: zone must not be empty"},
+		{`tz_convert(1)`, "2024-03-01", "tz_convert: zone must be a string"},
+		{`tz_convert("UTC"; "Nowhere")`, "2024-03-01", `tz_convert: unknown time zone "Nowhere"`},
+		{`tz_convert("UTC")`, "yesterday", `tz_convert: unrecognized date format "yesterday"`},
+		{`tz_convert("UTC")`, []any{}, "tz_convert: input must be a string or a number"},
+		{`tz_list(1)`, nil, "tz_list: prefix must be a string"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, RegisterTZConvert(), RegisterTZList())
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
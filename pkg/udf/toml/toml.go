@@ -0,0 +1,184 @@
+package toml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/itchyny/gojq"
+	gotoml "github.com/pelletier/go-toml/v2"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// normalize converts decoded TOML values into types gojq understands.
+// Dates and times become strings in their TOML (RFC 3339) form
+func normalize(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = normalize(item)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = normalize(item)
+		}
+		return val
+	case int64:
+		if int64(int(val)) == val {
+			return int(val)
+		}
+		return new(big.Int).SetInt64(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case gotoml.LocalDate:
+		return val.String()
+	case gotoml.LocalTime:
+		return val.String()
+	case gotoml.LocalDateTime:
+		return val.String()
+	default:
+		return val
+	}
+}
+
+// fromJSONNumbers replaces json.Number values so integers are written as
+// TOML integers rather than floats
+func fromJSONNumbers(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = fromJSONNumbers(item)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = fromJSONNumbers(item)
+		}
+		return val
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+		f, _ := val.Float64()
+		return f
+	default:
+		return val
+	}
+}
+
+// RegisterTOMLParse registers the toml_parse function with gojq
+func RegisterTOMLParse() gojq.CompilerOption {
+	return common.WithFunction("toml_parse", 0, 2, func(v any, args []any) any {
+		inputVal, isFile, err := common.ParseFileArgs(v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("toml_parse: %w", err), nil)
+		}
+
+		inputVal = common.ExtractUDFValue(inputVal)
+
+		var input []byte
+		var filePath string
+		var fileSize int64
+
+		if isFile {
+			filePathStr, ok := inputVal.(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "toml_parse: file argument requires string path, got %T", inputVal), nil)
+			}
+
+			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("toml_parse: %w", err), nil)
+			}
+			input = fileData
+			filePath = absPath
+			fileSize = size
+		} else {
+			switch val := inputVal.(type) {
+			case map[string]any:
+				// Already parsed, return as-is
+				return val
+			case string:
+				input = []byte(val)
+			case []byte:
+				input = val
+			default:
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "toml_parse: argument must be a string, got %T", val), nil)
+			}
+		}
+
+		var result map[string]any
+		if err := gotoml.Unmarshal(input, &result); err != nil {
+			meta := map[string]any{
+				"operation": "toml_parse",
+			}
+			if isFile {
+				meta["file_path"] = filePath
+				meta["file_size"] = int(fileSize)
+			}
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "toml_parse: invalid TOML: %w", err), meta)
+		}
+		if result == nil {
+			result = map[string]any{}
+		}
+
+		// For toml_parse, return the parsed document directly (not wrapped in _val/_meta)
+		// so it can be used with object operations, like json_parse
+		return normalize(result)
+	})
+}
+
+// RegisterTOMLStringify registers the toml_stringify function with gojq
+func RegisterTOMLStringify() gojq.CompilerOption {
+	return common.WithFunction("toml_stringify", 0, 2, func(v any, args []any) any {
+		inputVal, isFile, err := common.ParseFileArgs(v, args)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("toml_stringify: %w", err), nil)
+		}
+
+		inputVal = common.ExtractUDFValue(inputVal)
+
+		meta := map[string]any{
+			"operation": "toml_stringify",
+		}
+
+		// In file mode the input is the path of a JSON document to convert
+		if isFile {
+			filePathStr, ok := inputVal.(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "toml_stringify: file argument requires string path, got %T", inputVal), nil)
+			}
+			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
+			if err != nil {
+				return common.MakeUDFErrorResult(fmt.Errorf("toml_stringify: %w", err), nil)
+			}
+			meta["file_path"] = absPath
+			meta["file_size"] = int(size)
+			dec := json.NewDecoder(bytes.NewReader(fileData))
+			dec.UseNumber()
+			if err := dec.Decode(&inputVal); err != nil {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "toml_stringify: invalid JSON in file: %w", err), meta)
+			}
+			inputVal = fromJSONNumbers(inputVal)
+		}
+
+		// A TOML document is always a table at the top level
+		doc, ok := inputVal.(map[string]any)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "toml_stringify: input must be an object, got %T", inputVal), meta)
+		}
+
+		tomlBytes, err := gotoml.Marshal(doc)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("toml_stringify: failed to marshal: %w", err), meta)
+		}
+
+		result := string(tomlBytes)
+		meta["output_length"] = len(result)
+
+		return common.MakeUDFSuccessResult(result, meta)
+	})
+}
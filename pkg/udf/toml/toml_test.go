@@ -0,0 +1,153 @@
+package toml
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+const cargoManifest = `[package]
+name = "demo"
+version = "0.1.0"
+edition = "2021"
+published = 1979-05-27T07:32:00Z
+
+[dependencies]
+serde = { version = "1.0", features = ["derive"] }
+tokio = "1"
+
+[[bin]]
+name = "demo"
+path = "src/main.rs"
+`
+
+func TestTOMLParse(t *testing.T) {
+	options := []gojq.CompilerOption{RegisterTOMLParse(), RegisterTOMLStringify()}
+
+	result := runGojqQuery(t, `toml_parse | [.package.name, .dependencies.serde.features[0], .bin[0].path, .package.published]`, cargoManifest, options...)
+	got, ok := result.([]any)
+	if !ok || len(got) != 4 {
+		t.Fatalf("Expected 4 results, got %v", result)
+	}
+	want := []any{"demo", "derive", "src/main.rs", "1979-05-27T07:32:00Z"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Result %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+
+	// Integers must come back as jq numbers usable in arithmetic
+	result = runGojqQuery(t, `toml_parse | .a + 1`, "a = 41", options...)
+	if result != 42 {
+		t.Errorf("Expected 42, got %v (%T)", result, result)
+	}
+}
+
+func TestTOMLParseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Cargo.toml")
+	if err := os.WriteFile(path, []byte(cargoManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runGojqQuery(t, `toml_parse(true) | .package.version`, path, RegisterTOMLParse())
+	if result != "0.1.0" {
+		t.Errorf("Expected 0.1.0, got %v", result)
+	}
+
+	result = runGojqQuery(t, `toml_parse("`+path+`"; true) | .dependencies.tokio`, nil, RegisterTOMLParse())
+	if result != "1" {
+		t.Errorf("Expected 1, got %v", result)
+	}
+}
+
+func TestTOMLParseErrors(t *testing.T) {
+	result := runGojqQuery(t, `toml_parse`, "key = ", RegisterTOMLParse())
+	errStr := common.GetUDFError(result)
+	if !strings.Contains(errStr, "invalid TOML") {
+		t.Errorf("Expected invalid TOML error, got %v", result)
+	}
+
+	result = runGojqQuery(t, `toml_parse(true)`, "/nonexistent/file.toml", RegisterTOMLParse())
+	errStr = common.GetUDFError(result)
+	if !strings.Contains(errStr, "does not exist") {
+		t.Errorf("Expected missing file error, got %v", result)
+	}
+}
+
+func TestTOMLStringify(t *testing.T) {
+	options := []gojq.CompilerOption{RegisterTOMLParse(), RegisterTOMLStringify()}
+
+	result := runGojqQuery(t, `{tool: {poetry: {name: "demo", version: "1.0"}}, deps: ["a", "b"]} | toml_stringify`, nil, options...)
+	resultMap := result.(map[string]any)
+	out, ok := resultMap["_val"].(string)
+	if !ok {
+		t.Fatalf("Expected string _val, got %v", result)
+	}
+	if !strings.Contains(out, "[tool.poetry]") || !strings.Contains(out, "name = 'demo'") {
+		t.Errorf("Unexpected TOML output:\n%s", out)
+	}
+	meta := resultMap["_meta"].(map[string]any)
+	if meta["operation"] != "toml_stringify" || meta["output_length"] != len(out) {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+
+	// Round trip through both functions
+	result = runGojqQuery(t, `toml_parse | .package.version = "0.2.0" | toml_stringify | ._val | toml_parse | .package.version`, cargoManifest, options...)
+	if result != "0.2.0" {
+		t.Errorf("Expected round-tripped version 0.2.0, got %v", result)
+	}
+
+	result = runGojqQuery(t, `[1, 2] | toml_stringify`, nil, options...)
+	errStr := common.GetUDFError(result)
+	if !strings.Contains(errStr, "must be an object") {
+		t.Errorf("Expected error for non-object input, got %v", result)
+	}
+}
+
+func TestTOMLStringifyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"server": {"port": 8080, "ratio": 0.5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runGojqQuery(t, `toml_stringify(true)`, path, RegisterTOMLStringify())
+	resultMap := result.(map[string]any)
+	out, _ := resultMap["_val"].(string)
+	if !strings.Contains(out, "[server]") || !strings.Contains(out, "port = 8080\n") || !strings.Contains(out, "ratio = 0.5") {
+		t.Errorf("Unexpected TOML output:\n%s", out)
+	}
+	if resultMap["_meta"].(map[string]any)["file_path"] == nil {
+		t.Error("Expected file_path in metadata")
+	}
+}
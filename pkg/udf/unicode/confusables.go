@@ -0,0 +1,209 @@
+package unicode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	"golang.org/x/text/unicode/norm"
+)
+
+// lookalikes maps characters to the ASCII they are easily mistaken for.
+// Fullwidth and mathematical letters are not listed; NFKC already maps them
+var lookalikes = map[rune]string{}
+
+func init() {
+	pairs := []string{
+		// Cyrillic
+		"аa", "еe", "оo", "рp", "сc", "уy", "хx", "ѕs", "іi", "јj", "ԁd", "ԛq", "ԝw", "һh", "ӏl", "үy", "ѵv",
+		"АA", "ВB", "ЕE", "КK", "МM", "НH", "ОO", "РP", "СC", "ТT", "ХX", "УY", "ЅS", "ІI", "ЈJ", "ԚQ", "ԜW", "ҮY", "Ӏl",
+		// Greek
+		"οo", "αa", "νv", "ρp", "ιi", "κk", "υu", "χx", "γy", "ϲc", "ϳj",
+		"ΑA", "ΒB", "ΕE", "ΖZ", "ΗH", "ΙI", "ΚK", "ΜM", "ΝN", "ΟO", "ΡP", "ΤT", "ΥY", "ΧX", "ϹC",
+		// Armenian
+		"օo", "սu", "ցg", "հh", "ոn", "ՏS", "ՕO", "ՍU", "ԼL",
+		// Cherokee
+		"ᎪA", "ᎬE", "ᎻH", "ᎫJ", "ᏦK", "ᎷM", "ᏢP", "ᏚS", "ᎢT", "ᏔW", "ᏃZ", "ᏟC", "ᏀG", "ᎠD",
+		// Latin letters from other alphabets
+		"ɑa", "ɡg", "ıi", "ɩi", "ǀl", "ǃ!",
+		// Punctuation
+		"‐-", "‑-", "‒-", "–-", "—-", "−-", "‘'", "’'", "‚'", "′'", "“\"", "”\"", "″\"", "⁄/", "∕/", "∶:", "․.",
+	}
+	for _, p := range pairs {
+		r, size := utf8.DecodeRuneInString(p)
+		lookalikes[r] = p[size:]
+	}
+}
+
+// bidiControls are the formatting characters that reorder text, as used to
+// make source code display differently from how it compiles
+var bidiControls = map[rune]bool{
+	0x061C: true, 0x200E: true, 0x200F: true,
+	0x202A: true, 0x202B: true, 0x202C: true, 0x202D: true, 0x202E: true,
+	0x2066: true, 0x2067: true, 0x2068: true, 0x2069: true,
+}
+
+// invisibleKind reports whether r renders as nothing, and whether it is a
+// bidi control or another invisible character
+func invisibleKind(r rune) (string, bool) {
+	switch {
+	case bidiControls[r]:
+		return "bidi", true
+	case unicode.Is(unicode.Cf, r):
+		return "invisible", true
+	case r == 0x034F, r == 0x115F, r == 0x1160, r == 0x3164, r == 0xFFA0:
+		// Combining grapheme joiner and the Hangul fillers show as blanks
+		return "invisible", true
+	}
+	return "", false
+}
+
+// Skeleton maps s to a form where strings that look alike are equal, in
+// the spirit of UTS #39: compatibility characters are normalized, lookalike
+// letters replaced by the ASCII they resemble, and invisible characters
+// dropped
+func Skeleton(s string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFKC.String(s) {
+		if _, ok := invisibleKind(r); ok {
+			continue
+		}
+		if ascii, ok := lookalikes[r]; ok {
+			sb.WriteString(ascii)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// singleScriptSets are the combinations of scripts that are normally
+// written together (UTS #39 "highly restrictive")
+var singleScriptSets = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Hangul"},
+	{"Latin", "Han", "Bopomofo"},
+}
+
+func mixedScript(scripts []string) bool {
+	if len(scripts) <= 1 {
+		return false
+	}
+	for _, set := range singleScriptSets {
+		all := true
+		for _, s := range scripts {
+			if !containsString(set, s) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// Inspect reports the scripts, invisible characters and lookalike
+// characters of s
+func Inspect(s string) map[string]any {
+	scriptSet := map[string]bool{}
+	invisible := []any{}
+	confusables := []any{}
+	letters := 0 // confusables that are letters, not punctuation
+	offset := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			if script := Script(r); script != "Common" && script != "Inherited" {
+				scriptSet[script] = true
+			}
+		}
+		if kind, ok := invisibleKind(r); ok {
+			invisible = append(invisible, map[string]any{
+				"offset":    offset,
+				"codepoint": fmt.Sprintf("U+%04X", r),
+				"name":      Name(r),
+				"kind":      kind,
+			})
+		} else if r >= 0x80 {
+			if skel := Skeleton(string(r)); skel != string(r) && isASCII(skel) {
+				confusables = append(confusables, map[string]any{
+					"offset":     offset,
+					"char":       string(r),
+					"codepoint":  fmt.Sprintf("U+%04X", r),
+					"name":       Name(r),
+					"looks_like": skel,
+				})
+				if unicode.IsLetter(r) {
+					letters++
+				}
+			}
+		}
+		offset++
+	}
+
+	scripts := make([]string, 0, len(scriptSet))
+	for script := range scriptSet {
+		scripts = append(scripts, script)
+	}
+	sort.Strings(scripts)
+	scriptList := make([]any, len(scripts))
+	for i, script := range scripts {
+		scriptList[i] = script
+	}
+
+	skeleton := Skeleton(s)
+	mixed := mixedScript(scripts)
+	// Text that is not ASCII but can pass for it is spoofing ASCII
+	// wholesale, like a Cyrillic "раураl". Curly quotes alone are not
+	passesForASCII := isASCII(skeleton) && letters > 0
+	return map[string]any{
+		"skeleton":     skeleton,
+		"scripts":      scriptList,
+		"mixed_script": mixed,
+		"invisible":    invisible,
+		"confusables":  confusables,
+		"suspicious":   mixed || len(invisible) > 0 || passesForASCII,
+	}
+}
+
+// RegisterUnicodeInspect registers the unicode_inspect function with gojq
+func RegisterUnicodeInspect() gojq.CompilerOption {
+	return common.WithFunction("unicode_inspect", 0, 1, func(v any, args []any) any {
+		input, err := inputString("unicode_inspect", v, args, 0)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		result := Inspect(input)
+		meta := map[string]any{
+			"operation":   "unicode_inspect",
+			"suspicious":  result["suspicious"],
+			"invisible":   len(result["invisible"].([]any)),
+			"confusables": len(result["confusables"].([]any)),
+		}
+		return common.MakeUDFSuccessResult(result, meta)
+	})
+}
@@ -0,0 +1,170 @@
+package unicode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/unicode/runenames"
+)
+
+// inputString reads the string the functions work on: the argument at
+// index i if present, otherwise the pipeline value
+func inputString(name string, v any, args []any, i int) (string, error) {
+	inputVal := v
+	if len(args) > i {
+		inputVal = args[i]
+	}
+	switch val := common.ExtractUDFValue(inputVal).(type) {
+	case string:
+		return val, nil
+	case []byte:
+		return string(val), nil
+	default:
+		if str, ok := val.(fmt.Stringer); ok {
+			return str.String(), nil
+		}
+		return "", common.Errorf(common.CodeInvalid, "%v: input must be a string, got %T", name, val)
+	}
+}
+
+// forms maps normalization form names to their implementations
+var forms = map[string]norm.Form{
+	"NFC":  norm.NFC,
+	"NFD":  norm.NFD,
+	"NFKC": norm.NFKC,
+	"NFKD": norm.NFKD,
+}
+
+// Name returns the Unicode name of r. Ideographs and Hangul syllables,
+// which the name tables leave out, get the names derived for them by the
+// standard
+func Name(r rune) string {
+	name := runenames.Name(r)
+	switch name {
+	case "<CJK Ideograph>", "<CJK Ideograph Extension A>", "<CJK Ideograph Extension B>":
+		return fmt.Sprintf("CJK UNIFIED IDEOGRAPH-%04X", r)
+	case "<Hangul Syllable>":
+		return hangulName(r)
+	}
+	return name
+}
+
+// Jamo short names for the Hangul syllable name algorithm
+var (
+	jamoL = []string{"G", "GG", "N", "D", "DD", "R", "M", "B", "BB", "S", "SS", "", "J", "JJ", "C", "K", "T", "P", "H"}
+	jamoV = []string{"A", "AE", "YA", "YAE", "EO", "E", "YEO", "YE", "O", "WA", "WAE", "OE", "YO", "U", "WEO", "WE", "WI", "YU", "EU", "YI", "I"}
+	jamoT = []string{"", "G", "GG", "GS", "N", "NJ", "NH", "D", "L", "LG", "LM", "LB", "LS", "LT", "LP", "LH", "M", "B", "BS", "S", "SS", "NG", "J", "C", "K", "T", "P", "H"}
+)
+
+func hangulName(r rune) string {
+	s := int(r - 0xAC00)
+	l, v, t := s/(21*28), s%(21*28)/28, s%28
+	return "HANGUL SYLLABLE " + jamoL[l] + jamoV[v] + jamoT[t]
+}
+
+// Category returns the two-letter general category of r, such as "Lu"
+func Category(r rune) string {
+	for _, name := range categoryNames {
+		if unicode.Is(unicode.Categories[name], r) {
+			return name
+		}
+	}
+	return "Cn"
+}
+
+// Script returns the script of r, such as "Latin", or "Unknown"
+func Script(r rune) string {
+	// The common cases first; there are over a hundred scripts
+	for _, name := range []string{"Latin", "Common", "Inherited"} {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return name
+		}
+	}
+	for _, name := range scriptNames {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return name
+		}
+	}
+	return "Unknown"
+}
+
+var categoryNames, scriptNames []string
+
+func init() {
+	for name := range unicode.Categories {
+		// LC groups Lu, Ll and Lt
+		if len(name) == 2 && name != "LC" {
+			categoryNames = append(categoryNames, name)
+		}
+	}
+	sort.Strings(categoryNames)
+	for name := range unicode.Scripts {
+		scriptNames = append(scriptNames, name)
+	}
+	sort.Strings(scriptNames)
+}
+
+// RegisterUnicodeNormalize registers the unicode_normalize function with gojq
+func RegisterUnicodeNormalize() gojq.CompilerOption {
+	return common.WithFunction("unicode_normalize", 1, 2, func(v any, args []any) any {
+		formName, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "unicode_normalize: form must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		form, ok := forms[strings.ToUpper(formName)]
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "unicode_normalize: unknown form %q (supported: NFC, NFD, NFKC, NFKD)", formName), nil)
+		}
+		input, err := inputString("unicode_normalize", v, args, 1)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		result := form.String(input)
+		meta := map[string]any{
+			"operation":     "unicode_normalize",
+			"form":          strings.ToUpper(formName),
+			"changed":       result != input,
+			"input_length":  utf8.RuneCountInString(input),
+			"output_length": utf8.RuneCountInString(result),
+		}
+		return common.MakeUDFSuccessResult(result, meta)
+	})
+}
+
+// RegisterUnicodeNames registers the unicode_names function with gojq
+func RegisterUnicodeNames() gojq.CompilerOption {
+	return common.WithFunction("unicode_names", 0, 1, func(v any, args []any) any {
+		input, err := inputString("unicode_names", v, args, 0)
+		if err != nil {
+			return common.MakeUDFErrorResult(err, nil)
+		}
+
+		chars := []any{}
+		offset := 0
+		// Bytes that are not UTF-8 are reported as U+FFFD
+		for _, r := range input {
+			chars = append(chars, map[string]any{
+				"offset":    offset,
+				"char":      string(r),
+				"codepoint": fmt.Sprintf("U+%04X", r),
+				"name":      Name(r),
+				"category":  Category(r),
+				"script":    Script(r),
+			})
+			offset++
+		}
+
+		meta := map[string]any{
+			"operation": "unicode_names",
+			"count":     len(chars),
+		}
+		return common.MakeUDFSuccessResult(chars, meta)
+	})
+}
@@ -0,0 +1,164 @@
+package unicode
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+var unicodeOpts = []gojq.CompilerOption{RegisterUnicodeNormalize(), RegisterUnicodeNames(), RegisterUnicodeInspect()}
+
+func TestUnicodeNormalize(t *testing.T) {
+	tests := []struct {
+		query string
+		input string
+		want  any
+	}{
+		{`unicode_normalize("NFC") | ._val`, "café", "café"},
+		{`unicode_normalize("nfd") | ._val | length`, "café", 5},
+		{`unicode_normalize("NFKC") | ._val`, "ｆｉｌｅ①", "file1"},
+		{`unicode_normalize("NFKD") | ._val`, "ﬁ", "fi"},
+		{`unicode_normalize("NFC"; "é") | ._val`, "", "é"},
+		{`unicode_normalize("NFC") | ._meta.changed`, "plain", false},
+		{`unicode_normalize("NFC") | ._meta | [.input_length, .output_length]`, "café", []any{5, 4}},
+	}
+	for _, tt := range tests {
+		got := runGojqQuery(t, tt.query, tt.input, unicodeOpts...)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s on %q = %v, want %v", tt.query, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestUnicodeNames(t *testing.T) {
+	result := runGojqQuery(t, `unicode_names | ._val`, "Aа\u200B中가😀", unicodeOpts...)
+	chars := result.([]any)
+	want := []map[string]any{
+		{"offset": 0, "char": "A", "codepoint": "U+0041", "name": "LATIN CAPITAL LETTER A", "category": "Lu", "script": "Latin"},
+		{"offset": 1, "char": "а", "codepoint": "U+0430", "name": "CYRILLIC SMALL LETTER A", "category": "Ll", "script": "Cyrillic"},
+		{"offset": 2, "char": "\u200B", "codepoint": "U+200B", "name": "ZERO WIDTH SPACE", "category": "Cf", "script": "Common"},
+		{"offset": 3, "char": "中", "codepoint": "U+4E2D", "name": "CJK UNIFIED IDEOGRAPH-4E2D", "category": "Lo", "script": "Han"},
+		{"offset": 4, "char": "가", "codepoint": "U+AC00", "name": "HANGUL SYLLABLE GA", "category": "Lo", "script": "Hangul"},
+		{"offset": 5, "char": "😀", "codepoint": "U+1F600", "name": "GRINNING FACE", "category": "So", "script": "Common"},
+	}
+	if len(chars) != len(want) {
+		t.Fatalf("Expected %d characters, got %v", len(want), chars)
+	}
+	for i, w := range want {
+		if !reflect.DeepEqual(chars[i], map[string]any(w)) {
+			t.Errorf("Character %d = %v, want %v", i, chars[i], w)
+		}
+	}
+
+	if name := Name('힣'); name != "HANGUL SYLLABLE HIH" {
+		t.Errorf("Name(힣) = %q", name)
+	}
+}
+
+func TestUnicodeInspect(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		skeleton   string
+		scripts    []any
+		mixed      bool
+		invisible  int
+		confusable int
+		suspicious bool
+	}{
+		{"ascii", "paypal.com", "paypal.com", []any{"Latin"}, false, 0, 0, false},
+		{"mixed script", "pаypal.com", "paypal.com", []any{"Cyrillic", "Latin"}, true, 0, 1, true},
+		{"whole script", "раураӏ", "paypal", []any{"Cyrillic"}, false, 0, 6, true},
+		{"russian", "привет", "пpивeт", []any{"Cyrillic"}, false, 0, 2, false},
+		{"zero width", "admin\u200B", "admin", []any{"Latin"}, false, 1, 0, true},
+		{"bidi override", "access\u202E \u2066level", "access level", []any{"Latin"}, false, 2, 0, true},
+		{"fullwidth", "ａｄｍｉｎ", "admin", []any{"Latin"}, false, 0, 5, true},
+		{"japanese", "東京タワーへ", "東京タワーへ", []any{"Han", "Hiragana", "Katakana"}, false, 0, 0, false},
+		{"curly quotes", "it’s “fine”", "it's \"fine\"", []any{"Latin"}, false, 0, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Inspect(tt.input)
+			if got["skeleton"] != tt.skeleton {
+				t.Errorf("skeleton = %q, want %q", got["skeleton"], tt.skeleton)
+			}
+			if !reflect.DeepEqual(got["scripts"], tt.scripts) {
+				t.Errorf("scripts = %v, want %v", got["scripts"], tt.scripts)
+			}
+			if got["mixed_script"] != tt.mixed {
+				t.Errorf("mixed_script = %v, want %v", got["mixed_script"], tt.mixed)
+			}
+			if n := len(got["invisible"].([]any)); n != tt.invisible {
+				t.Errorf("invisible = %v, want %d entries", got["invisible"], tt.invisible)
+			}
+			if n := len(got["confusables"].([]any)); n != tt.confusable {
+				t.Errorf("confusables = %v, want %d entries", got["confusables"], tt.confusable)
+			}
+			if got["suspicious"] != tt.suspicious {
+				t.Errorf("suspicious = %v, want %v", got["suspicious"], tt.suspicious)
+			}
+		})
+	}
+
+	result := runGojqQuery(t, `unicode_inspect | [._val.confusables[0], ._val.invisible[0], ._meta.suspicious]`, "pаy\u202E", unicodeOpts...)
+	want := []any{
+		map[string]any{"offset": 1, "char": "а", "codepoint": "U+0430", "name": "CYRILLIC SMALL LETTER A", "looks_like": "a"},
+		map[string]any{"offset": 3, "codepoint": "U+202E", "name": "RIGHT-TO-LEFT OVERRIDE", "kind": "bidi"},
+		true,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("unicode_inspect = %v, want %v", result, want)
+	}
+}
+
+func TestUnicodeErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`unicode_normalize("NFX")`, "a", `unicode_normalize: unknown form "NFX"`},
+		{`unicode_normalize(1)`, "a", "unicode_normalize: form must be a string"},
+		{`unicode_normalize("NFC")`, 1, "unicode_normalize: input must be a string"},
+		{`unicode_names`, nil, "unicode_names: input must be a string"},
+		{`unicode_inspect([])`, "a", "unicode_inspect: input must be a string"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, unicodeOpts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
@@ -10,10 +10,10 @@ import (
 
 // RegisterURLEncode registers the url_encode function with gojq
 func RegisterURLEncode() gojq.CompilerOption {
-	return gojq.WithFunction("url_encode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("url_encode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("url_encode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("url_encode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -25,7 +25,7 @@ func RegisterURLEncode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("url_encode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "url_encode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -33,7 +33,7 @@ func RegisterURLEncode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "url_encode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("url_encode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("url_encode: %w", err), meta)
 			}
 
 			input = string(fileData)
@@ -49,7 +49,7 @@ func RegisterURLEncode() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("url_encode: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "url_encode: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -73,10 +73,10 @@ func RegisterURLEncode() gojq.CompilerOption {
 
 // RegisterURLDecode registers the url_decode function with gojq
 func RegisterURLDecode() gojq.CompilerOption {
-	return gojq.WithFunction("url_decode", 0, 2, func(v any, args []any) any {
+	return common.WithFunction("url_decode", 0, 2, func(v any, args []any) any {
 		inputVal, isFile, err := common.ParseFileArgs(v, args)
 		if err != nil {
-			return common.MakeUDFErrorResult(fmt.Errorf("url_decode: %v", err), nil)
+			return common.MakeUDFErrorResult(fmt.Errorf("url_decode: %w", err), nil)
 		}
 
 		inputVal = common.ExtractUDFValue(inputVal)
@@ -88,7 +88,7 @@ func RegisterURLDecode() gojq.CompilerOption {
 		if isFile {
 			filePathStr, ok := inputVal.(string)
 			if !ok {
-				return common.MakeUDFErrorResult(fmt.Errorf("url_decode: file argument requires string path, got %T", inputVal), nil)
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "url_decode: file argument requires string path, got %T", inputVal), nil)
 			}
 
 			fileData, absPath, size, err := common.ReadFileFromPath(filePathStr)
@@ -96,7 +96,7 @@ func RegisterURLDecode() gojq.CompilerOption {
 				meta := map[string]any{
 					"operation": "url_decode",
 				}
-				return common.MakeUDFErrorResult(fmt.Errorf("url_decode: %v", err), meta)
+				return common.MakeUDFErrorResult(fmt.Errorf("url_decode: %w", err), meta)
 			}
 
 			input = string(fileData)
@@ -112,7 +112,7 @@ func RegisterURLDecode() gojq.CompilerOption {
 				if str, ok := val.(fmt.Stringer); ok {
 					input = str.String()
 				} else {
-					return common.MakeUDFErrorResult(fmt.Errorf("url_decode: argument must be a string, got %T", val), nil)
+					return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "url_decode: argument must be a string, got %T", val), nil)
 				}
 			}
 		}
@@ -128,7 +128,7 @@ func RegisterURLDecode() gojq.CompilerOption {
 			} else {
 				meta["original_length"] = len(input)
 			}
-			return common.MakeUDFErrorResult(fmt.Errorf("url_decode: invalid URL-encoded string: %v", err), meta)
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "url_decode: invalid URL-encoded string: %w", err), meta)
 		}
 
 		meta := map[string]any{
@@ -0,0 +1,134 @@
+package uuid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// crockford is the Crockford base32 alphabet ULIDs are written in
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID is a 128-bit ULID: a 48-bit Unix time in milliseconds, then 80
+// random bits
+type ULID [16]byte
+
+// NewULID returns a ULID of the time t
+func NewULID(t time.Time) (ULID, error) {
+	var u ULID
+	if _, err := rand.Read(u[6:]); err != nil {
+		return u, err
+	}
+	ms := uint64(t.UnixMilli())
+	u[0], u[1], u[2], u[3], u[4], u[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+	return u, nil
+}
+
+// String writes u as 26 Crockford base32 characters
+func (u ULID) String() string {
+	var out [26]byte
+	// 26 characters hold 130 bits; the first only has the top 3 bits
+	var acc uint32
+	bits, i := 2, 0
+	for _, b := range u {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[i] = crockford[acc>>bits&0x1f]
+			i++
+		}
+	}
+	return string(out[:])
+}
+
+// ParseULID reads a ULID; as in Crockford base32, it is case-insensitive,
+// I and L read as 1 and O as 0
+func ParseULID(s string) (ULID, error) {
+	var u ULID
+	t := strings.ToUpper(strings.TrimSpace(s))
+	if len(t) != 26 {
+		return u, common.Errorf(common.CodeInvalid, "invalid ULID %q: must be 26 characters", s)
+	}
+	if t[0] > '7' {
+		return u, common.Errorf(common.CodeInvalid, "invalid ULID %q: timestamp overflows 48 bits", s)
+	}
+	var acc uint32
+	bits, j := -2, 0
+	for i := 0; i < len(t); i++ {
+		c := t[i]
+		switch c {
+		case 'I', 'L':
+			c = '1'
+		case 'O':
+			c = '0'
+		}
+		d := strings.IndexByte(crockford, c)
+		if d < 0 {
+			return u, common.Errorf(common.CodeInvalid, "invalid ULID %q: bad character %q", s, t[i])
+		}
+		acc = acc<<5 | uint32(d)
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			u[j] = byte(acc >> bits)
+			j++
+		}
+	}
+	return u, nil
+}
+
+// Time is the time of u
+func (u ULID) Time() time.Time {
+	ms := uint64(u[0])<<40 | uint64(u[1])<<32 | uint64(u[2])<<24 | uint64(u[3])<<16 | uint64(u[4])<<8 | uint64(u[5])
+	return time.UnixMilli(int64(ms)).UTC()
+}
+
+// RegisterULID registers the ulid function with gojq
+func RegisterULID() gojq.CompilerOption {
+	return common.WithFunction("ulid", 0, 0, func(v any, args []any) any {
+		now := time.Now()
+		u, err := NewULID(now)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("ulid: %w", err), nil)
+		}
+		return common.MakeUDFSuccessResult(u.String(), map[string]any{
+			"operation": "ulid",
+			"time":      u.Time().Format(time.RFC3339Nano),
+		})
+	})
+}
+
+// RegisterULIDParse registers the ulid_parse function with gojq
+func RegisterULIDParse() gojq.CompilerOption {
+	return common.WithFunction("ulid_parse", 0, 1, func(v any, args []any) any {
+		inputVal := v
+		if len(args) > 0 {
+			inputVal = args[0]
+		}
+		s, ok := common.ExtractUDFValue(inputVal).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "ulid_parse: input must be a string, got %T", common.ExtractUDFValue(inputVal)), nil)
+		}
+		u, err := ParseULID(s)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("ulid_parse: %w", err), nil)
+		}
+		t := u.Time()
+		return common.MakeUDFSuccessResult(map[string]any{
+			"ulid":         u.String(),
+			"time":         t.Format(time.RFC3339Nano),
+			"timestamp_ms": int(t.UnixMilli()),
+			"randomness":   hex.EncodeToString(u[6:]),
+			"uuid":         UUID(u).String(),
+		}, map[string]any{
+			"operation": "ulid_parse",
+			"input":     s,
+		})
+	})
+}
@@ -0,0 +1,217 @@
+package uuid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// UUID is a 128-bit UUID
+type UUID [16]byte
+
+// gregorianOffset is the number of 100ns intervals between the start of the
+// Gregorian calendar, which v1 and v6 timestamps count from, and 1970
+const gregorianOffset = 122192928000000000
+
+// NewV4 returns a random UUID
+func NewV4() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return u, err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u, nil
+}
+
+// NewV7 returns a UUID of the Unix time t in milliseconds, with the rest
+// of the millisecond in the 12 bits after the version so UUIDs made in the
+// same millisecond still sort by time, and random bits
+func NewV7(t time.Time) (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return u, err
+	}
+	ms := uint64(t.UnixMilli())
+	sub := uint16(int64(t.Nanosecond()%1e6) * 4096 / 1e6)
+	u[0], u[1], u[2], u[3], u[4], u[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+	binary.BigEndian.PutUint16(u[6:], 0x7000|sub)
+	u[8] = u[8]&0x3f | 0x80
+	return u, nil
+}
+
+// Parse reads a UUID in canonical form, without hyphens, in braces, or as
+// a urn:uuid: URN
+func Parse(s string) (UUID, error) {
+	var u UUID
+	t := strings.TrimSpace(s)
+	if len(t) >= 9 && strings.EqualFold(t[:9], "urn:uuid:") {
+		t = t[9:]
+	} else if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+		t = t[1 : len(t)-1]
+	}
+	if len(t) == 36 {
+		if t[8] != '-' || t[13] != '-' || t[18] != '-' || t[23] != '-' {
+			return u, common.Errorf(common.CodeInvalid, "invalid UUID %q", s)
+		}
+		t = t[:8] + t[9:13] + t[14:18] + t[19:23] + t[24:]
+	}
+	if len(t) != 32 {
+		return u, common.Errorf(common.CodeInvalid, "invalid UUID %q", s)
+	}
+	if _, err := hex.Decode(u[:], []byte(t)); err != nil {
+		return u, common.Errorf(common.CodeInvalid, "invalid UUID %q", s)
+	}
+	return u, nil
+}
+
+// String formats u in canonical lowercase form
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// Version is the version in the high bits of byte 6
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// Variant names the layout of the UUID from the high bits of byte 8
+func (u UUID) Variant() string {
+	switch {
+	case u[8]&0x80 == 0:
+		return "NCS"
+	case u[8]&0xc0 == 0x80:
+		return "RFC 9562"
+	case u[8]&0xe0 == 0xc0:
+		return "Microsoft"
+	}
+	return "future"
+}
+
+// Time returns the time embedded in v1, v6 and v7 UUIDs
+func (u UUID) Time() (time.Time, bool) {
+	if u.Variant() != "RFC 9562" {
+		return time.Time{}, false
+	}
+	switch u.Version() {
+	case 1:
+		low := uint64(binary.BigEndian.Uint32(u[0:4]))
+		mid := uint64(binary.BigEndian.Uint16(u[4:6]))
+		high := uint64(binary.BigEndian.Uint16(u[6:8]) & 0x0fff)
+		return gregorianTime(high<<48 | mid<<32 | low), true
+	case 6:
+		high := uint64(binary.BigEndian.Uint32(u[0:4]))
+		mid := uint64(binary.BigEndian.Uint16(u[4:6]))
+		low := uint64(binary.BigEndian.Uint16(u[6:8]) & 0x0fff)
+		return gregorianTime(high<<28 | mid<<12 | low), true
+	case 7:
+		ms := binary.BigEndian.Uint64(u[0:8]) >> 16
+		return time.UnixMilli(int64(ms)).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+func gregorianTime(ticks uint64) time.Time {
+	unix := int64(ticks) - gregorianOffset
+	return time.Unix(unix/1e7, unix%1e7*100).UTC()
+}
+
+// Fields describes u: its version, variant and, where they are encoded,
+// time, clock sequence and node
+func (u UUID) Fields() map[string]any {
+	fields := map[string]any{
+		"uuid":    u.String(),
+		"version": u.Version(),
+		"variant": u.Variant(),
+		"nil":     u == UUID{},
+		"max":     u == UUID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"time":    nil,
+	}
+	if t, ok := u.Time(); ok {
+		fields["time"] = t.Format(time.RFC3339Nano)
+		fields["timestamp"] = float64(t.UnixNano()) / 1e9
+	}
+	if v := u.Version(); (v == 1 || v == 6) && u.Variant() == "RFC 9562" {
+		fields["clock_sequence"] = int(binary.BigEndian.Uint16(u[8:10]) & 0x3fff)
+		node := hex.EncodeToString(u[10:])
+		fields["node"] = node[0:2] + ":" + node[2:4] + ":" + node[4:6] + ":" + node[6:8] + ":" + node[8:10] + ":" + node[10:12]
+	}
+	return fields
+}
+
+// RegisterUUID registers the uuid function with gojq
+func RegisterUUID() gojq.CompilerOption {
+	return common.WithFunction("uuid", 0, 1, func(v any, args []any) any {
+		// uuid makes a v4 UUID, uuid(7) or uuid("v7") a time-ordered v7 one
+		version := 4
+		if len(args) > 0 {
+			switch val := common.ExtractUDFValue(args[0]).(type) {
+			case int:
+				version = val
+			case float64:
+				if val != math.Trunc(val) {
+					version = -1
+				} else {
+					version = int(val)
+				}
+			case string:
+				n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(val), "v"))
+				if err != nil {
+					n = -1
+				}
+				version = n
+			default:
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "uuid: version must be 4 or 7, got %T", val), nil)
+			}
+		}
+
+		var u UUID
+		var err error
+		switch version {
+		case 4:
+			u, err = NewV4()
+		case 7:
+			u, err = NewV7(time.Now())
+		default:
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "uuid: version must be 4 or 7, got %v", common.ExtractUDFValue(args[0])), nil)
+		}
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("uuid: %w", err), nil)
+		}
+		return common.MakeUDFSuccessResult(u.String(), map[string]any{
+			"operation": "uuid",
+			"version":   version,
+		})
+	})
+}
+
+// RegisterUUIDParse registers the uuid_parse function with gojq
+func RegisterUUIDParse() gojq.CompilerOption {
+	return common.WithFunction("uuid_parse", 0, 1, func(v any, args []any) any {
+		inputVal := v
+		if len(args) > 0 {
+			inputVal = args[0]
+		}
+		s, ok := common.ExtractUDFValue(inputVal).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "uuid_parse: input must be a string, got %T", common.ExtractUDFValue(inputVal)), nil)
+		}
+		u, err := Parse(s)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("uuid_parse: %w", err), nil)
+		}
+		return common.MakeUDFSuccessResult(u.Fields(), map[string]any{
+			"operation": "uuid_parse",
+			"input":     s,
+		})
+	})
+}
@@ -0,0 +1,177 @@
+package uuid
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+var idOpts = []gojq.CompilerOption{RegisterUUID(), RegisterUUIDParse(), RegisterULID(), RegisterULIDParse()}
+
+var canonical = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+func TestUUIDGenerate(t *testing.T) {
+	for _, tt := range []struct {
+		query   string
+		version int
+	}{{`uuid`, 4}, {`uuid(4)`, 4}, {`uuid(7)`, 7}, {`uuid("v7")`, 7}, {`uuid("7")`, 7}, {`uuid("V4")`, 4}} {
+		s := runGojqQuery(t, tt.query+" | ._val", nil, idOpts...).(string)
+		if !canonical.MatchString(s) {
+			t.Fatalf("%s = %q, not canonical", tt.query, s)
+		}
+		u, _ := Parse(s)
+		if u.Version() != tt.version || u.Variant() != "RFC 9562" {
+			t.Errorf("%s = %q: version %d, variant %s", tt.query, s, u.Version(), u.Variant())
+		}
+	}
+
+	before := time.Now().Add(-time.Millisecond)
+	u, _ := NewV7(time.Now())
+	ts, ok := u.Time()
+	if !ok || ts.Before(before.Truncate(time.Millisecond)) || ts.After(time.Now()) {
+		t.Errorf("v7 time = %v, want about now", ts)
+	}
+
+	// v7 UUIDs sort by time, even within a millisecond
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	a, _ := NewV7(base.Add(100 * time.Microsecond))
+	b, _ := NewV7(base.Add(600 * time.Microsecond))
+	if a.String() >= b.String() {
+		t.Errorf("v7 UUIDs out of order: %s >= %s", a, b)
+	}
+}
+
+func TestUUIDParse(t *testing.T) {
+	// Test vectors from RFC 9562
+	tests := []struct {
+		input string
+		want  map[string]any
+	}{
+		{"C232AB00-9414-11EC-B3C8-9F6BDECED846", map[string]any{
+			"uuid": "c232ab00-9414-11ec-b3c8-9f6bdeced846", "version": 1, "variant": "RFC 9562", "nil": false, "max": false,
+			"time": "2022-02-22T19:22:22Z", "timestamp": 1645557742.0, "clock_sequence": 0x33c8, "node": "9f:6b:de:ce:d8:46",
+		}},
+		{"urn:uuid:1ec9414c-232a-6b00-b3c8-9f6bdeced846", map[string]any{
+			"uuid": "1ec9414c-232a-6b00-b3c8-9f6bdeced846", "version": 6, "variant": "RFC 9562", "nil": false, "max": false,
+			"time": "2022-02-22T19:22:22Z", "timestamp": 1645557742.0, "clock_sequence": 0x33c8, "node": "9f:6b:de:ce:d8:46",
+		}},
+		{"{017f22e2-79b0-7cc3-98c4-dc0c0c07398f}", map[string]any{
+			"uuid": "017f22e2-79b0-7cc3-98c4-dc0c0c07398f", "version": 7, "variant": "RFC 9562", "nil": false, "max": false,
+			"time": "2022-02-22T19:22:22Z", "timestamp": 1645557742.0,
+		}},
+		{"919108f752d133205bacf847db4148a8", map[string]any{
+			"uuid": "919108f7-52d1-3320-5bac-f847db4148a8", "version": 3, "variant": "NCS", "nil": false, "max": false, "time": nil,
+		}},
+		{"00000000-0000-0000-0000-000000000000", map[string]any{
+			"uuid": "00000000-0000-0000-0000-000000000000", "version": 0, "variant": "NCS", "nil": true, "max": false, "time": nil,
+		}},
+	}
+	for _, tt := range tests {
+		got := runGojqQuery(t, `uuid_parse | ._val`, tt.input, idOpts...)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("uuid_parse(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+
+	got := runGojqQuery(t, `uuid(7) | uuid_parse | ._val.version`, nil, idOpts...)
+	if got != 7 {
+		t.Errorf("uuid(7) | uuid_parse version = %v", got)
+	}
+}
+
+func TestULID(t *testing.T) {
+	got := runGojqQuery(t, `ulid_parse | ._val`, "01ARZ3NDEKTSV4RRFFQ69G5FAV", idOpts...)
+	want := map[string]any{
+		"ulid":         "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+		"time":         "2016-07-30T23:54:10.259Z",
+		"timestamp_ms": 1469922850259,
+		"randomness":   "d6764c61efb99302bd5b",
+		"uuid":         "01563e3a-b5d3-d676-4c61-efb99302bd5b",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ulid_parse = %v, want %v", got, want)
+	}
+
+	// Lowercase and the ambiguous letters are accepted
+	got = runGojqQuery(t, `ulid_parse("01arz3ndektsv4rrffq69g5fav") | ._val.ulid`, nil, idOpts...)
+	if got != "01ARZ3NDEKTSV4RRFFQ69G5FAV" {
+		t.Errorf("lowercase ulid_parse = %v", got)
+	}
+	if a, _ := ParseULID("0LOI0000000000000000000000"); a.String() != "01010000000000000000000000" {
+		t.Errorf("ParseULID with I, L and O = %v", a)
+	}
+
+	s := runGojqQuery(t, `ulid | ._val`, nil, idOpts...).(string)
+	u, err := ParseULID(s)
+	if err != nil || u.String() != s {
+		t.Fatalf("ulid = %q does not round trip: %v", s, err)
+	}
+	if d := time.Since(u.Time()); d < 0 || d > time.Minute {
+		t.Errorf("ulid time = %v, want about now", u.Time())
+	}
+	max := "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"
+	if u, _ := ParseULID(max); u.String() != max {
+		t.Errorf("max ULID round trip = %s", u)
+	}
+}
+
+func TestIDErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`uuid(5)`, nil, "uuid: version must be 4 or 7, got 5"},
+		{`uuid("v5")`, nil, "uuid: version must be 4 or 7, got v5"},
+		{`uuid("seven")`, nil, "uuid: version must be 4 or 7, got seven"},
+		{`uuid(true)`, nil, "uuid: version must be 4 or 7, got bool"},
+		{`uuid_parse`, "not-a-uuid", `uuid_parse: invalid UUID "not-a-uuid"`},
+		{`uuid_parse`, "c232ab00x9414-11ec-b3c8-9f6bdeced846", "uuid_parse: invalid UUID"},
+		{`uuid_parse`, "g232ab00-9414-11ec-b3c8-9f6bdeced846", "uuid_parse: invalid UUID"},
+		{`uuid_parse`, 5, "uuid_parse: input must be a string"},
+		{`ulid_parse`, "01ARZ3NDEK", "ulid_parse: invalid ULID \"01ARZ3NDEK\": must be 26 characters"},
+		{`ulid_parse`, "81ARZ3NDEKTSV4RRFFQ69G5FAV", "ulid_parse: invalid ULID \"81ARZ3NDEKTSV4RRFFQ69G5FAV\": timestamp overflows 48 bits"},
+		{`ulid_parse`, "01ARZ3NDEKTSV4RRFFQ69G5FAU", "ulid_parse: invalid ULID \"01ARZ3NDEKTSV4RRFFQ69G5FAU\": bad character 'U'"},
+		{`ulid_parse`, nil, "ulid_parse: input must be a string"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, idOpts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
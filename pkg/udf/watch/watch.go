@@ -0,0 +1,271 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// eventName is the name watch reports for an fsnotify operation
+type eventName struct {
+	op   fsnotify.Op
+	name string
+}
+
+var eventNames = []eventName{
+	{fsnotify.Create, "create"},
+	{fsnotify.Write, "modify"},
+	{fsnotify.Remove, "delete"},
+	{fsnotify.Rename, "rename"},
+	{fsnotify.Chmod, "chmod"},
+}
+
+// Options are the limits and filters of a watch
+type Options struct {
+	Count     int           // stop after this many events, 0 for no limit
+	Duration  time.Duration // stop after this long, 0 for no limit
+	Recursive bool          // watch subdirectories, including new ones
+	Events    []string      // event names to report
+}
+
+func defaultOptions() Options {
+	// chmod is left out by default; editors and indexers touch attributes
+	// constantly
+	return Options{Events: []string{"create", "modify", "delete", "rename"}}
+}
+
+func countArg(raw any) (int, error) {
+	switch val := raw.(type) {
+	case int:
+		if val > 0 {
+			return val, nil
+		}
+	case float64:
+		if val == math.Trunc(val) && val > 0 && val <= math.MaxInt32 {
+			return int(val), nil
+		}
+	default:
+		return 0, common.Errorf(common.CodeInvalid, "count must be a number, got %T", raw)
+	}
+	return 0, common.Errorf(common.CodeInvalid, "count must be a positive integer, got %v", raw)
+}
+
+func durationArg(raw any) (time.Duration, error) {
+	switch val := raw.(type) {
+	case string:
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			return 0, common.Errorf(common.CodeInvalid, "duration must be positive, like \"30s\" or \"5m\", got %q", val)
+		}
+		return d, nil
+	case int:
+		if val > 0 {
+			return time.Duration(val) * time.Second, nil
+		}
+	case float64:
+		if val > 0 {
+			return time.Duration(val * float64(time.Second)), nil
+		}
+	default:
+		return 0, common.Errorf(common.CodeInvalid, "duration must be a string or a number of seconds, got %T", raw)
+	}
+	return 0, common.Errorf(common.CodeInvalid, "duration must be positive, got %v", raw)
+}
+
+// parseLimit reads the second argument: a count of events, a duration
+// string, or an object of options
+func parseLimit(v any) (Options, error) {
+	opts := defaultOptions()
+	var err error
+	switch val := common.ExtractUDFValue(v).(type) {
+	case int, float64:
+		opts.Count, err = countArg(val)
+	case string:
+		opts.Duration, err = durationArg(val)
+	case map[string]any:
+		for key, raw := range val {
+			switch key {
+			case "count":
+				opts.Count, err = countArg(raw)
+			case "duration":
+				opts.Duration, err = durationArg(raw)
+			case "recursive":
+				var ok bool
+				if opts.Recursive, ok = raw.(bool); !ok {
+					err = common.Errorf(common.CodeInvalid, "recursive must be a boolean, got %T", raw)
+				}
+			case "events":
+				list, ok := raw.([]any)
+				if !ok || len(list) == 0 {
+					return opts, common.Errorf(common.CodeInvalid, "options.events must be a non-empty array, got %T", raw)
+				}
+				opts.Events = nil
+				for _, e := range list {
+					name, _ := e.(string)
+					if !slices.ContainsFunc(eventNames, func(n eventName) bool { return n.name == name }) {
+						return opts, common.Errorf(common.CodeInvalid, "options.events: unknown event %v, must be create, modify, delete, rename or chmod", e)
+					}
+					opts.Events = append(opts.Events, name)
+				}
+			default:
+				return opts, common.Errorf(common.CodeInvalid, "unknown option %q", key)
+			}
+			if err != nil {
+				return opts, fmt.Errorf("options.%w", err)
+			}
+		}
+	default:
+		return opts, common.Errorf(common.CodeInvalid, "limit must be a count, a duration or an object, got %T", val)
+	}
+	return opts, err
+}
+
+// watchIter yields the events of a watcher until a limit is reached
+type watchIter struct {
+	watcher  *fsnotify.Watcher
+	root     string
+	opts     Options
+	deadline <-chan time.Time
+	ctx      context.Context
+	cancel   context.CancelFunc
+	seen     int
+	pending  []any
+	done     bool
+}
+
+func (it *watchIter) stop() {
+	it.done = true
+	it.watcher.Close()
+	it.cancel()
+}
+
+func (it *watchIter) Next() (any, bool) {
+	for !it.done || len(it.pending) > 0 {
+		if len(it.pending) > 0 {
+			ev := it.pending[0]
+			it.pending = it.pending[1:]
+			return ev, true
+		}
+		if it.opts.Count > 0 && it.seen >= it.opts.Count {
+			it.stop()
+			break
+		}
+		select {
+		case <-it.deadline:
+			it.stop()
+		case <-it.ctx.Done():
+			// The run or the call timed out: end the stream like a limit
+			it.stop()
+		case err, ok := <-it.watcher.Errors:
+			if !ok {
+				it.stop()
+				break
+			}
+			return common.MakeUDFErrorResult(fmt.Errorf("watch: %w", err), map[string]any{
+				"operation": "watch",
+				"root":      it.root,
+			}), true
+		case ev, ok := <-it.watcher.Events:
+			if !ok {
+				it.stop()
+				break
+			}
+			if it.opts.Recursive && ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					addTree(it.watcher, ev.Name)
+				}
+			}
+			// One fsnotify event can carry several operations
+			for _, n := range eventNames {
+				if !ev.Has(n.op) || !slices.Contains(it.opts.Events, n.name) {
+					continue
+				}
+				if it.opts.Count > 0 && it.seen >= it.opts.Count {
+					break
+				}
+				it.seen++
+				it.pending = append(it.pending, common.MakeUDFSuccessResult(ev.Name, map[string]any{
+					"operation": "watch",
+					"event":     n.name,
+					"root":      it.root,
+					"time":      time.Now().UTC().Format(time.RFC3339Nano),
+					"sequence":  it.seen,
+				}))
+			}
+		}
+	}
+	return nil, false
+}
+
+// addTree watches dir and every directory below it
+func addTree(w *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			return w.Add(p)
+		}
+		return nil
+	})
+}
+
+// RegisterWatch registers the watch function with gojq
+func RegisterWatch() gojq.CompilerOption {
+	return common.WithIterFunction("watch", 1, 2, common.AuditedIter("watch", func(v any, args []any) gojq.Iter {
+		// watch(path) runs until interrupted; watch(path; limit) stops
+		// after a count of events or a duration
+		p, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok || p == "" {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "watch: path must be a non-empty string, got %T", common.ExtractUDFValue(args[0])), nil))
+		}
+		opts := defaultOptions()
+		if len(args) > 1 {
+			var err error
+			if opts, err = parseLimit(args[1]); err != nil {
+				return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("watch: %w", err), nil))
+			}
+		}
+		absPath, err := common.ResolvePath(p)
+		if err == nil {
+			err = common.CheckRead(absPath)
+		}
+		if err != nil {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("watch: %w", err), nil))
+		}
+		info, err := os.Stat(absPath)
+		if err != nil {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(common.Errorf(common.CodeNotFound, "watch: path does not exist: %q", absPath), nil))
+		}
+
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("watch: %w", err), nil))
+		}
+		if opts.Recursive && info.IsDir() {
+			err = addTree(w, absPath)
+		} else {
+			err = w.Add(absPath)
+		}
+		if err != nil {
+			w.Close()
+			return gojq.NewIter[any](common.MakeUDFErrorResult(fmt.Errorf("watch: cannot watch %q: %w", absPath, err), nil))
+		}
+
+		it := &watchIter{watcher: w, root: absPath, opts: opts}
+		it.ctx, it.cancel = common.Context()
+		if opts.Duration > 0 {
+			it.deadline = time.After(opts.Duration)
+		}
+		return it
+	}))
+}
@@ -0,0 +1,133 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query, collecting every output
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) []any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var results []any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+// after runs f once the watch has had time to start
+func after(f func()) {
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		f()
+	}()
+}
+
+func events(t *testing.T, results []any) []string {
+	var out []string
+	for _, r := range results {
+		m := r.(map[string]any)
+		if m["_err"] != nil {
+			t.Fatalf("error event: %v", m["_err"])
+		}
+		out = append(out, m["_meta"].(map[string]any)["event"].(string)+" "+filepath.Base(m["_val"].(string)))
+	}
+	return out
+}
+
+func TestWatchCount(t *testing.T) {
+	dir := t.TempDir()
+	after(func() {
+		os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0644)
+		time.Sleep(50 * time.Millisecond)
+		os.Remove(filepath.Join(dir, "a.txt"))
+	})
+	got := events(t, runGojqQuery(t, `watch("`+dir+`"; {count: 2, duration: "5s"})`, nil, RegisterWatch()))
+	if len(got) != 2 || got[0] != "create a.txt" || got[1] != "delete a.txt" {
+		t.Errorf("events = %v", got)
+	}
+}
+
+func TestWatchDuration(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+	os.WriteFile(path, nil, 0644)
+	after(func() {
+		f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		f.WriteString("line\n")
+		f.Close()
+	})
+	start := time.Now()
+	results := runGojqQuery(t, `watch("`+dir+`"; "400ms")`, nil, RegisterWatch())
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("watch ran for %v", elapsed)
+	}
+	got := events(t, results)
+	if len(got) == 0 || got[0] != "modify log" {
+		t.Errorf("events = %v", got)
+	}
+	meta := results[0].(map[string]any)["_meta"].(map[string]any)
+	if meta["root"] != dir || meta["sequence"] != 1 || meta["time"] == nil {
+		t.Errorf("meta = %v", meta)
+	}
+}
+
+func TestWatchRecursive(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	after(func() {
+		os.WriteFile(filepath.Join(dir, "sub", "deep.txt"), nil, 0644)
+	})
+	got := events(t, runGojqQuery(t, `watch("`+dir+`"; {count: 1, duration: "5s", recursive: true, events: ["create"]})`, nil, RegisterWatch()))
+	if len(got) != 1 || got[0] != "create deep.txt" {
+		t.Errorf("events = %v", got)
+	}
+}
+
+func TestWatchErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`watch("` + filepath.Join(dir, "missing") + `"; 1)`, "watch: path does not exist"},
+		{`watch("` + dir + `"; 0)`, "watch: count must be a positive integer"},
+		{`watch("` + dir + `"; "soon")`, "watch: duration must be positive"},
+		{`watch("` + dir + `"; {events: ["open"]})`, "watch: options.events: unknown event open"},
+		{`watch("` + dir + `"; {recursive: "yes"})`, "watch: options.recursive must be a boolean"},
+		{`watch("` + dir + `"; {depth: 1})`, `watch: unknown option "depth"`},
+		{`watch(1)`, "watch: path must be a non-empty string"},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, nil, RegisterWatch())
+		if len(res) != 1 {
+			t.Fatalf("%s: %d outputs", tt.query, len(res))
+		}
+		if got := common.GetUDFError(res[0]); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, got, tt.want)
+		}
+	}
+}
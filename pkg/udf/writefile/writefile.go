@@ -0,0 +1,124 @@
+package writefile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// defaultMode is the permission of files write_file creates
+const defaultMode os.FileMode = 0644
+
+// contents is what write_file writes for the value v: strings and bytes as
+// they are, and anything else as a line of JSON
+func contents(v any) ([]byte, error) {
+	switch val := common.ExtractUDFValue(v).(type) {
+	case string:
+		return []byte(val), nil
+	case []byte:
+		return val, nil
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return append(b, '\n'), nil
+	}
+}
+
+// RegisterWriteFile registers the write_file function with gojq
+func RegisterWriteFile() gojq.CompilerOption {
+	return common.WithFunction("write_file", 1, 2, common.Audited("write_file", func(v any, args []any) any {
+		// write_file(path; mode): "write" (the default) replaces the file
+		// atomically, "append" adds to the end and "create" fails if the
+		// file already exists
+		filePath, ok := common.ExtractUDFValue(args[0]).(string)
+		if !ok {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "write_file: path must be a string, got %T", common.ExtractUDFValue(args[0])), nil)
+		}
+		if filePath == "" {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "write_file: path cannot be empty"), nil)
+		}
+		mode := "write"
+		if len(args) > 1 {
+			s, ok := common.ExtractUDFValue(args[1]).(string)
+			if !ok {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "write_file: mode must be a string, got %T", common.ExtractUDFValue(args[1])), nil)
+			}
+			mode = s
+		}
+		if mode != "write" && mode != "append" && mode != "create" {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, `write_file: mode must be "write", "append" or "create", got %q`, mode), nil)
+		}
+
+		absPath, err := common.ResolvePath(filePath)
+		if err == nil {
+			err = common.CheckWrite(absPath)
+		}
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("write_file: %w", err), nil)
+		}
+		data, err := contents(v)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("write_file: %w", err), nil)
+		}
+
+		meta := map[string]any{
+			"operation":  "write_file",
+			"path":       absPath,
+			"write_mode": mode,
+		}
+
+		perm := defaultMode
+		info, err := os.Stat(absPath)
+		switch {
+		case err == nil && info.IsDir():
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "write_file: path is a directory: %q", absPath), meta)
+		case err == nil:
+			// Keep the mode of the file being replaced
+			perm = info.Mode().Perm()
+		case !os.IsNotExist(err):
+			return common.MakeUDFErrorResult(fmt.Errorf("write_file: %w", err), meta)
+		}
+		created := err != nil
+
+		switch mode {
+		case "write":
+			err = common.WriteFileAtomic(absPath, data, perm)
+		case "append", "create":
+			flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			if mode == "create" {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+			}
+			var f *os.File
+			if f, err = os.OpenFile(absPath, flags, perm); err == nil {
+				_, err = f.Write(data)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+			}
+		}
+		if err != nil {
+			if os.IsExist(err) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeExists, "write_file: file already exists: %q", absPath), meta)
+			}
+			if os.IsNotExist(err) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodeNotFound, "write_file: directory does not exist: %q", filepath.Dir(absPath)), meta)
+			}
+			if os.IsPermission(err) {
+				return common.MakeUDFErrorResult(common.Errorf(common.CodePermission, "write_file: permission denied writing file: %q", absPath), meta)
+			}
+			return common.MakeUDFErrorResult(fmt.Errorf("write_file: failed to write file %q: %w", absPath, err), meta)
+		}
+
+		meta["bytes_written"] = len(data)
+		meta["mode"] = fmt.Sprintf("%04o", perm)
+		meta["created"] = created
+		meta["atomic"] = mode == "write"
+		return common.MakeUDFSuccessResult(absPath, meta)
+	}))
+}
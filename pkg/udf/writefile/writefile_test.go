@@ -0,0 +1,134 @@
+package writefile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+
+	tests := []struct {
+		name  string
+		query string
+		input any
+		want  string
+	}{
+		{"string", `write_file($p)`, "hello", "hello"},
+		{"replace", `write_file($p; "write")`, "bye", "bye"},
+		{"append", `write_file($p; "append")`, "\nmore", "bye\nmore"},
+		{"object", `write_file($p)`, map[string]any{"a": []any{1, "x"}}, "{\"a\":[1,\"x\"]}\n"},
+		{"envelope", `{_val: "inner", _meta: {}} | write_file($p)`, nil, "inner"},
+		{"bytes", `write_file($p)`, "\x00\xff", "\x00\xff"},
+	}
+	for _, tt := range tests {
+		q, err := gojq.Parse(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := gojq.Compile(q, RegisterWriteFile(), gojq.WithVariables([]string{"$p"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, _ := code.Run(tt.input, path).Next()
+		m := res.(map[string]any)
+		if m["_err"] != nil {
+			t.Fatalf("%s: %v", tt.name, m["_err"])
+		}
+		got, _ := os.ReadFile(path)
+		if string(got) != tt.want {
+			t.Errorf("%s: file = %q, want %q", tt.name, got, tt.want)
+		}
+		if m["_val"] != path || m["_meta"].(map[string]any)["bytes_written"] == nil {
+			t.Errorf("%s: result = %v", tt.name, m)
+		}
+	}
+}
+
+func TestWriteFileMeta(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "new.json")
+
+	res := runGojqQuery(t, `write_file("`+path+`")`, "12345", RegisterWriteFile()).(map[string]any)
+	meta := res["_meta"].(map[string]any)
+	if meta["created"] != true || meta["bytes_written"] != 5 || meta["mode"] != "0644" || meta["atomic"] != true {
+		t.Errorf("new file meta = %v", meta)
+	}
+
+	// Replacing a file keeps its mode
+	os.Chmod(path, 0600)
+	res = runGojqQuery(t, `write_file("`+path+`")`, "x", RegisterWriteFile()).(map[string]any)
+	meta = res["_meta"].(map[string]any)
+	if meta["created"] != false || meta["mode"] != "0600" {
+		t.Errorf("replace meta = %v", meta)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode after replace = %v", info.Mode())
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries", len(entries))
+	}
+}
+
+func TestWriteFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "exists")
+	os.WriteFile(existing, []byte("keep"), 0644)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`write_file("` + existing + `"; "create")`, "write_file: file already exists"},
+		{`write_file("` + dir + `")`, "write_file: path is a directory"},
+		{`write_file("` + filepath.Join(dir, "missing", "f") + `")`, "write_file: directory does not exist"},
+		{`write_file("x"; "truncate")`, `write_file: mode must be "write", "append" or "create"`},
+		{`write_file(1)`, "write_file: path must be a string"},
+		{`write_file("")`, "write_file: path cannot be empty"},
+	}
+	for _, tt := range tests {
+		res := runGojqQuery(t, tt.query, "data", RegisterWriteFile()).(map[string]any)
+		if got := common.GetUDFError(res); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: _err = %q, want prefix %q", tt.query, got, tt.want)
+		}
+	}
+	if got, _ := os.ReadFile(existing); string(got) != "keep" {
+		t.Errorf("create mode overwrote the file: %q", got)
+	}
+}
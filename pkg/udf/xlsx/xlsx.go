@@ -0,0 +1,584 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Sheet describes a worksheet of a workbook
+type Sheet struct {
+	Name   string
+	Index  int
+	Hidden bool
+	target string // path of the sheet part inside the archive
+}
+
+// Workbook is an opened .xlsx file. Cells are only read when a sheet is
+// requested
+type Workbook struct {
+	Sheets []Sheet
+
+	file     *os.File
+	files    map[string]*zip.File
+	strings  []string
+	dateXfs  map[int]bool // style indexes whose number format is a date
+	date1904 bool
+}
+
+// Open opens an .xlsx file and reads its sheet list, shared strings and styles
+func Open(filePath string) (*Workbook, string, error) {
+	f, absPath, size, err := common.OpenFileFromPath(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		f.Close()
+		return nil, "", common.Errorf(common.CodeInvalid, "invalid xlsx file: %w", err)
+	}
+	wb := &Workbook{file: f, files: map[string]*zip.File{}}
+	for _, zf := range zr.File {
+		wb.files[zf.Name] = zf
+	}
+	if err := wb.load(); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	return wb, absPath, nil
+}
+
+// Close closes the underlying file
+func (wb *Workbook) Close() error {
+	return wb.file.Close()
+}
+
+func (wb *Workbook) decode(name string, v any) error {
+	zf, ok := wb.files[name]
+	if !ok {
+		return common.Errorf(common.CodeInvalid, "invalid xlsx file: missing %v", name)
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return common.Errorf(common.CodeInvalid, "invalid xlsx file: %w", err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return common.Errorf(common.CodeInvalid, "invalid xlsx file: %v: %w", name, err)
+	}
+	return nil
+}
+
+type xmlWorkbook struct {
+	WorkbookPr struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name  string `xml:"name,attr"`
+		State string `xml:"state,attr"`
+		RID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xmlRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xmlText is a string item: plain <t> or rich text runs <r><t>
+type xmlText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xmlText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var sb strings.Builder
+	for _, r := range t.Runs {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type xmlSharedStrings struct {
+	Items []xmlText `xml:"si"`
+}
+
+type xmlStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+func (wb *Workbook) load() error {
+	var book xmlWorkbook
+	if err := wb.decode("xl/workbook.xml", &book); err != nil {
+		return err
+	}
+	wb.date1904 = book.WorkbookPr.Date1904 == "1" || book.WorkbookPr.Date1904 == "true"
+
+	var rels xmlRelationships
+	if err := wb.decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return err
+	}
+	targets := map[string]string{}
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join("xl", rel.Target)
+		}
+	}
+	for i, s := range book.Sheets {
+		wb.Sheets = append(wb.Sheets, Sheet{
+			Name:   s.Name,
+			Index:  i,
+			Hidden: s.State == "hidden" || s.State == "veryHidden",
+			target: targets[s.RID],
+		})
+	}
+
+	// Both parts are optional: a workbook of numbers needs no shared strings
+	if _, ok := wb.files["xl/sharedStrings.xml"]; ok {
+		var sst xmlSharedStrings
+		if err := wb.decode("xl/sharedStrings.xml", &sst); err != nil {
+			return err
+		}
+		for _, si := range sst.Items {
+			wb.strings = append(wb.strings, si.String())
+		}
+	}
+	wb.dateXfs = map[int]bool{}
+	if _, ok := wb.files["xl/styles.xml"]; ok {
+		var styles xmlStyles
+		if err := wb.decode("xl/styles.xml", &styles); err != nil {
+			return err
+		}
+		custom := map[int]string{}
+		for _, f := range styles.NumFmts {
+			custom[f.ID] = f.Code
+		}
+		for i, xf := range styles.CellXfs {
+			if isDateFormat(xf.NumFmtID, custom[xf.NumFmtID]) {
+				wb.dateXfs[i] = true
+			}
+		}
+	}
+	return nil
+}
+
+// isDateFormat reports whether a number format displays a date or time.
+// Built-in formats 14-22 and 45-47 are dates; custom formats are dates when
+// they use date or time tokens outside of quoted text and brackets
+func isDateFormat(id int, code string) bool {
+	if (id >= 14 && id <= 22) || (id >= 45 && id <= 47) {
+		return true
+	}
+	if code == "" {
+		return false
+	}
+	inQuote, inBracket := false, false
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case inBracket:
+		case strings.ContainsRune("dmyhs", r):
+			return true
+		}
+	}
+	return false
+}
+
+// FindSheet selects a sheet by name or zero-based index; nil selects the
+// first sheet
+func (wb *Workbook) FindSheet(sel any) (Sheet, error) {
+	if len(wb.Sheets) == 0 {
+		return Sheet{}, fmt.Errorf("workbook has no sheets")
+	}
+	switch s := sel.(type) {
+	case nil:
+		return wb.Sheets[0], nil
+	case string:
+		for _, sheet := range wb.Sheets {
+			if sheet.Name == s {
+				return sheet, nil
+			}
+		}
+		names := make([]string, len(wb.Sheets))
+		for i, sheet := range wb.Sheets {
+			names[i] = strconv.Quote(sheet.Name)
+		}
+		return Sheet{}, common.Errorf(common.CodeNotFound, "sheet %q not found (available: %v)", s, strings.Join(names, ", "))
+	case int:
+		if s < 0 || s >= len(wb.Sheets) {
+			return Sheet{}, common.Errorf(common.CodeInvalid, "sheet index %d out of range (workbook has %d sheets)", s, len(wb.Sheets))
+		}
+		return wb.Sheets[s], nil
+	case float64:
+		if s != math.Trunc(s) {
+			return Sheet{}, common.Errorf(common.CodeInvalid, "sheet index must be an integer, got %v", s)
+		}
+		return wb.FindSheet(int(s))
+	default:
+		return Sheet{}, common.Errorf(common.CodeInvalid, "sheet must be a name or an index, got %T", sel)
+	}
+}
+
+type xmlCell struct {
+	Ref    string  `xml:"r,attr"`
+	Type   string  `xml:"t,attr"`
+	Style  int     `xml:"s,attr"`
+	Value  string  `xml:"v"`
+	Inline xmlText `xml:"is"`
+}
+
+// ReadRows returns the rows of a sheet. Every row is padded with nulls to
+// the width of the widest row, and rows without cells are skipped
+func (wb *Workbook) ReadRows(sheet Sheet) ([][]any, error) {
+	zf, ok := wb.files[sheet.target]
+	if !ok {
+		return nil, common.Errorf(common.CodeInvalid, "invalid xlsx file: missing part for sheet %q", sheet.Name)
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, common.Errorf(common.CodeInvalid, "invalid xlsx file: %w", err)
+	}
+	defer rc.Close()
+
+	// Sheets can be large, so rows are decoded one element at a time
+	var rows [][]any
+	width := 0
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, common.Errorf(common.CodeInvalid, "invalid xlsx file: %v: %w", sheet.target, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row struct {
+			Cells []xmlCell `xml:"c"`
+		}
+		if err := dec.DecodeElement(&row, &start); err != nil {
+			return nil, common.Errorf(common.CodeInvalid, "invalid xlsx file: %v: %w", sheet.target, err)
+		}
+		var values []any
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				if col, err = columnIndex(c.Ref); err != nil {
+					return nil, err
+				}
+			}
+			for len(values) <= col {
+				values = append(values, nil)
+			}
+			if values[col], err = wb.cellValue(c); err != nil {
+				return nil, fmt.Errorf("cell %v: %w", c.Ref, err)
+			}
+		}
+		// Styled but empty cells leave trailing nulls that are not data
+		for len(values) > 0 && values[len(values)-1] == nil {
+			values = values[:len(values)-1]
+		}
+		if len(values) == 0 {
+			continue
+		}
+		width = max(width, len(values))
+		rows = append(rows, values)
+	}
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, nil)
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+func (wb *Workbook) cellValue(c xmlCell) (any, error) {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(wb.strings) {
+			return nil, common.Errorf(common.CodeInvalid, "invalid shared string index %q", c.Value)
+		}
+		return wb.strings[i], nil
+	case "inlineStr":
+		return c.Inline.String(), nil
+	case "str", "e", "d":
+		// Formula strings, error values such as #DIV/0!, and ISO 8601 dates
+		return c.Value, nil
+	case "b":
+		return c.Value == "1", nil
+	}
+	if c.Value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(c.Value, 64)
+	if err != nil {
+		return nil, common.Errorf(common.CodeInvalid, "invalid number %q", c.Value)
+	}
+	if wb.dateXfs[c.Style] {
+		return wb.formatDate(f), nil
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int(f), nil
+	}
+	return f, nil
+}
+
+// formatDate converts a serial date to "2006-01-02", or an RFC 3339 time
+// without zone when it has a time part. Serials below 1 are times of day
+func (wb *Workbook) formatDate(serial float64) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if wb.date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	t := epoch.Add(time.Duration(math.Round(serial*86400)) * time.Second)
+	switch {
+	case serial >= 0 && serial < 1:
+		return t.Format("15:04:05")
+	case serial == math.Trunc(serial):
+		return t.Format("2006-01-02")
+	default:
+		return t.Format("2006-01-02T15:04:05")
+	}
+}
+
+// columnIndex returns the zero-based column of a cell reference like "AB12"
+func columnIndex(ref string) (int, error) {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+	}
+	if i == 0 || col > 16384 {
+		return 0, common.Errorf(common.CodeInvalid, "invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// options are the settings accepted by xlsx_read
+type options struct {
+	Sheet   any      // sheet name or index, nil for the first
+	Headers bool     // the first row holds column names
+	Columns []string // explicit column names, every row is data
+}
+
+func parseOptions(m map[string]any) (options, error) {
+	var opts options
+	for key, raw := range m {
+		switch key {
+		case "sheet":
+			opts.Sheet = raw
+		case "headers":
+			switch h := raw.(type) {
+			case bool:
+				opts.Headers = h
+			case []any:
+				for _, c := range h {
+					name, ok := c.(string)
+					if !ok {
+						return opts, common.Errorf(common.CodeInvalid, "options.headers must be a boolean or an array of strings, got element %T", c)
+					}
+					opts.Columns = append(opts.Columns, name)
+				}
+			default:
+				return opts, common.Errorf(common.CodeInvalid, "options.headers must be a boolean or an array of strings, got %T", raw)
+			}
+		default:
+			return opts, common.Errorf(common.CodeInvalid, "unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// toObjects keys each row by column name. Empty names become column_N and
+// repeated names get a numeric suffix
+func toObjects(rows [][]any, headers []any) []any {
+	names := make([]string, len(headers))
+	seen := map[string]int{}
+	for i, h := range headers {
+		var name string
+		switch v := h.(type) {
+		case nil:
+		case string:
+			name = v
+		default:
+			name = fmt.Sprint(v)
+		}
+		if name == "" {
+			name = "column_" + strconv.Itoa(i+1)
+		}
+		if n := seen[name]; n > 0 {
+			seen[name] = n + 1
+			name += "_" + strconv.Itoa(n+1)
+		} else {
+			seen[name] = 1
+		}
+		names[i] = name
+	}
+
+	result := make([]any, len(rows))
+	for i, row := range rows {
+		obj := make(map[string]any, len(names))
+		for j, name := range names {
+			if j < len(row) {
+				obj[name] = row[j]
+			} else {
+				obj[name] = nil
+			}
+		}
+		result[i] = obj
+	}
+	return result
+}
+
+func sheetNames(wb *Workbook) []any {
+	names := make([]any, len(wb.Sheets))
+	for i, s := range wb.Sheets {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// RegisterXLSXRead registers the xlsx_read function with gojq
+func RegisterXLSXRead() gojq.CompilerOption {
+	return common.WithFunction("xlsx_read", 0, 2, func(v any, args []any) any {
+		// xlsx_read, xlsx_read(path), xlsx_read(options),
+		// xlsx_read(path; sheet) or xlsx_read(path; options)
+		pathVal := v
+		var opts options
+		var err error
+		switch len(args) {
+		case 1:
+			if m, ok := common.ExtractUDFValue(args[0]).(map[string]any); ok {
+				opts, err = parseOptions(m)
+			} else {
+				pathVal = args[0]
+			}
+		case 2:
+			pathVal = args[0]
+			if m, ok := common.ExtractUDFValue(args[1]).(map[string]any); ok {
+				opts, err = parseOptions(m)
+			} else {
+				opts.Sheet = common.ExtractUDFValue(args[1])
+			}
+		}
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("xlsx_read: %w", err), nil)
+		}
+
+		filePath, ok := common.ExtractUDFValue(pathVal).(string)
+		if !ok || filePath == "" {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "xlsx_read: path must be a non-empty string, got %T", common.ExtractUDFValue(pathVal)), nil)
+		}
+		wb, absPath, err := Open(filePath)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("xlsx_read: %w", err), nil)
+		}
+		defer wb.Close()
+
+		sheet, err := wb.FindSheet(opts.Sheet)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("xlsx_read: %w", err), nil)
+		}
+		rows, err := wb.ReadRows(sheet)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("xlsx_read: %w", err), nil)
+		}
+
+		columns := 0
+		if len(rows) > 0 {
+			columns = len(rows[0])
+		}
+		var result []any
+		switch {
+		case opts.Columns != nil:
+			headers := make([]any, len(opts.Columns))
+			for i, c := range opts.Columns {
+				headers[i] = c
+			}
+			result = toObjects(rows, headers)
+		case opts.Headers && len(rows) > 0:
+			result = toObjects(rows[1:], rows[0])
+		default:
+			result = make([]any, len(rows))
+			for i, row := range rows {
+				result[i] = row
+			}
+		}
+
+		meta := map[string]any{
+			"operation": "xlsx_read",
+			"file_path": absPath,
+			"sheet":     sheet.Name,
+			"sheets":    sheetNames(wb),
+			"rows":      len(result),
+			"columns":   columns,
+		}
+		return common.MakeUDFSuccessResult(result, meta)
+	})
+}
+
+// RegisterXLSXSheets registers the xlsx_sheets function with gojq
+func RegisterXLSXSheets() gojq.CompilerOption {
+	return common.WithFunction("xlsx_sheets", 0, 1, func(v any, args []any) any {
+		pathVal := v
+		if len(args) > 0 {
+			pathVal = args[0]
+		}
+		filePath, ok := common.ExtractUDFValue(pathVal).(string)
+		if !ok || filePath == "" {
+			return common.MakeUDFErrorResult(common.Errorf(common.CodeInvalid, "xlsx_sheets: path must be a non-empty string, got %T", common.ExtractUDFValue(pathVal)), nil)
+		}
+		wb, absPath, err := Open(filePath)
+		if err != nil {
+			return common.MakeUDFErrorResult(fmt.Errorf("xlsx_sheets: %w", err), nil)
+		}
+		defer wb.Close()
+
+		sheets := make([]any, len(wb.Sheets))
+		for i, s := range wb.Sheets {
+			sheets[i] = map[string]any{"name": s.Name, "index": s.Index, "hidden": s.Hidden}
+		}
+		meta := map[string]any{
+			"operation": "xlsx_sheets",
+			"file_path": absPath,
+			"count":     len(sheets),
+		}
+		return common.MakeUDFSuccessResult(sheets, meta)
+	})
+}
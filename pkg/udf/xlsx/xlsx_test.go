@@ -0,0 +1,230 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/xen0bit/pwrq/pkg/udf/common"
+)
+
+// Helper to compile and run a gojq query
+func runGojqQuery(t *testing.T, query string, input any, options ...gojq.CompilerOption) any {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+
+	code, err := gojq.Compile(q, options...)
+	if err != nil {
+		t.Fatalf("Failed to compile query %q: %v", query, err)
+	}
+
+	var result any
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			t.Fatalf("Query execution failed: %v", err)
+		}
+		result = v
+	}
+	return result
+}
+
+// writeWorkbook writes a minimal workbook with a data sheet, a hidden
+// second sheet and a custom date format
+func writeWorkbook(t *testing.T) string {
+	t.Helper()
+	parts := map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+  <sheets>
+    <sheet name="People" sheetId="1" r:id="rId1"/>
+    <sheet name="Notes" sheetId="2" state="hidden" r:id="rId2"/>
+  </sheets>
+</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+  <Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <si><t>name</t></si>
+  <si><t>age</t></si>
+  <si><t>joined</t></si>
+  <si><r><t>Ada </t></r><r><t>Lovelace</t></r></si>
+</sst>`,
+		"xl/styles.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <numFmts><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd\ hh:mm"/></numFmts>
+  <cellXfs>
+    <xf numFmtId="0"/>
+    <xf numFmtId="14"/>
+    <xf numFmtId="164"/>
+    <xf numFmtId="165"/>
+  </cellXfs>
+</styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <sheetData>
+    <row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c></row>
+    <row r="2"><c r="A2" t="s"><v>3</v></c><c r="B2"><v>36</v></c><c r="C2" s="1"><v>45292</v></c></row>
+    <row r="3"><c r="A3" t="inlineStr"><is><t>Bob</t></is></c><c r="C3" s="2"><v>45292.5</v></c><c r="D3" s="3"/></row>
+    <row r="4"></row>
+    <row r="5"><c r="A5" t="b"><v>1</v></c><c r="B5"><v>1.25</v></c><c r="C5" t="e"><v>#DIV/0!</v></c></row>
+  </sheetData>
+</worksheet>`,
+		"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <sheetData><row r="1"><c r="B1" t="str"><v>note</v></c></row></sheetData>
+</worksheet>`,
+	}
+
+	path := filepath.Join(t.TempDir(), "book.xlsx")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestXLSXRead(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterXLSXRead()}
+	path := writeWorkbook(t)
+
+	result := runGojqQuery(t, `xlsx_read`, path, opts...)
+	got := result.(map[string]any)
+	want := []any{
+		[]any{"name", "age", "joined"},
+		[]any{"Ada Lovelace", 36, "2024-01-01"},
+		[]any{"Bob", nil, "2024-01-01T12:00:00"},
+		[]any{true, 1.25, "#DIV/0!"},
+	}
+	if !reflect.DeepEqual(got["_val"], want) {
+		t.Errorf("Rows mismatch:\n got: %v\nwant: %v", got["_val"], want)
+	}
+	meta := got["_meta"].(map[string]any)
+	if meta["sheet"] != "People" || meta["rows"] != 4 || meta["columns"] != 3 ||
+		!reflect.DeepEqual(meta["sheets"], []any{"People", "Notes"}) {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+
+	result = runGojqQuery(t, `xlsx_read(.; {headers: true}) | ._val[0:2]`, path, opts...)
+	wantObjects := []any{
+		map[string]any{"name": "Ada Lovelace", "age": 36, "joined": "2024-01-01"},
+		map[string]any{"name": "Bob", "age": nil, "joined": "2024-01-01T12:00:00"},
+	}
+	if !reflect.DeepEqual(result, wantObjects) {
+		t.Errorf("Headers mismatch:\n got: %v\nwant: %v", result, wantObjects)
+	}
+
+	result = runGojqQuery(t, `xlsx_read({headers: ["a", "b", "c"]}) | ._val[0]`, path, opts...)
+	if !reflect.DeepEqual(result, map[string]any{"a": "name", "b": "age", "c": "joined"}) {
+		t.Errorf("Explicit headers mismatch: %v", result)
+	}
+
+	// Sheets can be selected by name or index
+	for _, sel := range []string{`"Notes"`, `1`, `{sheet: "Notes"}`} {
+		result = runGojqQuery(t, `xlsx_read(.; `+sel+`) | ._val`, path, opts...)
+		if !reflect.DeepEqual(result, []any{[]any{nil, "note"}}) {
+			t.Errorf("Sheet %s mismatch: %v", sel, result)
+		}
+	}
+}
+
+func TestXLSXSheets(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterXLSXSheets()}
+	path := writeWorkbook(t)
+
+	result := runGojqQuery(t, `xlsx_sheets(.)`, path, opts...)
+	got := result.(map[string]any)
+	want := []any{
+		map[string]any{"name": "People", "index": 0, "hidden": false},
+		map[string]any{"name": "Notes", "index": 1, "hidden": true},
+	}
+	if !reflect.DeepEqual(got["_val"], want) {
+		t.Errorf("Sheets mismatch:\n got: %v\nwant: %v", got["_val"], want)
+	}
+	if got["_meta"].(map[string]any)["count"] != 2 {
+		t.Errorf("Unexpected metadata %v", got["_meta"])
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	tests := []struct {
+		id   int
+		code string
+		want bool
+	}{
+		{14, "", true},
+		{22, "", true},
+		{0, "", false},
+		{2, "0.00", false},
+		{164, "yyyy-mm-dd", true},
+		{165, `[Red]0.00`, false},
+		{166, `"days"0`, false},
+		{167, "[h]:mm:ss", true},
+	}
+	for _, tt := range tests {
+		if got := isDateFormat(tt.id, tt.code); got != tt.want {
+			t.Errorf("isDateFormat(%d, %q) = %v, want %v", tt.id, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXErrors(t *testing.T) {
+	opts := []gojq.CompilerOption{RegisterXLSXRead(), RegisterXLSXSheets()}
+	path := writeWorkbook(t)
+	notZip := filepath.Join(t.TempDir(), "plain.xlsx")
+	if err := os.WriteFile(notZip, []byte("a,b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		input any
+		want  string
+	}{
+		{`xlsx_read`, "/nonexistent/book.xlsx", "xlsx_read: file does not exist"},
+		{`xlsx_read`, notZip, "xlsx_read: invalid xlsx file"},
+		{`xlsx_read`, 5, "xlsx_read: path must be a non-empty string"},
+		{`xlsx_read(.; "Missing")`, path, `xlsx_read: sheet "Missing" not found (available: "People", "Notes")`},
+		{`xlsx_read(.; 7)`, path, "xlsx_read: sheet index 7 out of range"},
+		{`xlsx_read(.; true)`, path, "xlsx_read: sheet must be a name or an index"},
+		{`xlsx_read({bogus: 1})`, path, `xlsx_read: unknown option "bogus"`},
+		{`xlsx_sheets`, notZip, "xlsx_sheets: invalid xlsx file"},
+	}
+	for _, tt := range tests {
+		result := runGojqQuery(t, tt.query, tt.input, opts...)
+		obj, _ := result.(map[string]any)
+		errStr := common.GetUDFError(obj)
+		if !strings.HasPrefix(errStr, tt.want) {
+			t.Errorf("%s: expected error starting with %q, got %v", tt.query, tt.want, result)
+		}
+	}
+}
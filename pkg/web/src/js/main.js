@@ -80,8 +80,26 @@ function doValidateQuery() {
     }
 }
 
+// diagramOptions reads the options of createSVG from the form. The "auto"
+// theme follows the color scheme of the page
+function diagramOptions() {
+    const form = document.getElementById("diagram-options");
+    let theme = form.elements.theme.value;
+    if (theme === "auto") {
+        theme = window.matchMedia("(prefers-color-scheme: dark)").matches ? "dark" : "light";
+    }
+    return {
+        theme,
+        layout: form.elements.layout.value,
+        direction: form.elements.direction.value,
+        sketch: form.elements.sketch.checked,
+    };
+}
+
 // Generate SVG
-function generateSVG() {
+let generation = 0;
+
+async function generateSVG() {
     const query = document.getElementById("query").value;
     const svgContainer = document.getElementById("svg-container");
 
@@ -91,26 +109,30 @@ function generateSVG() {
     }
 
     // Check if WASM functions are available
-    if (typeof window.createSVG !== 'function') {
+    if (typeof window.createSVGAsync !== 'function') {
         return;
     }
 
+    // Only the latest query's diagram is shown, if the user typed on
+    const current = ++generation;
     try {
-        const result = window.createSVG(query);
-
-        // Go WASM returns a plain JavaScript object from map[string]interface{}
-        const svg = result && result.svg ? result.svg : "";
-        const err = result && result.err ? result.err : "";
-
-        if (err) {
-            svgContainer.innerHTML = "<p><em>Error generating SVG: " + err + "</em></p>";
-        } else if (svg) {
+        const svg = await window.createSVGAsync(query, diagramOptions(), (stage, step, steps) => {
+            if (current === generation) {
+                svgContainer.innerHTML = "<p><em>Generating diagram: " + stage + " (" + step + "/" + steps + ")...</em></p>";
+            }
+        });
+        if (current !== generation) {
+            return;
+        }
+        if (svg) {
             svgContainer.innerHTML = svg;
         } else {
             svgContainer.innerHTML = "<p><em>No SVG generated.</em></p>";
         }
     } catch (error) {
-        svgContainer.innerHTML = "<p><em>Error generating SVG.</em></p>";
+        if (current === generation) {
+            svgContainer.innerHTML = "<p><em>Error generating SVG: " + error.message + "</em></p>";
+        }
     }
 }
 
@@ -126,13 +148,45 @@ queryInput.addEventListener("input", () => {
     }, 300); // Wait 300ms after user stops typing
 });
 
+// Download the diagram as a PNG
+async function downloadPNG() {
+    const query = document.getElementById("query").value;
+    if (!query || typeof window.createPNG !== 'function') {
+        return;
+    }
+    try {
+        const png = await window.createPNG(query, 2, diagramOptions());
+        const link = document.createElement("a");
+        link.href = URL.createObjectURL(png);
+        link.download = "pwrq-flow.png";
+        link.click();
+        setTimeout(() => URL.revokeObjectURL(link.href), 0);
+    } catch (error) {
+        document.getElementById("svg-container").innerHTML = "<p><em>Error generating PNG: " + error.message + "</em></p>";
+    }
+}
+
+document.getElementById("download-png").addEventListener("click", downloadPNG);
+
+// Redraw the diagram when its options change
+document.getElementById("diagram-options").addEventListener("change", () => {
+    if (queryInput.getAttribute("aria-invalid") === "false") {
+        generateSVG();
+    }
+});
+window.matchMedia("(prefers-color-scheme: dark)").addEventListener("change", () => {
+    if (document.getElementById("diagram-options").elements.theme.value === "auto") {
+        generateSVG();
+    }
+});
+
 // Initialize WASM on page load
 (async () => {
     try {
         await initWASM();
 
         // Verify WASM functions are available
-        if (typeof window.validateQuery !== 'function' || typeof window.createSVG !== 'function') {
+        if (typeof window.validateQuery !== 'function' || typeof window.createSVGAsync !== 'function') {
             console.error("WASM functions not available");
             const textarea = document.getElementById("query");
             textarea.setAttribute("aria-invalid", "true");